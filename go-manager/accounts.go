@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// account is one set of Proton credentials. Each keeps its own session, in a
+// file or under SessionKey in the secret backend, so switching accounts
+// doesn't throw away the other sessions.
+type account struct {
+	Username    string
+	Password    string
+	SessionFile string
+	SessionKey  string
+}
+
+// accounts holds PROTON_USERNAME/PROTON_PASSWORD followed by any numbered
+// extras (PROTON_USERNAME_2, PROTON_PASSWORD_2, ...). It always has at least
+// one entry, possibly with empty credentials.
+var accounts []account
+
+func parseAccounts() []account {
+	list := []account{{
+		Username:    credential("PROTON_USERNAME"),
+		Password:    credential("PROTON_PASSWORD"),
+		SessionFile: cfg.sessionFile,
+		SessionKey:  "proton_session",
+	}}
+	for n := 2; ; n++ {
+		suffix := "_" + strconv.Itoa(n)
+		user := credential("PROTON_USERNAME" + suffix)
+		if user == "" {
+			return list
+		}
+		list = append(list, account{
+			Username:    user,
+			Password:    credential("PROTON_PASSWORD" + suffix),
+			SessionFile: strings.TrimSuffix(cfg.sessionFile, ".json") + suffix + ".json",
+			SessionKey:  "proton_session" + suffix,
+		})
+	}
+}
+
+func (pm *ProtonManager) acct() account {
+	return accounts[pm.account]
+}
+
+// useAccount makes account i current, dropping the previous account's client.
+// The caller logs in or resumes the new account's session.
+func (pm *ProtonManager) useAccount(i int) {
+	if pm.client != nil {
+		pm.client.Close()
+		pm.client = nil
+	}
+	pm.account = i
+	pm.accountSince = time.Now()
+	pm.uid, pm.accessToken, pm.refreshToken = "", "", ""
+	pm.tokenIssued, pm.learnedLifetime = time.Time{}, 0
+}
+
+// rotateAccount moves on to the next account and brings up its session. It
+// returns false if there is no other account or its session failed; the
+// next 401 then logs in with whichever account works. Callers hold pm.mu.
+func (pm *ProtonManager) rotateAccount(why string) bool {
+	if len(accounts) < 2 {
+		return false
+	}
+	next := (pm.account + 1) % len(accounts)
+	log(fmt.Sprintf("Rotating Proton account %s -> %s (%s)", pm.acct().Username, accounts[next].Username, why))
+	pm.useAccount(next)
+	if err := pm.initSession(); err != nil {
+		return false
+	}
+	return true
+}
+
+// rotationDue reports whether the current account has been used for
+// ACCOUNT_ROTATION_INTERVAL.
+func (pm *ProtonManager) rotationDue() bool {
+	return cfg.accountRotationInterval > 0 &&
+		time.Since(pm.accountSince) >= time.Duration(cfg.accountRotationInterval)*time.Second
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/protonapi/protontest"
+)
+
+func TestParseAccounts(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	secrets = nil
+	cfg.sessionFile = "/data/session.json"
+	t.Setenv("PROTON_USERNAME", "alice")
+	t.Setenv("PROTON_PASSWORD", "a-secret")
+	t.Setenv("PROTON_USERNAME_2", "bob")
+	t.Setenv("PROTON_PASSWORD_2", "b-secret")
+	// Numbering stops at the first gap
+	t.Setenv("PROTON_USERNAME_4", "dave")
+
+	got := parseAccounts()
+	want := []account{
+		{"alice", "a-secret", "/data/session.json", "proton_session"},
+		{"bob", "b-secret", "/data/session_2.json", "proton_session_2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parsed %d accounts, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("account %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	t.Setenv("PROTON_USERNAME", "")
+	t.Setenv("PROTON_USERNAME_2", "")
+	if got := parseAccounts(); len(got) != 1 || got[0].Username != "" {
+		t.Errorf("without credentials: %+v, want one empty account", got)
+	}
+}
+
+func TestAccountRotationInterval(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice", "bob")
+	cfg.accountRotationInterval = 3600
+
+	for _, tc := range []struct {
+		used time.Duration
+		want string
+	}{
+		{time.Minute, "alice"},
+		{2 * time.Hour, "bob"},
+		{time.Minute, "bob"},
+		{time.Hour, "alice"}, // wraps around
+	} {
+		// The fake API has a single session, so the accounts share its tokens
+		access, refresh := srv.Tokens()
+		for i := range accounts {
+			(&ProtonManager{account: i, uid: protontest.UID, accessToken: access, refreshToken: refresh}).saveSession()
+		}
+		pm.accountSince = time.Now().Add(-tc.used)
+		if _, err := pm.Servers(); err != nil {
+			t.Fatal(err)
+		}
+		if got := pm.acct().Username; got != tc.want {
+			t.Errorf("after %s on the account: using %s, want %s", tc.used, got, tc.want)
+		}
+	}
+	if time.Since(pm.accountSince) > time.Minute {
+		t.Error("rotation didn't restart the interval")
+	}
+
+	cfg.accountRotationInterval = 0
+	pm.accountSince = time.Time{}
+	if pm.rotationDue() {
+		t.Error("rotation due with ACCOUNT_ROTATION_INTERVAL=0")
+	}
+}
+
+func TestRotateAccountAlone(t *testing.T) {
+	newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	if pm.rotateAccount("test") {
+		t.Error("rotated with a single account")
+	}
+	if pm.acct().Username != "alice" || pm.accessToken == "" {
+		t.Errorf("single account lost its session: %s", pm.acct().Username)
+	}
+}
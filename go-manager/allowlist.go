@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/retry"
+)
+
+// Remote allowlists are kept up to date with the exit IP by a command
+// (ALLOWLIST_COMMAND, e.g. ssh to a VPS firewall) and/or an HTTP call
+// (ALLOWLIST_URL with a templated ALLOWLIST_BODY). Both get the new exit IP
+// and the one pushed before it, so the old one can be removed.
+
+// pushAllowlist sends ip, replacing old, to the configured allowlists.
+func pushAllowlist(ip, old string) error {
+	if cfg.allowlistCommand != "" {
+		if err := runAllowlistCommand(ip, old); err != nil {
+			return err
+		}
+	}
+	if cfg.allowlistURL != "" {
+		return callAllowlistURL(ip, old)
+	}
+	return nil
+}
+
+// runAllowlistCommand runs ALLOWLIST_COMMAND with sh, passing the IPs in
+// NEW_IP and OLD_IP.
+func runAllowlistCommand(ip, old string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", cfg.allowlistCommand)
+	cmd.Env = append(os.Environ(), "NEW_IP="+ip, "OLD_IP="+old)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("ALLOWLIST_COMMAND timed out after a minute")
+	}
+	if err != nil {
+		return fmt.Errorf("ALLOWLIST_COMMAND: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// callAllowlistURL sends ALLOWLIST_BODY to ALLOWLIST_URL, with {ip} and
+// {old_ip} filled in in both.
+func callAllowlistURL(ip, old string) error {
+	fill := strings.NewReplacer("{ip}", ip, "{old_ip}", old).Replace
+	var body io.Reader
+	if cfg.allowlistBody != "" {
+		body = strings.NewReader(fill(cfg.allowlistBody))
+	}
+	req, err := http.NewRequest(cfg.allowlistMethod, fill(cfg.allowlistURL), body)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", cfg.allowlistContentType)
+	}
+	if cfg.allowlistAuthorization != "" {
+		req.Header.Set("Authorization", cfg.allowlistAuthorization)
+	}
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("ALLOWLIST_URL: HTTP %s", resp.Status)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// allowlistProblems reports ALLOWLIST_* settings that can't work.
+func allowlistProblems() []string {
+	if cfg.allowlistURL == "" {
+		return nil
+	}
+	var problems []string
+	if u, err := url.Parse(cfg.allowlistURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("ALLOWLIST_URL must be an http(s) URL, got %q", cfg.allowlistURL))
+	}
+	if !strings.Contains(cfg.allowlistURL+cfg.allowlistBody, "{ip}") {
+		problems = append(problems, "ALLOWLIST_URL or ALLOWLIST_BODY must contain {ip}")
+	}
+	return problems
+}
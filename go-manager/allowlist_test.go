@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllowlistFollowsExitIP(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	out := filepath.Join(t.TempDir(), "allowlist")
+	cfg.allowlistCommand = `echo "$OLD_IP -> $NEW_IP" >> ` + out
+
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" || r.Method != "PUT" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.Path+" "+string(body))
+	}))
+	defer srv.Close()
+	cfg.allowlistURL, cfg.allowlistMethod = srv.URL+"/rules/{ip}", "PUT"
+	cfg.allowlistBody, cfg.allowlistAuthorization = `{"add": "{ip}", "remove": "{old_ip}"}`, "Bearer tok"
+
+	statuses := make(chan Status, 4)
+	statuses <- Status{ExitIP: "203.0.113.7"}
+	statuses <- Status{ExitIP: "203.0.113.7"} // unchanged
+	statuses <- Status{}
+	statuses <- Status{ExitIP: "203.0.113.8"}
+	close(statuses)
+	followExitIP(statuses, "remote allowlist", pushAllowlist)
+
+	if data, _ := os.ReadFile(out); string(data) != " -> 203.0.113.7\n203.0.113.7 -> 203.0.113.8\n" {
+		t.Errorf("command saw %q", data)
+	}
+	if len(bodies) != 2 || bodies[1] != `/rules/203.0.113.8 {"add": "203.0.113.8", "remove": "203.0.113.7"}` {
+		t.Errorf("URL got %q", bodies)
+	}
+
+	cfg.allowlistAuthorization = "Bearer wrong"
+	if err := callAllowlistURL("203.0.113.9", ""); err == nil {
+		t.Error("a rejected call went unnoticed")
+	}
+	cfg.allowlistCommand = "exit 3"
+	if err := runAllowlistCommand("203.0.113.9", ""); err == nil {
+		t.Error("a failing command went unnoticed")
+	}
+}
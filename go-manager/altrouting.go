@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// When the VPN is down the host's DNS is often what broke, or the network
+// blocks Proton outright. The manager then resolves the API over
+// DNS-over-HTTPS and, failing a direct connection, goes through Proton's
+// alternative routing proxies, the same mechanism the official clients use.
+
+// dohResolvers are addressed by IP so they work without system DNS.
+var dohResolvers = []string{
+	"https://1.1.1.1/dns-query",
+	"https://8.8.8.8/resolve",
+}
+
+// altRoutingPins are the SPKI hashes of Proton's alternative routing proxy
+// certificates, as pinned by Proton's own clients. The proxies' hostnames are
+// random, so the pin is what authenticates them.
+var altRoutingPins = []string{
+	"EU6TS9MO0L/GsDHvVc9D5fChYLNy5JdGYpJw0ccgetM=",
+	"iKPIHPnDNqdkvOnTClQ8zQAIKG0XavaPkcEo0LBAABA=",
+	"MSlVrBCdL0hKyczvgYVSRNm88RicyY04Q2y5qrBt0xA=",
+	"C2UxW0T1Ckl9s+8cXfjXxlEqwAfPM4HiW2y3UdtBeCw=",
+}
+
+// altRouteTTL is how long a working proxy is used before trying direct again.
+const altRouteTTL = 24 * time.Hour
+
+var (
+	altMu      sync.Mutex
+	altHost    string
+	altExpires time.Time
+)
+
+// apiTransport carries all Proton API traffic, including the login and
+// refresh calls made by go-proton-api.
+var apiTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	DialContext:         apiDialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// dohTransport queries the DoH resolvers, which are addressed by IP.
+var dohTransport = &http.Transport{
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// altTransport talks to alternative routing proxies, verified by pin.
+var altTransport = &http.Transport{
+	DialContext:         apiDialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+	TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection:   verifyAltRoutingPin,
+	},
+}
+
+// configureAPIProxy sends all API traffic, DoH lookups included, through
+// API_PROXY_URL for environments where only a proxy can reach the internet.
+func configureAPIProxy() error {
+	if cfg.apiProxyURL == "" {
+		return nil
+	}
+	if err := health.ApplyProxy(apiTransport, cfg.apiProxyURL); err != nil {
+		return err
+	}
+	if err := health.ApplyProxy(altTransport, cfg.apiProxyURL); err != nil {
+		return err
+	}
+	if err := health.ApplyProxy(dohTransport, cfg.apiProxyURL); err != nil {
+		return err
+	}
+	log("Proton API traffic goes through API_PROXY_URL")
+	return nil
+}
+
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+var dohTypes = map[string]int{"A": 1, "TXT": 16, "AAAA": 28}
+
+// dohLookup resolves name over DNS-over-HTTPS, trying each resolver in turn.
+func dohLookup(ctx context.Context, name, qtype string) ([]string, error) {
+	client := &http.Client{Transport: dohTransport, Timeout: 10 * time.Second}
+	var lastErr error
+	for _, resolver := range dohResolvers {
+		req, err := http.NewRequestWithContext(ctx, "GET",
+			resolver+"?name="+url.QueryEscape(name)+"&type="+qtype, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/dns-json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var result dohResponse
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if result.Status != 0 {
+			lastErr = fmt.Errorf("DoH lookup of %s failed with rcode %d", name, result.Status)
+			continue
+		}
+
+		var records []string
+		for _, a := range result.Answer {
+			if a.Type == dohTypes[qtype] {
+				records = append(records, strings.Trim(a.Data, `"`))
+			}
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+		lastErr = fmt.Errorf("no %s records for %s", qtype, name)
+	}
+	return nil, lastErr
+}
+
+// apiDialContext dials with the system resolver, falling back to DoH when
+// the name doesn't resolve.
+func apiDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 15 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	var dnsErr *net.DNSError
+	if err == nil || !errors.As(err, &dnsErr) {
+		return conn, err
+	}
+
+	host, port, splitErr := net.SplitHostPort(addr)
+	if splitErr != nil {
+		return nil, err
+	}
+	ips, dohErr := dohLookup(ctx, host, "A")
+	if dohErr != nil {
+		return nil, fmt.Errorf("%v (DoH: %v)", err, dohErr)
+	}
+	for _, ip := range ips {
+		if conn, dialErr := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); dialErr == nil {
+			return conn, nil
+		} else {
+			err = dialErr
+		}
+	}
+	return nil, err
+}
+
+// alternativeHosts looks up Proton's alternative routing proxies for the API
+// host, published as TXT records under d<base32(host)>.protonpro.xyz.
+func alternativeHosts(ctx context.Context) ([]string, error) {
+	u, err := url.Parse(cfg.apiBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	encoded := strings.TrimRight(base32.StdEncoding.EncodeToString([]byte(u.Hostname())), "=")
+	return dohLookup(ctx, "d"+encoded+".protonpro.xyz", "TXT")
+}
+
+func verifyAltRoutingPin(cs tls.ConnectionState) error {
+	for _, cert := range cs.PeerCertificates {
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		if slices.Contains(altRoutingPins, base64.StdEncoding.EncodeToString(sum[:])) {
+			return nil
+		}
+	}
+	return x509.UnknownAuthorityError{}
+}
+
+// currentAltHost returns the proxy in use, if alternative routing is active.
+func currentAltHost() string {
+	altMu.Lock()
+	defer altMu.Unlock()
+	if time.Now().After(altExpires) {
+		altHost = ""
+	}
+	return altHost
+}
+
+func setAltHost(host string) {
+	altMu.Lock()
+	defer altMu.Unlock()
+	altHost, altExpires = host, time.Now().Add(altRouteTTL)
+}
+
+// sendAPI issues req against the API, switching to an alternative routing
+// proxy when the API can't be reached directly. newReq builds the request
+// for a given base URL.
+func sendAPI(newReq func(base string) (*http.Request, error)) (*http.Response, error) {
+	if host := currentAltHost(); host != "" {
+		req, err := newReq("https://" + host)
+		if err != nil {
+			return nil, err
+		}
+		return (&http.Client{Transport: altTransport, Timeout: 30 * time.Second}).Do(req)
+	}
+
+	req, err := newReq(cfg.apiBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Transport: apiTransport, Timeout: 30 * time.Second}).Do(req)
+	if err == nil || !cfg.altRouting {
+		return resp, err
+	}
+
+	log(fmt.Sprintf("Proton API unreachable (%v), trying alternative routing", err))
+	hosts, lookupErr := alternativeHosts(req.Context())
+	if lookupErr != nil {
+		log(fmt.Sprintf("Alternative routing lookup failed: %v", lookupErr))
+		return nil, err
+	}
+	for _, host := range hosts {
+		altReq, reqErr := newReq("https://" + host)
+		if reqErr != nil {
+			return nil, reqErr
+		}
+		resp, altErr := (&http.Client{Transport: altTransport, Timeout: 30 * time.Second}).Do(altReq)
+		if altErr == nil {
+			log(fmt.Sprintf("Reached Proton API through alternative routing (%s)", host))
+			setAltHost(host)
+			return resp, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useDoHResolvers points the DoH lookups at test resolvers until the test
+// ends.
+func useDoHResolvers(t *testing.T, handlers ...http.HandlerFunc) {
+	t.Helper()
+	prevResolvers, prevTransport := dohResolvers, dohTransport
+	t.Cleanup(func() { dohResolvers, dohTransport = prevResolvers, prevTransport })
+	dohResolvers = nil
+	for _, h := range handlers {
+		srv := httptest.NewTLSServer(h)
+		t.Cleanup(srv.Close)
+		dohResolvers = append(dohResolvers, srv.URL+"/dns-query")
+		dohTransport = srv.Client().Transport.(*http.Transport)
+	}
+}
+
+func dohAnswer(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/dns-json" {
+			http.Error(w, "bad accept header", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(body))
+	}
+}
+
+func TestDoHLookup(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	for _, tc := range []struct {
+		name      string
+		qtype     string
+		resolvers []http.HandlerFunc
+		want      []string
+	}{
+		{"A records", "A", []http.HandlerFunc{
+			dohAnswer(`{"Status":0,"Answer":[{"type":5,"data":"cname.example."},{"type":1,"data":"185.159.159.140"},{"type":1,"data":"185.159.159.148"}]}`),
+		}, []string{"185.159.159.140", "185.159.159.148"}},
+		{"TXT quotes stripped", "TXT", []http.HandlerFunc{
+			dohAnswer(`{"Status":0,"Answer":[{"type":16,"data":"\"3.120.13.81\""}]}`),
+		}, []string{"3.120.13.81"}},
+		{"NXDOMAIN", "A", []http.HandlerFunc{dohAnswer(`{"Status":3}`)}, nil},
+		{"no records of the type", "AAAA", []http.HandlerFunc{
+			dohAnswer(`{"Status":0,"Answer":[{"type":1,"data":"185.159.159.140"}]}`),
+		}, nil},
+		{"next resolver after a failure", "A", []http.HandlerFunc{
+			dohAnswer(`not json`),
+			dohAnswer(`{"Status":2}`),
+			dohAnswer(`{"Status":0,"Answer":[{"type":1,"data":"185.159.159.140"}]}`),
+		}, []string{"185.159.159.140"}},
+	} {
+		useDoHResolvers(t, tc.resolvers...)
+		got, err := dohLookup(context.Background(), "vpn-api.proton.me", tc.qtype)
+		if !slices.Equal(got, tc.want) || (err == nil) != (tc.want != nil) {
+			t.Errorf("%s: dohLookup = %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestAlternativeHosts(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.apiBaseURL = "https://vpn-api.proton.me"
+	var queried string
+	useDoHResolvers(t, func(w http.ResponseWriter, r *http.Request) {
+		queried = r.URL.Query().Get("name") + " " + r.URL.Query().Get("type")
+		w.Write([]byte(`{"Status":0,"Answer":[{"type":16,"data":"\"3.120.13.81\""},{"type":16,"data":"\"18.194.40.137\""}]}`))
+	})
+
+	hosts, err := alternativeHosts(context.Background())
+	if err != nil || !slices.Equal(hosts, []string{"3.120.13.81", "18.194.40.137"}) {
+		t.Errorf("alternativeHosts = %v, %v", hosts, err)
+	}
+	if want := "dOZYG4LLBOBUS44DSN52G63RONVSQ.protonpro.xyz TXT"; queried != want {
+		t.Errorf("queried %q, want %q", queried, want)
+	}
+}
+
+func TestVerifyAltRoutingPin(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	cert := srv.Certificate()
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+
+	if err := verifyAltRoutingPin(state); err == nil {
+		t.Error("accepted a certificate that isn't pinned")
+	}
+	if err := verifyAltRoutingPin(tls.ConnectionState{}); err == nil {
+		t.Error("accepted a connection without certificates")
+	}
+
+	prev := altRoutingPins
+	defer func() { altRoutingPins = prev }()
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	altRoutingPins = append(slices.Clone(prev), base64.StdEncoding.EncodeToString(sum[:]))
+	if err := verifyAltRoutingPin(state); err != nil {
+		t.Errorf("rejected a pinned certificate: %v", err)
+	}
+}
+
+func TestAltHostExpires(t *testing.T) {
+	defer setAltHost("")
+	setAltHost("3.120.13.81")
+	if got := currentAltHost(); got != "3.120.13.81" {
+		t.Errorf("currentAltHost = %q", got)
+	}
+	altMu.Lock()
+	altExpires = time.Now().Add(-time.Second)
+	altMu.Unlock()
+	if got := currentAltHost(); got != "" {
+		t.Errorf("expired proxy still used: %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+type apiErrorKind int
+
+const (
+	apiErrOther apiErrorKind = iota
+	apiErrRateLimited
+	apiErrHumanVerification
+	apiErrSubscriptionExpired
+)
+
+// classifyAPIError sorts an error from the manager's own API calls or from
+// go-proton-api into the cases that need distinct handling.
+func classifyAPIError(err error) apiErrorKind {
+	var status, code int
+	var e *protonapi.Error
+	var pe *proton.APIError
+	switch {
+	case errors.As(err, &e):
+		status, code = e.Status, e.Code
+	case errors.As(err, &pe):
+		status, code = pe.Status, int(pe.Code)
+	default:
+		return apiErrOther
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		return apiErrRateLimited
+	case code == protonapi.CodeHumanVerification:
+		return apiErrHumanVerification
+	case code == protonapi.CodePaidPlanRequired:
+		return apiErrSubscriptionExpired
+	}
+	return apiErrOther
+}
+
+// retryAfter returns the delay the API asked for, if any.
+func retryAfter(err error) time.Duration {
+	var e *protonapi.Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+const authFailureSubject = "Proton authentication failed"
+
+// reportAPIError raises an alert for API errors that need a human.
+func reportAPIError(err error) {
+	if classifyAPIError(err) == apiErrOther && classOf(err) == classAuth {
+		notify(alertAuthFailure, authFailureSubject,
+			fmt.Sprintf("The manager's Proton session expired and logging in again failed:\n\n%v\n\nCheck PROTON_USERNAME/PROTON_PASSWORD. The manager keeps retrying; server switching is paused until then.", err))
+		return
+	}
+	switch classifyAPIError(err) {
+	case apiErrHumanVerification:
+		notify(alertHumanVerification, "Proton requires human verification",
+			fmt.Sprintf("The Proton API refused a request until a human verification (CAPTCHA) is completed:\n\n%v\n\nLog in to account.proton.me from the same network to complete it. Server switching is paused until then.", err))
+	case apiErrSubscriptionExpired:
+		notify(alertSubscription, "Proton VPN subscription required",
+			fmt.Sprintf("The Proton API reports that the account's plan no longer includes this feature:\n\n%v\n\nRenew the subscription. Server switching is paused until then.", err))
+	}
+}
+
+// clearAPIErrors resolves the alerts raised by reportAPIError.
+func clearAPIErrors() {
+	resolveAlert(alertAuthFailure, authFailureSubject)
+	resolveAlert(alertHumanVerification, "Proton requires human verification")
+	resolveAlert(alertSubscription, "Proton VPN subscription required")
+}
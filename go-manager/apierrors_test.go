@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestClassifyAPIError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want apiErrorKind
+	}{
+		{"plain", errors.New("connection refused"), apiErrOther},
+		{"rate limited", &protonapi.Error{Status: 429, Code: 2028}, apiErrRateLimited},
+		{"wrapped", fmt.Errorf("fetching servers: %w", &protonapi.Error{Status: 429}), apiErrRateLimited},
+		{"human verification", &protonapi.Error{Status: 422, Code: protonapi.CodeHumanVerification}, apiErrHumanVerification},
+		{"subscription", &protonapi.Error{Status: 422, Code: protonapi.CodePaidPlanRequired}, apiErrSubscriptionExpired},
+		{"other API error", &protonapi.Error{Status: 500, Code: 2000}, apiErrOther},
+		{"go-proton-api", &proton.APIError{Status: 422, Code: protonapi.CodeHumanVerification}, apiErrHumanVerification},
+		{"go-proton-api rate limited", &proton.APIError{Status: 429}, apiErrRateLimited},
+	} {
+		if got := classifyAPIError(tc.err); got != tc.want {
+			t.Errorf("%s: classifyAPIError = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	if d := retryAfter(fmt.Errorf("login: %w", &protonapi.Error{Status: 429, RetryAfter: time.Minute})); d != time.Minute {
+		t.Errorf("retryAfter = %s, want 1m", d)
+	}
+	if d := retryAfter(errors.New("boom")); d != 0 {
+		t.Errorf("retryAfter of a plain error = %s", d)
+	}
+}
+
+func TestReportAPIError(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	n := newMockNotifier(t)
+	notifiers = []Notifier{n}
+
+	reportAPIError(&protonapi.Error{Status: 422, Code: protonapi.CodeHumanVerification})
+	reportAPIError(&protonapi.Error{Status: 422, Code: protonapi.CodePaidPlanRequired})
+	reportAPIError(classed(classAuth, errors.New("Incorrect login credentials")))
+	reportAPIError(&protonapi.Error{Status: 429})
+	reportAPIError(errors.New("connection refused"))
+	flushNotifications(time.Second)
+
+	// Alerts are sent concurrently, so only the set is fixed
+	got, want := n.kinds(), []alertKind{alertHumanVerification, alertSubscription, alertAuthFailure}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("alerts = %v, want %v", got, want)
+	}
+}
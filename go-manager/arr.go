@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// arr pauses Sonarr or Radarr during a switch by disabling their download
+// clients, so grabs aren't sent to a client that can't reach the internet
+// and the queue isn't marked failed. The *arr APIs have no pause, and a
+// disabled client keeps its settings and downloads.
+type arr struct {
+	name   string
+	url    string
+	apiKey string
+	client *http.Client
+	// disabled are the ids of the clients Pause turned off
+	disabled []int
+}
+
+func newArr(name, baseURL, apiKey string) *arr {
+	return &arr{
+		name:   name,
+		url:    strings.TrimSuffix(baseURL, "/") + "/api/v3/downloadclient",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: integrationTimeout},
+	}
+}
+
+func (a *arr) Name() string         { return a.name }
+func (*arr) SetPort(port int) error { return nil }
+
+// Pause disables the enabled download clients, remembering which.
+func (a *arr) Pause() error {
+	var clients []map[string]any
+	if err := a.do("GET", a.url, nil, &clients); err != nil {
+		return err
+	}
+	for _, c := range clients {
+		if enabled, _ := c["enable"].(bool); !enabled {
+			continue
+		}
+		id, _ := c["id"].(float64)
+		if err := a.setEnabled(c, false); err != nil {
+			return err
+		}
+		a.disabled = append(a.disabled, int(id))
+	}
+	return nil
+}
+
+// Resume re-enables the clients Pause disabled. Ones that failed are kept
+// for the next try.
+func (a *arr) Resume() error {
+	var failed []int
+	var lastErr error
+	for _, id := range a.disabled {
+		var c map[string]any
+		err := a.do("GET", fmt.Sprintf("%s/%d", a.url, id), nil, &c)
+		if err == nil {
+			err = a.setEnabled(c, true)
+		}
+		if err != nil {
+			failed, lastErr = append(failed, id), err
+		}
+	}
+	a.disabled = failed
+	return lastErr
+}
+
+// setEnabled saves c with its enable flag changed, sending back every other
+// field as it came.
+func (a *arr) setEnabled(c map[string]any, enable bool) error {
+	c["enable"] = enable
+	id, _ := c["id"].(float64)
+	return a.do("PUT", fmt.Sprintf("%s/%d", a.url, int(id)), c, nil)
+}
+
+// do sends an API request, decoding the reply into result unless that is nil.
+func (a *arr) do(method, url string, body, result any) error {
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Api-Key", a.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: HTTP %s", method, url, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
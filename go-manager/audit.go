@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+)
+
+// Switch triggers recorded in the audit log.
+const (
+	triggerHealth          = "health"           // failed health check
+	triggerForced          = "forced"           // failover requested with a reason, e.g. from log monitoring
+	triggerLatency         = "latency"          // RTT above MAX_RTT_MS
+	triggerPacketLoss      = "packet_loss"      // loss above MAX_PACKET_LOSS_PCT
+	triggerIPv6            = "ipv6"             // IPv6 probes failing with IPV6=require
+	triggerLoad            = "load"             // less loaded server available
+	triggerPreferredServer = "preferred_server" // PREFERRED_SERVERS entry usable again
+	triggerPreferredTarget = "preferred_target" // better ranked target city/country has capacity
+	triggerNotTargeted     = "not_targeted"     // current server no longer matches the targets, e.g. after a profile change
+	triggerReconcile       = "reconcile"        // env file drifted from the live server list
+	triggerManual          = "manual"           // env file edited by hand
+	triggerControl         = "control"          // switch requested over the control API
+	triggerExternal        = "external"         // failover requested by a monitor via /trigger/switch
+)
+
+// Switch outcomes.
+const (
+	outcomeSuccess     = "success"      // tunnel came up and passed a health check
+	outcomeFailed      = "failed"       // tunnel did not come up on the new server
+	outcomeApplyFailed = "apply_failed" // the env file could not be updated
+	outcomeRejected    = "rejected"     // tunnel came up but failed a canary URL
+)
+
+// auditEvent is one line of the switch audit log.
+type auditEvent struct {
+	Time       time.Time    `json:"time"`
+	Trigger    string       `json:"trigger"`
+	Reason     string       `json:"reason"`
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	Inputs     *auditInputs `json:"inputs,omitempty"`
+	Outcome    string       `json:"outcome"`
+	DurationMs int64        `json:"duration_ms"`
+}
+
+// auditInputs are the values a load check based its decision on.
+type auditInputs struct {
+	Healthy     bool   `json:"healthy"`
+	CurrentLoad int    `json:"current_load"`
+	TargetLoad  int    `json:"target_load"`
+	Threshold   int    `json:"threshold"`
+	Port        string `json:"wireguard_port,omitempty"`
+	Protocol    string `json:"protocol"`
+}
+
+var auditMu sync.Mutex
+
+func auditFile() string {
+	return filepath.Join(cfg.logDir, "switches.ndjson")
+}
+
+// audit appends an event to the audit log and publishes it on the event
+// stream. The log is append-only and kept apart from the human-readable
+// output, so it can be shipped or parsed as is.
+func audit(ev auditEvent) {
+	switchMetrics.switched(ev)
+	events.publish(controlapi.Event{Type: eventSwitchFinished, Trigger: ev.Trigger, Reason: ev.Reason,
+		From: ev.From, To: ev.To, Outcome: ev.Outcome, DurationMs: int(ev.DurationMs)})
+	if !cfg.auditLog {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(auditFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log(fmt.Sprintf("Failed to write audit log: %v", err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log(fmt.Sprintf("Failed to write audit log: %v", err))
+	}
+}
+
+// switchTrigger maps a load check's reason onto its audit trigger.
+func switchTrigger(healthy bool, forced, reason string) string {
+	switch {
+	case strings.HasPrefix(forced, "Latency SLO"):
+		return triggerLatency
+	case strings.HasPrefix(forced, "Packet Loss"):
+		return triggerPacketLoss
+	case strings.HasPrefix(forced, "IPv6 Unreachable"):
+		return triggerIPv6
+	case strings.HasPrefix(forced, triggerReasonPrefix):
+		return triggerExternal
+	case forced != "":
+		return triggerForced
+	case !healthy:
+		return triggerHealth
+	case strings.HasPrefix(reason, "Preferred Server"):
+		return triggerPreferredServer
+	case strings.HasPrefix(reason, "Preferred Target"):
+		return triggerPreferredTarget
+	case strings.HasPrefix(reason, "Current Server Not Targeted"):
+		return triggerNotTargeted
+	}
+	return triggerLoad
+}
+
+func switchOutcome(ok bool) string {
+	if ok {
+		return outcomeSuccess
+	}
+	return outcomeFailed
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func readAudit(t *testing.T) []auditEvent {
+	t.Helper()
+	f, err := os.Open(auditFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var events []auditEvent
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var ev auditEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("bad audit line %q: %v", sc.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestAuditRecordsSwitches(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+
+	// US#2 drops out and the way back to US#1 fails
+	servers := testServers()
+	servers[1].Status = 0
+	rt := newMockRuntime(t)
+	rt.notReady = true
+	d = newTestDaemon(newMockServerSource(t, servers...), rt, newMockHealth(t, false))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readAudit(t)
+	if len(events) != 2 {
+		t.Fatalf("got %d audit events, want 2", len(events))
+	}
+	load := events[0]
+	if load.Trigger != triggerLoad || load.From != "US#1" || load.To != "US#2" || load.Outcome != outcomeSuccess {
+		t.Errorf("first event = %+v, want a successful load switch US#1 -> US#2", load)
+	}
+	if load.Inputs == nil || load.Inputs.CurrentLoad != 50 || load.Inputs.TargetLoad != 10 || !load.Inputs.Healthy {
+		t.Errorf("first event inputs = %+v", load.Inputs)
+	}
+	if failed := events[1]; failed.Trigger != triggerHealth || failed.To != "US#1" || failed.Outcome != outcomeFailed {
+		t.Errorf("second event = %+v, want a failed health switch", failed)
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.auditLog = false
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if events := readAudit(t); len(events) != 0 {
+		t.Errorf("got %d audit events with AUDIT_LOG off", len(events))
+	}
+}
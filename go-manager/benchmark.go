@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/runtime/docker"
+)
+
+const benchmarkContainer = "gluetun-proton-benchmark"
+
+// benchmarkResult is one row of the benchmark report.
+type benchmarkResult struct {
+	Rank           int     `json:"rank"`
+	Name           string  `json:"name"`
+	City           string  `json:"city"`
+	Load           int     `json:"load"`
+	Endpoint       string  `json:"endpoint,omitempty"`
+	RTTMillis      float64 `json:"rtt_ms"` // -1 when unreachable
+	ThroughputMbps float64 `json:"throughput_mbps,omitempty"`
+	ThroughputErr  string  `json:"throughput_error,omitempty"`
+}
+
+// runBenchmark probes every server matching the targets and writes a ranked
+// report, optionally sampling the download rate of the fastest ones through a
+// temporary gluetun container.
+func runBenchmark(pm *ProtonManager, args []string) {
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	out := fs.String("out", "", "Also write the report as JSON to this file")
+	throughput := fs.Int("throughput", 0, "Sample the download rate of the N lowest-latency servers through a temporary gluetun")
+	network := fs.String("network", cfg.bgNetwork, "Docker network shared with the manager, for the temporary gluetun")
+	url := fs.String("url", cfg.throughputProbeURL, "URL downloaded for throughput samples")
+	concurrency := fs.Int("concurrency", 16, "Servers probed at the same time")
+	top := fs.Int("top", 5, "Number of servers in the suggested PREFERRED_SERVERS line")
+	fs.Parse(args)
+
+	if *throughput > 0 && (*network == "" || *url == "") {
+		fmt.Fprintln(os.Stderr, "--throughput needs --network (or BLUEGREEN_NETWORK) and --url (or THROUGHPUT_PROBE_URL)")
+		os.Exit(exitUsage)
+	}
+
+	servers, err := pm.Servers()
+	if err != nil {
+		log(fmt.Sprintf("Error fetching servers: %v", err))
+		os.Exit(exitCode(err))
+	}
+	var candidates []LogicalServer
+	for _, s := range targetServers(servers) {
+		if eligible(s) {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No suitable servers found.")
+		return
+	}
+	log(fmt.Sprintf("Benchmarking %d servers", len(candidates)))
+
+	results := make([]benchmarkResult, len(candidates))
+	sem := make(chan struct{}, max(*concurrency, 1))
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = probeServer(&candidates[i])
+		}(i)
+	}
+	wg.Wait()
+	rankBenchmark(results)
+
+	if *throughput > 0 {
+		byName := make(map[string]*LogicalServer, len(candidates))
+		for i := range candidates {
+			byName[candidates[i].Name] = &candidates[i]
+		}
+		for i := range results[:min(*throughput, len(results))] {
+			r := &results[i]
+			if r.RTTMillis < 0 {
+				break
+			}
+			log(fmt.Sprintf("Sampling throughput on %s", r.Name))
+			mbps, err := sampleThroughputVia(byName[r.Name], *network, *url)
+			if err != nil {
+				r.ThroughputErr = err.Error()
+				log(fmt.Sprintf("Throughput sample on %s failed: %v", r.Name, err))
+				continue
+			}
+			r.ThroughputMbps = mbps
+		}
+		rankBenchmark(results)
+	}
+
+	printBenchmark(results, *top)
+	if *out != "" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		if err := os.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+			log(fmt.Sprintf("Error writing %s: %v", *out, err))
+			os.Exit(exitFailure)
+		}
+		log(fmt.Sprintf("Report written to %s", *out))
+	}
+}
+
+// probeServer measures the lowest round-trip time over a server's WireGuard
+// endpoints.
+func probeServer(s *LogicalServer) benchmarkResult {
+	r := benchmarkResult{Name: s.Name, City: s.City, Load: s.Load, RTTMillis: -1}
+	for _, ep := range wireguardEndpoints(s) {
+		rtt := probeEndpoint(ep.EntryIP)
+		if rtt < 0 {
+			continue
+		}
+		if ms := float64(rtt.Microseconds()) / 1000; r.RTTMillis < 0 || ms < r.RTTMillis {
+			r.RTTMillis, r.Endpoint = ms, ep.EntryIP
+		}
+	}
+	return r
+}
+
+// rankBenchmark orders results by measured throughput, then round-trip
+// time, with unreachable servers last, and numbers them.
+func rankBenchmark(results []benchmarkResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.RTTMillis < 0) != (b.RTTMillis < 0) {
+			return b.RTTMillis < 0
+		}
+		if a.ThroughputMbps != b.ThroughputMbps {
+			return a.ThroughputMbps > b.ThroughputMbps
+		}
+		if a.RTTMillis != b.RTTMillis {
+			return a.RTTMillis < b.RTTMillis
+		}
+		return a.Load < b.Load
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+}
+
+func printBenchmark(results []benchmarkResult, top int) {
+	fmt.Println("--------------------------------------------------------------------------")
+	fmt.Printf("%-4s %-12s %-16s %-6s %-16s %-10s %s\n", "#", "SERVER", "CITY", "LOAD", "ENDPOINT", "RTT", "THROUGHPUT")
+	fmt.Println("--------------------------------------------------------------------------")
+	var best []string
+	for _, r := range results {
+		rtt, mbps := "unreach.", "-"
+		if r.RTTMillis >= 0 {
+			rtt = fmt.Sprintf("%.1fms", r.RTTMillis)
+			if len(best) < top {
+				best = append(best, r.Name)
+			}
+		}
+		if r.ThroughputMbps > 0 {
+			mbps = fmt.Sprintf("%.1f Mbit/s", r.ThroughputMbps)
+		} else if r.ThroughputErr != "" {
+			mbps = "failed"
+		}
+		fmt.Printf("%-4d %-12s %-16s %-6s %-16s %-10s %s\n", r.Rank, r.Name, r.City, fmt.Sprintf("%d%%", r.Load), r.Endpoint, rtt, mbps)
+	}
+	fmt.Println("--------------------------------------------------------------------------")
+	if len(best) > 0 {
+		fmt.Printf("Suggested: PREFERRED_SERVERS=%s\n", strings.Join(best, ","))
+	}
+}
+
+// sampleThroughputVia starts a throwaway gluetun connected to server, with
+// its HTTP proxy on, and downloads url through it. The container copies the
+// active gluetun's environment, so it uses the same WireGuard key.
+func sampleThroughputVia(server *LogicalServer, network, url string) (float64, error) {
+	ep := wireguardEndpoint(server)
+	if ep == nil {
+		return 0, fmt.Errorf("no WireGuard endpoint")
+	}
+	active := activeGluetun()
+	env, err := docker.InspectEnv(active)
+	if err != nil {
+		return 0, err
+	}
+	image, err := exec.Command("docker", "inspect", "--format", "{{.Config.Image}}", active).Output()
+	if err != nil {
+		return 0, fmt.Errorf("docker inspect %s: %v", active, err)
+	}
+	for k, v := range managedEnvVars(server, ep) {
+		env[k] = v
+	}
+	env["HTTPPROXY"] = "on"
+
+	cmdArgs := []string{"run", "-d", "--rm", "--name", benchmarkContainer, "--network", network,
+		"--cap-add", "NET_ADMIN", "--device", "/dev/net/tun"}
+	for k, v := range env {
+		cmdArgs = append(cmdArgs, "-e", k+"="+v)
+	}
+	cmdArgs = append(cmdArgs, strings.TrimSpace(string(image)))
+
+	exec.Command("docker", "rm", "-f", benchmarkContainer).Run()
+	if out, err := exec.Command("docker", cmdArgs...).CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("starting %s: %v: %s", benchmarkContainer, err, strings.TrimSpace(string(out)))
+	}
+	defer exec.Command("docker", "rm", "-f", benchmarkContainer).Run()
+
+	if !waitForTunnel(benchmarkContainer, 90*time.Second) {
+		return 0, fmt.Errorf("tunnel did not come up")
+	}
+	client, err := health.ProxyClient("http://" + benchmarkContainer + ":8888")
+	if err != nil {
+		return 0, err
+	}
+	client.Timeout = throughputTimeout
+	return health.Throughput(client, url, throughputLimit)
+}
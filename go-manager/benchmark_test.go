@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestRankBenchmark(t *testing.T) {
+	results := []benchmarkResult{
+		{Name: "A", RTTMillis: -1},
+		{Name: "B", RTTMillis: 40, Load: 10},
+		{Name: "C", RTTMillis: 20, Load: 50},
+		{Name: "D", RTTMillis: 60, ThroughputMbps: 300},
+		{Name: "E", RTTMillis: 20, Load: 30},
+	}
+	rankBenchmark(results)
+
+	want := []string{"D", "E", "C", "B", "A"}
+	for i, r := range results {
+		if r.Name != want[i] || r.Rank != i+1 {
+			t.Fatalf("position %d = %s (rank %d), want %s", i, r.Name, r.Rank, want[i])
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// Switch modes
+const (
+	switchModeRecreate  = "recreate"   // recreate the single gluetun in place
+	switchModeBlueGreen = "blue-green" // bring up a standby, verify, then swap
+)
+
+// gluetunSlot is one of the two gluetun instances used in blue/green mode.
+type gluetunSlot struct {
+	Service   string
+	Container string
+}
+
+var (
+	bgMu     sync.Mutex
+	bgActive int
+)
+
+// parseBlueGreenSlots pairs compose service names with container names,
+// defaulting container names to the service names.
+func parseBlueGreenSlots(services, containers string) []gluetunSlot {
+	svcs := strings.Split(services, ",")
+	names := strings.Split(containers, ",")
+
+	var slots []gluetunSlot
+	for i, svc := range svcs {
+		slot := gluetunSlot{Service: strings.TrimSpace(svc)}
+		if slot.Service == "" {
+			continue
+		}
+		slot.Container = slot.Service
+		if i < len(names) && strings.TrimSpace(names[i]) != "" {
+			slot.Container = strings.TrimSpace(names[i])
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// blueGreenProblems reports blue-green settings that can't work. With one
+// slot, the standby would be the active gluetun.
+func blueGreenProblems() []string {
+	var problems []string
+	if len(cfg.bgSlots) != 2 {
+		problems = append(problems, "BLUEGREEN_SERVICES must name exactly two services")
+	}
+	if cfg.bgNetwork == "" {
+		problems = append(problems, "BLUEGREEN_NETWORK must be set in blue-green mode")
+	}
+	return problems
+}
+
+// activeGluetun returns the name of the gluetun container currently carrying
+// traffic.
+func activeGluetun() string {
+	if cfg.switchMode != switchModeBlueGreen {
+		return gluetunInstances()[0].Name
+	}
+	bgMu.Lock()
+	defer bgMu.Unlock()
+	return cfg.bgSlots[bgActive].Container
+}
+
+// detectActiveSlot marks the slot currently holding the gateway alias as
+// active, defaulting to the first slot.
+func detectActiveSlot() {
+	bgMu.Lock()
+	defer bgMu.Unlock()
+
+	for i, slot := range cfg.bgSlots {
+		aliases, err := containerAliases(slot.Container, cfg.bgNetwork)
+		if err == nil && slices.Contains(aliases, cfg.bgAlias) {
+			bgActive = i
+			log(fmt.Sprintf("Blue/green: %s is active", slot.Service))
+			return
+		}
+	}
+	log(fmt.Sprintf("Blue/green: no slot holds alias %q, assuming %s is active", cfg.bgAlias, cfg.bgSlots[0].Service))
+	bgActive = 0
+}
+
+func containerAliases(container, network string) ([]string, error) {
+	format := fmt.Sprintf("{{json (index .NetworkSettings.Networks %q).Aliases}}", network)
+	out, err := exec.Command("docker", "inspect", "--format", format, container).Output()
+	if err != nil {
+		return nil, err
+	}
+	var aliases []string
+	if err := json.Unmarshal(out, &aliases); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// switchBlueGreen brings the standby gluetun up with the env file's current
+// values, verifies its tunnel, and moves the gateway alias to it. On failure
+// the standby is stopped and the env file is rolled back to what the active
+// instance is running with. It returns true if the swap happened.
+func switchBlueGreen() bool {
+	bgMu.Lock()
+	activeIdx := bgActive
+	bgMu.Unlock()
+	active := cfg.bgSlots[activeIdx]
+	standbyIdx := (activeIdx + 1) % len(cfg.bgSlots)
+	standby := cfg.bgSlots[standbyIdx]
+
+	log(fmt.Sprintf("Blue/green: bringing up standby %s", standby.Service))
+	cmd, err := composeCommand("up", "-d", "--force-recreate", standby.Service)
+	if err != nil {
+		log(fmt.Sprintf("Blue/green: compose unavailable: %v", err))
+		rollbackEnv(active)
+		return false
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log(fmt.Sprintf("Blue/green: failed to start %s: %v\nOutput: %s", standby.Service, err, string(output)))
+		rollbackEnv(active)
+		return false
+	}
+
+	if !waitForTunnel(standby.Container, time.Duration(cfg.bgVerifyTimeout)*time.Second) {
+		log(fmt.Sprintf("Blue/green: %s did not come up within %ds, keeping %s", standby.Service, cfg.bgVerifyTimeout, active.Service))
+		stopService(standby.Service)
+		rollbackEnv(active)
+		return false
+	}
+
+	if err := moveAlias(active.Container, standby.Container); err != nil {
+		log(fmt.Sprintf("Blue/green: failed to move alias %q: %v", cfg.bgAlias, err))
+		stopService(standby.Service)
+		rollbackEnv(active)
+		return false
+	}
+
+	bgMu.Lock()
+	bgActive = standbyIdx
+	bgMu.Unlock()
+	log(fmt.Sprintf("Blue/green: %s is now active", standby.Service))
+
+	// The old tunnel only needs to live until clients have moved over
+	stopService(active.Service)
+	return true
+}
+
+// waitForTunnel polls connectivity from inside a container until it succeeds
+// or the timeout expires.
+func waitForTunnel(container string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if slices.ContainsFunc(cfg.pingTargets, func(t string) bool { return docker.Ping(container, t) }) {
+			return true
+		}
+		time.Sleep(5 * time.Second)
+	}
+	return false
+}
+
+// moveAlias attaches the gateway alias to the new container before detaching
+// it from the old one, so the name never stops resolving.
+func moveAlias(oldContainer, newContainer string) error {
+	// Connecting with an alias requires (re)joining the network
+	exec.Command("docker", "network", "disconnect", cfg.bgNetwork, newContainer).Run()
+	if out, err := exec.Command("docker", "network", "connect", "--alias", cfg.bgAlias, cfg.bgNetwork, newContainer).CombinedOutput(); err != nil {
+		return fmt.Errorf("connect %s: %v: %s", newContainer, err, strings.TrimSpace(string(out)))
+	}
+
+	exec.Command("docker", "network", "disconnect", cfg.bgNetwork, oldContainer).Run()
+	if out, err := exec.Command("docker", "network", "connect", cfg.bgNetwork, oldContainer).CombinedOutput(); err != nil {
+		log(fmt.Sprintf("Blue/green: failed to reattach %s without alias: %v: %s", oldContainer, err, strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+func stopService(service string) {
+	cmd, err := composeCommand("stop", service)
+	if err != nil {
+		return
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log(fmt.Sprintf("Failed to stop %s: %v\nOutput: %s", service, err, string(output)))
+	}
+}
+
+// rollbackEnv restores the managed env vars from what the given slot is
+// running with, so the env file matches the tunnel that is still serving.
+func rollbackEnv(slot gluetunSlot) {
+	running, err := docker.InspectEnv(slot.Container)
+	if err != nil {
+		log(fmt.Sprintf("Blue/green: cannot roll back env file: %v", err))
+		return
+	}
+
+	vars := map[string]string{"PROTON_SERVER_NAME": running["PROTON_SERVER_NAME"]}
+	for _, k := range tunnelEnvKeys {
+		vars[k] = running[k]
+	}
+	if err := writeEnvVars(vars); err != nil {
+		log(fmt.Sprintf("Blue/green: cannot roll back env file: %v", err))
+		return
+	}
+	stateStore.updateState(func(st *State) { st.Server = vars["PROTON_SERVER_NAME"] })
+	log(fmt.Sprintf("Blue/green: env file rolled back to %s", vars["PROTON_SERVER_NAME"]))
+}
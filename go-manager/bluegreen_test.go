@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseBlueGreenSlots(t *testing.T) {
+	for _, tc := range []struct {
+		services, containers string
+		want                 []gluetunSlot
+	}{
+		{"gluetun-blue,gluetun-green", "", []gluetunSlot{{"gluetun-blue", "gluetun-blue"}, {"gluetun-green", "gluetun-green"}}},
+		{"blue, green", "vpn-blue-1,vpn-green-1", []gluetunSlot{{"blue", "vpn-blue-1"}, {"green", "vpn-green-1"}}},
+		{"blue,green", ",vpn-green-1", []gluetunSlot{{"blue", "blue"}, {"green", "vpn-green-1"}}},
+		{"blue,", "", []gluetunSlot{{"blue", "blue"}}},
+	} {
+		if got := parseBlueGreenSlots(tc.services, tc.containers); !slices.Equal(got, tc.want) {
+			t.Errorf("parseBlueGreenSlots(%q, %q) = %v, want %v", tc.services, tc.containers, got, tc.want)
+		}
+	}
+}
+
+func TestBlueGreenProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.bgNetwork = "proj_default"
+	cfg.bgSlots = parseBlueGreenSlots("gluetun-blue,gluetun-green", "")
+	if problems := blueGreenProblems(); len(problems) != 0 {
+		t.Errorf("two slots: %v", problems)
+	}
+	cfg.bgSlots = parseBlueGreenSlots("gluetun", "")
+	if problems := blueGreenProblems(); len(problems) != 1 {
+		t.Errorf("one slot: %v, want a problem", problems)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// canary is a URL that must answer with an expected status through a new
+// tunnel, such as a tracker or streaming site that blocks some exit IPs.
+type canary struct {
+	URL    string
+	Status []int // empty accepts any status below 400
+}
+
+// parseCanaries reads CANARY_URLS: comma-separated URLs, each optionally
+// followed by |-separated accepted statuses, e.g.
+// https://tracker.example/announce|200,https://www.example.com/|200|301.
+func parseCanaries(v string) ([]canary, error) {
+	var list []canary
+	for _, entry := range strings.Split(v, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "|")
+		if parts[0] == "" {
+			continue
+		}
+		c := canary{URL: parts[0]}
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return nil, fmt.Errorf("CANARY_URLS entry %q is not an http(s) URL", c.URL)
+		}
+		for _, s := range parts[1:] {
+			code, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("CANARY_URLS entry %q has invalid status %q", c.URL, s)
+			}
+			c.Status = append(c.Status, code)
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
+
+func (c canary) accepts(status int) bool {
+	if len(c.Status) == 0 {
+		return status < 400
+	}
+	return slices.Contains(c.Status, status)
+}
+
+// canaryStatus fetches url through the tunnel: directly or via gluetun's
+// proxy when the health mode provides a client, otherwise with wget inside
+// the gluetun container.
+func canaryStatus(url string) (int, error) {
+	if client := throughputClient(); client != nil {
+		resp, err := client.Get(url)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+	return docker.HTTPStatus(activeGluetun(), url)
+}
+
+// checkCanaries returns why the tunnel fails a canary, or "" if all pass.
+func checkCanaries() string {
+	for _, c := range cfg.canaries {
+		status, err := canaryStatus(c.URL)
+		if err != nil {
+			return fmt.Sprintf("canary %s unreachable: %v", c.URL, err)
+		}
+		if !c.accepts(status) {
+			return fmt.Sprintf("canary %s returned %d", c.URL, status)
+		}
+	}
+	return ""
+}
+
+// canaryRejected checks the canaries after a switch to target. When one
+// fails, target is quarantined and another switch requested, up to
+// CANARY_MAX_ATTEMPTS in a row; after that the server is kept anyway, as
+// the services are likely down rather than blocking every exit IP. It
+// returns the rejection reason. Callers hold opMu.
+func (d *daemon) canaryRejected(target string) string {
+	if len(d.cfg.canaries) == 0 {
+		return ""
+	}
+	failure := checkCanaries()
+	if failure == "" {
+		d.canaryRejects = 0
+		return ""
+	}
+	d.canaryRejects++
+	if d.canaryRejects >= d.cfg.canaryMaxAttempts {
+		log(fmt.Sprintf("Keeping %s despite %s: %d servers in a row failed the canaries", target, failure, d.canaryRejects))
+		d.canaryRejects = 0
+		return ""
+	}
+	reason := fmt.Sprintf("Rejected %s: %s", target, failure)
+	log(reason)
+	stateStore.quarantine(target, failure)
+	d.requestFailover(reason)
+	return reason
+}
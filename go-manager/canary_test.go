@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseCanaries(t *testing.T) {
+	list, err := parseCanaries(" https://a.example/|200|302 , http://b.example/x ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].URL != "https://a.example/" || !slices.Equal(list[0].Status, []int{200, 302}) || list[1].Status != nil {
+		t.Errorf("parsed %+v", list)
+	}
+	if !list[1].accepts(301) || list[1].accepts(403) || list[0].accepts(301) {
+		t.Error("status matching wrong")
+	}
+	for _, bad := range []string{"ftp://x", "https://x|abc", "https://x|99"} {
+		if _, err := parseCanaries(bad); err == nil {
+			t.Errorf("parseCanaries(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCanaryRejectsBlockedServer(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	var blocked atomic.Bool
+	blocked.Store(true)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blocked.Load() {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer site.Close()
+	cfg.healthMode = healthModeNative
+	cfg.canaries = []canary{{URL: site.URL}}
+	cfg.canaryMaxAttempts = 2
+
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !stateStore.isQuarantined("US#2") {
+		t.Error("US#2 not quarantined after failing the canary")
+	}
+	if reason := d.takeFailoverReason(); reason == "" {
+		t.Error("no new switch requested")
+	}
+	if events := readAudit(t); len(events) != 1 || events[0].Outcome != outcomeRejected {
+		t.Errorf("audit = %+v, want one rejected switch", events)
+	}
+
+	// The second failure in a row reaches CANARY_MAX_ATTEMPTS and is kept
+	if reason := d.canaryRejected("US#1"); reason != "" || d.canaryRejects != 0 {
+		t.Errorf("canaryRejected = %q with %d rejects, want the server kept", reason, d.canaryRejects)
+	}
+
+	blocked.Store(false)
+	if reason := d.canaryRejected("US#1"); reason != "" {
+		t.Errorf("canaryRejected = %q for a passing canary", reason)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"gluetun-proton-manager/envfile"
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// Formats of the file the manager writes gluetun's settings to.
+const (
+	envFormatEnv     = "env"     // KEY=value lines loaded via env_file
+	envFormatCompose = "compose" // gluetun's inline environment: block
+)
+
+// readEnv reads gluetun's settings from the env file, under the manager's
+// names for renamed variables.
+func readEnv() (map[string]string, error) {
+	vars, err := readRawEnv()
+	if err != nil {
+		return nil, err
+	}
+	return fromGluetunEnv(vars), nil
+}
+
+// readRawEnv reads the env file as gluetun sees it.
+func readRawEnv() (map[string]string, error) {
+	if cfg.envFileFormat == envFormatCompose {
+		return envfile.ReadCompose(cfg.envFile, cfg.gluetunService)
+	}
+	return envfile.Read(cfg.envFile)
+}
+
+// updateEnvVars writes vars to the file at path in ENV_FILE_FORMAT.
+func updateEnvVars(path string, vars map[string]string) error {
+	if cfg.envFileFormat == envFormatCompose {
+		return envfile.UpdateCompose(path, cfg.gluetunService, vars)
+	}
+	return envfile.Update(path, vars)
+}
+
+// newDockerClient connects to DOCKER_HOST the way the docker CLI would,
+// honouring DOCKER_TLS_VERIFY, DOCKER_TLS and DOCKER_CERT_PATH.
+func newDockerClient() (*docker.Client, error) {
+	var tlsConfig *tls.Config
+	verify := os.Getenv("DOCKER_TLS_VERIFY") != ""
+	if verify || getEnvBool("DOCKER_TLS", false) {
+		home, _ := os.UserHomeDir()
+		var err error
+		if tlsConfig, err = docker.TLSConfig(getEnv("DOCKER_CERT_PATH", filepath.Join(home, ".docker")), verify); err != nil {
+			return nil, fmt.Errorf("Docker TLS: %v", err)
+		}
+	}
+	return docker.NewClient(os.Getenv("DOCKER_HOST"), tlsConfig)
+}
+
+// composeProjectConfig is the Compose project the manager controls.
+func composeProjectConfig() docker.Compose {
+	return docker.Compose{Project: cfg.composeProject, Dir: cfg.composeProjectDir, Files: cfg.composeFiles}
+}
+
+// composeCommand builds a Compose invocation scoped to our project and files.
+func composeCommand(args ...string) (*exec.Cmd, error) {
+	return composeProjectConfig().Command(args...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestComposeEnvFormat(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.envFileFormat = envFormatCompose
+	cfg.envFile = filepath.Join(t.TempDir(), "docker-compose.yml")
+	compose := "services:\n  gluetun:\n    environment:\n      PROTON_SERVER_NAME: US#1\n      VPN_TYPE: wireguard\n"
+	if err := os.WriteFile(cfg.envFile, []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeEnvVars(map[string]string{"PROTON_SERVER_NAME": "US#2", "VPN_ENDPOINT_IP": "10.0.0.2"}); err != nil {
+		t.Fatal(err)
+	}
+	vars := readEnvFile()
+	if vars["PROTON_SERVER_NAME"] != "US#2" || vars["VPN_ENDPOINT_IP"] != "10.0.0.2" || vars["VPN_TYPE"] != "wireguard" {
+		t.Errorf("gluetun environment = %v", vars)
+	}
+
+	if err := writeEnvVars(map[string]string{"VPN_ENDPOINT_IP": "10.0.0"}); err == nil {
+		t.Error("writeEnvVars accepted an invalid endpoint IP")
+	}
+}
+
+func TestRecreateUnquotesEnv(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.dockerAPI = true
+	env := "PROTON_SERVER_NAME=US#1\nTZ=\"Europe/Zurich\"\nSERVER_NAMES='US#1' # pinned\n"
+	if err := os.WriteFile(cfg.envFile, []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var created []string
+	useFakeEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/gluetun/json":
+			json.NewEncoder(w).Encode(map[string]any{"Id": "g1", "Name": "/gluetun",
+				"Config": map[string]any{"Env": []string{"TZ=UTC", "VPN_TYPE=wireguard"}}, "HostConfig": map[string]any{}})
+		case "/containers/create":
+			var body struct{ Env []string }
+			json.NewDecoder(r.Body).Decode(&body)
+			created = body.Env
+			json.NewEncoder(w).Encode(map[string]string{"Id": "g2"})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	restartGluetun()
+	for _, kv := range []string{"TZ=Europe/Zurich", "SERVER_NAMES=US#1", "VPN_TYPE=wireguard"} {
+		if !slices.Contains(created, kv) {
+			t.Errorf("recreated with %v, want %s", created, kv)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// connectionAgeWait returns how much longer the current server has to be in
+// use before MIN_CONNECTION_AGE lets a healthy connection be optimized away,
+// or 0. A server the manager didn't switch to itself has no known age and
+// is never held.
+func connectionAgeWait(now time.Time) time.Duration {
+	since := stateStore.state().LastSwitch
+	if cfg.minConnectionAge <= 0 || since.IsZero() {
+		return 0
+	}
+	return max(since.Add(time.Duration(cfg.minConnectionAge)*time.Second).Sub(now), 0)
+}
+
+// connectionAgeProblems reports a MIN_CONNECTION_AGE that can't work.
+func connectionAgeProblems() []string {
+	if cfg.minConnectionAge < 0 {
+		return []string{fmt.Sprintf("MIN_CONNECTION_AGE must be >= 0, got %d", cfg.minConnectionAge)}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMinConnectionAge(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.minConnectionAge = 3600
+	stateStore.updateState(func(st *State) { st.LastSwitch = time.Now().Add(-10 * time.Minute) })
+
+	// US#1 is 40 points busier than US#2, but was only switched to 10 minutes ago
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.applied) != 0 {
+		t.Errorf("applied %v within MIN_CONNECTION_AGE", rt.applied)
+	}
+
+	// Failing servers are replaced regardless
+	d = newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, false, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2] for an unhealthy server", rt.applied)
+	}
+
+	now := time.Now()
+	stateStore.updateState(func(st *State) { st.LastSwitch = now.Add(-2 * time.Hour) })
+	if wait := connectionAgeWait(now); wait != 0 {
+		t.Errorf("wait after 2h = %s, want 0", wait)
+	}
+	stateStore.updateState(func(st *State) { st.LastSwitch = now.Add(-45 * time.Minute) })
+	if wait := connectionAgeWait(now); wait != 15*time.Minute {
+		t.Errorf("wait after 45m = %s, want 15m", wait)
+	}
+}
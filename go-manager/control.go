@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+	"gluetun-proton-manager/protonapi"
+)
+
+// The control server lets automation inspect and steer the running daemon
+// over HTTP. It listens on CONTROL_SOCKET, a unix socket for CLI subcommands
+// run with docker exec, and on CONTROL_ADDR if that is set. The API is
+// described by controlapi/openapi.json, whose generated types it replies
+// with.
+
+// livenessTimeout is how long the health loop may go without an iteration
+// before /healthz reports the daemon stuck: a few of its longest intervals.
+func livenessTimeout() time.Duration {
+	return time.Duration(3*max(cfg.healthMaxInterval, cfg.healthCheckInterval))*time.Second + time.Minute
+}
+
+// controlHandler serves the control API for d.
+func controlHandler(d *daemon) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		status := d.status
+		d.mu.Unlock()
+		writeJSON(w, http.StatusOK, status)
+	})
+	// Liveness: the daemon's loops are running
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		since := time.Since(d.heartbeat)
+		d.mu.Unlock()
+		if since > livenessTimeout() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{
+				"status": fmt.Sprintf("no health check for %s", since.Round(time.Second))})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	// Readiness: the Proton session works and the tunnel passes traffic
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		apiErr, status := d.apiErr, d.status
+		d.mu.Unlock()
+		report := controlapi.Readiness{Session: "ok", Tunnel: "healthy"}
+		if apiErr != nil {
+			report.Session = apiErr.Error()
+		}
+		if !status.Healthy {
+			report.Tunnel = "unhealthy (" + status.State + ")"
+		}
+		report.Ready = apiErr == nil && status.Healthy
+		code := http.StatusOK
+		if !report.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+	mux.HandleFunc("GET /events", serveEvents)
+	mux.HandleFunc("GET /metrics", d.serveMetrics)
+	if cfg.controlDebug {
+		registerDebug(mux, d)
+	}
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(controlapi.Spec)
+	})
+	mux.HandleFunc("GET /profile", func(w http.ResponseWriter, r *http.Request) {
+		d.opMu.Lock()
+		active := activeProfile
+		d.opMu.Unlock()
+		writeJSON(w, http.StatusOK, controlapi.Profiles{
+			Active:    active,
+			Scheduled: scheduledProfile(profileSchedule, time.Now()),
+			Profiles:  profileNames(),
+		})
+	})
+	switchHandler := func(pin bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			server, err := d.switchServer(r.PathValue("name"), pin)
+			if err != nil {
+				writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"server": server})
+		}
+	}
+	mux.HandleFunc("POST /switch", switchHandler(false))
+	mux.HandleFunc("POST /switch/{name}", switchHandler(false))
+	mux.HandleFunc("POST /pin/{name}", switchHandler(true))
+	mux.HandleFunc("DELETE /pin", func(w http.ResponseWriter, r *http.Request) {
+		stateStore.updateState(func(st *State) { st.Pinned = "" })
+		d.updateStatus(func(s *Status) { s.Pinned = "" })
+		d.requestFailover("")
+		writeJSON(w, http.StatusOK, map[string]string{"pinned": ""})
+	})
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		restarted, err := d.reconcileOnce()
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		d.requestFailover("")
+		writeJSON(w, http.StatusOK, map[string]bool{"restarted": restarted})
+	})
+	mux.HandleFunc("POST /trigger/switch", d.serveTrigger)
+	mux.HandleFunc("POST /profile/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(r.PathValue("name"))
+		// "auto" hands control back to PROFILE_SCHEDULE
+		if name == "auto" {
+			name = scheduledProfile(profileSchedule, time.Now())
+		}
+		if err := d.useProfile(name, "control API"); err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"active": name})
+	})
+	return mux
+}
+
+// switchServer switches to the named server, or to the best other one if
+// name is empty. With pin, the server is also exempt from load-optimization
+// switches until a health check fails or it is unpinned.
+func (d *daemon) switchServer(name string, pin bool) (string, error) {
+	servers, err := d.servers()
+	if err != nil {
+		return "", err
+	}
+
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+	current := getCurrentServerFromEnv()
+	var target *LogicalServer
+	if name == "" {
+		for _, c := range selectCandidates(servers) {
+			if c.Name != current {
+				target = &c
+				break
+			}
+		}
+		if target == nil {
+			return "", errors.New("no other server matches the targets")
+		}
+	} else {
+		target = protonapi.FindByName(servers, strings.ToUpper(name))
+		if reason := unusableReason(target); reason != "" {
+			return "", fmt.Errorf("%s: %s", name, reason)
+		}
+	}
+	if pin {
+		stateStore.updateState(func(st *State) { st.Pinned = target.Name })
+		d.updateStatus(func(s *Status) { s.Pinned = target.Name })
+	}
+	if target.Name == current {
+		return target.Name, nil
+	}
+
+	reason := "Control API"
+	log(fmt.Sprintf("Initiating switch to %s. Reason: %s", target.Name, reason))
+	ev := auditEvent{Time: time.Now(), Trigger: triggerControl, Reason: reason, From: current, To: target.Name, Outcome: outcomeApplyFailed}
+	switchStarted(ev)
+	defer func() {
+		ev.DurationMs = time.Since(ev.Time).Milliseconds()
+		audit(ev)
+	}()
+	if !d.runtime.Apply(target) {
+		return "", fmt.Errorf("cannot write %s to the env file", target.Name)
+	}
+	ok := d.runtime.Restart() && d.restarted(reason)
+	d.connected(target.Name, ok)
+	ev.Outcome = switchOutcome(ok)
+	if !ok {
+		d.requestFailover(fmt.Sprintf("Switch to %s failed", target.Name))
+		return "", fmt.Errorf("the tunnel did not come up on %s", target.Name)
+	}
+	return target.Name, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// runControlSocket serves the control API on CONTROL_SOCKET until the process
+// exits. Only the socket's owner may connect.
+func runControlSocket(d *daemon) {
+	if conn, err := net.Dial("unix", cfg.controlSocket); err == nil {
+		conn.Close()
+		log(fmt.Sprintf("Control socket %s is in use by another manager", cfg.controlSocket))
+		return
+	}
+	os.Remove(cfg.controlSocket)
+	l, err := net.Listen("unix", cfg.controlSocket)
+	if err != nil {
+		log(fmt.Sprintf("Control socket disabled: %v", err))
+		return
+	}
+	os.Chmod(cfg.controlSocket, 0600)
+	srv := &http.Server{Handler: controlHandler(d), ReadHeaderTimeout: 10 * time.Second}
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log(fmt.Sprintf("Control socket stopped: %v", err))
+	}
+}
+
+// runControlServer serves the control API on CONTROL_ADDR until the process
+// exits. Unlike the socket, it asks for credentials if any are configured.
+func runControlServer(d *daemon) {
+	srv := &http.Server{Addr: cfg.controlAddr, Handler: requireAuth(controlHandler(d)), ReadHeaderTimeout: 10 * time.Second}
+	scheme := "http"
+	if cfg.controlTLS {
+		scheme = "https"
+	}
+	log(fmt.Sprintf("Control API listening on %s (%s)", cfg.controlAddr, scheme))
+	warnOpenControl()
+	if err := listenControl(srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log(fmt.Sprintf("Control API stopped: %v", err))
+	}
+}
+
+// controlEndpoint is where CLI subcommands reach the daemon's control API:
+// CONTROL_URL, the control socket if the daemon is listening on it, or
+// CONTROL_ADDR on the loopback interface. Switches wait for gluetun, so the
+// client allows for RESTART_TIMEOUT.
+func controlEndpoint() (string, *http.Client) {
+	client := &http.Client{
+		Timeout:   time.Duration(cfg.restartTimeout)*time.Second + time.Minute,
+		Transport: &http.Transport{TLSClientConfig: controlClientTLS()},
+	}
+	if cfg.controlURL != "" {
+		return strings.TrimRight(cfg.controlURL, "/"), client
+	}
+	if cfg.controlSocket != "" {
+		if _, err := os.Stat(cfg.controlSocket); err == nil {
+			client.Transport = &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", cfg.controlSocket)
+			}}
+			return "http://manager", client
+		}
+	}
+	host, port, err := net.SplitHostPort(cfg.controlAddr)
+	if err != nil {
+		return "", client
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if cfg.controlTLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port), client
+}
+
+// controlClient returns a client for the running daemon's control API, with
+// the configured credentials.
+func controlClient() (*controlapi.Client, error) {
+	base, httpClient := controlEndpoint()
+	if base == "" {
+		return nil, classed(classConfig, fmt.Errorf("cannot find the manager: %s doesn't exist and neither CONTROL_ADDR nor CONTROL_URL is set", cfg.controlSocket))
+	}
+	client := controlapi.New(base, httpClient)
+	client.Token, client.Username, client.Password = cfg.controlToken, cfg.controlUsername, cfg.controlPassword
+	return client, nil
+}
+
+// controlRequest calls the running daemon's control API and decodes its
+// JSON reply into v.
+func controlRequest(method, path string, v any) error {
+	client, err := controlClient()
+	if err != nil {
+		return err
+	}
+	err = client.Do(context.Background(), method, path, v)
+	var apiErr *controlapi.APIError
+	if err != nil && !errors.As(err, &apiErr) {
+		return fmt.Errorf("cannot reach the manager at %s: %v", client.BaseURL, err)
+	}
+	return err
+}
+
+// runProfileCommand implements "manager profile [list | use <name>]"
+// against the running daemon.
+func runProfileCommand(args []string) {
+	if len(args) == 0 || args[0] == "list" {
+		var report controlapi.Profiles
+		if err := controlRequest("GET", "/profile", &report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitCode(err))
+		}
+		for _, name := range report.Profiles {
+			var notes []string
+			if name == report.Active {
+				notes = append(notes, "active")
+			}
+			if name == report.Scheduled {
+				notes = append(notes, "scheduled")
+			}
+			if len(notes) > 0 {
+				fmt.Printf("%s (%s)\n", name, strings.Join(notes, ", "))
+			} else {
+				fmt.Println(name)
+			}
+		}
+		return
+	}
+	if args[0] != "use" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: manager profile [list | use <name|auto>]")
+		os.Exit(exitUsage)
+	}
+
+	var result controlapi.ProfileResult
+	if err := controlRequest("POST", "/profile/"+args[1], &result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+	fmt.Printf("Profile %s active\n", result.Active)
+}
+
+// runControlCommand implements the status, switch, pin, unpin and reload
+// subcommands against the running daemon.
+func runControlCommand(cmd string, args []string) {
+	var method, path string
+	switch {
+	case cmd == "status" && len(args) == 0:
+		method, path = "GET", "/status"
+	case cmd == "switch" && len(args) == 0:
+		method, path = "POST", "/switch"
+	case cmd == "switch" && len(args) == 1, cmd == "pin" && len(args) == 1:
+		method, path = "POST", "/"+cmd+"/"+url.PathEscape(args[0])
+	case cmd == "unpin" && len(args) == 0:
+		method, path = "DELETE", "/pin"
+	case cmd == "reload" && len(args) == 0:
+		method, path = "POST", "/reload"
+	default:
+		fmt.Fprintln(os.Stderr, "usage: manager status | switch [server] | pin <server> | unpin | reload")
+		os.Exit(exitUsage)
+	}
+
+	var result map[string]any
+	if err := controlRequest(method, path, &result); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+	switch cmd {
+	case "status":
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+	case "switch":
+		fmt.Printf("Connected to %s\n", result["server"])
+	case "pin":
+		fmt.Printf("Pinned to %s\n", result["server"])
+	case "unpin":
+		fmt.Println("Unpinned")
+	case "reload":
+		if result["restarted"] == true {
+			fmt.Println("Reloaded; gluetun was restarted to apply the env file")
+		} else {
+			fmt.Println("Reloaded; gluetun already matches the env file")
+		}
+	}
+}
+
+// runEventsCommand implements "manager events": it prints the running
+// daemon's events as JSON lines until interrupted.
+func runEventsCommand() {
+	client, err := controlClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+	client.HTTP.Timeout = 0
+	enc := json.NewEncoder(os.Stdout)
+	err = client.StreamEvents(context.Background(), 0, func(ev controlapi.Event) error {
+		return enc.Encode(ev)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+}
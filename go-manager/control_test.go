@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+)
+
+func TestControlProfileSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	profiles["night"] = currentSettings("night")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	srv := httptest.NewServer(controlHandler(d))
+	defer srv.Close()
+	cfg.controlURL = srv.URL
+
+	var result struct {
+		Active string `json:"active"`
+	}
+	if err := controlRequest("POST", "/profile/night", &result); err != nil || result.Active != "night" {
+		t.Fatalf("POST /profile/night = %+v, %v", result, err)
+	}
+	if activeProfile != "night" || d.takeFailoverReason() != "" {
+		t.Errorf("active profile %q", activeProfile)
+	}
+	select {
+	case <-d.failover:
+	default:
+		t.Error("load check not woken after the profile change")
+	}
+
+	var report controlapi.Profiles
+	if err := controlRequest("GET", "/profile", &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Active != "night" || report.Scheduled != defaultProfile || !slices.Equal(report.Profiles, []string{"default", "night"}) {
+		t.Errorf("GET /profile = %+v", report)
+	}
+
+	// Without a schedule, auto returns to the default profile
+	if err := controlRequest("POST", "/profile/auto", &result); err != nil || activeProfile != defaultProfile {
+		t.Errorf("POST /profile/auto: %v, active %q", err, activeProfile)
+	}
+	if err := controlRequest("POST", "/profile/weekend", &result); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+func TestControlHealthEndpoints(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	source := newMockServerSource(t, testServers()...)
+	d := newTestDaemon(source, newMockRuntime(t), newMockHealth(t, true))
+	srv := httptest.NewServer(controlHandler(d))
+	defer srv.Close()
+
+	get := func(path string) (int, controlapi.Readiness) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var report controlapi.Readiness
+		json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d", code)
+	}
+	if code, report := get("/readyz"); code != http.StatusServiceUnavailable || report.Session != errNoServerList.Error() {
+		t.Errorf("/readyz before any fetch = %d %+v", code, report)
+	}
+
+	d.servers()
+	d.updateStatus(func(s *Status) { s.Healthy = true })
+	if code, report := get("/readyz"); code != http.StatusOK || !report.Ready {
+		t.Errorf("/readyz = %d %+v", code, report)
+	}
+
+	// A failing Proton API makes the manager unready, not dead
+	source.mu.Lock()
+	source.err = errors.New("session expired")
+	source.mu.Unlock()
+	d.servers()
+	if code, report := get("/readyz"); code != http.StatusServiceUnavailable || report.Session != "session expired" || report.Tunnel != "healthy" {
+		t.Errorf("/readyz with a failing API = %d %+v", code, report)
+	}
+
+	d.mu.Lock()
+	d.heartbeat = time.Now().Add(-livenessTimeout() - time.Second)
+	d.mu.Unlock()
+	if code, _ := get("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/healthz with a stuck health loop = %d", code)
+	}
+}
+
+func TestControlSocketSwitchAndPin(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, exitIPServers()...), rt, newMockHealth(t, true))
+	cfg.controlSocket = filepath.Join(t.TempDir(), "manager.sock")
+	go runControlSocket(d)
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(cfg.controlSocket); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fi, err := os.Stat(cfg.controlSocket); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("socket %v, %v", fi, err)
+	}
+
+	var result map[string]any
+	if err := controlRequest("POST", "/pin/us%232", &result); err != nil || result["server"] != "US#2" {
+		t.Fatalf("POST /pin/US#2 = %v, %v", result, err)
+	}
+	if !slices.Equal(rt.appliedNames(), []string{"US#2"}) || stateStore.state().Pinned != "US#2" {
+		t.Errorf("applied %v, pinned %q", rt.appliedNames(), stateStore.state().Pinned)
+	}
+	var st Status
+	if err := controlRequest("GET", "/status", &st); err != nil || st.Pinned != "US#2" {
+		t.Errorf("GET /status = %+v, %v", st, err)
+	}
+
+	if err := controlRequest("POST", "/switch/US%233", &result); err == nil {
+		t.Error("switched to an inactive server")
+	}
+	if err := controlRequest("DELETE", "/pin", &result); err != nil || stateStore.state().Pinned != "" {
+		t.Errorf("DELETE /pin: %v, pinned %q", err, stateStore.state().Pinned)
+	}
+	if len(rt.appliedNames()) != 1 {
+		t.Errorf("applied %v after failed switch", rt.appliedNames())
+	}
+}
+
+func TestControlRequestExitCode(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.controlSocket = filepath.Join(t.TempDir(), "manager.sock")
+	if err := controlRequest("GET", "/status", nil); exitCode(err) != exitConfig {
+		t.Errorf("no control endpoint: exit code %d for %v, want %d", exitCode(err), err, exitConfig)
+	}
+
+	// A manager that isn't running is a failure of its own, not an
+	// unreachable Proton API.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.controlURL = "http://" + l.Addr().String()
+	l.Close()
+	if err := controlRequest("GET", "/status", nil); err == nil || exitCode(err) != exitFailure {
+		t.Errorf("manager down: exit code %d for %v, want %d", exitCode(err), err, exitFailure)
+	}
+}
+
+// TestOpenAPIMatchesHandler checks that every operation in the OpenAPI
+// document is served and that Status has the fields the document lists.
+func TestOpenAPIMatchesHandler(t *testing.T) {
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage
+			}
+		}
+	}
+	if err := json.Unmarshal(controlapi.Spec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	setupTestEnv(t, "US#1")
+	mux := controlHandler(newTestDaemon(newMockServerSource(t), newMockRuntime(t), newMockHealth(t))).(*http.ServeMux)
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			pattern := strings.ToUpper(method) + " " + path
+			req := httptest.NewRequest(strings.ToUpper(method), strings.ReplaceAll(path, "{name}", "x"), nil)
+			if _, got := mux.Handler(req); got != pattern {
+				t.Errorf("%s is served by %q", pattern, got)
+			}
+		}
+	}
+
+	var tags []string
+	st := reflect.TypeFor[Status]()
+	for i := range st.NumField() {
+		name, _, _ := strings.Cut(st.Field(i).Tag.Get("json"), ",")
+		tags = append(tags, name)
+	}
+	var props []string
+	for name := range spec.Components.Schemas["Status"].Properties {
+		props = append(props, name)
+	}
+	slices.Sort(tags)
+	slices.Sort(props)
+	if !slices.Equal(tags, props) {
+		t.Errorf("Status fields %v, OpenAPI Status properties %v", tags, props)
+	}
+}
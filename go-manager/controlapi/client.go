@@ -0,0 +1,105 @@
+// Package controlapi is a client for the manager's control API, as described
+// by openapi.json. The types and operations in client_gen.go are generated
+// from that document; run go generate after changing it.
+package controlapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//go:generate go run ./internal/gen -o client_gen.go openapi.json
+
+// Spec is the OpenAPI document for the control API.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Client calls a manager's control API at BaseURL, e.g.
+// http://vpn-manager:8000. Token, or Username and Password, are sent if the
+// API asks for credentials.
+type Client struct {
+	BaseURL  string
+	HTTP     *http.Client
+	Token    string
+	Username string
+	Password string
+}
+
+// New returns a client for the API at baseURL. A nil httpClient means
+// http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTP: httpClient}
+}
+
+// APIError is a response other than 200. Message is the API's error, if it
+// gave one, and Body the raw response, e.g. the Readiness report of a 503
+// from /readyz.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return fmt.Sprintf("control API returned status %d", e.StatusCode)
+}
+
+// Do sends a request to path and decodes the JSON reply into out, which may
+// be nil.
+func (c *Client) Do(ctx context.Context, method, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// responseError reads a response other than 200 into an APIError.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{StatusCode: resp.StatusCode, Body: body}
+	var e Error
+	if json.Unmarshal(body, &e) == nil {
+		apiErr.Message = e.Error
+	}
+	return apiErr
+}
+
+// pathParam escapes a path parameter, e.g. the # in CH#10.
+func pathParam(s string) string {
+	return url.PathEscape(s)
+}
@@ -0,0 +1,49 @@
+package controlapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var gotPath, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.Method+" "+r.URL.EscapedPath(), r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/pin/CH#10":
+			w.Write([]byte(`{"server": "CH#10"}`))
+		case "/status":
+			w.Write([]byte(`{"state": "healthy", "server": "CH#10", "load": 12, "healthy": true, "exit_ip": "198.51.100.1",
+				"last_switch": "2026-10-16T12:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error": "CH#99: server not found"}`))
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL+"/", nil)
+	c.Token = "s3cret"
+	ctx := context.Background()
+
+	res, err := c.PinServer(ctx, "CH#10")
+	if err != nil || res.Server != "CH#10" {
+		t.Fatalf("PinServer = %+v, %v", res, err)
+	}
+	if gotPath != "POST /pin/CH%2310" || gotAuth != "Bearer s3cret" {
+		t.Errorf("request %q with Authorization %q", gotPath, gotAuth)
+	}
+
+	st, err := c.GetStatus(ctx)
+	if err != nil || st.State != "healthy" || st.ExitIP != "198.51.100.1" || st.LastSwitch.Hour() != 12 {
+		t.Errorf("GetStatus = %+v, %v", st, err)
+	}
+
+	_, err = c.SwitchServer(ctx, "CH#99")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Error() != "CH#99: server not found" {
+		t.Errorf("SwitchServer error = %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+// Command gen writes the control API client's types and operations from its
+// OpenAPI document. It handles the subset of OpenAPI the document uses:
+// object schemas of scalars and string arrays, path parameters and JSON
+// responses. Operations that don't answer with JSON, such as the event
+// stream, are left to hand-written code.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"slices"
+	"strings"
+)
+
+type ref struct {
+	Ref string `json:"$ref"`
+}
+
+func (r ref) name() string { return r.Ref[strings.LastIndex(r.Ref, "/")+1:] }
+
+type schema struct {
+	ref
+	Type        string          `json:"type"`
+	Format      string          `json:"format"`
+	Description string          `json:"description"`
+	Enum        []string        `json:"enum"`
+	Items       *schema         `json:"items"`
+	Required    []string        `json:"required"`
+	Properties  ordered[schema] `json:"properties"`
+}
+
+type parameter struct {
+	ref
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type response struct {
+	ref
+	Content map[string]struct {
+		Schema schema `json:"schema"`
+	} `json:"content"`
+}
+
+type operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Parameters  []parameter         `json:"parameters"`
+	Responses   map[string]response `json:"responses"`
+}
+
+type document struct {
+	Paths      ordered[ordered[operation]] `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+		Schemas    ordered[schema]      `json:"schemas"`
+	} `json:"components"`
+}
+
+// ordered is a JSON object that remembers the order of its keys, so the
+// generated code follows the document.
+type ordered[T any] struct {
+	keys   []string
+	values map[string]T
+}
+
+func (o *ordered[T]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	o.values = make(map[string]T)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		o.keys = append(o.keys, key)
+		o.values[key] = v
+	}
+	return nil
+}
+
+// initialisms are spelled in capitals in Go names.
+var initialisms = map[string]string{"id": "ID", "ip": "IP", "rtt": "RTT", "url": "URL", "api": "API"}
+
+func goName(s string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		if v, ok := initialisms[strings.ToLower(part)]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+func goType(s schema) (string, error) {
+	if s.Ref != "" {
+		return s.name(), nil
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "", fmt.Errorf("array without items")
+		}
+		item, err := goType(*s.Items)
+		return "[]" + item, err
+	case "object":
+		return "map[string]any", nil
+	}
+	return "", fmt.Errorf("unsupported type %q", s.Type)
+}
+
+// generate returns the Go source for the document in spec.
+func generate(spec []byte) ([]byte, error) {
+	var doc document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+
+	usesTime := false
+	for _, name := range doc.Components.Schemas.keys {
+		s := doc.Components.Schemas.values[name]
+		fmt.Fprintf(&b, "\n// %s is the %s schema.\ntype %s struct {\n", name, name, name)
+		for _, prop := range s.Properties.keys {
+			p := s.Properties.values[prop]
+			typ, err := goType(p)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %v", name, prop, err)
+			}
+			if p.Description != "" {
+				fmt.Fprintf(&b, "\t// %s\n", p.Description)
+			}
+			if len(p.Enum) > 0 {
+				fmt.Fprintf(&b, "\t// One of %s.\n", strings.Join(p.Enum, ", "))
+			}
+			tag := prop
+			if !slices.Contains(s.Required, prop) {
+				tag += ",omitempty"
+			}
+			fmt.Fprintf(&b, "\t%s %s `json:\"%s\"`\n", goName(prop), typ, tag)
+			usesTime = usesTime || typ == "time.Time"
+		}
+		fmt.Fprint(&b, "}\n")
+	}
+
+	for _, path := range doc.Paths.keys {
+		ops := doc.Paths.values[path]
+		for _, method := range ops.keys {
+			op := ops.values[method]
+			if err := writeOperation(&b, &doc, path, strings.ToUpper(method), op); err != nil {
+				return nil, fmt.Errorf("%s %s: %v", method, path, err)
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprint(&src, "// Code generated by internal/gen from openapi.json. DO NOT EDIT.\n\npackage controlapi\n\nimport (\n\t\"context\"\n")
+	if usesTime {
+		fmt.Fprint(&src, "\t\"time\"\n")
+	}
+	fmt.Fprint(&src, ")\n")
+	src.Write(b.Bytes())
+	return format.Source(src.Bytes())
+}
+
+func writeOperation(b *bytes.Buffer, doc *document, path, method string, op operation) error {
+	if op.OperationID == "" {
+		return fmt.Errorf("no operationId")
+	}
+	ok, found := op.Responses["200"]
+	if !found {
+		return fmt.Errorf("no 200 response")
+	}
+	content, found := ok.Content["application/json"]
+	if !found {
+		return nil
+	}
+	result, err := goType(content.Schema)
+	if err != nil {
+		return err
+	}
+	pointer := !strings.HasPrefix(result, "map[")
+
+	args := []string{"ctx context.Context"}
+	urlExpr := fmt.Sprintf("%q", path)
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			p = doc.Components.Parameters[p.name()]
+		}
+		if p.In != "path" {
+			return fmt.Errorf("unsupported parameter %s in %s", p.Name, p.In)
+		}
+		args = append(args, p.Name+" string")
+		urlExpr = strings.Replace(urlExpr, "{"+p.Name+"}", `"+pathParam(`+p.Name+`)+"`, 1)
+	}
+	urlExpr = strings.TrimSuffix(strings.TrimPrefix(urlExpr, `""+`), `+""`)
+
+	name := goName(strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:])
+	fmt.Fprintf(b, "\n// %s calls %s %s: %s.\n", name, method, path, strings.TrimSuffix(op.Summary, "."))
+	if pointer {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) (*%s, error) {\n", name, strings.Join(args, ", "), result)
+		fmt.Fprintf(b, "\tvar out %s\n", result)
+		fmt.Fprintf(b, "\tif err := c.Do(ctx, %q, %s, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n}\n", method, urlExpr)
+	} else {
+		fmt.Fprintf(b, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+		fmt.Fprintf(b, "\tvar out %s\n", result)
+		fmt.Fprintf(b, "\terr := c.Do(ctx, %q, %s, &out)\n\treturn out, err\n}\n", method, urlExpr)
+	}
+	return nil
+}
+
+func main() {
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gen [-o file] openapi.json")
+		os.Exit(2)
+	}
+	spec, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	src, err := generate(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// selfSignedValidity is how long a generated control API certificate lasts.
+// It is regenerated once it has less than a tenth of that left.
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// readTokenEnv reads a secret from name, or from the file named by name_FILE.
+func readTokenEnv(name string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	file := os.Getenv(name + "_FILE")
+	if file == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("%s_FILE: %v", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// controlAuthEnabled reports whether the control API asks for credentials.
+func controlAuthEnabled() bool {
+	return cfg.controlToken != "" || cfg.controlUsername != ""
+}
+
+// requireAuth rejects requests without CONTROL_TOKEN as a bearer token or
+// CONTROL_USERNAME and CONTROL_PASSWORD as Basic credentials. /healthz,
+// /readyz and /openapi.json stay open; they can't change anything.
+// /trigger/switch checks its own token.
+func requireAuth(next http.Handler) http.Handler {
+	if !controlAuthEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && (r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || r.URL.Path == "/openapi.json") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/trigger/switch" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if authorized(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if cfg.controlUsername != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="proton-manager"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="proton-manager"`)
+		}
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+	})
+}
+
+func authorized(r *http.Request) bool {
+	equal := func(a, b string) bool { return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 }
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && cfg.controlToken != "" {
+		return equal(token, cfg.controlToken)
+	}
+	// A username without a password would accept any empty password
+	if user, pass, ok := r.BasicAuth(); ok && cfg.controlUsername != "" && cfg.controlPassword != "" {
+		// Evaluate both so a wrong username takes as long as a wrong password
+		userOK, passOK := equal(user, cfg.controlUsername), equal(pass, cfg.controlPassword)
+		return userOK && passOK
+	}
+	return false
+}
+
+// controlTLSFiles returns the certificate and key the control API serves:
+// CONTROL_TLS_CERT and CONTROL_TLS_KEY, or a generated pair next to
+// SESSION_FILE.
+func controlTLSFiles() (cert, key string) {
+	if cfg.controlTLSCert != "" {
+		return cfg.controlTLSCert, cfg.controlTLSKey
+	}
+	dir := getDir(cfg.sessionFile)
+	return filepath.Join(dir, "control.crt"), filepath.Join(dir, "control.key")
+}
+
+// controlTLSConfig loads the control API's certificate, first generating a
+// self-signed one if none is configured and the generated one is missing or
+// about to expire. It returns nil when TLS is off.
+func controlTLSConfig() (*tls.Config, error) {
+	if !cfg.controlTLS {
+		return nil, nil
+	}
+	certFile, keyFile := controlTLSFiles()
+	if cfg.controlTLSCert == "" {
+		if err := ensureSelfSigned(certFile, keyFile, time.Now()); err != nil {
+			return nil, fmt.Errorf("self-signed certificate: %v", err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("control API certificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// ensureSelfSigned writes a self-signed certificate for localhost, the
+// loopback addresses and this host's name, unless a valid one exists.
+func ensureSelfSigned(certFile, keyFile string, now time.Time) error {
+	if data, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if c, err := x509.ParseCertificate(block.Bytes); err == nil && c.NotAfter.Sub(now) > selfSignedValidity/10 {
+				if _, err := os.Stat(keyFile); err == nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	names := []string{"localhost"}
+	if host, err := os.Hostname(); err == nil && host != "localhost" {
+		names = append(names, host)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "proton-manager"},
+		DNSNames:              names,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(der)
+	log(fmt.Sprintf("Generated a self-signed control API certificate in %s (SHA-256 %s)", certFile, hex.EncodeToString(sum[:])))
+	return nil
+}
+
+// controlClientTLS trusts the system roots and the control API's own
+// certificate, so subcommands can reach a self-signed server.
+func controlClientTLS() *tls.Config {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	certFile, _ := controlTLSFiles()
+	if data, err := os.ReadFile(certFile); err == nil {
+		pool.AppendCertsFromPEM(data)
+	}
+	return &tls.Config{RootCAs: pool}
+}
+
+// listenControl serves srv on CONTROL_ADDR, with TLS if it is on.
+func listenControl(srv *http.Server) error {
+	tlsConfig, err := controlTLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = tlsConfig
+	return srv.ListenAndServeTLS("", "")
+}
+
+// controlProblems lists mistakes in the control API's auth and TLS settings.
+func controlProblems() []string {
+	var problems []string
+	if controlAuthErr != nil {
+		problems = append(problems, controlAuthErr.Error())
+	}
+	if (cfg.controlUsername == "") != (cfg.controlPassword == "") {
+		problems = append(problems, "CONTROL_USERNAME and CONTROL_PASSWORD must be set together")
+	}
+	if (cfg.controlTLSCert == "") != (cfg.controlTLSKey == "") {
+		problems = append(problems, "CONTROL_TLS_CERT and CONTROL_TLS_KEY must be set together")
+	}
+	return problems
+}
+
+// warnOpenControl logs when CONTROL_ADDR accepts unauthenticated requests
+// from other hosts.
+func warnOpenControl() {
+	host, _, err := net.SplitHostPort(cfg.controlAddr)
+	if err != nil || controlAuthEnabled() {
+		return
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return
+	}
+	log(fmt.Sprintf("Warning: the control API on %s has no authentication; set CONTROL_TOKEN or CONTROL_USERNAME and CONTROL_PASSWORD", cfg.controlAddr))
+}
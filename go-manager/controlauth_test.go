@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequireAuth(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	cfg.controlToken, cfg.controlUsername, cfg.controlPassword = "s3cret", "admin", "hunter2"
+	srv := httptest.NewServer(requireAuth(controlHandler(d)))
+	defer srv.Close()
+
+	get := func(path string, auth func(*http.Request)) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		if auth != nil {
+			auth(req)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("/status", nil); code != http.StatusUnauthorized {
+		t.Errorf("/status without credentials = %d", code)
+	}
+	if code := get("/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }); code != http.StatusUnauthorized {
+		t.Errorf("/status with a wrong token = %d", code)
+	}
+	if code := get("/status", func(r *http.Request) { r.SetBasicAuth("admin", "wrong") }); code != http.StatusUnauthorized {
+		t.Errorf("/status with a wrong password = %d", code)
+	}
+	if code := get("/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }); code != http.StatusOK {
+		t.Errorf("/status with the token = %d", code)
+	}
+	if code := get("/status", func(r *http.Request) { r.SetBasicAuth("admin", "hunter2") }); code != http.StatusOK {
+		t.Errorf("/status with Basic credentials = %d", code)
+	}
+	if code := get("/healthz", nil); code != http.StatusOK {
+		t.Errorf("/healthz without credentials = %d", code)
+	}
+}
+
+func TestUsernameWithoutPassword(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	cfg.controlUsername = "admin"
+	if problems := controlProblems(); len(problems) != 1 {
+		t.Errorf("controlProblems() = %v, want the missing password", problems)
+	}
+
+	srv := httptest.NewServer(requireAuth(controlHandler(d)))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/status", nil)
+	req.SetBasicAuth("admin", "")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("/status with the username and an empty password = %d", resp.StatusCode)
+	}
+}
+
+func TestSelfSignedControlTLS(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	dir := t.TempDir()
+	cfg.sessionFile = filepath.Join(dir, "session.json")
+	cfg.controlTLS, cfg.controlToken = true, "s3cret"
+
+	tlsConfig, err := controlTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := controlTLSFiles()
+	if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("key %v, %v", fi, err)
+	}
+	first, _ := os.ReadFile(certFile)
+	if _, err := controlTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(certFile); string(again) != string(first) {
+		t.Error("valid certificate regenerated")
+	}
+
+	// Subcommands trust the generated certificate and send the token
+	srv := httptest.NewUnstartedServer(requireAuth(controlHandler(d)))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+	cfg.controlURL = srv.URL
+	var st Status
+	if err := controlRequest("GET", "/status", &st); err != nil {
+		t.Fatalf("GET /status over TLS: %v", err)
+	}
+
+	// A certificate close to expiry is replaced
+	if err := ensureSelfSigned(certFile, keyFile, time.Now().Add(selfSignedValidity)); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(certFile)
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || cert.NotAfter.Before(time.Now().Add(selfSignedValidity)) {
+		t.Errorf("expiring certificate not replaced: %v, %v", cert.NotAfter, err)
+	}
+}
@@ -0,0 +1,787 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/retry"
+	"gluetun-proton-manager/selector"
+)
+
+// Daemon states
+type daemonState int
+
+const (
+	stateStarting daemonState = iota
+	stateHealthy
+	stateUnhealthy
+	stateSwitching
+)
+
+func (s daemonState) String() string {
+	switch s {
+	case stateHealthy:
+		return "healthy"
+	case stateUnhealthy:
+		return "unhealthy"
+	case stateSwitching:
+		return "switching"
+	default:
+		return "starting"
+	}
+}
+
+// Status is the externally visible daemon state, published to subscribers
+// such as the MQTT publisher whenever it changes.
+type Status struct {
+	State            string    `json:"state"`
+	Server           string    `json:"server"`
+	Load             int       `json:"load"`
+	Healthy          bool      `json:"healthy"`
+	ForwardedPort    int       `json:"forwarded_port"`
+	ExitIP           string    `json:"exit_ip,omitempty"`
+	RTTMs            int       `json:"rtt_ms,omitempty"`
+	IPv6             bool      `json:"ipv6,omitempty"`
+	Profile          string    `json:"profile"`
+	Pinned           string    `json:"pinned,omitempty"`
+	PacketLossPct    int       `json:"packet_loss_pct"`
+	LastSwitch       time.Time `json:"last_switch"`
+	LastSwitchReason string    `json:"last_switch_reason"`
+}
+
+// daemon runs health, load and reconcile checks in independent goroutines so
+// a slow API call or a gluetun restart never delays the next health check.
+type daemon struct {
+	cfg       *config
+	source    ServerSource
+	runtime   Runtime
+	checker   HealthChecker
+	checkerV6 HealthChecker
+
+	// mu guards state, health, status and watchers
+	mu       sync.Mutex
+	state    daemonState
+	health   *adaptiveInterval
+	status   Status
+	watchers []chan Status
+
+	// unhealthySince marks the start of the current outage; guarded by mu
+	unhealthySince time.Time
+	// heartbeat is the last health loop iteration and apiErr the result of
+	// the last server list fetch (errNoServerList before the first); both
+	// guarded by mu
+	heartbeat time.Time
+	apiErr    error
+	// lastServers is the last server list fetched, at serversFetchedAt;
+	// nextLoadCheck, loadBackoff and lastReconcile time the load and
+	// reconcile loops. All guarded by mu and reported by /debug/state.
+	lastServers      []LogicalServer
+	serversFetchedAt time.Time
+	nextLoadCheck    time.Time
+	loadBackoff      time.Duration
+	lastReconcile    time.Time
+
+	// opMu serializes everything that writes the env file or restarts
+	// gluetun.
+	opMu           sync.Mutex
+	switchFailures int // consecutive failed switches, guarded by opMu
+	canaryRejects  int // consecutive servers failing the canaries, guarded by opMu
+
+	// failover wakes the load loop immediately after a failed health check.
+	// failoverReason, guarded by mu, forces the switch without re-checking.
+	failover       chan struct{}
+	failoverReason string
+	// handshakeFailed, guarded by mu, asks the next switch to try another
+	// WireGuard port
+	handshakeFailed bool
+	// slowRTTs, guarded by mu, are the consecutive RTT samples above MAX_RTT_MS
+	slowRTTs []time.Duration
+	// lossWindow, guarded by mu, holds the latest packet loss samples
+	lossWindow []lossSample
+	// ipv6Failures, guarded by mu, counts failed IPv6 probes in a row
+	ipv6Failures int
+
+	// trafficWindow, guarded by mu, holds the tunnel's byte counters over
+	// BUSY_WINDOW; switchDeferred marks a switch waiting for it to calm down
+	trafficWindow  []trafficSample
+	switchDeferred bool
+
+	// startupUntil is when the first regular load check is due; set before
+	// the loops start, see startup.go
+	startupUntil time.Time
+
+	// done stops the loops once closed
+	done chan struct{}
+	// checks tracks the proxy checks started after recreates
+	checks sync.WaitGroup
+}
+
+func newDaemon(deps daemonDeps) *daemon {
+	if deps.Config != nil {
+		cfg = deps.Config
+	}
+	if deps.Notifiers != nil {
+		notifiers = deps.Notifiers
+	}
+	return &daemon{
+		cfg:       cfg,
+		source:    deps.Source,
+		runtime:   deps.Runtime,
+		checker:   deps.Health,
+		checkerV6: deps.HealthIPv6,
+		state:     stateStarting,
+		status:    Status{State: stateStarting.String()},
+		health: newAdaptiveInterval(
+			time.Duration(cfg.healthCheckInterval)*time.Second,
+			time.Duration(cfg.healthMinInterval)*time.Second,
+			time.Duration(cfg.healthMaxInterval)*time.Second,
+			cfg.healthRelaxAfter,
+		),
+		failover:  make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		heartbeat: time.Now(),
+		apiErr:    errNoServerList,
+	}
+}
+
+// stop ends the daemon's loops and waits for running proxy checks.
+func (d *daemon) stop() {
+	close(d.done)
+	d.checks.Wait()
+}
+
+func runDaemon(pm *ProtonManager) {
+	var rt Runtime = gluetunRuntime{}
+	switch cfg.runtimeBackend {
+	case runtimeNomad:
+		rt = &nomadRuntime{}
+	case runtimeKubernetes:
+		rt = kubeRuntime{}
+	}
+	if len(cfg.integrations) > 0 {
+		rt = integrationRuntime{rt}
+	}
+	d := newDaemon(daemonDeps{Config: cfg, Source: pm, Runtime: rt, Health: healthChecker(), HealthIPv6: ipv6HealthChecker()})
+	if cfg.runtimeBackend == runtimeKubernetes {
+		d.startOperator()
+	}
+	if cfg.tokenRefreshAhead > 0 {
+		go pm.refreshLoop(d.done)
+	}
+
+	if cfg.switchMode == switchModeBlueGreen {
+		detectActiveSlot()
+	}
+	detectGluetunVersion()
+
+	d.opMu.Lock()
+	if name := scheduledProfile(profileSchedule, time.Now()); name != defaultProfile {
+		applyProfile(name)
+		log(fmt.Sprintf("Profile %s active", name))
+	}
+	d.updateStatus(func(s *Status) { s.Profile = activeProfile })
+	current := getCurrentServerFromEnv()
+	d.resumeState(current)
+	stateStore.recordSwitch(current, true)
+	envVars := readEnvFile()
+	syncWireguardPort(envVars["WIREGUARD_ENDPOINT_PORT"])
+	syncTunnelMTU(envVars["WIREGUARD_MTU"])
+	syncProtocol(envVars["VPN_TYPE"])
+	d.opMu.Unlock()
+
+	d.startupUntil = time.Now().Add(time.Duration(cfg.loadCheckInterval) * time.Second)
+	envChanges := make(chan struct{}, 1)
+	if err := watchEnvFile(envChanges); err != nil {
+		log(fmt.Sprintf("Env file watcher disabled: %v", err))
+	}
+
+	go d.reconcileLoop()
+	go d.envLoop(envChanges)
+	go d.healthLoop()
+	go d.profileLoop()
+	if cfg.controlSocket != "" {
+		go runControlSocket(d)
+	}
+	if cfg.controlAddr != "" {
+		go runControlServer(d)
+	}
+	if cfg.logMonitor && cfg.runtimeBackend == runtimeDocker {
+		go d.logLoop()
+	}
+	if cfg.mqttBroker != "" {
+		go runMQTTPublisher(d.watchStatus())
+	}
+	if cfg.forwardedPortFile != "" || cfg.forwardedPortEnvFile != "" || len(cfg.integrations) > 0 {
+		go runPortPublisher(d.watchStatus())
+	}
+	if cfg.ddnsProvider != "" {
+		go followExitIP(d.watchStatus(), cfg.ddnsHostname, func(ip, _ string) error { return updateDDNS(ip) })
+	}
+	if cfg.allowlistCommand != "" || cfg.allowlistURL != "" {
+		go followExitIP(d.watchStatus(), "remote allowlist", pushAllowlist)
+	}
+	if cfg.reportSchedule != "" {
+		go runReporter(d.watchStatus())
+	}
+	d.loadLoop()
+}
+
+func (d *daemon) getState() daemonState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state
+}
+
+func (d *daemon) setState(s daemonState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != s {
+		log(fmt.Sprintf("State: %s -> %s", d.state, s))
+		d.state = s
+		d.status.State = s.String()
+		d.broadcastStatus()
+		events.publish(controlapi.Event{Type: eventState, State: s.String()})
+	}
+}
+
+// updateStatus applies fn to the published status and notifies watchers if
+// anything changed.
+func (d *daemon) updateStatus(fn func(*Status)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	before := d.status
+	fn(&d.status)
+	if d.status != before {
+		d.broadcastStatus()
+	}
+	if d.status.Healthy != before.Healthy {
+		ev := controlapi.Event{Type: eventTunnelDown, Server: d.status.Server}
+		if d.status.Healthy {
+			ev.Type = eventTunnelUp
+		}
+		events.publish(ev)
+		stateStore.recordHealth(d.status.Server, d.status.Healthy)
+	}
+}
+
+// watchStatus returns a channel that receives the current status and every
+// later change. Slow readers only see the latest status.
+func (d *daemon) watchStatus() <-chan Status {
+	ch := make(chan Status, 1)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ch <- d.status
+	d.watchers = append(d.watchers, ch)
+	return ch
+}
+
+// broadcastStatus replaces any unread status in each watcher. Callers hold mu.
+func (d *daemon) broadcastStatus() {
+	for _, ch := range d.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- d.status
+	}
+}
+
+// restarted records the switch and waits for gluetun to report a working
+// tunnel after a recreate, up to restartTimeout. Callers hold opMu.
+func (d *daemon) restarted(reason string) bool {
+	now, server := time.Now(), stateStore.state().Server
+	switched := false
+	d.updateStatus(func(s *Status) {
+		if s.Server != server {
+			s.Server = server
+			s.LastSwitch = now
+			s.LastSwitchReason = reason
+			switched = true
+		}
+	})
+	if switched {
+		stateStore.updateState(func(st *State) { st.LastSwitch, st.LastSwitchReason = now, reason })
+	}
+	d.mu.Lock()
+	d.slowRTTs, d.lossWindow, d.trafficWindow = nil, nil, nil
+	d.mu.Unlock()
+
+	// Blue/green switches verify the new tunnel before returning
+	if d.cfg.switchMode == switchModeBlueGreen {
+		detectGluetunVersion()
+		resumeIntegrations()
+		d.startProxyCheck()
+		return true
+	}
+	d.setState(stateSwitching)
+	defer d.setState(stateStarting)
+
+	start := time.Now()
+	if !d.runtime.WaitReady(time.Duration(d.cfg.restartTimeout) * time.Second) {
+		log(fmt.Sprintf("Gluetun not healthy after %ds", d.cfg.restartTimeout))
+		return false
+	}
+	log(fmt.Sprintf("Gluetun healthy after %s", time.Since(start).Round(time.Second)))
+	detectGluetunVersion()
+	resumeIntegrations()
+	d.startProxyCheck()
+	return true
+}
+
+// connected records whether the tunnel came up on a server and, if it did,
+// checks its exit IP and samples its throughput.
+func (d *daemon) connected(name string, ok bool) {
+	stateStore.recordSwitch(name, ok)
+	if !ok {
+		return
+	}
+	d.checkExitIP(name)
+	if d.cfg.throughputProbeURL != "" {
+		go sampleThroughput(name)
+	}
+}
+
+func (d *daemon) healthLoop() {
+	d.mu.Lock()
+	interval := d.health.current
+	d.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		d.mu.Lock()
+		d.heartbeat = time.Now()
+		d.mu.Unlock()
+		// Gluetun is expected to be down while it is being recreated
+		if d.getState() == stateSwitching {
+			continue
+		}
+
+		healthy := d.checker.Check()
+		stateStore.updateState(func(st *State) { st.countHealth(healthy) })
+		port := 0
+		if healthy && d.cfg.gluetunControlURL != "" {
+			port, _ = gluetunForwardedPort()
+		}
+		d.updateStatus(func(s *Status) {
+			s.Healthy = healthy
+			s.ForwardedPort = port
+		})
+
+		d.mu.Lock()
+		var changed bool
+		if healthy {
+			changed = d.health.success()
+		} else {
+			changed = d.health.failure()
+		}
+		interval = d.health.current
+		outageStarted := !healthy && d.unhealthySince.IsZero()
+		exitIP := d.status.ExitIP
+		if healthy {
+			d.unhealthySince = time.Time{}
+		} else if d.unhealthySince.IsZero() {
+			d.unhealthySince = time.Now()
+		}
+		outage := time.Since(d.unhealthySince)
+		d.mu.Unlock()
+
+		if healthy && dependentsDown.Load() && d.opMu.TryLock() {
+			startDependentsWhenReady()
+			d.opMu.Unlock()
+		}
+		if healthy {
+			resolveAlert(alertUnhealthy, "VPN tunnel unhealthy")
+		} else if d.cfg.alertUnhealthyAfter > 0 && outage >= time.Duration(d.cfg.alertUnhealthyAfter)*time.Second {
+			notify(alertUnhealthy, "VPN tunnel unhealthy",
+				fmt.Sprintf("The VPN tunnel through %s has been failing health checks for %s despite failover attempts.", activeGluetun(), outage.Round(time.Second)))
+		}
+
+		if healthy {
+			d.setState(stateHealthy)
+			if changed {
+				log(fmt.Sprintf("Connection stable, health check interval relaxed to %s", interval))
+			}
+			d.sampleRTT()
+			d.sampleLoss()
+			d.sampleTraffic()
+			d.checkIPv6()
+			d.judgeHealth()
+		} else {
+			log("Unhealthy connection detected! Initiating failover...")
+			d.setState(stateUnhealthy)
+			if outageStarted && d.cfg.killSwitchCheck {
+				go verifyKillSwitch(exitIP)
+			}
+			if changed {
+				log(fmt.Sprintf("Health check interval tightened to %s", interval))
+			}
+			// Force immediate load check to switch
+			d.requestFailover("")
+		}
+		ticker.Reset(interval)
+	}
+}
+
+// requestFailover wakes the load loop. A non-empty reason forces a switch even
+// if connectivity looks fine by the time the load check runs.
+func (d *daemon) requestFailover(reason string) {
+	if reason != "" {
+		d.mu.Lock()
+		d.failoverReason = reason
+		d.mu.Unlock()
+	}
+	select {
+	case d.failover <- struct{}{}:
+	default:
+	}
+}
+
+// requestPortRotation makes the next switch use the next WireGuard port.
+func (d *daemon) requestPortRotation() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handshakeFailed = true
+}
+
+func (d *daemon) takeHandshakeFailed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	failed := d.handshakeFailed
+	d.handshakeFailed = false
+	return failed
+}
+
+func (d *daemon) takeFailoverReason() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	reason := d.failoverReason
+	d.failoverReason = ""
+	return reason
+}
+
+func (d *daemon) loadLoop() {
+	loadInterval := time.Duration(d.cfg.loadCheckInterval) * time.Second
+	// Failed checks are retried sooner than the next interval, backing off
+	// towards it
+	retries := retry.Policy{Base: 30 * time.Second, Max: loadInterval, Jitter: d.cfg.apiRetry.Jitter}
+	var apiBackoff time.Duration
+	failures := 0
+
+	ticker := time.NewTicker(loadInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.checkLoad(); err != nil {
+			failures++
+			apiBackoff = retries.Delay(failures)
+			switch classifyAPIError(err) {
+			case apiErrRateLimited:
+				apiBackoff = max(apiBackoff, retryAfter(err))
+			case apiErrHumanVerification, apiErrSubscriptionExpired:
+				// Retrying sooner won't help and may lock the account further
+				apiBackoff = loadInterval
+				reportAPIError(err)
+			default:
+				if classOf(err) == classAuth {
+					// Nor will retrying rejected credentials
+					apiBackoff = loadInterval
+					reportAPIError(err)
+				}
+			}
+			log(fmt.Sprintf("Error fetching servers: %v (retrying in %s)", err, apiBackoff))
+			ticker.Reset(apiBackoff)
+		} else {
+			clearAPIErrors()
+			failures = 0
+			if apiBackoff > 0 {
+				apiBackoff = 0
+				ticker.Reset(loadInterval)
+			}
+		}
+		d.mu.Lock()
+		d.loadBackoff = apiBackoff
+		d.nextLoadCheck = time.Now().Add(cmp.Or(apiBackoff, loadInterval))
+		d.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-d.failover:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// errNoServerList is the API state before the first server list fetch.
+var errNoServerList = errors.New("no server list fetched yet")
+
+// servers fetches the server list, recording whether the Proton session
+// worked for readiness.
+func (d *daemon) servers() ([]LogicalServer, error) {
+	servers, err := d.source.Servers()
+	d.mu.Lock()
+	previous := d.apiErr
+	d.apiErr = err
+	if err == nil {
+		d.lastServers, d.serversFetchedAt = servers, time.Now()
+	}
+	d.mu.Unlock()
+	if err == nil {
+		if changed, serr := syncServersJSON(servers); serr != nil {
+			log(fmt.Sprintf("Failed to update %s: %v", d.cfg.serversJSONPath, serr))
+		} else if changed {
+			log(fmt.Sprintf("Updated gluetun's server list in %s", d.cfg.serversJSONPath))
+		}
+	}
+	switch {
+	case err != nil && (previous == nil || previous.Error() != err.Error()):
+		events.publish(controlapi.Event{Type: eventAPIError, Error: err.Error()})
+	case err == nil && previous != nil && previous != errNoServerList:
+		events.publish(controlapi.Event{Type: eventAPIRecovered})
+	}
+	return servers, err
+}
+
+// checkLoad fetches the server list and switches servers if the current one
+// is unhealthy or notably more loaded than the best candidate.
+func (d *daemon) checkLoad() error {
+	servers, err := d.servers()
+	if err != nil {
+		return err
+	}
+
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+
+	stateStore.recordLoads(targetServers(servers), time.Now())
+	if d.holdOnStart("server switches") {
+		return nil
+	}
+
+	currentName := getCurrentServerFromEnv()
+	forced := d.takeFailoverReason()
+	if d.takeHandshakeFailed() {
+		rotateWireguardPort("handshake failures in gluetun logs")
+	}
+	healthy := forced == "" && d.checker.Check()
+
+	if healthy && d.retryWireGuard(servers, currentName) {
+		return nil
+	}
+
+	best, currentLoad := findBestServer(servers, currentName)
+	pinned := stateStore.state().Pinned
+	d.updateStatus(func(s *Status) {
+		s.Server = currentName
+		s.Load = currentLoad
+		s.Pinned = pinned
+	})
+
+	// Logging
+	status := "BAD"
+	if healthy {
+		status = "OK"
+	}
+	msg := fmt.Sprintf("Health: %s | Current: %s (%d%%)", status, currentName, currentLoad)
+	if best != nil {
+		msg += fmt.Sprintf(" | Best: %s (%d%%)", best.Name, best.Load)
+	}
+	log(msg)
+
+	// Decision
+	shouldSwitch := false
+	target := ""
+	reason := ""
+
+	if !healthy {
+		shouldSwitch = true
+		reason = "Unhealthy Connection"
+		if forced != "" {
+			reason = forced
+		}
+		stateStore.updateState(func(st *State) { st.Pinned = "" })
+		stateStore.recordFailure(currentName, strings.ToLower(reason))
+		stateStore.recordDrop(currentName)
+		if best != nil {
+			target = best.Name
+		}
+	} else if best != nil && currentName != "" && currentName != pinned {
+		if reason = optimizationReason(servers, currentName, best, currentLoad, d.cfg.loadThreshold); reason != "" {
+			if d.adoptOnStart(servers, currentName) {
+				log(fmt.Sprintf("Keeping %s on startup instead of switching (%s), see SWITCH_ON_START", currentName, reason))
+				reason = ""
+			} else if wait := connectionAgeWait(time.Now()); wait > 0 {
+				log(fmt.Sprintf("Keeping %s for another %s before switching (%s), see MIN_CONNECTION_AGE", currentName, wait.Round(time.Second), reason))
+				reason = ""
+			} else if mbps, busy := d.deferForTraffic(); busy {
+				log(fmt.Sprintf("Deferring switch to %s while the tunnel carries %.1f Mbit/s (%s), see BUSY_THRESHOLD_MBPS", best.Name, mbps, reason))
+				reason = ""
+			} else {
+				shouldSwitch = true
+				target = best.Name
+			}
+		}
+	}
+
+	if shouldSwitch && target != "" && target != currentName {
+		log(fmt.Sprintf("Initiating switch to %s. Reason: %s", target, reason))
+		ev := auditEvent{
+			Time:    time.Now(),
+			Trigger: switchTrigger(healthy, forced, reason),
+			Reason:  reason,
+			From:    currentName,
+			To:      target,
+			Inputs: &auditInputs{
+				Healthy:     healthy,
+				CurrentLoad: currentLoad,
+				TargetLoad:  best.Load,
+				Threshold:   d.cfg.loadThreshold,
+				Port:        wireguardPort(),
+				Protocol:    activeProtocol,
+			},
+			Outcome: outcomeApplyFailed,
+		}
+		switchStarted(ev)
+		if d.runtime.Apply(best) {
+			ok := d.runtime.Restart() && d.restarted(reason) && d.checker.Check()
+			d.connected(target, ok)
+			ev.Outcome = switchOutcome(ok)
+			if !ok {
+				log(fmt.Sprintf("Post-switch health check failed on %s", target))
+				stateStore.recordFailure(target, "post-switch health check failed")
+				d.requestFailover(fmt.Sprintf("Switch to %s failed", target))
+				d.switchFailures++
+				// Two tunnels in a row failing to come up points at the port
+				if d.switchFailures >= 2 {
+					rotateWireguardPort(fmt.Sprintf("%d switches failed", d.switchFailures))
+				}
+				maybeFallBack(d.switchFailures)
+				if d.cfg.alertSwitchFailures > 0 && d.switchFailures >= d.cfg.alertSwitchFailures {
+					notify(alertSwitchFailure, "Repeated VPN server switch failures",
+						fmt.Sprintf("%d consecutive server switches failed; the last attempt was %s (%s).", d.switchFailures, target, reason))
+				}
+			} else {
+				d.switchFailures = 0
+				resolveAlert(alertSwitchFailure, "Repeated VPN server switch failures")
+				if d.canaryRejected(target) != "" {
+					ev.Outcome = outcomeRejected
+				}
+			}
+		}
+		ev.DurationMs = time.Since(ev.Time).Milliseconds()
+		audit(ev)
+	}
+	return nil
+}
+
+// optimizationReason says why a healthy current server should give way to
+// best, or returns "" to stay. threshold is how many points less loaded best
+// has to be.
+func optimizationReason(servers []LogicalServer, currentName string, best *LogicalServer, currentLoad, threshold int) string {
+	current := protonapi.FindByName(servers, currentName)
+	// E.g. after a profile change
+	if current != nil && !slices.ContainsFunc(targetServers(servers), func(s LogicalServer) bool { return s.Name == currentName }) {
+		return "Current Server Not Targeted"
+	}
+	if opts := selectionOptions(); len(opts.Preferred) > 0 {
+		bestPref, curPref := slices.Index(opts.Preferred, best.Name), slices.Index(opts.Preferred, currentName)
+		if bestPref >= 0 && (curPref < 0 || bestPref < curPref) && selector.PreferredUsable(*best, opts) {
+			return fmt.Sprintf("Preferred Server Available (%s)", best.Name)
+		}
+		// A usable preferred server is kept regardless of load elsewhere
+		if curPref >= 0 && current != nil && selector.PreferredUsable(*current, opts) {
+			return ""
+		}
+	}
+
+	tiers := resolveTiers(servers)
+	if rank := selector.Rank(tiers, *best); current != nil && rank < selector.Rank(tiers, *current) {
+		// Move back once a more preferred target has capacity again
+		return fmt.Sprintf("Preferred Target Available (%s)", tiers[rank])
+	}
+	if currentLoad > best.Load+threshold {
+		return fmt.Sprintf("Load Optimization (%d%% > %d%% + %d%%)", currentLoad, best.Load, threshold)
+	}
+	return ""
+}
+
+func (d *daemon) reconcileLoop() {
+	ticker := time.NewTicker(time.Duration(d.cfg.reconcileInterval) * time.Second)
+	defer ticker.Stop()
+
+	// Runs immediately on startup
+	for {
+		if _, err := d.reconcileOnce(); err != nil {
+			log(fmt.Sprintf("Reconcile skipped, error fetching servers: %v", err))
+		}
+		d.mu.Lock()
+		d.lastReconcile = time.Now()
+		d.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// reconcileOnce repairs drift between the env file, the server list and
+// gluetun, reporting whether gluetun was recreated.
+func (d *daemon) reconcileOnce() (bool, error) {
+	servers, err := d.servers()
+	if err != nil {
+		return false, err
+	}
+
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+	if d.holdOnStart("reconciliation") {
+		return false, nil
+	}
+	start, from := time.Now(), stateStore.state().Server
+	if !reconcile(servers, d.runtime) {
+		return false, nil
+	}
+	ok := d.restarted("Reconcile")
+	to := stateStore.state().Server
+	d.connected(to, ok)
+	audit(auditEvent{Time: start, Trigger: triggerReconcile, Reason: "Reconcile", From: from, To: to,
+		Outcome: switchOutcome(ok), DurationMs: time.Since(start).Milliseconds()})
+	return true, nil
+}
+
+func (d *daemon) envLoop(changes <-chan struct{}) {
+	for {
+		select {
+		case <-changes:
+		case <-d.done:
+			return
+		}
+		d.opMu.Lock()
+		start, from := time.Now(), stateStore.state().Server
+		name := getCurrentServerFromEnv()
+		if name != from && handleEnvChange(d.source, d.runtime, name) {
+			ok := d.restarted("Manual Env Edit")
+			to := stateStore.state().Server
+			d.connected(to, ok)
+			audit(auditEvent{Time: start, Trigger: triggerManual, Reason: "Manual Env Edit", From: from, To: to,
+				Outcome: switchOutcome(ok), DurationMs: time.Since(start).Milliseconds()})
+		}
+		d.opMu.Unlock()
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testServers() []LogicalServer {
+	return []LogicalServer{
+		{Name: "US#1", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 50},
+		{Name: "US#2", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 10},
+		{Name: "US#3", EntryCountry: "US", ExitCountry: "US", Status: 0, Load: 1},
+	}
+}
+
+func TestCheckLoadSwitchesAwayFromUnhealthyServer(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	source := newMockServerSource(t, testServers()...)
+	rt := newMockRuntime(t)
+	d := newTestDaemon(source, rt, newMockHealth(t, false, true))
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2]", rt.applied)
+	}
+	if rt.restarts != 1 {
+		t.Errorf("restarted %d times, want 1", rt.restarts)
+	}
+	if got := getCurrentServerFromEnv(); got != "US#2" {
+		t.Errorf("env file has %q, want US#2", got)
+	}
+	if d.switchFailures != 0 {
+		t.Errorf("switchFailures = %d, want 0", d.switchFailures)
+	}
+}
+
+func TestCheckLoadKeepsHealthyServer(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	servers := testServers()
+	servers[0].Load = 25 // within 20% of US#2
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, servers...), rt, newMockHealth(t, true))
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.applied) != 0 || rt.restarts != 0 {
+		t.Errorf("applied %v with %d restarts, want no switch", rt.applied, rt.restarts)
+	}
+}
+
+func TestCheckLoadSwitchesForLoad(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2]", rt.applied)
+	}
+}
+
+func TestCheckLoadAlertsOnRepeatedSwitchFailures(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.alertSwitchFailures = 1
+	n := newMockNotifier(t)
+	rt := newMockRuntime(t)
+	rt.notReady = true
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, false), n)
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	flushNotifications(time.Second)
+
+	if d.switchFailures != 1 {
+		t.Errorf("switchFailures = %d, want 1", d.switchFailures)
+	}
+	if !slices.Contains(n.kinds(), alertSwitchFailure) {
+		t.Errorf("sent %v, want a %s alert", n.kinds(), alertSwitchFailure)
+	}
+}
+
+func TestCheckLoadRolledBackSwitchFails(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	rt := newMockRuntime(t)
+	rt.rollBack = true
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) || rt.restarts != 1 {
+		t.Fatalf("applied %v with %d restarts, want one try of US#2", rt.applied, rt.restarts)
+	}
+	if d.switchFailures != 1 {
+		t.Errorf("switchFailures = %d, want 1", d.switchFailures)
+	}
+	if st := stateStore.state(); st.Server != "US#1" || !st.LastSwitch.IsZero() {
+		t.Errorf("state server %q, last switch %v, want US#1 and no switch", st.Server, st.LastSwitch)
+	}
+	if rec := stateStore.record("US#2"); rec.Connects != 0 || rec.ConnectFailures != 1 {
+		t.Errorf("US#2 has %d connects and %d failures, want a failure only", rec.Connects, rec.ConnectFailures)
+	}
+	if events := readAudit(t); len(events) != 1 || events[0].Outcome != outcomeFailed {
+		t.Errorf("audit events %+v, want one failed switch", events)
+	}
+}
+
+func TestCheckLoadReturnsSourceError(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	source := newMockServerSource(t)
+	source.err = errTest
+	rt := newMockRuntime(t)
+	d := newTestDaemon(source, rt, newMockHealth(t, false))
+
+	if err := d.checkLoad(); err != errTest {
+		t.Fatalf("checkLoad() = %v, want %v", err, errTest)
+	}
+	if len(rt.applied) != 0 {
+		t.Errorf("applied %v after a failed fetch", rt.applied)
+	}
+}
+
+func TestStopEndsReconcileAndEnvLoops(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	fakeGluetunEnv(t, map[string]string{})
+	source := newMockServerSource(t, testServers()...)
+	rt := newMockRuntime(t)
+	d := newTestDaemon(source, rt, newMockHealth(t, true))
+
+	changes := make(chan struct{}, 1)
+	stopped := make(chan struct{}, 2)
+	go func() {
+		d.reconcileLoop()
+		stopped <- struct{}{}
+	}()
+	go func() {
+		d.envLoop(changes)
+		stopped <- struct{}{}
+	}()
+	waitFor(t, "the first reconcile", func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return !d.lastReconcile.IsZero()
+	})
+
+	d.stop()
+	for range 2 {
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("loop still running after stop")
+		}
+	}
+
+	// A change arriving after stop is left alone.
+	os.WriteFile(cfg.envFile, []byte("PROTON_SERVER_NAME=US#2\n"), 0644)
+	changes <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	if applied := rt.appliedNames(); len(applied) != 0 || rt.restarts != 0 {
+		t.Errorf("applied %v with %d restarts after stop", applied, rt.restarts)
+	}
+}
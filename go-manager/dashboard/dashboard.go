@@ -0,0 +1,10 @@
+// Package dashboard holds the Grafana dashboard for the manager's Prometheus
+// metrics, ready to import with a Prometheus data source.
+package dashboard
+
+import _ "embed"
+
+// Grafana is the dashboard definition in Grafana's export format.
+//
+//go:embed grafana.json
+var Grafana []byte
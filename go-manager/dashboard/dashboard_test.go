@@ -0,0 +1,38 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGrafanaDashboard(t *testing.T) {
+	var d struct {
+		UID    string `json:"uid"`
+		Inputs []struct {
+			Name string `json:"name"`
+		} `json:"__inputs"`
+		Panels []struct {
+			Title   string `json:"title"`
+			Targets []struct {
+				Expr string `json:"expr"`
+			} `json:"targets"`
+		} `json:"panels"`
+	}
+	if err := json.Unmarshal(Grafana, &d); err != nil {
+		t.Fatalf("dashboard is not valid JSON: %v", err)
+	}
+	if d.UID == "" || len(d.Inputs) != 1 || d.Inputs[0].Name != "DS_PROMETHEUS" {
+		t.Errorf("dashboard isn't importable: uid %q, inputs %+v", d.UID, d.Inputs)
+	}
+	for _, p := range d.Panels {
+		if len(p.Targets) == 0 {
+			t.Errorf("panel %q has no queries", p.Title)
+		}
+		for _, target := range p.Targets {
+			if !strings.Contains(target.Expr, "proton_manager_") {
+				t.Errorf("panel %q queries %q, want a manager metric", p.Title, target.Expr)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/retry"
+)
+
+// Dynamic DNS providers for DDNS_PROVIDER.
+const (
+	ddnsCloudflare = "cloudflare" // an A/AAAA record through the Cloudflare API
+	ddnsDuckDNS    = "duckdns"    // a duckdns.org subdomain
+	ddnsHTTP       = "http"       // a GET of DDNS_URL
+)
+
+// Provider endpoints, swapped out in tests.
+var (
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+	duckdnsAPI    = "https://www.duckdns.org/update"
+)
+
+// updateDDNS sets the record to ip with the configured provider.
+func updateDDNS(ip string) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+	switch cfg.ddnsProvider {
+	case ddnsCloudflare:
+		return updateCloudflare(client, ip)
+	case ddnsDuckDNS:
+		return updateDuckDNS(client, ip)
+	default:
+		return updateDDNSURL(client, ip)
+	}
+}
+
+// updateCloudflare updates the record named DDNS_HOSTNAME in DDNS_ZONE_ID,
+// creating it if missing. IPv6 exit IPs go to an AAAA record.
+func updateCloudflare(client *http.Client, ip string) error {
+	recordType := "A"
+	if net.ParseIP(ip).To4() == nil {
+		recordType = "AAAA"
+	}
+	records := fmt.Sprintf("%s/zones/%s/dns_records", cloudflareAPI, url.PathEscape(cfg.ddnsZoneID))
+
+	var found []struct {
+		ID string `json:"id"`
+	}
+	q := url.Values{"type": {recordType}, "name": {cfg.ddnsHostname}}
+	if err := cloudflareDo(client, "GET", records+"?"+q.Encode(), nil, &found); err != nil {
+		return err
+	}
+	record := map[string]any{"type": recordType, "name": cfg.ddnsHostname, "content": ip, "ttl": 60, "proxied": false}
+	if len(found) == 0 {
+		return cloudflareDo(client, "POST", records, record, nil)
+	}
+	return cloudflareDo(client, "PATCH", records+"/"+found[0].ID, map[string]any{"content": ip}, nil)
+}
+
+// cloudflareDo sends a Cloudflare API request and unwraps its envelope.
+func cloudflareDo(client *http.Client, method, url string, body, result any) error {
+	var r io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.ddnsToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("Cloudflare: HTTP %s", resp.Status)
+	}
+	if !reply.Success {
+		msg := resp.Status
+		if len(reply.Errors) > 0 {
+			msg = reply.Errors[0].Message
+		}
+		err := fmt.Errorf("Cloudflare: %s", msg)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return retry.Permanent(err)
+		}
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// updateDuckDNS updates a duckdns.org subdomain, which answers OK or KO.
+func updateDuckDNS(client *http.Client, ip string) error {
+	q := url.Values{"domains": {strings.TrimSuffix(cfg.ddnsHostname, ".duckdns.org")}, "token": {cfg.ddnsToken}}
+	if net.ParseIP(ip).To4() == nil {
+		q.Set("ipv6", ip)
+	} else {
+		q.Set("ip", ip)
+	}
+	resp, err := client.Get(duckdnsAPI + "?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if strings.TrimSpace(string(body)) != "OK" {
+		return retry.Permanent(fmt.Errorf("DuckDNS rejected the update (%s); check DDNS_HOSTNAME and DDNS_TOKEN", resp.Status))
+	}
+	return nil
+}
+
+// updateDDNSURL fetches DDNS_URL with {ip}, {hostname} and {token}
+// filled in, as most DynDNS-style services accept.
+func updateDDNSURL(client *http.Client, ip string) error {
+	target := strings.NewReplacer(
+		"{ip}", url.QueryEscape(ip),
+		"{hostname}", url.QueryEscape(cfg.ddnsHostname),
+		"{token}", url.QueryEscape(cfg.ddnsToken),
+	).Replace(cfg.ddnsURL)
+	resp, err := client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return nil
+}
+
+// ddnsProblems reports DDNS_* settings that can't work.
+func ddnsProblems() []string {
+	var problems []string
+	switch cfg.ddnsProvider {
+	case "":
+		return nil
+	case ddnsCloudflare:
+		if cfg.ddnsZoneID == "" || cfg.ddnsHostname == "" || cfg.ddnsToken == "" {
+			problems = append(problems, "DDNS_PROVIDER=cloudflare needs DDNS_ZONE_ID, DDNS_HOSTNAME and DDNS_TOKEN")
+		}
+	case ddnsDuckDNS:
+		if cfg.ddnsHostname == "" || cfg.ddnsToken == "" {
+			problems = append(problems, "DDNS_PROVIDER=duckdns needs DDNS_HOSTNAME and DDNS_TOKEN")
+		}
+	case ddnsHTTP:
+		if u, err := url.Parse(cfg.ddnsURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.Contains(cfg.ddnsURL, "{ip}") {
+			problems = append(problems, fmt.Sprintf("DDNS_URL must be an http(s) URL containing {ip}, got %q", cfg.ddnsURL))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("DDNS_PROVIDER must be %s, %s or %s", ddnsCloudflare, ddnsDuckDNS, ddnsHTTP))
+	}
+	return problems
+}
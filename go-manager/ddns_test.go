@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDDNSCloudflare(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	records := map[string]map[string]any{}
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, result any) {
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "errors": []any{}, "result": result})
+	}
+	mux.HandleFunc("GET /zones/zone1/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "errors": []any{map[string]any{"message": "Authentication error"}}})
+			return
+		}
+		found := []any{}
+		for id, rec := range records {
+			if rec["name"] == r.URL.Query().Get("name") && rec["type"] == r.URL.Query().Get("type") {
+				found = append(found, map[string]any{"id": id})
+			}
+		}
+		reply(w, found)
+	})
+	mux.HandleFunc("POST /zones/zone1/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		var rec map[string]any
+		json.NewDecoder(r.Body).Decode(&rec)
+		records["rec1"] = rec
+		reply(w, rec)
+	})
+	mux.HandleFunc("PATCH /zones/zone1/dns_records/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var patch map[string]any
+		json.NewDecoder(r.Body).Decode(&patch)
+		records[r.PathValue("id")]["content"] = patch["content"]
+		reply(w, records[r.PathValue("id")])
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	cloudflareAPI = srv.URL
+	t.Cleanup(func() { cloudflareAPI = "https://api.cloudflare.com/client/v4" })
+	cfg.ddnsProvider, cfg.ddnsZoneID, cfg.ddnsHostname, cfg.ddnsToken = ddnsCloudflare, "zone1", "vpn.example.com", "tok"
+
+	if err := updateDDNS("203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateDDNS("203.0.113.8"); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records["rec1"]["content"] != "203.0.113.8" || records["rec1"]["type"] != "A" {
+		t.Errorf("records = %v, want one A record for 203.0.113.8", records)
+	}
+
+	cfg.ddnsToken = "wrong"
+	if err := updateDDNS("203.0.113.9"); err == nil {
+		t.Error("a rejected token went unnoticed")
+	}
+}
+
+func TestDDNSDuckDNSAndURL(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		got = append(got, q.Get("domains")+q.Get("hostname")+"="+q.Get("ip"))
+		if q.Get("token") != "tok" {
+			w.Write([]byte("KO"))
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer srv.Close()
+	duckdnsAPI = srv.URL
+	t.Cleanup(func() { duckdnsAPI = "https://www.duckdns.org/update" })
+
+	cfg.ddnsProvider, cfg.ddnsHostname, cfg.ddnsToken = ddnsDuckDNS, "myvpn.duckdns.org", "tok"
+	if err := updateDDNS("203.0.113.7"); err != nil {
+		t.Fatal(err)
+	}
+	cfg.ddnsToken = "wrong"
+	if err := updateDDNS("203.0.113.7"); err == nil {
+		t.Error("a KO answer went unnoticed")
+	}
+
+	cfg.ddnsProvider, cfg.ddnsURL, cfg.ddnsToken = ddnsHTTP, srv.URL+"/nic/update?hostname={hostname}&ip={ip}&token={token}", "tok"
+	if err := updateDDNS("203.0.113.8"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != "myvpn=203.0.113.7" || got[2] != "myvpn.duckdns.org=203.0.113.8" {
+		t.Errorf("requests = %v", got)
+	}
+}
+
+func TestDDNSProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	for _, tt := range []struct {
+		provider, url string
+		problems      int
+	}{
+		{"", "", 0},
+		{ddnsCloudflare, "", 1},
+		{ddnsHTTP, "https://dyn.example.com/update?ip={ip}", 0},
+		{ddnsHTTP, "https://dyn.example.com/update", 1},
+		{"noip", "", 1},
+	} {
+		cfg.ddnsProvider, cfg.ddnsURL = tt.provider, tt.url
+		if p := ddnsProblems(); len(p) != tt.problems {
+			t.Errorf("%s %q: got %v", tt.provider, tt.url, p)
+		}
+	}
+}
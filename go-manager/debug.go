@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"gluetun-proton-manager/selector"
+)
+
+// debugCandidates is how many of the best candidate servers /debug/state
+// lists.
+const debugCandidates = 5
+
+// debugState is the body of GET /debug/state: what the daemon is doing and
+// what its next decision will be based on. Its shape isn't part of the API
+// contract.
+type debugState struct {
+	Time       time.Time     `json:"time"`
+	Build      buildInfo     `json:"build"`
+	Goroutines int           `json:"goroutines"`
+	Status     Status        `json:"status"`
+	Timers     debugTimers   `json:"timers"`
+	Servers    debugServers  `json:"servers"`
+	Decision   debugDecision `json:"decision"`
+}
+
+type debugTimers struct {
+	HealthInterval  string    `json:"health_interval"`
+	HealthStreak    int       `json:"health_streak"`
+	LastHealthCheck time.Time `json:"last_health_check"`
+	UnhealthySince  time.Time `json:"unhealthy_since,omitzero"`
+	NextLoadCheck   time.Time `json:"next_load_check,omitzero"`
+	LoadBackoff     string    `json:"load_backoff,omitempty"`
+	LastReconcile   time.Time `json:"last_reconcile,omitzero"`
+}
+
+type debugServers struct {
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+	Count     int       `json:"count"`
+	Error     string    `json:"error,omitempty"`
+	// Candidates are the best servers for the current targets, best first
+	Candidates  []debugServer `json:"candidates,omitempty"`
+	Quarantined bool          `json:"all_quarantined,omitempty"`
+}
+
+type debugServer struct {
+	Name string `json:"name"`
+	Load int    `json:"load"`
+	Tier int    `json:"tier"`
+}
+
+// debugDecision holds the inputs of the next load check. While a switch or
+// reconcile runs, Busy is set and only the fields guarded by mu are filled
+// in.
+type debugDecision struct {
+	Busy            bool     `json:"operation_in_progress,omitempty"`
+	Managed         string   `json:"managed_server,omitempty"`
+	EnvServer       string   `json:"env_server,omitempty"`
+	Pinned          string   `json:"pinned_server,omitempty"`
+	Profile         string   `json:"profile,omitempty"`
+	Targets         []string `json:"targets,omitempty"`
+	Fallback        bool     `json:"target_fallback,omitempty"`
+	Threshold       int      `json:"load_threshold,omitempty"`
+	WireGuardPort   string   `json:"wireguard_port,omitempty"`
+	WireGuardMTU    int      `json:"wireguard_mtu,omitempty"`
+	Protocol        string   `json:"protocol,omitempty"`
+	SwitchFailures  int      `json:"switch_failures,omitempty"`
+	CanaryRejects   int      `json:"canary_rejects,omitempty"`
+	FailoverReason  string   `json:"failover_reason,omitempty"`
+	HandshakeFailed bool     `json:"handshake_failed,omitempty"`
+	SlowRTTsMs      []int64  `json:"slow_rtts_ms,omitempty"`
+	LossWindow      []string `json:"loss_window,omitempty"`
+}
+
+// registerDebug adds /debug/pprof and /debug/state to mux.
+func registerDebug(mux *http.ServeMux, d *daemon) {
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.debugState())
+	})
+}
+
+// debugState snapshots the daemon without waiting for a running operation,
+// so it also answers when the daemon seems stuck.
+func (d *daemon) debugState() debugState {
+	st := debugState{Time: time.Now(), Build: currentBuild(), Goroutines: runtime.NumGoroutine()}
+
+	d.mu.Lock()
+	st.Status = d.status
+	st.Timers = debugTimers{
+		HealthInterval:  d.health.current.String(),
+		HealthStreak:    d.health.streak,
+		LastHealthCheck: d.heartbeat,
+		UnhealthySince:  d.unhealthySince,
+		NextLoadCheck:   d.nextLoadCheck,
+		LastReconcile:   d.lastReconcile,
+	}
+	if d.loadBackoff > 0 {
+		st.Timers.LoadBackoff = d.loadBackoff.String()
+	}
+	servers := d.lastServers
+	st.Servers = debugServers{FetchedAt: d.serversFetchedAt, Count: len(servers)}
+	if d.apiErr != nil {
+		st.Servers.Error = d.apiErr.Error()
+	}
+	dec := debugDecision{
+		FailoverReason:  d.failoverReason,
+		HandshakeFailed: d.handshakeFailed,
+	}
+	for _, rtt := range d.slowRTTs {
+		dec.SlowRTTsMs = append(dec.SlowRTTsMs, rtt.Milliseconds())
+	}
+	for _, s := range d.lossWindow {
+		dec.LossWindow = append(dec.LossWindow, formatLossSample(s))
+	}
+	d.mu.Unlock()
+
+	if !d.opMu.TryLock() {
+		dec.Busy = true
+		st.Decision = dec
+		return st
+	}
+	defer d.opMu.Unlock()
+	state := stateStore.state()
+	dec.Managed, dec.Pinned, dec.Profile = state.Server, state.Pinned, activeProfile
+	dec.EnvServer = getCurrentServerFromEnv()
+	for _, t := range d.cfg.targetTiers {
+		dec.Targets = append(dec.Targets, t.Name)
+	}
+	dec.Fallback, dec.Threshold = d.cfg.targetFallback, d.cfg.loadThreshold
+	dec.WireGuardPort, dec.Protocol = wireguardPort(), activeProtocol
+	dec.WireGuardMTU = tunnelMTU
+	dec.SwitchFailures, dec.CanaryRejects = d.switchFailures, d.canaryRejects
+	st.Decision = dec
+
+	if len(servers) > 0 {
+		tiers := resolveTiers(servers)
+		candidates, quarantined := selector.Select(servers, tiers, selectionOptions())
+		st.Servers.Quarantined = quarantined
+		for _, c := range candidates[:min(len(candidates), debugCandidates)] {
+			st.Servers.Candidates = append(st.Servers.Candidates, debugServer{Name: c.Name, Load: c.Load, Tier: selector.Rank(tiers, c)})
+		}
+	}
+	return st
+}
+
+func formatLossSample(s lossSample) string {
+	return fmt.Sprintf("%d/%d received", s.received, s.sent)
+}
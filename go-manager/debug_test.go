@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t))
+	get := func(h http.Handler, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		return rec
+	}
+	if rec := get(controlHandler(d), "/debug/state"); rec.Code != http.StatusNotFound {
+		t.Errorf("/debug/state without CONTROL_DEBUG = %d", rec.Code)
+	}
+
+	cfg.controlDebug = true
+	h := controlHandler(d)
+	if rec := get(h, "/debug/pprof/"); rec.Code != http.StatusOK {
+		t.Errorf("/debug/pprof/ = %d", rec.Code)
+	}
+
+	d.servers()
+	d.requestFailover("Latency SLO")
+	var st debugState
+	if err := json.Unmarshal(get(h, "/debug/state").Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Servers.Count != 3 || len(st.Servers.Candidates) == 0 || st.Servers.Candidates[0].Name != "US#2" {
+		t.Errorf("servers = %+v", st.Servers)
+	}
+	if st.Decision.Busy || st.Decision.Managed != "US#1" || st.Decision.FailoverReason != "Latency SLO" || st.Decision.Threshold != cfg.loadThreshold {
+		t.Errorf("decision = %+v", st.Decision)
+	}
+
+	// A running switch doesn't block the dump
+	d.opMu.Lock()
+	defer d.opMu.Unlock()
+	st = debugState{}
+	json.Unmarshal(get(h, "/debug/state").Body.Bytes(), &st)
+	if !st.Decision.Busy || st.Decision.FailoverReason != "Latency SLO" || st.Decision.Managed != "" {
+		t.Errorf("decision during a switch = %+v", st.Decision)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// deluge sets Deluge's incoming port through the JSON-RPC API of its web
+// UI. Torrents keep running across a switch, so Pause and Resume do
+// nothing.
+type deluge struct {
+	url      string
+	password string
+	client   *http.Client
+	id       int
+}
+
+func newDeluge(baseURL, password string) *deluge {
+	jar, _ := cookiejar.New(nil)
+	return &deluge{
+		url:      strings.TrimSuffix(baseURL, "/") + "/json",
+		password: password,
+		client:   &http.Client{Jar: jar, Timeout: integrationTimeout},
+	}
+}
+
+func (*deluge) Name() string  { return "Deluge" }
+func (*deluge) Pause() error  { return nil }
+func (*deluge) Resume() error { return nil }
+
+// SetPort logs in, connects the web UI to a daemon if it isn't yet, and
+// sets the listen port range to just port.
+func (c *deluge) SetPort(port int) error {
+	var ok bool
+	if err := c.call("auth.login", []any{c.password}, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("login rejected, check DELUGE_PASSWORD")
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	config := map[string]any{"listen_ports": []int{port, port}, "random_port": false}
+	return c.call("core.set_config", []any{config}, nil)
+}
+
+// connect attaches the web UI to the first daemon it knows of.
+func (c *deluge) connect() error {
+	var connected bool
+	if err := c.call("web.connected", []any{}, &connected); err != nil || connected {
+		return err
+	}
+	var hosts [][]any
+	if err := c.call("web.get_hosts", []any{}, &hosts); err != nil {
+		return err
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return errors.New("the web UI knows no Deluge daemon")
+	}
+	return c.call("web.connect", []any{hosts[0][0]}, nil)
+}
+
+// call invokes method, decoding its result into result unless that is nil.
+func (c *deluge) call(method string, params []any, result any) error {
+	c.id++
+	body, _ := json.Marshal(map[string]any{"method": method, "params": params, "id": c.id})
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: HTTP %s", method, resp.Status)
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %v", method, err)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("%s: %s", method, reply.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// How dependent containers are handled around a gluetun recreate
+const (
+	dependentStop     = "stop"     // docker stop, then docker start
+	dependentPause    = "pause"    // docker pause, then docker unpause
+	dependentRecreate = "recreate" // docker stop, then compose up --force-recreate
+)
+
+// dependentsDown is set while dependents are stopped and waiting for gluetun
+// to come back up.
+var dependentsDown atomic.Bool
+
+// dependent is a container that routes through gluetun and must be
+// restarted around a switch (e.g. `network_mode: service:gluetun`).
+type dependent struct {
+	Name         string
+	ReadyTimeout time.Duration
+}
+
+// parseDependents parses "name[:timeoutSeconds],..." in start order.
+func parseDependents(value string, defaultTimeout int) []dependent {
+	var deps []dependent
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		dep := dependent{Name: entry, ReadyTimeout: time.Duration(defaultTimeout) * time.Second}
+		if name, timeout, ok := strings.Cut(entry, ":"); ok {
+			dep.Name = name
+			if secs, err := strconv.Atoi(timeout); err == nil {
+				dep.ReadyTimeout = time.Duration(secs) * time.Second
+			}
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// stopDependents stops (or pauses) dependents in reverse start order.
+func stopDependents() {
+	if len(cfg.dependents) > 0 {
+		dependentsDown.Store(true)
+	}
+	for i := len(cfg.dependents) - 1; i >= 0; i-- {
+		name := cfg.dependents[i].Name
+		verb := "stop"
+		if cfg.dependentAction == dependentPause {
+			verb = "pause"
+		}
+		log(fmt.Sprintf("Dependent %s: %s", name, verb))
+		if err := dockerAction(verb, name); err != nil {
+			log(fmt.Sprintf("Failed to %s %s: %v", verb, name, err))
+		}
+	}
+}
+
+// startDependentsWhenReady starts stopped dependents once gluetun reports a
+// working tunnel, so they don't come up before it. If it doesn't, they stay
+// down until a later health check passes.
+func startDependentsWhenReady() {
+	if !dependentsDown.Load() {
+		return
+	}
+	if !waitForGluetun(activeGluetun(), time.Duration(cfg.restartTimeout)*time.Second) {
+		log("Gluetun not ready, dependents stay stopped until it is")
+		return
+	}
+	if dependentsDown.CompareAndSwap(true, false) {
+		startDependents()
+	}
+}
+
+// startDependents brings dependents back in order, waiting for each to be
+// ready before starting the next.
+func startDependents() {
+	for _, dep := range cfg.dependents {
+		log(fmt.Sprintf("Dependent %s: starting", dep.Name))
+		var err error
+		switch cfg.dependentAction {
+		case dependentPause:
+			err = dockerAction("unpause", dep.Name)
+		case dependentRecreate:
+			err = cfg.dockerRetry.Do(context.Background(), func() error { return recreateDependent(dep.Name) })
+		default:
+			err = dockerAction("start", dep.Name)
+		}
+		if err != nil {
+			log(fmt.Sprintf("Failed to start %s: %v", dep.Name, err))
+			continue
+		}
+		if !waitForContainer(dep.Name, dep.ReadyTimeout) {
+			log(fmt.Sprintf("Dependent %s: not ready after %s, continuing", dep.Name, dep.ReadyTimeout))
+		}
+	}
+}
+
+// checkDependentAction rejects stop and pause for dependents that share
+// another container's network: started again, they would still point at the
+// removed gluetun's network namespace.
+func checkDependentAction() error {
+	if cfg.dependentAction == dependentRecreate {
+		return nil
+	}
+	for _, dep := range cfg.dependents {
+		if mode, err := docker.NetworkMode(dep.Name); err == nil && strings.HasPrefix(mode, "container:") {
+			return fmt.Errorf("DEPENDENT_ACTION=%s doesn't work for %s, which uses gluetun's network (%s); use %s", cfg.dependentAction, dep.Name, mode, dependentRecreate)
+		}
+	}
+	return nil
+}
+
+// dockerAction runs docker <verb> <name> under DOCKER_RETRY.
+func dockerAction(verb, name string) error {
+	return cfg.dockerRetry.Do(context.Background(), func() error { return docker.Action(verb, name) })
+}
+
+// recreateDependent recreates a dependent so it attaches to the new gluetun,
+// through Compose or, with the Engine API, natively.
+func recreateDependent(name string) error {
+	if cfg.dockerAPI {
+		return docker.Recreate(name, docker.RecreateOptions{NetworkContainer: activeGluetun()})
+	}
+	cmd, err := composeCommand("up", "-d", "--force-recreate", "--no-deps", name)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// waitForContainer waits until a container is running and, if it defines a
+// Docker healthcheck, healthy.
+func waitForContainer(name string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if ready, _ := containerReady(name); ready {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// containerReady reports whether a container is running and not failing its
+// Docker healthcheck, and whether it has a healthcheck at all.
+func containerReady(name string) (ready, hasHealthcheck bool) {
+	status, health, err := docker.State(name)
+	if err != nil {
+		return false, false
+	}
+	return status == "running" && (health == "" || health == "healthy"), health != ""
+}
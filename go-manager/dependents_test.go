@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseDependents(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		want  []dependent
+	}{
+		{"", nil},
+		{"qbittorrent", []dependent{{"qbittorrent", 60 * time.Second}}},
+		{"qbittorrent:120, sonarr ,", []dependent{{"qbittorrent", 120 * time.Second}, {"sonarr", 60 * time.Second}}},
+		{"prowlarr:0", []dependent{{"prowlarr", 0}}},
+		// A timeout that isn't a number keeps the default
+		{"radarr:soon", []dependent{{"radarr", 60 * time.Second}}},
+	} {
+		if got := parseDependents(tc.value, 60); !slices.Equal(got, tc.want) {
+			t.Errorf("parseDependents(%q) = %v, want %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestCheckDependentAction(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	useFakeEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/qbittorrent/json":
+			w.Write([]byte(`{"Id":"q1","Config":{},"HostConfig":{"NetworkMode":"container:abc123"}}`))
+		case "/containers/sonarr/json":
+			w.Write([]byte(`{"Id":"s1","Config":{},"HostConfig":{"NetworkMode":"proj_default"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	for _, tc := range []struct {
+		action, dependents string
+		ok                 bool
+	}{
+		{dependentRecreate, "qbittorrent", true},
+		{"stop", "sonarr,missing", true},
+		{"stop", "sonarr,qbittorrent", false},
+		{"pause", "qbittorrent", false},
+	} {
+		cfg.dependentAction, cfg.dependents = tc.action, parseDependents(tc.dependents, 60)
+		if err := checkDependentAction(); (err == nil) != tc.ok {
+			t.Errorf("DEPENDENT_ACTION=%s with %s: %v", tc.action, tc.dependents, err)
+		}
+	}
+}
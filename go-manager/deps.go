@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+//go:generate go run go.uber.org/mock/mockgen@v0.6.0 -source=deps.go -destination=deps_mock_test.go -package=main -self_package=gluetun-proton-manager
+//go:generate go run go.uber.org/mock/mockgen@v0.6.0 -source=notify.go -destination=notify_mock_test.go -package=main -self_package=gluetun-proton-manager
+//go:generate go run go.uber.org/mock/mockgen@v0.6.0 -source=health/checker.go -destination=health_mock_test.go -package=main -self_package=gluetun-proton-manager
+
+// The daemon reaches the outside world only through these interfaces, so it
+// can be driven against fakes. The production implementations talk to the
+// Proton API, the env file, Docker and the alert backends.
+
+// ServerSource supplies the current Proton server list.
+type ServerSource interface {
+	Servers() ([]LogicalServer, error)
+}
+
+const (
+	runtimeDocker     = "docker"     // gluetun runs under Docker or Compose
+	runtimeNomad      = "nomad"      // gluetun is a task in a Nomad job
+	runtimeKubernetes = "kubernetes" // gluetun is a pod managed through a VPNTunnel
+)
+
+// Runtime puts a server into gluetun's configuration and brings the tunnel
+// up on it.
+type Runtime interface {
+	// Apply writes the server's settings, reporting whether it succeeded.
+	Apply(server *LogicalServer) bool
+	// Restart recreates gluetun so it picks up the applied settings. It
+	// reports false if the runtime rolled the settings back itself, as a
+	// blue/green switch does when the standby fails verification.
+	Restart() bool
+	// WaitReady waits up to timeout for the new tunnel to come up.
+	WaitReady(timeout time.Duration) bool
+}
+
+// HealthChecker reports whether the tunnel passes traffic.
+type HealthChecker = health.Checker
+
+// daemonDeps are the daemon's settings and collaborators. Config and
+// Notifiers replace the configuration and alert backends, which are
+// process-wide.
+type daemonDeps struct {
+	Config  *config
+	Source  ServerSource
+	Runtime Runtime
+	Health  HealthChecker
+	// HealthIPv6 probes IPv6 through the tunnel; nil skips that
+	HealthIPv6 HealthChecker
+	Notifiers  []Notifier
+}
+
+// gluetunRuntime is the Runtime for a real gluetun managed through the env
+// file and Docker Compose.
+type gluetunRuntime struct{}
+
+func (gluetunRuntime) Apply(server *LogicalServer) bool { return updateEnv(server) }
+
+func (gluetunRuntime) Restart() bool { return restartGluetun() }
+
+func (gluetunRuntime) WaitReady(timeout time.Duration) bool {
+	return waitForGluetun(activeGluetun(), timeout)
+}
+
+// dockerOnlyProblems reports settings that need Docker when RUNTIME is
+// something else.
+func dockerOnlyProblems() []string {
+	if cfg.switchMode == switchModeBlueGreen || cfg.gluetunLabel != "" || cfg.dockerAPI || len(cfg.dependents) > 0 || cfg.killSwitchCheck {
+		return []string{fmt.Sprintf("SWITCH_MODE=bluegreen, GLUETUN_LABEL, DOCKER_API, DEPENDENT_CONTAINERS and KILLSWITCH_CHECK need Docker and aren't supported with RUNTIME=%s", cfg.runtimeBackend)}
+	}
+	return nil
+}
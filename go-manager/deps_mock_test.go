@@ -0,0 +1,122 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: deps.go
+//
+// Generated by this command:
+//
+//	mockgen -source=deps.go -destination=deps_mock_test.go -package=main -self_package=gluetun-proton-manager
+//
+
+// Package main is a generated GoMock package.
+package main
+
+import (
+	reflect "reflect"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockServerSource is a mock of ServerSource interface.
+type MockServerSource struct {
+	ctrl     *gomock.Controller
+	recorder *MockServerSourceMockRecorder
+	isgomock struct{}
+}
+
+// MockServerSourceMockRecorder is the mock recorder for MockServerSource.
+type MockServerSourceMockRecorder struct {
+	mock *MockServerSource
+}
+
+// NewMockServerSource creates a new mock instance.
+func NewMockServerSource(ctrl *gomock.Controller) *MockServerSource {
+	mock := &MockServerSource{ctrl: ctrl}
+	mock.recorder = &MockServerSourceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockServerSource) EXPECT() *MockServerSourceMockRecorder {
+	return m.recorder
+}
+
+// Servers mocks base method.
+func (m *MockServerSource) Servers() ([]LogicalServer, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Servers")
+	ret0, _ := ret[0].([]LogicalServer)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Servers indicates an expected call of Servers.
+func (mr *MockServerSourceMockRecorder) Servers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Servers", reflect.TypeOf((*MockServerSource)(nil).Servers))
+}
+
+// MockRuntime is a mock of Runtime interface.
+type MockRuntime struct {
+	ctrl     *gomock.Controller
+	recorder *MockRuntimeMockRecorder
+	isgomock struct{}
+}
+
+// MockRuntimeMockRecorder is the mock recorder for MockRuntime.
+type MockRuntimeMockRecorder struct {
+	mock *MockRuntime
+}
+
+// NewMockRuntime creates a new mock instance.
+func NewMockRuntime(ctrl *gomock.Controller) *MockRuntime {
+	mock := &MockRuntime{ctrl: ctrl}
+	mock.recorder = &MockRuntimeMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRuntime) EXPECT() *MockRuntimeMockRecorder {
+	return m.recorder
+}
+
+// Apply mocks base method.
+func (m *MockRuntime) Apply(server *LogicalServer) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Apply", server)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Apply indicates an expected call of Apply.
+func (mr *MockRuntimeMockRecorder) Apply(server any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Apply", reflect.TypeOf((*MockRuntime)(nil).Apply), server)
+}
+
+// Restart mocks base method.
+func (m *MockRuntime) Restart() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restart")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Restart indicates an expected call of Restart.
+func (mr *MockRuntimeMockRecorder) Restart() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restart", reflect.TypeOf((*MockRuntime)(nil).Restart))
+}
+
+// WaitReady mocks base method.
+func (m *MockRuntime) WaitReady(timeout time.Duration) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitReady", timeout)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// WaitReady indicates an expected call of WaitReady.
+func (mr *MockRuntimeMockRecorder) WaitReady(timeout any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitReady", reflect.TypeOf((*MockRuntime)(nil).WaitReady), timeout)
+}
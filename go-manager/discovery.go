@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// discoveryInterval is how long a label lookup is reused before the
+// containers are listed again.
+const discoveryInterval = 30 * time.Second
+
+// listContainers is docker.List, replaceable in tests.
+var listContainers = docker.List
+
+var discovered struct {
+	mu    sync.Mutex
+	at    time.Time
+	list  []docker.Container
+	valid bool
+}
+
+// gluetunInstances returns the gluetun containers to manage. Without
+// GLUETUN_LABEL that is GLUETUN_CONTAINER_NAME alone. With it, every
+// container carrying the label, sorted by name and re-listed every
+// discoveryInterval, so scaled or renamed stacks are picked up. They all
+// share the env file; the first is the one probed.
+func gluetunInstances() []docker.Container {
+	configured := []docker.Container{{Name: cfg.gluetunContainer, Service: cfg.gluetunService}}
+	if cfg.gluetunLabel == "" {
+		return configured
+	}
+
+	discovered.mu.Lock()
+	defer discovered.mu.Unlock()
+	if discovered.valid && time.Since(discovered.at) < discoveryInterval {
+		return discovered.list
+	}
+
+	list, err := listContainers(cfg.gluetunLabel)
+	switch {
+	case err != nil:
+		log(fmt.Sprintf("Gluetun discovery failed: %v", err))
+	case len(list) == 0:
+		log(fmt.Sprintf("No containers labelled %s", cfg.gluetunLabel))
+	default:
+		if !slices.Equal(list, discovered.list) {
+			var names []string
+			for _, c := range list {
+				names = append(names, c.Name)
+			}
+			log(fmt.Sprintf("Gluetun containers (%s): %s", cfg.gluetunLabel, strings.Join(names, ", ")))
+		}
+		discovered.list = list
+	}
+	// Failed lookups are retried on the same schedule, keeping the last list
+	discovered.at, discovered.valid = time.Now(), true
+	if len(discovered.list) == 0 {
+		return configured
+	}
+	return discovered.list
+}
+
+// rediscoverGluetun makes the next gluetunInstances call list containers
+// again, e.g. after a recreate.
+func rediscoverGluetun() {
+	discovered.mu.Lock()
+	discovered.valid = false
+	discovered.mu.Unlock()
+}
+
+// gluetunServices returns the Compose services of the gluetun instances,
+// falling back to GLUETUN_SERVICE_NAME for containers not made by Compose.
+func gluetunServices() []string {
+	var services []string
+	for _, c := range gluetunInstances() {
+		service := c.Service
+		if service == "" {
+			service = cfg.gluetunService
+		}
+		if !slices.Contains(services, service) {
+			services = append(services, service)
+		}
+	}
+	return services
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+func stubContainers(t *testing.T, list *[]docker.Container, err *error) *int {
+	t.Helper()
+	calls := 0
+	listContainers = func(label string) ([]docker.Container, error) {
+		calls++
+		return *list, *err
+	}
+	t.Cleanup(func() { listContainers = docker.List })
+	return &calls
+}
+
+func TestGluetunInstancesByLabel(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.gluetunContainer = "gluetun"
+	list := []docker.Container{{Name: "vpn-gluetun-1", Service: "gluetun"}, {Name: "vpn-gluetun-2", Service: "gluetun"}}
+	var err error
+	calls := stubContainers(t, &list, &err)
+
+	// Without a label the configured name is used
+	if got := activeGluetun(); got != "gluetun" || *calls != 0 {
+		t.Errorf("activeGluetun = %q after %d lookups, want gluetun without any", got, *calls)
+	}
+
+	cfg.gluetunLabel = "proton-sidecar.manage=true"
+	if got := activeGluetun(); got != "vpn-gluetun-1" {
+		t.Errorf("activeGluetun = %q, want vpn-gluetun-1", got)
+	}
+	if got := gluetunServices(); !slices.Equal(got, []string{"gluetun"}) {
+		t.Errorf("services = %v, want [gluetun]", got)
+	}
+	if *calls != 1 {
+		t.Errorf("%d lookups, want 1 (cached)", *calls)
+	}
+
+	// A renamed stack is picked up once the cache is refreshed
+	list = []docker.Container{{Name: "home-vpn-1", Service: "vpn"}}
+	rediscoverGluetun()
+	if got := activeGluetun(); got != "home-vpn-1" {
+		t.Errorf("activeGluetun = %q, want home-vpn-1", got)
+	}
+
+	// A failed lookup keeps the last list
+	list, err = nil, errors.New("daemon unreachable")
+	rediscoverGluetun()
+	if got := activeGluetun(); got != "home-vpn-1" {
+		t.Errorf("activeGluetun after a failed lookup = %q, want home-vpn-1", got)
+	}
+}
+
+func TestGluetunInstancesFallBack(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.gluetunContainer, cfg.gluetunLabel = "gluetun", "proton-sidecar.manage=true"
+	var list []docker.Container
+	var err error
+	stubContainers(t, &list, &err)
+
+	if got := activeGluetun(); got != "gluetun" {
+		t.Errorf("activeGluetun with no matches = %q, want the configured gluetun", got)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// runDoctor runs the validate checks plus a Proton API reachability check
+// and explains how to fix each failure. It returns an exit code like
+// runValidate.
+func runDoctor() int {
+	fmt.Printf("Manager %s\n", currentBuild())
+	results := append([]checkResult{checkProtonAPI()}, validationChecks()...)
+	for i := range results {
+		if !results[i].OK {
+			results[i].Hint = doctorHint(results[i])
+		}
+	}
+	if printReport(results) {
+		return 0
+	}
+	return checksExitCode(results)
+}
+
+// checkProtonAPI reports whether the Proton API answers at all. Any HTTP
+// response counts: the request is unauthenticated.
+func checkProtonAPI() checkResult {
+	resp, err := sendAPI(func(base string) (*http.Request, error) {
+		return http.NewRequest("GET", base+"/tests/ping", nil)
+	})
+	if err != nil {
+		return checkResult{Name: "Proton API", Detail: err.Error()}
+	}
+	resp.Body.Close()
+	via := cfg.apiBaseURL
+	if host := currentAltHost(); host != "" {
+		via = host + " (alternative routing)"
+	}
+	return checkResult{Name: "Proton API", OK: true, Detail: fmt.Sprintf("%s answered %s", via, resp.Status)}
+}
+
+// doctorHint suggests a fix for a failed check, going by its name and the
+// error it reported.
+func doctorHint(r checkResult) string {
+	detail := strings.ToLower(r.Detail)
+	denied := strings.Contains(detail, "permission denied")
+	missing := strings.Contains(detail, "no such file")
+	switch {
+	case r.Name == "Configuration":
+		return "fix the settings listed; .example.env documents each of them"
+	case r.Name == "Proton API":
+		if cfg.apiProxyURL != "" {
+			return fmt.Sprintf("check that API_PROXY_URL (%s) is up and can reach %s", cfg.apiProxyURL, cfg.apiBaseURL)
+		}
+		if !cfg.altRouting {
+			return "check the manager's network and DNS, or set ALT_ROUTING=true to fall back to Proton's alternative routing"
+		}
+		return "check the manager's network and DNS; if Proton is blocked here, set API_PROXY_URL to a proxy that can reach it"
+	case strings.HasPrefix(r.Name, "Proton auth"):
+		if strings.Contains(detail, "verification") || strings.Contains(detail, "captcha") {
+			return fmt.Sprintf("solve the CAPTCHA the manager logs when it starts, or write the token to HV_TOKEN_FILE (%s)", cfg.hvTokenFile)
+		}
+		return fmt.Sprintf("check PROTON_USERNAME and PROTON_PASSWORD; if they are right, delete SESSION_FILE (%s) to force a fresh login", cfg.sessionFile)
+	case r.Name == "Server list":
+		return "the session works but the server list didn't load; try again later or check PROTON_API_URL"
+	case strings.HasPrefix(r.Name, "Target"):
+		return "check the spelling against `manager -list-cities`, or set TARGET_FALLBACK=true"
+	case r.Name == "Preferred servers":
+		return "check PREFERRED_SERVERS; servers are named like CH#10 and must still be in Proton's list"
+	case r.Name == "Docker":
+		if denied {
+			return "the manager can't use the Docker socket; run it as root or with the socket's group (group_add), or point DOCKER_HOST at a socket proxy"
+		}
+		if missing {
+			return "mount /var/run/docker.sock into the manager, or set DOCKER_HOST"
+		}
+		return fmt.Sprintf("check DOCKER_HOST (%s) and that the Docker daemon is running", getEnv("DOCKER_HOST", docker.DefaultHost))
+	case r.Name == "Gluetun container":
+		return "set GLUETUN_CONTAINER_NAME to the container_name shown by docker ps"
+	case r.Name == "Dependent container":
+		return "check the names in DEPENDENT_CONTAINERS against docker ps"
+	case r.Name == "Compose":
+		if strings.Contains(detail, "not defined") {
+			return "set GLUETUN_SERVICE_NAME to gluetun's service name, or COMPOSE_FILE to the file that defines it"
+		}
+		if strings.Contains(detail, "config failed") {
+			return fmt.Sprintf("mount the compose project at COMPOSE_PROJECT_DIR (%s) and run docker compose config there to see the error", cfg.composeProjectDir)
+		}
+		return "use the manager image, which ships docker compose, or set DOCKER_API=true to manage gluetun without Compose"
+	case r.Name == "Env file":
+		if denied {
+			return fmt.Sprintf("make ENV_FILE_PATH (%s) writable by uid %d, and mount it read-write", cfg.envFile, os.Getuid())
+		}
+		if missing {
+			return fmt.Sprintf("mount gluetun's env file at ENV_FILE_PATH (%s), or create it", cfg.envFile)
+		}
+		return "check ENV_FILE_PATH and ENV_FILE_FORMAT"
+	case r.Name == "Gluetun env":
+		return "set the listed variables in the env file gluetun reads; see docker-compose.example.yml"
+	case r.Name == "Gluetun version":
+		return "remove the variables gluetun doesn't read from the env file; if the version is wrong, set GLUETUN_VERSION to the release gluetun runs"
+	case r.Name == "IPv6":
+		return "add Proton's IPv6 tunnel address to WIREGUARD_ADDRESSES in the env file, e.g. 10.2.0.2/32,2a07:b944::2:2/128, and enable IPv6 where gluetun runs (sysctl net.ipv6.conf.all.disable_ipv6=0)"
+	case r.Name == "MQTT":
+		return "check MQTT_BROKER, MQTT_USERNAME and MQTT_PASSWORD"
+	case r.Name == "Control API":
+		return "check CONTROL_TLS_CERT and CONTROL_TLS_KEY, or unset both to use a generated certificate"
+	case strings.HasPrefix(r.Name, "Nomad"):
+		return "check NOMAD_ADDR, NOMAD_TOKEN and the NOMAD_* job settings"
+	case strings.HasPrefix(r.Name, "Kubernetes"), r.Name == "VPNTunnel":
+		return "check the manager's service account can read the VPNTunnel, its Secret and its workload"
+	}
+	return ""
+}
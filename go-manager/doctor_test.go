@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDoctorHint(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.sessionFile = "/data/proton_session.json"
+
+	tests := []struct {
+		result checkResult
+		want   string
+	}{
+		{checkResult{Name: "Docker", Detail: "cannot reach Docker daemon: dial unix /var/run/docker.sock: connect: permission denied"}, "socket's group"},
+		{checkResult{Name: "Docker", Detail: "cannot reach Docker daemon: dial unix /var/run/docker.sock: connect: no such file or directory"}, "mount /var/run/docker.sock"},
+		{checkResult{Name: "Env file", Detail: "open /project/.env: permission denied"}, "writable by uid"},
+		{checkResult{Name: "Env file", Detail: "open /project/.env: no such file or directory"}, "mount gluetun's env file"},
+		{checkResult{Name: "Compose", Detail: `service "gluetun" not defined in /project/docker-compose.yml`}, "GLUETUN_SERVICE_NAME"},
+		{checkResult{Name: "Compose", Detail: "neither 'docker compose' nor 'docker-compose' is available"}, "DOCKER_API=true"},
+		{checkResult{Name: "Proton auth (alice)", Detail: "422: Incorrect login credentials"}, "delete SESSION_FILE (/data/proton_session.json)"},
+		{checkResult{Name: "Proton auth", Detail: "Human verification required"}, "HV_TOKEN_FILE"},
+		{checkResult{Name: "Target cities", Detail: `no active servers in "Zurch"`}, "-list-cities"},
+		{checkResult{Name: "Something new", Detail: "failed"}, ""},
+	}
+	for _, tt := range tests {
+		got := doctorHint(tt.result)
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("doctorHint(%s: %s) = %q, want it to contain %q", tt.result.Name, tt.result.Detail, got, tt.want)
+		}
+	}
+}
+
+func TestBuildInfoString(t *testing.T) {
+	b := buildInfo{Version: "v1.4.0", Commit: "3f2a9c1d5e", BuildDate: "2026-01-02T15:04:05Z", GoVersion: "go1.25.7", Platform: "linux/amd64"}
+	if got, want := b.String(), "v1.4.0 (3f2a9c1, 2026-01-02T15:04:05Z, go1.25.7 linux/amd64)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	b = buildInfo{Version: "dev", Commit: "3f2a9c1d5e", Modified: true, GoVersion: "go1.25.7", Platform: "linux/arm64"}
+	if got, want := b.String(), "dev (3f2a9c1-dirty, go1.25.7 linux/arm64)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got := currentBuild(); got.Version == "" || got.GoVersion == "" {
+		t.Errorf("currentBuild() = %+v, want a version and Go version", got)
+	}
+}
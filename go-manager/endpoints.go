@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// wireguardEndpoints returns the physical servers of a logical that are up
+// and carry a WireGuard key.
+func wireguardEndpoints(server *LogicalServer) []*Server {
+	var endpoints []*Server
+	for i := range server.Servers {
+		s := &server.Servers[i]
+		if s.X25519PublicKey != "" && s.Status != 0 {
+			endpoints = append(endpoints, s)
+		}
+	}
+	return endpoints
+}
+
+// endpointByIP returns the logical's endpoint with the given entry IP.
+func endpointByIP(server *LogicalServer, ip string) *Server {
+	for _, s := range wireguardEndpoints(server) {
+		if s.EntryIP == ip {
+			return s
+		}
+	}
+	return nil
+}
+
+// wireguardEndpoint picks the physical server to connect to. When a logical
+// has several, each is probed and the fastest reachable one wins; endpoints
+// that don't answer are recorded as dead and skipped for a while.
+func wireguardEndpoint(server *LogicalServer) *Server {
+	var alive []*Server
+	for _, s := range wireguardEndpoints(server) {
+		if stateStore == nil || !stateStore.isEndpointDead(s.EntryIP) {
+			alive = append(alive, s)
+		}
+	}
+	if len(alive) == 0 {
+		// Better a recently dead endpoint than none at all
+		if all := wireguardEndpoints(server); len(all) > 0 {
+			return all[0]
+		}
+		return nil
+	}
+	if len(alive) == 1 || !cfg.endpointProbe {
+		return alive[0]
+	}
+
+	rtts := make([]time.Duration, len(alive))
+	var wg sync.WaitGroup
+	for i, s := range alive {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			rtts[i] = probeEndpoint(ip)
+		}(i, s.EntryIP)
+	}
+	wg.Wait()
+
+	var best *Server
+	var bestRTT time.Duration
+	for i, s := range alive {
+		if rtts[i] < 0 {
+			log(fmt.Sprintf("Endpoint %s of %s is unreachable", s.EntryIP, server.Name))
+			if stateStore != nil {
+				stateStore.markEndpointDead(s.EntryIP)
+			}
+			continue
+		}
+		if best == nil || rtts[i] < bestRTT {
+			best, bestRTT = s, rtts[i]
+		}
+	}
+	if best == nil {
+		return alive[0]
+	}
+	log(fmt.Sprintf("Selected endpoint %s of %s (%s)", best.EntryIP, server.Name, bestRTT.Round(time.Millisecond)))
+	return best
+}
+
+// probeEndpoint returns the round-trip time to a WireGuard endpoint, or -1 if
+// it is unreachable. WireGuard ignores unauthenticated packets, so UDP can only
+// prove a port closed; the RTT comes from ICMP, or a TCP handshake on 443
+// when raw sockets aren't permitted.
+func probeEndpoint(ip string) time.Duration {
+	if udpPortRefused(ip, wireguardPort()) {
+		return -1
+	}
+
+	start := time.Now()
+	ok, err := health.Ping(ip, 2, time.Second)
+	if err == nil {
+		if !ok {
+			return -1
+		}
+		return time.Since(start)
+	}
+
+	start = time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, "443"), 2*time.Second)
+	if err != nil {
+		return -1
+	}
+	conn.Close()
+	return time.Since(start)
+}
+
+// udpPortRefused sends a probe datagram and reports whether the host answered
+// with ICMP port unreachable.
+func udpPortRefused(ip, port string) bool {
+	conn, err := net.Dial("udp", net.JoinHostPort(ip, port))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return errors.Is(err, syscall.ECONNREFUSED)
+	}
+	_, err = conn.Read(make([]byte, 1))
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func endpointServer() *LogicalServer {
+	return &LogicalServer{Name: "CH#4", Servers: []Server{
+		{EntryIP: "192.0.2.1", Status: 1, X25519PublicKey: "key1"},
+		{EntryIP: "192.0.2.2", Status: 0, X25519PublicKey: "key2"}, // down
+		{EntryIP: "192.0.2.3", Status: 1},                          // OpenVPN only
+		{EntryIP: "192.0.2.4", Status: 1, X25519PublicKey: "key4"},
+	}}
+}
+
+func TestWireguardEndpointSkipsDead(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		dead []string
+		want string
+	}{
+		{"first usable", nil, "192.0.2.1"},
+		{"first dead", []string{"192.0.2.1"}, "192.0.2.4"},
+		// Better a recently dead endpoint than none at all
+		{"all dead", []string{"192.0.2.1", "192.0.2.4"}, "192.0.2.1"},
+	} {
+		setupTestEnv(t, "CH#4")
+		for _, ip := range tc.dead {
+			stateStore.markEndpointDead(ip)
+		}
+		if got := wireguardEndpoint(endpointServer()); got == nil || got.EntryIP != tc.want {
+			t.Errorf("%s: endpoint = %v, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	if got := wireguardEndpoint(&LogicalServer{Servers: []Server{{EntryIP: "192.0.2.3", Status: 1}}}); got != nil {
+		t.Errorf("endpoint without a WireGuard key = %v", got)
+	}
+	if got := endpointByIP(endpointServer(), "192.0.2.2"); got != nil {
+		t.Errorf("endpointByIP returned a server that is down: %v", got)
+	}
+}
+
+func TestWireguardEndpointProbe(t *testing.T) {
+	setupTestEnv(t, "CH#4")
+	cfg.endpointProbe = true
+	server := &LogicalServer{Name: "LO#1", Servers: []Server{
+		{EntryIP: "127.0.0.1", Status: 1, X25519PublicKey: "key1"},
+		{EntryIP: "127.0.0.2", Status: 1, X25519PublicKey: "key2"},
+	}}
+
+	// Nothing listens on loopback, so both refuse the WireGuard port
+	if got := wireguardEndpoint(server); got == nil || got.EntryIP != "127.0.0.1" {
+		t.Errorf("endpoint = %v, want the first when none answer", got)
+	}
+	if !stateStore.isEndpointDead("127.0.0.1") || !stateStore.isEndpointDead("127.0.0.2") {
+		t.Errorf("unreachable endpoints not recorded: %v", stateStore.DeadEndpoints)
+	}
+}
+
+func TestEndpointDeadExpires(t *testing.T) {
+	setupTestEnv(t, "CH#4")
+	cfg.endpointDeadFor = 60
+	stateStore.DeadEndpoints = map[string]time.Time{"192.0.2.9": time.Now().Add(-time.Second)}
+	if stateStore.isEndpointDead("192.0.2.9") {
+		t.Error("expired endpoint still dead")
+	}
+
+	stateStore.markEndpointDead("192.0.2.1")
+	if _, ok := stateStore.DeadEndpoints["192.0.2.9"]; ok {
+		t.Error("expired endpoint not pruned")
+	}
+	stateStore = loadStore(stateStore.path)
+	if !stateStore.isEndpointDead("192.0.2.1") {
+		t.Error("dead endpoint lost on reload")
+	}
+	if d := time.Until(stateStore.DeadEndpoints["192.0.2.1"]); d < 50*time.Second || d > 60*time.Second {
+		t.Errorf("dead for %s, want ENDPOINT_DEAD_DURATION", d)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backups of the env file are named after the time they were taken, so they
+// sort chronologically and can be picked by (a prefix of) their timestamp.
+const envBackupLayout = "20060102T150405.000Z"
+
+// updateEnvFile is updateEnvVars, replaceable in tests.
+var updateEnvFile = updateEnvVars
+
+func envBackupDir() string {
+	return filepath.Join(cfg.cacheDir, "env-backups")
+}
+
+// envBackups lists the backup timestamps, oldest first.
+func envBackups() []string {
+	entries, _ := os.ReadDir(envBackupDir())
+	var stamps []string
+	for _, e := range entries {
+		if _, err := time.Parse(envBackupLayout, e.Name()); err == nil {
+			stamps = append(stamps, e.Name())
+		}
+	}
+	sort.Strings(stamps)
+	return stamps
+}
+
+// backupEnvFile copies the env file into the backup directory, unless it is
+// unchanged since the latest backup, and prunes all but the newest
+// ENV_BACKUP_COUNT backups.
+func backupEnvFile() error {
+	if cfg.envBackupCount <= 0 {
+		return nil
+	}
+	data, err := os.ReadFile(cfg.envFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(envBackupDir(), 0700); err != nil {
+		return err
+	}
+
+	stamps := envBackups()
+	if n := len(stamps); n > 0 {
+		if latest, err := os.ReadFile(filepath.Join(envBackupDir(), stamps[n-1])); err == nil && bytes.Equal(latest, data) {
+			return nil
+		}
+	}
+	now := time.Now().UTC()
+	stamp := now.Format(envBackupLayout)
+	for _, err := os.Stat(filepath.Join(envBackupDir(), stamp)); err == nil; _, err = os.Stat(filepath.Join(envBackupDir(), stamp)) {
+		now = now.Add(time.Millisecond) // keep backups taken in the same millisecond
+		stamp = now.Format(envBackupLayout)
+	}
+	if err := os.WriteFile(filepath.Join(envBackupDir(), stamp), data, 0600); err != nil {
+		return err
+	}
+
+	stamps = envBackups()
+	for len(stamps) > cfg.envBackupCount {
+		os.Remove(filepath.Join(envBackupDir(), stamps[0]))
+		stamps = stamps[1:]
+	}
+	return nil
+}
+
+// findEnvBackup resolves stamp to a backup: the latest one if stamp is
+// empty, otherwise the latest one starting with stamp.
+func findEnvBackup(stamp string) (string, error) {
+	var match string
+	for _, s := range envBackups() {
+		if strings.HasPrefix(s, stamp) {
+			match = s
+		}
+	}
+	if match == "" {
+		if stamp == "" {
+			return "", fmt.Errorf("no env file backups in %s", envBackupDir())
+		}
+		return "", fmt.Errorf("no env file backup matching %q", stamp)
+	}
+	return match, nil
+}
+
+// readEnvBackup resolves stamp with findEnvBackup and reads that backup.
+func readEnvBackup(stamp string) (string, []byte, error) {
+	match, err := findEnvBackup(stamp)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(envBackupDir(), match))
+	if err != nil {
+		return "", nil, err
+	}
+	return match, data, nil
+}
+
+// restoreEnvFile writes a backup back over the env file and returns the
+// timestamp restored.
+func restoreEnvFile(stamp string) (string, error) {
+	match, data, err := readEnvBackup(stamp)
+	if err != nil {
+		return "", err
+	}
+	return match, os.WriteFile(cfg.envFile, data, 0644)
+}
+
+// backupAndRestoreEnvFile is restoreEnvFile for a user asking for a backup:
+// the current env file is backed up first, so the restore can be undone.
+// The chosen backup is read before that, as the new backup would otherwise
+// become the latest, or prune the chosen one out of a full set.
+func backupAndRestoreEnvFile(stamp string) (string, error) {
+	match, data, err := readEnvBackup(stamp)
+	if err != nil {
+		return "", err
+	}
+	if err := backupEnvFile(); err != nil {
+		return "", fmt.Errorf("failed to back up %s: %v", cfg.envFile, err)
+	}
+	return match, os.WriteFile(cfg.envFile, data, 0644)
+}
+
+// verifyEnvWrite re-reads the env file after an update and checks that it
+// holds the values written and still passes the gluetun env schema.
+func verifyEnvWrite(updates map[string]string) error {
+	vars, err := readEnv()
+	if err != nil {
+		return err
+	}
+	for k, v := range updates {
+		if vars[k] != v {
+			return fmt.Errorf("%s reads back as %q, wrote %q", k, vars[k], v)
+		}
+	}
+	if problems := validateGluetunEnv(vars); len(problems) > 0 {
+		return fmt.Errorf("written env file is invalid: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// runEnvCommand implements "manager env [backups | restore [timestamp]]".
+func runEnvCommand(args []string) {
+	if len(args) == 0 || args[0] == "backups" {
+		stamps := envBackups()
+		if len(stamps) == 0 {
+			fmt.Printf("No env file backups in %s\n", envBackupDir())
+			return
+		}
+		for _, s := range stamps {
+			fmt.Println(s)
+		}
+		return
+	}
+	if args[0] != "restore" || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "usage: manager env [backups | restore [timestamp]]")
+		os.Exit(exitUsage)
+	}
+
+	var stamp string
+	if len(args) == 2 {
+		stamp = args[1]
+	}
+	restored, err := backupAndRestoreEnvFile(stamp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+	fmt.Printf("Restored %s from backup %s\n", cfg.envFile, restored)
+	fmt.Println("The manager will pick up the change on its next env check.")
+}
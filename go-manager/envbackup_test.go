@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gluetun-proton-manager/envfile"
+)
+
+func TestEnvBackupsRotate(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.envBackupCount = 2
+
+	for _, server := range []string{"US#2", "US#3", "US#4"} {
+		if err := writeEnvVars(map[string]string{"PROTON_SERVER_NAME": server}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stamps := envBackups()
+	if len(stamps) != 2 {
+		t.Fatalf("backups = %v, want the newest 2", stamps)
+	}
+
+	if _, err := restoreEnvFile(""); err != nil {
+		t.Fatal(err)
+	}
+	if vars, _ := envfile.Read(cfg.envFile); vars["PROTON_SERVER_NAME"] != "US#3" {
+		t.Errorf("restored latest backup has server %q, want US#3", vars["PROTON_SERVER_NAME"])
+	}
+	if _, err := restoreEnvFile(stamps[0]); err != nil {
+		t.Fatal(err)
+	}
+	if vars, _ := envfile.Read(cfg.envFile); vars["PROTON_SERVER_NAME"] != "US#2" {
+		t.Errorf("restored oldest backup has server %q, want US#2", vars["PROTON_SERVER_NAME"])
+	}
+	if _, err := restoreEnvFile("1999"); err == nil {
+		t.Error("restoring an unknown timestamp succeeded")
+	}
+}
+
+func TestRestoreOldestBackupFromFullSet(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.envBackupCount = 2
+	for _, server := range []string{"US#2", "US#3", "US#4"} {
+		if err := writeEnvVars(map[string]string{"PROTON_SERVER_NAME": server}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldest := envBackups()[0]
+
+	// Backing up US#4 prunes the oldest backup, the one being restored.
+	restored, err := backupAndRestoreEnvFile(oldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored != oldest {
+		t.Errorf("restored %s, want %s", restored, oldest)
+	}
+	if vars, _ := envfile.Read(cfg.envFile); vars["PROTON_SERVER_NAME"] != "US#2" {
+		t.Errorf("restored env file has server %q, want US#2", vars["PROTON_SERVER_NAME"])
+	}
+	stamps := envBackups()
+	if len(stamps) != 2 {
+		t.Fatalf("backups = %v, want 2", stamps)
+	}
+	if _, data, _ := readEnvBackup(stamps[1]); !strings.Contains(string(data), "US#4") {
+		t.Errorf("latest backup = %q, want the env file from before the restore", data)
+	}
+}
+
+func TestEnvBackupSkipsUnchangedFile(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	backupEnvFile()
+	backupEnvFile()
+	if stamps := envBackups(); len(stamps) != 1 {
+		t.Errorf("backups = %v, want 1", stamps)
+	}
+}
+
+func TestMangledWriteIsRestored(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	before, _ := os.ReadFile(cfg.envFile)
+	updateEnvFile = func(path string, vars map[string]string) error {
+		return os.WriteFile(path, []byte("PROTON_SERVER_NAME=US#2\nWIREGUARD_ENDPOINT_IP=10.0.0.\n"), 0644)
+	}
+	t.Cleanup(func() { updateEnvFile = updateEnvVars })
+
+	err := writeEnvVars(map[string]string{"PROTON_SERVER_NAME": "US#2"})
+	if err == nil || !strings.Contains(err.Error(), "WIREGUARD_ENDPOINT_IP") {
+		t.Errorf("writeEnvVars error = %v, want an invalid WIREGUARD_ENDPOINT_IP", err)
+	}
+	if after, _ := os.ReadFile(cfg.envFile); string(after) != string(before) {
+		t.Errorf("env file = %q, want it restored to %q", after, before)
+	}
+}
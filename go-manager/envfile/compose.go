@@ -0,0 +1,302 @@
+package envfile
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// composeEnv locates a service's environment block in a compose file.
+// Entries are the lines in [start, end); a missing block is inserted at end.
+type composeEnv struct {
+	lines  []string
+	found  bool
+	list   bool   // "- KEY=value" entries rather than "KEY: value"
+	prefix string // indentation (and dash) for new entries
+	start  int
+	end    int
+}
+
+// ReadCompose returns the environment of a service defined inline in a
+// compose file. Entries without a value are left out.
+func ReadCompose(path, service string) (map[string]string, error) {
+	vars := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return vars, err
+	}
+	env, err := locateEnv(strings.Split(string(data), "\n"), service)
+	if err != nil {
+		return vars, err
+	}
+	for _, line := range env.lines[env.start:env.end] {
+		if k, v, _, ok := parseEntry(line); ok && v != "" {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+// UpdateCompose sets the given variables in a service's environment block,
+// rewriting existing entries in place and appending missing ones in the
+// block's own style. Everything else in the file is left as it was.
+func UpdateCompose(path, service string, vars map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	env, err := locateEnv(strings.Split(string(data), "\n"), service)
+	if err != nil {
+		return err
+	}
+
+	lines := append([]string{}, env.lines[:env.start]...)
+	found := make(map[string]bool)
+	for _, line := range env.lines[env.start:env.end] {
+		k, _, comment, ok := parseEntry(line)
+		if v, set := vars[k]; ok && set {
+			trimmed := strings.TrimLeft(line, " ")
+			indent := line[:len(line)-len(trimmed)]
+			if strings.HasPrefix(trimmed, "-") {
+				style := quoteStyle(strings.TrimSpace(trimmed[1:]))
+				line = indent + "- " + item(k, v, true, style)
+			} else {
+				_, rest, _ := mappingKey(trimmed)
+				line = indent + item(k, v, false, quoteStyle(rest))
+			}
+			if comment != "" {
+				line += " " + comment
+			}
+			found[k] = true
+		}
+		lines = append(lines, line)
+	}
+
+	var missing []string
+	for k := range vars {
+		if !found[k] {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 && !env.found {
+		lines = append(lines, strings.TrimSuffix(env.prefix, "  - ")+"environment:")
+	}
+	for _, k := range missing {
+		lines = append(lines, env.prefix+item(k, vars[k], env.list, 0))
+	}
+	lines = append(lines, env.lines[env.end:]...)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), info.Mode().Perm())
+}
+
+func locateEnv(lines []string, service string) (composeEnv, error) {
+	env := composeEnv{lines: lines}
+
+	// services: at the top level
+	i := findKey(lines, 0, len(lines), 0, "services")
+	if i < 0 {
+		return env, fmt.Errorf("no services in compose file")
+	}
+	end := blockEnd(lines, i, 0)
+	svcIndent := firstIndent(lines, i+1, end)
+	j := findKey(lines, i+1, end, svcIndent, service)
+	if j < 0 {
+		return env, fmt.Errorf("service %q not found in compose file", service)
+	}
+
+	// the service's keys
+	end = blockEnd(lines, j, svcIndent)
+	keyIndent := firstIndent(lines, j+1, end)
+	if keyIndent <= svcIndent {
+		keyIndent = svcIndent + 2
+	}
+	k := findKey(lines, j+1, end, keyIndent, "environment")
+	if k < 0 {
+		env.start, env.end = end, end
+		env.list, env.prefix = true, strings.Repeat(" ", keyIndent)+"  - "
+		return env, nil
+	}
+	if _, rest, _ := mappingKey(strings.TrimSpace(lines[k])); rest != "" && !strings.HasPrefix(rest, "#") {
+		return env, fmt.Errorf("service %q: only block-style environment is supported", service)
+	}
+
+	// the entries, which may be list items at the key's own indentation
+	env.found, env.start, env.end = true, k+1, k+1
+	for n := k + 1; n < len(lines); n++ {
+		line := lines[n]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < keyIndent || indent == keyIndent && !strings.HasPrefix(trimmed, "-") {
+			break
+		}
+		if env.end == env.start {
+			env.list = strings.HasPrefix(trimmed, "-")
+			env.prefix = line[:indent]
+			if env.list {
+				env.prefix += "- "
+			}
+		}
+		env.end = n + 1
+	}
+	if env.end == env.start {
+		env.list, env.prefix = true, strings.Repeat(" ", keyIndent)+"  - "
+	}
+	return env, nil
+}
+
+// blockEnd returns the index just past the last content line nested under
+// lines[start].
+func blockEnd(lines []string, start, indent int) int {
+	end := start + 1
+	for n := start + 1; n < len(lines); n++ {
+		trimmed := strings.TrimSpace(lines[n])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if len(lines[n])-len(strings.TrimLeft(lines[n], " ")) <= indent {
+			break
+		}
+		end = n + 1
+	}
+	return end
+}
+
+func firstIndent(lines []string, start, end int) int {
+	for _, line := range lines[start:end] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return len(line) - len(strings.TrimLeft(line, " "))
+		}
+	}
+	return -1
+}
+
+// findKey returns the index of the mapping key name at exactly indent.
+func findKey(lines []string, start, end, indent int, name string) int {
+	for n := start; n < end; n++ {
+		line := lines[n]
+		if len(line)-len(strings.TrimLeft(line, " ")) != indent {
+			continue
+		}
+		if key, _, ok := mappingKey(strings.TrimSpace(line)); ok && key == name {
+			return n
+		}
+	}
+	return -1
+}
+
+// mappingKey splits "key: rest" (the key optionally quoted).
+func mappingKey(s string) (key, rest string, ok bool) {
+	if s == "" || s[0] == '#' || s[0] == '-' {
+		return "", "", false
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		end := strings.IndexByte(s[1:], s[0]) + 1
+		if end == 0 || !strings.HasPrefix(s[end+1:], ":") {
+			return "", "", false
+		}
+		return s[1:end], strings.TrimSpace(s[end+2:]), true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i == len(s)-1 || s[i+1] == ' ') {
+			return s[:i], strings.TrimSpace(s[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// parseEntry reads one entry line, returning its key, value and trailing
+// comment. Entries without a value ("- KEY" or "KEY:") have an empty one.
+func parseEntry(line string) (key, value, comment string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", "", "", false
+	}
+	if strings.HasPrefix(trimmed, "-") {
+		entry, comment := scalar(strings.TrimSpace(trimmed[1:]))
+		key, value, _ = strings.Cut(entry, "=")
+		return strings.TrimSpace(key), value, comment, key != ""
+	}
+	key, rest, ok := mappingKey(trimmed)
+	if !ok {
+		return "", "", "", false
+	}
+	if rest == "" || strings.HasPrefix(rest, "#") {
+		return key, "", rest, true
+	}
+	value, comment = scalar(rest)
+	return key, value, comment, true
+}
+
+// item formats an entry without its list dash: KEY=value for a list,
+// KEY: value for a mapping. A non-zero style keeps the entry's quotes.
+func item(key, value string, list bool, style byte) string {
+	if list {
+		return quote(key+"="+value, style)
+	}
+	return key + ": " + quote(value, style)
+}
+
+// quoteStyle returns the quote character a scalar starts with, if any.
+func quoteStyle(s string) byte {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		return s[0]
+	}
+	return 0
+}
+
+// scalar decodes a plain or quoted YAML scalar, splitting off a comment.
+func scalar(s string) (value, comment string) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					v = s[1:i]
+				}
+				return v, strings.TrimSpace(s[i+1:])
+			}
+		}
+	case strings.HasPrefix(s, "'"):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+					continue
+				}
+				return strings.ReplaceAll(s[1:i], "''", "'"), strings.TrimSpace(s[i+1:])
+			}
+		}
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:])
+	}
+	return s, ""
+}
+
+// quote quotes a value in the given style, or double-quotes it if it isn't
+// safe as a plain YAML scalar.
+func quote(s string, style byte) string {
+	if style == '\'' {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	if style == 0 && s != "" && !strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@` ") &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") &&
+		!strings.HasSuffix(s, ":") && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	return strconv.Quote(s)
+}
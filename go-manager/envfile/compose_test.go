@@ -0,0 +1,124 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCompose(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUpdateComposeList(t *testing.T) {
+	path := writeCompose(t, `services:
+  gluetun:
+    image: qmcgaw/gluetun
+    environment:
+      # Proton
+      - VPN_SERVICE_PROVIDER=custom
+      - "SERVER_NAMES=US#1" # managed
+      - VPN_ENDPOINT_PORT
+    ports:
+      - 8888:8888
+  other:
+    environment:
+      - SERVER_NAMES=untouched
+`)
+	err := UpdateCompose(path, "gluetun", map[string]string{
+		"SERVER_NAMES":      "US#2",
+		"VPN_ENDPOINT_PORT": "51820",
+		"VPN_ENDPOINT_IP":   "10.0.0.2",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `services:
+  gluetun:
+    image: qmcgaw/gluetun
+    environment:
+      # Proton
+      - VPN_SERVICE_PROVIDER=custom
+      - "SERVER_NAMES=US#2" # managed
+      - VPN_ENDPOINT_PORT=51820
+      - VPN_ENDPOINT_IP=10.0.0.2
+    ports:
+      - 8888:8888
+  other:
+    environment:
+      - SERVER_NAMES=untouched
+`
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("compose file =\n%s\nwant\n%s", data, want)
+	}
+	vars, err := ReadCompose(path, "gluetun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["SERVER_NAMES"] != "US#2" || vars["VPN_ENDPOINT_PORT"] != "51820" || vars["VPN_SERVICE_PROVIDER"] != "custom" {
+		t.Errorf("ReadCompose = %v", vars)
+	}
+}
+
+func TestUpdateComposeMapping(t *testing.T) {
+	path := writeCompose(t, `services:
+    gluetun:
+        environment:
+            VPN_TYPE: wireguard
+            WIREGUARD_PUBLIC_KEY: 'old'
+`)
+	if err := UpdateCompose(path, "gluetun", map[string]string{"WIREGUARD_PUBLIC_KEY": "a+b/c=", "SERVER_NAMES": "CH#4"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+    gluetun:
+        environment:
+            VPN_TYPE: wireguard
+            WIREGUARD_PUBLIC_KEY: 'a+b/c='
+            SERVER_NAMES: CH#4
+`
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("compose file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestUpdateComposeAddsEnvironment(t *testing.T) {
+	path := writeCompose(t, `services:
+  gluetun:
+    image: qmcgaw/gluetun
+
+  app:
+    image: app
+`)
+	if err := UpdateCompose(path, "gluetun", map[string]string{"SERVER_NAMES": "NL#9"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `services:
+  gluetun:
+    image: qmcgaw/gluetun
+    environment:
+      - SERVER_NAMES=NL#9
+
+  app:
+    image: app
+`
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("compose file =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestComposeErrors(t *testing.T) {
+	path := writeCompose(t, "services:\n  gluetun:\n    environment: [A=1]\n")
+	if _, err := ReadCompose(path, "gluetun"); err == nil {
+		t.Error("flow-style environment accepted")
+	}
+	if _, err := ReadCompose(path, "missing"); err == nil {
+		t.Error("missing service accepted")
+	}
+}
@@ -0,0 +1,78 @@
+// Package envfile reads and updates the KEY=value env file gluetun's compose
+// service loads, preserving comments and unrelated lines.
+package envfile
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Read parses the env file into a map, ignoring comments and blank lines.
+// Values come out the way compose passes them to the container: quotes are
+// removed, and an unquoted value loses a trailing " #" comment.
+func Read(path string) (map[string]string, error) {
+	vars := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return vars, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		vars[strings.TrimSpace(k)], _ = scalar(strings.TrimSpace(v))
+	}
+	return vars, nil
+}
+
+// Update sets the given variables in the env file, replacing existing lines
+// in place and appending missing ones. A missing file is created.
+func Update(path string, vars map[string]string) error {
+	content, _ := os.ReadFile(path)
+	lines := strings.Split(string(content), "\n")
+
+	newLines := []string{}
+	foundVars := make(map[string]bool)
+
+	for _, line := range lines {
+		updated := false
+		for k, v := range vars {
+			if strings.HasPrefix(line, k+"=") {
+				newLines = append(newLines, fmt.Sprintf("%s=%s", k, v))
+				foundVars[k] = true
+				updated = true
+				break
+			}
+		}
+		if !updated {
+			newLines = append(newLines, line)
+		}
+	}
+
+	// Append missing, in a stable order
+	var missing []string
+	for k := range vars {
+		if !foundVars[k] {
+			missing = append(missing, k)
+		}
+	}
+	sort.Strings(missing)
+	for _, k := range missing {
+		newLines = append(newLines, fmt.Sprintf("%s=%s", k, vars[k]))
+	}
+
+	output := strings.Join(newLines, "\n")
+	// Ensure newline at end
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+
+	return os.WriteFile(path, []byte(output), 0644)
+}
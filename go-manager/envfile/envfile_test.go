@@ -0,0 +1,43 @@
+package envfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "# gluetun\n" +
+		"VPN_SERVICE_PROVIDER=custom\n" +
+		"WIREGUARD_PRIVATE_KEY=\"wOEI9rqqbDwnN8/Bpp22sVz48T71vJ4fYmFWujulwUU=\"\n" +
+		"SERVER_NAMES='US#1'\n" +
+		"TZ=\"Europe/Zurich\\t\" # tab included\n" +
+		"FIREWALL_OUTBOUND_SUBNETS=192.168.1.0/24 # LAN\n" +
+		"HTTPPROXY= on \r\n" +
+		"\n" +
+		"EMPTY=\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"VPN_SERVICE_PROVIDER":      "custom",
+		"WIREGUARD_PRIVATE_KEY":     "wOEI9rqqbDwnN8/Bpp22sVz48T71vJ4fYmFWujulwUU=",
+		"SERVER_NAMES":              "US#1",
+		"TZ":                        "Europe/Zurich\t",
+		"FIREWALL_OUTBOUND_SUBNETS": "192.168.1.0/24",
+		"HTTPPROXY":                 "on",
+		"EMPTY":                     "",
+	} {
+		if got, ok := vars[k]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if len(vars) != 7 {
+		t.Errorf("read %d vars, want 7: %v", len(vars), vars)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gluetun-proton-manager/health"
+)
+
+// envRule checks the format of one gluetun variable. Since is the first
+// gluetun release that reads it; older releases silently ignore it.
+type envRule struct {
+	Check func(string) error
+	Since string
+}
+
+// gluetunEnvSchema covers the variables the manager writes and the common
+// ones whose format gluetun validates at startup. Others aren't checked.
+var gluetunEnvSchema = map[string]envRule{
+	"VPN_TYPE":                      {Check: oneOf("wireguard", "openvpn")},
+	"OPENVPN_PROTOCOL":              {Check: oneOf("udp", "tcp")},
+	"WIREGUARD_ENDPOINT_IP":         {Check: ipAddr, Since: "v3.39.0"},
+	"WIREGUARD_ENDPOINT_PORT":       {Check: port, Since: "v3.39.0"},
+	"WIREGUARD_MTU":                 {Check: mtu},
+	"VPN_ENDPOINT_IP":               {Check: ipAddr},
+	"VPN_ENDPOINT_PORT":             {Check: port},
+	"WIREGUARD_PUBLIC_KEY":          {Check: wireguardKey},
+	"WIREGUARD_PRIVATE_KEY":         {Check: wireguardKey},
+	"WIREGUARD_PRESHARED_KEY":       {Check: wireguardKey},
+	"WIREGUARD_ADDRESSES":           {Check: list(cidr)},
+	"WIREGUARD_ALLOWED_IPS":         {Check: list(cidr)},
+	"FIREWALL_OUTBOUND_SUBNETS":     {Check: list(cidr)},
+	"FIREWALL_VPN_INPUT_PORTS":      {Check: list(port)},
+	"FIREWALL_INPUT_PORTS":          {Check: list(port)},
+	"SERVER_NAMES":                  {Check: list(nonEmpty)},
+	"SERVER_COUNTRIES":              {Check: list(nonEmpty)},
+	"SERVER_CITIES":                 {Check: list(nonEmpty)},
+	"HTTP_CONTROL_SERVER_ADDRESS":   {Check: listenAddr},
+	"HTTPPROXY_LISTENING_ADDRESS":   {Check: listenAddr},
+	"SHADOWSOCKS_LISTENING_ADDRESS": {Check: listenAddr},
+	"HTTPPROXY":                     {Check: onOff},
+	"SHADOWSOCKS":                   {Check: onOff},
+	"SHADOWSOCKS_CIPHER":            {Check: oneOf("chacha20-ietf-poly1305", "aes-128-gcm", "aes-256-gcm")},
+	"VPN_PORT_FORWARDING":           {Check: onOff},
+	"DOT":                           {Check: onOff},
+	"FIREWALL":                      {Check: onOff},
+}
+
+func oneOf(values ...string) func(string) error {
+	return func(v string) error {
+		if !slices.Contains(values, strings.ToLower(v)) {
+			return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+		}
+		return nil
+	}
+}
+
+func onOff(v string) error {
+	return oneOf("on", "off", "yes", "no", "true", "false")(v)
+}
+
+func ipAddr(v string) error {
+	if net.ParseIP(v) == nil {
+		return fmt.Errorf("not an IP address")
+	}
+	return nil
+}
+
+func port(v string) error {
+	if p, err := strconv.Atoi(v); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("not a port between 1 and 65535")
+	}
+	return nil
+}
+
+func mtu(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < health.MinMTU || n > 65535 {
+		return fmt.Errorf("not an MTU between %d and 65535", health.MinMTU)
+	}
+	return nil
+}
+
+func cidr(v string) error {
+	if _, _, err := net.ParseCIDR(v); err != nil {
+		return fmt.Errorf("%q is not a CIDR", v)
+	}
+	return nil
+}
+
+func wireguardKey(v string) error {
+	if key, err := base64.StdEncoding.DecodeString(v); err != nil || len(key) != 32 {
+		return fmt.Errorf("not a base64 WireGuard key")
+	}
+	return nil
+}
+
+func listenAddr(v string) error {
+	_, p, err := net.SplitHostPort(v)
+	if err != nil {
+		return fmt.Errorf("not a host:port address")
+	}
+	return port(p)
+}
+
+func nonEmpty(v string) error {
+	if v == "" {
+		return fmt.Errorf("has an empty entry")
+	}
+	return nil
+}
+
+// list applies check to each comma-separated entry.
+func list(check func(string) error) func(string) error {
+	return func(v string) error {
+		for _, item := range strings.Split(v, ",") {
+			if err := check(strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// validateGluetunEnv checks an env set against the schema and returns what
+// gluetun would reject at startup. Empty values are unset as far as gluetun
+// is concerned, and values with ${...} are left to Compose.
+func validateGluetunEnv(vars map[string]string) []string {
+	var problems []string
+	for key, v := range vars {
+		rule, ok := gluetunEnvSchema[key]
+		if !ok || v == "" || strings.Contains(v, "${") {
+			continue
+		}
+		if err := rule.Check(v); err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%s: %v", key, v, err))
+		}
+	}
+	if strings.EqualFold(vars["VPN_SERVICE_PROVIDER"], "custom") && strings.EqualFold(vars["VPN_TYPE"], "wireguard") {
+		for _, key := range []string{"WIREGUARD_ENDPOINT_IP", "WIREGUARD_PUBLIC_KEY"} {
+			if vars[key] == "" && vars[strings.Replace(key, "WIREGUARD_", "VPN_", 1)] == "" {
+				problems = append(problems, fmt.Sprintf("%s is required with a custom WireGuard provider", key))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// versionWarnings lists variables set in vars that the given gluetun
+// version predates.
+func versionWarnings(vars map[string]string, version string) []string {
+	if !isReleaseVersion(version) {
+		return nil // "latest" or a custom build
+	}
+	var warnings []string
+	for key, rule := range gluetunEnvSchema {
+		if rule.Since != "" && vars[key] != "" && compareVersions(version, rule.Since) < 0 {
+			warnings = append(warnings, fmt.Sprintf("%s needs gluetun %s or later, running %s", key, rule.Since, version))
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// compareVersions compares "vX.Y.Z" versions numerically.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// checkGluetunEnv validates the env file as it would be after applying
+// updates. Format errors are returned; variables the running gluetun
+// version predates are only logged, as gluetun ignores rather than rejects
+// them.
+func checkGluetunEnv(updates map[string]string) error {
+	vars := readEnvFile()
+	for k, v := range updates {
+		vars[k] = v
+	}
+	for _, w := range versionWarnings(toGluetunEnv(vars), currentGluetunVersion()) {
+		log("Warning: " + w)
+	}
+	if problems := validateGluetunEnv(vars); len(problems) > 0 {
+		return fmt.Errorf("gluetun would reject the env file: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const testWireguardKey = "YAnzB0x7aB5lWmbN8kG3nh5fxHcPCKJQp0s3ETC5/nE="
+
+func TestValidateGluetunEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"valid", map[string]string{"VPN_TYPE": "wireguard", "WIREGUARD_ENDPOINT_IP": "10.0.0.1", "WIREGUARD_ENDPOINT_PORT": "51820", "WIREGUARD_PUBLIC_KEY": testWireguardKey}, ""},
+		{"bad ip", map[string]string{"WIREGUARD_ENDPOINT_IP": "10.0.0.300"}, "WIREGUARD_ENDPOINT_IP"},
+		{"bad port", map[string]string{"VPN_ENDPOINT_PORT": "70000"}, "VPN_ENDPOINT_PORT"},
+		{"bad key", map[string]string{"WIREGUARD_PUBLIC_KEY": "k1"}, "WIREGUARD_PUBLIC_KEY"},
+		{"bad cidr", map[string]string{"FIREWALL_OUTBOUND_SUBNETS": "192.168.0.0/16,10.0.0.0"}, "FIREWALL_OUTBOUND_SUBNETS"},
+		{"bad vpn type", map[string]string{"VPN_TYPE": "ipsec"}, "VPN_TYPE"},
+		{"interpolated", map[string]string{"VPN_ENDPOINT_PORT": "${PORT}"}, ""},
+		{"custom without endpoint", map[string]string{"VPN_SERVICE_PROVIDER": "custom", "VPN_TYPE": "wireguard", "WIREGUARD_PUBLIC_KEY": testWireguardKey}, "WIREGUARD_ENDPOINT_IP is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := validateGluetunEnv(tt.vars)
+			if tt.want == "" {
+				if len(problems) > 0 {
+					t.Errorf("problems = %v, want none", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("problems = %v, want one mentioning %s", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionWarnings(t *testing.T) {
+	vars := map[string]string{"WIREGUARD_ENDPOINT_IP": "10.0.0.1"}
+	if w := versionWarnings(vars, "v3.38.0"); len(w) != 1 || !strings.Contains(w[0], "WIREGUARD_ENDPOINT_IP") {
+		t.Errorf("warnings for v3.38.0 = %v, want WIREGUARD_ENDPOINT_IP", w)
+	}
+	for _, version := range []string{"v3.39.0", "v3.40.1", "latest", ""} {
+		if w := versionWarnings(vars, version); len(w) > 0 {
+			t.Errorf("warnings for %q = %v, want none", version, w)
+		}
+	}
+}
+
+func TestWriteEnvVarsRefusesInvalidEnv(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	before, _ := os.ReadFile(cfg.envFile)
+
+	if err := writeEnvVars(map[string]string{"PROTON_SERVER_NAME": "US#2", "WIREGUARD_ENDPOINT_IP": "not-an-ip"}); err == nil {
+		t.Fatal("writeEnvVars accepted an invalid endpoint IP")
+	}
+	if after, _ := os.ReadFile(cfg.envFile); string(after) != string(before) {
+		t.Errorf("env file changed to %q", after)
+	}
+}
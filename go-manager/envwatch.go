@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Policies for handling a PROTON_SERVER_NAME edited outside the manager.
+const (
+	envPolicyAdopt  = "adopt"  // validate and pin the new server
+	envPolicyRevert = "revert" // restore the server the manager last wrote
+	envPolicyIgnore = "ignore" // leave it for the next reconcile
+)
+
+// watchEnvFile signals on changes each time the env file is modified. The
+// parent directory is watched so editors that replace the file via rename are
+// still picked up.
+func watchEnvFile(changes chan<- struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(cfg.envFile)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		target := filepath.Clean(cfg.envFile)
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != target || ev.Has(fsnotify.Chmod) {
+					continue
+				}
+				// Editors often write in several steps; wait for them to settle.
+				debounce = time.After(time.Second)
+			case <-debounce:
+				debounce = nil
+				select {
+				case changes <- struct{}{}:
+				default: // a change is already pending
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log(fmt.Sprintf("Env watcher error: %v", err))
+			}
+		}
+	}()
+	return nil
+}
+
+// unusableReason says why a server chosen by hand can't be used, or returns
+// "" if it can.
+func unusableReason(server *LogicalServer) string {
+	switch {
+	case server == nil:
+		return "server not found"
+	case server.Status != 1:
+		return "server is not active"
+	case len(wireguardEndpoints(server)) == 0:
+		return "no WireGuard endpoint"
+	}
+	return ""
+}
+
+// handleEnvChange validates a manually edited server name and either adopts
+// it as the pinned server or restores the previous one. It returns true if
+// gluetun was recreated on the new settings.
+func handleEnvChange(source ServerSource, rt Runtime, name string) bool {
+	managed := stateStore.state().Server
+	log(fmt.Sprintf("Env file changed externally: PROTON_SERVER_NAME=%q (was %q)", name, managed))
+	if cfg.envChangePolicy == envPolicyIgnore {
+		return false
+	}
+
+	servers, err := source.Servers()
+	if err != nil {
+		log(fmt.Sprintf("Cannot validate %s, error fetching servers: %v", name, err))
+		return false
+	}
+
+	if cfg.envChangePolicy == envPolicyAdopt {
+		server := protonapi.FindByName(servers, name)
+		if reason := unusableReason(server); reason != "" {
+			log(fmt.Sprintf("Rejecting %s: %s", name, reason))
+		} else {
+			log(fmt.Sprintf("Adopting %s as pinned server", name))
+			if !rt.Apply(server) || !rt.Restart() {
+				return false
+			}
+			stateStore.updateState(func(st *State) { st.Pinned = name })
+			return true
+		}
+	}
+
+	// Revert to the server we last wrote
+	previous := protonapi.FindByName(servers, managed)
+	if previous == nil {
+		log(fmt.Sprintf("Cannot revert: previous server %q not found", managed))
+		return false
+	}
+	log(fmt.Sprintf("Reverting env file to %s", previous.Name))
+	return rt.Apply(previous) && rt.Restart()
+}
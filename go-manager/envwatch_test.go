@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHandleEnvChange(t *testing.T) {
+	for _, tc := range []struct {
+		name, policy, edited string
+		managed              string // server the manager last wrote
+		sourceErr            error
+		restart              bool
+		applied              []string
+		pinned               string
+	}{
+		{name: "adopt", policy: envPolicyAdopt, edited: "US#2", restart: true, applied: []string{"US#2"}, pinned: "US#2"},
+		{name: "adopt unknown server reverts", policy: envPolicyAdopt, edited: "XX#9", restart: true, applied: []string{"US#1"}},
+		{name: "adopt invalid name reverts", policy: envPolicyAdopt, edited: "not a server", restart: true, applied: []string{"US#1"}},
+		{name: "adopt inactive server reverts", policy: envPolicyAdopt, edited: "US#3", restart: true, applied: []string{"US#1"}},
+		{name: "adopt server without WireGuard reverts", policy: envPolicyAdopt, edited: "CH#1", restart: true, applied: []string{"US#1"}},
+		{name: "revert", policy: envPolicyRevert, edited: "US#2", restart: true, applied: []string{"US#1"}},
+		{name: "revert without previous server", policy: envPolicyRevert, edited: "US#2", managed: "XX#1"},
+		{name: "ignore", policy: envPolicyIgnore, edited: "US#2"},
+		{name: "servers unavailable", policy: envPolicyAdopt, edited: "US#2", sourceErr: errTest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			managed := tc.managed
+			if managed == "" {
+				managed = "US#1"
+			}
+			setupTestEnv(t, managed)
+			cfg.envChangePolicy = tc.policy
+			servers := append(reconcileServers(), LogicalServer{Name: "CH#1", ExitCountry: "CH", Status: 1})
+			source := newMockServerSource(t, servers...)
+			source.err = tc.sourceErr
+			rt := newMockRuntime(t)
+
+			if got := handleEnvChange(source, rt, tc.edited); got != tc.restart {
+				t.Errorf("handleEnvChange = %v, want %v", got, tc.restart)
+			}
+			if !slices.Equal(rt.appliedNames(), tc.applied) {
+				t.Errorf("applied %v, want %v", rt.appliedNames(), tc.applied)
+			}
+			wantRestarts := 0
+			if tc.restart {
+				wantRestarts = 1
+			}
+			if rt.restarts != wantRestarts {
+				t.Errorf("restarted %d times, want %d", rt.restarts, wantRestarts)
+			}
+			if got := stateStore.state().Pinned; got != tc.pinned {
+				t.Errorf("pinned %q, want %q", got, tc.pinned)
+			}
+			if tc.policy == envPolicyIgnore && source.calls != 0 {
+				t.Errorf("ignore fetched servers %d times", source.calls)
+			}
+		})
+	}
+}
+
+func TestHandleEnvChangeFailedApply(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	rt := newMockRuntime(t)
+	rt.failApply = true
+	if handleEnvChange(newMockServerSource(t, reconcileServers()...), rt, "US#2") {
+		t.Error("handleEnvChange reported a restart after Apply failed")
+	}
+	if rt.restarts != 0 || stateStore.state().Pinned != "" {
+		t.Errorf("restarted %d times, pinned %q, want neither", rt.restarts, stateStore.state().Pinned)
+	}
+}
+
+func TestWatchEnvFileDebounces(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	changes := make(chan struct{}, 1)
+	if err := watchEnvFile(changes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Several writes in quick succession settle into one change, a second
+	// after the last of them.
+	for _, server := range []string{"US#2", "US#3", "US#2"} {
+		if err := os.WriteFile(cfg.envFile, []byte("PROTON_SERVER_NAME="+server+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+	select {
+	case <-changes:
+		t.Fatal("change signalled before the writes settled")
+	case <-time.After(400 * time.Millisecond):
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change signalled")
+	}
+
+	// Other files in the directory don't count.
+	if err := os.WriteFile(filepath.Join(filepath.Dir(cfg.envFile), "other.env"), []byte("X=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Error("change signalled again")
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+)
+
+// Event types on the /events stream.
+const (
+	eventState          = "state"           // daemon state changed
+	eventTunnelUp       = "tunnel_up"       // health checks started passing
+	eventTunnelDown     = "tunnel_down"     // health checks started failing
+	eventSwitchStarted  = "switch_started"  // a switch to another server began
+	eventSwitchFinished = "switch_finished" // a switch ended; see its outcome
+	eventAPIError       = "api_error"       // fetching the server list failed
+	eventAPIRecovered   = "api_recovered"   // fetching the server list works again
+)
+
+const (
+	// eventHistory is how many recent events are kept for clients that
+	// reconnect with Last-Event-ID.
+	eventHistory = 256
+	// eventBuffer is how far a subscriber may fall behind before it is
+	// dropped; it can reconnect and replay from eventHistory.
+	eventBuffer = 64
+	// eventKeepalive is how often an idle stream gets a comment, so proxies
+	// don't time it out.
+	eventKeepalive = 30 * time.Second
+)
+
+// eventBus fans daemon events out to /events subscribers.
+type eventBus struct {
+	mu     sync.Mutex
+	lastID int
+	recent []controlapi.Event
+	subs   map[chan controlapi.Event]struct{}
+}
+
+var events = &eventBus{subs: make(map[chan controlapi.Event]struct{})}
+
+// publish stamps ev and sends it to every subscriber without blocking.
+func (b *eventBus) publish(ev controlapi.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ev.ID, ev.Time = b.lastID, time.Now()
+	b.recent = append(b.recent, ev)
+	if len(b.recent) > eventHistory {
+		b.recent = b.recent[len(b.recent)-eventHistory:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the kept events after lastID (none if lastID is 0) and
+// a channel of later ones, closed if the subscriber falls behind. cancel
+// unsubscribes.
+func (b *eventBus) subscribe(lastID int) (backlog []controlapi.Event, ch chan controlapi.Event, cancel func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if lastID > 0 {
+		for _, ev := range b.recent {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	ch = make(chan controlapi.Event, eventBuffer)
+	b.subs[ch] = struct{}{}
+	return backlog, ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// switchStarted publishes the start of the switch ev describes; audit
+// publishes its end.
+func switchStarted(ev auditEvent) {
+	events.publish(controlapi.Event{Type: eventSwitchStarted, Trigger: ev.Trigger, Reason: ev.Reason, From: ev.From, To: ev.To})
+}
+
+// serveEvents streams events as server-sent events until the client goes
+// away. A client reconnecting with Last-Event-ID first gets what it missed.
+func serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+	lastID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	backlog, ch, cancel := events.subscribe(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(ev controlapi.Event) error {
+		data, _ := json.Marshal(ev)
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		return err
+	}
+	for _, ev := range backlog {
+		if send(ev) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok || send(ev) != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+)
+
+func TestEventBusReplayAndSlowSubscriber(t *testing.T) {
+	bus := &eventBus{subs: make(map[chan controlapi.Event]struct{})}
+	bus.publish(controlapi.Event{Type: eventTunnelUp})
+	bus.publish(controlapi.Event{Type: eventTunnelDown})
+
+	backlog, ch, cancel := bus.subscribe(1)
+	defer cancel()
+	if len(backlog) != 1 || backlog[0].ID != 2 || backlog[0].Type != eventTunnelDown {
+		t.Errorf("backlog after 1 = %+v", backlog)
+	}
+	if backlog, _, cancel := bus.subscribe(0); len(backlog) != 0 {
+		t.Errorf("fresh subscriber got backlog %+v", backlog)
+		cancel()
+	}
+
+	for range eventBuffer + 1 {
+		bus.publish(controlapi.Event{Type: eventState})
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != eventBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", n, eventBuffer)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	source := newMockServerSource(t, testServers()...)
+	d := newTestDaemon(source, newMockRuntime(t), newMockHealth(t))
+	srv := httptest.NewServer(controlHandler(d))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := make(chan controlapi.Event, 10)
+	go controlapi.New(srv.URL, nil).StreamEvents(ctx, 0, func(ev controlapi.Event) error {
+		received <- ev
+		return nil
+	})
+	next := func() controlapi.Event {
+		t.Helper()
+		select {
+		case ev := <-received:
+			return ev
+		case <-ctx.Done():
+			t.Fatal("no event")
+			return controlapi.Event{}
+		}
+	}
+	// Wait for the subscription before publishing
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		events.mu.Lock()
+		subscribed := len(events.subs) > 0
+		events.mu.Unlock()
+		if subscribed || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	d.updateStatus(func(s *Status) { s.Server, s.Healthy = "US#1", true })
+	if ev := next(); ev.Type != eventTunnelUp || ev.Server != "US#1" {
+		t.Errorf("event = %+v, want tunnel_up on US#1", ev)
+	}
+	source.err = errors.New("503 Service Unavailable")
+	d.servers()
+	d.servers()
+	if ev := next(); ev.Type != eventAPIError || ev.Error != "503 Service Unavailable" {
+		t.Errorf("event = %+v, want api_error", ev)
+	}
+	source.err = nil
+	d.servers()
+	if ev := next(); ev.Type != eventAPIRecovered {
+		t.Errorf("event = %+v, want api_recovered after a single api_error", ev)
+	}
+	audit(auditEvent{Trigger: triggerControl, From: "US#1", To: "US#2", Outcome: outcomeSuccess, DurationMs: 1500})
+	if ev := next(); ev.Type != eventSwitchFinished || ev.To != "US#2" || ev.Outcome != outcomeSuccess || ev.DurationMs != 1500 {
+		t.Errorf("event = %+v, want switch_finished", ev)
+	}
+}
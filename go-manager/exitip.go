@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/retry"
+)
+
+// maxExitIPs bounds the exit IP history.
+const maxExitIPs = 500
+
+// ExitIPRecord is an exit IP the tunnel was seen using.
+type ExitIPRecord struct {
+	IP     string    `json:"ip"`
+	Server string    `json:"server"`
+	Seen   time.Time `json:"seen"`
+	Listed []string  `json:"listed,omitempty"` // DNSBL zones listing the IP
+}
+
+// exitIPRetry retries a failed push of a new exit IP; the IP may not
+// change again for hours, so one failure shouldn't leave it stale that long.
+var exitIPRetry = retry.Policy{Attempts: 4, Base: 15 * time.Second, Max: 2 * time.Minute, Jitter: 0.2}
+
+// followExitIP calls push with each new exit IP and the one pushed before
+// it ("" the first time), until statuses is closed. what names the target
+// in the log.
+func followExitIP(statuses <-chan Status, what string, push func(ip, old string) error) {
+	pushed := ""
+	for st := range statuses {
+		if st.ExitIP == "" || st.ExitIP == pushed {
+			continue
+		}
+		err := exitIPRetry.Do(context.Background(), func() error { return push(st.ExitIP, pushed) })
+		if err != nil {
+			log(fmt.Sprintf("Failed to update %s to %s: %v", what, st.ExitIP, err))
+			continue
+		}
+		log(fmt.Sprintf("Updated %s to %s", what, st.ExitIP))
+		pushed = st.ExitIP
+	}
+}
+
+// dnsblLookup is swapped out in tests.
+var dnsblLookup = health.DNSBL
+
+func (s *Store) recordExitIP(server, ip string, listed []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ExitIPs = append(s.ExitIPs, ExitIPRecord{IP: ip, Server: server, Seen: time.Now(), Listed: listed})
+	if len(s.ExitIPs) > maxExitIPs {
+		s.ExitIPs = slices.Clone(s.ExitIPs[len(s.ExitIPs)-maxExitIPs:])
+	}
+	s.save()
+}
+
+// quarantine takes a server out of selection for quarantineDuration right
+// away, whatever its failure count.
+func (s *Store) quarantine(name, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.record(name)
+	rec.QuarantinedUntil = time.Now().Add(time.Duration(cfg.quarantineDuration) * time.Second)
+	rec.LastFailure = reason
+	log(fmt.Sprintf("Quarantining %s until %s (%s)", name, rec.QuarantinedUntil.Format("2006-01-02 15:04:05"), reason))
+	s.save()
+}
+
+// gluetunPublicIP returns the public IP gluetun found for the tunnel. Gluetun
+// looks it up shortly after connecting, so this polls for up to timeout.
+func gluetunPublicIP(timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var result struct {
+			PublicIP string `json:"public_ip"`
+		}
+		err := gluetunGet("/v1/publicip/ip", &result)
+		if err == nil && result.PublicIP != "" {
+			return result.PublicIP, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("gluetun has no public IP yet")
+			}
+			return "", err
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// advertisedExitIP returns the exit IP the API lists for the endpoint in the
+// env file, or for the server's first endpoint.
+func advertisedExitIP(source ServerSource, name string, env map[string]string) string {
+	servers, err := source.Servers()
+	if err != nil {
+		return ""
+	}
+	s := protonapi.FindByName(servers, name)
+	if s == nil {
+		return ""
+	}
+	if ep := endpointByIP(s, env["WIREGUARD_ENDPOINT_IP"]); ep != nil {
+		return ep.ExitIP
+	}
+	for _, ep := range s.Servers {
+		if ep.Status != 0 && ep.ExitIP != "" {
+			return ep.ExitIP
+		}
+	}
+	return ""
+}
+
+// checkExitIP records the exit IP of a new connection on name and, with
+// DNSBL_ZONES set, looks it up on those blocklists. Querying gluetun and the
+// blocklists can take a while, so that runs in the background.
+func (d *daemon) checkExitIP(name string) {
+	env := readEnvFile()
+	if d.cfg.gluetunControlURL == "" && len(d.cfg.dnsblZones) == 0 {
+		if ip := advertisedExitIP(d.source, name, env); ip != "" {
+			stateStore.recordExitIP(name, ip, nil)
+			d.updateStatus(func(s *Status) { s.ExitIP = ip })
+		}
+		return
+	}
+	go d.lookupExitIP(name, env)
+}
+
+func (d *daemon) lookupExitIP(name string, env map[string]string) {
+	var ip string
+	if d.cfg.gluetunControlURL != "" {
+		var err error
+		if ip, err = gluetunPublicIP(30 * time.Second); err != nil {
+			log(fmt.Sprintf("Could not get exit IP from gluetun: %v", err))
+		}
+	}
+	if ip == "" {
+		ip = advertisedExitIP(d.source, name, env)
+	}
+	if ip == "" {
+		return
+	}
+
+	listed := dnsblLookup(ip, d.cfg.dnsblZones)
+	stateStore.recordExitIP(name, ip, listed)
+	d.updateStatus(func(s *Status) { s.ExitIP = ip })
+	if len(listed) == 0 {
+		log(fmt.Sprintf("Exit IP on %s: %s", name, ip))
+		return
+	}
+	log(fmt.Sprintf("Exit IP %s on %s is listed on %s", ip, name, strings.Join(listed, ", ")))
+
+	var rotate []string
+	for _, zone := range listed {
+		if d.cfg.dnsblRotateOn == nil || slices.Contains(d.cfg.dnsblRotateOn, zone) {
+			rotate = append(rotate, zone)
+		}
+	}
+	if len(rotate) == 0 || getCurrentServerFromEnv() != name {
+		return
+	}
+	reason := fmt.Sprintf("Exit IP %s listed on %s", ip, strings.Join(rotate, ", "))
+	stateStore.quarantine(name, reason)
+	d.requestFailover(reason)
+}
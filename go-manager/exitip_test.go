@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func exitIPServers() []LogicalServer {
+	servers := testServers()
+	servers[1].Servers = []Server{
+		{EntryIP: "10.0.0.1", ExitIP: "198.51.100.1", X25519PublicKey: "k1", Status: 1},
+		{EntryIP: "10.0.0.2", ExitIP: "198.51.100.2", X25519PublicKey: "k2", Status: 1},
+	}
+	return servers
+}
+
+func TestCheckExitIPRecordsAdvertisedIP(t *testing.T) {
+	setupTestEnv(t, "US#2")
+	writeEnvVars(map[string]string{"WIREGUARD_ENDPOINT_IP": "10.0.0.2"})
+	d := newTestDaemon(newMockServerSource(t, exitIPServers()...), newMockRuntime(t), newMockHealth(t))
+
+	d.checkExitIP("US#2")
+	if len(stateStore.ExitIPs) != 1 || stateStore.ExitIPs[0].IP != "198.51.100.2" || stateStore.ExitIPs[0].Server != "US#2" {
+		t.Errorf("exit IP history = %+v, want 198.51.100.2 on US#2", stateStore.ExitIPs)
+	}
+}
+
+func TestListedExitIPRotates(t *testing.T) {
+	setupTestEnv(t, "US#2")
+	gluetun := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/publicip/ip" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"public_ip":"203.0.113.7"}`))
+	}))
+	defer gluetun.Close()
+	cfg.gluetunControlURL = gluetun.URL
+	cfg.dnsblZones = []string{"bad.example", "meh.example"}
+	lookup := dnsblLookup
+	dnsblLookup = func(ip string, zones []string) []string { return zones }
+	defer func() { dnsblLookup = lookup }()
+
+	cfg.dnsblRotateOn = []string{"meh.example"}
+	d := newTestDaemon(newMockServerSource(t, exitIPServers()...), newMockRuntime(t), newMockHealth(t))
+	d.lookupExitIP("US#2", nil)
+
+	rec := stateStore.ExitIPs[len(stateStore.ExitIPs)-1]
+	if rec.IP != "203.0.113.7" || !slices.Equal(rec.Listed, cfg.dnsblZones) {
+		t.Errorf("recorded %+v", rec)
+	}
+	if !stateStore.isQuarantined("US#2") {
+		t.Error("US#2 not quarantined")
+	}
+	select {
+	case <-d.failover:
+	case <-time.After(time.Second):
+		t.Fatal("no failover requested")
+	}
+	if reason := d.takeFailoverReason(); reason != "Exit IP 203.0.113.7 listed on meh.example" {
+		t.Errorf("failover reason %q", reason)
+	}
+
+	// Listings on zones outside DNSBL_ROTATE_ON are only recorded
+	setupTestEnv(t, "US#2")
+	cfg.dnsblRotateOn = []string{}
+	d = newTestDaemon(newMockServerSource(t, exitIPServers()...), newMockRuntime(t), newMockHealth(t))
+	d.lookupExitIP("US#2", nil)
+	if stateStore.isQuarantined("US#2") || d.takeFailoverReason() != "" {
+		t.Error("rotated on a zone not in DNSBL_ROTATE_ON")
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// Exit codes, so a supervisor or script can tell why the manager stopped.
+const (
+	exitFailure             = 1
+	exitUsage               = 2
+	exitRateLimited         = 3
+	exitHumanVerification   = 4
+	exitSubscriptionExpired = 5
+	exitConfig              = 6
+	exitAuth                = 7
+	exitAPIUnreachable      = 8
+	exitDocker              = 9
+	exitNoCandidates        = 10
+)
+
+// failureClass groups errors by what a supervisor should do about them:
+// fix the configuration, fix the credentials, wait for the network, ...
+type failureClass int
+
+const (
+	classOther failureClass = iota
+	classConfig
+	classAuth
+	classAPIUnreachable
+	classDocker
+	classNoCandidates
+)
+
+// classError tags an error with its failure class. The message is the
+// wrapped error's.
+type classError struct {
+	class failureClass
+	err   error
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+func (e *classError) Unwrap() error { return e.err }
+
+// classed tags err with class; a nil err stays nil.
+func classed(class failureClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// classOf returns the class err was tagged with, or classAPIUnreachable for
+// an untagged network error, which is how calls to the Proton API fail when
+// it can't be reached.
+func classOf(err error) failureClass {
+	var ce *classError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return classAPIUnreachable
+	}
+	return classOther
+}
+
+// exitCode maps err to the exit code of its failure class. Proton's own
+// refusals come first: a rate limit during login is not a wrong password.
+func exitCode(err error) int {
+	switch classifyAPIError(err) {
+	case apiErrRateLimited:
+		return exitRateLimited
+	case apiErrHumanVerification:
+		return exitHumanVerification
+	case apiErrSubscriptionExpired:
+		return exitSubscriptionExpired
+	}
+	switch classOf(err) {
+	case classConfig:
+		return exitConfig
+	case classAuth:
+		return exitAuth
+	case classAPIUnreachable:
+		return exitAPIUnreachable
+	case classDocker:
+		return exitDocker
+	case classNoCandidates:
+		return exitNoCandidates
+	}
+	return exitFailure
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestExitCode(t *testing.T) {
+	unreachable := &url.Error{Op: "Get", URL: "https://vpn-api.proton.me/vpn/logicals", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain", errors.New("boom"), exitFailure},
+		{"config", classed(classConfig, errors.New("PROTON_USERNAME and PROTON_PASSWORD must be set")), exitConfig},
+		{"auth", classed(classAuth, errors.New("Incorrect login credentials")), exitAuth},
+		{"wrapped auth", fmt.Errorf("login: %w", classed(classAuth, errors.New("bad"))), exitAuth},
+		{"network", unreachable, exitAPIUnreachable},
+		{"docker over a socket", classed(classDocker, unreachable), exitDocker},
+		{"no candidates", classed(classNoCandidates, errors.New("none")), exitNoCandidates},
+		{"rate limit beats auth", classed(classAuth, &protonapi.Error{Status: 429}), exitRateLimited},
+		{"human verification", &protonapi.Error{Status: 422, Code: protonapi.CodeHumanVerification}, exitHumanVerification},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+	if classed(classAuth, nil) != nil {
+		t.Error("classed(nil) should stay nil")
+	}
+	if err := classed(classDocker, errors.New("no such container")); err.Error() != "no such container" {
+		t.Errorf("classed error message = %q", err)
+	}
+}
+
+func TestChecksExitCode(t *testing.T) {
+	pass := checkResult{Name: "Configuration", OK: true}
+	tests := []struct {
+		failed string
+		want   int
+	}{
+		{"Configuration", exitConfig},
+		{"Proton auth (alice)", exitAuth},
+		{"Proton API", exitAPIUnreachable},
+		{"Compose", exitDocker},
+		{"Target cities", exitNoCandidates},
+		{"MQTT", exitFailure},
+	}
+	for _, tt := range tests {
+		results := []checkResult{pass, {Name: tt.failed, Detail: "failed"}, {Name: "Docker", Detail: "failed"}}
+		if got := checksExitCode(results); got != tt.want {
+			t.Errorf("first failure %s: exit code %d, want %d", tt.failed, got, tt.want)
+		}
+	}
+	if got := checksExitCode([]checkResult{pass}); got != 0 {
+		t.Errorf("all passed: exit code %d, want 0", got)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import "time"
+
+// Load forecasting. Every load check records the load of the servers
+// matching the targets into a per-hour average, and selection blends the
+// average over the next LOAD_FORECAST_HOURS into the current load, so the
+// manager doesn't land on a server that is quiet now but fills up every
+// evening.
+
+// forecastMinSamples is how many samples an hour needs before it is trusted.
+const forecastMinSamples = 3
+
+// recordLoads folds the servers' current loads into their hourly averages.
+func (s *Store) recordLoads(servers []LogicalServer, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hour := at.Hour()
+	for _, srv := range servers {
+		rec := s.record(srv.Name)
+		if len(rec.HourlyLoad) != 24 || len(rec.HourlySamples) != 24 {
+			rec.HourlyLoad, rec.HourlySamples = make([]float64, 24), make([]int, 24)
+		}
+		// Average the first samples, then follow changes
+		n := min(rec.HourlySamples[hour], 9)
+		rec.HourlyLoad[hour] = (rec.HourlyLoad[hour]*float64(n) + float64(srv.Load)) / float64(n+1)
+		rec.HourlySamples[hour]++
+	}
+	s.save()
+}
+
+// forecastLoad returns the server's average load over the hours from at,
+// and false if there isn't enough history for any of them.
+func (s *Store) forecastLoad(name string, at time.Time, hours int) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.Servers[name]
+	if !ok || len(rec.HourlyLoad) != 24 || len(rec.HourlySamples) != 24 {
+		return 0, false
+	}
+	var sum float64
+	var n int
+	for i := range max(hours, 1) {
+		h := (at.Hour() + i) % 24
+		if rec.HourlySamples[h] >= forecastMinSamples {
+			sum += rec.HourlyLoad[h]
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// forecastPenalty moves a server's load LOAD_FORECAST_WEIGHT percent of the
+// way towards its forecast for the hours from at.
+func forecastPenalty(s LogicalServer, at time.Time) float64 {
+	if stateStore == nil || cfg.forecastWeight <= 0 {
+		return 0
+	}
+	forecast, ok := stateStore.forecastLoad(s.Name, at, cfg.forecastHours)
+	if !ok {
+		return 0
+	}
+	return float64(cfg.forecastWeight) / 100 * (forecast - float64(s.Load))
+}
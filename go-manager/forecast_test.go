@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecastPrefersQuietServer(t *testing.T) {
+	setupTestEnv(t, "")
+	cfg.forecastWeight = 50
+
+	// Every evening US#2 fills up while US#1 stays quiet
+	evening := time.Date(2026, 3, 2, 20, 0, 0, 0, time.Local)
+	for day := range forecastMinSamples {
+		at := evening.AddDate(0, 0, -day-1)
+		stateStore.recordLoads([]LogicalServer{{Name: "US#1", Load: 20}, {Name: "US#2", Load: 90}}, at)
+	}
+
+	if _, ok := stateStore.forecastLoad("US#2", evening.Add(-3*time.Hour), 2); ok {
+		t.Error("forecast for hours without history")
+	}
+	forecast, ok := stateStore.forecastLoad("US#2", evening, 2)
+	if !ok || forecast != 90 {
+		t.Fatalf("forecast = %.0f, %v; want 90", forecast, ok)
+	}
+
+	// At 10% now, US#2 still ranks behind US#1 at 25%
+	quiet, busy := LogicalServer{Name: "US#1", Load: 25}, LogicalServer{Name: "US#2", Load: 10}
+	quietScore := float64(quiet.Load) + forecastPenalty(quiet, evening)
+	busyScore := float64(busy.Load) + forecastPenalty(busy, evening)
+	if quietScore >= busyScore {
+		t.Errorf("scores US#1 %.1f, US#2 %.1f; want US#1 lower", quietScore, busyScore)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"gluetun-proton-manager/selector"
+)
+
+// hostLocation is where the host is, for TARGET=auto. Nil if unknown.
+var hostLocation *Location
+
+// hostLocationResponse is Proton's geolocation of the caller's public IP.
+type hostLocationResponse struct {
+	IP      string  `json:"IP"`
+	Lat     float64 `json:"Lat"`
+	Long    float64 `json:"Long"`
+	Country string  `json:"Country"`
+}
+
+// locateHost sets hostLocation from GEO_LOCATION ("lat,long") or, failing
+// that, from Proton's geolocation of our public IP. The lookup is cached in
+// the state store because a manager sharing gluetun's network namespace would
+// otherwise see the VPN exit instead of the host's real location.
+func locateHost(pm *ProtonManager) {
+	if cfg.geoLocation != "" {
+		loc, err := selector.ParseLocation(cfg.geoLocation)
+		if err != nil {
+			log(fmt.Sprintf("Invalid GEO_LOCATION: %v", err))
+			return
+		}
+		hostLocation = &loc
+		return
+	}
+
+	// Inside the tunnel only a location recorded earlier is trustworthy
+	if cfg.healthMode == healthModeNative {
+		if loc := stateStore.hostLocation(); loc != nil {
+			hostLocation = loc
+			log(fmt.Sprintf("Using cached host location %.2f,%.2f", loc.Lat, loc.Long))
+			return
+		}
+	}
+
+	var resp hostLocationResponse
+	if err := pm.apiGet("/vpn/location", &resp); err != nil {
+		log(fmt.Sprintf("Failed to geolocate host: %v", err))
+		hostLocation = stateStore.hostLocation()
+		return
+	}
+	loc := Location{Lat: resp.Lat, Long: resp.Long}
+	hostLocation = &loc
+	stateStore.setHostLocation(loc)
+	log(fmt.Sprintf("Host located in %s (%.2f,%.2f)", resp.Country, loc.Lat, loc.Long))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gluetunGet decodes a JSON response from the gluetun control server.
+func gluetunGet(path string, v any) error {
+	req, err := http.NewRequest("GET", strings.TrimRight(cfg.gluetunControlURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	authorizeGluetun(req)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("control server denied %s (status %d); see manager gluetun-auth", path, resp.StatusCode)
+	default:
+		return fmt.Errorf("control server returned status %d for %s", resp.StatusCode, path)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// gluetunVPNStatus queries the gluetun control server for the VPN status.
+func gluetunVPNStatus() (string, error) {
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := gluetunGet("/v1/vpn/status", &result); err != nil {
+		return "", err
+	}
+	return result.Status, nil
+}
+
+// gluetunForwardedPort returns the VPN port forwarded by gluetun, or 0 if
+// port forwarding is off. Newer gluetun versions moved the endpoint.
+func gluetunForwardedPort() (int, error) {
+	var result struct {
+		Port int `json:"port"`
+	}
+	err := gluetunGet("/v1/portforward", &result)
+	if err != nil {
+		err = gluetunGet("/v1/openvpn/portforwarded", &result)
+	}
+	return result.Port, err
+}
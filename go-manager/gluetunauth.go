@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gluetunControlRoutes are the control server routes the manager calls.
+var gluetunControlRoutes = []string{
+	"GET /v1/vpn/status",
+	"GET /v1/portforward",
+	"GET /v1/openvpn/portforwarded",
+	"GET /v1/publicip/ip",
+}
+
+// authorizeGluetun adds the configured control server credentials to req.
+// Gluetun from v3.40.0 checks them against the roles in its auth config.
+func authorizeGluetun(req *http.Request) {
+	switch {
+	case cfg.gluetunControlAPIKey != "":
+		req.Header.Set("X-API-Key", cfg.gluetunControlAPIKey)
+	case cfg.gluetunControlUser != "":
+		req.SetBasicAuth(cfg.gluetunControlUser, cfg.gluetunControlPassword)
+	}
+}
+
+// gluetunAuthTOML renders a role for gluetun's auth config
+// (/gluetun/auth/config.toml) that allows the manager's routes with the
+// configured credentials.
+func gluetunAuthTOML(apiKey string) string {
+	routes := make([]string, len(gluetunControlRoutes))
+	for i, r := range gluetunControlRoutes {
+		routes[i] = strconv.Quote(r)
+	}
+	var b strings.Builder
+	b.WriteString("[[roles]]\n")
+	b.WriteString("name = \"proton-manager\"\n")
+	fmt.Fprintf(&b, "routes = [%s]\n", strings.Join(routes, ", "))
+	if apiKey == "" && cfg.gluetunControlUser != "" {
+		b.WriteString("auth = \"basic\"\n")
+		fmt.Fprintf(&b, "username = %s\n", strconv.Quote(cfg.gluetunControlUser))
+		fmt.Fprintf(&b, "password = %s\n", strconv.Quote(cfg.gluetunControlPassword))
+	} else {
+		b.WriteString("auth = \"apikey\"\n")
+		fmt.Fprintf(&b, "apikey = %s\n", strconv.Quote(apiKey))
+	}
+	return b.String()
+}
+
+// runGluetunAuth prints the auth config role for gluetun, generating an API
+// key when none is configured.
+func runGluetunAuth() {
+	key := cfg.gluetunControlAPIKey
+	if key == "" && cfg.gluetunControlUser == "" {
+		buf := make([]byte, 24)
+		rand.Read(buf)
+		key = hex.EncodeToString(buf)
+		fmt.Fprintf(os.Stderr, "Generated a new API key; set GLUETUN_CONTROL_API_KEY=%s for the manager\n", key)
+	}
+	fmt.Print(gluetunAuthTOML(key))
+}
+
+// gluetunAuthProblems reports control server credentials that can't work.
+func gluetunAuthProblems() []string {
+	var problems []string
+	if (cfg.gluetunControlAPIKey != "" || cfg.gluetunControlUser != "") && cfg.gluetunControlURL == "" {
+		problems = append(problems, "GLUETUN_CONTROL_API_KEY and GLUETUN_CONTROL_USER need GLUETUN_CONTROL_URL")
+	}
+	if cfg.gluetunControlUser != "" && cfg.gluetunControlPassword == "" {
+		problems = append(problems, "GLUETUN_CONTROL_USER needs GLUETUN_CONTROL_PASSWORD")
+	}
+	if cfg.gluetunControlAPIKey != "" && cfg.gluetunControlUser != "" {
+		problems = append(problems, "set either GLUETUN_CONTROL_API_KEY or GLUETUN_CONTROL_USER, not both")
+	}
+	return problems
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGluetunControlAuth(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	gluetun := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":"running"}`))
+	}))
+	defer gluetun.Close()
+	cfg.gluetunControlURL = gluetun.URL
+
+	if _, err := gluetunVPNStatus(); err == nil || !strings.Contains(err.Error(), "gluetun-auth") {
+		t.Errorf("without a key: %v", err)
+	}
+	cfg.gluetunControlAPIKey = "secret"
+	if status, err := gluetunVPNStatus(); err != nil || status != "running" {
+		t.Errorf("with a key: %q, %v", status, err)
+	}
+}
+
+func TestGluetunAuthTOML(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	toml := gluetunAuthTOML("abc")
+	for _, want := range []string{`auth = "apikey"`, `apikey = "abc"`, `"GET /v1/vpn/status"`, `"GET /v1/publicip/ip"`} {
+		if !strings.Contains(toml, want) {
+			t.Errorf("missing %s in:\n%s", want, toml)
+		}
+	}
+
+	cfg.gluetunControlUser, cfg.gluetunControlPassword = "manager", "pw"
+	toml = gluetunAuthTOML("")
+	if !strings.Contains(toml, `auth = "basic"`) || !strings.Contains(toml, `password = "pw"`) {
+		t.Errorf("basic auth role:\n%s", toml)
+	}
+}
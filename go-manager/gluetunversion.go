@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// envRename is a gluetun variable that had another name in older releases.
+// The manager works with Name throughout and translates at the env file and
+// running-container boundary.
+type envRename struct {
+	Name   string
+	Before string // gluetun's name for it before Since
+	Since  string
+}
+
+var gluetunEnvRenames = []envRename{
+	{Name: "WIREGUARD_ENDPOINT_IP", Before: "VPN_ENDPOINT_IP", Since: "v3.39.0"},
+	{Name: "WIREGUARD_ENDPOINT_PORT", Before: "VPN_ENDPOINT_PORT", Since: "v3.39.0"},
+}
+
+// gluetunVersion is the running gluetun's version, e.g. "v3.39.1", or ""
+// (or a tag like "latest") when unknown, which is taken as a current
+// release.
+var gluetunVersion struct {
+	mu    sync.Mutex
+	value string
+}
+
+func currentGluetunVersion() string {
+	gluetunVersion.mu.Lock()
+	defer gluetunVersion.mu.Unlock()
+	return gluetunVersion.value
+}
+
+// detectGluetunVersion reads gluetun's version from GLUETUN_VERSION or its
+// image, logging when it changes along with any mismatch between the env
+// file and what that version expects.
+func detectGluetunVersion() {
+	v := cfg.gluetunVersionSetting
+	if v == "" && cfg.runtimeBackend == runtimeDocker {
+		v = docker.ImageVersion(activeGluetun())
+	}
+	gluetunVersion.mu.Lock()
+	changed := v != gluetunVersion.value
+	gluetunVersion.value = v
+	gluetunVersion.mu.Unlock()
+	if !changed {
+		return
+	}
+	if !isReleaseVersion(v) {
+		log(fmt.Sprintf("Gluetun version unknown (%q), assuming a current release; set GLUETUN_VERSION if it is older", v))
+		return
+	}
+	log(fmt.Sprintf("Gluetun %s detected", v))
+	raw, _ := readRawEnv()
+	for _, w := range renameWarnings(raw, v) {
+		log("Warning: " + w)
+	}
+}
+
+// isReleaseVersion reports whether v is a "vX.Y.Z" release rather than
+// "latest" or a custom build.
+func isReleaseVersion(v string) bool {
+	return strings.HasPrefix(v, "v")
+}
+
+// usesOldName reports whether gluetun version v still reads r.Before.
+func usesOldName(r envRename, v string) bool {
+	return isReleaseVersion(v) && compareVersions(v, r.Since) < 0
+}
+
+// toGluetunEnv renames the manager's variables to what the running gluetun
+// reads.
+func toGluetunEnv(vars map[string]string) map[string]string {
+	v := currentGluetunVersion()
+	out := maps.Clone(vars)
+	for _, r := range gluetunEnvRenames {
+		if val, ok := out[r.Name]; ok && usesOldName(r, v) {
+			delete(out, r.Name)
+			out[r.Before] = val
+		}
+	}
+	return out
+}
+
+// fromGluetunEnv fills in the manager's names for variables set under
+// gluetun's older ones, preferring those the running version reads.
+func fromGluetunEnv(vars map[string]string) map[string]string {
+	v := currentGluetunVersion()
+	for _, r := range gluetunEnvRenames {
+		old, ok := vars[r.Before]
+		if ok && (usesOldName(r, v) || vars[r.Name] == "") {
+			vars[r.Name] = old
+		}
+	}
+	return vars
+}
+
+// renameWarnings lists variables the env file, as read by readRawEnv, sets
+// under a name the given gluetun version doesn't read.
+func renameWarnings(vars map[string]string, version string) []string {
+	var warnings []string
+	for _, r := range gluetunEnvRenames {
+		stale, current := r.Name, r.Before
+		if !usesOldName(r, version) {
+			stale, current = r.Before, r.Name
+		}
+		if vars[stale] != "" && vars[stale] != vars[current] {
+			warnings = append(warnings, fmt.Sprintf("the env file sets %s, which gluetun %s doesn't read; the manager writes %s instead", stale, version, current))
+		}
+	}
+	return warnings
+}
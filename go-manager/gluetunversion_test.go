@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOldGluetunGetsOldVariableNames(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.gluetunVersionSetting = "v3.38.0"
+	detectGluetunVersion()
+
+	vars := map[string]string{"PROTON_SERVER_NAME": "US#2", "WIREGUARD_ENDPOINT_IP": "10.0.0.2", "WIREGUARD_ENDPOINT_PORT": "51820"}
+	if err := writeEnvVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(cfg.envFile)
+	if !strings.Contains(string(data), "VPN_ENDPOINT_IP=10.0.0.2\n") || strings.Contains(string(data), "WIREGUARD_ENDPOINT_IP") {
+		t.Errorf("env file for v3.38.0:\n%s", data)
+	}
+	if got := readEnvFile()["WIREGUARD_ENDPOINT_IP"]; got != "10.0.0.2" {
+		t.Errorf("read back WIREGUARD_ENDPOINT_IP = %q, want 10.0.0.2", got)
+	}
+
+	// After an upgrade the current names are written, and the old ones
+	// left in the file are reported
+	cfg.gluetunVersionSetting = "v3.40.0"
+	detectGluetunVersion()
+	vars["WIREGUARD_ENDPOINT_IP"] = "10.0.0.3"
+	if err := writeEnvVars(vars); err != nil {
+		t.Fatal(err)
+	}
+	if got := readEnvFile()["WIREGUARD_ENDPOINT_IP"]; got != "10.0.0.3" {
+		t.Errorf("read back WIREGUARD_ENDPOINT_IP = %q, want 10.0.0.3", got)
+	}
+	raw, _ := readRawEnv()
+	if w := renameWarnings(raw, "v3.40.0"); len(w) != 1 || !strings.Contains(w[0], "VPN_ENDPOINT_IP") {
+		t.Errorf("renameWarnings = %v, want VPN_ENDPOINT_IP reported", w)
+	}
+}
+
+func TestUnknownGluetunVersion(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.gluetunVersionSetting = "latest"
+	detectGluetunVersion()
+	out := toGluetunEnv(map[string]string{"WIREGUARD_ENDPOINT_IP": "10.0.0.2"})
+	if out["WIREGUARD_ENDPOINT_IP"] != "10.0.0.2" || len(out) != 1 {
+		t.Errorf("toGluetunEnv for latest = %v, want current names", out)
+	}
+	// Files written for an old gluetun still read
+	in := fromGluetunEnv(map[string]string{"VPN_ENDPOINT_IP": "10.0.0.4"})
+	if in["WIREGUARD_ENDPOINT_IP"] != "10.0.0.4" {
+		t.Errorf("fromGluetunEnv = %v", in)
+	}
+}
@@ -4,7 +4,12 @@ go 1.25
 
 require (
 	github.com/ProtonMail/go-proton-api v0.0.0-20260109112619-daf7af47921d
+	github.com/expr-lang/expr v1.17.8
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/go-resty/resty/v2 v2.7.0
+	github.com/tetratelabs/wazero v1.12.0
+	github.com/zalando/go-keyring v0.2.6
+	go.uber.org/mock v0.6.0
 )
 
 replace github.com/go-resty/resty/v2 => github.com/ProtonMail/resty/v2 v2.0.0-20250929142426-e3dc6308c80b
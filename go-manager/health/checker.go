@@ -0,0 +1,97 @@
+// Package health probes whether a VPN tunnel passes traffic, directly or
+// through gluetun's HTTP proxy or Shadowsocks server.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Checker reports whether the tunnel currently works.
+type Checker interface {
+	Check() bool
+}
+
+// RTTer is implemented by checkers that can also time the tunnel's round
+// trip.
+type RTTer interface {
+	RTT() (time.Duration, error)
+}
+
+// LossMeter is implemented by checkers that can count lost packets. Loss
+// sends a burst of probes and returns how many were sent and answered.
+type LossMeter interface {
+	Loss() (sent, received int, err error)
+}
+
+// LossProbes is the burst size for Loss.
+const LossProbes = 5
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func() bool
+
+func (f CheckerFunc) Check() bool { return f() }
+
+// Native probes Target from the caller's own network namespace, which must
+// be the tunnel's.
+type Native struct {
+	Target string
+}
+
+func (n Native) Check() bool { return ProbeNative(n.Target) }
+
+// Loss sends a burst of ICMP echoes to Target.
+func (n Native) Loss() (int, int, error) {
+	received, err := PingLoss(n.Target, LossProbes, time.Second)
+	return LossProbes, received, err
+}
+
+// RTT times an ICMP echo to Target.
+func (n Native) RTT() (time.Duration, error) {
+	start := time.Now()
+	ok, err := Ping(n.Target, 1, 2*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("no reply from %s", n.Target)
+	}
+	return time.Since(start), nil
+}
+
+// Proxy fetches ProbeURL through ProxyURL (see ApplyProxy) and treats any
+// status below 400 as healthy. A malformed ProxyURL is never healthy.
+type Proxy struct {
+	ProxyURL string
+	ProbeURL string
+}
+
+func (p Proxy) Check() bool {
+	client, err := ProxyClient(p.ProxyURL)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Get(p.ProbeURL)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+// RTT times a request for ProbeURL through the proxy. That includes the
+// proxy's connection set-up, so it reads higher than an ICMP round trip.
+func (p Proxy) RTT() (time.Duration, error) {
+	client, err := ProxyClient(p.ProxyURL)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := client.Head(p.ProbeURL)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return time.Since(start), nil
+}
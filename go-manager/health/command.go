@@ -0,0 +1,26 @@
+package health
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// CommandTimeout bounds a Command probe.
+const CommandTimeout = 30 * time.Second
+
+// Command runs Cmd with sh and treats exit status 0 as healthy. Env is added
+// to the manager's environment.
+type Command struct {
+	Cmd string
+	Env []string
+}
+
+func (c Command) Check() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Cmd)
+	cmd.Env = append(os.Environ(), c.Env...)
+	return cmd.Run() == nil
+}
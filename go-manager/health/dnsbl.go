@@ -0,0 +1,50 @@
+package health
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNSBL looks an IPv4 address up on DNS blocklists and returns the zones
+// listing it. Lookup errors count as not listed.
+func DNSBL(ip string, zones []string) []string {
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		return nil
+	}
+	reversed := net.IPv4(v4[3], v4[2], v4[1], v4[0]).String()
+
+	listed := make([]bool, len(zones))
+	var wg sync.WaitGroup
+	for i, zone := range zones {
+		wg.Add(1)
+		go func(i int, zone string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			addrs, err := net.DefaultResolver.LookupHost(ctx, reversed+"."+strings.Trim(zone, "."))
+			if err != nil {
+				return
+			}
+			// Listings answer in 127.0.0.0/8; anything else is a resolver
+			// rewriting NXDOMAIN
+			for _, a := range addrs {
+				if strings.HasPrefix(a, "127.") {
+					listed[i] = true
+				}
+			}
+		}(i, zone)
+	}
+	wg.Wait()
+
+	var out []string
+	for i, zone := range zones {
+		if listed[i] {
+			out = append(out, zone)
+		}
+	}
+	return out
+}
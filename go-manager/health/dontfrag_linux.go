@@ -0,0 +1,27 @@
+package health
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDontFragment makes conn send with the don't-fragment bit, ignoring the
+// kernel's cached path MTU so probes larger than it still go out.
+func setDontFragment(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return syscall.EINVAL
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	err = raw.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package health
+
+import (
+	"errors"
+	"net"
+)
+
+func setDontFragment(net.Conn) error {
+	return errors.New("path MTU probing is only supported on Linux")
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP fetches URL, directly or through ProxyURL (see ApplyProxy), and
+// treats the response as healthy if it has the expected status and body.
+type HTTP struct {
+	URL      string
+	Status   int    // expected status; 0 accepts any below 400
+	Body     string // substring the body must contain, if set
+	ProxyURL string
+}
+
+func (h HTTP) Check() bool { return h.probe() == nil }
+
+// RTT times a full probe of URL.
+func (h HTTP) RTT() (time.Duration, error) {
+	start := time.Now()
+	if err := h.probe(); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func (h HTTP) probe() error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if h.ProxyURL != "" {
+		var err error
+		if client, err = ProxyClient(h.ProxyURL); err != nil {
+			return err
+		}
+	}
+	resp, err := client.Get(h.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !StatusOK(h.Status, resp.StatusCode) {
+		return fmt.Errorf("%s returned status %d", h.URL, resp.StatusCode)
+	}
+	if h.Body == "" {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), h.Body) {
+		return fmt.Errorf("%s response lacks %q", h.URL, h.Body)
+	}
+	return nil
+}
+
+// StatusOK reports whether got is the expected status, or below 400 when
+// none is expected.
+func StatusOK(want, got int) bool {
+	if want == 0 {
+		return got < http.StatusBadRequest
+	}
+	return got == want
+}
@@ -0,0 +1,130 @@
+package health
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"time"
+)
+
+// ProbeNative checks connectivity from the caller's own network namespace.
+// It sends ICMP echoes over a raw socket and falls back to a TCP handshake on
+// port 443 when raw sockets aren't permitted (no NET_RAW capability).
+func ProbeNative(target string) bool {
+	ok, err := Ping(target, 3, 2*time.Second)
+	if err == nil {
+		return ok
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(target, "443"), 5*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Ping sends up to count ICMP echo requests and returns true on the first
+// matching reply. An IPv6 target is pinged over ICMPv6. An error means ICMP could not be attempted at all.
+func Ping(target string, count int, timeout time.Duration) (bool, error) {
+	received, err := ping(target, count, timeout, true)
+	return received > 0, err
+}
+
+// PingLoss sends count ICMP echo requests and returns how many were
+// answered. An error means ICMP could not be attempted at all.
+func PingLoss(target string, count int, timeout time.Duration) (int, error) {
+	return ping(target, count, timeout, false)
+}
+
+// ICMP echo message types.
+const (
+	echoRequestV4 = 8
+	echoReplyV4   = 0
+	echoRequestV6 = 128
+	echoReplyV6   = 129
+)
+
+func ping(target string, count int, timeout time.Duration, untilReply bool) (int, error) {
+	network, request, reply := "ip4:icmp", byte(echoRequestV4), byte(echoReplyV4)
+	if ip := net.ParseIP(target); ip != nil && ip.To4() == nil {
+		network, request, reply = "ip6:ipv6-icmp", echoRequestV6, echoReplyV6
+	}
+	conn, err := net.Dial(network, target)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	id := uint16(os.Getpid())
+	buf := make([]byte, 1500)
+	received := 0
+
+	for seq := uint16(1); seq <= uint16(count); seq++ {
+		conn.SetDeadline(time.Now().Add(timeout))
+		if _, err := conn.Write(icmpEchoRequest(request, id, seq, echoSize)); err != nil {
+			return received, err
+		}
+		if awaitEchoReply(conn, buf, reply, id, seq) {
+			received++
+		}
+		if untilReply && received > 0 {
+			break
+		}
+	}
+	return received, nil
+}
+
+// awaitEchoReply reads until the reply of type typ to echo id/seq arrives or
+// the connection's deadline passes.
+func awaitEchoReply(conn net.Conn, buf []byte, typ byte, id, seq uint16) bool {
+	// Raw sockets see every ICMP packet; wait for our reply
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return false // timed out
+		}
+		reply := buf[:n]
+		// Raw IPv4 reads include the IP header, IPv6 ones don't
+		if len(reply) > 0 && reply[0]>>4 == 4 {
+			if hdrLen := int(reply[0]&0x0f) * 4; hdrLen <= len(reply) {
+				reply = reply[hdrLen:]
+			}
+		}
+		if len(reply) >= 8 && reply[0] == typ &&
+			binary.BigEndian.Uint16(reply[4:6]) == id &&
+			binary.BigEndian.Uint16(reply[6:8]) == seq {
+			return true
+		}
+	}
+}
+
+// echoSize is the length of the echo requests Ping sends.
+const echoSize = 8 + 16
+
+// icmpEchoRequest builds an echo request of type typ and size bytes,
+// padding the payload. The kernel overwrites the checksum of ICMPv6
+// messages, which covers the IPv6 addresses too.
+func icmpEchoRequest(typ byte, id, seq uint16, size int) []byte {
+	msg := make([]byte, max(size, echoSize))
+	msg[0] = typ
+	binary.BigEndian.PutUint16(msg[4:6], id)
+	binary.BigEndian.PutUint16(msg[6:8], seq)
+	copy(msg[8:], "proton-sidecar!!")
+	binary.BigEndian.PutUint16(msg[2:4], icmpChecksum(msg))
+	return msg
+}
+
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,90 @@
+package health
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestICMPChecksum(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		want uint16
+	}{
+		// RFC 1071, section 3
+		{[]byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}, 0x220d},
+		// An odd byte is padded with zero
+		{[]byte{0x00, 0x01, 0xf2}, ^uint16(0x0001 + 0xf200)},
+		{nil, 0xffff},
+		// Carries fold back in
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x02}, ^uint16(0x0002)},
+	} {
+		if got := icmpChecksum(tc.data); got != tc.want {
+			t.Errorf("icmpChecksum(%x) = %#04x, want %#04x", tc.data, got, tc.want)
+		}
+	}
+}
+
+func TestICMPEchoRequest(t *testing.T) {
+	for _, size := range []int{0, echoSize, 1400} {
+		msg := icmpEchoRequest(echoRequestV4, 0x1234, 7, size)
+		if len(msg) != max(size, echoSize) {
+			t.Errorf("size %d: %d bytes", size, len(msg))
+		}
+		if msg[0] != echoRequestV4 || msg[1] != 0 || binary.BigEndian.Uint16(msg[4:]) != 0x1234 || binary.BigEndian.Uint16(msg[6:]) != 7 {
+			t.Errorf("size %d: header %x", size, msg[:8])
+		}
+		// A message including its own checksum sums to zero
+		if sum := icmpChecksum(msg); sum != 0 {
+			t.Errorf("size %d: checksum doesn't verify (%#04x)", size, sum)
+		}
+	}
+}
+
+// ipv4Header prefixes an ICMP message with a 20-byte IPv4 header, as raw
+// IPv4 sockets deliver it.
+func ipv4Header(msg []byte) []byte {
+	hdr := make([]byte, 20)
+	hdr[0] = 0x45
+	return append(hdr, msg...)
+}
+
+// echoReply is an echo message like the one a host answers with.
+func echoReply(typ byte, id, seq uint16) []byte {
+	return icmpEchoRequest(typ, id, seq, 0)
+}
+
+func TestAwaitEchoReply(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		packets [][]byte
+		typ     byte
+		want    bool
+	}{
+		{"v4 reply", [][]byte{ipv4Header(echoReply(echoReplyV4, 42, 3))}, echoReplyV4, true},
+		{"v6 reply", [][]byte{echoReply(echoReplyV6, 42, 3)}, echoReplyV6, true},
+		{"after others", [][]byte{
+			ipv4Header(echoReply(echoRequestV4, 42, 3)), // our own request
+			ipv4Header(echoReply(echoReplyV4, 99, 3)),   // another process
+			ipv4Header(echoReply(echoReplyV4, 42, 2)),   // a late reply
+			ipv4Header([]byte{3, 1, 0, 0}),              // truncated unreachable
+			ipv4Header(echoReply(echoReplyV4, 42, 3)),
+		}, echoReplyV4, true},
+		{"no reply", [][]byte{ipv4Header(echoReply(echoReplyV4, 42, 2))}, echoReplyV4, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				for _, p := range tc.packets {
+					server.Write(p)
+				}
+			}()
+			client.SetDeadline(time.Now().Add(200 * time.Millisecond))
+			if got := awaitEchoReply(client, make([]byte, 1500), tc.typ, 42, 3); got != tc.want {
+				t.Errorf("awaitEchoReply = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Header sizes of an ICMPv4 echo in an IPv4 packet without options.
+const (
+	ipv4HeaderLen = 20
+	icmpHeaderLen = 8
+)
+
+// MinMTU is the smallest MTU every IPv4 path must carry without
+// fragmentation, where PathMTU starts its search.
+const MinMTU = 576
+
+// PathMTU finds the largest IPv4 packet, up to limit bytes, that reaches
+// target unfragmented. It binary-searches with ICMP echoes that have the
+// don't-fragment bit set, so like Ping it needs raw sockets; an error means
+// ICMP could not be attempted or target didn't answer even MinMTU.
+func PathMTU(target string, limit int, timeout time.Duration) (int, error) {
+	conn, err := net.Dial("ip4:icmp", target)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if err := setDontFragment(conn); err != nil {
+		return 0, err
+	}
+
+	id := uint16(os.Getpid())
+	buf := make([]byte, limit+ipv4HeaderLen)
+	seq := uint16(0)
+	// fits sends two echoes of size bytes; a packet too big for the local
+	// interface fails to send at all
+	fits := func(size int) bool {
+		for range 2 {
+			seq++
+			conn.SetDeadline(time.Now().Add(timeout))
+			if _, err := conn.Write(icmpEchoRequest(echoRequestV4, id, seq, size-ipv4HeaderLen)); err != nil {
+				return false
+			}
+			if awaitEchoReply(conn, buf, echoReplyV4, id, seq) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !fits(MinMTU) {
+		return 0, fmt.Errorf("no reply from %s", target)
+	}
+	lo, hi := MinMTU, limit
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return lo, nil
+}
@@ -0,0 +1,72 @@
+package health
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProxyClient returns an HTTP client that routes through the given proxy.
+func ProxyClient(raw string) (*http.Client, error) {
+	transport := &http.Transport{DisableKeepAlives: true}
+	if err := ApplyProxy(transport, raw); err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}, nil
+}
+
+// ApplyProxy routes a transport through a proxy URL:
+// http(s)://[user:pass@]host:port for an HTTP proxy such as gluetun's,
+// socks5://[user:pass@]host:port for a SOCKS proxy, or
+// ss://cipher:password@host:port for gluetun's Shadowsocks server.
+func ApplyProxy(transport *http.Transport, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		transport.Proxy = http.ProxyURL(u)
+	case "ss":
+		method, password, err := shadowsocksCredentials(u)
+		if err != nil {
+			return err
+		}
+		server := u.Host
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialShadowsocks(ctx, server, method, password, addr)
+		}
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// shadowsocksCredentials reads cipher and password from an ss:// URL, in
+// either plain (cipher:password@) or SIP002 base64 userinfo form.
+func shadowsocksCredentials(u *url.URL) (string, string, error) {
+	if u.User == nil {
+		return "", "", fmt.Errorf("ss:// URL needs cipher:password")
+	}
+	if password, ok := u.User.Password(); ok {
+		return u.User.Username(), password, nil
+	}
+
+	encoded := u.User.Username()
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return "", "", fmt.Errorf("ss:// userinfo is neither cipher:password nor base64")
+	}
+	method, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", fmt.Errorf("ss:// userinfo must decode to cipher:password")
+	}
+	return method, password, nil
+}
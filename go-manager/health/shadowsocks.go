@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// Minimal Shadowsocks AEAD (SIP004) TCP client, enough to tunnel health
+// probes through gluetun's Shadowsocks listener. Only the AES-GCM ciphers are
+// supported since they are available in the standard library.
+
+const ssMaxPayload = 0x3FFF
+
+var ssKeySizes = map[string]int{
+	"aes-128-gcm": 16,
+	"aes-256-gcm": 32,
+}
+
+// ssConn wraps a TCP connection to a Shadowsocks server.
+type ssConn struct {
+	net.Conn
+	key  []byte
+	addr []byte // target address, sent with the first write
+
+	enc      cipher.AEAD
+	encNonce []byte
+	dec      cipher.AEAD
+	decNonce []byte
+	readBuf  []byte
+}
+
+// dialShadowsocks connects to server and asks it to relay to target.
+func dialShadowsocks(ctx context.Context, server, method, password, target string) (net.Conn, error) {
+	keySize, ok := ssKeySizes[method]
+	if !ok {
+		return nil, fmt.Errorf("unsupported shadowsocks cipher %q (use aes-128-gcm or aes-256-gcm)", method)
+	}
+	addr, err := ssAddress(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	return &ssConn{Conn: conn, key: evpBytesToKey(password, keySize), addr: addr}, nil
+}
+
+// ssAddress encodes host:port in SOCKS5 address format.
+func ssAddress(target string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var addr []byte
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			addr = append([]byte{0x01}, ip4...)
+		} else {
+			addr = append([]byte{0x04}, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("hostname too long: %s", host)
+		}
+		addr = append([]byte{0x03, byte(len(host))}, host...)
+	}
+	return binary.BigEndian.AppendUint16(addr, uint16(port)), nil
+}
+
+// evpBytesToKey derives the master key from a password as OpenSSL does.
+func evpBytesToKey(password string, keyLen int) []byte {
+	var key, prev []byte
+	for len(key) < keyLen {
+		h := md5.New()
+		h.Write(prev)
+		h.Write([]byte(password))
+		prev = h.Sum(nil)
+		key = append(key, prev...)
+	}
+	return key[:keyLen]
+}
+
+func ssAEAD(key, salt []byte) (cipher.AEAD, error) {
+	subkey, err := hkdf.Key(sha1.New, key, salt, "ss-subkey", len(key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// incrementNonce treats the nonce as a little-endian counter.
+func incrementNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+func (c *ssConn) Write(p []byte) (int, error) {
+	var out []byte
+	if c.enc == nil {
+		salt := make([]byte, len(c.key))
+		if _, err := rand.Read(salt); err != nil {
+			return 0, err
+		}
+		aead, err := ssAEAD(c.key, salt)
+		if err != nil {
+			return 0, err
+		}
+		c.enc, c.encNonce = aead, make([]byte, aead.NonceSize())
+		out = salt
+	}
+
+	payload := p
+	if c.addr != nil {
+		payload = append(append([]byte{}, c.addr...), p...)
+		c.addr = nil
+	}
+
+	for len(payload) > 0 {
+		chunk := payload[:min(len(payload), ssMaxPayload)]
+		payload = payload[len(chunk):]
+
+		out = c.enc.Seal(out, c.encNonce, binary.BigEndian.AppendUint16(nil, uint16(len(chunk))), nil)
+		incrementNonce(c.encNonce)
+		out = c.enc.Seal(out, c.encNonce, chunk, nil)
+		incrementNonce(c.encNonce)
+	}
+
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *ssConn) Read(p []byte) (int, error) {
+	if len(c.readBuf) == 0 {
+		if err := c.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *ssConn) readChunk() error {
+	if c.dec == nil {
+		salt := make([]byte, len(c.key))
+		if _, err := io.ReadFull(c.Conn, salt); err != nil {
+			return err
+		}
+		aead, err := ssAEAD(c.key, salt)
+		if err != nil {
+			return err
+		}
+		c.dec, c.decNonce = aead, make([]byte, aead.NonceSize())
+	}
+
+	overhead := c.dec.Overhead()
+	lenBuf := make([]byte, 2+overhead)
+	if _, err := io.ReadFull(c.Conn, lenBuf); err != nil {
+		return err
+	}
+	plainLen, err := c.dec.Open(lenBuf[:0], c.decNonce, lenBuf, nil)
+	if err != nil {
+		return fmt.Errorf("shadowsocks: bad length chunk (wrong password or cipher?)")
+	}
+	incrementNonce(c.decNonce)
+
+	size := int(binary.BigEndian.Uint16(plainLen)) & ssMaxPayload
+	buf := make([]byte, size+overhead)
+	if _, err := io.ReadFull(c.Conn, buf); err != nil {
+		return err
+	}
+	c.readBuf, err = c.dec.Open(buf[:0], c.decNonce, buf, nil)
+	if err != nil {
+		return fmt.Errorf("shadowsocks: bad payload chunk")
+	}
+	incrementNonce(c.decNonce)
+	return nil
+}
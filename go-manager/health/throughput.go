@@ -0,0 +1,31 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Throughput downloads url through client, reading at most limit bytes, and
+// returns the rate in Mbit/s.
+func Throughput(client *http.Client, url string, limit int64) (float64, error) {
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, limit))
+	if err != nil && n == 0 {
+		return 0, err
+	}
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 || n == 0 {
+		return 0, fmt.Errorf("no data received")
+	}
+	return float64(n) * 8 / elapsed / 1e6, nil
+}
@@ -0,0 +1,134 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: health/checker.go
+//
+// Generated by this command:
+//
+//	mockgen -source=health/checker.go -destination=health_mock_test.go -package=main -self_package=gluetun-proton-manager
+//
+
+// Package main is a generated GoMock package.
+package main
+
+import (
+	reflect "reflect"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockChecker is a mock of Checker interface.
+type MockChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockCheckerMockRecorder
+	isgomock struct{}
+}
+
+// MockCheckerMockRecorder is the mock recorder for MockChecker.
+type MockCheckerMockRecorder struct {
+	mock *MockChecker
+}
+
+// NewMockChecker creates a new mock instance.
+func NewMockChecker(ctrl *gomock.Controller) *MockChecker {
+	mock := &MockChecker{ctrl: ctrl}
+	mock.recorder = &MockCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChecker) EXPECT() *MockCheckerMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method.
+func (m *MockChecker) Check() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Check indicates an expected call of Check.
+func (mr *MockCheckerMockRecorder) Check() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockChecker)(nil).Check))
+}
+
+// MockRTTer is a mock of RTTer interface.
+type MockRTTer struct {
+	ctrl     *gomock.Controller
+	recorder *MockRTTerMockRecorder
+	isgomock struct{}
+}
+
+// MockRTTerMockRecorder is the mock recorder for MockRTTer.
+type MockRTTerMockRecorder struct {
+	mock *MockRTTer
+}
+
+// NewMockRTTer creates a new mock instance.
+func NewMockRTTer(ctrl *gomock.Controller) *MockRTTer {
+	mock := &MockRTTer{ctrl: ctrl}
+	mock.recorder = &MockRTTerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRTTer) EXPECT() *MockRTTerMockRecorder {
+	return m.recorder
+}
+
+// RTT mocks base method.
+func (m *MockRTTer) RTT() (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RTT")
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RTT indicates an expected call of RTT.
+func (mr *MockRTTerMockRecorder) RTT() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RTT", reflect.TypeOf((*MockRTTer)(nil).RTT))
+}
+
+// MockLossMeter is a mock of LossMeter interface.
+type MockLossMeter struct {
+	ctrl     *gomock.Controller
+	recorder *MockLossMeterMockRecorder
+	isgomock struct{}
+}
+
+// MockLossMeterMockRecorder is the mock recorder for MockLossMeter.
+type MockLossMeterMockRecorder struct {
+	mock *MockLossMeter
+}
+
+// NewMockLossMeter creates a new mock instance.
+func NewMockLossMeter(ctrl *gomock.Controller) *MockLossMeter {
+	mock := &MockLossMeter{ctrl: ctrl}
+	mock.recorder = &MockLossMeterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLossMeter) EXPECT() *MockLossMeterMockRecorder {
+	return m.recorder
+}
+
+// Loss mocks base method.
+func (m *MockLossMeter) Loss() (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Loss")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Loss indicates an expected call of Loss.
+func (mr *MockLossMeterMockRecorder) Loss() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Loss", reflect.TypeOf((*MockLossMeter)(nil).Loss))
+}
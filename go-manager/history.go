@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHealthRecords bounds the tunnel health history.
+const maxHealthRecords = 1000
+
+// HealthRecord is a change of the tunnel's health.
+type HealthRecord struct {
+	Time    time.Time `json:"time"`
+	Server  string    `json:"server"`
+	Healthy bool      `json:"healthy"`
+}
+
+func (s *Store) recordHealth(server string, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Health = append(s.Health, HealthRecord{Time: time.Now(), Server: server, Healthy: healthy})
+	if len(s.Health) > maxHealthRecords {
+		s.Health = slices.Clone(s.Health[len(s.Health)-maxHealthRecords:])
+	}
+	s.save()
+}
+
+// historyRow is one exported event: a switch from the audit log or a health
+// change from the state store.
+type historyRow struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"` // switch or health
+	Server     string    `json:"server"`
+	From       string    `json:"from,omitempty"`
+	Trigger    string    `json:"trigger,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Outcome    string    `json:"outcome,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	Healthy    *bool     `json:"healthy,omitempty"`
+}
+
+var historyColumns = []string{"time", "kind", "server", "from", "trigger", "reason", "outcome", "duration_ms", "healthy"}
+
+func (r historyRow) csv() []string {
+	healthy, duration := "", ""
+	if r.Healthy != nil {
+		healthy = strconv.FormatBool(*r.Healthy)
+	}
+	if r.Kind == "switch" {
+		duration = strconv.FormatInt(r.DurationMs, 10)
+	}
+	return []string{r.Time.Format(time.RFC3339), r.Kind, r.Server, r.From, r.Trigger, r.Reason, r.Outcome, duration, healthy}
+}
+
+// historyRows merges the audit log and the health history since the given
+// time, oldest first.
+func historyRows(store *Store, since time.Time) []historyRow {
+	var rows []historyRow
+	for _, ev := range auditEvents(since, time.Now().Add(time.Minute)) {
+		rows = append(rows, historyRow{Time: ev.Time, Kind: "switch", Server: ev.To, From: ev.From,
+			Trigger: ev.Trigger, Reason: ev.Reason, Outcome: ev.Outcome, DurationMs: ev.DurationMs})
+	}
+	store.mu.Lock()
+	for _, h := range store.Health {
+		if !h.Time.Before(since) {
+			rows = append(rows, historyRow{Time: h.Time, Kind: "health", Server: h.Server, Healthy: &h.Healthy})
+		}
+	}
+	store.mu.Unlock()
+	slices.SortStableFunc(rows, func(a, b historyRow) int { return a.Time.Compare(b.Time) })
+	return rows
+}
+
+// parseSince reads --since: a number of days ("7d"), a Go duration ("12h"),
+// a date or an RFC 3339 time.
+func parseSince(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("--since %q is not a duration such as 7d or 12h, a date or an RFC 3339 time", v)
+}
+
+func writeHistory(w io.Writer, format string, rows []historyRow) error {
+	switch format {
+	case "json":
+		if rows == nil {
+			rows = []historyRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(historyColumns)
+		for _, r := range rows {
+			cw.Write(r.csv())
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown format %q, want csv or json", format)
+}
+
+// runHistoryCommand implements `manager history export`.
+func runHistoryCommand(args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(os.Stderr, "usage: manager history export [--format csv|json] [--since 7d] [--out file]")
+		os.Exit(exitUsage)
+	}
+	fs := flag.NewFlagSet("history export", flag.ExitOnError)
+	format := fs.String("format", "csv", "Output format: csv or json")
+	sinceFlag := fs.String("since", "", "Only events in this period (7d, 12h) or after this date or time")
+	out := fs.String("out", "", "Write to this file instead of stdout")
+	fs.Parse(args[1:])
+
+	since, err := parseSince(*sinceFlag, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	rows := historyRows(loadStore(cfg.stateFile), since)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitFailure)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeHistory(w, *format, rows); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+}
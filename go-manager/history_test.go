@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHistoryExport(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	now := time.Now()
+	audit(auditEvent{Time: now.Add(-10 * 24 * time.Hour), Trigger: triggerLoad, From: "US#1", To: "US#2", Outcome: outcomeSuccess})
+	audit(auditEvent{Time: now.Add(-time.Hour), Trigger: triggerHealth, Reason: "Unhealthy Connection", From: "US#2", To: "US#3",
+		Outcome: outcomeSuccess, DurationMs: 4200})
+	stateStore.recordHealth("US#2", false)
+
+	since, err := parseSince("7d", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := historyRows(stateStore, since)
+	if len(rows) != 2 || rows[0].Kind != "switch" || rows[1].Kind != "health" {
+		t.Fatalf("rows %+v", rows)
+	}
+
+	var buf bytes.Buffer
+	if err := writeHistory(&buf, "csv", rows); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][2] != "US#3" || records[1][7] != "4200" || records[2][8] != "false" {
+		t.Errorf("csv %q", records)
+	}
+
+	buf.Reset()
+	if err := writeHistory(&buf, "json", rows); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []historyRow
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[0].Reason != "Unhealthy Connection" {
+		t.Errorf("json %s: %v", buf.String(), err)
+	}
+
+	if err := writeHistory(&buf, "xml", rows); err == nil {
+		t.Error("xml format accepted")
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"12h", now.Add(-12 * time.Hour)},
+		{"2026-10-01T00:00:00Z", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if got, err := parseSince(tt.in, now); err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseSince("last week", now); err == nil {
+		t.Error("parseSince accepted \"last week\"")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// hassEntity describes one Home Assistant entity backed by the state topic.
+type hassEntity struct {
+	Component   string // sensor or binary_sensor
+	Key         string
+	Name        string
+	Template    string
+	DeviceClass string
+	Unit        string
+	Icon        string
+}
+
+var hassEntities = []hassEntity{
+	{Component: "binary_sensor", Key: "healthy", Name: "Connected", Template: "{{ 'ON' if value_json.healthy else 'OFF' }}", DeviceClass: "connectivity"},
+	{Component: "sensor", Key: "server", Name: "Server", Template: "{{ value_json.server }}", Icon: "mdi:server-network"},
+	{Component: "sensor", Key: "load", Name: "Server Load", Template: "{{ value_json.load }}", Unit: "%", Icon: "mdi:gauge"},
+	{Component: "sensor", Key: "state", Name: "State", Template: "{{ value_json.state }}", Icon: "mdi:state-machine"},
+	{Component: "sensor", Key: "forwarded_port", Name: "Forwarded Port", Template: "{{ value_json.forwarded_port }}", Icon: "mdi:lan-connect"},
+	{Component: "sensor", Key: "last_switch", Name: "Last Switch", Template: "{{ value_json.last_switch }}", DeviceClass: "timestamp"},
+	{Component: "sensor", Key: "last_switch_reason", Name: "Last Switch Reason", Template: "{{ value_json.last_switch_reason }}", Icon: "mdi:swap-horizontal"},
+}
+
+var nonTopicChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// mqttNode returns the node id used in topics and unique ids.
+func mqttNode() string {
+	return nonTopicChars.ReplaceAllString(cfg.mqttNodeID, "_")
+}
+
+func mqttStateTopic() string        { return cfg.mqttTopicPrefix + "/state" }
+func mqttAvailabilityTopic() string { return cfg.mqttTopicPrefix + "/availability" }
+
+// runMQTTPublisher keeps a broker connection open, publishing Home Assistant
+// discovery configs on every connect and the daemon status on every change.
+func runMQTTPublisher(statuses <-chan Status) {
+	const keepalive = 60 * time.Second
+	var last *Status
+	failures := 0
+
+	for {
+		will := &mqttWill{Topic: mqttAvailabilityTopic(), Payload: "offline", Retain: true}
+		client, err := dialMQTT(cfg.mqttBroker, mqttNode(), cfg.mqttUsername, cfg.mqttPassword, will, keepalive)
+		if err != nil {
+			failures++
+			delay := cfg.notifyRetry.Delay(failures)
+			log(fmt.Sprintf("MQTT: cannot connect to %s: %v (retrying in %s)", cfg.mqttBroker, err, delay.Round(time.Second)))
+			time.Sleep(delay)
+			continue
+		}
+		failures = 0
+		log(fmt.Sprintf("MQTT: connected to %s", cfg.mqttBroker))
+
+		err = publishDiscovery(client)
+		if err == nil {
+			err = client.publish(mqttAvailabilityTopic(), []byte("online"), true)
+		}
+		if err == nil && last != nil {
+			err = publishStatus(client, *last)
+		}
+
+		ping := time.NewTicker(keepalive / 2)
+		for err == nil {
+			select {
+			case st := <-statuses:
+				last = &st
+				err = publishStatus(client, st)
+			case <-ping.C:
+				err = client.ping()
+			case <-client.done:
+				err = client.err
+			}
+		}
+		ping.Stop()
+		// Not close(): without a DISCONNECT the broker publishes "offline"
+		client.conn.Close()
+
+		log(fmt.Sprintf("MQTT: connection lost (%v), reconnecting", err))
+		time.Sleep(cfg.notifyRetry.Delay(1))
+	}
+}
+
+func publishDiscovery(client *mqttClient) error {
+	node := mqttNode()
+	device := map[string]any{
+		"identifiers":  []string{node},
+		"name":         "ProtonVPN " + cfg.mqttNodeID,
+		"manufacturer": "gluetun-proton-manager",
+		"model":        "Sidecar Manager",
+	}
+
+	for _, e := range hassEntities {
+		config := map[string]any{
+			"name":               e.Name,
+			"unique_id":          node + "_" + e.Key,
+			"state_topic":        mqttStateTopic(),
+			"value_template":     e.Template,
+			"availability_topic": mqttAvailabilityTopic(),
+			"device":             device,
+		}
+		if e.DeviceClass != "" {
+			config["device_class"] = e.DeviceClass
+		}
+		if e.Unit != "" {
+			config["unit_of_measurement"] = e.Unit
+			config["state_class"] = "measurement"
+		}
+		if e.Icon != "" {
+			config["icon"] = e.Icon
+		}
+
+		payload, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		topic := strings.Join([]string{cfg.mqttDiscoveryPrefix, e.Component, node, e.Key, "config"}, "/")
+		if err := client.publish(topic, payload, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func publishStatus(client *mqttClient, st Status) error {
+	state := map[string]any{
+		"state":              st.State,
+		"server":             st.Server,
+		"load":               st.Load,
+		"healthy":            st.Healthy,
+		"forwarded_port":     st.ForwardedPort,
+		"last_switch_reason": st.LastSwitchReason,
+	}
+	// Leave the timestamp unknown rather than reporting year 1
+	if !st.LastSwitch.IsZero() {
+		state["last_switch"] = st.LastSwitch.Format(time.RFC3339)
+	}
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return client.publish(mqttStateTopic(), payload, true)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+)
+
+// Proton sometimes demands a CAPTCHA before it accepts a login, typically
+// after repeated logins from the same IP. Exiting would make the container
+// restart and log in again, which only deepens the lock, so the manager
+// waits for a human to solve the challenge and then logs in with its token.
+
+const verifyURL = "https://verify.proton.me/"
+
+// hvError returns the human verification details if err is Proton asking
+// for one.
+func hvError(err error) (*proton.APIHVDetails, bool) {
+	var pe *proton.APIError
+	if !errors.As(err, &pe) || !pe.IsHVError() {
+		return nil, false
+	}
+	hv, detailsErr := pe.GetHVDetails()
+	if detailsErr != nil {
+		return nil, false
+	}
+	return hv, true
+}
+
+func verificationLink(hv *proton.APIHVDetails) string {
+	q := url.Values{}
+	q.Set("methods", strings.Join(hv.Methods, ","))
+	q.Set("token", hv.Token)
+	return verifyURL + "?" + q.Encode()
+}
+
+// readHVToken returns a token dropped into HV_TOKEN_FILE, if any. This is how
+// a verification completed elsewhere is handed to the manager.
+func readHVToken() string {
+	data, err := os.ReadFile(cfg.hvTokenFile)
+	if err != nil {
+		return ""
+	}
+	os.Remove(cfg.hvTokenFile)
+	return strings.TrimSpace(string(data))
+}
+
+// awaitHumanVerification announces the challenge and retries the login with
+// its token every HV_RETRY_INTERVAL seconds, or right away on SIGUSR1, until
+// Proton accepts it. A challenge that expires is replaced by the new one.
+func (pm *ProtonManager) awaitHumanVerification(hv *proton.APIHVDetails) error {
+	loginWithHV := pm.loginWithHV
+	if loginWithHV == nil {
+		loginWithHV = pm.apiManager.NewClientWithLoginWithHVToken
+	}
+	retry := make(chan os.Signal, 1)
+	signal.Notify(retry, syscall.SIGUSR1)
+	defer signal.Stop(retry)
+
+	for {
+		link := verificationLink(hv)
+		log(fmt.Sprintf("Proton requires human verification. Open %s, solve the challenge, then wait or send SIGUSR1 to retry now", link))
+		notify(alertHumanVerification, "Proton requires human verification",
+			fmt.Sprintf("Proton wants a human verification before the manager can log in as %s. Open this link and solve the challenge:\n\n%s\n\nThe manager retries every %s; send it SIGUSR1 (docker kill -s USR1 <manager>) to retry immediately. If the page gives you a token, write it to %s.",
+				pm.acct().Username, link, time.Duration(cfg.hvRetryInterval)*time.Second, cfg.hvTokenFile))
+
+		select {
+		case <-time.After(time.Duration(cfg.hvRetryInterval) * time.Second):
+		case <-retry:
+			log("Retrying login on SIGUSR1")
+		}
+
+		if token := readHVToken(); token != "" {
+			hv = &proton.APIHVDetails{Methods: hv.Methods, Token: token}
+		}
+		c, auth, err := loginWithHV(context.Background(), pm.acct().Username, []byte(pm.acct().Password), hv)
+		if err == nil {
+			pm.setAuth(c, auth)
+			resolveAlert(alertHumanVerification, "Proton requires human verification")
+			return nil
+		}
+		next, ok := hvError(err)
+		if !ok {
+			return err
+		}
+		if next.Token != hv.Token {
+			hv = next
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ProtonMail/go-proton-api"
+)
+
+func TestHVError(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		ok   bool
+	}{
+		{"challenge", &proton.APIError{Code: proton.HumanVerificationRequired, Details: []byte(`{"HumanVerificationToken":"t1","HumanVerificationMethods":["captcha"]}`)}, true},
+		{"unreadable details", &proton.APIError{Code: proton.HumanVerificationRequired, Details: []byte(`[`)}, false},
+		{"other API error", &proton.APIError{Code: 2028}, false},
+		{"not an API error", errTest, false},
+		{"no error", nil, false},
+	} {
+		hv, ok := hvError(tc.err)
+		if ok != tc.ok {
+			t.Errorf("%s: hvError ok = %v, want %v", tc.name, ok, tc.ok)
+		}
+		if ok && (hv.Token != "t1" || !slices.Equal(hv.Methods, []string{"captcha"})) {
+			t.Errorf("%s: hvError = %+v", tc.name, hv)
+		}
+	}
+}
+
+func TestReadHVToken(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.hvTokenFile = filepath.Join(t.TempDir(), "proton_hv_token")
+	if got := readHVToken(); got != "" {
+		t.Errorf("readHVToken() = %q without a file", got)
+	}
+	os.WriteFile(cfg.hvTokenFile, []byte("  solved\n"), 0600)
+	if got := readHVToken(); got != "solved" {
+		t.Errorf("readHVToken() = %q, want solved", got)
+	}
+	if _, err := os.Stat(cfg.hvTokenFile); !os.IsNotExist(err) {
+		t.Error("token file still there after it was read")
+	}
+}
+
+func TestAwaitHumanVerification(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	cfg.hvRetryInterval = 0
+	cfg.hvTokenFile = filepath.Join(t.TempDir(), "proton_hv_token")
+
+	// The fake API has no SRP endpoints, so the login only asks it for the
+	// auth info, which is where it challenges.
+	var tried []proton.APIHVDetails
+	pm.loginWithHV = func(ctx context.Context, username string, password []byte, hv *proton.APIHVDetails) (*proton.Client, proton.Auth, error) {
+		tried = append(tried, *hv)
+		if _, err := pm.apiManager.AuthInfo(ctx, proton.AuthInfoReq{Username: username}); err != nil {
+			return nil, proton.Auth{}, err
+		}
+		auth := proton.Auth{UID: "login-uid", AccessToken: "login-access", RefreshToken: "login-refresh"}
+		return pm.apiManager.NewClient(auth.UID, auth.AccessToken, auth.RefreshToken), auth, nil
+	}
+
+	// A token solved elsewhere replaces the challenge's; Proton rejects it
+	// with a new challenge, which the next attempt passes.
+	srv.RequireHumanVerification(1, "challenge-2", "captcha", "email")
+	if err := os.WriteFile(cfg.hvTokenFile, []byte("solved\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.awaitHumanVerification(&proton.APIHVDetails{Methods: []string{"captcha", "email"}, Token: "challenge-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []proton.APIHVDetails{
+		{Methods: []string{"captcha", "email"}, Token: "solved"},
+		{Methods: []string{"captcha", "email"}, Token: "challenge-2"},
+	}
+	if len(tried) != len(want) {
+		t.Fatalf("tried %+v, want %+v", tried, want)
+	}
+	for i := range want {
+		if tried[i].Token != want[i].Token || !slices.Equal(tried[i].Methods, want[i].Methods) {
+			t.Errorf("attempt %d with %+v, want %+v", i+1, tried[i], want[i])
+		}
+	}
+	if _, err := os.Stat(cfg.hvTokenFile); !os.IsNotExist(err) {
+		t.Error("token file still there after it was used")
+	}
+	if pm.uid != "login-uid" {
+		t.Errorf("session uid = %q, want the new login's", pm.uid)
+	}
+	if alerts.incident(alertHumanVerification).active {
+		t.Error("human verification alert still open after the login")
+	}
+}
+
+func TestAwaitHumanVerificationStopsOnOtherErrors(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	cfg.hvRetryInterval = 0
+	cfg.hvTokenFile = filepath.Join(t.TempDir(), "proton_hv_token")
+
+	attempts := 0
+	pm.loginWithHV = func(context.Context, string, []byte, *proton.APIHVDetails) (*proton.Client, proton.Auth, error) {
+		attempts++
+		return nil, proton.Auth{}, errTest
+	}
+	if err := pm.awaitHumanVerification(&proton.APIHVDetails{Methods: []string{"captcha"}, Token: "challenge-1"}); err != errTest {
+		t.Errorf("awaitHumanVerification = %v, want %v", err, errTest)
+	}
+	if attempts != 1 {
+		t.Errorf("tried %d logins, want 1", attempts)
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-proton-api"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/protonapi/protontest"
+	"gluetun-proton-manager/selector"
+)
+
+// These tests run the manager's API client and the daemon's load loop
+// against protontest, a fake Proton API serving recorded /vpn/logicals
+// snapshots.
+
+const fixture = "protonapi/protontest/testdata/logicals.json"
+
+// newFakeAPI starts a fake API with the recorded snapshots and points the
+// manager at it.
+func newFakeAPI(t *testing.T) *protontest.Server {
+	t.Helper()
+	snapshots, err := protonapi.LoadSnapshots(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := protontest.NewServer(snapshots...)
+	t.Cleanup(srv.Close)
+
+	prevURL, prevAlt := cfg.apiBaseURL, cfg.altRouting
+	cfg.apiBaseURL, cfg.altRouting = srv.URL, false
+	t.Cleanup(func() { cfg.apiBaseURL, cfg.altRouting = prevURL, prevAlt })
+	return srv
+}
+
+// newTestManager returns a ProtonManager holding the fake API's initial
+// session for each of the given account names.
+func newTestManager(t *testing.T, names ...string) *ProtonManager {
+	t.Helper()
+	dir := t.TempDir()
+	secrets = nil
+	cfg.accountRotationInterval = 0
+	accounts = nil
+	for i, name := range names {
+		acct := account{
+			Username:    name,
+			Password:    "secret",
+			SessionFile: filepath.Join(dir, name+".json"),
+		}
+		accounts = append(accounts, acct)
+		pm := &ProtonManager{account: i, uid: protontest.UID, accessToken: protontest.AccessToken, refreshToken: protontest.RefreshToken}
+		pm.saveSession()
+	}
+
+	pm := &ProtonManager{accountSince: time.Now(), apiManager: newAPIManager()}
+	if err := pm.loadSession(); err != nil {
+		t.Fatal(err)
+	}
+	return pm
+}
+
+// waitFor polls cond until it holds or a few seconds have passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServersFromFakeAPI(t *testing.T) {
+	newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+
+	servers, err := pm.Servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 5 {
+		t.Fatalf("got %d servers, want 5", len(servers))
+	}
+	if s := protonapi.FindByName(servers, "CH#2"); s == nil || s.Load != 30 || len(s.Servers) != 1 {
+		t.Errorf("CH#2 = %+v, want load 30 with one physical server", s)
+	}
+}
+
+func TestProactiveTokenRefresh(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	prevLifetime := cfg.tokenLifetime
+	cfg.tokenLifetime = 3600
+	t.Cleanup(func() { cfg.tokenLifetime = prevLifetime })
+	ahead := 30 * time.Minute
+
+	// Not due yet: nothing happens
+	pm.tokenIssued = time.Now().Add(-10 * time.Minute)
+	if err := pm.refreshAhead(ahead); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Hits("/auth/v4/refresh"); n != 0 {
+		t.Fatalf("refreshed %d times with 50 minutes left, want 0", n)
+	}
+
+	// Within TOKEN_REFRESH_AHEAD of expiry: renewed and persisted
+	pm.tokenIssued = time.Now().Add(-45 * time.Minute)
+	if err := pm.refreshAhead(ahead); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Hits("/auth/v4/refresh"); n != 1 {
+		t.Fatalf("refreshed %d times, want 1", n)
+	}
+	access, _ := srv.Tokens()
+	if pm.accessToken != access || time.Since(pm.tokenIssued) > time.Minute {
+		t.Errorf("manager holds %s issued %s, want %s issued now", pm.accessToken, pm.tokenIssued, access)
+	}
+	saved := &ProtonManager{}
+	if err := saved.loadSession(); err != nil {
+		t.Fatal(err)
+	}
+	if saved.accessToken != access || !saved.tokenIssued.Equal(pm.tokenIssued) {
+		t.Errorf("saved session %s issued %s, want %s issued %s", saved.accessToken, saved.tokenIssued, access, pm.tokenIssued)
+	}
+
+	// A token that expires early shortens the lifetime planned with
+	pm.tokenIssued = time.Now().Add(-20 * time.Minute)
+	srv.ExpireToken()
+	if _, err := pm.Servers(); err != nil {
+		t.Fatal(err)
+	}
+	if pm.learnedLifetime < 20*time.Minute || pm.learnedLifetime > 21*time.Minute {
+		t.Errorf("learned lifetime %s, want about 20m", pm.learnedLifetime)
+	}
+	if until := time.Until(pm.tokenExpiry()); until > 21*time.Minute {
+		t.Errorf("next expiry in %s, want within the learned 20m", until)
+	}
+}
+
+func TestRefreshLoop(t *testing.T) {
+	prevLifetime, prevAhead, prevBase := cfg.tokenLifetime, cfg.tokenRefreshAhead, tokenRetryBase
+	cfg.tokenLifetime, cfg.tokenRefreshAhead, tokenRetryBase = 3600, 1800, 10*time.Millisecond
+	t.Cleanup(func() { cfg.tokenLifetime, cfg.tokenRefreshAhead, tokenRetryBase = prevLifetime, prevAhead, prevBase })
+
+	for _, tc := range []struct {
+		name      string
+		age       time.Duration // of the token when the loop starts
+		failures  int           // refreshes the API rejects before one succeeds
+		refreshes int           // refresh requests the loop makes, at least
+	}{
+		{name: "not due", age: 10 * time.Minute},
+		{name: "due", age: 45 * time.Minute, refreshes: 1},
+		{name: "already expired", age: 2 * time.Hour, refreshes: 1},
+		{name: "failed renewal retried", age: 45 * time.Minute, failures: 2, refreshes: 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeAPI(t)
+			pm := newTestManager(t, "alice")
+			pm.tokenIssued = time.Now().Add(-tc.age)
+			srv.FailRefresh(tc.failures > 0)
+
+			done, stopped := make(chan struct{}), make(chan struct{})
+			go func() {
+				pm.refreshLoop(done)
+				close(stopped)
+			}()
+			if tc.failures > 0 {
+				waitFor(t, "failed refreshes", func() bool { return srv.Hits("/auth/v4/refresh") >= tc.failures })
+				srv.FailRefresh(false)
+			}
+			renewed := func() bool {
+				pm.mu.Lock()
+				defer pm.mu.Unlock()
+				access, _ := srv.Tokens()
+				return pm.accessToken == access && pm.accessToken != protontest.AccessToken
+			}
+			if tc.refreshes > 0 {
+				waitFor(t, "the token to be renewed", renewed)
+			}
+
+			// Once renewed, or while not due, the next refresh is half an
+			// hour or more away.
+			time.Sleep(100 * time.Millisecond)
+			hits := srv.Hits("/auth/v4/refresh")
+			if hits < tc.refreshes || tc.failures == 0 && hits != tc.refreshes {
+				t.Errorf("made %d refresh requests, want %d", hits, tc.refreshes)
+			}
+			if tc.refreshes == 0 && renewed() {
+				t.Error("token renewed long before it was due")
+			}
+
+			close(done)
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Error("refreshLoop still running after done was closed")
+			}
+		})
+	}
+}
+
+func TestSessionMetricsAndReauthAlert(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	prevMetrics, prevAlerts := sessionMetrics, alerts
+	sessionMetrics, alerts = &sessionCounters{refreshes: make(map[string]int)}, newAlertManager(time.Hour, nil)
+	t.Cleanup(func() { sessionMetrics, alerts = prevMetrics, prevAlerts })
+
+	srv.ExpireToken()
+	if _, err := pm.Servers(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake API has no SRP endpoints, so the login is stubbed
+	pm.loginWith = func(ctx context.Context, username string, password []byte) (*proton.Client, proton.Auth, error) {
+		auth := proton.Auth{UID: "login-uid", AccessToken: "login-access", RefreshToken: "login-refresh"}
+		return pm.apiManager.NewClient(auth.UID, auth.AccessToken, auth.RefreshToken), auth, nil
+	}
+
+	// A revoked refresh token forces a password login, which alerts
+	srv.ExpireToken()
+	srv.FailRefresh(true)
+	pm.Servers()
+	if !alerts.incident(alertReauth).active {
+		t.Error("no reauthentication alert after the refresh failed")
+	}
+
+	var out strings.Builder
+	sessionMetrics.write(&out)
+	for _, want := range []string{
+		`proton_manager_token_refreshes_total{trigger="expired"} 1`,
+		"proton_manager_token_refresh_failures_total 1",
+		"proton_manager_api_unauthorized_total 2",
+		"proton_manager_reauthentications_total 1",
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("metrics lack %q:\n%s", want, out.String())
+		}
+	}
+
+	// The next successful refresh resolves it. The test login can't hand
+	// out tokens the fake knows, so take over its current ones.
+	srv.FailRefresh(false)
+	pm.uid = protontest.UID
+	_, pm.refreshToken = srv.Tokens()
+	if err := pm.refreshAhead(time.Duration(cfg.tokenLifetime) * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if alerts.incident(alertReauth).active {
+		t.Error("reauthentication alert still open after a successful refresh")
+	}
+}
+
+func TestServersRefreshesExpiredToken(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	srv.ExpireToken()
+
+	if _, err := pm.Servers(); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Hits("/auth/v4/refresh"); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	access, refresh := srv.Tokens()
+	if pm.accessToken != access || pm.refreshToken != refresh {
+		t.Errorf("manager holds %s/%s, want %s/%s", pm.accessToken, pm.refreshToken, access, refresh)
+	}
+
+	// The refreshed session is persisted for the next start
+	saved := &ProtonManager{}
+	if err := saved.loadSession(); err != nil {
+		t.Fatal(err)
+	}
+	if saved.refreshToken != refresh {
+		t.Errorf("saved refresh token %q, want %q", saved.refreshToken, refresh)
+	}
+}
+
+func TestFailedReauthReturnsError(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	accounts[0].Password = ""
+
+	srv.ExpireToken()
+	srv.FailRefresh(true)
+	_, err := pm.Servers()
+	if err == nil {
+		t.Fatal("Servers succeeded without a session")
+	}
+	if code := exitCode(err); code != exitConfig {
+		t.Errorf("exit code %d for %v, want %d", code, err, exitConfig)
+	}
+}
+
+func TestServersRateLimited(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	srv.RateLimit(1, 90*time.Second)
+
+	_, err := pm.Servers()
+	if classifyAPIError(err) != apiErrRateLimited {
+		t.Fatalf("Servers() = %v, want a rate limit error", err)
+	}
+	if d := retryAfter(err); d != 90*time.Second {
+		t.Errorf("retryAfter = %s, want 90s", d)
+	}
+	if code := exitCode(err); code != exitRateLimited {
+		t.Errorf("exitCode = %d, want %d", code, exitRateLimited)
+	}
+
+	if _, err := pm.Servers(); err != nil {
+		t.Errorf("Servers() after the limit = %v", err)
+	}
+}
+
+func TestRateLimitRotatesAccount(t *testing.T) {
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice", "bob")
+	srv.RateLimit(1, time.Minute)
+
+	servers, err := pm.Servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) == 0 {
+		t.Error("no servers after rotating")
+	}
+	if pm.acct().Username != "bob" {
+		t.Errorf("using %s, want bob", pm.acct().Username)
+	}
+}
+
+func TestLoadLoopFollowsSnapshots(t *testing.T) {
+	setupTestEnv(t, "CH#1")
+	srv := newFakeAPI(t)
+	pm := newTestManager(t, "alice")
+	cfg.targetTiers = []selector.Tier{{Name: "CH", Countries: []string{"CH"}}}
+
+	rt := newMockRuntime(t)
+	d := newTestDaemon(pm, rt, newMockHealth(t, true))
+	stopped := make(chan struct{})
+	go func() {
+		d.loadLoop()
+		close(stopped)
+	}()
+	defer func() {
+		d.stop()
+		<-stopped
+	}()
+
+	// CH#1 at 80% moves to CH#2 at 30%; CH#4 is in maintenance and DE#1 is
+	// outside the target
+	waitFor(t, "switch to CH#2", func() bool { return slices.Equal(rt.appliedNames(), []string{"CH#2"}) })
+
+	// CH#2 climbs to 75% while CH#3 is at 40%
+	srv.Advance()
+	d.requestFailover("")
+	waitFor(t, "switch to CH#3", func() bool { return slices.Equal(rt.appliedNames(), []string{"CH#2", "CH#3"}) })
+
+	// CH#4 is back at 10%, well below CH#3's 35%
+	srv.Advance()
+	srv.ExpireToken()
+	d.requestFailover("")
+	waitFor(t, "switch to CH#4", func() bool { return slices.Equal(rt.appliedNames(), []string{"CH#2", "CH#3", "CH#4"}) })
+
+	if n := srv.Hits("/auth/v4/refresh"); n != 1 {
+		t.Errorf("refreshed %d times, want 1", n)
+	}
+	if got := getCurrentServerFromEnv(); got != "CH#4" {
+		t.Errorf("env file has %q, want CH#4", got)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// integration is an application behind the tunnel that the manager keeps in
+// step with switches, talking to its own API rather than to Docker.
+type integration interface {
+	Name() string
+	// Pause runs before gluetun is recreated.
+	Pause() error
+	// Resume runs once the new tunnel is up.
+	Resume() error
+	// SetPort runs when gluetun forwards a new port.
+	SetPort(port int) error
+}
+
+// integrationTimeout bounds each call to an application's API.
+const integrationTimeout = 10 * time.Second
+
+// parseIntegrations builds the integrations whose URL is set.
+func parseIntegrations() []integration {
+	var list []integration
+	if u := getEnv("DELUGE_URL", ""); u != "" {
+		list = append(list, newDeluge(u, credential("DELUGE_PASSWORD")))
+	}
+	if u := getEnv("SABNZBD_URL", ""); u != "" {
+		list = append(list, newSABnzbd(u, credential("SABNZBD_API_KEY")))
+	}
+	if u := getEnv("SONARR_URL", ""); u != "" {
+		list = append(list, newArr("Sonarr", u, credential("SONARR_API_KEY")))
+	}
+	if u := getEnv("RADARR_URL", ""); u != "" {
+		list = append(list, newArr("Radarr", u, credential("RADARR_API_KEY")))
+	}
+	return list
+}
+
+// integrationProblems reports integration settings that can't work.
+func integrationProblems() []string {
+	var problems []string
+	for _, name := range []string{"DELUGE_URL", "SABNZBD_URL", "SONARR_URL", "RADARR_URL"} {
+		if v := os.Getenv(name); v != "" {
+			if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("%s must be an http(s) URL, got %q", name, v))
+			}
+		}
+	}
+	for _, in := range cfg.integrations {
+		switch c := in.(type) {
+		case *deluge:
+			if cfg.gluetunControlURL == "" {
+				problems = append(problems, "DELUGE_URL needs GLUETUN_CONTROL_URL to read the forwarded port")
+			}
+		case *sabnzbd:
+			if c.apiKey == "" {
+				problems = append(problems, "SABNZBD_URL needs SABNZBD_API_KEY")
+			}
+		case *arr:
+			if c.apiKey == "" {
+				upper := strings.ToUpper(c.name)
+				problems = append(problems, fmt.Sprintf("%s_URL needs %s_API_KEY", upper, upper))
+			}
+		}
+	}
+	return problems
+}
+
+// pauseIntegrations tells each application a switch is starting. Failures
+// are logged and don't hold the switch up.
+func pauseIntegrations() {
+	for _, in := range cfg.integrations {
+		if err := in.Pause(); err != nil {
+			log(fmt.Sprintf("Integration %s: pause failed: %v", in.Name(), err))
+		}
+	}
+}
+
+// resumeIntegrations tells each application the tunnel is back.
+func resumeIntegrations() {
+	for _, in := range cfg.integrations {
+		if err := in.Resume(); err != nil {
+			log(fmt.Sprintf("Integration %s: resume failed: %v", in.Name(), err))
+		}
+	}
+}
+
+// setIntegrationPorts hands a new forwarded port to each application,
+// reporting whether all of them took it.
+func setIntegrationPorts(port int) bool {
+	ok := true
+	for _, in := range cfg.integrations {
+		if err := in.SetPort(port); err != nil {
+			log(fmt.Sprintf("Integration %s: setting port %d failed: %v", in.Name(), port, err))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// integrationRuntime pauses the integrations before each recreate, and
+// resumes them at once if the runtime kept the old tunnel.
+type integrationRuntime struct {
+	Runtime
+}
+
+func (r integrationRuntime) Restart() bool {
+	pauseIntegrations()
+	if !r.Runtime.Restart() {
+		resumeIntegrations()
+		return false
+	}
+	return true
+}
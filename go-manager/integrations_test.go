@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestIntegrationsFollowSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	var calls []string
+	sab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("apikey") != "key" {
+			w.Write([]byte(`{"status": false, "error": "API Key Incorrect"}`))
+			return
+		}
+		calls = append(calls, r.URL.Query().Get("mode"))
+		w.Write([]byte(`{"status": true}`))
+	}))
+	defer sab.Close()
+	cfg.integrations = []integration{newSABnzbd(sab.URL, "key")}
+
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), integrationRuntime{rt}, newMockHealth(t, false, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if rt.restarts != 1 || !slices.Equal(calls, []string{"pause", "resume"}) {
+		t.Errorf("%d restarts, SABnzbd calls %v; want 1 and [pause resume]", rt.restarts, calls)
+	}
+
+	if err := newSABnzbd(sab.URL, "wrong").Pause(); err == nil {
+		t.Error("a rejected API key went unnoticed")
+	}
+}
+
+func TestDelugeSetPort(t *testing.T) {
+	var config map[string]any
+	connected := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+			ID     int    `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		var result any
+		switch req.Method {
+		case "auth.login":
+			result = req.Params[0] == "secret"
+			if result == true {
+				http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "s"})
+			}
+		case "web.connected":
+			result = connected
+		case "web.get_hosts":
+			result = [][]any{{"abc", "127.0.0.1", 58846, "Offline"}}
+		case "web.connect":
+			connected = req.Params[0] == "abc"
+		case "core.set_config":
+			if _, err := r.Cookie("_session_id"); err != nil || !connected {
+				w.Write([]byte(`{"result": null, "error": {"message": "Not authenticated", "code": 1}, "id": 1}`))
+				return
+			}
+			config = req.Params[0].(map[string]any)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"result": result, "error": nil, "id": req.ID})
+	}))
+	defer srv.Close()
+
+	if err := newDeluge(srv.URL, "wrong").SetPort(51820); err == nil {
+		t.Error("a rejected password went unnoticed")
+	}
+	if err := newDeluge(srv.URL+"/", "secret").SetPort(51820); err != nil {
+		t.Fatal(err)
+	}
+	if ports, _ := config["listen_ports"].([]any); len(ports) != 2 || ports[0] != float64(51820) || config["random_port"] != false {
+		t.Errorf("set_config got %v", config)
+	}
+}
+
+func TestArrDisablesDownloadClients(t *testing.T) {
+	clients := map[string]map[string]any{
+		"1": {"id": 1, "name": "SABnzbd", "enable": true, "priority": 1},
+		"2": {"id": 2, "name": "Spare", "enable": false, "priority": 2},
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := r.PathValue("id")
+		switch {
+		case r.Method == "GET" && id == "":
+			json.NewEncoder(w).Encode([]map[string]any{clients["1"], clients["2"]})
+		case r.Method == "GET":
+			json.NewEncoder(w).Encode(clients[id])
+		case r.Method == "PUT":
+			var c map[string]any
+			json.NewDecoder(r.Body).Decode(&c)
+			clients[id] = c
+			w.WriteHeader(http.StatusAccepted)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/api/v3/downloadclient", handler)
+	mux.Handle("/api/v3/downloadclient/{id}", handler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	a := newArr("Sonarr", srv.URL, "key")
+	if err := a.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if clients["1"]["enable"] != false || clients["1"]["priority"] != float64(1) {
+		t.Errorf("after pause client 1 = %v", clients["1"])
+	}
+	if err := a.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if clients["1"]["enable"] != true || clients["2"]["enable"] != false {
+		t.Errorf("after resume clients = %v", clients)
+	}
+	if err := newArr("Radarr", srv.URL, "wrong").Pause(); err == nil {
+		t.Error("a rejected API key went unnoticed")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// adaptiveInterval is a check interval that tightens when checks fail and
+// relaxes again after a run of consecutive successes, staying within
+// [min, max].
+type adaptiveInterval struct {
+	current    time.Duration
+	min        time.Duration
+	max        time.Duration
+	relaxAfter int
+	streak     int
+}
+
+func newAdaptiveInterval(base, min, max time.Duration, relaxAfter int) *adaptiveInterval {
+	if min <= 0 || min > base {
+		min = base
+	}
+	if max < base {
+		max = base
+	}
+	return &adaptiveInterval{current: base, min: min, max: max, relaxAfter: relaxAfter}
+}
+
+// failure halves the interval and resets the success streak. It returns true
+// if the interval changed.
+func (a *adaptiveInterval) failure() bool {
+	a.streak = 0
+	next := max(a.current/2, a.min)
+	changed := next != a.current
+	a.current = next
+	return changed
+}
+
+// success doubles the interval after relaxAfter consecutive successes. It
+// returns true if the interval changed.
+func (a *adaptiveInterval) success() bool {
+	a.streak++
+	if a.relaxAfter <= 0 || a.streak < a.relaxAfter {
+		return false
+	}
+	a.streak = 0
+	next := min(a.current*2, a.max)
+	changed := next != a.current
+	a.current = next
+	return changed
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveInterval(t *testing.T) {
+	a := newAdaptiveInterval(60*time.Second, 15*time.Second, 240*time.Second, 2)
+
+	// Failures halve it down to the minimum
+	for _, want := range []time.Duration{30 * time.Second, 15 * time.Second, 15 * time.Second} {
+		a.failure()
+		if a.current != want {
+			t.Fatalf("after a failure: %s, want %s", a.current, want)
+		}
+	}
+
+	// Every second success in a row doubles it up to the maximum
+	for _, want := range []time.Duration{15, 30, 30, 60, 60, 120, 120, 240, 240, 240} {
+		a.success()
+		if a.current != want*time.Second {
+			t.Fatalf("after a success: %s, want %s", a.current, want*time.Second)
+		}
+	}
+
+	// A failure breaks the streak
+	a.failure()
+	a.success()
+	if a.failure(); a.current != 60*time.Second {
+		t.Errorf("after failures: %s, want 60s", a.current)
+	}
+}
+
+func TestAdaptiveIntervalBounds(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		min, max         time.Duration
+		wantMin, wantMax time.Duration
+	}{
+		{"in range", 15 * time.Second, 240 * time.Second, 15 * time.Second, 240 * time.Second},
+		{"min above base", 90 * time.Second, 240 * time.Second, 60 * time.Second, 240 * time.Second},
+		{"no min", 0, 240 * time.Second, 60 * time.Second, 240 * time.Second},
+		{"max below base", 15 * time.Second, 30 * time.Second, 15 * time.Second, 60 * time.Second},
+	} {
+		a := newAdaptiveInterval(60*time.Second, tc.min, tc.max, 5)
+		if a.min != tc.wantMin || a.max != tc.wantMax || a.current != 60*time.Second {
+			t.Errorf("%s: [%s, %s] from %s, want [%s, %s] from 1m0s", tc.name, a.min, a.max, a.current, tc.wantMin, tc.wantMax)
+		}
+	}
+}
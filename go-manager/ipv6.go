@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/protonapi"
+)
+
+// IPV6 modes. Proton flags the servers whose exits carry IPv6; without
+// IPV6 the manager ignores the flag and the tunnel is whatever gluetun's
+// settings make it.
+const (
+	ipv6Off     = "off"
+	ipv6Prefer  = "prefer"  // rank servers without IPv6 lower
+	ipv6Require = "require" // only use servers with IPv6
+)
+
+// ipv6Failover is how many IPv6 probes in a row must fail before
+// IPV6=require switches servers.
+const ipv6Failover = 3
+
+func supportsIPv6(s LogicalServer) bool {
+	return s.Features&protonapi.FeatureIPv6 != 0
+}
+
+// ipv6Eligible filters out servers without IPv6 with IPV6=require.
+func ipv6Eligible(s LogicalServer) bool {
+	return cfg.ipv6Mode != ipv6Require || supportsIPv6(s)
+}
+
+// ipv6Penalty is the load, in points, added to servers without IPv6 with
+// IPV6=prefer.
+func ipv6Penalty(s LogicalServer) float64 {
+	if cfg.ipv6Mode != ipv6Prefer || supportsIPv6(s) {
+		return 0
+	}
+	return float64(cfg.ipv6PreferWeight)
+}
+
+// ipv6EnvVars returns gluetun's WIREGUARD_ALLOWED_IPS, routing IPv6 into
+// the tunnel only for servers that carry it. Gluetun's firewall drops IPv6
+// that isn't routed into the tunnel, so it can't leak either way.
+func ipv6EnvVars(server *LogicalServer) map[string]string {
+	if cfg.ipv6Mode == ipv6Off {
+		return nil
+	}
+	allowed := "0.0.0.0/0"
+	if supportsIPv6(*server) {
+		allowed += ",::/0"
+	}
+	return map[string]string{"WIREGUARD_ALLOWED_IPS": allowed}
+}
+
+// ipv6HealthChecker probes IPV6_PING_TARGET the way HEALTH_MODE probes the
+// IPv4 one, or returns nil with IPV6=off.
+func ipv6HealthChecker() health.Checker {
+	switch {
+	case cfg.ipv6Mode == ipv6Off:
+		return nil
+	case cfg.healthMode == healthModeNative:
+		return health.Native{Target: cfg.ipv6PingTarget}
+	case cfg.healthMode == healthModeProxy:
+		return health.Proxy{ProxyURL: cfg.healthProxyURL, ProbeURL: "http://" + net.JoinHostPort(cfg.ipv6PingTarget, "80") + "/"}
+	}
+	return execChecker{target: cfg.ipv6PingTarget}
+}
+
+// checkIPv6 probes IPv6 through the tunnel after a passing health check, if
+// the current server carries it. With IPV6=require, ipv6Failover failures in
+// a row request a switch; with prefer they are only logged.
+func (d *daemon) checkIPv6() {
+	if d.checkerV6 == nil {
+		return
+	}
+	d.mu.Lock()
+	current := protonapi.FindByName(d.lastServers, d.status.Server)
+	d.mu.Unlock()
+	if current == nil || !supportsIPv6(*current) {
+		d.updateStatus(func(s *Status) { s.IPv6 = false })
+		return
+	}
+
+	ok := d.checkerV6.Check()
+	d.updateStatus(func(s *Status) { s.IPv6 = ok })
+	d.mu.Lock()
+	previous := d.ipv6Failures
+	if ok {
+		d.ipv6Failures = 0
+	} else {
+		d.ipv6Failures++
+	}
+	failures := d.ipv6Failures
+	if failures >= ipv6Failover && d.cfg.ipv6Mode == ipv6Require {
+		d.ipv6Failures = 0
+	}
+	d.mu.Unlock()
+
+	switch {
+	case ok && previous > 0:
+		log(fmt.Sprintf("IPv6 through %s works again", current.Name))
+	case !ok && failures == 1:
+		log(fmt.Sprintf("IPv6 probe to %s through %s failed", d.cfg.ipv6PingTarget, current.Name))
+	}
+	if ok || d.cfg.ipv6Mode != ipv6Require || failures < ipv6Failover {
+		return
+	}
+	reason := fmt.Sprintf("IPv6 Unreachable (%d probes in a row)", failures)
+	log(reason)
+	d.requestFailover(reason)
+}
+
+// ipv6Problems checks the IPv6 settings.
+func ipv6Problems() []string {
+	var problems []string
+	switch cfg.ipv6Mode {
+	case ipv6Off, ipv6Prefer, ipv6Require:
+	default:
+		problems = append(problems, fmt.Sprintf("IPV6 must be %s, %s or %s", ipv6Off, ipv6Prefer, ipv6Require))
+	}
+	if ip := net.ParseIP(cfg.ipv6PingTarget); ip == nil || ip.To4() != nil {
+		problems = append(problems, fmt.Sprintf("IPV6_PING_TARGET must be an IPv6 address, got %q", cfg.ipv6PingTarget))
+	}
+	if cfg.ipv6PreferWeight < 0 {
+		problems = append(problems, "IPV6_PREFER_WEIGHT must be >= 0")
+	}
+	return problems
+}
+
+// hasIPv6Address reports whether a WIREGUARD_ADDRESSES value includes an
+// IPv6 address, without which gluetun can't carry IPv6.
+func hasIPv6Address(addresses string) bool {
+	for _, a := range strings.Split(addresses, ",") {
+		if ip, _, err := net.ParseCIDR(strings.TrimSpace(a)); err == nil && ip.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
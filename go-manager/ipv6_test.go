@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func ipv6TestServers() []LogicalServer {
+	return []LogicalServer{
+		{Name: "US#1", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 50, Features: protonapi.FeatureIPv6},
+		{Name: "US#2", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 10},
+		{Name: "US#3", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 30, Features: protonapi.FeatureIPv6},
+	}
+}
+
+func TestIPv6Selection(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	servers := ipv6TestServers()
+
+	for _, tt := range []struct {
+		mode, want string
+	}{
+		{ipv6Off, "US#2"},
+		{ipv6Prefer, "US#3"}, // 10 + 25 > 30
+		{ipv6Require, "US#3"},
+	} {
+		cfg.ipv6Mode = tt.mode
+		if best, _ := findBestServer(servers, ""); best == nil || best.Name != tt.want {
+			t.Errorf("IPV6=%s picked %v, want %s", tt.mode, best, tt.want)
+		}
+	}
+
+	// Preferring doesn't rule out a server far less loaded
+	cfg.ipv6Mode, cfg.ipv6PreferWeight = ipv6Prefer, 10
+	if best, _ := findBestServer(servers, ""); best == nil || best.Name != "US#2" {
+		t.Errorf("IPV6=prefer with weight 10 picked %v, want US#2", best)
+	}
+}
+
+func TestIPv6EnvVars(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	servers := ipv6TestServers()
+	endpoint := &Server{EntryIP: "10.0.0.1", X25519PublicKey: "key"}
+
+	if _, ok := managedEnvVars(&servers[0], endpoint)["WIREGUARD_ALLOWED_IPS"]; ok {
+		t.Error("WIREGUARD_ALLOWED_IPS managed with IPV6=off")
+	}
+	cfg.ipv6Mode = ipv6Prefer
+	if got := managedEnvVars(&servers[0], endpoint)["WIREGUARD_ALLOWED_IPS"]; got != "0.0.0.0/0,::/0" {
+		t.Errorf("IPv6 server: WIREGUARD_ALLOWED_IPS = %q", got)
+	}
+	if got := managedEnvVars(&servers[1], endpoint)["WIREGUARD_ALLOWED_IPS"]; got != "0.0.0.0/0" {
+		t.Errorf("IPv4-only server: WIREGUARD_ALLOWED_IPS = %q", got)
+	}
+}
+
+func TestIPv6FailureTriggersSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.ipv6Mode = ipv6Require
+	d := newDaemon(daemonDeps{
+		Config:     cfg,
+		Source:     newMockServerSource(t, ipv6TestServers()...),
+		Runtime:    newMockRuntime(t),
+		Health:     newMockHealth(t, true),
+		HealthIPv6: newMockHealth(t, false, true, false),
+	})
+	d.lastServers = ipv6TestServers()
+	d.status.Server = "US#1"
+
+	// The passing second probe resets the run
+	for range 4 {
+		d.checkIPv6()
+	}
+	if reason := d.takeFailoverReason(); reason != "" {
+		t.Fatalf("switch requested after an interrupted run: %q", reason)
+	}
+	d.checkIPv6()
+	want := "IPv6 Unreachable (3 probes in a row)"
+	if reason := d.takeFailoverReason(); reason != want {
+		t.Errorf("failover reason %q, want %q", reason, want)
+	}
+	if switchTrigger(true, want, want) != triggerIPv6 {
+		t.Error("IPv6 switch not audited as such")
+	}
+
+	// A server without IPv6 isn't probed
+	d.status.Server = "US#2"
+	d.checkIPv6()
+	if d.status.IPv6 || d.ipv6Failures != 0 {
+		t.Errorf("IPv6 probed on an IPv4-only server")
+	}
+}
+
+func TestHasIPv6Address(t *testing.T) {
+	for addrs, want := range map[string]bool{
+		"":                                false,
+		"10.2.0.2/32":                     false,
+		"10.2.0.2/32, 2a07:b944::2:2/128": true,
+		"2a07:b944::2:2/128":              true,
+		"10.2.0.2/32,not-an-address":      false,
+	} {
+		if got := hasIPv6Address(addrs); got != want {
+			t.Errorf("hasIPv6Address(%q) = %v, want %v", addrs, got, want)
+		}
+	}
+}
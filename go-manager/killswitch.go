@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// When the tunnel goes down, gluetun's firewall is supposed to cut the
+// containers sharing its network off from the internet. With
+// KILLSWITCH_CHECK the manager verifies that from inside them: a dependent
+// that still gets out, as the host's own public IP, is leaking.
+
+const leakSubject = "Traffic is leaking outside the VPN tunnel"
+
+// verifyKillSwitch probes KILLSWITCH_PROBE_URL from each KILLSWITCH_CONTAINERS
+// container while the tunnel is down, alerting on any that reaches it
+// outside the tunnel. exitIP is the tunnel's last known exit IP.
+func verifyKillSwitch(exitIP string) {
+	hostIP, err := fetchProbeIP(func() ([]byte, error) { return fetchDirect(cfg.killSwitchProbeURL) })
+	if err != nil {
+		hostIP = "" // e.g. the manager shares gluetun's network too
+	}
+
+	var leaking []string
+	for _, name := range cfg.killSwitchContainers {
+		ip, err := fetchProbeIP(func() ([]byte, error) { return docker.Fetch(name, cfg.killSwitchProbeURL) })
+		switch {
+		case err != nil && probeUnavailable(err):
+			log(fmt.Sprintf("Kill switch check in %s could not run: %v", name, err))
+		case err != nil:
+			log(fmt.Sprintf("Kill switch holds: %s can't reach %s", name, cfg.killSwitchProbeURL))
+		case isLeak(ip, hostIP, exitIP):
+			log(fmt.Sprintf("LEAK: %s reaches the internet as %s while the tunnel is down", name, ip))
+			leaking = append(leaking, fmt.Sprintf("%s (as %s)", name, ip))
+		default:
+			log(fmt.Sprintf("%s reaches the internet as %s, not the host's IP; the tunnel seems up despite the failed health check", name, ip))
+		}
+	}
+
+	if len(leaking) == 0 {
+		resolveAlert(alertLeak, leakSubject)
+		return
+	}
+	notify(alertLeak, leakSubject,
+		fmt.Sprintf("The VPN tunnel is down, but these containers can still reach %s without it:\n\n%s\n\nTheir traffic bypasses the VPN and exposes your own IP. Check gluetun's FIREWALL settings and that they use network_mode: service:gluetun (or the namespace gluetun controls); stop them until it is fixed.",
+			cfg.killSwitchProbeURL, strings.Join(leaking, "\n")))
+}
+
+// killSwitchProblems reports KILLSWITCH_* settings that can't work.
+func killSwitchProblems() []string {
+	if !cfg.killSwitchCheck {
+		return nil
+	}
+	var problems []string
+	if len(cfg.killSwitchContainers) == 0 {
+		problems = append(problems, "KILLSWITCH_CHECK needs KILLSWITCH_CONTAINERS or DEPENDENT_CONTAINERS")
+	}
+	if u, err := url.Parse(cfg.killSwitchProbeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("KILLSWITCH_PROBE_URL must be an http(s) URL, got %q", cfg.killSwitchProbeURL))
+	}
+	return problems
+}
+
+// isLeak reports whether a dependent getting out as ip is bypassing the
+// tunnel: it shows the host's public IP or, when that is unknown, anything
+// but the tunnel's exit IP.
+func isLeak(ip, hostIP, exitIP string) bool {
+	if hostIP != "" {
+		return ip == hostIP
+	}
+	return ip != exitIP
+}
+
+// probeUnavailable tells a probe that couldn't run, such as an image
+// without wget or a stopped container, from one that was blocked.
+func probeUnavailable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "No such container") || strings.Contains(msg, "is not running")
+}
+
+// fetchDirect downloads url from the manager's own network.
+func fetchDirect(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 4096))
+}
+
+// fetchProbeIP returns the IP an IP echo service reported: either the whole
+// body, or its ip= line as in Cloudflare's /cdn-cgi/trace.
+func fetchProbeIP(fetch func() ([]byte, error)) (string, error) {
+	body, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(string(body))
+	for _, line := range strings.Split(text, "\n") {
+		if ip, ok := strings.CutPrefix(line, "ip="); ok {
+			text = strings.TrimSpace(ip)
+			break
+		}
+	}
+	if net.ParseIP(text) == nil {
+		return "", fmt.Errorf("%s returned no IP address", cfg.killSwitchProbeURL)
+	}
+	return text, nil
+}
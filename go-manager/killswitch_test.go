@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKillSwitchProbeIP(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	for _, tt := range []struct {
+		body, want string
+	}{
+		{"fl=123\nh=1.1.1.1\nip=203.0.113.7\nts=1\n", "203.0.113.7"},
+		{"198.51.100.2\n", "198.51.100.2"},
+		{"<html>blocked</html>", ""},
+	} {
+		got, err := fetchProbeIP(func() ([]byte, error) { return []byte(tt.body), nil })
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("fetchProbeIP(%q) = %q, %v; want %q", tt.body, got, err, tt.want)
+		}
+	}
+	if _, err := fetchProbeIP(func() ([]byte, error) { return nil, errors.New("timed out") }); err == nil {
+		t.Error("a failed fetch returned an IP")
+	}
+}
+
+func TestKillSwitchLeak(t *testing.T) {
+	for _, tt := range []struct {
+		ip, host, exit string
+		leak           bool
+	}{
+		{"203.0.113.7", "203.0.113.7", "198.51.100.2", true},
+		{"198.51.100.9", "203.0.113.7", "198.51.100.2", false}, // another Proton exit
+		{"203.0.113.7", "", "198.51.100.2", true},
+		{"198.51.100.2", "", "198.51.100.2", false},
+	} {
+		if got := isLeak(tt.ip, tt.host, tt.exit); got != tt.leak {
+			t.Errorf("isLeak(%s, host %q, exit %s) = %v, want %v", tt.ip, tt.host, tt.exit, got, tt.leak)
+		}
+	}
+	if !probeUnavailable(errors.New(`exec: "wget": executable file not found in $PATH`)) {
+		t.Error("a missing wget counted as a blocked probe")
+	}
+}
+
+func TestKillSwitchProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.killSwitchCheck = true
+	if p := killSwitchProblems(); len(p) != 1 {
+		t.Errorf("no containers: got %v", p)
+	}
+	cfg.killSwitchContainers = []string{"qbittorrent"}
+	cfg.killSwitchProbeURL = "1.1.1.1"
+	if p := killSwitchProblems(); len(p) != 1 {
+		t.Errorf("bad URL: got %v", p)
+	}
+	cfg.killSwitchProbeURL = "http://1.1.1.1/cdn-cgi/trace"
+	if p := killSwitchProblems(); len(p) != 0 {
+		t.Errorf("valid settings: got %v", p)
+	}
+}
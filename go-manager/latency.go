@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// sampleRTT times the tunnel's round trip after a passing health check and
+// requests a switch once MAX_RTT_SAMPLES samples in a row exceed MAX_RTT_MS.
+// Checkers that can't measure RTT are skipped.
+func (d *daemon) sampleRTT() {
+	if d.cfg.maxRTTMs <= 0 {
+		return
+	}
+	r, ok := d.checker.(health.RTTer)
+	if !ok {
+		return
+	}
+	rtt, err := r.RTT()
+	if err != nil {
+		log(fmt.Sprintf("RTT sample failed: %v", err))
+		return
+	}
+	d.updateStatus(func(s *Status) { s.RTTMs = int(rtt.Milliseconds()) })
+
+	d.mu.Lock()
+	if rtt <= time.Duration(d.cfg.maxRTTMs)*time.Millisecond {
+		d.slowRTTs = nil
+		d.mu.Unlock()
+		return
+	}
+	d.slowRTTs = append(d.slowRTTs, rtt)
+	if len(d.slowRTTs) < d.cfg.maxRTTSamples {
+		d.mu.Unlock()
+		return
+	}
+	var sum time.Duration
+	for _, s := range d.slowRTTs {
+		sum += s
+	}
+	avg := sum / time.Duration(len(d.slowRTTs))
+	d.slowRTTs = nil
+	d.mu.Unlock()
+
+	reason := fmt.Sprintf("Latency SLO Exceeded (%dms > %dms over %d samples)", avg.Milliseconds(), d.cfg.maxRTTMs, d.cfg.maxRTTSamples)
+	log(reason)
+	d.requestFailover(reason)
+}
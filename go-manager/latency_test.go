@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowTunnelTriggersSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.maxRTTMs, cfg.maxRTTSamples = 100, 3
+	ms := time.Millisecond
+	checker := newMockHealth(t, true)
+	checker.rtts = []time.Duration{150 * ms, 40 * ms, 150 * ms, 200 * ms, 250 * ms}
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), checker)
+
+	// The fast second sample resets the run
+	for range 4 {
+		d.sampleRTT()
+	}
+	if reason := d.takeFailoverReason(); reason != "" {
+		t.Fatalf("switch requested after an interrupted run: %q", reason)
+	}
+
+	d.sampleRTT()
+	want := "Latency SLO Exceeded (200ms > 100ms over 3 samples)"
+	if reason := d.takeFailoverReason(); reason != want {
+		t.Errorf("failover reason %q, want %q", reason, want)
+	}
+	if switchTrigger(false, want, want) != triggerLatency {
+		t.Error("latency switch not audited as such")
+	}
+}
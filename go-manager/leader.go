@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"gluetun-proton-manager/controlapi"
+	"gluetun-proton-manager/runtime/kubernetes"
+)
+
+const (
+	leaderOff        = ""           // a single replica, no election
+	leaderFile       = "file"       // an exclusive lock on LEADER_LOCK_FILE
+	leaderKubernetes = "kubernetes" // a coordination.k8s.io Lease
+)
+
+// leaseRetryInterval is how often a standby checks whether the Lease is free.
+const leaseRetryInterval = 2 * time.Second
+
+// lockFile keeps the leader's lock open for the life of the process.
+var lockFile *os.File
+
+// becomeLeader blocks until this replica leads, so that only one replica
+// writes the env file and restarts gluetun. Meanwhile /healthz answers on
+// CONTROL_ADDR, so a standby isn't restarted for being idle. Losing the lead
+// exits the process; on SIGTERM the lead is handed over before exiting.
+//
+// Without leader election, the lock file still keeps a second manager that
+// was started by accident from interleaving env writes and restarts: it
+// exits instead of waiting.
+func becomeLeader() {
+	if cfg.leaderElection == leaderOff {
+		if !cfg.singleInstance {
+			return
+		}
+		_, err := lockLeaderFile(cfg.leaderLockFile, false)
+		var held *lockHeldError
+		switch {
+		case errors.As(err, &held):
+			log(fmt.Sprintf("Another manager is already running (%s holds %s). Stop it, or set LEADER_ELECTION=file to run this one as a standby.", held.holder, held.path))
+			os.Exit(exitFailure)
+		case err != nil:
+			log(fmt.Sprintf("Warning: cannot take the instance lock: %v", err))
+		}
+		return
+	}
+	stopStandby := serveStandby()
+	var lost <-chan struct{}
+	var release func()
+	var err error
+	switch cfg.leaderElection {
+	case leaderFile:
+		release, err = lockLeaderFile(cfg.leaderLockFile, true)
+	case leaderKubernetes:
+		lost, release, err = holdLease()
+	}
+	stopStandby()
+	if err != nil {
+		log(fmt.Sprintf("Leader election failed: %v", err))
+		os.Exit(exitFailure)
+	}
+	log(fmt.Sprintf("Leader: %s is active", cfg.leaderID))
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case sig := <-sigs:
+			log(fmt.Sprintf("Leader: %s received, stepping down", sig))
+			release()
+			os.Exit(0)
+		case <-lost:
+			log("Leader: lost the lead to another replica, exiting")
+			os.Exit(exitFailure)
+		}
+	}()
+}
+
+// lockHeldError reports a lock file held by another manager.
+type lockHeldError struct {
+	path, holder string
+}
+
+func (e *lockHeldError) Error() string {
+	return fmt.Sprintf("%s is locked by %s", e.path, e.holder)
+}
+
+// lockLeaderFile takes an exclusive lock on path and records leaderID in it.
+// With wait it blocks until the lock is free, which the kernel makes it the
+// moment the holder dies; without it, a held lock is an error naming the
+// holder.
+func lockLeaderFile(path string, wait bool) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %v", path, err)
+		}
+		holder, _ := os.ReadFile(path)
+		if !wait {
+			f.Close()
+			return nil, &lockHeldError{path: path, holder: strings.TrimSpace(string(holder))}
+		}
+		log(fmt.Sprintf("Standby: %s is locked by %s, waiting", path, strings.TrimSpace(string(holder))))
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %v", path, err)
+		}
+	}
+	// The holder is what a standby reports; a lock without it isn't taken
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("record holder in %s: %v", path, err)
+	}
+	if _, err := f.WriteAt([]byte(fmt.Sprintf("%s (pid %d)\n", cfg.leaderID, os.Getpid())), 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("record holder in %s: %v", path, err)
+	}
+	lockFile = f
+	return func() { f.Close() }, nil
+}
+
+// holdLease waits for the Lease to be free or expired, takes it and keeps
+// renewing it. lost is closed if a renewal fails for a whole lease duration
+// or another replica holds the Lease.
+func holdLease() (lost <-chan struct{}, release func(), err error) {
+	if kubeClient == nil {
+		return nil, nil, kubeClientErr
+	}
+	duration := time.Duration(cfg.leaderLeaseDuration) * time.Second
+	var lease *kubernetes.Lease
+	waiting := ""
+	for {
+		lease, err = kubeClient.Lease(cfg.leaderLeaseName)
+		if err == kubernetes.ErrNotFound {
+			lease, err = nil, nil
+		}
+		if err == nil && (lease == nil || lease.Spec.HolderIdentity == cfg.leaderID || lease.Expired(time.Now())) {
+			if lease, err = kubeClient.HoldLease(cfg.leaderLeaseName, lease, cfg.leaderID, duration, time.Now()); err == nil {
+				break
+			}
+		}
+		if err != nil && err != kubernetes.ErrConflict {
+			log(fmt.Sprintf("Leader election: lease %s: %v", cfg.leaderLeaseName, err))
+		} else if lease != nil && lease.Spec.HolderIdentity != waiting {
+			waiting = lease.Spec.HolderIdentity
+			log(fmt.Sprintf("Standby: lease %s is held by %s, waiting", cfg.leaderLeaseName, waiting))
+		}
+		time.Sleep(leaseRetryInterval)
+	}
+
+	done := make(chan struct{})
+	current := make(chan *kubernetes.Lease, 1)
+	current <- lease
+	go func() {
+		renewed := time.Now()
+		for range time.Tick(duration / 3) {
+			l := <-current
+			next, err := kubeClient.HoldLease(cfg.leaderLeaseName, l, cfg.leaderID, duration, time.Now())
+			switch {
+			case err == nil:
+				l, renewed = next, time.Now()
+			case err == kubernetes.ErrConflict:
+				// Someone else wrote the Lease; the next renewal starts from it
+				if fresh, err := kubeClient.Lease(cfg.leaderLeaseName); err == nil {
+					l = fresh
+				}
+			default:
+				log(fmt.Sprintf("Leader: cannot renew lease %s: %v", cfg.leaderLeaseName, err))
+			}
+			current <- l
+			if l.Spec.HolderIdentity != cfg.leaderID || time.Since(renewed) > duration {
+				close(done)
+				return
+			}
+		}
+	}()
+	release = func() {
+		l := <-current
+		if l.Spec.HolderIdentity != cfg.leaderID {
+			return
+		}
+		if err := kubeClient.ReleaseLease(cfg.leaderLeaseName, l); err != nil {
+			log(fmt.Sprintf("Leader: cannot release lease %s: %v", cfg.leaderLeaseName, err))
+		}
+	}
+	return done, release, nil
+}
+
+// serveStandby answers /healthz (alive) and /readyz (not ready) on
+// CONTROL_ADDR while this replica waits to lead. The returned function stops
+// it, freeing the address for the control API.
+func serveStandby() func() {
+	if cfg.controlAddr == "" {
+		return func() {}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "standby"})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, controlapi.Readiness{Session: "standby", Tunnel: "standby"})
+	})
+	srv := &http.Server{Addr: cfg.controlAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go listenControl(srv)
+	return func() { srv.Close() }
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLockLeaderFile(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	path := filepath.Join(t.TempDir(), ".proton-manager.lock")
+	cfg.leaderID = "manager-a"
+	release, err := lockLeaderFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second holder is turned away, told who has the lock
+	cfg.leaderID = "manager-b"
+	_, err = lockLeaderFile(path, false)
+	var held *lockHeldError
+	if !errors.As(err, &held) || !strings.HasPrefix(held.holder, "manager-a (pid ") {
+		t.Errorf("second lock = %v, want it held by manager-a", err)
+	}
+
+	release()
+	release, err = lockLeaderFile(path, false)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	release()
+}
+
+func TestLockLeaderFileUnwritable(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	// /dev/full can be locked but not written
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	if release, err := lockLeaderFile("/dev/full", false); err == nil {
+		release()
+		t.Error("took the lock without recording the holder")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// logPattern maps a class of gluetun log lines to a failure kind.
+type logPattern struct {
+	Kind        string
+	Description string
+	Re          *regexp.Regexp
+}
+
+var gluetunLogPatterns = []logPattern{
+	{"handshake", "WireGuard handshake timeouts", regexp.MustCompile(`(?i)handshake did not complete`)},
+	{"unhealthy", "gluetun healthcheck failures", regexp.MustCompile(`(?i)program has been unhealthy`)},
+	{"dns", "DNS failures", regexp.MustCompile(`(?i)\[dns\].*(timeout|timed out|no such host|servfail|refused)`)},
+	{"auth", "authentication errors", regexp.MustCompile(`(?i)auth_failed|authentication failed|invalid (private|public) key`)},
+}
+
+// logLoop follows the active gluetun's logs and requests a failover once any
+// failure kind matches logFailureThreshold times within logFailureWindow.
+func (d *daemon) logLoop() {
+	for {
+		container := activeGluetun()
+		if err := d.followLogs(container); err != nil {
+			log(fmt.Sprintf("Log monitor: %v", err))
+		}
+		// Logs end when gluetun is recreated; pick up the new container
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (d *daemon) followLogs(container string) error {
+	logs, err := docker.Logs(container)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	window := time.Duration(d.cfg.logFailureWindow) * time.Second
+	hits := make(map[string][]time.Time)
+
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Errors are expected while gluetun is being recreated
+		if d.getState() == stateSwitching {
+			clear(hits)
+			continue
+		}
+
+		for _, p := range gluetunLogPatterns {
+			if !p.Re.MatchString(line) {
+				continue
+			}
+			now := time.Now()
+			recent := hits[p.Kind][:0]
+			for _, t := range hits[p.Kind] {
+				if now.Sub(t) < window {
+					recent = append(recent, t)
+				}
+			}
+			hits[p.Kind] = append(recent, now)
+
+			if len(hits[p.Kind]) >= d.cfg.logFailureThreshold {
+				delete(hits, p.Kind)
+				reason := fmt.Sprintf("Gluetun Logs: %d %s in %s", d.cfg.logFailureThreshold, p.Description, window)
+				log(fmt.Sprintf("%s (last: %s)", reason, line))
+				if p.Kind == "handshake" {
+					d.requestPortRotation()
+				}
+				d.requestFailover(reason)
+			}
+			break
+		}
+	}
+	return scanner.Err()
+}
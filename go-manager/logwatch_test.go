@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGluetunLogPatterns(t *testing.T) {
+	for line, want := range map[string]string{
+		"2026-10-16T08:00:00Z INFO [wireguard] Handshake did not complete after 5 seconds, retrying":      "handshake",
+		"2026-10-16T08:00:00Z INFO [healthcheck] program has been unhealthy for 36s: restarting VPN":      "unhealthy",
+		"2026-10-16T08:00:00Z WARN [dns] exchanging over dot connection: read tcp: i/o timeout":           "dns",
+		"2026-10-16T08:00:00Z ERROR [dns] lookup github.com: no such host":                                "dns",
+		"2026-10-16T08:00:00Z WARN [dns] SERVFAIL for example.com":                                        "dns",
+		"2026-10-16T08:00:00Z ERROR [openvpn] AUTH: Received control message: AUTH_FAILED":                "auth",
+		"2026-10-16T08:00:00Z ERROR [wireguard] invalid private key: key must be 32 bytes":                "auth",
+		"2026-10-16T08:00:00Z INFO [ip getter] Public IP address is 203.0.113.7 (Switzerland, Zurich)":    "",
+		"2026-10-16T08:00:00Z INFO [dns] ready and using DNS server at address 127.0.0.1":                 "",
+		"2026-10-16T08:00:00Z INFO [healthcheck] healthy!":                                                "",
+		"2026-10-16T08:00:00Z WARN [http server] request timeout from 172.18.0.3, not a resolver problem": "",
+	} {
+		got := ""
+		for _, p := range gluetunLogPatterns {
+			if p.Re.MatchString(line) {
+				got = p.Kind
+				break
+			}
+		}
+		if got != want {
+			t.Errorf("%q matched %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestFollowLogs(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.logFailureThreshold, cfg.logFailureWindow = 3, 120
+	var logs string
+	useFakeEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/gluetun/json":
+			w.Write([]byte(`{"Id":"g1","Config":{"Tty":true}}`))
+		case "/containers/gluetun/logs":
+			w.Write([]byte(logs))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	handshake := "INFO [wireguard] Handshake did not complete after 5 seconds, retrying\n"
+	dns := "WARN [dns] lookup github.com: i/o timeout\n"
+
+	for _, tc := range []struct {
+		name, logs string
+		reason     string
+		rotate     bool
+	}{
+		{"below threshold", handshake + dns + handshake, "", false},
+		{"handshakes", strings.Repeat(handshake, 3), "Gluetun Logs: 3 WireGuard handshake timeouts in 2m0s", true},
+		{"dns", dns + handshake + dns + dns, "Gluetun Logs: 3 DNS failures in 2m0s", false},
+	} {
+		logs = tc.logs
+		d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+		if err := d.followLogs("gluetun"); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if reason := d.takeFailoverReason(); reason != tc.reason {
+			t.Errorf("%s: failover reason = %q, want %q", tc.name, reason, tc.reason)
+		}
+		if rotate := d.takeHandshakeFailed(); rotate != tc.rotate {
+			t.Errorf("%s: port rotation requested = %v", tc.name, rotate)
+		}
+	}
+
+	// Errors while switching are expected and not counted
+	logs = strings.Repeat(handshake, 3)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	d.setState(stateSwitching)
+	d.followLogs("gluetun")
+	if reason := d.takeFailoverReason(); reason != "" {
+		t.Errorf("failover requested while switching: %q", reason)
+	}
+}
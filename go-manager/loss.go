@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"gluetun-proton-manager/health"
+)
+
+// lossSample is one burst of probes.
+type lossSample struct {
+	sent, received int
+}
+
+// sampleLoss sends a burst of probes after a passing health check and
+// requests a switch when the loss over the last MAX_PACKET_LOSS_WINDOW bursts
+// exceeds MAX_PACKET_LOSS_PCT. A link answering one probe in three passes
+// the health check but is barely usable. Checkers that can't count lost
+// packets are skipped.
+func (d *daemon) sampleLoss() {
+	if d.cfg.maxLossPct <= 0 {
+		return
+	}
+	m, ok := d.checker.(health.LossMeter)
+	if !ok {
+		return
+	}
+	sent, received, err := m.Loss()
+	if err != nil || sent == 0 {
+		if err != nil {
+			log(fmt.Sprintf("Packet loss sample failed: %v", err))
+		}
+		return
+	}
+
+	d.mu.Lock()
+	d.lossWindow = append(d.lossWindow, lossSample{sent, received})
+	if len(d.lossWindow) > d.cfg.lossWindow {
+		d.lossWindow = d.lossWindow[len(d.lossWindow)-d.cfg.lossWindow:]
+	}
+	var total, lost int
+	for _, s := range d.lossWindow {
+		total += s.sent
+		lost += s.sent - s.received
+	}
+	full := len(d.lossWindow) == d.cfg.lossWindow
+	pct := 100 * lost / total
+	if full && pct > d.cfg.maxLossPct {
+		d.lossWindow = nil
+	}
+	d.mu.Unlock()
+
+	d.updateStatus(func(s *Status) { s.PacketLossPct = pct })
+	if !full || pct <= d.cfg.maxLossPct {
+		return
+	}
+	reason := fmt.Sprintf("Packet Loss (%d%% > %d%% over %d probes)", pct, d.cfg.maxLossPct, total)
+	log(reason)
+	d.requestFailover(reason)
+}
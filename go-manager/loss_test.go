@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestPacketLossTriggersSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.maxLossPct, cfg.lossWindow = 20, 3
+	checker := newMockHealth(t, true)
+	checker.replies = []int{5, 4, 5, 3, 2}
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), checker)
+
+	// 0%, 10%, 6%, then exactly 20% over the last three bursts
+	for range 4 {
+		d.sampleLoss()
+		if reason := d.takeFailoverReason(); reason != "" {
+			t.Fatalf("switch requested at %d%% loss: %q", d.status.PacketLossPct, reason)
+		}
+	}
+
+	// 5+3+2 of 15 answered
+	d.sampleLoss()
+	want := "Packet Loss (33% > 20% over 15 probes)"
+	if reason := d.takeFailoverReason(); reason != want {
+		t.Errorf("failover reason %q, want %q", reason, want)
+	}
+	if len(d.lossWindow) != 0 {
+		t.Error("window not cleared after triggering")
+	}
+}
@@ -3,16 +3,26 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtonMail/go-proton-api"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/retry"
+	"gluetun-proton-manager/runtime/docker"
+	"gluetun-proton-manager/runtime/kubernetes"
+	"gluetun-proton-manager/selector"
 )
 
 // Constants
@@ -20,64 +30,323 @@ const (
 	defaultCheckInt     = 300
 	defaultHealthInt    = 60
 	defaultLoadCheckInt = 900
-	pingTarget          = "8.8.8.8"
-	apiBaseURL          = "https://api.protonmail.ch"
+	defaultReconcileInt = 600
+	defaultQuarantineN  = 3
+	defaultQuarantineWn = 3600
+	defaultQuarantineD  = 3600
+	defaultPingTarget   = "8.8.8.8"
+	defaultAPIURL       = "https://api.protonmail.ch"
 )
 
-// Configuration
-var (
-	targetCities       []string
-	targetCountry      string
-	sessionFile        string
-	logDir             string
-	cacheDir           string
-	protonUser         string
-	protonPass         string
-	checkInterval      int
+// config holds the settings read from the environment at startup. The
+// daemon gets it through daemonDeps; everything else reads cfg, the one in
+// use, which profiles also update.
+type config struct {
+	targetCities  []string
+	targetCountry string
+	// targetTiers are tried in order; the first with an available server
+	// wins. targetFallback allows any active server once all are exhausted.
+	targetTiers         []selector.Tier
+	targetFallback      bool
+	sessionFile         string
+	stateFile           string
+	logDir              string
+	auditLog            bool
+	dnsblZones          []string
+	canaries            []canary
+	canaryMaxAttempts   int
+	maxRTTMs            int
+	maxRTTSamples       int
+	maxLossPct          int
+	controlAddr         string
+	controlURL          string
+	controlSocket       string // empty disables the socket
+	controlToken        string
+	controlUsername     string
+	controlPassword     string
+	triggerToken        string // external failover webhook, see trigger.go
+	triggerCooldown     int
+	controlTLS          bool
+	controlTLSCert      string
+	controlTLSKey       string
+	controlDebug        bool
+	lossWindow          int
+	dnsblRotateOn       []string // nil rotates on every zone
+	cacheDir            string
+	envBackupCount      int
+	checkInterval       int
 	healthCheckInterval int
-	loadCheckInterval  int
+	loadCheckInterval   int
+	loadThreshold       int
+	reconcileInterval   int
+	envChangePolicy     string
+	healthMinInterval   int
+	healthMaxInterval   int
+	healthRelaxAfter    int
+	healthMode          string
+	healthProxyURL      string
+	healthProbeURL      string
+	quarantineThreshold int
+	quarantineWindow    int
+	quarantineDuration  int
+	reliabilityWeight   int
+	avoidLastN          int
+	avoidRecentHours    int
+	forecastWeight      int
+	forecastHours       int
+	selectionTopK       int
+	selectionLoadBand   int
+	selectionFilter     *selector.Expr // SELECTION_FILTER, see targets.go
+	selectionScore      *selector.Expr // SELECTION_SCORE
+	preferredServers    []string
+	preferredMaxLoad    int
+	requiredFeatures    int
+	throughputProbeURL  string
+
+	// Custom health probes, see probe.go
+	pingTargets     []string
+	healthCmd       string
+	healthURL       string
+	healthURLStatus int
+	healthURLBody   string
+
+	// Server selection
+	geoLocation         string
+	autoRadius          int
+	excludeVirtual      bool
+	targetExitCountries []string
+	endpointProbe       bool
+	endpointDeadFor     int
+
+	// API reachability
+	apiBaseURL  string
+	altRouting  bool
+	apiProxyURL string
+
+	// Retry policies: one Proton API request, one container operation, one
+	// alert delivery (and MQTT reconnects)
+	apiRetry    retry.Policy
+	dockerRetry retry.Policy
+	notifyRetry retry.Policy
+
+	// Accounts
+	accountRotationInterval int
+	tokenLifetime           int
+	tokenRefreshAhead       int
+
+	// Secrets
+	secretBackend   string
+	secretDir       string
+	vaultAddr       string
+	vaultSecretPath string
+
+	// Human verification
+	hvRetryInterval int
+	hvTokenFile     string
+
+	// integrations are the applications configured with their *_URL
+	// settings, see integrations.go
+	integrations []integration
+
+	// Forwarded port publishing, see portfile.go
+	forwardedPortFile    string
+	forwardedPortEnvFile string
+	forwardedPortVar     string
+
+	// Dynamic DNS, see ddns.go
+	ddnsProvider string
+	ddnsHostname string
+	ddnsZoneID   string
+	ddnsToken    string
+	ddnsURL      string
+
+	// Remote allowlists, see allowlist.go
+	allowlistCommand       string
+	allowlistURL           string
+	allowlistMethod        string
+	allowlistBody          string
+	allowlistContentType   string
+	allowlistAuthorization string
+
+	// How servers are written to gluetun, see provider.go
+	updateStrategy    string
+	providerSelection string
+
+	// gluetun's server list kept in sync, see serversjson.go
+	serversJSONPath string
+
+	// Scheduled connectivity reports, see report.go
+	reportSchedule string
+	reportMinute   int
+
+	// Muted notifications, see quiethours.go
+	quietHours []quietRange
+	quietAllow []string
+
+	// Switching before the first regular load check, see startup.go
+	switchOnStart string
+
+	// Time on a server before optimizing it away, see connectionage.go
+	minConnectionAge int
+
+	// Deferring switches while the tunnel is busy, see traffic.go
+	busyThresholdMbps int
+	busyWindow        int
+
+	// External selection program, see selectorplugin.go
+	selectorPlugin        string
+	selectorPluginTimeout int
+
+	// Sandboxed selection and health plugins, see wasmplugins.go
+	pluginDir          string
+	wasmPluginTimeout  int
+	wasmPluginMemoryMB int
+
+	// Control server credentials, see gluetunauth.go
+	gluetunControlAPIKey   string
+	gluetunControlUser     string
+	gluetunControlPassword string
+
+	// gluetunVersionSetting overrides the detected gluetun version, see
+	// gluetunversion.go
+	gluetunVersionSetting string
+
+	// Gluetun's proxies, see proxies.go
+	gluetunHTTPProxy           string
+	gluetunHTTPProxyPort       int
+	gluetunHTTPProxyUser       string
+	gluetunHTTPProxyPassword   string
+	gluetunShadowsocks         string
+	gluetunShadowsocksPort     int
+	gluetunShadowsocksPassword string
+	gluetunShadowsocksCipher   string
+	proxyCheckHost             string
+
+	// Kill switch verification, see killswitch.go
+	killSwitchCheck      bool
+	killSwitchContainers []string
+	killSwitchProbeURL   string
+
+	// IPv6 support, see ipv6.go
+	ipv6Mode         string
+	ipv6PingTarget   string
+	ipv6PreferWeight int
+
+	// WireGuard ports in fallback order, see wgports.go
+	wireguardPorts []string
+
+	// MTU_PROBE sets WIREGUARD_MTU from the path MTU to each new endpoint,
+	// up to WIREGUARD_MTU_MAX
+	mtuProbe        bool
+	wireguardMTUMax int
+
+	// Protocol fallback
+	protocolFallback      bool
+	protocolFallbackAfter int
+	protocolRetryInterval int
 
 	// Docker Configuration
-	gluetunService   string
-	gluetunContainer string
-	envFile          string
-)
-
-// VPN Server Structs (matching Proton API JSON)
-type LogicalServer struct {
-	ID           string   `json:"ID"`
-	Name         string   `json:"Name"`
-	EntryCountry string   `json:"EntryCountry"`
-	ExitCountry  string   `json:"ExitCountry"`
-	Domain       string   `json:"Domain"`
-	Tier         int      `json:"Tier"`
-	Features     int      `json:"Features"`
-	Status       int      `json:"Status"` // 1 = Active
-	Load         int      `json:"Load"`
-	Score        float64  `json:"Score"`
-	City         string   `json:"City"`
-	Servers      []Server `json:"Servers"`
+	gluetunControlURL string
+	restartTimeout    int
+	gluetunService    string
+	gluetunContainer  string
+	gluetunLabel      string
+	envFile           string
+	envFileFormat     string
+	dockerAPI         bool
+	composeProject    string
+	composeProjectDir string
+	composeFiles      []string
+
+	// Nomad
+	runtimeBackend string
+	nomadAddr      string
+	nomadToken     string
+	nomadNamespace string
+	nomadJob       string
+	nomadGroup     string
+	nomadTask      string
+	nomadVarsPath  string
+
+	// Kubernetes operator
+	kubeTunnel    string
+	kubeNamespace string
+
+	// Leader election
+	leaderElection      string
+	singleInstance      bool
+	leaderID            string
+	leaderLockFile      string
+	leaderLeaseName     string
+	leaderLeaseDuration int
+
+	// Blue/green switching
+	switchMode      string
+	bgNetwork       string
+	bgAlias         string
+	bgVerifyTimeout int
+	bgSlots         []gluetunSlot
+
+	// Dependent containers
+	dependents      []dependent
+	dependentAction string
+
+	// MQTT / Home Assistant
+	mqttBroker          string
+	mqttUsername        string
+	mqttPassword        string
+	mqttNodeID          string
+	mqttTopicPrefix     string
+	mqttDiscoveryPrefix string
+
+	// Alerting
+	smtpHost            string
+	smtpPort            int
+	smtpUsername        string
+	smtpPassword        string
+	smtpFrom            string
+	smtpTo              []string
+	notifyCooldown      int
+	notifyCooldowns     map[alertKind]time.Duration
+	alertUnhealthyAfter int
+	alertSwitchFailures int
+
+	// Gluetun log monitoring
+	logMonitor          bool
+	logFailureThreshold int
+	logFailureWindow    int
 }
 
-type Server struct {
-	EntryIP         string `json:"EntryIP"`
-	ExitIP          string `json:"ExitIP"`
-	Domain          string `json:"Domain"`
-	ID              string `json:"ID"`
-	Status          int    `json:"Status"`
-	X25519PublicKey string `json:"X25519PublicKey"` // WireGuard Key
-}
+var cfg = &config{}
 
-type LogicalServersResponse struct {
-	Code           int             `json:"Code"`
-	LogicalServers []LogicalServer `json:"LogicalServers"`
-}
+// Configuration errors, reported at startup, and the Kubernetes client
+var (
+	canariesErr         error
+	controlAuthErr      error
+	selectionExprErr    error
+	requiredFeaturesErr error
+	retryErr            error
+	quietHoursErr       error
+	notifyCooldownsErr  error
+	dockerAPIErr        error
+	kubeClient          *kubernetes.Client
+	kubeClientErr       error
+)
+
+// VPN server types, shared with the protonapi package
+type (
+	LogicalServer          = protonapi.LogicalServer
+	Location               = protonapi.Location
+	Server                 = protonapi.Server
+	LogicalServersResponse = protonapi.LogicalServersResponse
+)
 
 // Session Data to persist to disk
 type SessionData struct {
-	UID          string `json:"uid"`
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	UID          string    `json:"uid"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	IssuedAt     time.Time `json:"issued_at,omitzero"`
 }
 
 func init() {
@@ -86,23 +355,280 @@ func init() {
 	if citiesEnv == "" {
 		citiesEnv = "San Jose"
 	}
-	targetCities = strings.Split(citiesEnv, ",")
+	cfg.targetCities = strings.Split(citiesEnv, ",")
+
+	cfg.targetCountry = os.Getenv("TARGET_COUNTRY")
+	countriesEnv := os.Getenv("TARGET_COUNTRIES")
+	regionsEnv := os.Getenv("TARGET_REGION")
+	autoTarget := strings.EqualFold(os.Getenv("TARGET"), "auto")
+	cfg.targetTiers, targetTiersErr = selector.ParseTargets(countriesEnv, regionsEnv, autoTarget, cfg.targetCountry, cfg.targetCities)
+	cfg.targetFallback = getEnvBool("TARGET_FALLBACK", countriesEnv != "" || regionsEnv != "" || autoTarget)
+	cfg.geoLocation = os.Getenv("GEO_LOCATION")
+	cfg.autoRadius = getEnvInt("AUTO_RADIUS_KM", 300)
+	cfg.excludeVirtual = getEnvBool("EXCLUDE_VIRTUAL_SERVERS", false)
+	cfg.endpointProbe = getEnvBool("ENDPOINT_PROBE", true)
+	cfg.endpointDeadFor = getEnvInt("ENDPOINT_DEAD_DURATION", 3600)
+	cfg.apiBaseURL = strings.TrimRight(getEnv("PROTON_API_URL", defaultAPIURL), "/")
+	cfg.altRouting = getEnvBool("ALT_ROUTING", true)
+	cfg.apiProxyURL = os.Getenv("API_PROXY_URL")
+	cfg.tokenLifetime = getEnvInt("TOKEN_LIFETIME", 86400)
+	cfg.tokenRefreshAhead = getEnvInt("TOKEN_REFRESH_AHEAD", 1800)
+	cfg.apiRetry = retrySetting("API_RETRY", retry.Policy{
+		Attempts: 3, Base: 2 * time.Second, Max: 30 * time.Second, Jitter: 0.2,
+		Retryable: apiRetryable, MinDelay: retryAfter,
+	})
+	cfg.dockerRetry = retrySetting("DOCKER_RETRY", retry.Policy{
+		Attempts: 3, Base: 5 * time.Second, Max: 30 * time.Second, Jitter: 0.2,
+		Retryable: dockerRetryable,
+	})
+	cfg.notifyRetry = retrySetting("NOTIFY_RETRY", retry.Policy{
+		Attempts: 3, Base: 10 * time.Second, Max: 5 * time.Minute, Jitter: 0.2,
+		Retryable: notifyRetryable,
+	})
+	cfg.protocolFallback = getEnvBool("PROTOCOL_FALLBACK", false)
+	cfg.protocolFallbackAfter = getEnvInt("PROTOCOL_FALLBACK_AFTER", 3)
+	cfg.protocolRetryInterval = getEnvInt("PROTOCOL_RETRY_INTERVAL", 3600)
+	cfg.wireguardPorts = parseWireguardPorts(getEnv("WIREGUARD_PORTS", "51820,88,1224,4569,5060,80"))
+	cfg.wireguardPorts = preferWireguardPort(cfg.wireguardPorts, os.Getenv("WIREGUARD_ENDPOINT_PORT"))
+	cfg.mtuProbe = getEnvBool("MTU_PROBE", false)
+	cfg.ipv6Mode = strings.ToLower(getEnv("IPV6", ipv6Off))
+	cfg.ipv6PingTarget = getEnv("IPV6_PING_TARGET", "2606:4700:4700::1111")
+	cfg.ipv6PreferWeight = getEnvInt("IPV6_PREFER_WEIGHT", 25)
+	cfg.wireguardMTUMax = getEnvInt("WIREGUARD_MTU_MAX", 1420)
+	for _, code := range strings.Split(os.Getenv("TARGET_EXIT_COUNTRY"), ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			cfg.targetExitCountries = append(cfg.targetExitCountries, strings.ToUpper(code))
+		}
+	}
+	for _, name := range strings.Split(os.Getenv("PREFERRED_SERVERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			cfg.preferredServers = append(cfg.preferredServers, strings.ToUpper(name))
+		}
+	}
+	cfg.preferredMaxLoad = getEnvInt("PREFERRED_MAX_LOAD", 80)
+	cfg.requiredFeatures, requiredFeaturesErr = protonapi.ParseFeatures(os.Getenv("REQUIRED_FEATURES"))
+	cfg.sessionFile = getEnv("SESSION_FILE", "/data/proton_session.json")
+	cfg.stateFile = getEnv("STATE_FILE", getDir(cfg.sessionFile)+"/proton_state.json")
+	cfg.hvRetryInterval = getEnvInt("HV_RETRY_INTERVAL", 600)
+	cfg.hvTokenFile = getEnv("HV_TOKEN_FILE", getDir(cfg.sessionFile)+"/proton_hv_token")
+	cfg.logDir = getEnv("LOG_DIR", "/tmp/proton_sidecar/logs")
+	cfg.auditLog = getEnvBool("AUDIT_LOG", true)
+	cfg.canaries, canariesErr = parseCanaries(os.Getenv("CANARY_URLS"))
+	cfg.canaryMaxAttempts = getEnvInt("CANARY_MAX_ATTEMPTS", 3)
+	cfg.maxRTTMs = getEnvInt("MAX_RTT_MS", 0)
+	cfg.maxRTTSamples = getEnvInt("MAX_RTT_SAMPLES", 3)
+	cfg.maxLossPct = getEnvInt("MAX_PACKET_LOSS_PCT", 0)
+	cfg.controlAddr = os.Getenv("CONTROL_ADDR")
+	cfg.controlURL = os.Getenv("CONTROL_URL")
+	if cfg.controlSocket = getEnv("CONTROL_SOCKET", getDir(cfg.sessionFile)+"/manager.sock"); strings.EqualFold(cfg.controlSocket, "off") {
+		cfg.controlSocket = ""
+	}
+	cfg.controlToken, controlAuthErr = readTokenEnv("CONTROL_TOKEN")
+	cfg.controlUsername = os.Getenv("CONTROL_USERNAME")
+	if password, err := readTokenEnv("CONTROL_PASSWORD"); err != nil {
+		controlAuthErr = err
+	} else {
+		cfg.controlPassword = password
+	}
+	if token, err := readTokenEnv("TRIGGER_TOKEN"); err != nil {
+		controlAuthErr = err
+	} else {
+		cfg.triggerToken = token
+	}
+	cfg.triggerCooldown = getEnvInt("TRIGGER_COOLDOWN", 300)
+	cfg.controlTLSCert, cfg.controlTLSKey = os.Getenv("CONTROL_TLS_CERT"), os.Getenv("CONTROL_TLS_KEY")
+	cfg.controlTLS = getEnvBool("CONTROL_TLS", cfg.controlTLSCert != "")
+	cfg.controlDebug = getEnvBool("CONTROL_DEBUG", false)
+	cfg.lossWindow = getEnvInt("PACKET_LOSS_WINDOW", 6)
+	cfg.dnsblZones = splitList(os.Getenv("DNSBL_ZONES"))
+	switch v := strings.TrimSpace(os.Getenv("DNSBL_ROTATE_ON")); strings.ToLower(v) {
+	case "", "all":
+	case "none":
+		cfg.dnsblRotateOn = []string{}
+	default:
+		cfg.dnsblRotateOn = splitList(v)
+	}
+	cfg.cacheDir = getEnv("CACHE_DIR", "/tmp/proton_sidecar/cache")
+	cfg.envBackupCount = getEnvInt("ENV_BACKUP_COUNT", 10)
+	cfg.secretBackend = strings.ToLower(getEnv("SECRET_BACKEND", secretBackendEnv))
+	cfg.secretDir = getEnv("SECRET_DIR", getDir(cfg.sessionFile)+"/secrets")
+	cfg.vaultAddr = os.Getenv("VAULT_ADDR")
+	cfg.vaultSecretPath = getEnv("VAULT_SECRET_PATH", "secret/gluetun-proton-manager")
+	secrets, secretsErr = newSecretStore(cfg.secretBackend)
+	accounts = parseAccounts()
+	cfg.integrations = parseIntegrations()
+	cfg.ddnsProvider = strings.ToLower(os.Getenv("DDNS_PROVIDER"))
+	cfg.ddnsHostname = os.Getenv("DDNS_HOSTNAME")
+	cfg.ddnsZoneID = os.Getenv("DDNS_ZONE_ID")
+	cfg.ddnsToken = credential("DDNS_TOKEN")
+	cfg.ddnsURL = os.Getenv("DDNS_URL")
+	cfg.gluetunVersionSetting = os.Getenv("GLUETUN_VERSION")
+	cfg.updateStrategy = strings.ToLower(getEnv("UPDATE_STRATEGY", strategyEndpoint))
+	cfg.providerSelection = strings.ToLower(getEnv("PROVIDER_SELECTION", providerByHostname))
+	cfg.serversJSONPath = os.Getenv("SERVERS_JSON_PATH")
+	cfg.reportSchedule = strings.ToLower(os.Getenv("REPORT_SCHEDULE"))
+	cfg.reportMinute = -1
+	if t, err := time.Parse("15:04", getEnv("REPORT_TIME", "08:00")); err == nil {
+		cfg.reportMinute = t.Hour()*60 + t.Minute()
+	}
+	cfg.quietHours, quietHoursErr = parseQuietHours(os.Getenv("QUIET_HOURS"))
+	cfg.quietAllow = splitList(getEnv("QUIET_HOURS_ALLOW", defaultQuietAllow))
+	cfg.switchOnStart = strings.ToLower(getEnv("SWITCH_ON_START", switchOnStartIfUnhealthy))
+	cfg.minConnectionAge = getEnvInt("MIN_CONNECTION_AGE", 0)
+	cfg.busyThresholdMbps = getEnvInt("BUSY_THRESHOLD_MBPS", 0)
+	cfg.busyWindow = getEnvInt("BUSY_WINDOW", 120)
+	cfg.selectorPlugin = os.Getenv("SELECTOR_PLUGIN")
+	cfg.selectorPluginTimeout = getEnvInt("SELECTOR_PLUGIN_TIMEOUT", 10)
+	cfg.pluginDir = getEnv("PLUGIN_DIR", "/data/plugins")
+	cfg.wasmPluginTimeout = getEnvInt("WASM_PLUGIN_TIMEOUT", 5)
+	cfg.wasmPluginMemoryMB = getEnvInt("WASM_PLUGIN_MEMORY_MB", 64)
+	cfg.gluetunHTTPProxy = strings.ToLower(os.Getenv("GLUETUN_HTTPPROXY"))
+	cfg.gluetunHTTPProxyPort = getEnvInt("GLUETUN_HTTPPROXY_PORT", 8888)
+	cfg.gluetunHTTPProxyUser = os.Getenv("GLUETUN_HTTPPROXY_USER")
+	cfg.gluetunHTTPProxyPassword = credential("GLUETUN_HTTPPROXY_PASSWORD")
+	cfg.gluetunShadowsocks = strings.ToLower(os.Getenv("GLUETUN_SHADOWSOCKS"))
+	cfg.gluetunShadowsocksPort = getEnvInt("GLUETUN_SHADOWSOCKS_PORT", 8388)
+	cfg.gluetunShadowsocksPassword = credential("GLUETUN_SHADOWSOCKS_PASSWORD")
+	cfg.gluetunShadowsocksCipher = strings.ToLower(os.Getenv("GLUETUN_SHADOWSOCKS_CIPHER"))
+	cfg.proxyCheckHost = os.Getenv("PROXY_CHECK_HOST")
+	cfg.allowlistCommand = os.Getenv("ALLOWLIST_COMMAND")
+	cfg.allowlistURL = os.Getenv("ALLOWLIST_URL")
+	cfg.allowlistMethod = strings.ToUpper(getEnv("ALLOWLIST_METHOD", "POST"))
+	cfg.allowlistBody = os.Getenv("ALLOWLIST_BODY")
+	cfg.allowlistContentType = getEnv("ALLOWLIST_CONTENT_TYPE", "application/json")
+	cfg.allowlistAuthorization = credential("ALLOWLIST_AUTHORIZATION")
+	cfg.accountRotationInterval = getEnvInt("ACCOUNT_ROTATION_INTERVAL", 0)
+
+	cfg.checkInterval = getEnvInt("CHECK_INTERVAL", defaultCheckInt)
+	cfg.healthCheckInterval = getEnvInt("HEALTH_CHECK_INTERVAL", defaultHealthInt)
+	cfg.loadCheckInterval = getEnvInt("LOAD_CHECK_INTERVAL", defaultLoadCheckInt)
+	cfg.loadThreshold = getEnvInt("LOAD_SWITCH_THRESHOLD", 20)
+	cfg.reconcileInterval = getEnvInt("RECONCILE_INTERVAL", defaultReconcileInt)
+	cfg.healthMinInterval = getEnvInt("HEALTH_CHECK_MIN_INTERVAL", max(cfg.healthCheckInterval/4, 5))
+	cfg.healthMaxInterval = getEnvInt("HEALTH_CHECK_MAX_INTERVAL", 4*cfg.healthCheckInterval)
+	cfg.healthRelaxAfter = getEnvInt("HEALTH_RELAX_AFTER", 5)
+	cfg.healthMode = strings.ToLower(getEnv("HEALTH_MODE", healthModeExec))
+	cfg.healthProxyURL = os.Getenv("HEALTH_PROXY_URL")
+	cfg.healthProbeURL = getEnv("HEALTH_PROBE_URL", "http://cp.cloudflare.com/generate_204")
+	cfg.pingTargets = splitList(getEnv("PING_TARGETS", defaultPingTarget))
+	cfg.healthCmd = os.Getenv("HEALTH_CMD")
+	cfg.healthURL = os.Getenv("HEALTH_URL")
+	cfg.healthURLStatus = getEnvInt("HEALTH_URL_STATUS", 0)
+	cfg.healthURLBody = os.Getenv("HEALTH_URL_BODY")
+	cfg.quarantineThreshold = getEnvInt("QUARANTINE_THRESHOLD", defaultQuarantineN)
+	cfg.quarantineWindow = getEnvInt("QUARANTINE_WINDOW", defaultQuarantineWn)
+	cfg.quarantineDuration = getEnvInt("QUARANTINE_DURATION", defaultQuarantineD)
+	cfg.reliabilityWeight = getEnvInt("RELIABILITY_WEIGHT", 30)
+	cfg.avoidLastN = getEnvInt("AVOID_LAST_N_SERVERS", 0)
+	cfg.avoidRecentHours = getEnvInt("AVOID_RECENT_HOURS", 0)
+	cfg.forecastWeight = getEnvInt("LOAD_FORECAST_WEIGHT", 50)
+	cfg.forecastHours = getEnvInt("LOAD_FORECAST_HOURS", 2)
+	cfg.selectionTopK = getEnvInt("SELECTION_TOP_K", 1)
+	cfg.selectionLoadBand = getEnvInt("SELECTION_LOAD_BAND", 10)
+	cfg.selectionFilter, cfg.selectionScore, selectionExprErr = compileSelectionExprs(os.Getenv("SELECTION_FILTER"), os.Getenv("SELECTION_SCORE"))
+	cfg.throughputProbeURL = os.Getenv("THROUGHPUT_PROBE_URL")
+	cfg.envChangePolicy = strings.ToLower(getEnv("ENV_CHANGE_POLICY", envPolicyAdopt))
 
-	targetCountry = os.Getenv("TARGET_COUNTRY")
-	sessionFile = getEnv("SESSION_FILE", "/data/proton_session.json")
-	logDir = getEnv("LOG_DIR", "/tmp/proton_sidecar/logs")
-	cacheDir = getEnv("CACHE_DIR", "/tmp/proton_sidecar/cache")
-	protonUser = os.Getenv("PROTON_USERNAME")
-	protonPass = os.Getenv("PROTON_PASSWORD")
+	// Docker Config
+	cfg.gluetunService = getEnv("GLUETUN_SERVICE_NAME", "gluetun")
+	cfg.gluetunContainer = getEnv("GLUETUN_CONTAINER_NAME", "gluetun")
+	cfg.gluetunLabel = os.Getenv("GLUETUN_LABEL")
+	cfg.envFileFormat = strings.ToLower(getEnv("ENV_FILE_FORMAT", envFormatEnv))
+	cfg.envFile = getEnv("ENV_FILE_PATH", "/project/.env")
+	cfg.gluetunControlURL = os.Getenv("GLUETUN_CONTROL_URL")
+	cfg.gluetunControlAPIKey = credential("GLUETUN_CONTROL_API_KEY")
+	cfg.gluetunControlUser = os.Getenv("GLUETUN_CONTROL_USER")
+	cfg.gluetunControlPassword = credential("GLUETUN_CONTROL_PASSWORD")
+	cfg.restartTimeout = getEnvInt("RESTART_TIMEOUT", 120)
+	cfg.composeProject = os.Getenv("COMPOSE_PROJECT_NAME")
+	cfg.composeProjectDir = getEnv("COMPOSE_PROJECT_DIR", "/project")
+	cfg.composeFiles = docker.ParseFiles(os.Getenv("COMPOSE_FILE"), cfg.composeProjectDir,
+		getEnv("COMPOSE_PATH_SEPARATOR", string(os.PathListSeparator)))
+	cfg.dockerAPI = getEnvBool("DOCKER_API", false)
+	if cfg.dockerAPI {
+		var client *docker.Client
+		if client, dockerAPIErr = newDockerClient(); dockerAPIErr == nil {
+			docker.UseAPI(client)
+		}
+	}
+	if cfg.envFileFormat == envFormatCompose && os.Getenv("ENV_FILE_PATH") == "" {
+		if files := composeProjectConfig().FindFiles(); len(files) > 0 {
+			cfg.envFile = files[0]
+		}
+	}
 
-	checkInterval = getEnvInt("CHECK_INTERVAL", defaultCheckInt)
-	healthCheckInterval = getEnvInt("HEALTH_CHECK_INTERVAL", defaultHealthInt)
-	loadCheckInterval = getEnvInt("LOAD_CHECK_INTERVAL", defaultLoadCheckInt)
+	cfg.runtimeBackend = strings.ToLower(getEnv("RUNTIME", runtimeDocker))
+	cfg.nomadAddr = getEnv("NOMAD_ADDR", "http://127.0.0.1:4646")
+	cfg.nomadToken = os.Getenv("NOMAD_TOKEN")
+	cfg.nomadNamespace = os.Getenv("NOMAD_NAMESPACE")
+	cfg.nomadJob = getEnv("NOMAD_JOB", "gluetun")
+	cfg.nomadGroup = os.Getenv("NOMAD_GROUP")
+	cfg.nomadTask = getEnv("NOMAD_TASK", "gluetun")
+	cfg.nomadVarsPath = os.Getenv("NOMAD_VARIABLES_PATH")
+	cfg.kubeTunnel = getEnv("KUBE_TUNNEL", "gluetun")
+	cfg.kubeNamespace = os.Getenv("KUBE_NAMESPACE")
+	cfg.leaderElection = strings.ToLower(os.Getenv("LEADER_ELECTION"))
+	cfg.singleInstance = getEnvBool("SINGLE_INSTANCE_LOCK", true)
+	hostname, _ := os.Hostname()
+	cfg.leaderID = getEnv("LEADER_ID", hostname)
+	cfg.leaderLockFile = getEnv("LEADER_LOCK_FILE", filepath.Join(filepath.Dir(cfg.envFile), ".proton-manager.lock"))
+	cfg.leaderLeaseName = getEnv("LEADER_LEASE_NAME", "proton-manager")
+	cfg.leaderLeaseDuration = getEnvInt("LEADER_LEASE_DURATION", 15)
+	if cfg.runtimeBackend == runtimeKubernetes || cfg.leaderElection == leaderKubernetes {
+		kubeClient, kubeClientErr = kubernetes.InCluster(cfg.kubeNamespace)
+	}
 
-	// Docker Config
-	gluetunService = getEnv("GLUETUN_SERVICE_NAME", "gluetun")
-	gluetunContainer = getEnv("GLUETUN_CONTAINER_NAME", "gluetun")
-	envFile = getEnv("ENV_FILE_PATH", "/project/.env")
+	cfg.switchMode = strings.ToLower(getEnv("SWITCH_MODE", switchModeRecreate))
+	cfg.bgSlots = parseBlueGreenSlots(
+		getEnv("BLUEGREEN_SERVICES", "gluetun-blue,gluetun-green"),
+		os.Getenv("BLUEGREEN_CONTAINERS"),
+	)
+	cfg.bgNetwork = os.Getenv("BLUEGREEN_NETWORK")
+	cfg.bgAlias = getEnv("BLUEGREEN_ALIAS", "vpn-gateway")
+	cfg.bgVerifyTimeout = getEnvInt("BLUEGREEN_VERIFY_TIMEOUT", 90)
+
+	cfg.dependents = parseDependents(os.Getenv("DEPENDENT_CONTAINERS"), getEnvInt("DEPENDENT_READY_TIMEOUT", 60))
+	cfg.dependentAction = strings.ToLower(getEnv("DEPENDENT_ACTION", dependentRecreate))
+	cfg.forwardedPortFile = os.Getenv("FORWARDED_PORT_FILE")
+	cfg.forwardedPortEnvFile = os.Getenv("FORWARDED_PORT_ENV_FILE")
+	cfg.forwardedPortVar = getEnv("FORWARDED_PORT_VAR", "FORWARDED_PORT")
+	cfg.killSwitchCheck = getEnvBool("KILLSWITCH_CHECK", false)
+	cfg.killSwitchContainers = nil
+	for _, dep := range parseDependents(getEnv("KILLSWITCH_CONTAINERS", os.Getenv("DEPENDENT_CONTAINERS")), 0) {
+		cfg.killSwitchContainers = append(cfg.killSwitchContainers, dep.Name)
+	}
+	cfg.killSwitchProbeURL = getEnv("KILLSWITCH_PROBE_URL", "http://1.1.1.1/cdn-cgi/trace")
+
+	cfg.mqttBroker = os.Getenv("MQTT_BROKER")
+	cfg.mqttUsername = os.Getenv("MQTT_USERNAME")
+	cfg.mqttPassword = credential("MQTT_PASSWORD")
+	cfg.mqttNodeID = getEnv("MQTT_NODE_ID", cfg.gluetunContainer)
+	cfg.mqttTopicPrefix = strings.TrimRight(getEnv("MQTT_TOPIC_PREFIX", "proton-sidecar/"+mqttNode()), "/")
+	cfg.mqttDiscoveryPrefix = getEnv("MQTT_DISCOVERY_PREFIX", "homeassistant")
+
+	cfg.smtpHost = os.Getenv("SMTP_HOST")
+	cfg.smtpPort = getEnvInt("SMTP_PORT", 587)
+	cfg.smtpUsername = os.Getenv("SMTP_USERNAME")
+	cfg.smtpPassword = credential("SMTP_PASSWORD")
+	cfg.smtpFrom = getEnv("SMTP_FROM", cfg.smtpUsername)
+	for _, to := range strings.Split(os.Getenv("SMTP_TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			cfg.smtpTo = append(cfg.smtpTo, to)
+		}
+	}
+	cfg.notifyCooldown = getEnvInt("NOTIFY_COOLDOWN", getEnvInt("SMTP_RATE_LIMIT", 3600))
+	cfg.notifyCooldowns, notifyCooldownsErr = parseCooldowns(os.Getenv("NOTIFY_COOLDOWNS"))
+	cfg.alertUnhealthyAfter = getEnvInt("ALERT_UNHEALTHY_AFTER", 600)
+	cfg.alertSwitchFailures = getEnvInt("ALERT_SWITCH_FAILURES", 3)
+
+	cfg.logMonitor = getEnvBool("LOG_MONITOR", true)
+	cfg.logFailureThreshold = getEnvInt("LOG_FAILURE_THRESHOLD", 3)
+	cfg.logFailureWindow = getEnvInt("LOG_FAILURE_WINDOW", 120)
+
+	// Profiles start from the settings above, so they are read last
+	if profiles, profilesErr = parseProfiles(os.Getenv("PROFILES")); profilesErr == nil {
+		profileSchedule, profilesErr = parseSchedule(os.Getenv("PROFILE_SCHEDULE"), profiles)
+	}
 }
 
 func main() {
@@ -112,7 +638,95 @@ func main() {
 	countryFilter := flag.String("country", "", "Filter by country code (e.g. US)")
 	flag.Parse()
 
-	log("VPN Manager Started")
+	// Subcommands
+	switch flag.Arg(0) {
+	case "validate":
+		if code := runValidate(); code != 0 {
+			os.Exit(code)
+		}
+		return
+	case "simulate":
+		runSimulate(flag.Args()[1:])
+		return
+	case "profile":
+		runProfileCommand(flag.Args()[1:])
+		return
+	case "status", "switch", "pin", "unpin", "reload":
+		runControlCommand(flag.Arg(0), flag.Args()[1:])
+		return
+	case "events":
+		runEventsCommand()
+		return
+	case "env":
+		runEnvCommand(flag.Args()[1:])
+		return
+	case "history":
+		runHistoryCommand(flag.Args()[1:])
+		return
+	case "dashboard":
+		runDashboardCommand(flag.Args()[1:])
+		return
+	case "version":
+		runVersion(flag.Args()[1:])
+		return
+	case "gluetun-auth":
+		runGluetunAuth()
+		return
+	case "doctor":
+		if code := runDoctor(); code != 0 {
+			os.Exit(code)
+		}
+		return
+	}
+
+	log(fmt.Sprintf("VPN Manager %s started", currentBuild()))
+	if targetTiersErr != nil {
+		log(fmt.Sprintf("Invalid target configuration: %v", targetTiersErr))
+		os.Exit(exitConfig)
+	}
+	for _, err := range []error{canariesErr, requiredFeaturesErr, profilesErr, dockerAPIErr, controlAuthErr, retryErr, quietHoursErr, notifyCooldownsErr} {
+		if err != nil {
+			log(fmt.Sprintf("Invalid configuration: %v", err))
+			os.Exit(exitConfig)
+		}
+	}
+	if secretsErr != nil {
+		log(fmt.Sprintf("Invalid secret backend: %v", secretsErr))
+		os.Exit(exitConfig)
+	}
+	if cfg.switchMode == switchModeBlueGreen {
+		if problems := blueGreenProblems(); len(problems) > 0 {
+			log(fmt.Sprintf("Invalid configuration: %s", strings.Join(problems, "; ")))
+			os.Exit(exitConfig)
+		}
+	}
+	for _, problems := range [][]string{controlProblems(), startupProblems(), providerProblems(), trafficProblems()} {
+		if len(problems) > 0 {
+			log(fmt.Sprintf("Invalid configuration: %s", strings.Join(problems, "; ")))
+			os.Exit(exitConfig)
+		}
+	}
+	if cfg.healthMode == healthModeProxy {
+		if _, err := health.ProxyClient(cfg.healthProxyURL); err != nil {
+			log(fmt.Sprintf("Invalid HEALTH_PROXY_URL: %v", err))
+			os.Exit(exitConfig)
+		}
+	}
+	if err := configureAPIProxy(); err != nil {
+		log(fmt.Sprintf("Invalid API_PROXY_URL: %v", err))
+		os.Exit(exitConfig)
+	}
+	if len(cfg.dependents) > 0 && cfg.runtimeBackend == runtimeDocker {
+		if err := checkDependentAction(); err != nil {
+			log(fmt.Sprintf("Invalid configuration: %v", err))
+			os.Exit(exitConfig)
+		}
+	}
+	setupNotifiers()
+	if err := loadWASMPlugins(); err != nil {
+		log(fmt.Sprintf("Invalid WASM plugin: %v", err))
+		os.Exit(exitConfig)
+	}
 
 	if *listCities {
 		runListCities(*countryFilter)
@@ -120,111 +734,244 @@ func main() {
 	}
 
 	// Main Manager Logic
-	manager := NewProtonManager()
-	
+	switch flag.Arg(0) {
+	case "snapshot", "server-info", "recommend", "benchmark":
+	default:
+		if !*checkOnly {
+			becomeLeader()
+		}
+	}
+	manager, err := NewProtonManager()
+	if err != nil {
+		exitAuthFailure(err)
+	}
+	stateStore = loadStore(cfg.stateFile)
+	if slices.ContainsFunc(profileNames(), func(name string) bool {
+		return slices.ContainsFunc(profiles[name].Tiers, func(t selector.Tier) bool { return t.Auto })
+	}) {
+		locateHost(manager)
+	}
+
 	if *checkOnly {
 		runCheckOnly(manager)
 		return
 	}
+	switch flag.Arg(0) {
+	case "snapshot":
+		runSnapshot(manager, flag.Args()[1:])
+		return
+	case "server-info":
+		runServerInfo(manager, flag.Args()[1:])
+		return
+	case "recommend":
+		runRecommend(manager, flag.Args()[1:])
+		return
+	case "benchmark":
+		runBenchmark(manager, flag.Args()[1:])
+		return
+	}
 
-	// Main Loop
+	// Main Loop: without Docker there is nothing the daemon can do
+	if cfg.runtimeBackend == runtimeDocker {
+		if _, err := docker.Version(); err != nil {
+			log(fmt.Sprintf("Cannot reach the Docker daemon: %v", err))
+			os.Exit(exitCode(classed(classDocker, err)))
+		}
+	}
 	runDaemon(manager)
 }
 
 // --- Manager Logic ---
 
 type ProtonManager struct {
+	// mu serializes API calls, which may refresh the tokens below
+	mu sync.Mutex
+
 	client       *proton.Client
 	apiManager   *proton.Manager
 	accessToken  string
 	uid          string
 	refreshToken string
+
+	// account indexes accounts; accountSince is when it became current
+	account      int
+	accountSince time.Time
+
+	// tokenIssued is when accessToken was obtained; learnedLifetime, if
+	// set, is how long one actually lasted when that was less than
+	// TOKEN_LIFETIME
+	tokenIssued     time.Time
+	learnedLifetime time.Duration
+
+	// loginWith, if set, replaces the SRP login, for tests
+	loginWith func(ctx context.Context, username string, password []byte) (*proton.Client, proton.Auth, error)
+	// loginWithHV, if set, replaces the SRP login with a verification token
+	loginWithHV func(ctx context.Context, username string, password []byte, hv *proton.APIHVDetails) (*proton.Client, proton.Auth, error)
 }
 
-func NewProtonManager() *ProtonManager {
-	pm := &ProtonManager{}
+// NewProtonManager resumes the saved session or logs in.
+func NewProtonManager() (*ProtonManager, error) {
+	pm := &ProtonManager{accountSince: time.Now()}
 	pm.ensureDirs()
-	pm.initSession()
-	return pm
+	if err := pm.initSession(); err != nil {
+		return nil, err
+	}
+	return pm, nil
+}
+
+// exitAuthFailure stops a command that could not log in, after alerting.
+func exitAuthFailure(err error) {
+	notify(alertAuthFailure, authFailureSubject,
+		fmt.Sprintf("The manager could not log in to Proton and has stopped:\n\n%v\n\nCheck PROTON_USERNAME/PROTON_PASSWORD, or complete any verification Proton requires, then restart the manager.", err))
+	flushNotifications(30 * time.Second)
+	os.Exit(exitCode(err))
 }
 
 func (pm *ProtonManager) ensureDirs() {
-	os.MkdirAll(logDir, 0755)
-	os.MkdirAll(cacheDir, 0755)
-	
-	sessionDir := getDir(sessionFile)
+	os.MkdirAll(cfg.logDir, 0755)
+	os.MkdirAll(cfg.cacheDir, 0755)
+
+	sessionDir := getDir(cfg.sessionFile)
 	if _, err := os.Stat(sessionDir); os.IsNotExist(err) {
 		os.MkdirAll(sessionDir, 0700)
 	}
 }
 
-func (pm *ProtonManager) initSession() {
-	pm.apiManager = proton.New(
-		proton.WithAppVersion("Other"),
-	)
+// initSession resumes the current account's saved session, falling back to
+// a password login.
+func (pm *ProtonManager) initSession() error {
+	if pm.apiManager == nil {
+		pm.apiManager = newAPIManager()
+	}
 
 	// 1. Try to load from disk
-	if err := pm.loadSession(); err == nil {
-		log("Session loaded from disk.")
-		// Verify session by creating a client
-		// We use NewClientWithRefresh to ensure the tokens are valid/refreshed
-		ctx := context.Background()
-		c, auth, err := pm.apiManager.NewClientWithRefresh(ctx, pm.uid, pm.refreshToken)
-		if err == nil {
-			pm.client = c
-			pm.accessToken = auth.AccessToken
-			pm.refreshToken = auth.RefreshToken
-			pm.saveSession() // Save potential refresh
-			log("Session verified and refreshed.")
-			return
-		}
+	err := pm.resumeSession()
+	if err == nil {
+		log("Session verified and refreshed.")
+		return nil
+	} else if !os.IsNotExist(err) {
 		log(fmt.Sprintf("Failed to refresh session: %v. Starting fresh.", err))
 	}
 
 	// 2. Fresh Auth
-	pm.authenticate()
+	if authErr := pm.authenticate(); authErr != nil {
+		return authErr
+	}
+	if !os.IsNotExist(err) {
+		pm.reauthenticated(err)
+	}
+	return nil
+}
+
+// newAPIManager returns the go-proton-api manager used for logins and
+// refreshes. It keeps the library's own host unless PROTON_API_URL points
+// somewhere else, such as a test server.
+func newAPIManager() *proton.Manager {
+	opts := []proton.Option{
+		proton.WithAppVersion("Other"),
+		proton.WithTransport(apiTransport),
+	}
+	if cfg.apiBaseURL != defaultAPIURL {
+		opts = append(opts, proton.WithHostURL(cfg.apiBaseURL))
+	}
+	return proton.New(opts...)
 }
 
-func (pm *ProtonManager) authenticate() {
-	if protonUser == "" || protonPass == "" {
-		log("Error: PROTON_USERNAME and PROTON_PASSWORD must be set.")
-		os.Exit(1)
+// resumeSession restores the session persisted on disk and refreshes it.
+func (pm *ProtonManager) resumeSession() error {
+	if err := pm.loadSession(); err != nil {
+		return err
 	}
+	log("Session loaded from disk.")
 
-	log(fmt.Sprintf("Authenticating as %s...", protonUser))
+	// Verify session by refreshing its tokens
+	return pm.renewTokens(refreshResume)
+}
+
+// authenticate logs in with each account in turn until one succeeds. The
+// error is classed for exitCode.
+func (pm *ProtonManager) authenticate() error {
+	// Try each account in turn before giving up
+	err := pm.login()
+	for i := 1; err != nil && i < len(accounts); i++ {
+		log(fmt.Sprintf("Authentication as %s failed: %v", pm.acct().Username, err))
+		pm.useAccount((pm.account + 1) % len(accounts))
+		err = pm.login()
+	}
+	if hv, ok := hvError(err); ok {
+		err = pm.awaitHumanVerification(hv)
+	}
+	if err != nil && classOf(err) == classOther {
+		err = classed(classAuth, err)
+	}
+	if err != nil {
+		log(fmt.Sprintf("Authentication failed: %v", err))
+	}
+	return err
+}
+
+// login performs a fresh SRP login with the configured credentials.
+func (pm *ProtonManager) login() error {
+	acct := pm.acct()
+	if acct.Username == "" || acct.Password == "" {
+		return classed(classConfig, fmt.Errorf("PROTON_USERNAME and PROTON_PASSWORD must be set"))
+	}
+
+	log(fmt.Sprintf("Authenticating as %s...", acct.Username))
 	ctx := context.Background()
 	
 	// SRP Auth
-	c, auth, err := pm.apiManager.NewClientWithLogin(ctx, protonUser, []byte(protonPass))
+	loginWith := pm.loginWith
+	if loginWith == nil {
+		loginWith = pm.apiManager.NewClientWithLogin
+	}
+	c, auth, err := loginWith(ctx, acct.Username, []byte(acct.Password))
 	if err != nil {
-		log(fmt.Sprintf("Authentication failed: %v", err))
-		os.Exit(1)
+		return err
 	}
+	pm.setAuth(c, auth)
+	return nil
+}
 
+// setAuth adopts a freshly logged-in client and persists its session.
+func (pm *ProtonManager) setAuth(c *proton.Client, auth proton.Auth) {
 	pm.client = c
 	pm.uid = auth.UID
 	pm.accessToken = auth.AccessToken
 	pm.refreshToken = auth.RefreshToken
-	
+	pm.tokenIssued = time.Now()
+
 	log("Authentication successful.")
 	pm.saveSession()
 }
 
 func (pm *ProtonManager) loadSession() error {
-	f, err := os.Open(sessionFile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
 	var data SessionData
-	if err := json.NewDecoder(f).Decode(&data); err != nil {
-		return err
+	if secrets != nil {
+		raw, err := secrets.Get(pm.acct().SessionKey)
+		if errors.Is(err, errSecretNotFound) {
+			return os.ErrNotExist
+		} else if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(raw), &data); err != nil {
+			return err
+		}
+	} else {
+		f, err := os.Open(pm.acct().SessionFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(&data); err != nil {
+			return err
+		}
 	}
 
 	pm.uid = data.UID
 	pm.accessToken = data.AccessToken
 	pm.refreshToken = data.RefreshToken
+	pm.tokenIssued = data.IssuedAt
 	return nil
 }
 
@@ -233,9 +980,18 @@ func (pm *ProtonManager) saveSession() {
 		UID:          pm.uid,
 		AccessToken:  pm.accessToken,
 		RefreshToken: pm.refreshToken,
+		IssuedAt:     pm.tokenIssued,
+	}
+
+	if secrets != nil {
+		raw, _ := json.Marshal(data)
+		if err := secrets.Set(pm.acct().SessionKey, string(raw)); err != nil {
+			log(fmt.Sprintf("Failed to save session to %s: %v", secrets.Name(), err))
+		}
+		return
 	}
 
-	f, err := os.Create(sessionFile)
+	f, err := os.Create(pm.acct().SessionFile)
 	if err != nil {
 		log(fmt.Sprintf("Failed to save session: %v", err))
 		return
@@ -246,71 +1002,88 @@ func (pm *ProtonManager) saveSession() {
 }
 
 // Fetch Servers using standard HTTP client with our AccessToken
-func (pm *ProtonManager) getServers() ([]LogicalServer, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", apiBaseURL+"/vpn/logicals", nil)
-	if err != nil {
+func (pm *ProtonManager) Servers() ([]LogicalServer, error) {
+	var result LogicalServersResponse
+	if err := pm.apiGet(protonapi.LogicalServersPath, &result); err != nil {
 		return nil, err
 	}
+	return result.LogicalServers, nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+pm.accessToken)
-	req.Header.Set("x-pm-appversion", "Other")
-	req.Header.Set("x-pm-uid", pm.uid)
+// apiGet decodes an authenticated API response, refreshing the session once
+// if the access token has expired.
+func (pm *ProtonManager) apiGet(path string, v any) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 
-	resp, err := client.Do(req)
+	if pm.rotationDue() {
+		pm.rotateAccount("rotation interval reached")
+	}
+	err := cfg.apiRetry.Do(context.Background(), func() error { return pm.fetch(path, v) })
+	switch classifyAPIError(err) {
+	case apiErrRateLimited, apiErrHumanVerification, apiErrSubscriptionExpired:
+		// Another account may not have the problem
+		if pm.rotateAccount(err.Error()) {
+			err = pm.fetch(path, v)
+		}
+	}
+	return err
+}
+
+// fetch performs one authenticated GET. Callers hold pm.mu.
+func (pm *ProtonManager) fetch(path string, v any) error {
+	newReq := func(base string) (*http.Request, error) {
+		req, err := http.NewRequest("GET", base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+pm.accessToken)
+		req.Header.Set("x-pm-appversion", "Other")
+		req.Header.Set("x-pm-uid", pm.uid)
+		return req, nil
+	}
+
+	resp, err := sendAPI(newReq)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 401 {
 		// Token expired, refresh and retry once
 		log("Token expired (401). Refreshing...")
+		pm.tokenExpired()
 		if err := pm.refreshSession(); err == nil {
-			req.Header.Set("Authorization", "Bearer "+pm.accessToken)
-			resp, err = client.Do(req)
+			resp, err = sendAPI(newReq)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			defer resp.Body.Close()
 		} else {
-			return nil, fmt.Errorf("failed to refresh session: %v", err)
+			return fmt.Errorf("failed to refresh session: %w", err)
 		}
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
+		return protonapi.ParseError(resp)
 	}
 
-	var result LogicalServersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
-	}
-
-	return result.LogicalServers, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
+// refreshSession renews expired tokens, logging in again if the refresh
+// token was rejected too. Callers hold pm.mu.
 func (pm *ProtonManager) refreshSession() error {
-	ctx := context.Background()
-	// We close the old client if it exists to clean up
-	if pm.client != nil {
-		pm.client.Close()
+	err := pm.renewTokens(refreshExpired)
+	if err == nil {
+		return nil
 	}
-
-	c, auth, err := pm.apiManager.NewClientWithRefresh(ctx, pm.uid, pm.refreshToken)
-	if err != nil {
-		// If refresh fails, try full re-auth
-		log("Refresh failed, attempting full re-authentication...")
-		// Use authenticate() but handle potential exit
-		// Since authenticate() exits on failure, this is fine for now
-		pm.authenticate()
-		return nil 
+	// If refresh fails, try full re-auth
+	log("Refresh failed, attempting full re-authentication...")
+	if authErr := pm.authenticate(); authErr != nil {
+		return authErr
 	}
-
-	pm.client = c
-	pm.accessToken = auth.AccessToken
-	pm.refreshToken = auth.RefreshToken
-	pm.saveSession()
+	pm.reauthenticated(err)
 	return nil
 }
 
@@ -319,16 +1092,20 @@ func (pm *ProtonManager) refreshSession() error {
 
 func runListCities(countryFilter string) {
 	// For listing cities, we need a manager to get servers
-	pm := NewProtonManager()
-	servers, err := pm.getServers()
+	pm, err := NewProtonManager()
+	if err != nil {
+		exitAuthFailure(err)
+	}
+	servers, err := pm.Servers()
 	if err != nil {
 		log(fmt.Sprintf("Error fetching servers: %v", err))
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
 	stats := make(map[string]struct {
-		Count int
-		Load  int
+		Count   int
+		Virtual int
+		Load    int
 	})
 
 	for _, s := range servers {
@@ -342,6 +1119,9 @@ func runListCities(countryFilter string) {
 		entry := stats[key]
 		entry.Count++
 		entry.Load += s.Load
+		if s.IsVirtual() {
+			entry.Virtual++
+		}
 		stats[key] = entry
 	}
 
@@ -353,7 +1133,7 @@ func runListCities(countryFilter string) {
 	sort.Strings(keys)
 
 	fmt.Println("------------------------------------------------------------")
-	fmt.Printf("%-8s %-30s %-10s %-10s\n", "COUNTRY", "CITY", "SERVERS", "AVG LOAD")
+	fmt.Printf("%-8s %-30s %-10s %-10s %-10s\n", "COUNTRY", "CITY", "SERVERS", "VIRTUAL", "AVG LOAD")
 	fmt.Println("------------------------------------------------------------")
 
 	for _, k := range keys {
@@ -364,17 +1144,17 @@ func runListCities(countryFilter string) {
 		if data.Count > 0 {
 			avgLoad = data.Load / data.Count
 		}
-		fmt.Printf("%-8s %-30s %-10d %d%%\n", country, city, data.Count, avgLoad)
+		fmt.Printf("%-8s %-30s %-10d %-10d %d%%\n", country, city, data.Count, data.Virtual, avgLoad)
 	}
 	fmt.Println("------------------------------------------------------------")
 }
 
 func runCheckOnly(pm *ProtonManager) {
 	log("Running in CHECK ONLY mode...")
-	servers, err := pm.getServers()
+	servers, err := pm.Servers()
 	if err != nil {
 		log(fmt.Sprintf("Error: %v", err))
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 
 	currentName := getCurrentServerFromEnv()
@@ -383,99 +1163,14 @@ func runCheckOnly(pm *ProtonManager) {
 	if best != nil {
 		fmt.Printf("\n--- REPORT ---\n")
 		fmt.Printf("Current Server (Env): %s\n", currentName)
-		fmt.Printf("Best Server: %s (Load: %d%%)\n", best.Name, best.Load)
+		fmt.Printf("Best Server: %s (Load: %d%%, Reliability: %.2f)\n", best.Name, best.Load, stateStore.reliability(best.Name))
+		if q := stateStore.quarantined(); len(q) > 0 {
+			fmt.Printf("Quarantined: %s\n", strings.Join(q, ", "))
+		}
 		fmt.Printf("--------------\n")
 	} else {
 		fmt.Println("No suitable servers found.")
-	}
-}
-
-
-// --- Daemon Logic ---
-
-func runDaemon(pm *ProtonManager) {
-	lastHealth := time.Time{}
-	lastLoad := time.Time{}
-
-	for {
-		now := time.Now()
-
-		// 1. Health Check
-		if now.Sub(lastHealth) >= time.Duration(healthCheckInterval)*time.Second {
-			lastHealth = now
-			healthy := checkConnectivity()
-			
-			if !healthy {
-				log("Unhealthy connection detected! Initiating failover...")
-				// Force immediate load check to switch
-				lastLoad = time.Time{} 
-			} else {
-				// If healthy, wait before checking load
-				if now.Sub(lastLoad) < time.Duration(loadCheckInterval)*time.Second {
-					time.Sleep(5 * time.Second)
-					continue
-				}
-			}
-		}
-
-		// 2. Load Check / Failover
-		if now.Sub(lastLoad) >= time.Duration(loadCheckInterval)*time.Second {
-			lastLoad = now
-			
-			servers, err := pm.getServers()
-			if err != nil {
-				log(fmt.Sprintf("Error fetching servers: %v", err))
-				time.Sleep(30 * time.Second)
-				continue
-			}
-
-			currentName := getCurrentServerFromEnv()
-			healthy := checkConnectivity()
-			
-			best, currentLoad := findBestServer(servers, currentName)
-			
-			// Logging
-			status := "BAD"
-			if healthy { status = "OK" }
-			msg := fmt.Sprintf("Health: %s | Current: %s (%d%%)", status, currentName, currentLoad)
-			if best != nil {
-				msg += fmt.Sprintf(" | Best: %s (%d%%)", best.Name, best.Load)
-			}
-			log(msg)
-
-			// Decision
-			shouldSwitch := false
-			target := ""
-			reason := ""
-
-			if !healthy {
-				shouldSwitch = true
-				reason = "Unhealthy Connection"
-				if best != nil {
-					target = best.Name
-				}
-			} else if best != nil && currentName != "" {
-				if currentLoad > (best.Load + 20) {
-					shouldSwitch = true
-					target = best.Name
-					reason = fmt.Sprintf("Load Optimization (%d%% > %d%% + 20%%)", currentLoad, best.Load)
-				}
-			}
-
-			if shouldSwitch && target != "" && target != currentName {
-				log(fmt.Sprintf("Initiating switch to %s. Reason: %s", target, reason))
-				if updateEnv(best) {
-					restartGluetun()
-					// Wait for restart
-					time.Sleep(45 * time.Second)
-					// Reset timers
-					lastHealth = time.Now()
-					lastLoad = time.Now()
-				}
-			}
-		}
-
-		time.Sleep(5 * time.Second)
+		os.Exit(exitNoCandidates)
 	}
 }
 
@@ -483,153 +1178,156 @@ func runDaemon(pm *ProtonManager) {
 // --- Helpers ---
 
 func findBestServer(servers []LogicalServer, currentName string) (*LogicalServer, int) {
-	var candidates []LogicalServer
 	currentLoad := 100
-
-	for _, s := range servers {
-		if s.Name == currentName {
-			currentLoad = s.Load
-		}
-
-		if s.Status != 1 {
-			continue
-		}
-
-		if targetCountry != "" && s.EntryCountry != targetCountry {
-			continue
-		}
-
-		// Check city match
-		cityMatch := false
-		for _, city := range targetCities {
-			if strings.EqualFold(s.City, strings.TrimSpace(city)) {
-				cityMatch = true
-				break
-			}
-		}
-		
-		if cityMatch {
-			candidates = append(candidates, s)
-		}
+	if current := protonapi.FindByName(servers, currentName); current != nil {
+		currentLoad = current.Load
 	}
 
+	candidates := pluginSelect(selectCandidates(servers), currentName)
 	if len(candidates) == 0 {
 		return nil, currentLoad
 	}
-
-	// Sort by Load ASC
-	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].Load < candidates[j].Load
-	})
-
 	return &candidates[0], currentLoad
 }
 
 func checkConnectivity() bool {
-	// Use gluetunContainer (name) for docker exec
-	cmd := exec.Command("docker", "exec", "-i", gluetunContainer, "ping", "-c", "3", "-W", "2", pingTarget)
-	if err := cmd.Run(); err != nil {
-		return false
-	}
-	return true
+	return healthChecker().Check()
 }
 
 func getCurrentServerFromEnv() string {
-	data, err := os.ReadFile(envFile)
-	if err != nil {
-		return ""
+	return readEnvFile()["PROTON_SERVER_NAME"]
+}
+
+// readEnvFile parses the env file into a map. A missing file yields an
+// empty map.
+func readEnvFile() map[string]string {
+	vars, _ := readEnv()
+	return vars
+}
+
+// managedEnvVars returns the env vars the manager owns for the given server.
+func managedEnvVars(server *LogicalServer, wgServer *Server) map[string]string {
+	vars := map[string]string{
+		"PROTON_SERVER_NAME":      server.Name,
+		"WIREGUARD_ENDPOINT_IP":   wgServer.EntryIP,
+		"WIREGUARD_ENDPOINT_PORT": wireguardPort(),
+		"WIREGUARD_PUBLIC_KEY":    wgServer.X25519PublicKey,
+	}
+	for k, v := range protocolEnvVars(server) {
+		vars[k] = v
 	}
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "PROTON_SERVER_NAME=") {
-			return strings.TrimPrefix(line, "PROTON_SERVER_NAME=")
+	if cfg.updateStrategy == strategyProvider {
+		for k, v := range providerEnvVars(server) {
+			vars[k] = v
 		}
 	}
-	return ""
+	for k, v := range mtuEnvVars() {
+		vars[k] = v
+	}
+	for k, v := range ipv6EnvVars(server) {
+		vars[k] = v
+	}
+	for k, v := range proxyEnvVars() {
+		vars[k] = v
+	}
+	return vars
 }
 
 func updateEnv(server *LogicalServer) bool {
 	// Find WireGuard Key
-	var wgServer *Server
-	for _, s := range server.Servers {
-		if s.X25519PublicKey != "" {
-			wgServer = &s
-			break
-		}
-	}
-
+	wgServer := wireguardEndpoint(server)
 	if wgServer == nil {
 		log(fmt.Sprintf("Error: No WireGuard key found for server %s", server.Name))
 		return false
 	}
 
+	if cfg.mtuProbe {
+		probeTunnelMTU(wgServer.EntryIP)
+	}
 	log(fmt.Sprintf("Updating ENV: Name=%s, IP=%s", server.Name, wgServer.EntryIP))
 
-	// Read existing
-	content, _ := os.ReadFile(envFile)
-	lines := strings.Split(string(content), "\n")
-	
-	newLines := []string{}
-	managedVars := map[string]string{
-		"PROTON_SERVER_NAME":      server.Name,
-		"WIREGUARD_ENDPOINT_IP":   wgServer.EntryIP,
-		"WIREGUARD_ENDPOINT_PORT": "51820",
-		"WIREGUARD_PUBLIC_KEY":    wgServer.X25519PublicKey,
+	if err := writeEnvVars(managedEnvVars(server, wgServer)); err != nil {
+		log(fmt.Sprintf("Error updating env: %v", err))
+		return false
 	}
-	foundVars := make(map[string]bool)
+	stateStore.updateState(func(st *State) { st.Server = server.Name })
+	return true
+}
 
-	for _, line := range lines {
-		updated := false
-		for k, v := range managedVars {
-			if strings.HasPrefix(line, k+"=") {
-				newLines = append(newLines, fmt.Sprintf("%s=%s", k, v))
-				foundVars[k] = true
-				updated = true
-				break
-			}
-		}
-		if !updated {
-			newLines = append(newLines, line)
-		}
+// writeEnvVars sets the given variables in the env file, unless gluetun
+// would reject the result.
+func writeEnvVars(managedVars map[string]string) error {
+	managedVars = toGluetunEnv(managedVars)
+	if err := checkGluetunEnv(managedVars); err != nil {
+		return err
 	}
-
-	// Append missing
-	for k, v := range managedVars {
-		if !foundVars[k] {
-			newLines = append(newLines, fmt.Sprintf("%s=%s", k, v))
-		}
+	backedUp := cfg.envBackupCount > 0
+	if err := backupEnvFile(); err != nil {
+		log(fmt.Sprintf("Failed to back up %s: %v", cfg.envFile, err))
+		backedUp = false
 	}
-
-	// Write back
-	output := strings.Join(newLines, "\n")
-	// Ensure newline at end
-	if !strings.HasSuffix(output, "\n") {
-		output += "\n"
+	if err := updateEnvFile(cfg.envFile, managedVars); err != nil {
+		return err
 	}
-	
-	if err := os.WriteFile(envFile, []byte(output), 0644); err != nil {
-		log(fmt.Sprintf("Error updating env: %v", err))
-		return false
+	err := verifyEnvWrite(managedVars)
+	if err != nil && backedUp {
+		if stamp, rerr := restoreEnvFile(""); rerr != nil {
+			log(fmt.Sprintf("Failed to restore %s: %v", cfg.envFile, rerr))
+		} else {
+			log(fmt.Sprintf("Restored %s from backup %s", cfg.envFile, stamp))
+		}
 	}
-	return true
+	return err
 }
 
-func restartGluetun() {
+// restartGluetun recreates gluetun on the env file's settings. It reports
+// false only when a blue/green switch kept the old tunnel.
+func restartGluetun() bool {
+	if cfg.switchMode == switchModeBlueGreen {
+		return switchBlueGreen()
+	}
+
 	log("Recreating Gluetun...")
-	
-	// Use gluetunService for docker-compose up
-	cmdArgs := []string{"up", "-d", "--force-recreate", gluetunService}
-	cmd := exec.Command("docker-compose", cmdArgs...)
-	
-	if _, err := os.Stat("/project/docker-compose.yml"); err == nil {
-		cmd = exec.Command("docker-compose", "-f", "/project/docker-compose.yml", "up", "-d", "--force-recreate", gluetunService)
+	stopDependents()
+	defer startDependentsWhenReady()
+
+	defer rediscoverGluetun()
+	instances := gluetunInstances()
+
+	if cfg.dockerAPI {
+		env := readEnvFile()
+		for _, c := range instances {
+			err := cfg.dockerRetry.Do(context.Background(), func() error {
+				return docker.Recreate(c.Name, docker.RecreateOptions{Env: env})
+			})
+			if err != nil {
+				log(fmt.Sprintf("Failed to recreate gluetun: %v", err))
+			}
+		}
+		return true
 	}
 
-	if output, err := cmd.CombinedOutput(); err != nil {
-		log(fmt.Sprintf("Failed to recreate gluetun: %v\nOutput: %s", err, string(output)))
-		// Fallback - Use gluetunContainer for direct docker restart
-		exec.Command("docker", "restart", gluetunContainer).Run()
+	restart := func() {
+		for _, c := range instances {
+			dockerAction("restart", c.Name)
+		}
+	}
+	recreate := func() error {
+		cmd, err := composeCommand(append([]string{"up", "-d", "--force-recreate"}, gluetunServices()...)...)
+		if err != nil {
+			return retry.Permanent(fmt.Errorf("Compose unavailable: %v", err))
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%v\nOutput: %s", err, string(output))
+		}
+		return nil
+	}
+	if err := cfg.dockerRetry.Do(context.Background(), recreate); err != nil {
+		log(fmt.Sprintf("Failed to recreate gluetun: %v", err))
+		// Fallback - direct docker restart
+		restart()
 	}
+	return true
 }
 
 func log(msg string) {
@@ -652,6 +1350,27 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return fallback
+}
+
+// splitList splits a comma-separated setting into lower-case entries.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getDir(path string) string {
 	// naive dirname
 	lastSlash := strings.LastIndex(path, "/")
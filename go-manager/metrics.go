@@ -0,0 +1,184 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"gluetun-proton-manager/dashboard"
+	"gluetun-proton-manager/protonapi"
+)
+
+// Token refresh triggers, the trigger label of
+// proton_manager_token_refreshes_total.
+const (
+	refreshResume    = "resume"    // restoring the saved session
+	refreshScheduled = "scheduled" // ahead of the token's expiry
+	refreshExpired   = "expired"   // after a 401
+)
+
+// sessionCounters counts how the Proton session is kept alive. Password
+// logins piling up while refreshes fail are the early sign of a refresh
+// token being invalidated.
+type sessionCounters struct {
+	mu              sync.Mutex
+	refreshes       map[string]int // by trigger
+	refreshFailures int
+	unauthorized    int
+	reauths         int
+}
+
+var sessionMetrics = &sessionCounters{refreshes: make(map[string]int)}
+
+func (c *sessionCounters) refreshed(trigger string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshes[trigger]++
+}
+
+func (c *sessionCounters) refreshFailed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refreshFailures++
+}
+
+func (c *sessionCounters) rejected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unauthorized++
+}
+
+// reauthenticated counts a password login and returns the total so far.
+func (c *sessionCounters) reauthenticated() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reauths++
+	return c.reauths
+}
+
+// switchKey identifies a series of proton_manager_switches_total.
+type switchKey struct {
+	trigger, outcome, server string
+}
+
+// switchCounters counts finished switches by trigger, outcome and the
+// server switched to.
+type switchCounters struct {
+	mu     sync.Mutex
+	counts map[switchKey]int
+}
+
+var switchMetrics = &switchCounters{counts: make(map[switchKey]int)}
+
+func (c *switchCounters) switched(ev auditEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[switchKey{ev.Trigger, ev.Outcome, ev.To}]++
+}
+
+// serverLabels are the labels identifying a server and where it is. City
+// and country come from the last server list, so they are empty until one
+// has been fetched.
+func serverLabels(servers []LogicalServer, name string) string {
+	city, country := "", ""
+	if s := protonapi.FindByName(servers, name); s != nil {
+		city, country = s.City, s.ExitCountry
+	}
+	return fmt.Sprintf("server=%q,city=%q,country=%q", name, city, country)
+}
+
+// serveMetrics writes the counters and the tunnel's state in the Prometheus
+// text format.
+func (d *daemon) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	sessionMetrics.write(w)
+	d.mu.Lock()
+	status, servers := d.status, d.lastServers
+	d.mu.Unlock()
+	switchMetrics.write(w, servers)
+	writeTunnelMetrics(w, status, servers)
+}
+
+func (c *switchCounters) write(w io.Writer, servers []LogicalServer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := slices.Collect(maps.Keys(c.counts))
+	slices.SortFunc(keys, func(a, b switchKey) int {
+		return cmp.Or(strings.Compare(a.trigger, b.trigger), strings.Compare(a.outcome, b.outcome), strings.Compare(a.server, b.server))
+	})
+	fmt.Fprint(w, "# HELP proton_manager_switches_total Finished switches, by trigger, outcome and the server switched to.\n"+
+		"# TYPE proton_manager_switches_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(w, "proton_manager_switches_total{trigger=%q,outcome=%q,%s} %d\n", k.trigger, k.outcome, serverLabels(servers, k.server), c.counts[k])
+	}
+}
+
+// writeTunnelMetrics writes gauges for the connected server.
+func writeTunnelMetrics(w io.Writer, st Status, servers []LogicalServer) {
+	if st.Server == "" {
+		return
+	}
+	labels := serverLabels(servers, st.Server)
+	gauge := func(name, help string, value int) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s{%s} %d\n", name, help, name, name, labels, value)
+	}
+	up := 0
+	if st.Healthy {
+		up = 1
+	}
+	gauge("proton_manager_tunnel_up", "Whether the tunnel passes health checks, labelled with the connected server.", up)
+	gauge("proton_manager_server_load_percent", "Load of the connected server at the last load check.", st.Load)
+	if st.RTTMs > 0 {
+		gauge("proton_manager_rtt_milliseconds", "Last round trip through the tunnel (MAX_RTT_MS).", st.RTTMs)
+	}
+	gauge("proton_manager_packet_loss_percent", "Packet loss over PACKET_LOSS_WINDOW (MAX_PACKET_LOSS_PCT).", st.PacketLossPct)
+	if !st.LastSwitch.IsZero() {
+		gauge("proton_manager_last_switch_timestamp_seconds", "When the connected server was switched to.", int(st.LastSwitch.Unix()))
+	}
+}
+
+func (c *sessionCounters) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counter := func(name, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	}
+	counter("proton_manager_token_refreshes_total", "Access token refreshes, by what prompted them.")
+	for _, trigger := range []string{refreshResume, refreshScheduled, refreshExpired} {
+		fmt.Fprintf(w, "proton_manager_token_refreshes_total{trigger=%q} %d\n", trigger, c.refreshes[trigger])
+	}
+	counter("proton_manager_token_refresh_failures_total", "Access token refreshes that failed.")
+	fmt.Fprintf(w, "proton_manager_token_refresh_failures_total %d\n", c.refreshFailures)
+	counter("proton_manager_api_unauthorized_total", "API requests answered with 401 because the access token had expired.")
+	fmt.Fprintf(w, "proton_manager_api_unauthorized_total %d\n", c.unauthorized)
+	counter("proton_manager_reauthentications_total", "Password logins after the saved session could not be refreshed.")
+	fmt.Fprintf(w, "proton_manager_reauthentications_total %d\n", c.reauths)
+}
+
+// runDashboardCommand implements `manager dashboard export`, which writes the
+// bundled Grafana dashboard for the metrics above.
+func runDashboardCommand(args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprintln(os.Stderr, "usage: manager dashboard export [--out file]")
+		os.Exit(exitUsage)
+	}
+	fs := flag.NewFlagSet("dashboard export", flag.ExitOnError)
+	out := fs.String("out", "", "Write to this file instead of stdout")
+	fs.Parse(args[1:])
+
+	if *out == "" {
+		os.Stdout.Write(dashboard.Grafana)
+		return
+	}
+	if err := os.WriteFile(*out, dashboard.Grafana, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+}
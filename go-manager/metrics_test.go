@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSwitchAndTunnelMetrics(t *testing.T) {
+	prev := switchMetrics
+	switchMetrics = &switchCounters{counts: make(map[switchKey]int)}
+	t.Cleanup(func() { switchMetrics = prev })
+
+	servers := []LogicalServer{{Name: "CH#4", City: "Zurich", ExitCountry: "CH", Load: 31}}
+	switchMetrics.switched(auditEvent{Trigger: triggerLoad, Outcome: outcomeSuccess, To: "CH#4"})
+	switchMetrics.switched(auditEvent{Trigger: triggerLoad, Outcome: outcomeSuccess, To: "CH#4"})
+	switchMetrics.switched(auditEvent{Trigger: triggerHealth, Outcome: outcomeFailed, To: "SE#1"})
+
+	var out strings.Builder
+	switchMetrics.write(&out, servers)
+	writeTunnelMetrics(&out, Status{Server: "CH#4", Healthy: true, Load: 31, RTTMs: 42, LastSwitch: time.Unix(1700000000, 0)}, servers)
+	for _, want := range []string{
+		`proton_manager_switches_total{trigger="health",outcome="failed",server="SE#1",city="",country=""} 1`,
+		`proton_manager_switches_total{trigger="load",outcome="success",server="CH#4",city="Zurich",country="CH"} 2`,
+		`proton_manager_tunnel_up{server="CH#4",city="Zurich",country="CH"} 1`,
+		`proton_manager_server_load_percent{server="CH#4",city="Zurich",country="CH"} 31`,
+		`proton_manager_rtt_milliseconds{server="CH#4",city="Zurich",country="CH"} 42`,
+		`proton_manager_last_switch_timestamp_seconds{server="CH#4",city="Zurich",country="CH"} 1700000000`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("metrics missing %s:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	writeTunnelMetrics(&out, Status{}, servers)
+	if out.Len() != 0 {
+		t.Errorf("tunnel metrics without a server:\n%s", out.String())
+	}
+}
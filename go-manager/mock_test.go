@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"gluetun-proton-manager/envfile"
+	"gluetun-proton-manager/runtime/docker"
+	"gluetun-proton-manager/selector"
+)
+
+// Test doubles for the daemon's dependencies, built on the mocks generated
+// from deps.go, notify.go and health/checker.go. Each records what the daemon
+// asked of it so tests can assert on the calls.
+
+// mockServerSource returns servers, or err.
+type mockServerSource struct {
+	*MockServerSource
+	mu      sync.Mutex
+	servers []LogicalServer
+	err     error
+	calls   int
+}
+
+func newMockServerSource(t *testing.T, servers ...LogicalServer) *mockServerSource {
+	m := &mockServerSource{MockServerSource: NewMockServerSource(gomock.NewController(t)), servers: servers}
+	m.EXPECT().Servers().DoAndReturn(m.list).AnyTimes()
+	return m
+}
+
+func (m *mockServerSource) list() ([]LogicalServer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return append([]LogicalServer(nil), m.servers...), m.err
+}
+
+// mockRuntime records the servers it applies. Like the real runtime it
+// writes PROTON_SERVER_NAME and records it as the managed server. With
+// rollBack set, Restart puts the previous server back the way a failed
+// blue/green switch does.
+type mockRuntime struct {
+	*MockRuntime
+	mu        sync.Mutex
+	applied   []string
+	restarts  int
+	failApply bool
+	rollBack  bool
+	notReady  bool
+	previous  string
+}
+
+func newMockRuntime(t *testing.T) *mockRuntime {
+	m := &mockRuntime{MockRuntime: NewMockRuntime(gomock.NewController(t))}
+	m.EXPECT().Apply(gomock.Any()).DoAndReturn(m.apply).AnyTimes()
+	m.EXPECT().Restart().DoAndReturn(m.restart).AnyTimes()
+	m.EXPECT().WaitReady(gomock.Any()).DoAndReturn(m.waitReady).AnyTimes()
+	return m
+}
+
+func (m *mockRuntime) apply(server *LogicalServer) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failApply {
+		return false
+	}
+	if err := envfile.Update(cfg.envFile, map[string]string{"PROTON_SERVER_NAME": server.Name}); err != nil {
+		return false
+	}
+	m.applied = append(m.applied, server.Name)
+	stateStore.updateState(func(st *State) {
+		m.previous = st.Server
+		st.Server = server.Name
+	})
+	return true
+}
+
+// appliedNames returns the servers applied so far.
+func (m *mockRuntime) appliedNames() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.applied)
+}
+
+func (m *mockRuntime) restart() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restarts++
+	if m.rollBack {
+		envfile.Update(cfg.envFile, map[string]string{"PROTON_SERVER_NAME": m.previous})
+		stateStore.updateState(func(st *State) { st.Server = m.previous })
+		return false
+	}
+	return true
+}
+
+func (m *mockRuntime) waitReady(time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.notReady
+}
+
+// mockHealth returns results in order, repeating the last one. RTT and Loss
+// do the same with rtts and replies (out of 5 probes).
+type mockHealth struct {
+	*MockChecker
+	*MockRTTer
+	*MockLossMeter
+	mu        sync.Mutex
+	results   []bool
+	calls     int
+	rtts      []time.Duration
+	rttCalls  int
+	replies   []int
+	lossCalls int
+}
+
+func newMockHealth(t *testing.T, results ...bool) *mockHealth {
+	ctrl := gomock.NewController(t)
+	m := &mockHealth{MockChecker: NewMockChecker(ctrl), MockRTTer: NewMockRTTer(ctrl), MockLossMeter: NewMockLossMeter(ctrl), results: results}
+	m.MockChecker.EXPECT().Check().DoAndReturn(m.check).AnyTimes()
+	m.MockRTTer.EXPECT().RTT().DoAndReturn(m.rtt).AnyTimes()
+	m.MockLossMeter.EXPECT().Loss().DoAndReturn(m.loss).AnyTimes()
+	return m
+}
+
+func (m *mockHealth) loss() (int, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.replies) == 0 {
+		return 0, 0, errTest
+	}
+	i := min(m.lossCalls, len(m.replies)-1)
+	m.lossCalls++
+	return 5, m.replies[i], nil
+}
+
+func (m *mockHealth) rtt() (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.rtts) == 0 {
+		return 0, errTest
+	}
+	i := min(m.rttCalls, len(m.rtts)-1)
+	m.rttCalls++
+	return m.rtts[i], nil
+}
+
+func (m *mockHealth) check() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := min(m.calls, len(m.results)-1)
+	m.calls++
+	return m.results[i]
+}
+
+// mockNotifier records the alerts sent to it.
+type mockNotifier struct {
+	*MockNotifier
+	mu   sync.Mutex
+	sent []alert
+}
+
+func newMockNotifier(t *testing.T) *mockNotifier {
+	m := &mockNotifier{MockNotifier: NewMockNotifier(gomock.NewController(t))}
+	m.EXPECT().Name().Return("mock").AnyTimes()
+	m.EXPECT().Send(gomock.Any()).DoAndReturn(m.send).AnyTimes()
+	return m
+}
+
+func (m *mockNotifier) send(a alert) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, a)
+	return nil
+}
+
+func (m *mockNotifier) kinds() []alertKind {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kinds []alertKind
+	for _, a := range m.sent {
+		kinds = append(kinds, a.Kind)
+	}
+	return kinds
+}
+
+// testConfig is the configuration tests start from: the defaults, with the
+// manager's files under dir and every optional feature off.
+func testConfig(dir string) *config {
+	return &config{
+		envFile:       filepath.Join(dir, ".env"),
+		envFileFormat: envFormatEnv,
+		logDir:        dir,
+		auditLog:      true,
+		cacheDir:      filepath.Join(dir, "cache"),
+
+		envBackupCount:      10,
+		gluetunService:      "gluetun",
+		gluetunContainer:    "gluetun",
+		runtimeBackend:      runtimeDocker,
+		switchMode:          switchModeRecreate,
+		updateStrategy:      strategyEndpoint,
+		providerSelection:   providerByHostname,
+		healthCheckInterval: defaultHealthInt,
+		healthMinInterval:   15,
+		healthMaxInterval:   4 * defaultHealthInt,
+		healthRelaxAfter:    5,
+		loadCheckInterval:   defaultLoadCheckInt,
+		reconcileInterval:   defaultReconcileInt,
+		restartTimeout:      120,
+		healthMode:          healthModeExec,
+		envChangePolicy:     envPolicyAdopt,
+		quarantineThreshold: defaultQuarantineN,
+		quarantineWindow:    defaultQuarantineWn,
+		quarantineDuration:  defaultQuarantineD,
+		endpointDeadFor:     3600,
+
+		targetTiers:       []selector.Tier{{}},
+		loadThreshold:     20,
+		selectionTopK:     1,
+		selectionLoadBand: 10,
+		preferredMaxLoad:  80,
+		forecastHours:     2,
+		wireguardPorts:    []string{"51820"},
+		wireguardMTUMax:   1420,
+
+		healthProbeURL:     "http://cp.cloudflare.com/generate_204",
+		pingTargets:        []string{defaultPingTarget},
+		ipv6Mode:           ipv6Off,
+		ipv6PingTarget:     "2606:4700:4700::1111",
+		ipv6PreferWeight:   25,
+		killSwitchProbeURL: "http://1.1.1.1/cdn-cgi/trace",
+		canaryMaxAttempts:  3,
+		maxRTTSamples:      3,
+		lossWindow:         6,
+
+		forwardedPortVar:      "FORWARDED_PORT",
+		allowlistMethod:       "POST",
+		triggerCooldown:       300,
+		reportMinute:          8 * 60,
+		selectorPluginTimeout: 10,
+		switchOnStart:         switchOnStartIfUnhealthy,
+		busyWindow:            120,
+		quietAllow:            splitList(defaultQuietAllow),
+		alertSwitchFailures:   3,
+	}
+}
+
+// setupTestEnv points the manager's file-backed state at a temp directory,
+// writes an env file recording currentServer, installs testConfig until the
+// test ends and resets the daemon's runtime state.
+func setupTestEnv(t *testing.T, currentServer string) {
+	t.Helper()
+	dir := t.TempDir()
+	prev := cfg
+	cfg = testConfig(dir)
+	t.Cleanup(func() {
+		for _, d := range testDaemons {
+			d.checks.Wait()
+		}
+		cfg, testDaemons = prev, nil
+	})
+	if err := os.WriteFile(cfg.envFile, []byte("PROTON_SERVER_NAME="+currentServer+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stateStore = loadStore(filepath.Join(dir, "state.json"))
+	stateStore.updateState(func(st *State) { st.Server = currentServer })
+	alerts, notifiers = newAlertManager(time.Hour, nil), nil
+	discovered.list, discovered.valid = nil, false
+	gluetunVersion.value = ""
+	serversJSONReload.Store(false)
+	wgPortIndex, tunnelMTU, activeProtocol = 0, 0, protocolWireGuard
+	wasmSelectors, healthPolicies = nil, nil
+	profiles = map[string]*profile{defaultProfile: currentSettings(defaultProfile)}
+	profileSchedule, activeProfile = nil, defaultProfile
+}
+
+// useFakeEngine routes container operations to handler, standing in for the
+// Docker Engine API, until the test ends.
+func useFakeEngine(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	engine := httptest.NewServer(handler)
+	t.Cleanup(engine.Close)
+	client, err := docker.NewClient("tcp://"+strings.TrimPrefix(engine.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docker.UseAPI(client)
+	t.Cleanup(func() { docker.UseAPI(nil) })
+}
+
+func newTestDaemon(source ServerSource, rt Runtime, checker HealthChecker, n ...Notifier) *daemon {
+	d := newDaemon(daemonDeps{Config: cfg, Source: source, Runtime: rt, Health: checker, Notifiers: n})
+	testDaemons = append(testDaemons, d)
+	return d
+}
+
+// testDaemons are the daemons the running test created; setupTestEnv waits
+// for their background checks before restoring the configuration.
+var testDaemons []*daemon
+
+var errTest = errors.New("test error")
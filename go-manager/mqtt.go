@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Minimal MQTT 3.1.1 client: QoS 0 publishing with retain, a last will, and
+// keepalive pings. That is all the state publisher needs, so we avoid pulling
+// in a full client library.
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPingreq    = 0xC0
+	mqttDisconnect = 0xE0
+)
+
+type mqttWill struct {
+	Topic   string
+	Payload string
+	Retain  bool
+}
+
+type mqttClient struct {
+	conn net.Conn
+	mu   sync.Mutex // serializes writes
+	done chan struct{}
+	err  error
+}
+
+// dialMQTT connects to tcp://, mqtt://, ssl:// or mqtts:// brokers.
+func dialMQTT(broker, clientID, username, password string, will *mqttWill, keepalive time.Duration) (*mqttClient, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostWithPort(u.Host, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(u.Host, "8883"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported MQTT scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqttClient{conn: conn, done: make(chan struct{})}
+	if err := c.handshake(clientID, username, password, will, keepalive); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func hostWithPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (c *mqttClient) handshake(clientID, username, password string, will *mqttWill, keepalive time.Duration) error {
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = appendMQTTString(payload, clientID)
+	if will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+		payload = appendMQTTString(payload, will.Topic)
+		payload = appendMQTTString(payload, will.Payload)
+	}
+	if username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, username)
+		if password != "" {
+			flags |= 0x40
+			payload = appendMQTTString(payload, password)
+		}
+	}
+
+	var header []byte
+	header = appendMQTTString(header, "MQTT")
+	header = append(header, 4, flags) // protocol level 3.1.1
+	header = binary.BigEndian.AppendUint16(header, uint16(keepalive/time.Second))
+
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.writePacket(mqttConnect, append(header, payload...)); err != nil {
+		return err
+	}
+
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, ack); err != nil {
+		return fmt.Errorf("reading CONNACK: %v", err)
+	}
+	if ack[0] != mqttConnack || ack[1] != 2 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", ack[0])
+	}
+	if ack[3] != 0 {
+		return fmt.Errorf("broker refused connection (code %d)", ack[3])
+	}
+	return nil
+}
+
+// readLoop drains incoming packets (PINGRESP) and notices disconnects.
+func (c *mqttClient) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		if _, err := r.ReadByte(); err != nil {
+			c.err = err
+			close(c.done)
+			return
+		}
+		length, err := readRemainingLength(r)
+		if err == nil {
+			_, err = r.Discard(length)
+		}
+		if err != nil {
+			c.err = err
+			close(c.done)
+			return
+		}
+	}
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	flags := byte(mqttPublish)
+	if retain {
+		flags |= 0x01
+	}
+	body := appendMQTTString(nil, topic)
+	return c.writePacket(flags, append(body, payload...))
+}
+
+func (c *mqttClient) ping() error {
+	return c.writePacket(mqttPingreq, nil)
+}
+
+// close disconnects cleanly, which tells the broker to drop the last will.
+// The publisher never does this: when it goes away the will has to fire.
+func (c *mqttClient) close() {
+	c.writePacket(mqttDisconnect, nil)
+	c.conn.Close()
+}
+
+func (c *mqttClient) writePacket(header byte, body []byte) error {
+	pkt := append([]byte{header}, encodeRemainingLength(len(body))...)
+	pkt = append(pkt, body...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(pkt)
+	return err
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func encodeRemainingLength(n int) []byte {
+	var out []byte
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		out = append(out, digit)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func readRemainingLength(r *bufio.Reader) (int, error) {
+	length, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+	return 0, fmt.Errorf("malformed remaining length")
+}
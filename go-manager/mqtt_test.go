@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// mqttPacket is one control packet as a broker sees it.
+type mqttPacket struct {
+	header byte
+	body   []byte
+}
+
+// startMQTTBroker accepts one connection, answers its CONNECT with the given
+// CONNACK return code and passes on every packet it receives.
+func startMQTTBroker(t *testing.T, code byte) (string, <-chan mqttPacket) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	packets := make(chan mqttPacket, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				close(packets)
+				return
+			}
+			length, err := readRemainingLength(r)
+			if err != nil {
+				close(packets)
+				return
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(r, body); err != nil {
+				close(packets)
+				return
+			}
+			if header == mqttConnect {
+				conn.Write([]byte{mqttConnack, 2, 0, code})
+			}
+			packets <- mqttPacket{header, body}
+		}
+	}()
+	return "tcp://" + l.Addr().String(), packets
+}
+
+// mqttStrings splits a body into its length-prefixed strings.
+func mqttStrings(t *testing.T, b []byte) []string {
+	t.Helper()
+	var out []string
+	for len(b) > 0 {
+		if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+			t.Fatalf("truncated string in %x", b)
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		out = append(out, string(b[2:2+n]))
+		b = b[2+n:]
+	}
+	return out
+}
+
+func TestMQTTConnect(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		will               *mqttWill
+		username, password string
+		flags              byte
+		payload            []string
+	}{
+		{"bare", nil, "", "", 0x02, []string{"node"}},
+		{"will", &mqttWill{Topic: "vpn/availability", Payload: "offline"}, "", "", 0x06, []string{"node", "vpn/availability", "offline"}},
+		{"retained will", &mqttWill{Topic: "t", Payload: "offline", Retain: true}, "", "", 0x26, []string{"node", "t", "offline"}},
+		{"username", nil, "ha", "", 0x82, []string{"node", "ha"}},
+		{"credentials", &mqttWill{Topic: "t", Payload: "p", Retain: true}, "ha", "secret", 0xE6, []string{"node", "t", "p", "ha", "secret"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			broker, packets := startMQTTBroker(t, 0)
+			client, err := dialMQTT(broker, "node", tc.username, tc.password, tc.will, 90*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.conn.Close()
+
+			pkt := <-packets
+			if pkt.header != mqttConnect {
+				t.Fatalf("first packet 0x%02x, want CONNECT", pkt.header)
+			}
+			// Variable header: "MQTT", level 4, flags, keepalive
+			want := []byte{0, 4, 'M', 'Q', 'T', 'T', 4, tc.flags, 0, 90}
+			if len(pkt.body) < len(want) || !bytes.Equal(pkt.body[:len(want)], want) {
+				t.Fatalf("variable header = %x, want %x", pkt.body[:min(len(want), len(pkt.body))], want)
+			}
+			payload := mqttStrings(t, pkt.body[len(want):])
+			if len(payload) != len(tc.payload) {
+				t.Fatalf("payload = %q, want %q", payload, tc.payload)
+			}
+			for i := range payload {
+				if payload[i] != tc.payload[i] {
+					t.Errorf("payload = %q, want %q", payload, tc.payload)
+				}
+			}
+		})
+	}
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	broker, _ := startMQTTBroker(t, 5) // not authorized
+	if _, err := dialMQTT(broker, "node", "ha", "wrong", nil, time.Minute); err == nil {
+		t.Error("connected although the broker refused")
+	}
+	if _, err := dialMQTT("ws://broker:80", "node", "", "", nil, time.Minute); err == nil {
+		t.Error("accepted a ws:// broker")
+	}
+}
+
+func TestMQTTPublish(t *testing.T) {
+	broker, packets := startMQTTBroker(t, 0)
+	client, err := dialMQTT(broker, "node", "", "", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-packets // CONNECT
+
+	// Large enough for a two-byte remaining length
+	large := bytes.Repeat([]byte("x"), 300)
+	for _, tc := range []struct {
+		topic   string
+		payload []byte
+		retain  bool
+		header  byte
+	}{
+		{"vpn/state", []byte(`{"healthy":true}`), false, 0x30},
+		{"vpn/availability", []byte("online"), true, 0x31},
+		{"vpn/big", large, false, 0x30},
+	} {
+		if err := client.publish(tc.topic, tc.payload, tc.retain); err != nil {
+			t.Fatal(err)
+		}
+		pkt := <-packets
+		if pkt.header != tc.header {
+			t.Errorf("%s: header 0x%02x, want 0x%02x", tc.topic, pkt.header, tc.header)
+		}
+		n := int(binary.BigEndian.Uint16(pkt.body))
+		if topic, payload := string(pkt.body[2:2+n]), pkt.body[2+n:]; topic != tc.topic || !bytes.Equal(payload, tc.payload) {
+			t.Errorf("PUBLISH = %s %q, want %s %q", topic, payload, tc.topic, tc.payload)
+		}
+	}
+
+	if err := client.ping(); err != nil {
+		t.Fatal(err)
+	}
+	if pkt := <-packets; pkt.header != mqttPingreq || len(pkt.body) != 0 {
+		t.Errorf("ping sent 0x%02x %x", pkt.header, pkt.body)
+	}
+
+	client.close()
+	if pkt := <-packets; pkt.header != mqttDisconnect || len(pkt.body) != 0 {
+		t.Errorf("close sent 0x%02x %x, want DISCONNECT", pkt.header, pkt.body)
+	}
+	if _, ok := <-packets; ok {
+		t.Error("connection still open after close")
+	}
+}
+
+func TestMQTTConnectionLost(t *testing.T) {
+	broker, packets := startMQTTBroker(t, 0)
+	client, err := dialMQTT(broker, "node", "", "", nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-packets // CONNECT
+
+	// The read loop notices when the connection goes away
+	client.conn.Close()
+	select {
+	case <-client.done:
+	case <-time.After(5 * time.Second):
+		t.Error("done not closed after the connection dropped")
+	}
+}
+
+// Remaining length encodings from the MQTT 3.1.1 spec, section 2.2.3.
+func TestMQTTRemainingLength(t *testing.T) {
+	for _, tc := range []struct {
+		n       int
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{268435455, []byte{0xff, 0xff, 0xff, 0x7f}},
+	} {
+		if got := encodeRemainingLength(tc.n); !bytes.Equal(got, tc.encoded) {
+			t.Errorf("encode(%d) = %x, want %x", tc.n, got, tc.encoded)
+		}
+		if got, err := readRemainingLength(bufio.NewReader(bytes.NewReader(tc.encoded))); err != nil || got != tc.n {
+			t.Errorf("read(%x) = %d, %v, want %d", tc.encoded, got, err, tc.n)
+		}
+	}
+
+	for _, bad := range [][]byte{
+		{0xff, 0xff, 0xff, 0xff, 0x01}, // five bytes
+		{0x80},                         // truncated
+	} {
+		if _, err := readRemainingLength(bufio.NewReader(bytes.NewReader(bad))); err == nil {
+			t.Errorf("read(%x) succeeded", bad)
+		}
+	}
+}
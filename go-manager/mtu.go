@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// WireGuard over IPv4 adds 60 bytes to every packet: 20 for the IP header,
+// 8 for UDP and 32 for its own header and authentication tag. Below 1280 the
+// tunnel can't carry IPv6.
+const (
+	wireguardOverhead = 60
+	minTunnelMTU      = 1280
+)
+
+// tunnelMTU is the WIREGUARD_MTU the manager writes with MTU_PROBE, 0 until
+// it has been probed or read back from the env file. After init it is only
+// touched under the daemon's opMu.
+var tunnelMTU int
+
+// probeTunnelMTU measures the path MTU to a WireGuard endpoint and sets
+// tunnelMTU to the largest tunnel MTU that fits through it. A failed probe
+// keeps the previous value.
+func probeTunnelMTU(ip string) {
+	pmtu, err := health.PathMTU(ip, cfg.wireguardMTUMax+wireguardOverhead, time.Second)
+	if err != nil {
+		log(fmt.Sprintf("MTU probe to %s failed: %v", ip, err))
+		return
+	}
+	wgMTU := tunnelMTUFor(pmtu)
+	if wgMTU+wireguardOverhead > pmtu {
+		log(fmt.Sprintf("Path MTU to %s is only %d; WireGuard packets will be fragmented", ip, pmtu))
+	}
+	if wgMTU != tunnelMTU {
+		log(fmt.Sprintf("Path MTU to %s is %d, using WireGuard MTU %d", ip, pmtu, wgMTU))
+	}
+	tunnelMTU = wgMTU
+}
+
+// tunnelMTUFor returns the tunnel MTU for a path MTU, within
+// minTunnelMTU..WIREGUARD_MTU_MAX.
+func tunnelMTUFor(pmtu int) int {
+	return max(min(pmtu-wireguardOverhead, cfg.wireguardMTUMax), minTunnelMTU)
+}
+
+// syncTunnelMTU continues with the MTU recorded in the env file, so a
+// manager restart doesn't drop it before the next switch probes again.
+func syncTunnelMTU(value string) {
+	if n, err := strconv.Atoi(value); cfg.mtuProbe && err == nil && n >= minTunnelMTU {
+		tunnelMTU = n
+	}
+}
+
+// mtuEnvVars returns WIREGUARD_MTU once it has been probed.
+func mtuEnvVars() map[string]string {
+	if !cfg.mtuProbe || tunnelMTU == 0 {
+		return nil
+	}
+	return map[string]string{"WIREGUARD_MTU": strconv.Itoa(tunnelMTU)}
+}
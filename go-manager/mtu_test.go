@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTunnelMTUFor(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	tests := []struct {
+		pmtu, want int
+	}{
+		{1500, 1420}, // Ethernet: capped at WIREGUARD_MTU_MAX
+		{1492, 1420}, // PPPoE
+		{1460, 1400},
+		{1400, 1340}, // some LTE carriers
+		{1300, 1280}, // never below what IPv6 needs
+	}
+	for _, tt := range tests {
+		if got := tunnelMTUFor(tt.pmtu); got != tt.want {
+			t.Errorf("tunnelMTUFor(%d) = %d, want %d", tt.pmtu, got, tt.want)
+		}
+	}
+}
+
+func TestManagedMTU(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	server := &LogicalServer{Name: "US#2"}
+	endpoint := &Server{EntryIP: "10.0.0.2", X25519PublicKey: "key"}
+
+	// Not probed yet: the env file's value, if any, is left alone
+	cfg.mtuProbe = true
+	if _, ok := managedEnvVars(server, endpoint)["WIREGUARD_MTU"]; ok {
+		t.Error("WIREGUARD_MTU managed before a probe")
+	}
+	syncTunnelMTU("1380")
+	if got := managedEnvVars(server, endpoint)["WIREGUARD_MTU"]; got != "1380" {
+		t.Errorf("WIREGUARD_MTU = %q, want 1380 from the env file", got)
+	}
+	if !slices.Contains(comparedEnvKeys(), "WIREGUARD_MTU") {
+		t.Error("WIREGUARD_MTU not compared against the running gluetun")
+	}
+}
+
+func TestPreferWireguardPort(t *testing.T) {
+	ports := []string{"51820", "88", "1224"}
+	tests := []struct {
+		port string
+		want []string
+	}{
+		{"", ports},
+		{"88", []string{"88", "51820", "1224"}},
+		{"4569", []string{"4569", "51820", "88", "1224"}},
+		{"70000", ports},
+	}
+	for _, tt := range tests {
+		if got := preferWireguardPort(ports, tt.port); !slices.Equal(got, tt.want) {
+			t.Errorf("preferWireguardPort(%q) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gluetun-proton-manager/runtime/nomad"
+)
+
+// nomadRuntime is the Runtime for gluetun running as a Nomad task. The env
+// file stays the manager's record; Restart copies the managed variables into
+// the job's task env, or into Nomad Variables when NOMAD_VARIABLES_PATH is
+// set, and Nomad restarts the task with them.
+type nomadRuntime struct {
+	pushed time.Time
+}
+
+func (*nomadRuntime) Apply(server *LogicalServer) bool { return updateEnv(server) }
+
+func (r *nomadRuntime) Restart() bool {
+	log(fmt.Sprintf("Updating Nomad job %s...", cfg.nomadJob))
+	r.pushed = time.Now().Truncate(time.Second)
+	if err := pushNomadEnv(syncedEnvVars()); err != nil {
+		log(fmt.Sprintf("Failed to update Nomad job: %v", err))
+	}
+	return true
+}
+
+// WaitReady waits for an allocation whose gluetun task started after the
+// update, then for the tunnel itself.
+func (r *nomadRuntime) WaitReady(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	client := nomadClient()
+	for {
+		allocs, err := client.Allocations(cfg.nomadJob)
+		if err != nil {
+			log(fmt.Sprintf("Nomad: %v", err))
+		} else if nomad.TaskRunningSince(allocs, cfg.nomadGroup, cfg.nomadTask, r.pushed) && tunnelReady() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+func nomadClient() *nomad.Client {
+	return nomad.New(cfg.nomadAddr, cfg.nomadToken, cfg.nomadNamespace)
+}
+
+// pushNomadEnv writes env into Nomad Variables or the task's env block. An
+// env block change is a job update, which Nomad rolls out as a new
+// allocation; a variables change re-renders the job's template, which
+// restarts the task according to its change_mode.
+func pushNomadEnv(env map[string]string) error {
+	client := nomadClient()
+	if cfg.nomadVarsPath != "" {
+		items, index, err := client.Variables(cfg.nomadVarsPath)
+		if err != nil {
+			return err
+		}
+		for k, v := range env {
+			items[k] = v
+		}
+		return client.PutVariables(cfg.nomadVarsPath, items, index)
+	}
+
+	job, err := client.Job(cfg.nomadJob)
+	if err != nil {
+		return err
+	}
+	if _, err := job.SetTaskEnv(cfg.nomadGroup, cfg.nomadTask, env); err != nil {
+		return err
+	}
+	return client.Register(job)
+}
+
+// nomadEnv returns the variables gluetun is currently given by Nomad.
+func nomadEnv() (map[string]string, error) {
+	client := nomadClient()
+	if cfg.nomadVarsPath != "" {
+		items, _, err := client.Variables(cfg.nomadVarsPath)
+		return items, err
+	}
+	job, err := client.Job(cfg.nomadJob)
+	if err != nil {
+		return nil, err
+	}
+	return job.TaskEnv(cfg.nomadGroup, cfg.nomadTask)
+}
+
+// nomadProblems lists the settings that can't be used with RUNTIME=nomad.
+func nomadProblems() []string {
+	var problems []string
+	if cfg.nomadJob == "" || cfg.nomadTask == "" {
+		problems = append(problems, "NOMAD_JOB and NOMAD_TASK must be set with RUNTIME=nomad")
+	}
+	if !slices.Contains([]string{healthModeNative, healthModeProxy}, cfg.healthMode) {
+		problems = append(problems, "RUNTIME=nomad needs HEALTH_MODE=native or proxy")
+	}
+	return append(problems, dockerOnlyProblems()...)
+}
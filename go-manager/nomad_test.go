@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// fakeNomadJob serves a one-task job and records the update it receives.
+func fakeNomadJob(t *testing.T) (*sync.Mutex, *map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var registered map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/job/gluetun":
+			w.Write([]byte(`{"ID": "gluetun", "JobModifyIndex": 7, "TaskGroups": [{"Name": "vpn", "Tasks": [
+				{"Name": "gluetun", "Env": {"VPN_TYPE": "wireguard", "WIREGUARD_ENDPOINT_IP": "10.0.0.1"}}
+			]}]}`))
+		case "POST /v1/job/gluetun":
+			json.NewDecoder(r.Body).Decode(&registered)
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	cfg.nomadAddr, cfg.nomadToken, cfg.nomadNamespace = srv.URL, "", ""
+	cfg.nomadJob, cfg.nomadGroup, cfg.nomadTask, cfg.nomadVarsPath = "gluetun", "", "gluetun", ""
+	return &mu, &registered
+}
+
+func TestNomadRestartUpdatesTaskEnv(t *testing.T) {
+	setupTestEnv(t, "US#2")
+	mu, registered := fakeNomadJob(t)
+	cfg.runtimeBackend = runtimeNomad
+	env := "PROTON_SERVER_NAME=US#2\nWIREGUARD_ENDPOINT_IP=10.0.0.2\nWIREGUARD_ENDPOINT_PORT=51820\nWIREGUARD_PUBLIC_KEY=key2\nWIREGUARD_PRIVATE_KEY=secret\n"
+	if err := os.WriteFile(cfg.envFile, []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := runningGluetunEnv()
+	if err != nil || running["WIREGUARD_ENDPOINT_IP"] != "10.0.0.1" {
+		t.Fatalf("running env = %v, %v", running, err)
+	}
+
+	(&nomadRuntime{}).Restart()
+	mu.Lock()
+	defer mu.Unlock()
+	job, _ := (*registered)["Job"].(map[string]any)
+	if job == nil {
+		t.Fatal("job was not updated")
+	}
+	task := job["TaskGroups"].([]any)[0].(map[string]any)["Tasks"].([]any)[0].(map[string]any)
+	got := task["Env"].(map[string]any)
+	if got["WIREGUARD_ENDPOINT_IP"] != "10.0.0.2" || got["PROTON_SERVER_NAME"] != "US#2" || got["VPN_TYPE"] != "wireguard" {
+		t.Errorf("task env = %v", got)
+	}
+	if _, ok := got["WIREGUARD_PRIVATE_KEY"]; ok {
+		t.Error("unmanaged variable copied into the job")
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert kinds. Only events that need a human are raised as alerts.
+type alertKind string
+
+const (
+	alertAuthFailure       alertKind = "auth_failure"
+	alertUnhealthy         alertKind = "unhealthy"
+	alertSwitchFailure     alertKind = "switch_failure"
+	alertProtocolFallback  alertKind = "protocol_fallback"
+	alertHumanVerification alertKind = "human_verification"
+	alertSubscription      alertKind = "subscription_expired"
+	alertReauth            alertKind = "reauthentication"
+	alertLeak              alertKind = "kill_switch_leak"
+	alertProxy             alertKind = "proxy_down"
+	// alertReport is a scheduled report rather than an alert; it skips the
+	// cooldowns
+	alertReport alertKind = "report"
+)
+
+// alertKinds are the kinds NOTIFY_COOLDOWNS can name.
+var alertKinds = []alertKind{alertAuthFailure, alertUnhealthy, alertSwitchFailure, alertProtocolFallback,
+	alertHumanVerification, alertSubscription, alertReauth, alertLeak, alertProxy}
+
+type alert struct {
+	Kind     alertKind
+	Subject  string
+	Body     string
+	Time     time.Time
+	Resolved bool
+}
+
+// Notifier delivers alerts to one backend.
+type Notifier interface {
+	Name() string
+	Send(a alert) error
+}
+
+var (
+	notifiers []Notifier
+	notifyWG  sync.WaitGroup
+	// alerts is replaced with the configured cooldowns by setupNotifiers;
+	// commands that run before it, such as validate, raise nothing
+	alerts = newAlertManager(time.Hour, nil)
+)
+
+// alertManager sits in front of every backend. It coalesces an alert that
+// keeps being raised into a single message, repeated at most once per cooldown
+// while it lasts, followed by a recovery message once it is resolved.
+type alertManager struct {
+	mu              sync.Mutex
+	defaultCooldown time.Duration
+	cooldowns       map[alertKind]time.Duration
+	incidents       map[alertKind]*incident
+}
+
+// incident is the state of one alert kind.
+type incident struct {
+	active   bool
+	notified bool // the active incident was announced
+	since    time.Time
+	lastSent time.Time
+	repeats  int
+}
+
+func newAlertManager(defaultCooldown time.Duration, cooldowns map[alertKind]time.Duration) *alertManager {
+	return &alertManager{
+		defaultCooldown: defaultCooldown,
+		cooldowns:       cooldowns,
+		incidents:       make(map[alertKind]*incident),
+	}
+}
+
+// parseCooldowns reads "kind:seconds,..." overrides.
+func parseCooldowns(spec string) (map[alertKind]time.Duration, error) {
+	cooldowns := make(map[alertKind]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		kind, secs, ok := strings.Cut(entry, ":")
+		n, err := strconv.Atoi(strings.TrimSpace(secs))
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("NOTIFY_COOLDOWNS: %q is not kind:seconds", entry)
+		}
+		k := alertKind(strings.TrimSpace(kind))
+		if !slices.Contains(alertKinds, k) {
+			return nil, fmt.Errorf("NOTIFY_COOLDOWNS: unknown alert kind %q", k)
+		}
+		cooldowns[k] = time.Duration(n) * time.Second
+	}
+	return cooldowns, nil
+}
+
+// setupNotifiers builds the configured notifier backends.
+func setupNotifiers() {
+	alerts = newAlertManager(time.Duration(cfg.notifyCooldown)*time.Second, cfg.notifyCooldowns)
+	if cfg.smtpHost != "" {
+		notifiers = append(notifiers, newSMTPNotifier())
+	}
+}
+
+func (m *alertManager) cooldown(kind alertKind) time.Duration {
+	if d, ok := m.cooldowns[kind]; ok {
+		return d
+	}
+	return m.defaultCooldown
+}
+
+func (m *alertManager) incident(kind alertKind) *incident {
+	inc, ok := m.incidents[kind]
+	if !ok {
+		inc = &incident{}
+		m.incidents[kind] = inc
+	}
+	return inc
+}
+
+// raise records an occurrence of kind and reports whether it should be sent.
+func (m *alertManager) raise(a *alert) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inc := m.incident(a.Kind)
+	cooledDown := a.Time.Sub(inc.lastSent) >= m.cooldown(a.Kind)
+
+	if !inc.active {
+		inc.active, inc.notified = true, false
+		inc.since, inc.repeats = a.Time, 0
+	} else {
+		inc.repeats++
+		if inc.notified && cooledDown {
+			a.Subject = "Still ongoing: " + a.Subject
+			a.Body += fmt.Sprintf("\n\nRaised %d more times since %s.", inc.repeats, inc.since.Format(time.RFC1123))
+		}
+	}
+	if !cooledDown {
+		return false
+	}
+	inc.notified = true
+	inc.lastSent = a.Time
+	return true
+}
+
+// resolve closes the incident for kind. It returns the recovery message to
+// send, or false if the incident was never announced.
+func (m *alertManager) resolve(kind alertKind, subject string, now time.Time) (alert, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inc := m.incident(kind)
+	if !inc.active {
+		return alert{}, false
+	}
+	announced := inc.notified
+	inc.active, inc.notified = false, false
+	if !announced {
+		return alert{}, false
+	}
+
+	body := fmt.Sprintf("Resolved after %s.", now.Sub(inc.since).Round(time.Second))
+	if inc.repeats > 0 {
+		body += fmt.Sprintf(" The alert was raised %d more times meanwhile.", inc.repeats)
+	}
+	return alert{Kind: kind, Subject: "Resolved: " + subject, Body: body, Time: now, Resolved: true}, true
+}
+
+// notify raises an alert, sending it to every backend in the background
+// unless it repeats one still in its cooldown.
+func notify(kind alertKind, subject, body string) {
+	a := alert{Kind: kind, Subject: subject, Body: body, Time: time.Now()}
+	// A quieted alert doesn't open an incident, so a problem that outlasts
+	// quiet hours is announced on its next occurrence.
+	if quieted(a) || !alerts.raise(&a) {
+		return
+	}
+	dispatch(a)
+}
+
+// resolveAlert sends a recovery message if an alert of this kind is open.
+func resolveAlert(kind alertKind, subject string) {
+	if a, ok := alerts.resolve(kind, subject, time.Now()); ok && !quieted(a) {
+		dispatch(a)
+	}
+}
+
+func dispatch(a alert) {
+	for _, n := range notifiers {
+		notifyWG.Add(1)
+		go func(n Notifier) {
+			defer notifyWG.Done()
+			if err := cfg.notifyRetry.Do(context.Background(), func() error { return n.Send(a) }); err != nil {
+				log(fmt.Sprintf("Failed to send %s alert via %s: %v", a.Kind, n.Name(), err))
+			}
+		}(n)
+	}
+}
+
+// flushNotifications waits up to timeout for in-flight alerts, so an alert
+// raised right before exiting still goes out.
+func flushNotifications(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		notifyWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
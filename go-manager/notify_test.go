@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCooldowns(t *testing.T) {
+	cooldowns, err := parseCooldowns(" unhealthy:1800, switch_failure:0,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cooldowns) != 2 || cooldowns[alertUnhealthy] != 30*time.Minute || cooldowns[alertSwitchFailure] != 0 {
+		t.Errorf("cooldowns = %v", cooldowns)
+	}
+	if cooldowns, err := parseCooldowns(""); err != nil || len(cooldowns) != 0 {
+		t.Errorf("empty spec = %v, %v", cooldowns, err)
+	}
+	for _, bad := range []string{"unhealthy", "unhealthy:soon", "unhealthy:-5", "weather:60"} {
+		if _, err := parseCooldowns(bad); err == nil {
+			t.Errorf("parseCooldowns(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAlertCoalescing(t *testing.T) {
+	m := newAlertManager(time.Hour, nil)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	raise := func(after time.Duration) (alert, bool) {
+		a := alert{Kind: alertUnhealthy, Subject: "Tunnel unhealthy", Time: start.Add(after)}
+		return a, m.raise(&a)
+	}
+
+	if _, sent := raise(0); !sent {
+		t.Fatal("first alert held back")
+	}
+	for i := 1; i <= 3; i++ {
+		if _, sent := raise(time.Duration(i) * time.Minute); sent {
+			t.Fatalf("repeat %d inside the cooldown was sent", i)
+		}
+	}
+	a, sent := raise(time.Hour)
+	if !sent || !strings.HasPrefix(a.Subject, "Still ongoing: ") || !strings.Contains(a.Body, "Raised 4 more times") {
+		t.Errorf("reminder after the cooldown = %+v, sent %v", a, sent)
+	}
+
+	r, ok := m.resolve(alertUnhealthy, "Tunnel unhealthy", start.Add(90*time.Minute))
+	if !ok || r.Subject != "Resolved: Tunnel unhealthy" || !r.Resolved || !strings.Contains(r.Body, "1h30m0s") {
+		t.Errorf("recovery = %+v, %v", r, ok)
+	}
+	if _, ok := m.resolve(alertUnhealthy, "Tunnel unhealthy", start.Add(91*time.Minute)); ok {
+		t.Error("second recovery message for one incident")
+	}
+
+	// Recurring within the cooldown of the last message, the problem is
+	// neither announced nor resolved again
+	if _, sent := raise(95 * time.Minute); sent {
+		t.Error("recurrence inside the cooldown was sent")
+	}
+	if _, ok := m.resolve(alertUnhealthy, "Tunnel unhealthy", start.Add(96*time.Minute)); ok {
+		t.Error("recovery sent for an incident never announced")
+	}
+}
+
+func TestAlertCooldownsPerKind(t *testing.T) {
+	m := newAlertManager(time.Hour, map[alertKind]time.Duration{alertSwitchFailure: time.Minute})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	sent := map[alertKind]int{}
+	for i := 0; i < 10; i++ {
+		for _, kind := range []alertKind{alertSwitchFailure, alertUnhealthy} {
+			a := alert{Kind: kind, Time: now.Add(time.Duration(i) * 30 * time.Second)}
+			if m.raise(&a) {
+				sent[kind]++
+			}
+		}
+	}
+	// Over four and a half minutes: every minute for switch failures, once
+	// for the default hour
+	if sent[alertSwitchFailure] != 5 || sent[alertUnhealthy] != 1 {
+		t.Errorf("sent %v", sent)
+	}
+}
+
+func TestNotifySendsOneRecovery(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	n := newMockNotifier(t)
+	notifiers = []Notifier{n}
+
+	for i := 0; i < 5; i++ {
+		notify(alertProxy, proxySubject, "down")
+	}
+	resolveAlert(alertProxy, proxySubject)
+	resolveAlert(alertProxy, proxySubject)
+	flushNotifications(time.Second)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var raised, recovered []alert
+	for _, a := range n.sent {
+		if a.Resolved {
+			recovered = append(recovered, a)
+		} else {
+			raised = append(raised, a)
+		}
+	}
+	if len(raised) != 1 || len(recovered) != 1 {
+		t.Fatalf("sent %+v, want one alert and one recovery", n.sent)
+	}
+	if !strings.Contains(recovered[0].Body, "raised 4 more times") {
+		t.Errorf("recovery body = %q", recovered[0].Body)
+	}
+}
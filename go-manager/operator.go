@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/runtime/kubernetes"
+	"gluetun-proton-manager/selector"
+)
+
+// tunnelPollInterval is how often the VPNTunnel is re-read for spec changes.
+const tunnelPollInterval = 30 * time.Second
+
+// tunnel is the VPNTunnel the operator follows.
+var tunnel struct {
+	mu         sync.Mutex
+	spec       kubernetes.TunnelSpec
+	generation int64
+}
+
+func tunnelSpec() kubernetes.TunnelSpec {
+	tunnel.mu.Lock()
+	defer tunnel.mu.Unlock()
+	return tunnel.spec
+}
+
+// kubeRuntime is the Runtime for gluetun running in Kubernetes. The env file
+// mirrors the VPNTunnel's Secret; Restart copies the managed variables into
+// the Secret and rolls the workload so its pods pick them up.
+type kubeRuntime struct{}
+
+func (kubeRuntime) Apply(server *LogicalServer) bool { return updateEnv(server) }
+
+func (kubeRuntime) Restart() bool {
+	spec := tunnelSpec()
+	log(fmt.Sprintf("Restarting %s...", spec.Workload))
+	if err := kubeClient.UpdateSecret(spec.SecretName, syncedEnvVars()); err != nil {
+		log(fmt.Sprintf("Failed to update Secret: %v", err))
+		return true
+	}
+	if err := kubeClient.Restart(spec.Workload, time.Now()); err != nil {
+		log(fmt.Sprintf("Failed to restart gluetun: %v", err))
+	}
+	return true
+}
+
+// WaitReady waits for the restart to roll out, then for the tunnel itself.
+func (kubeRuntime) WaitReady(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	workload := tunnelSpec().Workload
+	for {
+		done, err := kubeClient.RolledOut(workload)
+		if err != nil {
+			log(fmt.Sprintf("Kubernetes: %v", err))
+		} else if done && tunnelReady() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// kubeEnv returns the variables gluetun is currently given by its Secret.
+func kubeEnv() (map[string]string, error) {
+	return kubeClient.Secret(tunnelSpec().SecretName)
+}
+
+// tunnelProfile turns a VPNTunnel spec into a profile named after the
+// tunnel. Settings the spec leaves out come from the plain configuration.
+func tunnelProfile(spec kubernetes.TunnelSpec) (*profile, error) {
+	if spec.SecretName == "" || spec.Workload == "" {
+		return nil, fmt.Errorf("spec.secretName and spec.workload are required")
+	}
+	p := *currentSettings(cfg.kubeTunnel)
+	if base, ok := profiles[defaultProfile]; ok {
+		p = *base
+		p.Name = cfg.kubeTunnel
+	}
+	if len(spec.Countries) > 0 || len(spec.Regions) > 0 || spec.Country != "" || len(spec.Cities) > 0 || spec.Auto {
+		tiers, err := selector.ParseTargets(strings.Join(spec.Countries, ","), strings.Join(spec.Regions, ","),
+			spec.Auto, strings.ToUpper(spec.Country), spec.Cities)
+		if err != nil {
+			return nil, err
+		}
+		p.Tiers = tiers
+	}
+	if spec.Fallback != nil {
+		p.Fallback = *spec.Fallback
+	}
+	if len(spec.Features) > 0 {
+		features, err := protonapi.ParseFeatures(strings.Join(spec.Features, ","))
+		if err != nil {
+			return nil, err
+		}
+		p.Features = features
+	}
+	if spec.LoadThreshold != nil {
+		p.Threshold = *spec.LoadThreshold
+	}
+	if len(spec.PreferredServers) > 0 {
+		p.Preferred = nil
+		for _, s := range spec.PreferredServers {
+			p.Preferred = append(p.Preferred, strings.ToUpper(s))
+		}
+	}
+	if spec.PreferredMaxLoad != nil {
+		p.PreferredMaxLoad = *spec.PreferredMaxLoad
+	}
+	return &p, nil
+}
+
+// applyTunnel makes a VPNTunnel's spec current. After startup, a changed
+// spec wakes the load loop so the server is re-evaluated under it.
+func (d *daemon) applyTunnel(t *kubernetes.Tunnel, startup bool) error {
+	p, err := tunnelProfile(t.Spec)
+	if err != nil {
+		return fmt.Errorf("vpntunnel %s: %v", d.cfg.kubeTunnel, err)
+	}
+	if !startup {
+		d.opMu.Lock()
+		defer d.opMu.Unlock()
+	}
+	profiles[d.cfg.kubeTunnel] = p
+	applyProfile(d.cfg.kubeTunnel)
+	tunnel.mu.Lock()
+	tunnel.spec, tunnel.generation = t.Spec, t.Metadata.Generation
+	tunnel.mu.Unlock()
+
+	if !startup {
+		log(fmt.Sprintf("VPNTunnel %s changed (generation %d)", d.cfg.kubeTunnel, t.Metadata.Generation))
+		d.updateStatus(func(s *Status) { s.Profile = d.cfg.kubeTunnel })
+		d.requestFailover("")
+	}
+	return nil
+}
+
+// startOperator reads the VPNTunnel, waiting until it can, seeds the env
+// file from its Secret and starts following it. It runs before the daemon's
+// loops.
+func (d *daemon) startOperator() {
+	for {
+		t, err := kubeClient.Tunnel(d.cfg.kubeTunnel)
+		if err == nil {
+			err = d.applyTunnel(t, true)
+		}
+		if err == nil {
+			break
+		}
+		log(fmt.Sprintf("Operator: %v", err))
+		time.Sleep(tunnelPollInterval)
+	}
+
+	// The Secret is authoritative; the env file only mirrors it
+	if env, err := kubeEnv(); err != nil {
+		log(fmt.Sprintf("Operator: %v", err))
+	} else if len(env) > 0 {
+		if err := updateEnvFile(d.cfg.envFile, env); err != nil {
+			log(fmt.Sprintf("Operator: cannot seed %s: %v", d.cfg.envFile, err))
+		}
+	}
+	log(fmt.Sprintf("Operator: following VPNTunnel %s/%s", kubeClient.Namespace(), d.cfg.kubeTunnel))
+
+	go d.tunnelLoop()
+	go runTunnelStatusPublisher(d.watchStatus())
+}
+
+// tunnelLoop re-reads the VPNTunnel and applies spec changes.
+func (d *daemon) tunnelLoop() {
+	for range time.Tick(tunnelPollInterval) {
+		t, err := kubeClient.Tunnel(d.cfg.kubeTunnel)
+		if err != nil {
+			log(fmt.Sprintf("Operator: %v", err))
+			continue
+		}
+		tunnel.mu.Lock()
+		changed := t.Metadata.Generation != tunnel.generation
+		tunnel.mu.Unlock()
+		if changed {
+			if err := d.applyTunnel(t, false); err != nil {
+				log(fmt.Sprintf("Operator: %v", err))
+			}
+		}
+	}
+}
+
+// runTunnelStatusPublisher reports each status change on the VPNTunnel.
+func runTunnelStatusPublisher(statuses <-chan Status) {
+	var failing bool
+	for st := range statuses {
+		err := kubeClient.UpdateTunnelStatus(cfg.kubeTunnel, tunnelStatus(st))
+		if err != nil && !failing {
+			log(fmt.Sprintf("Operator: cannot update status: %v", err))
+		}
+		failing = err != nil
+	}
+}
+
+// tunnelStatus converts the daemon's status for the VPNTunnel.
+func tunnelStatus(st Status) kubernetes.TunnelStatus {
+	tunnel.mu.Lock()
+	generation := tunnel.generation
+	tunnel.mu.Unlock()
+	ts := kubernetes.TunnelStatus{
+		ObservedGeneration: generation,
+		State:              st.State,
+		Server:             st.Server,
+		Load:               st.Load,
+		Healthy:            st.Healthy,
+		ExitIP:             st.ExitIP,
+		LastSwitchReason:   st.LastSwitchReason,
+	}
+	if !st.LastSwitch.IsZero() {
+		ts.LastSwitch = st.LastSwitch.UTC().Format(time.RFC3339)
+	}
+	return ts
+}
+
+// kubeProblems lists the settings that can't be used with RUNTIME=kubernetes.
+func kubeProblems() []string {
+	var problems []string
+	if kubeClientErr != nil {
+		problems = append(problems, fmt.Sprintf("RUNTIME=kubernetes: %v", kubeClientErr))
+	}
+	if cfg.kubeTunnel == "" {
+		problems = append(problems, "KUBE_TUNNEL must be set with RUNTIME=kubernetes")
+	}
+	if cfg.healthMode != healthModeProxy {
+		problems = append(problems, "RUNTIME=kubernetes needs HEALTH_MODE=proxy")
+	}
+	if len(profileSchedule) > 0 {
+		problems = append(problems, "PROFILE_SCHEDULE isn't supported with RUNTIME=kubernetes; the VPNTunnel sets the selection")
+	}
+	return append(problems, dockerOnlyProblems()...)
+}
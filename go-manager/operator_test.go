@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/runtime/kubernetes"
+)
+
+func TestTunnelProfile(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	profiles = map[string]*profile{defaultProfile: currentSettings(defaultProfile)}
+	cfg.kubeTunnel = "home"
+	threshold, fallback := 35, true
+
+	p, err := tunnelProfile(kubernetes.TunnelSpec{
+		Country: "ch", Cities: []string{"Zurich"}, Features: []string{"p2p"},
+		LoadThreshold: &threshold, Fallback: &fallback,
+		SecretName: "gluetun-env", Workload: "deployment/gluetun",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "home" || p.Threshold != 35 || !p.Fallback || p.Features != protonapi.FeatureP2P {
+		t.Errorf("profile = %+v", p)
+	}
+	if len(p.Tiers) != 1 || p.Tiers[0].Countries[0] != "CH" || p.Tiers[0].Cities[0] != "Zurich" {
+		t.Errorf("tiers = %+v", p.Tiers)
+	}
+	if p.PreferredMaxLoad != cfg.preferredMaxLoad {
+		t.Errorf("unset PreferredMaxLoad = %d, want the configured %d", p.PreferredMaxLoad, cfg.preferredMaxLoad)
+	}
+
+	if _, err := tunnelProfile(kubernetes.TunnelSpec{Country: "CH"}); err == nil {
+		t.Error("spec without secretName and workload accepted")
+	}
+}
+
+func TestKubeRestartUpdatesSecret(t *testing.T) {
+	setupTestEnv(t, "CH#2")
+	env := "PROTON_SERVER_NAME=CH#2\nWIREGUARD_ENDPOINT_IP=10.0.0.2\nWIREGUARD_ENDPOINT_PORT=51820\nWIREGUARD_PUBLIC_KEY=key2\nWIREGUARD_PRIVATE_KEY=secret\n"
+	if err := os.WriteFile(cfg.envFile, []byte(env), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	patched := make(map[string]map[string]any)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		patched[r.Method+" "+r.URL.Path] = body
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+	kubeClient = kubernetes.New(srv.URL, "vpn", "", nil)
+	defer func() { kubeClient = nil }()
+	tunnel.spec = kubernetes.TunnelSpec{SecretName: "gluetun-env", Workload: "deployment/gluetun"}
+
+	kubeRuntime{}.Restart()
+	mu.Lock()
+	defer mu.Unlock()
+	data, _ := patched["PATCH /api/v1/namespaces/vpn/secrets/gluetun-env"]["data"].(map[string]any)
+	if data["WIREGUARD_ENDPOINT_IP"] != "MTAuMC4wLjI=" || data["PROTON_SERVER_NAME"] != "Q0gjMg==" {
+		t.Errorf("secret patch = %v", data)
+	}
+	if _, ok := data["WIREGUARD_PRIVATE_KEY"]; ok {
+		t.Error("unmanaged variable copied into the Secret")
+	}
+	if patched["PATCH /apis/apps/v1/namespaces/vpn/deployments/gluetun"] == nil {
+		t.Error("workload not restarted")
+	}
+}
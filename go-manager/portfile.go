@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"gluetun-proton-manager/envfile"
+)
+
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runPortPublisher writes the forwarded port to FORWARDED_PORT_FILE and
+// FORWARDED_PORT_ENV_FILE and hands it to the integrations whenever gluetun
+// reports a new one, for services that can't use the control API. The port
+// reads 0 while the tunnel is down, so the last known port stays in place
+// until the next one.
+func runPortPublisher(statuses <-chan Status) {
+	written := 0
+	for st := range statuses {
+		if st.ForwardedPort == 0 || st.ForwardedPort == written {
+			continue
+		}
+		if err := writeForwardedPort(st.ForwardedPort); err != nil {
+			log(fmt.Sprintf("Failed to write forwarded port %d: %v", st.ForwardedPort, err))
+			continue
+		}
+		if !setIntegrationPorts(st.ForwardedPort) {
+			continue
+		}
+		log(fmt.Sprintf("Forwarded port is now %d", st.ForwardedPort))
+		written = st.ForwardedPort
+	}
+}
+
+// writeForwardedPort writes port to the configured files.
+func writeForwardedPort(port int) error {
+	value := strconv.Itoa(port)
+	if cfg.forwardedPortFile != "" {
+		// Replace rather than rewrite, so readers never see a partial file
+		tmp := cfg.forwardedPortFile + ".tmp"
+		if err := os.WriteFile(tmp, []byte(value+"\n"), 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, cfg.forwardedPortFile); err != nil {
+			return err
+		}
+	}
+	if cfg.forwardedPortEnvFile != "" {
+		return envfile.Update(cfg.forwardedPortEnvFile, map[string]string{cfg.forwardedPortVar: value})
+	}
+	return nil
+}
+
+// portFileProblems reports FORWARDED_PORT_* settings that can't work.
+func portFileProblems() []string {
+	if cfg.forwardedPortFile == "" && cfg.forwardedPortEnvFile == "" {
+		return nil
+	}
+	var problems []string
+	if cfg.gluetunControlURL == "" {
+		problems = append(problems, "FORWARDED_PORT_FILE and FORWARDED_PORT_ENV_FILE need GLUETUN_CONTROL_URL to read the forwarded port")
+	}
+	if !envVarName.MatchString(cfg.forwardedPortVar) {
+		problems = append(problems, fmt.Sprintf("FORWARDED_PORT_VAR %q is not a valid variable name", cfg.forwardedPortVar))
+	}
+	return problems
+}
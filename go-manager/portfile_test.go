@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gluetun-proton-manager/envfile"
+)
+
+func TestForwardedPortFiles(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	dir := t.TempDir()
+	cfg.forwardedPortFile = filepath.Join(dir, "forwarded_port")
+	cfg.forwardedPortEnvFile = filepath.Join(dir, ".env")
+	os.WriteFile(cfg.forwardedPortEnvFile, []byte("TZ=UTC\nFORWARDED_PORT=1000\n"), 0644)
+
+	statuses := make(chan Status)
+	done := make(chan struct{})
+	go func() {
+		runPortPublisher(statuses)
+		close(done)
+	}()
+	statuses <- Status{ForwardedPort: 51820}
+	statuses <- Status{} // tunnel down: keep the last port
+	close(statuses)
+	<-done
+
+	if data, _ := os.ReadFile(cfg.forwardedPortFile); string(data) != "51820\n" {
+		t.Errorf("port file = %q, want 51820", data)
+	}
+	vars, err := envfile.Read(cfg.forwardedPortEnvFile)
+	if err != nil || vars["FORWARDED_PORT"] != "51820" || vars["TZ"] != "UTC" {
+		t.Errorf("env file = %v, %v", vars, err)
+	}
+}
+
+func TestPortFileProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.forwardedPortFile = "/tmp/port"
+	cfg.gluetunControlURL = ""
+	cfg.forwardedPortVar = "FORWARDED-PORT"
+	if p := portFileProblems(); len(p) != 2 {
+		t.Errorf("got %v, want 2 problems", p)
+	}
+}
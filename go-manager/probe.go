@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// Health check modes
+const (
+	healthModeExec   = "exec"   // docker exec ping inside the gluetun container
+	healthModeNative = "native" // probe directly; the manager shares gluetun's network namespace
+	// healthModeProxy probes the full VPN data path through gluetun's HTTP
+	// proxy or Shadowsocks listener, without needing exec access.
+	healthModeProxy = "proxy"
+)
+
+// healthChecker returns the checker for HEALTH_MODE, probing with
+// HEALTH_CMD or HEALTH_URL instead of a ping when one is set.
+func healthChecker() health.Checker {
+	switch {
+	case cfg.healthCmd != "" && cfg.healthMode == healthModeExec:
+		return health.CheckerFunc(func() bool { return docker.Shell(activeGluetun(), cfg.healthCmd) == nil })
+	case cfg.healthCmd != "" && cfg.healthMode == healthModeProxy:
+		// Commands that honour the usual proxy variables go through gluetun
+		env := []string{"HTTP_PROXY=" + cfg.healthProxyURL, "HTTPS_PROXY=" + cfg.healthProxyURL, "ALL_PROXY=" + cfg.healthProxyURL}
+		return health.Command{Cmd: cfg.healthCmd, Env: env}
+	case cfg.healthCmd != "":
+		return health.Command{Cmd: cfg.healthCmd}
+	case cfg.healthURL != "" && cfg.healthMode == healthModeExec:
+		return execURLChecker{url: cfg.healthURL, status: cfg.healthURLStatus, body: cfg.healthURLBody}
+	case cfg.healthURL != "":
+		probe := health.HTTP{URL: cfg.healthURL, Status: cfg.healthURLStatus, Body: cfg.healthURLBody}
+		if cfg.healthMode == healthModeProxy {
+			probe.ProxyURL = cfg.healthProxyURL
+		}
+		return probe
+	}
+	if cfg.healthMode == healthModeProxy {
+		return health.Proxy{ProxyURL: cfg.healthProxyURL, ProbeURL: cfg.healthProbeURL}
+	}
+	r := &rotatingChecker{}
+	for _, target := range cfg.pingTargets {
+		if cfg.healthMode == healthModeNative {
+			r.checkers = append(r.checkers, health.Native{Target: target})
+		} else {
+			r.checkers = append(r.checkers, execChecker{target: target})
+		}
+	}
+	return r
+}
+
+// rotatingChecker pings PING_TARGETS, starting one further along the list
+// each check so no single target sees every probe. The tunnel is healthy as
+// long as one target answers. RTT and loss are measured against the target
+// that last answered.
+type rotatingChecker struct {
+	checkers []health.Checker
+
+	mu   sync.Mutex
+	next int // where the next check starts
+	last int // the target that last answered
+}
+
+func (r *rotatingChecker) Check() bool {
+	if len(r.checkers) == 0 {
+		return false
+	}
+	r.mu.Lock()
+	start := r.next
+	r.next = (r.next + 1) % len(r.checkers)
+	r.mu.Unlock()
+
+	for i := range r.checkers {
+		n := (start + i) % len(r.checkers)
+		if r.checkers[n].Check() {
+			r.mu.Lock()
+			r.last = n
+			r.mu.Unlock()
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rotatingChecker) answered() health.Checker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkers[r.last]
+}
+
+func (r *rotatingChecker) RTT() (time.Duration, error) {
+	return r.answered().(health.RTTer).RTT()
+}
+
+func (r *rotatingChecker) Loss() (int, int, error) {
+	return r.answered().(health.LossMeter).Loss()
+}
+
+// execURLChecker fetches url from inside the active gluetun container.
+type execURLChecker struct {
+	url    string
+	status int
+	body   string
+}
+
+func (c execURLChecker) Check() bool {
+	status, err := docker.HTTPStatus(activeGluetun(), c.url)
+	if err != nil || !health.StatusOK(c.status, status) {
+		return false
+	}
+	if c.body == "" {
+		return true
+	}
+	body, err := docker.Fetch(activeGluetun(), c.url)
+	return err == nil && strings.Contains(string(body), c.body)
+}
+
+// execChecker pings target from inside the active gluetun container.
+type execChecker struct {
+	target string
+}
+
+func (c execChecker) Check() bool { return docker.Ping(activeGluetun(), c.target) }
+
+func (c execChecker) RTT() (time.Duration, error) { return docker.PingRTT(activeGluetun(), c.target) }
+
+func (c execChecker) Loss() (int, int, error) {
+	return docker.PingLoss(activeGluetun(), c.target, health.LossProbes)
+}
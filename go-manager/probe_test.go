@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+func TestCustomHealthProbes(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.healthMode = healthModeNative
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("tunnel ok"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		url    string
+		status int
+		body   string
+		want   bool
+	}{
+		{"any success", srv.URL, 0, "", true},
+		{"error status", srv.URL + "/down", 0, "", false},
+		{"expected status", srv.URL, 202, "", true},
+		{"other status", srv.URL, 200, "", false},
+		{"body found", srv.URL, 0, "ok", true},
+		{"body missing", srv.URL, 0, "blocked", false},
+	} {
+		cfg.healthURL, cfg.healthURLStatus, cfg.healthURLBody = tt.url, tt.status, tt.body
+		if got := healthChecker().Check(); got != tt.want {
+			t.Errorf("%s: healthy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A command takes precedence over the URL
+	cfg.healthCmd = "exit 1"
+	if healthChecker().Check() {
+		t.Error("failing HEALTH_CMD reported healthy")
+	}
+	cfg.healthCmd = "true"
+	if !healthChecker().Check() {
+		t.Error("succeeding HEALTH_CMD reported unhealthy")
+	}
+}
+
+// fakeTarget is a ping target that answers if up, counting its probes.
+type fakeTarget struct {
+	up    bool
+	calls *int
+	rtt   time.Duration
+}
+
+func (f fakeTarget) Check() bool                 { *f.calls++; return f.up }
+func (f fakeTarget) RTT() (time.Duration, error) { return f.rtt, nil }
+func (f fakeTarget) Loss() (int, int, error)     { return 5, 5, nil }
+
+func TestRotatingChecker(t *testing.T) {
+	var a, b, c int
+	r := &rotatingChecker{checkers: []health.Checker{
+		fakeTarget{up: true, calls: &a, rtt: time.Millisecond},
+		fakeTarget{up: false, calls: &b},
+		fakeTarget{up: true, calls: &c, rtt: 3 * time.Millisecond},
+	}}
+
+	// Checks start at successive targets, skipping the one that's down
+	for range 3 {
+		if !r.Check() {
+			t.Fatal("unhealthy while two targets answer")
+		}
+	}
+	if a != 1 || b != 1 || c != 2 {
+		t.Errorf("probes per target = %d, %d, %d; want 1, 1, 2", a, b, c)
+	}
+	if rtt, _ := r.RTT(); rtt != 3*time.Millisecond {
+		t.Errorf("RTT %v not from the target that last answered", rtt)
+	}
+
+	// Only all targets failing makes the tunnel unhealthy
+	r.checkers = []health.Checker{fakeTarget{calls: &a}, fakeTarget{calls: &b}}
+	if r.Check() {
+		t.Error("healthy with every target down")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/selector"
+)
+
+// defaultProfile names the selection settings from the plain configuration.
+const defaultProfile = "default"
+
+// profile is a named set of selection settings. The active profile's values
+// are held in cfg like the rest of the configuration, so everything that
+// selects servers follows it without knowing about profiles.
+type profile struct {
+	Name             string
+	Tiers            []selector.Tier
+	Fallback         bool
+	Features         int
+	Threshold        int
+	Preferred        []string
+	PreferredMaxLoad int
+}
+
+// scheduleEntry activates Profile from Minute (of the day) on.
+type scheduleEntry struct {
+	Minute  int
+	Profile string
+}
+
+var (
+	profiles        map[string]*profile
+	profileSchedule []scheduleEntry
+	profilesErr     error
+	activeProfile   = defaultProfile // guarded by the daemon's opMu
+)
+
+// currentSettings captures cfg's selection settings as a profile.
+func currentSettings(name string) *profile {
+	return &profile{
+		Name:             name,
+		Tiers:            cfg.targetTiers,
+		Fallback:         cfg.targetFallback,
+		Features:         cfg.requiredFeatures,
+		Threshold:        cfg.loadThreshold,
+		Preferred:        cfg.preferredServers,
+		PreferredMaxLoad: cfg.preferredMaxLoad,
+	}
+}
+
+// parseProfiles reads PROFILES and each profile's PROFILE_<NAME>_* settings.
+// Settings a profile leaves out are taken from the plain configuration.
+func parseProfiles(names string) (map[string]*profile, error) {
+	base := currentSettings(defaultProfile)
+	list := map[string]*profile{defaultProfile: base}
+	for _, name := range splitList(names) {
+		if _, dup := list[name]; dup {
+			return nil, fmt.Errorf("profile %q defined twice", name)
+		}
+		p := *base
+		p.Name = name
+		key := func(k string) string { return "PROFILE_" + strings.ToUpper(name) + "_" + k }
+		env := func(k string) string { return os.Getenv(key(k)) }
+
+		countries, regions, country, cities := env("TARGET_COUNTRIES"), env("TARGET_REGION"), env("TARGET_COUNTRY"), env("TARGET_CITIES")
+		auto := strings.EqualFold(env("TARGET"), "auto")
+		if countries != "" || regions != "" || country != "" || cities != "" || auto {
+			var cityList []string
+			if cities != "" {
+				cityList = strings.Split(cities, ",")
+			}
+			tiers, err := selector.ParseTargets(countries, regions, auto, strings.ToUpper(country), cityList)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %v", name, err)
+			}
+			p.Tiers = tiers
+		}
+		p.Fallback = getEnvBool(key("TARGET_FALLBACK"), p.Fallback)
+		if v := env("FEATURES"); v != "" {
+			features, err := protonapi.ParseFeatures(v)
+			if err != nil {
+				return nil, fmt.Errorf("profile %s: %v", name, err)
+			}
+			p.Features = features
+		}
+		p.Threshold = getEnvInt(key("LOAD_SWITCH_THRESHOLD"), p.Threshold)
+		if v := env("PREFERRED_SERVERS"); v != "" {
+			p.Preferred = nil
+			for _, s := range splitList(v) {
+				p.Preferred = append(p.Preferred, strings.ToUpper(s))
+			}
+		}
+		p.PreferredMaxLoad = getEnvInt(key("PREFERRED_MAX_LOAD"), p.PreferredMaxLoad)
+		list[name] = &p
+	}
+	return list, nil
+}
+
+// parseSchedule reads PROFILE_SCHEDULE, e.g. "07:00=day,23:00=night", in
+// local time (TZ).
+func parseSchedule(v string, profiles map[string]*profile) ([]scheduleEntry, error) {
+	var sched []scheduleEntry
+	for _, entry := range splitList(v) {
+		at, name, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("PROFILE_SCHEDULE entry %q is not HH:MM=profile", entry)
+		}
+		t, err := time.Parse("15:04", strings.TrimSpace(at))
+		if err != nil {
+			return nil, fmt.Errorf("PROFILE_SCHEDULE entry %q: invalid time", entry)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := profiles[name]; !ok {
+			return nil, fmt.Errorf("PROFILE_SCHEDULE entry %q: unknown profile %q", entry, name)
+		}
+		sched = append(sched, scheduleEntry{Minute: t.Hour()*60 + t.Minute(), Profile: name})
+	}
+	sort.SliceStable(sched, func(i, j int) bool { return sched[i].Minute < sched[j].Minute })
+	return sched, nil
+}
+
+// scheduledProfile returns the profile the schedule puts in force at t: the
+// latest entry at or before t, carrying over from the day before. Without a
+// schedule it is the default profile.
+func scheduledProfile(sched []scheduleEntry, t time.Time) string {
+	if len(sched) == 0 {
+		return defaultProfile
+	}
+	minute := t.Hour()*60 + t.Minute()
+	name := sched[len(sched)-1].Profile
+	for _, e := range sched {
+		if e.Minute <= minute {
+			name = e.Profile
+		}
+	}
+	return name
+}
+
+// applyProfile makes the named profile's settings current. Callers hold the
+// daemon's opMu, or run before the daemon starts.
+func applyProfile(name string) error {
+	p, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+	cfg.targetTiers, cfg.targetFallback = p.Tiers, p.Fallback
+	cfg.requiredFeatures = p.Features
+	cfg.loadThreshold = p.Threshold
+	cfg.preferredServers, cfg.preferredMaxLoad = p.Preferred, p.PreferredMaxLoad
+	activeProfile = name
+	return nil
+}
+
+// profileNames lists the configured profiles, default first.
+func profileNames() []string {
+	names := []string{defaultProfile}
+	for name := range profiles {
+		if name != defaultProfile {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names[1:])
+	return names
+}
+
+// useProfile switches to a profile and wakes the load loop so the server is
+// re-evaluated under it.
+func (d *daemon) useProfile(name, why string) error {
+	d.opMu.Lock()
+	if name == activeProfile {
+		d.opMu.Unlock()
+		return nil
+	}
+	prev := activeProfile
+	err := applyProfile(name)
+	d.opMu.Unlock()
+	if err != nil {
+		return err
+	}
+	log(fmt.Sprintf("Profile %s -> %s (%s)", prev, name, why))
+	d.updateStatus(func(s *Status) { s.Profile = name })
+	d.requestFailover("")
+	return nil
+}
+
+// profileLoop follows PROFILE_SCHEDULE, switching profiles when an entry's
+// time is reached.
+func (d *daemon) profileLoop() {
+	if len(profileSchedule) == 0 {
+		return
+	}
+	scheduled := scheduledProfile(profileSchedule, time.Now())
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-d.done:
+			return
+		}
+		next := scheduledProfile(profileSchedule, time.Now())
+		if next == scheduled {
+			continue
+		}
+		scheduled = next
+		if err := d.useProfile(next, "schedule"); err != nil {
+			log(fmt.Sprintf("Failed to switch profile: %v", err))
+		}
+	}
+}
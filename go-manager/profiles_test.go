@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestParseProfiles(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	t.Setenv("PROFILE_NIGHT_TARGET_COUNTRIES", "NL,CH:Zurich")
+	t.Setenv("PROFILE_NIGHT_FEATURES", "p2p")
+	t.Setenv("PROFILE_NIGHT_LOAD_SWITCH_THRESHOLD", "40")
+	t.Setenv("PROFILE_DAY_PREFERRED_SERVERS", "us#2")
+
+	list, err := parseProfiles("day, night")
+	if err != nil {
+		t.Fatal(err)
+	}
+	night, day := list["night"], list["day"]
+	if len(night.Tiers) != 2 || night.Tiers[1].Name != "CH" || night.Features != protonapi.FeatureP2P || night.Threshold != 40 {
+		t.Errorf("night = %+v", night)
+	}
+	// Unset settings come from the plain configuration
+	if day.Threshold != 20 || len(day.Tiers) != 1 || !slices.Equal(day.Preferred, []string{"US#2"}) {
+		t.Errorf("day = %+v", day)
+	}
+
+	t.Setenv("PROFILE_BAD_FEATURES", "warp")
+	if _, err := parseProfiles("bad"); err == nil {
+		t.Error("profile with an unknown feature accepted")
+	}
+}
+
+func TestScheduledProfile(t *testing.T) {
+	list := map[string]*profile{defaultProfile: {}, "day": {}, "night": {}}
+	sched, err := parseSchedule("23:00=night, 07:30=day", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(h, m int) time.Time { return time.Date(2026, 3, 2, h, m, 0, 0, time.Local) }
+	for _, tc := range []struct {
+		t    time.Time
+		want string
+	}{
+		{at(3, 0), "night"}, // carried over from the day before
+		{at(7, 30), "day"},
+		{at(22, 59), "day"},
+		{at(23, 0), "night"},
+	} {
+		if got := scheduledProfile(sched, tc.t); got != tc.want {
+			t.Errorf("at %s: %s, want %s", tc.t.Format("15:04"), got, tc.want)
+		}
+	}
+	for _, bad := range []string{"7am=day", "07:00=evening", "07:00"} {
+		if _, err := parseSchedule(bad, list); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestProfileChangesSelection(t *testing.T) {
+	setupTestEnv(t, "US#2")
+	servers := testServers()
+	servers[0].Features = protonapi.FeatureP2P
+	profiles["p2p"] = &profile{Name: "p2p", Tiers: cfg.targetTiers, Features: protonapi.FeatureP2P, Threshold: 20, PreferredMaxLoad: 80}
+
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, servers...), rt, newMockHealth(t, true))
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.applied) != 0 {
+		t.Fatalf("switched to %v under the default profile", rt.applied)
+	}
+
+	if err := d.useProfile("p2p", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#1"}) {
+		t.Errorf("applied %v, want the only P2P server US#1", rt.applied)
+	}
+	if d.status.Profile != "p2p" {
+		t.Errorf("status profile %q", d.status.Profile)
+	}
+	if err := d.useProfile("nope", "test"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Tunnel protocols. WireGuard uses the custom provider with the endpoint the
+// manager picked; the OpenVPN fallback uses gluetun's built-in Proton provider
+// over TCP, which gets through networks that block or throttle UDP.
+const (
+	protocolWireGuard = "wireguard"
+	protocolOpenVPN   = "openvpn"
+)
+
+// activeProtocol and fallbackSince are only touched under the daemon's opMu.
+var (
+	activeProtocol = protocolWireGuard
+	fallbackSince  time.Time
+)
+
+// protocolEnvVars returns the env vars selecting the tunnel protocol. They are
+// only managed when the fallback is enabled, so existing setups are untouched.
+func protocolEnvVars(server *LogicalServer) map[string]string {
+	if !cfg.protocolFallback {
+		return nil
+	}
+	if activeProtocol == protocolOpenVPN {
+		return map[string]string{
+			"VPN_TYPE":             protocolOpenVPN,
+			"VPN_SERVICE_PROVIDER": "protonvpn",
+			"OPENVPN_PROTOCOL":     "tcp",
+			"SERVER_NAMES":         server.Name,
+		}
+	}
+	return map[string]string{
+		"VPN_TYPE":             protocolWireGuard,
+		"VPN_SERVICE_PROVIDER": "custom",
+		"OPENVPN_PROTOCOL":     "udp",
+		"SERVER_NAMES":         "",
+	}
+}
+
+// syncProtocol continues with the protocol recorded in the env file.
+func syncProtocol(vpnType string) {
+	if cfg.protocolFallback && vpnType == protocolOpenVPN {
+		activeProtocol = protocolOpenVPN
+		fallbackSince = time.Now()
+		log("Resuming on OpenVPN fallback")
+	}
+}
+
+// maybeFallBack switches to OpenVPN once protocolFallbackAfter consecutive
+// WireGuard switches have failed. Callers hold opMu.
+func maybeFallBack(switchFailures int) {
+	if !cfg.protocolFallback || activeProtocol != protocolWireGuard || switchFailures < cfg.protocolFallbackAfter {
+		return
+	}
+	if readEnvFile()["OPENVPN_USER"] == "" {
+		log("Cannot fall back to OpenVPN: OPENVPN_USER is not set in the env file")
+		return
+	}
+
+	activeProtocol = protocolOpenVPN
+	fallbackSince = time.Now()
+	log(fmt.Sprintf("%d WireGuard switches failed, falling back to OpenVPN over TCP", switchFailures))
+	notify(alertProtocolFallback, "Fell back to OpenVPN",
+		fmt.Sprintf("%d consecutive WireGuard connections failed, so the tunnel now uses OpenVPN over TCP 443. WireGuard will be retried every %s.",
+			switchFailures, time.Duration(cfg.protocolRetryInterval)*time.Second))
+}
+
+// retryWireGuard moves back to WireGuard on the current server once the
+// retry interval has passed, returning to OpenVPN if the tunnel doesn't come
+// up. It returns true if it attempted a retry. Callers hold opMu.
+func (d *daemon) retryWireGuard(servers []LogicalServer, currentName string) bool {
+	if activeProtocol != protocolOpenVPN || time.Since(fallbackSince) < time.Duration(d.cfg.protocolRetryInterval)*time.Second {
+		return false
+	}
+	server := protonapi.FindByName(servers, currentName)
+	if server == nil {
+		server, _ = findBestServer(servers, currentName)
+	}
+	if server == nil {
+		return false
+	}
+
+	log(fmt.Sprintf("Retrying WireGuard on %s", server.Name))
+	activeProtocol = protocolWireGuard
+	if d.runtime.Apply(server) {
+		if d.runtime.Restart() && d.restarted("Retry WireGuard") && d.checker.Check() {
+			log("WireGuard works again, leaving OpenVPN fallback")
+			resolveAlert(alertProtocolFallback, "Fell back to OpenVPN")
+			return true
+		}
+	}
+
+	log("WireGuard still failing, staying on OpenVPN")
+	activeProtocol = protocolOpenVPN
+	fallbackSince = time.Now()
+	if d.runtime.Apply(server) && d.runtime.Restart() {
+		d.restarted("OpenVPN Fallback")
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProtocolEnvVars(t *testing.T) {
+	setupTestEnv(t, "CH#4")
+	server := &LogicalServer{Name: "CH#4"}
+	if vars := protocolEnvVars(server); vars != nil {
+		t.Errorf("env vars managed without PROTOCOL_FALLBACK: %v", vars)
+	}
+
+	cfg.protocolFallback = true
+	if vars := protocolEnvVars(server); vars["VPN_TYPE"] != "wireguard" || vars["VPN_SERVICE_PROVIDER"] != "custom" || vars["SERVER_NAMES"] != "" {
+		t.Errorf("WireGuard env vars = %v", vars)
+	}
+	activeProtocol = protocolOpenVPN
+	if vars := protocolEnvVars(server); vars["VPN_TYPE"] != "openvpn" || vars["VPN_SERVICE_PROVIDER"] != "protonvpn" ||
+		vars["OPENVPN_PROTOCOL"] != "tcp" || vars["SERVER_NAMES"] != "CH#4" {
+		t.Errorf("OpenVPN env vars = %v", vars)
+	}
+}
+
+func TestMaybeFallBack(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		enabled  bool
+		user     string
+		failures int
+		want     string
+	}{
+		{"disabled", false, "user", 5, protocolWireGuard},
+		{"below threshold", true, "user", 2, protocolWireGuard},
+		{"no OpenVPN credentials", true, "", 3, protocolWireGuard},
+		{"falls back", true, "user", 3, protocolOpenVPN},
+	} {
+		setupTestEnv(t, "CH#4")
+		cfg.protocolFallback, cfg.protocolFallbackAfter = tc.enabled, 3
+		env := "PROTON_SERVER_NAME=CH#4\nOPENVPN_USER=" + tc.user + "\n"
+		if err := os.WriteFile(cfg.envFile, []byte(env), 0644); err != nil {
+			t.Fatal(err)
+		}
+		maybeFallBack(tc.failures)
+		if activeProtocol != tc.want {
+			t.Errorf("%s: protocol = %s, want %s", tc.name, activeProtocol, tc.want)
+		}
+	}
+}
+
+func TestSyncProtocol(t *testing.T) {
+	setupTestEnv(t, "CH#4")
+	syncProtocol(protocolOpenVPN)
+	if activeProtocol != protocolWireGuard {
+		t.Error("resumed OpenVPN without PROTOCOL_FALLBACK")
+	}
+	cfg.protocolFallback = true
+	syncProtocol(protocolOpenVPN)
+	if activeProtocol != protocolOpenVPN || time.Since(fallbackSince) > time.Second {
+		t.Errorf("protocol = %s since %s, want a fresh OpenVPN fallback", activeProtocol, fallbackSince)
+	}
+}
+
+func TestRetryWireGuard(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		since   time.Duration
+		health  []bool
+		retried bool
+		applied []string
+		want    string
+	}{
+		{"too early", 30 * time.Minute, []bool{true}, false, nil, protocolOpenVPN},
+		{"wireguard works", 2 * time.Hour, []bool{true}, true, []string{"US#1"}, protocolWireGuard},
+		{"still failing", 2 * time.Hour, []bool{false}, true, []string{"US#1", "US#1"}, protocolOpenVPN},
+	} {
+		setupTestEnv(t, "US#1")
+		cfg.protocolFallback, cfg.protocolRetryInterval = true, 3600
+		activeProtocol, fallbackSince = protocolOpenVPN, time.Now().Add(-tc.since)
+		rt := newMockRuntime(t)
+		d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, tc.health...))
+
+		if retried := d.retryWireGuard(testServers(), "US#1"); retried != tc.retried {
+			t.Errorf("%s: retried = %v", tc.name, retried)
+		}
+		if activeProtocol != tc.want || !slices.Equal(rt.applied, tc.applied) {
+			t.Errorf("%s: protocol = %s, applied %v, want %s and %v", tc.name, activeProtocol, rt.applied, tc.want, tc.applied)
+		}
+		if tc.retried && tc.want == protocolOpenVPN && time.Since(fallbackSince) > time.Second {
+			t.Errorf("%s: retry interval not restarted", tc.name)
+		}
+	}
+}
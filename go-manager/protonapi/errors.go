@@ -0,0 +1,45 @@
+package protonapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// API error codes with a meaning of their own.
+const (
+	CodeHumanVerification = 9001
+	CodePaidPlanRequired  = 10004
+)
+
+// Error is Proton's JSON error envelope on a non-200 response.
+type Error struct {
+	Status     int             `json:"-"`
+	Code       int             `json:"Code"`
+	Message    string          `json:"Error"`
+	Details    json.RawMessage `json:"Details"`
+	RetryAfter time.Duration   `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API returned status %d", e.Status)
+	}
+	return fmt.Sprintf("API returned status %d: %s (code %d)", e.Status, e.Message, e.Code)
+}
+
+// ParseError decodes the error envelope of a failed response. A body that
+// isn't JSON still yields an error carrying the status.
+func ParseError(resp *http.Response) *Error {
+	e := &Error{Status: resp.StatusCode}
+	if body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil {
+		json.Unmarshal(body, e)
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return e
+}
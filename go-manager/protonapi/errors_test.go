@@ -0,0 +1,52 @@
+package protonapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseError(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		status     int
+		retryAfter string
+		body       string
+		want       Error
+		message    string
+	}{
+		{"envelope", 422, "", `{"Code":9001,"Error":"Human verification required","Details":{"HumanVerificationMethods":["captcha"]}}`,
+			Error{Status: 422, Code: CodeHumanVerification, Message: "Human verification required"},
+			"API returned status 422: Human verification required (code 9001)"},
+		{"rate limited", 429, "30", `{"Code":2028,"Error":"Too many recent requests"}`,
+			Error{Status: 429, Code: 2028, Message: "Too many recent requests", RetryAfter: 30 * time.Second},
+			"API returned status 429: Too many recent requests (code 2028)"},
+		{"not json", 502, "", `<html>Bad Gateway</html>`,
+			Error{Status: 502}, "API returned status 502"},
+		{"empty body", 403, "soon", ``,
+			Error{Status: 403}, "API returned status 403"},
+		{"negative retry-after", 503, "-5", `{}`,
+			Error{Status: 503}, "API returned status 503"},
+	} {
+		rec := httptest.NewRecorder()
+		if tc.retryAfter != "" {
+			rec.Header().Set("Retry-After", tc.retryAfter)
+		}
+		rec.WriteHeader(tc.status)
+		rec.WriteString(tc.body)
+
+		got := ParseError(rec.Result())
+		if got.Status != tc.want.Status || got.Code != tc.want.Code || got.Message != tc.want.Message || got.RetryAfter != tc.want.RetryAfter {
+			t.Errorf("%s: ParseError = %+v, want %+v", tc.name, *got, tc.want)
+		}
+		if got.Error() != tc.message {
+			t.Errorf("%s: message = %q, want %q", tc.name, got.Error(), tc.message)
+		}
+	}
+
+	resp := &http.Response{StatusCode: 422, Header: http.Header{}, Body: http.NoBody}
+	if e := ParseError(resp); e.Details != nil {
+		t.Errorf("details without a body: %s", e.Details)
+	}
+}
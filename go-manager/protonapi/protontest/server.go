@@ -0,0 +1,219 @@
+// Package protontest runs a fake Proton VPN API for tests: it serves
+// /vpn/logicals from recorded snapshots, issues and refreshes tokens through
+// /auth/v4/refresh, and can be told to expire tokens, rate limit or demand
+// human verification.
+package protontest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Initial session the server accepts, for clients that resume it instead of
+// logging in.
+const (
+	UID          = "test-uid"
+	AccessToken  = "access-0"
+	RefreshToken = "refresh-0"
+)
+
+// Error codes the fake API answers with, as the real one does.
+const (
+	codeOK           = 1000
+	codeInvalidToken = 401
+	codeTooMany      = 2028
+	codeHVRequired   = 9001
+)
+
+// Server is a fake Proton API. Its methods are safe to call while clients
+// are using it.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	snapshots    []protonapi.Snapshot
+	snapshot     int
+	accessToken  string
+	refreshToken string
+	generation   int
+	rateLimit    int
+	retryAfter   time.Duration
+	failRefresh  bool
+	hvPending    int
+	hvDetails    map[string]any
+	hits         map[string]int
+}
+
+// NewServer starts a fake API serving the given snapshots, such as those
+// read by protonapi.LoadSnapshots. Each call to /vpn/logicals returns the
+// current snapshot; Advance moves to the next.
+func NewServer(snapshots ...protonapi.Snapshot) *Server {
+	s := &Server{
+		snapshots:    snapshots,
+		accessToken:  AccessToken,
+		refreshToken: RefreshToken,
+		hits:         make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+protonapi.LogicalServersPath, s.logicals)
+	mux.HandleFunc("POST /auth/v4/refresh", s.refresh)
+	mux.HandleFunc("POST /auth/v4/info", s.authInfo)
+	s.Server = httptest.NewServer(s.count(mux))
+	return s
+}
+
+// Advance serves the next snapshot, staying on the last one.
+func (s *Server) Advance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.snapshot < len(s.snapshots)-1 {
+		s.snapshot++
+	}
+}
+
+// ExpireToken invalidates the current access token, so the next request gets
+// a 401 until the client refreshes its session.
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessToken = ""
+}
+
+// FailRefresh makes refreshes fail with 401, as for a revoked session.
+func (s *Server) FailRefresh(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failRefresh = fail
+}
+
+// RateLimit answers the next n API requests with 429 and a Retry-After of d.
+func (s *Server) RateLimit(n int, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimit, s.retryAfter = n, d
+}
+
+// RequireHumanVerification answers the next n requests to /auth/v4/info, the
+// first step of a login, with a human verification challenge for token
+// offering the given methods.
+func (s *Server) RequireHumanVerification(n int, token string, methods ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hvPending = n
+	s.hvDetails = map[string]any{"HumanVerificationToken": token, "HumanVerificationMethods": methods}
+}
+
+// Tokens returns the session the server currently accepts.
+func (s *Server) Tokens() (access, refresh string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accessToken, s.refreshToken
+}
+
+// Hits returns how many requests were made to path.
+func (s *Server) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+func (s *Server) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		limited := s.rateLimit > 0
+		if limited {
+			s.rateLimit--
+		}
+		retryAfter := s.retryAfter
+		s.mu.Unlock()
+
+		if limited {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+			writeError(w, http.StatusTooManyRequests, codeTooMany, "Too many recent API requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) logicals(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	valid := s.accessToken != "" &&
+		r.Header.Get("Authorization") == "Bearer "+s.accessToken &&
+		r.Header.Get("x-pm-uid") == UID
+	var servers []protonapi.LogicalServer
+	if len(s.snapshots) > 0 {
+		servers = s.snapshots[s.snapshot].LogicalServers
+	}
+	s.mu.Unlock()
+
+	if !valid {
+		writeError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid access token")
+		return
+	}
+	writeJSON(w, http.StatusOK, protonapi.LogicalServersResponse{Code: codeOK, LogicalServers: servers})
+}
+
+func (s *Server) refresh(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UID          string
+		RefreshToken string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, 2001, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failRefresh || req.UID != UID || req.RefreshToken != s.refreshToken {
+		writeError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid refresh token")
+		return
+	}
+	s.generation++
+	s.accessToken = "access-" + strconv.Itoa(s.generation)
+	s.refreshToken = "refresh-" + strconv.Itoa(s.generation)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"Code":         codeOK,
+		"UID":          UID,
+		"UserID":       "test-user",
+		"AccessToken":  s.accessToken,
+		"RefreshToken": s.refreshToken,
+		"TokenType":    "Bearer",
+		"Scopes":       strings.Fields("full self vpn"),
+	})
+}
+
+func (s *Server) authInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	challenge := s.hvPending > 0
+	if challenge {
+		s.hvPending--
+	}
+	details := s.hvDetails
+	s.mu.Unlock()
+
+	if challenge {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"Code": codeHVRequired, "Error": "Human verification required", "Details": details})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"Code": codeOK, "Version": 4, "SRPSession": "test-srp-session"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	writeJSON(w, status, map[string]any{"Code": code, "Error": msg, "Details": map[string]any{}})
+}
@@ -0,0 +1,148 @@
+// Package protonapi holds the Proton VPN API types the manager works with and
+// decodes the API's error responses.
+package protonapi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogicalServersPath lists every logical server with its load and endpoints.
+const LogicalServersPath = "/vpn/logicals"
+
+// LogicalServer is a VPN server as users see it, backed by one or more
+// physical servers.
+type LogicalServer struct {
+	ID           string   `json:"ID"`
+	Name         string   `json:"Name"`
+	EntryCountry string   `json:"EntryCountry"`
+	ExitCountry  string   `json:"ExitCountry"`
+	HostCountry  string   `json:"HostCountry"` // physical country of Smart Routing servers
+	Domain       string   `json:"Domain"`
+	Tier         int      `json:"Tier"`
+	Features     int      `json:"Features"`
+	Status       int      `json:"Status"` // 1 = Active
+	Load         int      `json:"Load"`
+	Score        float64  `json:"Score"`
+	City         string   `json:"City"`
+	Location     Location `json:"Location"`
+	Servers      []Server `json:"Servers"`
+}
+
+type Location struct {
+	Lat  float64 `json:"Lat"`
+	Long float64 `json:"Long"`
+}
+
+// Server is a physical server behind a logical one.
+type Server struct {
+	EntryIP         string `json:"EntryIP"`
+	ExitIP          string `json:"ExitIP"`
+	Domain          string `json:"Domain"`
+	ID              string `json:"ID"`
+	Status          int    `json:"Status"`
+	X25519PublicKey string `json:"X25519PublicKey"` // WireGuard Key
+}
+
+type LogicalServersResponse struct {
+	Code           int             `json:"Code"`
+	LogicalServers []LogicalServer `json:"LogicalServers"`
+}
+
+// Feature flags of a logical server.
+const (
+	FeatureSecureCore = 1 << 0
+	FeatureTor        = 1 << 1
+	FeatureP2P        = 1 << 2
+	FeatureStreaming  = 1 << 3
+	FeatureIPv6       = 1 << 4
+)
+
+var featureNames = []struct {
+	flag int
+	name string
+}{
+	{FeatureSecureCore, "SecureCore"},
+	{FeatureTor, "Tor"},
+	{FeatureP2P, "P2P"},
+	{FeatureStreaming, "Streaming"},
+	{FeatureIPv6, "IPv6"},
+}
+
+// FeatureNames decodes the server's feature flags. Unknown bits are listed
+// by value.
+func (s LogicalServer) FeatureNames() []string {
+	var names []string
+	rest := s.Features
+	for _, f := range featureNames {
+		if s.Features&f.flag != 0 {
+			names = append(names, f.name)
+			rest &^= f.flag
+		}
+	}
+	for bit := 1; rest != 0; bit <<= 1 {
+		if rest&bit != 0 {
+			names = append(names, fmt.Sprintf("0x%x", bit))
+			rest &^= bit
+		}
+	}
+	return names
+}
+
+// ParseFeatures turns a comma-separated list of feature names, as printed by
+// FeatureNames and matched case-insensitively, into flags.
+func ParseFeatures(list string) (int, error) {
+	flags := 0
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		flag := 0
+		for _, f := range featureNames {
+			if strings.EqualFold(f.name, name) {
+				flag = f.flag
+			}
+		}
+		if flag == 0 {
+			return 0, fmt.Errorf("unknown server feature %q", name)
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// TierName names the plan a server requires.
+func (s LogicalServer) TierName() string {
+	switch s.Tier {
+	case 0:
+		return "Free"
+	case 1:
+		return "Basic"
+	case 2:
+		return "Plus"
+	case 3:
+		return "Proton internal"
+	}
+	return fmt.Sprintf("tier %d", s.Tier)
+}
+
+// HasLocation reports whether the API gave the server's coordinates.
+func (s LogicalServer) HasLocation() bool {
+	return s.Location.Lat != 0 || s.Location.Long != 0
+}
+
+// IsVirtual reports whether a server is a Smart Routing server, physically
+// hosted in another country than the one it exits in.
+func (s LogicalServer) IsVirtual() bool {
+	return s.HostCountry != "" && !strings.EqualFold(s.HostCountry, s.ExitCountry)
+}
+
+// FindByName returns the server with the given name, or nil.
+func FindByName(servers []LogicalServer, name string) *LogicalServer {
+	for i := range servers {
+		if servers[i].Name == name {
+			return &servers[i]
+		}
+	}
+	return nil
+}
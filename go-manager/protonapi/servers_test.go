@@ -0,0 +1,26 @@
+package protonapi
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFeatureNames(t *testing.T) {
+	s := LogicalServer{Features: FeatureP2P | FeatureStreaming | 1<<7}
+	if got, want := s.FeatureNames(), []string{"P2P", "Streaming", "0x80"}; !slices.Equal(got, want) {
+		t.Errorf("FeatureNames() = %v, want %v", got, want)
+	}
+	if got := (LogicalServer{}).FeatureNames(); got != nil {
+		t.Errorf("FeatureNames() of no features = %v", got)
+	}
+}
+
+func TestParseFeatures(t *testing.T) {
+	flags, err := ParseFeatures(" p2p, STREAMING ,")
+	if err != nil || flags != FeatureP2P|FeatureStreaming {
+		t.Errorf("ParseFeatures = %d, %v", flags, err)
+	}
+	if _, err := ParseFeatures("p2p,warp"); err == nil {
+		t.Error("unknown feature accepted")
+	}
+}
@@ -0,0 +1,45 @@
+package protonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Snapshot is a server list as the API returned it at Time. Its JSON form is
+// a /vpn/logicals response with an added Time field, so a saved response is
+// a snapshot without a time.
+type Snapshot struct {
+	Time           time.Time       `json:"Time,omitzero"`
+	LogicalServers []LogicalServer `json:"LogicalServers"`
+}
+
+// LoadSnapshots reads recorded server lists from a file holding one
+// snapshot, a JSON array of them, or one per line.
+func LoadSnapshots(path string) ([]Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	var snapshots []Snapshot
+	if bytes.HasPrefix(data, []byte("[")) {
+		err = json.Unmarshal(data, &snapshots)
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var s Snapshot
+			if err = dec.Decode(&s); err != nil {
+				break
+			}
+			snapshots = append(snapshots, s)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// How a chosen server is put into gluetun's configuration.
+const (
+	// strategyEndpoint pins gluetun's custom provider to the endpoint IP and
+	// public key the manager picked
+	strategyEndpoint = "endpoint"
+	// strategyProvider steers gluetun's built-in protonvpn provider with
+	// its server filters and leaves connecting to gluetun
+	strategyProvider = "provider"
+)
+
+// What the provider strategy filters gluetun's server list by.
+const (
+	providerByHostname = "hostname" // the chosen server's physical hostnames
+	providerByCity     = "city"     // any server in the chosen server's city
+)
+
+// providerEnvKeys are compared against the running gluetun in place of the
+// endpoint variables under the provider strategy.
+var providerEnvKeys = []string{
+	"VPN_SERVICE_PROVIDER",
+	"SERVER_HOSTNAMES",
+	"SERVER_CITIES",
+	"WIREGUARD_ENDPOINT_PORT",
+}
+
+// providerEnvVars returns the variables selecting server through gluetun's
+// protonvpn provider. The custom provider's endpoint and public key are
+// cleared so they can't override its choice; WIREGUARD_PRIVATE_KEY and
+// WIREGUARD_ADDRESSES stay as the user set them.
+func providerEnvVars(server *LogicalServer) map[string]string {
+	vars := map[string]string{
+		"VPN_SERVICE_PROVIDER":  "protonvpn",
+		"WIREGUARD_ENDPOINT_IP": "",
+		"WIREGUARD_PUBLIC_KEY":  "",
+		"SERVER_HOSTNAMES":      "",
+		"SERVER_CITIES":         "",
+	}
+	if cfg.providerSelection == providerByCity {
+		vars["SERVER_CITIES"] = server.City
+	} else {
+		vars["SERVER_HOSTNAMES"] = strings.Join(serverHostnames(server), ",")
+	}
+	return vars
+}
+
+// serverHostnames returns the hostnames of a logical server's live
+// endpoints, as gluetun's server list names them.
+func serverHostnames(server *LogicalServer) []string {
+	var hosts []string
+	for _, s := range wireguardEndpoints(server) {
+		if s.Domain != "" {
+			hosts = append(hosts, s.Domain)
+		}
+	}
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
+
+// providerProblems reports UPDATE_STRATEGY settings that can't work.
+func providerProblems() []string {
+	var problems []string
+	switch cfg.updateStrategy {
+	case strategyEndpoint:
+		return nil
+	case strategyProvider:
+	default:
+		return []string{fmt.Sprintf("UPDATE_STRATEGY must be %s or %s", strategyEndpoint, strategyProvider)}
+	}
+	if cfg.providerSelection != providerByHostname && cfg.providerSelection != providerByCity {
+		problems = append(problems, fmt.Sprintf("PROVIDER_SELECTION must be %s or %s", providerByHostname, providerByCity))
+	}
+	if cfg.switchMode == switchModeBlueGreen {
+		problems = append(problems, fmt.Sprintf("UPDATE_STRATEGY=%s is not supported with SWITCH_MODE=%s", strategyProvider, switchModeBlueGreen))
+	}
+	return problems
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func providerTestServer() *LogicalServer {
+	return &LogicalServer{Name: "CH#4", City: "Zurich", EntryCountry: "CH", ExitCountry: "CH", Status: 1, Servers: []Server{
+		{EntryIP: "10.0.0.2", Domain: "node-ch-05.protonvpn.net", Status: 1, X25519PublicKey: "key2"},
+		{EntryIP: "10.0.0.1", Domain: "node-ch-04.protonvpn.net", Status: 1, X25519PublicKey: "key1"},
+		{EntryIP: "10.0.0.3", Domain: "node-ch-06.protonvpn.net", Status: 0, X25519PublicKey: "key3"},
+	}}
+}
+
+func TestProviderEnvVars(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	server := providerTestServer()
+
+	// The endpoint strategy pins the endpoint and key
+	vars := managedEnvVars(server, &server.Servers[0])
+	if vars["WIREGUARD_ENDPOINT_IP"] != "10.0.0.2" || vars["SERVER_HOSTNAMES"] != "" {
+		t.Errorf("endpoint strategy wrote %v", vars)
+	}
+
+	cfg.updateStrategy = strategyProvider
+	vars = managedEnvVars(server, &server.Servers[0])
+	for k, want := range map[string]string{
+		"PROTON_SERVER_NAME":    "CH#4",
+		"VPN_SERVICE_PROVIDER":  "protonvpn",
+		"SERVER_HOSTNAMES":      "node-ch-04.protonvpn.net,node-ch-05.protonvpn.net",
+		"SERVER_CITIES":         "",
+		"WIREGUARD_ENDPOINT_IP": "",
+		"WIREGUARD_PUBLIC_KEY":  "",
+	} {
+		if got, ok := vars[k]; !ok || got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if _, ok := vars["WIREGUARD_PRIVATE_KEY"]; ok {
+		t.Error("provider strategy touched WIREGUARD_PRIVATE_KEY")
+	}
+
+	cfg.providerSelection = providerByCity
+	vars = managedEnvVars(server, &server.Servers[0])
+	if vars["SERVER_CITIES"] != "Zurich" || vars["SERVER_HOSTNAMES"] != "" {
+		t.Errorf("city selection wrote %v", vars)
+	}
+}
+
+func TestProviderComparedKeys(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	if slices.Contains(comparedEnvKeys(), "SERVER_HOSTNAMES") {
+		t.Error("endpoint strategy compares SERVER_HOSTNAMES")
+	}
+	cfg.updateStrategy, cfg.protocolFallback = strategyProvider, true
+	keys := comparedEnvKeys()
+	if !slices.Contains(keys, "SERVER_HOSTNAMES") || slices.Contains(keys, "WIREGUARD_ENDPOINT_IP") {
+		t.Errorf("provider strategy compares %v", keys)
+	}
+	if !slices.IsSorted(keys) || len(slices.Compact(slices.Clone(keys))) != len(keys) {
+		t.Errorf("compared keys not deduplicated: %v", keys)
+	}
+}
+
+func TestProviderProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	if p := providerProblems(); len(p) != 0 {
+		t.Errorf("defaults: %v", p)
+	}
+	cfg.updateStrategy = "bogus"
+	if p := providerProblems(); len(p) != 1 {
+		t.Errorf("bad strategy: %v", p)
+	}
+	cfg.updateStrategy, cfg.providerSelection, cfg.switchMode = strategyProvider, "country", switchModeBlueGreen
+	if p := providerProblems(); len(p) != 2 {
+		t.Errorf("bad selection and blue-green: %v", p)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// Gluetun's HTTP proxy and Shadowsocks server can be managed like the
+// tunnel settings: GLUETUN_HTTPPROXY and GLUETUN_SHADOWSOCKS set to on or
+// off write their variables into the env file with every switch, and with
+// PROXY_CHECK_HOST each enabled proxy is tried after every recreate.
+
+// proxyChecks is how often a proxy is tried after a recreate, proxyRetry
+// apart, before it counts as down; gluetun starts them a little after the
+// tunnel.
+const proxyChecks = 3
+
+var proxyRetry = 5 * time.Second
+
+const proxySubject = "Gluetun proxy not responding"
+
+// gluetunShadowsocksCipher is the cipher gluetun uses when
+// SHADOWSOCKS_CIPHER isn't set.
+const gluetunShadowsocksCipher = "chacha20-ietf-poly1305"
+
+// proxyEnvVars returns the proxy variables the manager writes to the env
+// file, or nil for proxies left alone.
+func proxyEnvVars() map[string]string {
+	vars := map[string]string{}
+	if cfg.gluetunHTTPProxy != "" {
+		vars["HTTPPROXY"] = cfg.gluetunHTTPProxy
+		if cfg.gluetunHTTPProxy == "on" {
+			vars["HTTPPROXY_LISTENING_ADDRESS"] = ":" + strconv.Itoa(cfg.gluetunHTTPProxyPort)
+			vars["HTTPPROXY_USER"] = cfg.gluetunHTTPProxyUser
+			vars["HTTPPROXY_PASSWORD"] = cfg.gluetunHTTPProxyPassword
+		}
+	}
+	if cfg.gluetunShadowsocks != "" {
+		vars["SHADOWSOCKS"] = cfg.gluetunShadowsocks
+		if cfg.gluetunShadowsocks == "on" {
+			vars["SHADOWSOCKS_LISTENING_ADDRESS"] = ":" + strconv.Itoa(cfg.gluetunShadowsocksPort)
+			vars["SHADOWSOCKS_PASSWORD"] = cfg.gluetunShadowsocksPassword
+			if cfg.gluetunShadowsocksCipher != "" {
+				vars["SHADOWSOCKS_CIPHER"] = cfg.gluetunShadowsocksCipher
+			}
+		}
+	}
+	if len(vars) == 0 {
+		return nil
+	}
+	return vars
+}
+
+// proxyEnvKeys are the managed proxy variables, compared against the
+// running gluetun by reconcile.
+func proxyEnvKeys() []string {
+	keys := make([]string, 0, 8)
+	for k := range proxyEnvVars() {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// proxyURLs returns the URL the manager reaches each enabled proxy at, by
+// name, when PROXY_CHECK_HOST is set.
+func proxyURLs(cfg *config) map[string]string {
+	if cfg.proxyCheckHost == "" {
+		return nil
+	}
+	urls := map[string]string{}
+	if cfg.gluetunHTTPProxy == "on" {
+		u := url.URL{Scheme: "http", Host: net.JoinHostPort(cfg.proxyCheckHost, strconv.Itoa(cfg.gluetunHTTPProxyPort))}
+		if cfg.gluetunHTTPProxyUser != "" {
+			u.User = url.UserPassword(cfg.gluetunHTTPProxyUser, cfg.gluetunHTTPProxyPassword)
+		}
+		urls["HTTP proxy"] = u.String()
+	}
+	if cfg.gluetunShadowsocks == "on" {
+		u := url.URL{Scheme: "ss", Host: net.JoinHostPort(cfg.proxyCheckHost, strconv.Itoa(cfg.gluetunShadowsocksPort)),
+			User: url.UserPassword(shadowsocksCipher(cfg), cfg.gluetunShadowsocksPassword)}
+		urls["Shadowsocks"] = u.String()
+	}
+	return urls
+}
+
+// startProxyCheck runs checkProxies in the background with the daemon's
+// settings; stop waits for it.
+func (d *daemon) startProxyCheck() {
+	d.checks.Add(1)
+	go func() {
+		defer d.checks.Done()
+		checkProxies(d.cfg)
+	}()
+}
+
+// shadowsocksCipher is the cipher gluetun's Shadowsocks server runs with.
+func shadowsocksCipher(cfg *config) string {
+	if cfg.gluetunShadowsocksCipher == "" {
+		return gluetunShadowsocksCipher
+	}
+	return cfg.gluetunShadowsocksCipher
+}
+
+// checkProxies fetches HEALTH_PROBE_URL through each enabled proxy after a
+// recreate, alerting when one doesn't work while the tunnel does.
+func checkProxies(cfg *config) {
+	urls := proxyURLs(cfg)
+	if len(urls) == 0 {
+		return
+	}
+	var down []string
+	for name, proxyURL := range urls {
+		probe := health.Proxy{ProxyURL: proxyURL, ProbeURL: cfg.healthProbeURL}
+		ok := false
+		for i := 0; i < proxyChecks && !ok; i++ {
+			if i > 0 {
+				time.Sleep(proxyRetry)
+			}
+			ok = probe.Check()
+		}
+		if !ok {
+			log(fmt.Sprintf("Gluetun's %s doesn't respond through %s", name, cfg.proxyCheckHost))
+			down = append(down, name)
+		}
+	}
+	if len(down) == 0 {
+		resolveAlert(alertProxy, proxySubject)
+		return
+	}
+	slices.Sort(down)
+	notify(alertProxy, proxySubject,
+		fmt.Sprintf("The tunnel came up on %s, but gluetun's %s didn't answer through %s. Services using it have no connection; check gluetun's logs and its proxy settings.",
+			stateStore.state().Server, strings.Join(down, " and "), cfg.proxyCheckHost))
+}
+
+// proxyProblems reports GLUETUN_HTTPPROXY/GLUETUN_SHADOWSOCKS settings that
+// can't work.
+func proxyProblems() []string {
+	var problems []string
+	for name, v := range map[string]string{"GLUETUN_HTTPPROXY": cfg.gluetunHTTPProxy, "GLUETUN_SHADOWSOCKS": cfg.gluetunShadowsocks} {
+		if v != "" && v != "on" && v != "off" {
+			problems = append(problems, fmt.Sprintf("%s must be on, off or empty, got %q", name, v))
+		}
+	}
+	if cfg.gluetunHTTPProxyPassword != "" && cfg.gluetunHTTPProxyUser == "" {
+		problems = append(problems, "GLUETUN_HTTPPROXY_PASSWORD needs GLUETUN_HTTPPROXY_USER")
+	}
+	if cfg.gluetunShadowsocks == "on" {
+		if cfg.gluetunShadowsocksPassword == "" {
+			problems = append(problems, "GLUETUN_SHADOWSOCKS=on needs GLUETUN_SHADOWSOCKS_PASSWORD")
+		}
+		// The manager's Shadowsocks client only speaks AES-GCM
+		if cipher := shadowsocksCipher(cfg); cfg.proxyCheckHost != "" && !strings.HasPrefix(cipher, "aes-") {
+			problems = append(problems, fmt.Sprintf("PROXY_CHECK_HOST can only check Shadowsocks with GLUETUN_SHADOWSOCKS_CIPHER aes-128-gcm or aes-256-gcm, got %s", cipher))
+		}
+	}
+	for name, p := range map[string]int{"GLUETUN_HTTPPROXY_PORT": cfg.gluetunHTTPProxyPort, "GLUETUN_SHADOWSOCKS_PORT": cfg.gluetunShadowsocksPort} {
+		if p < 1 || p > 65535 {
+			problems = append(problems, fmt.Sprintf("%s must be a port between 1 and 65535", name))
+		}
+	}
+	slices.Sort(problems)
+	return problems
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProxyEnvVars(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	if vars := proxyEnvVars(); vars != nil {
+		t.Errorf("unmanaged proxies wrote %v", vars)
+	}
+	cfg.gluetunHTTPProxy, cfg.gluetunHTTPProxyPort, cfg.gluetunHTTPProxyUser, cfg.gluetunHTTPProxyPassword = "on", 8888, "me", "pw"
+	cfg.gluetunShadowsocks = "off"
+	vars := proxyEnvVars()
+	if vars["HTTPPROXY"] != "on" || vars["HTTPPROXY_LISTENING_ADDRESS"] != ":8888" || vars["HTTPPROXY_PASSWORD"] != "pw" || vars["SHADOWSOCKS"] != "off" {
+		t.Errorf("proxyEnvVars() = %v", vars)
+	}
+	if _, ok := vars["SHADOWSOCKS_PASSWORD"]; ok {
+		t.Error("a disabled Shadowsocks server got a password")
+	}
+	cfg.gluetunShadowsocks, cfg.gluetunShadowsocksPassword = "on", "pw"
+	if cipher, ok := proxyEnvVars()["SHADOWSOCKS_CIPHER"]; ok {
+		t.Errorf("unset cipher written as %q", cipher)
+	}
+	cfg.gluetunShadowsocksCipher = "aes-128-gcm"
+	if cipher := proxyEnvVars()["SHADOWSOCKS_CIPHER"]; cipher != "aes-128-gcm" {
+		t.Errorf("SHADOWSOCKS_CIPHER = %q", cipher)
+	}
+	if keys := comparedEnvKeys(); !slices.Contains(keys, "HTTPPROXY_USER") {
+		t.Errorf("reconcile doesn't compare the proxy settings: %v", keys)
+	}
+}
+
+func TestCheckProxies(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") == "" || r.URL.Host != "probe.test" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	u, _ := url.Parse(proxy.URL)
+	host, port, _ := net.SplitHostPort(u.Host)
+	cfg.proxyCheckHost, cfg.healthProbeURL, proxyRetry = host, "http://probe.test/generate_204", 0
+	t.Cleanup(func() { proxyRetry = 5 * time.Second })
+	cfg.gluetunHTTPProxy, cfg.gluetunHTTPProxyUser, cfg.gluetunHTTPProxyPassword = "on", "me", "pw"
+	cfg.gluetunHTTPProxyPort, _ = strconv.Atoi(port)
+
+	checkProxies(cfg)
+	if alerts.incident(alertProxy).active {
+		t.Fatal("a working proxy raised an alert")
+	}
+	proxy.Close()
+	checkProxies(cfg)
+	if !alerts.incident(alertProxy).active {
+		t.Error("a dead proxy went unnoticed")
+	}
+}
+
+func TestProxyProblems(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.gluetunHTTPProxyPort, cfg.gluetunShadowsocksPort = 8888, 8388
+	cfg.gluetunShadowsocks, cfg.gluetunShadowsocksCipher, cfg.proxyCheckHost = "on", "chacha20-ietf-poly1305", "network-anchor"
+	cfg.gluetunShadowsocksPassword = ""
+	if p := proxyProblems(); len(p) != 2 {
+		t.Errorf("got %v, want a missing password and an uncheckable cipher", p)
+	}
+	// Unset, gluetun picks a cipher the check can't speak
+	cfg.gluetunShadowsocksCipher, cfg.gluetunShadowsocksPassword = "", "pw"
+	if p := proxyProblems(); len(p) != 1 || !strings.Contains(p[0], gluetunShadowsocksCipher) {
+		t.Errorf("got %v, want gluetun's default cipher rejected", p)
+	}
+}
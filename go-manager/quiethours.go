@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Quiet hours hold back notifications during configured times of day, so a
+// routine problem at night doesn't wake anyone. The manager keeps logging and
+// acting as usual; only the messages to notifiers are skipped. Kinds listed
+// in QUIET_HOURS_ALLOW still go out.
+
+// defaultQuietAllow are the alerts worth waking up for: a leak, and the
+// failed login the manager exits on.
+const defaultQuietAllow = "kill_switch_leak,auth_failure"
+
+// quietRange is a time of day in minutes after midnight. A range whose end
+// is before its start wraps past midnight.
+type quietRange struct {
+	from, to int
+}
+
+// parseQuietHours parses a comma-separated list like "22:00-07:00".
+func parseQuietHours(v string) ([]quietRange, error) {
+	var ranges []quietRange
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(item, "-")
+		start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+		end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("QUIET_HOURS: %q is not HH:MM-HH:MM", item)
+		}
+		ranges = append(ranges, quietRange{start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute()})
+	}
+	return ranges, nil
+}
+
+func (r quietRange) contains(minute int) bool {
+	if r.from <= r.to {
+		return minute >= r.from && minute < r.to
+	}
+	return minute >= r.from || minute < r.to
+}
+
+// inQuietHours reports whether t falls in one of the QUIET_HOURS ranges.
+func inQuietHours(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	return slices.ContainsFunc(cfg.quietHours, func(r quietRange) bool { return r.contains(minute) })
+}
+
+// quieted reports whether an alert of this kind is held back at t, and logs
+// it if so.
+func quieted(a alert) bool {
+	if !inQuietHours(a.Time) || slices.Contains(cfg.quietAllow, string(a.Kind)) {
+		return false
+	}
+	log(fmt.Sprintf("Quiet hours: not sending %s alert: %s", a.Kind, a.Subject))
+	return true
+}
+
+// quietHoursProblems reports QUIET_HOURS settings that can't work.
+func quietHoursProblems() []string {
+	if quietHoursErr != nil {
+		return []string{quietHoursErr.Error()}
+	}
+	return nil
+}
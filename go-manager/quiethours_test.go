@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	ranges, err := parseQuietHours("22:00-07:00, 12:30-13:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []quietRange{{22 * 60, 7 * 60}, {12*60 + 30, 13 * 60}}
+	if !slices.Equal(ranges, want) {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+	for _, bad := range []string{"22:00", "22:00-7", "late-early"} {
+		if _, err := parseQuietHours(bad); err == nil {
+			t.Errorf("parseQuietHours(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestInQuietHours(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.quietHours, _ = parseQuietHours("22:00-07:00,12:30-13:00")
+	for clock, want := range map[string]bool{
+		"23:15": true, "04:00": true, "07:00": false, "21:59": false,
+		"12:45": true, "13:00": false,
+	} {
+		at, _ := time.Parse("15:04", clock)
+		if got := inQuietHours(at); got != want {
+			t.Errorf("inQuietHours(%s) = %v, want %v", clock, got, want)
+		}
+	}
+}
+
+func TestQuietHoursMuteNotifications(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	n := newMockNotifier(t)
+	notifiers = []Notifier{n}
+	cfg.quietHours = []quietRange{{0, 24 * 60}}
+
+	notify(alertSwitchFailure, "Switch failed", "")
+	notify(alertLeak, "Traffic leaked", "")
+	resolveAlert(alertLeak, "Traffic leaked")
+	flushNotifications(time.Second)
+	if got := n.kinds(); !slices.Equal(got, []alertKind{alertLeak, alertLeak}) {
+		t.Errorf("sent %v during quiet hours, want only %s alerts", got, alertLeak)
+	}
+	notify(alertAuthFailure, "Login failed", "")
+	flushNotifications(time.Second)
+	if got := n.kinds(); len(got) != 3 || got[2] != alertAuthFailure {
+		t.Errorf("sent %v during quiet hours, want the %s alert too", got, alertAuthFailure)
+	}
+
+	// The muted problem opened no incident, so it's announced once quiet
+	// hours are over.
+	cfg.quietHours = nil
+	notify(alertSwitchFailure, "Switch failed", "")
+	flushNotifications(time.Second)
+	if got := n.kinds(); len(got) != 4 || got[3] != alertSwitchFailure {
+		t.Errorf("sent %v after quiet hours, want a %s alert", got, alertSwitchFailure)
+	}
+}
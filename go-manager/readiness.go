@@ -0,0 +1,54 @@
+package main
+
+import "time"
+
+// readinessPoll is how long waitForGluetun waits between checks.
+var readinessPoll = 3 * time.Second
+
+// waitForGluetun polls until gluetun reports a working tunnel or the timeout
+// expires.
+func waitForGluetun(container string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if gluetunReady(container) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(readinessPoll)
+	}
+}
+
+// tunnelReady checks the tunnel through gluetun's control server if
+// configured, or with a health probe otherwise. It is the readiness check for
+// runtimes without a Docker health status.
+func tunnelReady() bool {
+	if cfg.gluetunControlURL != "" {
+		status, err := gluetunVPNStatus()
+		return err == nil && status == "running"
+	}
+	return checkConnectivity()
+}
+
+// gluetunReady combines the signals available for a gluetun container: its
+// Docker health status, the control server's VPN status if configured, and a
+// ping through the tunnel when neither is available.
+func gluetunReady(container string) bool {
+	ready, hasHealthcheck := containerReady(container)
+	if !ready {
+		return false
+	}
+
+	if cfg.gluetunControlURL != "" {
+		status, err := gluetunVPNStatus()
+		if err != nil || status != "running" {
+			return false
+		}
+	}
+
+	if !hasHealthcheck && cfg.gluetunControlURL == "" {
+		return checkConnectivity()
+	}
+	return true
+}
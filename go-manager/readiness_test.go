@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWaitForGluetun(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		states  []string // status/health per inspect, the last one repeating
+		control string   // VPN status on gluetun's control server, if any
+		probe   bool     // whether a health probe is configured and passing
+		timeout time.Duration
+		want    bool
+		checks  int32 // inspects until ready
+	}{
+		{"healthy at once", []string{"running/healthy"}, "", false, time.Minute, true, 1},
+		{"healthy after starting", []string{"running/starting", "running/starting", "running/healthy"}, "", false, time.Minute, true, 3},
+		{"never healthy", []string{"running/unhealthy"}, "", false, 50 * time.Millisecond, false, 0},
+		{"container stopped", []string{"exited/"}, "", false, 50 * time.Millisecond, false, 0},
+		{"control server running", []string{"running/healthy"}, "running", false, time.Minute, true, 1},
+		{"control server not running", []string{"running/healthy"}, "stopped", false, 50 * time.Millisecond, false, 0},
+		{"no healthcheck, probe passes", []string{"running/"}, "", true, time.Minute, true, 1},
+		{"no healthcheck, probe fails", []string{"running/"}, "", false, 50 * time.Millisecond, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, "US#1")
+			readinessPoll = 10 * time.Millisecond
+			t.Cleanup(func() { readinessPoll = 3 * time.Second })
+
+			var inspects atomic.Int32
+			useFakeEngine(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/containers/gluetun/json" {
+					http.NotFound(w, r)
+					return
+				}
+				n := int(inspects.Add(1))
+				status, health, _ := strings.Cut(tc.states[min(n, len(tc.states))-1], "/")
+				healthJSON := "null"
+				if health != "" {
+					healthJSON = fmt.Sprintf(`{"Status":%q}`, health)
+				}
+				fmt.Fprintf(w, `{"Id":"g1","Config":{},"HostConfig":{},"State":{"Status":%q,"Health":%s}}`, status, healthJSON)
+			})
+			if tc.control != "" {
+				gluetun := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					fmt.Fprintf(w, `{"status":%q}`, tc.control)
+				}))
+				t.Cleanup(gluetun.Close)
+				cfg.gluetunControlURL = gluetun.URL
+			}
+			probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !tc.probe {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			t.Cleanup(probe.Close)
+			cfg.healthMode, cfg.healthURL = healthModeNative, probe.URL
+
+			start := time.Now()
+			if got := waitForGluetun("gluetun", tc.timeout); got != tc.want {
+				t.Errorf("waitForGluetun = %v, want %v", got, tc.want)
+			}
+			if elapsed := time.Since(start); elapsed > tc.timeout+time.Second {
+				t.Errorf("took %s with a %s timeout", elapsed, tc.timeout)
+			}
+			switch n := inspects.Load(); {
+			case tc.want && n != tc.checks:
+				t.Errorf("ready after %d checks, want %d", n, tc.checks)
+			case !tc.want && n < 2:
+				t.Errorf("gave up after %d checks", n)
+			}
+		})
+	}
+}
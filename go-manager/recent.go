@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// maxRecent bounds the history of servers left behind.
+const maxRecent = 100
+
+// RecentServer is a server the manager moved away from.
+type RecentServer struct {
+	Name string    `json:"name"`
+	Left time.Time `json:"left"`
+}
+
+// addRecent remembers that name was just left. Callers hold mu.
+func (s *Store) addRecent(name string) {
+	s.Recent = append(s.Recent, RecentServer{Name: name, Left: time.Now()})
+	if len(s.Recent) > maxRecent {
+		s.Recent = slices.Clone(s.Recent[len(s.Recent)-maxRecent:])
+	}
+}
+
+// recentlyUsed reports whether name is one of the last n servers left, or
+// was left less than within ago.
+func (s *Store) recentlyUsed(name string, n int, within time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, r := range s.Recent {
+		if r.Name != name {
+			continue
+		}
+		if len(s.Recent)-i <= n || (within > 0 && time.Since(r.Left) < within) {
+			return true
+		}
+	}
+	return false
+}
+
+// avoidRecent reports whether selection should pass over name because it
+// was used recently (AVOID_LAST_N_SERVERS, AVOID_RECENT_HOURS).
+func avoidRecent(name string) bool {
+	if stateStore == nil || (cfg.avoidLastN <= 0 && cfg.avoidRecentHours <= 0) {
+		return false
+	}
+	return stateStore.recentlyUsed(name, cfg.avoidLastN, time.Duration(cfg.avoidRecentHours)*time.Hour)
+}
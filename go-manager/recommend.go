@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/selector"
+)
+
+// recommendation is one candidate of "manager recommend", with what went
+// into its ranking.
+type recommendation struct {
+	Server      LogicalServer
+	Target      string // tier the server matches, or "fallback"
+	Reliability float64
+	Forecast    string // forecast load, or "-" without enough history
+	Ranked      float64
+	Notes       []string
+}
+
+// recommend returns the first count servers the daemon would pick from, in
+// its order.
+func recommend(servers []LogicalServer, count int, now time.Time) []recommendation {
+	candidates := selectCandidates(servers)
+	candidates = candidates[:min(count, len(candidates))]
+	tiers := resolveTiers(servers)
+	preferred := selector.FirstPreferred(servers, selectionOptions())
+
+	recs := make([]recommendation, 0, len(candidates))
+	for _, s := range candidates {
+		r := recommendation{Server: s, Target: "fallback", Reliability: 1, Forecast: "-",
+			Ranked: float64(s.Load) + reliabilityPenalty(s.Name) + forecastPenalty(s, now)}
+		if rank := selector.Rank(tiers, s); rank < len(tiers) {
+			r.Target = tiers[rank].String()
+		}
+		if stateStore != nil {
+			r.Reliability = stateStore.reliability(s.Name)
+			if f, ok := stateStore.forecastLoad(s.Name, now, cfg.forecastHours); ok {
+				r.Forecast = fmt.Sprintf("%.0f%%", f)
+			}
+		}
+
+		if preferred != nil && preferred.Name == s.Name {
+			r.Notes = append(r.Notes, "preferred")
+		}
+		if stateStore != nil && stateStore.isQuarantined(s.Name) {
+			r.Notes = append(r.Notes, "quarantined")
+		}
+		if avoidRecent(s.Name) {
+			r.Notes = append(r.Notes, "recently used")
+		}
+		if f := s.FeatureNames(); len(f) > 0 {
+			r.Notes = append(r.Notes, strings.Join(f, "/"))
+		}
+		recs = append(recs, r)
+	}
+	return recs
+}
+
+// recommendVerdict says what the daemon would do about the server in the env
+// file, given the top candidate.
+func recommendVerdict(servers []LogicalServer, best LogicalServer, currentName string, now time.Time) string {
+	current := protonapi.FindByName(servers, currentName)
+	switch {
+	case current == nil || !eligible(*current):
+		return fmt.Sprintf("Current server %s is unavailable; the daemon would switch to %s.", currentName, best.Name)
+	case current.Name == best.Name:
+		return fmt.Sprintf("Current server %s is the top candidate.", currentName)
+	}
+	reason := optimizationReason(servers, currentName, &best, current.Load, cfg.loadThreshold)
+	if wait := connectionAgeWait(now); reason != "" && wait > 0 {
+		return fmt.Sprintf("Current server %s (%d%%): the daemon would switch to %s in %s (MIN_CONNECTION_AGE), %s.", currentName, current.Load, best.Name, wait.Round(time.Minute), reason)
+	} else if reason != "" {
+		return fmt.Sprintf("Current server %s (%d%%): the daemon would switch to %s, %s.", currentName, current.Load, best.Name, reason)
+	}
+	return fmt.Sprintf("Current server %s (%d%%): the daemon would stay (threshold %d points).", currentName, current.Load, cfg.loadThreshold)
+}
+
+// runRecommend lists the servers the daemon would pick from right now, with
+// what went into their ranking.
+func runRecommend(pm *ProtonManager, args []string) {
+	fs := flag.NewFlagSet("recommend", flag.ExitOnError)
+	count := fs.Int("count", 5, "Number of candidates to list")
+	probe := fs.Bool("probe", true, "Measure the round-trip time to each candidate")
+	fs.Parse(args)
+
+	servers, err := pm.Servers()
+	if err != nil {
+		log(fmt.Sprintf("Error fetching servers: %v", err))
+		os.Exit(exitCode(err))
+	}
+	now := time.Now()
+	recs := recommend(servers, *count, now)
+	if len(recs) == 0 {
+		fmt.Println("No suitable servers found.")
+		os.Exit(exitNoCandidates)
+	}
+
+	rtts := make([]time.Duration, len(recs))
+	if *probe {
+		var wg sync.WaitGroup
+		for i := range recs {
+			endpoints := wireguardEndpoints(&recs[i].Server)
+			if len(endpoints) == 0 {
+				rtts[i] = -1
+				continue
+			}
+			wg.Add(1)
+			go func(i int, ip string) {
+				defer wg.Done()
+				rtts[i] = probeEndpoint(ip)
+			}(i, endpoints[0].EntryIP)
+		}
+		wg.Wait()
+	}
+
+	fmt.Println("------------------------------------------------------------------------------------------")
+	fmt.Printf("%-3s %-12s %-16s %-14s %-6s %-8s %-9s %-7s %-8s %s\n",
+		"#", "SERVER", "CITY", "TARGET", "LOAD", "RELIAB", "FORECAST", "RANKED", "RTT", "NOTES")
+	fmt.Println("------------------------------------------------------------------------------------------")
+	for i, r := range recs {
+		rtt := "-"
+		if *probe {
+			rtt = "unreach."
+			if rtts[i] >= 0 {
+				rtt = rtts[i].Round(time.Millisecond).String()
+			}
+		}
+		fmt.Printf("%-3d %-12s %-16s %-14s %-6s %-8.2f %-9s %-7.1f %-8s %s\n",
+			i+1, r.Server.Name, r.Server.City, r.Target, fmt.Sprintf("%d%%", r.Server.Load), r.Reliability, r.Forecast, r.Ranked, rtt, strings.Join(r.Notes, ", "))
+	}
+	fmt.Println("------------------------------------------------------------------------------------------")
+	fmt.Println("RANKED is the load plus the reliability and forecast adjustments; lower wins.")
+	if cfg.selectionTopK > 1 {
+		fmt.Printf("With SELECTION_TOP_K=%d, #1 was drawn at random from the best candidates within %d points.\n", cfg.selectionTopK, cfg.selectionLoadBand)
+	}
+
+	if currentName := getCurrentServerFromEnv(); currentName != "" {
+		fmt.Println(recommendVerdict(servers, recs[0].Server, currentName, now))
+	}
+}
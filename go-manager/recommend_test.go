@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/selector"
+)
+
+func TestRecommend(t *testing.T) {
+	chTier := []selector.Tier{{Name: "CH", Countries: []string{"CH"}}}
+	for _, tc := range []struct {
+		name    string
+		servers []LogicalServer
+		count   int
+		setup   func()
+		want    []string // name (target) notes
+	}{
+		{"ranked by load, inactive left out", testServers(), 5, nil,
+			[]string{"US#2 (any country)", "US#1 (any country)"}},
+		{"count limits the list", testServers(), 1, nil,
+			[]string{"US#2 (any country)"}},
+		{"features noted", append(testServers(), LogicalServer{Name: "US#4", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 30, Features: protonapi.FeatureP2P}), 5, nil,
+			[]string{"US#2 (any country)", "US#4 (any country) P2P", "US#1 (any country)"}},
+		{"unreliable server ranked lower", slices.Concat(testServers()[1:], []LogicalServer{{Name: "US#1", EntryCountry: "US", ExitCountry: "US", Status: 1, Load: 15}}), 5, func() {
+			cfg.reliabilityWeight = 30
+			for range 3 {
+				stateStore.recordSwitch("US#2", false)
+			}
+		}, []string{"US#1 (any country)", "US#2 (any country)"}},
+		{"quarantined server left out", testServers(), 5, func() {
+			stateStore.record("US#2").QuarantinedUntil = time.Now().Add(time.Hour)
+		}, []string{"US#1 (any country)"}},
+		{"quarantined servers used when nothing else is left", testServers(), 5, func() {
+			stateStore.record("US#1").QuarantinedUntil = time.Now().Add(time.Hour)
+			stateStore.record("US#2").QuarantinedUntil = time.Now().Add(time.Hour)
+		}, []string{"US#2 (any country) quarantined", "US#1 (any country) quarantined"}},
+		{"preferred server first", testServers(), 5, func() {
+			cfg.preferredServers = []string{"US#1"}
+		}, []string{"US#1 (any country) preferred", "US#2 (any country)"}},
+		{"more preferred target wins over load", append(testServers(), LogicalServer{Name: "CH#1", EntryCountry: "CH", ExitCountry: "CH", Status: 1, Load: 90}), 5, func() {
+			cfg.targetTiers, cfg.targetFallback = chTier, true
+		}, []string{"CH#1 (CH)"}},
+		{"fallback outside the targets", testServers(), 5, func() {
+			cfg.targetTiers, cfg.targetFallback = chTier, true
+		}, []string{"US#2 (fallback)", "US#1 (fallback)"}},
+		{"nothing targeted without fallback", testServers(), 5, func() {
+			cfg.targetTiers, cfg.targetFallback = chTier, false
+		}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, "US#1")
+			if tc.setup != nil {
+				tc.setup()
+			}
+			var got []string
+			for _, r := range recommend(tc.servers, tc.count, time.Now()) {
+				got = append(got, strings.TrimSpace(r.Server.Name+" ("+r.Target+") "+strings.Join(r.Notes, ", ")))
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("recommend = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRecommendVerdict(t *testing.T) {
+	now := time.Now()
+	best := testServers()[1] // US#2
+	for _, tc := range []struct {
+		name    string
+		current string
+		setup   func()
+		want    string
+	}{
+		{"inactive current server", "US#3", nil,
+			"Current server US#3 is unavailable; the daemon would switch to US#2."},
+		{"unknown current server", "CH#1", nil,
+			"Current server CH#1 is unavailable; the daemon would switch to US#2."},
+		{"already on the best server", "US#2", nil,
+			"Current server US#2 is the top candidate."},
+		{"busier than the threshold", "US#1", nil,
+			"Current server US#1 (50%): the daemon would switch to US#2, Load Optimization (50% > 10% + 20%)."},
+		{"within the threshold", "US#1", func() { cfg.loadThreshold = 50 },
+			"Current server US#1 (50%): the daemon would stay (threshold 50 points)."},
+		{"connection too young", "US#1", func() {
+			cfg.minConnectionAge = 3600
+			stateStore.updateState(func(st *State) { st.LastSwitch = now.Add(-45 * time.Minute) })
+		}, "Current server US#1 (50%): the daemon would switch to US#2 in 15m0s (MIN_CONNECTION_AGE), Load Optimization (50% > 10% + 20%)."},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, tc.current)
+			if tc.setup != nil {
+				tc.setup()
+			}
+			if got := recommendVerdict(testServers(), best, tc.current, now); got != tc.want {
+				t.Errorf("verdict = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// Env vars that must match between the env file and the running gluetun
+// container for the tunnel to reflect what the manager last wrote.
+var tunnelEnvKeys = []string{
+	"WIREGUARD_ENDPOINT_IP",
+	"WIREGUARD_ENDPOINT_PORT",
+	"WIREGUARD_PUBLIC_KEY",
+}
+
+// protocolEnvKeys are also compared when the protocol fallback manages them.
+var protocolEnvKeys = []string{
+	"VPN_TYPE",
+	"VPN_SERVICE_PROVIDER",
+	"SERVER_NAMES",
+}
+
+// comparedEnvKeys returns the tunnel's env vars plus those the optional
+// protocol fallback, MTU probing and IPv6 support manage.
+func comparedEnvKeys() []string {
+	keys := slices.Clone(tunnelEnvKeys)
+	if cfg.updateStrategy == strategyProvider {
+		keys = slices.Clone(providerEnvKeys)
+	}
+	if cfg.protocolFallback {
+		keys = append(keys, protocolEnvKeys...)
+	}
+	if cfg.mtuProbe {
+		keys = append(keys, "WIREGUARD_MTU")
+	}
+	if cfg.ipv6Mode != ipv6Off {
+		keys = append(keys, "WIREGUARD_ALLOWED_IPS")
+	}
+	keys = append(keys, proxyEnvKeys()...)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// syncedEnvVars returns the env file's values for the variables a runtime
+// without the env file copies to gluetun.
+func syncedEnvVars() map[string]string {
+	envVars := readEnvFile()
+	keys := append([]string{"PROTON_SERVER_NAME"}, comparedEnvKeys()...)
+	env := make(map[string]string)
+	for _, k := range keys {
+		if v, ok := envVars[k]; ok {
+			env[k] = v
+		}
+	}
+	return toGluetunEnv(env)
+}
+
+// runningGluetunEnv returns the environment gluetun is running with, under
+// the manager's names for renamed variables.
+func runningGluetunEnv() (map[string]string, error) {
+	var env map[string]string
+	var err error
+	switch cfg.runtimeBackend {
+	case runtimeNomad:
+		env, err = nomadEnv()
+	case runtimeKubernetes:
+		env, err = kubeEnv()
+	default:
+		env, err = docker.InspectEnv(activeGluetun())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromGluetunEnv(env), nil
+}
+
+// reconcile compares the env file against the live server list and against
+// the running gluetun container, repairing any drift it finds. It returns
+// true if gluetun was recreated on the repaired settings.
+func reconcile(servers []LogicalServer, rt Runtime) bool {
+	envVars := readEnvFile()
+	currentName := envVars["PROTON_SERVER_NAME"]
+	needsRestart := false
+
+	// 1. Env file vs live API data
+	current := protonapi.FindByName(servers, currentName)
+	switch {
+	case currentName == "":
+		if best, _ := findBestServer(servers, ""); best != nil {
+			log(fmt.Sprintf("Drift: no server recorded in env file, adopting %s", best.Name))
+			needsRestart = rt.Apply(best)
+		}
+	case current == nil || current.Status != 1:
+		log(fmt.Sprintf("Drift: %s is no longer available", currentName))
+		if best, _ := findBestServer(servers, currentName); best != nil {
+			needsRestart = rt.Apply(best)
+		}
+	default:
+		// Any live endpoint of the server is fine; only pick anew if it's gone
+		wgServer := endpointByIP(current, envVars["WIREGUARD_ENDPOINT_IP"])
+		if wgServer == nil {
+			wgServer = wireguardEndpoint(current)
+		}
+		if wgServer != nil {
+			for k, v := range managedEnvVars(current, wgServer) {
+				if envVars[k] != v {
+					log(fmt.Sprintf("Drift: %s changed for %s (env file: %q, API: %q)", k, currentName, envVars[k], v))
+					needsRestart = rt.Apply(current)
+					break
+				}
+			}
+		}
+	}
+
+	// 2. Env file vs running container
+	if !needsRestart {
+		running, err := runningGluetunEnv()
+		if err != nil {
+			log(fmt.Sprintf("Reconcile: %v", err))
+			return false
+		}
+		envVars = readEnvFile()
+		for _, k := range comparedEnvKeys() {
+			if running[k] != envVars[k] {
+				log(fmt.Sprintf("Drift: gluetun is running with %s=%q but env file has %q", k, running[k], envVars[k]))
+				needsRestart = true
+				break
+			}
+		}
+	}
+
+	// 3. Gluetun's server list vs the servers it is told to select
+	if !needsRestart && serversJSONReload.Swap(false) {
+		log("Drift: gluetun's server list lacked its configured hostnames, recreating to reload it")
+		needsRestart = true
+	}
+
+	return needsRestart && rt.Restart()
+}
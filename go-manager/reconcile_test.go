@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reconcileServers are testServers with WireGuard endpoints.
+func reconcileServers() []LogicalServer {
+	servers := testServers()
+	for i := range servers {
+		n := string(rune('1' + i))
+		servers[i].Servers = []Server{{EntryIP: "10.0.0." + n, X25519PublicKey: "key" + n, Status: 1}}
+	}
+	return servers
+}
+
+// writeTestEnv replaces the env file with vars.
+func writeTestEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+	var b strings.Builder
+	for k, v := range vars {
+		b.WriteString(k + "=" + v + "\n")
+	}
+	if err := os.WriteFile(cfg.envFile, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeGluetunEnv serves env as the running gluetun container's environment;
+// a nil env makes the inspect fail.
+func fakeGluetunEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	useFakeEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/gluetun/json" || env == nil {
+			http.NotFound(w, r)
+			return
+		}
+		var list []string
+		for k, v := range env {
+			list = append(list, k+"="+v)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Id": "g1", "Config": map[string]any{"Env": list}, "HostConfig": map[string]any{}})
+	})
+}
+
+func TestReconcile(t *testing.T) {
+	servers := reconcileServers()
+	us1 := managedEnvVars(&servers[0], &servers[0].Servers[0])
+	with := func(vars map[string]string, k, v string) map[string]string {
+		out := make(map[string]string, len(vars))
+		for key, val := range vars {
+			out[key] = val
+		}
+		out[k] = v
+		return out
+	}
+
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string // env file
+		running  map[string]string // gluetun's environment, nil if it can't be inspected
+		reload   bool              // servers.json lacked its hostnames
+		restart  bool
+		applied  []string
+		fromFile string // server the env file ends up with
+	}{
+		{name: "env matches", env: us1, running: us1, fromFile: "US#1"},
+		{name: "env stale against the API", env: with(us1, "WIREGUARD_PUBLIC_KEY", "old"), running: us1,
+			restart: true, applied: []string{"US#1"}, fromFile: "US#1"},
+		{name: "server gone", env: with(us1, "PROTON_SERVER_NAME", "US#3"), running: us1,
+			restart: true, applied: []string{"US#2"}, fromFile: "US#2"},
+		{name: "no server recorded", env: map[string]string{}, running: us1,
+			restart: true, applied: []string{"US#2"}, fromFile: "US#2"},
+		{name: "container env differs", env: us1, running: with(us1, "WIREGUARD_ENDPOINT_IP", "10.9.9.9"),
+			restart: true, fromFile: "US#1"},
+		// A failed inspect ends the pass; the servers.json reload waits for the next one.
+		{name: "container can't be inspected", env: us1, running: nil, reload: true, fromFile: "US#1"},
+		{name: "servers.json reload", env: us1, running: us1, reload: true, restart: true, fromFile: "US#1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, "US#1")
+			writeTestEnv(t, tc.env)
+			fakeGluetunEnv(t, tc.running)
+			serversJSONReload.Store(tc.reload)
+			rt := newMockRuntime(t)
+
+			if got := reconcile(reconcileServers(), rt); got != tc.restart {
+				t.Errorf("reconcile = %v, want %v", got, tc.restart)
+			}
+			wantRestarts := 0
+			if tc.restart {
+				wantRestarts = 1
+			}
+			if rt.restarts != wantRestarts {
+				t.Errorf("restarted %d times, want %d", rt.restarts, wantRestarts)
+			}
+			if !slices.Equal(rt.appliedNames(), tc.applied) {
+				t.Errorf("applied %v, want %v", rt.appliedNames(), tc.applied)
+			}
+			if got := getCurrentServerFromEnv(); got != tc.fromFile {
+				t.Errorf("env file has %q, want %q", got, tc.fromFile)
+			}
+			if tc.restart && tc.reload && serversJSONReload.Load() {
+				t.Error("servers.json reload still pending after the recreate")
+			}
+		})
+	}
+}
+
+func TestComparedEnvKeys(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	if got := comparedEnvKeys(); !slices.Equal(got, []string{"WIREGUARD_ENDPOINT_IP", "WIREGUARD_ENDPOINT_PORT", "WIREGUARD_PUBLIC_KEY"}) {
+		t.Errorf("comparedEnvKeys() = %v, want the tunnel's keys", got)
+	}
+
+	cfg.protocolFallback, cfg.mtuProbe, cfg.ipv6Mode = true, true, ipv6Prefer
+	got := comparedEnvKeys()
+	for _, k := range []string{"VPN_TYPE", "SERVER_NAMES", "WIREGUARD_MTU", "WIREGUARD_ALLOWED_IPS", "WIREGUARD_PUBLIC_KEY"} {
+		if !slices.Contains(got, k) {
+			t.Errorf("comparedEnvKeys() = %v, want %s", got, k)
+		}
+	}
+	if !slices.IsSorted(got) || len(slices.Compact(slices.Clone(got))) != len(got) {
+		t.Errorf("comparedEnvKeys() = %v, want sorted and without duplicates", got)
+	}
+}
+
+func TestRunningGluetunEnv(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	fakeGluetunEnv(t, map[string]string{"WIREGUARD_ENDPOINT_IP": "10.0.0.1", "TZ": "UTC"})
+	env, err := runningGluetunEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env["WIREGUARD_ENDPOINT_IP"] != "10.0.0.1" || env["TZ"] != "UTC" {
+		t.Errorf("runningGluetunEnv() = %v", env)
+	}
+
+	fakeGluetunEnv(t, nil)
+	if _, err := runningGluetunEnv(); err == nil {
+		t.Error("runningGluetunEnv succeeded for a missing container")
+	}
+}
+
+func TestReconcileOnceRecordsSwitch(t *testing.T) {
+	setupTestEnv(t, "US#3")
+	servers := reconcileServers()
+	fakeGluetunEnv(t, managedEnvVars(&servers[1], &servers[1].Servers[0]))
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, servers...), rt, newMockHealth(t, true))
+
+	restarted, err := d.reconcileOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restarted || !slices.Equal(rt.appliedNames(), []string{"US#2"}) {
+		t.Errorf("reconcileOnce restarted=%v applied %v, want a switch to US#2", restarted, rt.appliedNames())
+	}
+	if got := stateStore.state().Server; got != "US#2" {
+		t.Errorf("state server = %q, want US#2", got)
+	}
+
+	// The source failing leaves everything alone.
+	source := newMockServerSource(t)
+	source.err = errTest
+	d = newTestDaemon(source, rt, newMockHealth(t, true))
+	if _, err := d.reconcileOnce(); err == nil {
+		t.Error("reconcileOnce succeeded without a server list")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"gluetun-proton-manager/health"
+)
+
+// Reliability scores rank servers by how they have actually behaved here:
+// how often switching to them worked, how long they stayed up and how fast
+// they were. Selection adds (1 - score) * RELIABILITY_WEIGHT to a server's
+// load, so a server that keeps failing loses to a slightly busier one.
+
+const (
+	throughputLimit   = 25 << 20
+	throughputTimeout = 15 * time.Second
+)
+
+// recordSwitch records the outcome of bringing up a server. A success on a
+// new server closes the previous server's session and opens one for it; a
+// failure ends the current session.
+func (s *Store) recordSwitch(name string, ok bool) {
+	if name == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ok && name == s.Current {
+		return
+	}
+	s.closeSession()
+	rec := s.record(name)
+	if ok {
+		rec.Connects++
+		s.Current, s.CurrentSince = name, time.Now()
+	} else {
+		rec.ConnectFailures++
+	}
+	s.save()
+}
+
+// recordDrop counts an established connection going unhealthy and ends its
+// session. Servers that never came up are counted by recordSwitch instead.
+func (s *Store) recordDrop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" || name != s.Current {
+		return
+	}
+	s.record(name).Drops++
+	s.closeSession()
+	s.save()
+}
+
+// closeSession adds the open session's time to its server and remembers it
+// as recently used. Callers hold mu.
+func (s *Store) closeSession() {
+	if s.Current != "" && !s.CurrentSince.IsZero() {
+		s.record(s.Current).UptimeSeconds += int64(time.Since(s.CurrentSince).Seconds())
+		s.addRecent(s.Current)
+	}
+	s.Current, s.CurrentSince = "", time.Time{}
+}
+
+// recordThroughput folds a sample into the server's moving average.
+func (s *Store) recordThroughput(name string, mbps float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.record(name)
+	if rec.ThroughputMbps == 0 {
+		rec.ThroughputMbps = mbps
+	} else {
+		rec.ThroughputMbps = 0.7*rec.ThroughputMbps + 0.3*mbps
+	}
+	s.save()
+}
+
+// reliability returns a score between 0 and 1. Servers without history get
+// the same score as one with a short clean record, so a proven server is
+// preferred to an unknown one but an unknown one to a failing one.
+func (s *Store) reliability(name string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rec ServerRecord
+	if r, ok := s.Servers[name]; ok {
+		rec = *r
+	}
+
+	// Switch success rate, as if starting from 9 successes in 10
+	success := (float64(rec.Connects) + 1.8) / float64(rec.Connects+rec.ConnectFailures+2)
+
+	// Drops per day connected, as if starting from a clean day
+	uptime := time.Duration(rec.UptimeSeconds) * time.Second
+	if name == s.Current && !s.CurrentSince.IsZero() {
+		uptime += time.Since(s.CurrentSince)
+	}
+	days := uptime.Hours()/24 + 1
+	stability := days / (days + float64(rec.Drops))
+
+	// Throughput relative to the fastest server seen; unmeasured is neutral
+	speed := 1.0
+	if rec.ThroughputMbps > 0 {
+		fastest := 0.0
+		for _, r := range s.Servers {
+			fastest = math.Max(fastest, r.ThroughputMbps)
+		}
+		speed = 0.5 + 0.5*rec.ThroughputMbps/fastest
+	}
+	return success * stability * speed
+}
+
+// reliabilityPenalty is the load, in points, added to a server when ranking
+// candidates.
+func reliabilityPenalty(name string) float64 {
+	if stateStore == nil || cfg.reliabilityWeight <= 0 {
+		return 0
+	}
+	return float64(cfg.reliabilityWeight) * (1 - stateStore.reliability(name))
+}
+
+// throughputClient returns a client reaching the internet through the
+// tunnel, or nil if the health mode doesn't give the manager one.
+func throughputClient() *http.Client {
+	switch cfg.healthMode {
+	case healthModeNative:
+		return &http.Client{Timeout: throughputTimeout}
+	case healthModeProxy:
+		client, err := health.ProxyClient(cfg.healthProxyURL)
+		if err != nil {
+			return nil
+		}
+		client.Timeout = throughputTimeout
+		return client
+	}
+	return nil
+}
+
+// sampleThroughput measures the tunnel's download rate on a freshly
+// connected server and records it.
+func sampleThroughput(name string) {
+	client := throughputClient()
+	if client == nil {
+		return
+	}
+	mbps, err := health.Throughput(client, cfg.throughputProbeURL, throughputLimit)
+	if err != nil {
+		log(fmt.Sprintf("Throughput sample on %s failed: %v", name, err))
+		return
+	}
+	log(fmt.Sprintf("Throughput on %s: %.1f Mbit/s", name, mbps))
+	stateStore.recordThroughput(name, mbps)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReliabilityOrdersByHistory(t *testing.T) {
+	s := loadStore(filepath.Join(t.TempDir(), "state.json"))
+
+	// good connects cleanly; flaky connects but drops; broken never comes up
+	s.recordSwitch("good", true)
+	s.recordSwitch("flaky", true)
+	s.recordDrop("flaky")
+	s.recordSwitch("flaky", true)
+	s.recordDrop("flaky")
+	for range 4 {
+		s.recordSwitch("broken", false)
+	}
+
+	good, unknown, flaky, broken := s.reliability("good"), s.reliability("unknown"), s.reliability("flaky"), s.reliability("broken")
+	if !(good > unknown && unknown > flaky && flaky > broken) {
+		t.Errorf("scores good %.2f, unknown %.2f, flaky %.2f, broken %.2f; want them in that order", good, unknown, flaky, broken)
+	}
+}
+
+func TestRecordDropIgnoresServerWithoutSession(t *testing.T) {
+	s := loadStore(filepath.Join(t.TempDir(), "state.json"))
+	s.recordSwitch("a", true)
+	s.recordDrop("b")
+	if rec := s.Servers["b"]; rec != nil && rec.Drops != 0 {
+		t.Errorf("counted %d drops for a server that wasn't connected", rec.Drops)
+	}
+	if s.Current != "a" {
+		t.Errorf("current session on %q, want a", s.Current)
+	}
+}
+
+func TestSelectionPenalizesUnreliableServer(t *testing.T) {
+	setupTestEnv(t, "")
+	cfg.reliabilityWeight = 30
+	stateStore.recordSwitch("US#2", false)
+	stateStore.recordSwitch("US#2", false)
+	stateStore.recordSwitch("US#2", false)
+
+	servers := testServers()
+	servers[0].Load = 15 // US#1, just above US#2's 10
+	best, _ := findBestServer(servers, "")
+	if best == nil || best.Name != "US#1" {
+		t.Errorf("best = %v, want US#1 over the failing US#2", best)
+	}
+
+	cfg.reliabilityWeight = 0
+	if best, _ := findBestServer(servers, ""); best == nil || best.Name != "US#2" {
+		t.Errorf("best = %v with scoring off, want US#2", best)
+	}
+}
+
+func TestAvoidRecentServers(t *testing.T) {
+	setupTestEnv(t, "")
+	for _, name := range []string{"US#2", "US#1", "US#4"} {
+		stateStore.recordSwitch(name, true)
+	}
+
+	cfg.avoidLastN = 1
+	if !avoidRecent("US#1") || avoidRecent("US#2") || avoidRecent("US#4") {
+		t.Error("with AVOID_LAST_N_SERVERS=1 only US#1, the server just left, should be avoided")
+	}
+	cfg.avoidLastN, cfg.avoidRecentHours = 0, 1
+	if !avoidRecent("US#2") || !avoidRecent("US#1") {
+		t.Error("servers left within the hour should be avoided")
+	}
+
+	// US#1 is the least loaded but was just left
+	cfg.avoidLastN, cfg.avoidRecentHours = 1, 0
+	servers := testServers()
+	servers[0].Load = 5
+	best, _ := findBestServer(servers, "US#4")
+	if best == nil || best.Name != "US#2" {
+		t.Errorf("best = %v, want US#2", best)
+	}
+}
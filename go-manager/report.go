@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report schedules
+const (
+	reportDaily  = "daily"
+	reportWeekly = "weekly" // sent on Mondays
+)
+
+// reportTopServers is how many servers a report lists.
+const reportTopServers = 5
+
+// connectivityReport summarizes the tunnel over one report period.
+type connectivityReport struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// TrackedSeconds is the part of the period the manager was running for
+	TrackedSeconds int64          `json:"tracked_seconds"`
+	UptimePct      float64        `json:"uptime_pct"`
+	AvgLoad        float64        `json:"avg_load"`
+	Switches       int            `json:"switches"`
+	FailedSwitches int            `json:"failed_switches"`
+	Triggers       map[string]int `json:"triggers,omitempty"`
+	TopServers     []reportServer `json:"top_servers"`
+}
+
+// reportServer is the time spent connected to one server.
+type reportServer struct {
+	Name     string  `json:"name"`
+	Seconds  int64   `json:"seconds"`
+	SharePct float64 `json:"share_pct"`
+}
+
+// reportTracker accumulates the daemon's status over a report period,
+// weighting each status by how long it lasted.
+type reportTracker struct {
+	mu      sync.Mutex
+	since   time.Time
+	last    Status
+	lastAt  time.Time
+	tracked time.Duration
+	healthy time.Duration
+	loadSum float64 // load percent × seconds
+	servers map[string]time.Duration
+}
+
+func newReportTracker(now time.Time) *reportTracker {
+	return &reportTracker{since: now, lastAt: now, servers: make(map[string]time.Duration)}
+}
+
+// observe books the time since the previous status to it, then starts
+// timing st.
+func (t *reportTracker) observe(st Status, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.book(now)
+	t.last = st
+}
+
+func (t *reportTracker) book(now time.Time) {
+	elapsed := now.Sub(t.lastAt)
+	t.lastAt = now
+	if elapsed <= 0 || t.last.State == "" {
+		return
+	}
+	t.tracked += elapsed
+	if t.last.Healthy {
+		t.healthy += elapsed
+	}
+	if t.last.Server != "" {
+		t.servers[t.last.Server] += elapsed
+		t.loadSum += float64(t.last.Load) * elapsed.Seconds()
+	}
+}
+
+// take builds the report for the period up to now and starts the next one.
+func (t *reportTracker) take(period string, now time.Time) connectivityReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.book(now)
+
+	r := connectivityReport{Period: period, From: t.since, To: now, TrackedSeconds: int64(t.tracked.Seconds())}
+	if t.tracked > 0 {
+		r.UptimePct = roundPct(t.healthy.Seconds() / t.tracked.Seconds())
+	}
+	var connected time.Duration
+	for name, d := range t.servers {
+		connected += d
+		r.TopServers = append(r.TopServers, reportServer{Name: name, Seconds: int64(d.Seconds())})
+	}
+	if connected > 0 {
+		r.AvgLoad = float64(int(t.loadSum/connected.Seconds()*10+0.5)) / 10
+		for i := range r.TopServers {
+			r.TopServers[i].SharePct = roundPct(float64(r.TopServers[i].Seconds) / connected.Seconds())
+		}
+	}
+	slices.SortFunc(r.TopServers, func(a, b reportServer) int {
+		if a.Seconds != b.Seconds {
+			return int(b.Seconds - a.Seconds)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(r.TopServers) > reportTopServers {
+		r.TopServers = r.TopServers[:reportTopServers]
+	}
+	for _, ev := range auditEvents(r.From, r.To) {
+		r.Switches++
+		if ev.Outcome != outcomeSuccess {
+			r.FailedSwitches++
+		}
+		if r.Triggers == nil {
+			r.Triggers = make(map[string]int)
+		}
+		r.Triggers[ev.Trigger]++
+	}
+
+	t.since, t.tracked, t.healthy, t.loadSum = now, 0, 0, 0
+	t.servers = make(map[string]time.Duration)
+	return r
+}
+
+// roundPct turns a fraction into a percentage with one decimal.
+func roundPct(f float64) float64 {
+	return float64(int(f*1000+0.5)) / 10
+}
+
+// auditEvents reads the audit log entries between from and to.
+func auditEvents(from, to time.Time) []auditEvent {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.Open(auditFile())
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var evs []auditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev auditEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil || ev.Time.Before(from) || !ev.Time.Before(to) {
+			continue
+		}
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+// nextReport returns when the next report after now is due: every day at
+// REPORT_TIME, or on Mondays for weekly reports, in local time.
+func nextReport(schedule string, minute int, now time.Time) time.Time {
+	y, m, d := now.Date()
+	next := time.Date(y, m, d, minute/60, minute%60, 0, 0, now.Location())
+	for !next.After(now) || (schedule == reportWeekly && next.Weekday() != time.Monday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// runReporter sends a connectivity report to the notifiers and saves it
+// under LOG_DIR on REPORT_SCHEDULE.
+func runReporter(statuses <-chan Status) {
+	tracker := newReportTracker(time.Now())
+	timer := time.NewTimer(time.Until(nextReport(cfg.reportSchedule, cfg.reportMinute, time.Now())))
+	for {
+		select {
+		case st := <-statuses:
+			tracker.observe(st, time.Now())
+		case <-timer.C:
+			r := tracker.take(cfg.reportSchedule, time.Now())
+			if err := saveReport(r); err != nil {
+				log(fmt.Sprintf("Failed to save report: %v", err))
+			}
+			dispatch(alert{Kind: alertReport, Subject: reportSubject(r), Body: reportBody(r), Time: r.To})
+			timer.Reset(time.Until(nextReport(cfg.reportSchedule, cfg.reportMinute, time.Now())))
+		}
+	}
+}
+
+// saveReport writes r to LOG_DIR/reports as JSON.
+func saveReport(r connectivityReport) error {
+	dir := filepath.Join(cfg.logDir, "reports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json", r.Period, r.To.Format("2006-01-02"))
+	return os.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0644)
+}
+
+func reportSubject(r connectivityReport) string {
+	period := "Daily"
+	if r.Period == reportWeekly {
+		period = "Weekly"
+	}
+	return fmt.Sprintf("%s VPN report: %.1f%% uptime, %d switches", period, r.UptimePct, r.Switches)
+}
+
+func reportBody(r connectivityReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s to %s\n", r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"))
+	if tracked := time.Duration(r.TrackedSeconds) * time.Second; tracked < r.To.Sub(r.From)-time.Minute {
+		fmt.Fprintf(&b, "The manager ran for %s of it.\n", tracked.Round(time.Minute))
+	}
+	fmt.Fprintf(&b, "Uptime: %.1f%%\n", r.UptimePct)
+	fmt.Fprintf(&b, "Switches: %d", r.Switches)
+	if r.FailedSwitches > 0 {
+		fmt.Fprintf(&b, " (%d failed)", r.FailedSwitches)
+	}
+	if len(r.Triggers) > 0 {
+		var triggers []string
+		for trigger, n := range r.Triggers {
+			triggers = append(triggers, fmt.Sprintf("%s %d", trigger, n))
+		}
+		slices.Sort(triggers)
+		fmt.Fprintf(&b, ": %s", strings.Join(triggers, ", "))
+	}
+	fmt.Fprintf(&b, "\nAverage load: %.1f%%\n", r.AvgLoad)
+	if len(r.TopServers) > 0 {
+		var servers []string
+		for _, s := range r.TopServers {
+			servers = append(servers, fmt.Sprintf("%s (%.1f%%)", s.Name, s.SharePct))
+		}
+		fmt.Fprintf(&b, "Top servers: %s\n", strings.Join(servers, ", "))
+	}
+	return b.String()
+}
+
+// reportProblems reports REPORT_* settings that can't work.
+func reportProblems() []string {
+	var problems []string
+	switch cfg.reportSchedule {
+	case "", reportDaily, reportWeekly:
+	default:
+		problems = append(problems, fmt.Sprintf("REPORT_SCHEDULE must be %s or %s, got %q", reportDaily, reportWeekly, cfg.reportSchedule))
+	}
+	if cfg.reportMinute < 0 {
+		problems = append(problems, fmt.Sprintf("REPORT_TIME must be HH:MM, got %q", os.Getenv("REPORT_TIME")))
+	}
+	return problems
+}
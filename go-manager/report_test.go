@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportTracker(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	start := time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)
+	audit(auditEvent{Time: start.Add(time.Hour), Trigger: triggerHealth, Outcome: outcomeSuccess})
+	audit(auditEvent{Time: start.Add(2 * time.Hour), Trigger: triggerLoad, Outcome: outcomeFailed})
+	audit(auditEvent{Time: start.Add(-time.Hour), Trigger: triggerLoad, Outcome: outcomeSuccess}) // before the period
+
+	tr := newReportTracker(start)
+	tr.observe(Status{State: stateHealthy.String(), Server: "CH#4", Load: 20, Healthy: true}, start)
+	tr.observe(Status{State: stateUnhealthy.String(), Server: "CH#4", Load: 20}, start.Add(15*time.Hour))
+	tr.observe(Status{State: stateHealthy.String(), Server: "NL#2", Load: 60, Healthy: true}, start.Add(16*time.Hour))
+	r := tr.take(reportDaily, start.Add(20*time.Hour))
+
+	if r.TrackedSeconds != 20*3600 || r.UptimePct != 95 {
+		t.Errorf("tracked %ds, uptime %.1f%%; want 72000s, 95%%", r.TrackedSeconds, r.UptimePct)
+	}
+	if r.AvgLoad != 28 { // (16h × 20 + 4h × 60) / 20h
+		t.Errorf("average load %.1f, want 28", r.AvgLoad)
+	}
+	if r.Switches != 2 || r.FailedSwitches != 1 || r.Triggers[triggerLoad] != 1 {
+		t.Errorf("switches %d, failed %d, triggers %v", r.Switches, r.FailedSwitches, r.Triggers)
+	}
+	if len(r.TopServers) != 2 || r.TopServers[0].Name != "CH#4" || r.TopServers[0].SharePct != 80 {
+		t.Errorf("top servers %+v", r.TopServers)
+	}
+	if body := reportBody(r); !strings.Contains(body, "CH#4 (80.0%), NL#2 (20.0%)") || !strings.Contains(body, "(1 failed)") {
+		t.Errorf("body:\n%s", body)
+	}
+
+	// The next period starts empty
+	if next := tr.take(reportDaily, start.Add(21*time.Hour)); next.From != r.To || next.TopServers[0].Seconds != 3600 {
+		t.Errorf("next period %+v", next)
+	}
+
+	if err := saveReport(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.logDir, "reports", "daily-2026-10-16.json")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNextReport(t *testing.T) {
+	thu := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC) // a Thursday
+	if got := nextReport(reportDaily, 8*60, thu); !got.Equal(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("daily after 08:00: %v", got)
+	}
+	if got := nextReport(reportDaily, 10*60, thu); !got.Equal(time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("daily before 10:00: %v", got)
+	}
+	if got := nextReport(reportWeekly, 8*60, thu); !got.Equal(time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly: %v", got)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"strings"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/retry"
+)
+
+// retrySetting reads the policy in the named variable on top of def. An
+// invalid spec keeps def and is reported through retryErr.
+func retrySetting(name string, def retry.Policy) retry.Policy {
+	p, err := retry.Parse(os.Getenv(name), def)
+	if err != nil && retryErr == nil {
+		retryErr = fmt.Errorf("%s: %v", name, err)
+	}
+	return p
+}
+
+// apiRetryable retries network errors and server-side failures. Rate
+// limits, verification and subscription errors are left to the load loop,
+// which backs off for much longer.
+func apiRetryable(err error) bool {
+	if classifyAPIError(err) != apiErrOther {
+		return false
+	}
+	var e *protonapi.Error
+	if errors.As(err, &e) {
+		return e.Status >= 500
+	}
+	return classOf(err) == classAPIUnreachable
+}
+
+// dockerRetryable retries everything except a missing container, which
+// won't appear by waiting.
+func dockerRetryable(err error) bool {
+	return !strings.Contains(err.Error(), "No such ")
+}
+
+// notifyRetryable gives up on permanent SMTP rejections (5xx), such as a
+// refused recipient or failed authentication.
+func notifyRetryable(err error) bool {
+	var e *textproto.Error
+	return !errors.As(err, &e) || e.Code < 500
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestRetryClassification(t *testing.T) {
+	unreachable := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	apiTests := []struct {
+		err  error
+		want bool
+	}{
+		{unreachable, true},
+		{&protonapi.Error{Status: 503}, true},
+		{&protonapi.Error{Status: 429}, false},
+		{&protonapi.Error{Status: 422, Code: protonapi.CodeHumanVerification}, false},
+		{&protonapi.Error{Status: 400}, false},
+		{errors.New("invalid character '<' looking for beginning of value"), false},
+	}
+	for _, tt := range apiTests {
+		if got := apiRetryable(tt.err); got != tt.want {
+			t.Errorf("apiRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+
+	if dockerRetryable(errors.New("exit status 1: Error response from daemon: No such container: gluetun")) {
+		t.Error("a missing container should not be retried")
+	}
+	if !dockerRetryable(errors.New("exit status 1: Error response from daemon: Conflict")) {
+		t.Error("a daemon conflict should be retried")
+	}
+
+	if notifyRetryable(&textproto.Error{Code: 535, Msg: "authentication failed"}) {
+		t.Error("a 5xx SMTP reply should not be retried")
+	}
+	if !notifyRetryable(&textproto.Error{Code: 421, Msg: "try again later"}) || !notifyRetryable(unreachable) {
+		t.Error("4xx SMTP replies and network errors should be retried")
+	}
+}
@@ -0,0 +1,163 @@
+// Package retry repeats operations that failed for transient reasons, with
+// exponential backoff and jitter between the attempts.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy says how often and how patiently to retry.
+type Policy struct {
+	// Attempts is the total number of tries; below 1 means 1.
+	Attempts int
+	// Base is the delay after the first failure; each further failure
+	// multiplies it by Multiplier (2 if unset), up to Max.
+	Base       time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the fraction of each delay that is randomized, from 0 to 1,
+	// so retries from several places don't line up.
+	Jitter float64
+	// Retryable reports whether err is worth another try. Nil retries every
+	// error except those marked Permanent.
+	Retryable func(error) bool
+	// MinDelay, if set, returns a delay err asks for, such as an HTTP
+	// Retry-After; the longer of it and the backoff is used.
+	MinDelay func(error) time.Duration
+}
+
+// Delay returns the pause after the given number of consecutive failures,
+// counting from 1.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.Base <= 0 || failures < 1 {
+		return 0
+	}
+	mult := p.Multiplier
+	if mult <= 0 {
+		mult = 2
+	}
+	d := float64(p.Base)
+	for i := 1; i < failures && (p.Max <= 0 || d < float64(p.Max)); i++ {
+		d *= mult
+	}
+	if p.Max > 0 {
+		d = min(d, float64(p.Max))
+	}
+	if p.Jitter > 0 {
+		d -= d * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, returns an error that isn't retryable, the
+// attempts run out or ctx is done. It returns fn's last error.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	for failures := 1; ; failures++ {
+		err := fn()
+		if err == nil || failures >= p.Attempts || !p.retryable(err) {
+			var perm *permanentError
+			if errors.As(err, &perm) {
+				return perm.err
+			}
+			return err
+		}
+		delay := p.Delay(failures)
+		if p.MinDelay != nil {
+			delay = max(delay, p.MinDelay(err))
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+func (p Policy) retryable(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// Permanent marks err as not worth retrying; Do returns it unwrapped.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Parse reads "attempts=3,base=2s,max=30s,jitter=0.2" (any subset, also
+// "multiplier=1.5") on top of def. An empty spec returns def.
+func Parse(spec string, def Policy) (Policy, error) {
+	p := def
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return def, fmt.Errorf("%q is not key=value", field)
+		}
+		var err error
+		switch strings.TrimSpace(key) {
+		case "attempts":
+			p.Attempts, err = strconv.Atoi(value)
+			if err == nil && p.Attempts < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "base":
+			p.Base, err = parseDelay(value)
+		case "max":
+			p.Max, err = parseDelay(value)
+		case "multiplier":
+			p.Multiplier, err = strconv.ParseFloat(value, 64)
+			if err == nil && p.Multiplier < 1 {
+				err = errors.New("must be at least 1")
+			}
+		case "jitter":
+			p.Jitter, err = strconv.ParseFloat(value, 64)
+			if err == nil && (p.Jitter < 0 || p.Jitter > 1) {
+				err = errors.New("must be between 0 and 1")
+			}
+		default:
+			return def, fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return def, fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	if p.Max > 0 && p.Base > p.Max {
+		return def, fmt.Errorf("base %s exceeds max %s", p.Base, p.Max)
+	}
+	return p, nil
+}
+
+func parseDelay(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err == nil && d < 0 {
+		err = errors.New("must not be negative")
+	}
+	return d, err
+}
+
+// String formats p the way Parse reads it.
+func (p Policy) String() string {
+	return fmt.Sprintf("attempts=%d,base=%s,max=%s,jitter=%g", max(p.Attempts, 1), p.Base, p.Max, p.Jitter)
+}
@@ -0,0 +1,97 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := Policy{Base: time.Second, Max: 10 * time.Second}
+	for failures, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := p.Delay(failures); got != want {
+			t.Errorf("Delay(%d) = %s, want %s", failures, got, want)
+		}
+	}
+	p.Multiplier = 1.5
+	if got := p.Delay(3); got != 2250*time.Millisecond {
+		t.Errorf("Delay(3) with multiplier 1.5 = %s, want 2.25s", got)
+	}
+
+	p = Policy{Base: 10 * time.Second, Jitter: 0.5}
+	for range 100 {
+		if d := p.Delay(1); d < 5*time.Second || d > 10*time.Second {
+			t.Fatalf("Delay with 50%% jitter = %s, want 5s to 10s", d)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	errTransient, errFatal := errors.New("transient"), errors.New("fatal")
+	p := Policy{Attempts: 3, Base: time.Millisecond, Retryable: func(err error) bool { return err == errTransient }}
+
+	calls := 0
+	err := p.Do(context.Background(), func() error {
+		if calls++; calls < 3 {
+			return errTransient
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("succeeding on the last attempt: err %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	if err := p.Do(context.Background(), func() error { calls++; return errTransient }); err != errTransient || calls != 3 {
+		t.Errorf("always failing: err %v after %d calls, want transient after 3", err, calls)
+	}
+
+	calls = 0
+	if err := p.Do(context.Background(), func() error { calls++; return errFatal }); err != errFatal || calls != 1 {
+		t.Errorf("not retryable: err %v after %d calls, want fatal after 1", err, calls)
+	}
+
+	calls = 0
+	err = Policy{Attempts: 5}.Do(context.Background(), func() error { calls++; return Permanent(errFatal) })
+	if err != errFatal || calls != 1 {
+		t.Errorf("permanent: err %v after %d calls, want the unwrapped error after 1", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = Policy{Attempts: 5, Base: time.Hour}.Do(ctx, func() error { calls++; cancel(); return errTransient })
+	if err != errTransient || calls != 1 {
+		t.Errorf("cancelled: err %v after %d calls, want transient after 1", err, calls)
+	}
+
+	start := time.Now()
+	calls = 0
+	p = Policy{Attempts: 2, Base: time.Millisecond, MinDelay: func(error) time.Duration { return 50 * time.Millisecond }}
+	p.Do(context.Background(), func() error { calls++; return errTransient })
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("MinDelay of 50ms: retried after %s", elapsed)
+	}
+}
+
+func TestParse(t *testing.T) {
+	def := Policy{Attempts: 3, Base: time.Second, Max: time.Minute, Jitter: 0.2}
+	p, err := Parse("attempts=5, base=500ms,jitter=0", def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Attempts != 5 || p.Base != 500*time.Millisecond || p.Max != time.Minute || p.Jitter != 0 {
+		t.Errorf("Parse = %+v", p)
+	}
+	if got := p.String(); got != "attempts=5,base=500ms,max=1m0s,jitter=0" {
+		t.Errorf("String() = %q", got)
+	}
+	if p, err := Parse("", def); err != nil || p.Attempts != 3 {
+		t.Errorf("empty spec: %+v, %v", p, err)
+	}
+	for _, spec := range []string{"attempts=0", "base=-1s", "jitter=2", "multiplier=0.5", "tries=3", "base", "base=2m"} {
+		if _, err := Parse(spec, def); err == nil {
+			t.Errorf("Parse(%q) accepted", spec)
+		}
+	}
+}
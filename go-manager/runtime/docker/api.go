@@ -0,0 +1,431 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultHost is the Engine API socket used when no host is given.
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// api, when set, is used for container operations instead of the CLI.
+var api *Client
+
+// UseAPI routes container operations through the Engine API instead of the
+// docker CLI.
+func UseAPI(c *Client) { api = c }
+
+// Client is a minimal Docker Engine API client, enough to inspect, exec
+// into, follow and recreate containers without the docker CLI.
+type Client struct {
+	http *http.Client
+	base string
+}
+
+// NewClient connects to the Engine API at host, in DOCKER_HOST form:
+// unix:///var/run/docker.sock, tcp://host:2376 or ssh://user@host. A
+// tcp:// host uses TLS if tlsConfig is set.
+func NewClient(host string, tlsConfig *tls.Config) (*Client, error) {
+	if host == "" {
+		host = DefaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %v", host, err)
+	}
+
+	transport := &http.Transport{}
+	base := "http://docker"
+	switch u.Scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", u.Path)
+		}
+	case "tcp":
+		addr := u.Host
+		if u.Port() == "" {
+			port := "2375"
+			if tlsConfig != nil {
+				port = "2376"
+			}
+			addr = net.JoinHostPort(u.Hostname(), port)
+		}
+		base = "http://" + addr
+		if tlsConfig != nil {
+			base = "https://" + addr
+			transport.TLSClientConfig = tlsConfig
+		}
+	case "ssh":
+		args := sshArgs(u)
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialCommand(ctx, "ssh", args...)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q", host)
+	}
+	return &Client{http: &http.Client{Transport: transport}, base: base}, nil
+}
+
+// apiTimeout bounds every call except following logs. Stopping a container
+// can take a while.
+const apiTimeout = 2 * time.Minute
+
+// do sends a request and returns the response if it succeeded. 304 (already
+// started or stopped) counts as success.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+		defer resp.Body.Close()
+		var e struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Message == "" {
+			e.Message = resp.Status
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, e.Message)
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes the JSON response into out, if given.
+func (c *Client) call(method, path string, query url.Values, body, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// containerJSON is the part of an inspect response the manager uses.
+// Config and HostConfig are kept raw so a recreate copies them in full.
+type containerJSON struct {
+	ID     string `json:"Id"`
+	Name   string
+	Config json.RawMessage
+	State  struct {
+		Status string
+		Health *struct {
+			Status string
+		}
+	}
+	HostConfig      json.RawMessage
+	NetworkSettings struct {
+		Networks map[string]json.RawMessage
+	}
+}
+
+type containerConfig struct {
+	Env    []string
+	Labels map[string]string
+	Image  string
+	Tty    bool
+}
+
+func (c *Client) inspect(name string) (containerJSON, containerConfig, error) {
+	var info containerJSON
+	var cfg containerConfig
+	if err := c.call("GET", "/containers/"+url.PathEscape(name)+"/json", nil, nil, &info); err != nil {
+		return info, cfg, err
+	}
+	err := json.Unmarshal(info.Config, &cfg)
+	return info, cfg, err
+}
+
+func (c *Client) list(label string) ([]Container, error) {
+	filters, _ := json.Marshal(map[string][]string{"label": {label}})
+	var found []struct {
+		Names  []string
+		Labels map[string]string
+	}
+	if err := c.call("GET", "/containers/json", url.Values{"all": {"1"}, "filters": {string(filters)}}, nil, &found); err != nil {
+		return nil, err
+	}
+	list := make([]Container, 0, len(found))
+	for _, f := range found {
+		if len(f.Names) == 0 {
+			continue
+		}
+		list = append(list, Container{
+			Name:    strings.TrimPrefix(f.Names[0], "/"),
+			Service: f.Labels["com.docker.compose.service"],
+		})
+	}
+	return list, nil
+}
+
+func (c *Client) action(verb, name string) error {
+	return c.call("POST", "/containers/"+url.PathEscape(name)+"/"+verb, nil, nil, nil)
+}
+
+func (c *Client) version() (string, error) {
+	var v struct{ Version string }
+	err := c.call("GET", "/version", nil, nil, &v)
+	return v.Version, err
+}
+
+// exec runs cmd in a container and returns its combined output, with an
+// error if it exits non-zero.
+func (c *Client) exec(container string, cmd ...string) ([]byte, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	spec := map[string]any{"AttachStdout": true, "AttachStderr": true, "Cmd": cmd}
+	if err := c.call("POST", "/containers/"+url.PathEscape(container)+"/exec", nil, spec, &created); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	resp, err := c.do(ctx, "POST", "/exec/"+created.ID+"/start", nil, map[string]any{"Detach": false, "Tty": false})
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err = demux(&out, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return out.Bytes(), err
+	}
+
+	var result struct{ ExitCode int }
+	if err := c.call("GET", "/exec/"+created.ID+"/json", nil, nil, &result); err != nil {
+		return out.Bytes(), err
+	}
+	if result.ExitCode != 0 {
+		return out.Bytes(), fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return out.Bytes(), nil
+}
+
+// logs follows a container's output from now on.
+func (c *Client) logs(name string) (io.ReadCloser, error) {
+	_, cfg, err := c.inspect(name)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}, "tail": {"0"}}
+	resp, err := c.do(context.Background(), "GET", "/containers/"+url.PathEscape(name)+"/logs", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Tty {
+		return resp.Body, nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(demux(pw, resp.Body))
+	}()
+	return readCloser{pr, func() error {
+		pr.Close()
+		return resp.Body.Close()
+	}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+// demux copies a multiplexed stdout/stderr stream (8-byte frame headers) to
+// w as one stream.
+func demux(w io.Writer, r io.Reader) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// RecreateOptions are the changes a recreate makes to a container's
+// configuration.
+type RecreateOptions struct {
+	// Env is applied over the container's environment.
+	Env map[string]string
+	// NetworkContainer, if set, replaces the container a network_mode:
+	// container:... shares, whose old ID is gone once it is recreated.
+	NetworkContainer string
+}
+
+// recreate replaces a container with one created from the same config,
+// host config and networks, with opts applied. The old container is kept
+// (stopped and renamed) until the new one has started, and brought back if
+// anything fails.
+func (c *Client) recreate(name string, opts RecreateOptions) error {
+	old, cfg, err := c.inspect(name)
+	if err != nil {
+		return err
+	}
+	name = strings.TrimPrefix(old.Name, "/")
+
+	var config, hostConfig map[string]any
+	if err := json.Unmarshal(old.Config, &config); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(old.HostConfig, &hostConfig); err != nil {
+		return err
+	}
+	config["Env"] = mergeEnv(cfg.Env, opts.Env)
+	mode, _ := hostConfig["NetworkMode"].(string)
+	if opts.NetworkContainer != "" && strings.HasPrefix(mode, "container:") {
+		hostConfig["NetworkMode"] = "container:" + opts.NetworkContainer
+	}
+	config["HostConfig"] = hostConfig
+
+	// Endpoints are created on the primary network; any others are
+	// connected afterwards, which older engines require.
+	endpoints := endpointConfigs(old)
+	primary := mode
+	if _, ok := endpoints[primary]; !ok {
+		primary = ""
+		if names := sortedKeys(endpoints); len(names) > 0 {
+			primary = names[0]
+		}
+	}
+	if primary != "" {
+		config["NetworkingConfig"] = map[string]any{
+			"EndpointsConfig": map[string]any{primary: endpoints[primary]},
+		}
+	}
+
+	if err := c.action("stop", old.ID); err != nil {
+		return err
+	}
+	backup := name + "-replaced"
+	if err := c.call("POST", "/containers/"+old.ID+"/rename", url.Values{"name": {backup}}, nil, nil); err != nil {
+		c.action("start", old.ID)
+		return err
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = c.call("POST", "/containers/create", url.Values{"name": {name}}, config, &created)
+	if err == nil {
+		for _, n := range sortedKeys(endpoints) {
+			if n == primary || err != nil {
+				continue
+			}
+			err = c.call("POST", "/networks/"+url.PathEscape(n)+"/connect", nil,
+				map[string]any{"Container": created.ID, "EndpointConfig": endpoints[n]}, nil)
+		}
+	}
+	if err == nil {
+		err = c.action("start", created.ID)
+	}
+	if err != nil {
+		if created.ID != "" {
+			c.call("DELETE", "/containers/"+created.ID, url.Values{"force": {"1"}}, nil, nil)
+		}
+		c.call("POST", "/containers/"+old.ID+"/rename", url.Values{"name": {name}}, nil, nil)
+		c.action("start", old.ID)
+		return fmt.Errorf("recreating %s (old container restored): %v", name, err)
+	}
+	return c.call("DELETE", "/containers/"+old.ID, nil, nil, nil)
+}
+
+// endpointConfigs returns the user-set parts of a container's network
+// endpoints, dropping runtime state and the alias Docker derives from the
+// old container ID.
+func endpointConfigs(info containerJSON) map[string]map[string]any {
+	endpoints := make(map[string]map[string]any)
+	for n, raw := range info.NetworkSettings.Networks {
+		var ep map[string]any
+		if json.Unmarshal(raw, &ep) != nil {
+			continue
+		}
+		kept := make(map[string]any)
+		for _, k := range []string{"IPAMConfig", "Links", "DriverOpts"} {
+			if ep[k] != nil {
+				kept[k] = ep[k]
+			}
+		}
+		if aliases, ok := ep["Aliases"].([]any); ok {
+			var keep []any
+			for _, a := range aliases {
+				if s, _ := a.(string); s != "" && !strings.HasPrefix(info.ID, s) {
+					keep = append(keep, s)
+				}
+			}
+			kept["Aliases"] = keep
+		}
+		endpoints[n] = kept
+	}
+	return endpoints
+}
+
+// mergeEnv applies env over a KEY=value list, replacing existing keys in
+// place and appending new ones in order.
+func mergeEnv(base []string, env map[string]string) []string {
+	merged := make([]string, 0, len(base)+len(env))
+	seen := make(map[string]bool)
+	for _, kv := range base {
+		k, _, _ := strings.Cut(kv, "=")
+		if v, ok := env[k]; ok {
+			kv = k + "=" + v
+			seen[k] = true
+		}
+		merged = append(merged, kv)
+	}
+	for _, k := range sortedKeys(env) {
+		if !seen[k] {
+			merged = append(merged, k+"="+env[k])
+		}
+	}
+	return merged
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+package docker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// fakeEngine serves the Engine API calls a recreate makes and records them.
+type fakeEngine struct {
+	mu        sync.Mutex
+	calls     []string
+	created   map[string]any
+	failStart bool
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /containers/gluetun/json":
+		w.Write([]byte(`{
+			"Id": "abc123def4567890",
+			"Name": "/gluetun",
+			"Config": {"Image": "qmcgaw/gluetun", "Env": ["VPN_TYPE=wireguard", "SERVER_NAMES=US#1"]},
+			"State": {"Status": "running"},
+			"HostConfig": {"NetworkMode": "proj_default", "CapAdd": ["NET_ADMIN"]},
+			"NetworkSettings": {"Networks": {
+				"proj_default": {"Aliases": ["gluetun", "abc123def456"], "IPAddress": "172.18.0.2"},
+				"proj_extra": {"Aliases": ["vpn"]}
+			}}
+		}`))
+	case "GET /containers/qbittorrent/json":
+		w.Write([]byte(`{"Id": "q1", "Config": {}, "HostConfig": {"NetworkMode": "container:abc123def4567890"}}`))
+	case "POST /containers/create":
+		json.NewDecoder(r.Body).Decode(&f.created)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id": "new"}`))
+	case "POST /containers/new/start":
+		if f.failStart {
+			http.Error(w, `{"message": "port is already allocated"}`, http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /containers/gluetun/exec":
+		w.Write([]byte(`{"Id": "e1"}`))
+	case "POST /exec/e1/start":
+		for _, frame := range []struct {
+			stream byte
+			data   string
+		}{{1, "PING 1.1.1.1\n"}, {2, "1 packets transmitted, 1 received\n"}} {
+			header := make([]byte, 8)
+			header[0] = frame.stream
+			binary.BigEndian.PutUint32(header[4:], uint32(len(frame.data)))
+			w.Write(append(header, frame.data...))
+		}
+	case "GET /exec/e1/json":
+		w.Write([]byte(`{"ExitCode": 0}`))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func startFakeEngine(t *testing.T) (*fakeEngine, *Client) {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := &fakeEngine{}
+	srv := &http.Server{Handler: engine}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	client, err := NewClient("unix://"+sock, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine, client
+}
+
+func TestNetworkMode(t *testing.T) {
+	_, client := startFakeEngine(t)
+	UseAPI(client)
+	t.Cleanup(func() { UseAPI(nil) })
+
+	for name, want := range map[string]string{"gluetun": "proj_default", "qbittorrent": "container:abc123def4567890"} {
+		if mode, err := NetworkMode(name); err != nil || mode != want {
+			t.Errorf("NetworkMode(%s) = %q, %v, want %q", name, mode, err, want)
+		}
+	}
+}
+
+func TestRecreate(t *testing.T) {
+	engine, client := startFakeEngine(t)
+	if err := client.recreate("gluetun", RecreateOptions{Env: map[string]string{"SERVER_NAMES": "US#2", "VPN_ENDPOINT_IP": "10.0.0.2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"GET /containers/gluetun/json",
+		"POST /containers/abc123def4567890/stop",
+		"POST /containers/abc123def4567890/rename",
+		"POST /containers/create",
+		"POST /networks/proj_extra/connect",
+		"POST /containers/new/start",
+		"DELETE /containers/abc123def4567890",
+	}
+	if !slices.Equal(engine.calls, want) {
+		t.Errorf("calls =\n%v\nwant\n%v", engine.calls, want)
+	}
+
+	env, _ := engine.created["Env"].([]any)
+	if len(env) != 3 || env[1] != "SERVER_NAMES=US#2" || env[2] != "VPN_ENDPOINT_IP=10.0.0.2" {
+		t.Errorf("Env = %v", env)
+	}
+	host, _ := engine.created["HostConfig"].(map[string]any)
+	if caps, _ := host["CapAdd"].([]any); len(caps) != 1 {
+		t.Errorf("HostConfig not copied: %v", host)
+	}
+	endpoints := engine.created["NetworkingConfig"].(map[string]any)["EndpointsConfig"].(map[string]any)
+	primary, _ := endpoints["proj_default"].(map[string]any)
+	if aliases, _ := primary["Aliases"].([]any); len(aliases) != 1 || aliases[0] != "gluetun" || primary["IPAddress"] != nil {
+		t.Errorf("primary endpoint = %v, want only the gluetun alias", primary)
+	}
+}
+
+func TestRecreateRollsBack(t *testing.T) {
+	engine, client := startFakeEngine(t)
+	engine.failStart = true
+	if err := client.recreate("gluetun", RecreateOptions{}); err == nil {
+		t.Fatal("recreate succeeded with a failing start")
+	}
+
+	tail := engine.calls[len(engine.calls)-3:]
+	want := []string{
+		"DELETE /containers/new",
+		"POST /containers/abc123def4567890/rename",
+		"POST /containers/abc123def4567890/start",
+	}
+	if !slices.Equal(tail, want) {
+		t.Errorf("rollback calls = %v, want %v", tail, want)
+	}
+}
+
+func TestExec(t *testing.T) {
+	_, client := startFakeEngine(t)
+	out, err := client.exec("gluetun", "ping", "-c", "1", "1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "PING 1.1.1.1\n1 packets transmitted, 1 received\n" {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	for image, want := range map[string]string{
+		"qmcgaw/gluetun:v3.39.1":                "v3.39.1",
+		"qmcgaw/gluetun":                        "",
+		"registry.local:5000/gluetun":           "",
+		"registry.local:5000/gluetun:v3.38.0":   "v3.38.0",
+		"qmcgaw/gluetun:latest@sha256:0123abcd": "latest",
+	} {
+		if got := imageTag(image); got != want {
+			t.Errorf("imageTag(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
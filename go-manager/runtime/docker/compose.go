@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Default compose file names, in the order Docker Compose itself looks for them.
+var composeFileCandidates = []string{
+	"compose.yaml",
+	"compose.yml",
+	"docker-compose.yaml",
+	"docker-compose.yml",
+}
+
+var (
+	composeOnce sync.Once
+	composeBase []string
+	composeErr  error
+)
+
+// detectCompose returns the command prefix used to invoke Compose, preferring
+// the v2 plugin (`docker compose`) and falling back to the legacy binary.
+func detectCompose() ([]string, error) {
+	composeOnce.Do(func() {
+		if err := exec.Command("docker", "compose", "version").Run(); err == nil {
+			composeBase = []string{"docker", "compose"}
+			return
+		}
+		if _, err := exec.LookPath("docker-compose"); err == nil {
+			composeBase = []string{"docker-compose"}
+			return
+		}
+		composeErr = fmt.Errorf("neither 'docker compose' nor 'docker-compose' is available")
+	})
+	return composeBase, composeErr
+}
+
+// Compose identifies a Compose project: its name, directory and files. Empty
+// Files means the default file in Dir.
+type Compose struct {
+	Project string
+	Dir     string
+	Files   []string
+}
+
+// ParseFiles splits a COMPOSE_FILE value on sep the same way Compose does,
+// resolving relative entries against dir.
+func ParseFiles(value, dir, sep string) []string {
+	if value == "" {
+		return nil
+	}
+
+	var files []string
+	for _, f := range strings.Split(value, sep) {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// FindFiles returns the configured compose files, or the first default file
+// found in the project directory.
+func (c Compose) FindFiles() []string {
+	if len(c.Files) > 0 {
+		return c.Files
+	}
+	for _, name := range composeFileCandidates {
+		path := filepath.Join(c.Dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return []string{path}
+		}
+	}
+	return nil
+}
+
+// Command builds a Compose invocation scoped to the project and its files.
+func (c Compose) Command(args ...string) (*exec.Cmd, error) {
+	base, err := detectCompose()
+	if err != nil {
+		return nil, err
+	}
+
+	cmdArgs := append([]string{}, base[1:]...)
+	if c.Project != "" {
+		cmdArgs = append(cmdArgs, "-p", c.Project)
+	}
+	for _, f := range c.FindFiles() {
+		cmdArgs = append(cmdArgs, "-f", f)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	return exec.Command(base[0], cmdArgs...), nil
+}
@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseFiles(t *testing.T) {
+	for _, tc := range []struct {
+		value, sep string
+		want       []string
+	}{
+		{"", ":", nil},
+		{"compose.yml", ":", []string{"/project/compose.yml"}},
+		{"compose.yml:override.yml", ":", []string{"/project/compose.yml", "/project/override.yml"}},
+		{"/srv/a.yml: b/c.yml :", ":", []string{"/srv/a.yml", "/project/b/c.yml"}},
+		{"a.yml;/srv/b.yml", ";", []string{"/project/a.yml", "/srv/b.yml"}},
+		// Another separator leaves the value whole
+		{"a.yml;b.yml", ":", []string{"/project/a.yml;b.yml"}},
+	} {
+		if got := ParseFiles(tc.value, "/project", tc.sep); !slices.Equal(got, tc.want) {
+			t.Errorf("ParseFiles(%q, %q) = %q, want %q", tc.value, tc.sep, got, tc.want)
+		}
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	c := Compose{Dir: dir}
+	if files := c.FindFiles(); files != nil {
+		t.Errorf("empty dir = %q", files)
+	}
+
+	// Compose's own order: compose.yaml first, docker-compose.yml last
+	for _, name := range []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("services: {}\n"), 0o644)
+		if files := c.FindFiles(); !slices.Equal(files, []string{filepath.Join(dir, name)}) {
+			t.Errorf("with %s = %q", name, files)
+		}
+	}
+
+	c.Files = []string{"/srv/custom.yml"}
+	if files := c.FindFiles(); !slices.Equal(files, c.Files) {
+		t.Errorf("configured files = %q", files)
+	}
+}
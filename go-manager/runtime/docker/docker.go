@@ -0,0 +1,305 @@
+// Package docker drives gluetun and its neighbours through the Docker and
+// Docker Compose CLIs, or the Engine API directly once UseAPI is called.
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InspectEnv returns the environment a container was created with.
+func InspectEnv(name string) (map[string]string, error) {
+	var env []string
+	if api != nil {
+		_, cfg, err := api.inspect(name)
+		if err != nil {
+			return nil, err
+		}
+		env = cfg.Env
+	} else {
+		out, err := exec.Command("docker", "inspect", "--format", "{{json .Config.Env}}", name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("docker inspect %s: %v", name, err)
+		}
+		if err := json.Unmarshal(out, &env); err != nil {
+			return nil, fmt.Errorf("decoding env of %s: %v", name, err)
+		}
+	}
+
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+// Container is a container found by List.
+type Container struct {
+	Name    string
+	Service string // Compose service, if created by Compose
+}
+
+// List returns the containers, running or not, carrying label ("key" or
+// "key=value"), sorted by name.
+func List(label string) ([]Container, error) {
+	var list []Container
+	if api != nil {
+		var err error
+		if list, err = api.list(label); err != nil {
+			return nil, err
+		}
+	} else {
+		out, err := exec.Command("docker", "ps", "--all", "--filter", "label="+label,
+			"--format", `{{.Names}}|{{.Label "com.docker.compose.service"}}`).Output()
+		if err != nil {
+			return nil, fmt.Errorf("docker ps: %v", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if name, service, _ := strings.Cut(line, "|"); name != "" {
+				list = append(list, Container{Name: name, Service: service})
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// State returns a container's status (e.g. "running") and, if it defines a
+// Docker healthcheck, its health status.
+func State(name string) (status, health string, err error) {
+	if api != nil {
+		info, _, err := api.inspect(name)
+		if err != nil {
+			return "", "", err
+		}
+		if info.State.Health != nil {
+			health = info.State.Health.Status
+		}
+		return info.State.Status, health, nil
+	}
+	out, err := exec.Command("docker", "inspect", "--format",
+		"{{.State.Status}}|{{if .State.Health}}{{.State.Health.Status}}{{end}}", name).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("docker inspect %s: %v", name, err)
+	}
+	status, health, _ = strings.Cut(strings.TrimSpace(string(out)), "|")
+	return status, health, nil
+}
+
+// NetworkMode returns a container's network mode, e.g. "bridge" or
+// "container:<id>" for one sharing another container's network.
+func NetworkMode(name string) (string, error) {
+	if api != nil {
+		info, _, err := api.inspect(name)
+		if err != nil {
+			return "", err
+		}
+		var host struct{ NetworkMode string }
+		err = json.Unmarshal(info.HostConfig, &host)
+		return host.NetworkMode, err
+	}
+	out, err := exec.Command("docker", "inspect", "--format", "{{.HostConfig.NetworkMode}}", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("docker inspect %s: %v", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Action runs a lifecycle command on a container: start, stop, restart,
+// pause or unpause.
+func Action(verb, name string) error {
+	if api != nil {
+		return api.action(verb, name)
+	}
+	if out, err := exec.Command("docker", verb, name).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Recreate replaces a container with a copy of its configuration, changed
+// as opts says. It needs the Engine API.
+func Recreate(name string, opts RecreateOptions) error {
+	if api == nil {
+		return fmt.Errorf("recreating %s needs the Docker Engine API", name)
+	}
+	return api.recreate(name, opts)
+}
+
+// Version returns the Docker daemon's version.
+func Version() (string, error) {
+	if api != nil {
+		return api.version()
+	}
+	out, err := exec.Command("docker", "version", "--format", "{{.Server.Version}}").Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Logs follows a container's stdout and stderr from now on, until the
+// container stops or the reader is closed.
+func Logs(name string) (io.ReadCloser, error) {
+	if api != nil {
+		return api.logs(name)
+	}
+	cmd := exec.Command("docker", "logs", "--follow", "--tail", "0", name)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+	return readCloser{pr, func() error {
+		return cmd.Process.Kill()
+	}}, nil
+}
+
+// execIn runs a command inside a container and returns its combined output.
+func execIn(container string, cmd ...string) ([]byte, error) {
+	if api != nil {
+		return api.exec(container, cmd...)
+	}
+	return exec.Command("docker", append([]string{"exec", container}, cmd...)...).CombinedOutput()
+}
+
+// Shell runs a shell command inside the given container.
+func Shell(container, command string) error {
+	_, err := execIn(container, "sh", "-c", command)
+	return err
+}
+
+// Ping pings target from inside the given container.
+func Ping(container, target string) bool {
+	_, err := execIn(container, "ping", "-c", "3", "-W", "2", target)
+	return err == nil
+}
+
+// NetBytes returns the bytes received plus sent on a network interface
+// inside the given container, from its kernel counters.
+func NetBytes(container, iface string) (uint64, error) {
+	dir := "/sys/class/net/" + iface + "/statistics/"
+	out, err := execIn(container, "cat", dir+"rx_bytes", dir+"tx_bytes")
+	if err != nil {
+		return 0, fmt.Errorf("read %s counters in %s: %v: %s", iface, container, err, strings.TrimSpace(string(out)))
+	}
+	var total uint64
+	for _, field := range strings.Fields(string(out)) {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("read %s counters in %s: %v", iface, container, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+var httpStatusLine = regexp.MustCompile(`HTTP/[0-9.]+ ([0-9]{3})`)
+
+// HTTPStatus fetches url from inside the given container with its wget and
+// returns the final response status.
+func HTTPStatus(container, url string) (int, error) {
+	out, _ := execIn(container, "wget", "-S", "-q", "-T", "10", "-O", "/dev/null", url)
+	m := httpStatusLine.FindAllStringSubmatch(string(out), -1)
+	if len(m) == 0 {
+		return 0, fmt.Errorf("no response: %s", strings.TrimSpace(string(out)))
+	}
+	return strconv.Atoi(m[len(m)-1][1])
+}
+
+// Fetch downloads url from inside the given container with its wget.
+func Fetch(container, url string) ([]byte, error) {
+	out, err := execIn(container, "wget", "-q", "-T", "10", "-O", "-", url)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+var pingSummary = regexp.MustCompile(`min/avg/max[^=]*= [0-9.]+/([0-9.]+)/`)
+
+// PingRTT pings target from inside the given container and returns the
+// average round-trip time.
+func PingRTT(container, target string) (time.Duration, error) {
+	out, err := execIn(container, "ping", "-c", "3", "-W", "2", target)
+	if err != nil {
+		return 0, fmt.Errorf("ping %s from %s: %v", target, container, err)
+	}
+	m := pingSummary.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, fmt.Errorf("no round-trip summary in ping output")
+	}
+	ms, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+var pingCounts = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+
+// PingLoss sends count pings to target from inside the given container and
+// returns how many were sent and answered.
+func PingLoss(container, target string, count int) (int, int, error) {
+	// ping exits non-zero when packets are lost; the summary still counts them
+	out, _ := execIn(container, "ping", "-c", strconv.Itoa(count), "-W", "1", target)
+	m := pingCounts.FindStringSubmatch(string(out))
+	if m == nil {
+		return 0, 0, fmt.Errorf("no packet summary in ping output: %s", strings.TrimSpace(string(out)))
+	}
+	sent, _ := strconv.Atoi(m[1])
+	received, _ := strconv.Atoi(m[2])
+	return sent, received, nil
+}
+
+// ImageVersion returns the version a container's image declares in its
+// org.opencontainers.image.version label, e.g. "v3.39.1", falling back to
+// the image tag when the label is missing or just "latest". It returns ""
+// if neither is known.
+func ImageVersion(container string) string {
+	var label, image string
+	if api != nil {
+		_, cfg, err := api.inspect(container)
+		if err != nil {
+			return ""
+		}
+		label, image = cfg.Labels["org.opencontainers.image.version"], cfg.Image
+	} else {
+		out, err := exec.Command("docker", "inspect", "--format", `{{index .Config.Labels "org.opencontainers.image.version"}} {{.Config.Image}}`, container).Output()
+		if err != nil {
+			return ""
+		}
+		label, image, _ = strings.Cut(strings.TrimSpace(string(out)), " ")
+		if label == "<no value>" {
+			label = ""
+		}
+	}
+	if label != "" && label != "latest" {
+		return label
+	}
+	if tag := imageTag(image); tag != "" {
+		return tag
+	}
+	return label
+}
+
+// imageTag returns the tag of an image reference such as
+// qmcgaw/gluetun:v3.39.1, or "" if it has none.
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "" // a registry port, not a tag
+	}
+	return image[i+1:]
+}
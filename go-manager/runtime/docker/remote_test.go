@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/version" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(`{"Version": "27.1.0"}`))
+}
+
+func TestTCPHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(versionHandler))
+	defer srv.Close()
+
+	client, err := NewClient("tcp://"+strings.TrimPrefix(srv.URL, "http://"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.version(); err != nil || v != "27.1.0" {
+		t.Errorf("version = %q, %v", v, err)
+	}
+}
+
+func TestTLSHost(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(versionHandler))
+	defer srv.Close()
+
+	certPath := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(certPath, "ca.pem"), ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := TLSConfig(certPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient("tcp://"+strings.TrimPrefix(srv.URL, "https://"), tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.version(); err != nil || v != "27.1.0" {
+		t.Errorf("version = %q, %v", v, err)
+	}
+
+	if _, err := TLSConfig(t.TempDir(), true); err == nil {
+		t.Error("TLSConfig verified without a ca.pem")
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	u, _ := url.Parse("ssh://admin@nas.lan:2222")
+	want := []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=30", "-l", "admin", "-p", "2222", "--", "nas.lan", "docker", "system", "dial-stdio"}
+	if got := sshArgs(u); !slices.Equal(got, want) {
+		t.Errorf("sshArgs = %v, want %v", got, want)
+	}
+	if _, err := NewClient("npipe:////./pipe/docker_engine", nil); err == nil {
+		t.Error("unsupported scheme accepted")
+	}
+}
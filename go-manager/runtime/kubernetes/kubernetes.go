@@ -0,0 +1,307 @@
+// Package kubernetes is a minimal Kubernetes API client for the manager's
+// operator mode: it reads VPNTunnel resources and reports their status, keeps
+// gluetun's settings in a Secret and restarts the workload running gluetun.
+// Leases provide leader election between manager replicas.
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Group and Version of the VPNTunnel custom resource.
+const (
+	Group   = "proton.gluetun.dev"
+	Version = "v1alpha1"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ErrNotFound is returned for resources that don't exist, and ErrConflict
+// for writes based on an outdated resourceVersion.
+var (
+	ErrNotFound = fmt.Errorf("not found")
+	ErrConflict = fmt.Errorf("conflict")
+)
+
+// Client talks to the API server in one namespace.
+type Client struct {
+	server    string
+	namespace string
+	tokenFile string
+	http      *http.Client
+}
+
+// New returns a client for the API server at server. tokenFile, if set, is
+// re-read for each request, as service account tokens are rotated.
+func New(server, namespace, tokenFile string, tlsConfig *tls.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		server:    strings.TrimRight(server, "/"),
+		namespace: namespace,
+		tokenFile: tokenFile,
+		http:      &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+// InCluster returns a client using the pod's service account. An empty
+// namespace means the pod's own.
+func InCluster(namespace string) (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod (KUBERNETES_SERVICE_HOST unset)")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificates in %s", filepath.Join(serviceAccountDir, "ca.crt"))
+	}
+	if namespace == "" {
+		ns, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	server := "https://" + net.JoinHostPort(host, port)
+	return New(server, namespace, filepath.Join(serviceAccountDir, "token"), &tls.Config{RootCAs: pool}), nil
+}
+
+// Namespace returns the namespace the client works in.
+func (c *Client) Namespace() string { return c.namespace }
+
+func (c *Client) do(method, path string, body, out any) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.server+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if method == "PATCH" {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var status struct{ Message string }
+		json.NewDecoder(resp.Body).Decode(&status)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, status.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Metadata is the part of an object's metadata the manager reads.
+type Metadata struct {
+	Name            string `json:"name"`
+	Generation      int64  `json:"generation,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// TunnelSpec is the desired state of a VPNTunnel: where and how to pick
+// servers, and the Secret and workload that carry gluetun.
+type TunnelSpec struct {
+	// Countries are tiers in TARGET_COUNTRIES form, e.g. "NL:Amsterdam|Rotterdam".
+	Countries []string `json:"countries,omitempty"`
+	Regions   []string `json:"regions,omitempty"`
+	Country   string   `json:"country,omitempty"`
+	Cities    []string `json:"cities,omitempty"`
+	Auto      bool     `json:"auto,omitempty"`
+	Fallback  *bool    `json:"fallback,omitempty"`
+	Features  []string `json:"features,omitempty"`
+	// LoadThreshold and PreferredMaxLoad are percentages, as
+	// LOAD_SWITCH_THRESHOLD and PREFERRED_MAX_LOAD.
+	LoadThreshold    *int     `json:"loadThreshold,omitempty"`
+	PreferredServers []string `json:"preferredServers,omitempty"`
+	PreferredMaxLoad *int     `json:"preferredMaxLoad,omitempty"`
+
+	SecretName string `json:"secretName"`
+	// Workload is the Deployment or StatefulSet running gluetun, as
+	// "deployment/<name>" or "statefulset/<name>".
+	Workload string `json:"workload"`
+}
+
+// TunnelStatus is what the manager reports back on a VPNTunnel.
+type TunnelStatus struct {
+	ObservedGeneration int64  `json:"observedGeneration"`
+	State              string `json:"state"`
+	Server             string `json:"server"`
+	Load               int    `json:"load"`
+	Healthy            bool   `json:"healthy"`
+	ExitIP             string `json:"exitIP,omitempty"`
+	LastSwitch         string `json:"lastSwitch,omitempty"`
+	LastSwitchReason   string `json:"lastSwitchReason,omitempty"`
+}
+
+// Tunnel is a VPNTunnel resource.
+type Tunnel struct {
+	Metadata Metadata     `json:"metadata"`
+	Spec     TunnelSpec   `json:"spec"`
+	Status   TunnelStatus `json:"status"`
+}
+
+func (c *Client) tunnelPath(name string) string {
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/vpntunnels/%s", Group, Version, c.namespace, name)
+}
+
+// Tunnel fetches a VPNTunnel.
+func (c *Client) Tunnel(name string) (*Tunnel, error) {
+	var t Tunnel
+	if err := c.do("GET", c.tunnelPath(name), nil, &t); err != nil {
+		return nil, fmt.Errorf("vpntunnel %s: %v", name, err)
+	}
+	return &t, nil
+}
+
+// UpdateTunnelStatus replaces a VPNTunnel's status.
+func (c *Client) UpdateTunnelStatus(name string, status TunnelStatus) error {
+	body := map[string]any{"status": status}
+	if err := c.do("PATCH", c.tunnelPath(name)+"/status", body, nil); err != nil {
+		return fmt.Errorf("vpntunnel %s status: %v", name, err)
+	}
+	return nil
+}
+
+func (c *Client) secretPath(name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", c.namespace, name)
+}
+
+// Secret returns a Secret's data.
+func (c *Client) Secret(name string) (map[string]string, error) {
+	var s struct{ Data map[string][]byte }
+	if err := c.do("GET", c.secretPath(name), nil, &s); err != nil {
+		return nil, fmt.Errorf("secret %s: %v", name, err)
+	}
+	data := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
+// UpdateSecret sets the given keys in a Secret, leaving its other keys
+// alone. A missing Secret is created.
+func (c *Client) UpdateSecret(name string, data map[string]string) error {
+	encoded := make(map[string][]byte, len(data))
+	for k, v := range data {
+		encoded[k] = []byte(v)
+	}
+	err := c.do("PATCH", c.secretPath(name), map[string]any{"data": encoded}, nil)
+	if err == ErrNotFound {
+		secret := map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   Metadata{Name: name},
+			"data":       encoded,
+		}
+		err = c.do("POST", fmt.Sprintf("/api/v1/namespaces/%s/secrets", c.namespace), secret, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("secret %s: %v", name, err)
+	}
+	return nil
+}
+
+// workloadPath resolves "deployment/<name>" or "statefulset/<name>".
+func (c *Client) workloadPath(workload string) (string, error) {
+	kind, name, ok := strings.Cut(workload, "/")
+	if !ok || name == "" {
+		return "", fmt.Errorf("workload %q is not deployment/<name> or statefulset/<name>", workload)
+	}
+	switch strings.ToLower(kind) {
+	case "deployment", "deploy":
+		kind = "deployments"
+	case "statefulset", "sts":
+		kind = "statefulsets"
+	default:
+		return "", fmt.Errorf("workload %q: unsupported kind %s", workload, kind)
+	}
+	return fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s/%s", c.namespace, kind, name), nil
+}
+
+// RestartAnnotation is the pod template annotation `kubectl rollout restart`
+// sets; changing it rolls the workload's pods.
+const RestartAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Restart rolls a workload's pods, as `kubectl rollout restart` does.
+func (c *Client) Restart(workload string, at time.Time) error {
+	path, err := c.workloadPath(workload)
+	if err != nil {
+		return err
+	}
+	patch := map[string]any{"spec": map[string]any{"template": map[string]any{"metadata": map[string]any{
+		"annotations": map[string]string{RestartAnnotation: at.UTC().Format(time.RFC3339)},
+	}}}}
+	if err := c.do("PATCH", path, patch, nil); err != nil {
+		return fmt.Errorf("%s: %v", workload, err)
+	}
+	return nil
+}
+
+// RolledOut reports whether a workload's latest pod template is fully rolled
+// out: every replica updated and ready, and no old ones left.
+func (c *Client) RolledOut(workload string) (bool, error) {
+	path, err := c.workloadPath(workload)
+	if err != nil {
+		return false, err
+	}
+	var w struct {
+		Metadata Metadata
+		Spec     struct{ Replicas *int32 }
+		Status   struct {
+			ObservedGeneration int64
+			Replicas           int32
+			UpdatedReplicas    int32
+			ReadyReplicas      int32
+		}
+	}
+	if err := c.do("GET", path, nil, &w); err != nil {
+		return false, fmt.Errorf("%s: %v", workload, err)
+	}
+	want := int32(1)
+	if w.Spec.Replicas != nil {
+		want = *w.Spec.Replicas
+	}
+	s := w.Status
+	return s.ObservedGeneration >= w.Metadata.Generation &&
+		s.UpdatedReplicas == want && s.ReadyReplicas == want && s.Replicas == want, nil
+}
@@ -0,0 +1,152 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPI serves the calls the operator makes and records writes.
+type fakeAPI struct {
+	mu      sync.Mutex
+	secret  map[string]any
+	patches map[string]map[string]any
+	auth    string
+	rolled  bool
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	if r.Method == "PATCH" {
+		if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+			http.Error(w, "unsupported patch", http.StatusUnsupportedMediaType)
+			return
+		}
+		f.patches[r.URL.Path] = body
+	}
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /apis/proton.gluetun.dev/v1alpha1/namespaces/vpn/vpntunnels/home":
+		w.Write([]byte(`{"metadata": {"name": "home", "generation": 3}, "spec": {
+			"cities": ["Zurich"], "country": "ch", "features": ["p2p"], "loadThreshold": 30,
+			"secretName": "gluetun-env", "workload": "deployment/gluetun"}}`))
+	case "PATCH /apis/proton.gluetun.dev/v1alpha1/namespaces/vpn/vpntunnels/home/status":
+		w.Write([]byte(`{}`))
+	case "PATCH /api/v1/namespaces/vpn/secrets/gluetun-env":
+		if f.secret == nil {
+			http.Error(w, `{"message": "secrets \"gluetun-env\" not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	case "POST /api/v1/namespaces/vpn/secrets":
+		f.secret = body
+		w.WriteHeader(http.StatusCreated)
+	case "GET /api/v1/namespaces/vpn/secrets/gluetun-env":
+		json.NewEncoder(w).Encode(f.secret)
+	case "PATCH /apis/apps/v1/namespaces/vpn/deployments/gluetun":
+		w.Write([]byte(`{}`))
+	case "GET /apis/apps/v1/namespaces/vpn/deployments/gluetun":
+		if f.rolled {
+			w.Write([]byte(`{"metadata": {"generation": 5}, "spec": {"replicas": 1},
+				"status": {"observedGeneration": 5, "replicas": 1, "updatedReplicas": 1, "readyReplicas": 1}}`))
+		} else {
+			w.Write([]byte(`{"metadata": {"generation": 5}, "spec": {"replicas": 1},
+				"status": {"observedGeneration": 5, "replicas": 2, "updatedReplicas": 1, "readyReplicas": 1}}`))
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func startFakeAPI(t *testing.T) (*fakeAPI, *Client) {
+	t.Helper()
+	api := &fakeAPI{patches: make(map[string]map[string]any)}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return api, New(srv.URL, "vpn", tokenFile, nil)
+}
+
+func TestTunnel(t *testing.T) {
+	api, client := startFakeAPI(t)
+	tunnel, err := client.Tunnel("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tunnel.Metadata.Generation != 3 || tunnel.Spec.Country != "ch" || *tunnel.Spec.LoadThreshold != 30 || tunnel.Spec.Workload != "deployment/gluetun" {
+		t.Errorf("tunnel = %+v", tunnel)
+	}
+	if api.auth != "Bearer sa-token" {
+		t.Errorf("Authorization = %q", api.auth)
+	}
+	if _, err := client.Tunnel("missing"); err == nil {
+		t.Error("found a VPNTunnel that doesn't exist")
+	}
+
+	if err := client.UpdateTunnelStatus("home", TunnelStatus{ObservedGeneration: 3, Server: "CH#1", Healthy: true}); err != nil {
+		t.Fatal(err)
+	}
+	status := api.patches["/apis/proton.gluetun.dev/v1alpha1/namespaces/vpn/vpntunnels/home/status"]["status"].(map[string]any)
+	if status["server"] != "CH#1" || status["healthy"] != true || status["observedGeneration"] != float64(3) {
+		t.Errorf("status patch = %v", status)
+	}
+}
+
+func TestUpdateSecretCreatesIt(t *testing.T) {
+	api, client := startFakeAPI(t)
+	if err := client.UpdateSecret("gluetun-env", map[string]string{"SERVER_NAMES": "CH#1"}); err != nil {
+		t.Fatal(err)
+	}
+	if api.secret["kind"] != "Secret" {
+		t.Fatalf("secret not created: %v", api.secret)
+	}
+	data, err := client.Secret("gluetun-env")
+	if err != nil || data["SERVER_NAMES"] != "CH#1" {
+		t.Errorf("secret data = %v, %v", data, err)
+	}
+
+	// Once it exists, only the given keys are patched
+	if err := client.UpdateSecret("gluetun-env", map[string]string{"SERVER_NAMES": "CH#2"}); err != nil {
+		t.Fatal(err)
+	}
+	patch := api.patches["/api/v1/namespaces/vpn/secrets/gluetun-env"]["data"].(map[string]any)
+	if len(patch) != 1 || patch["SERVER_NAMES"] != "Q0gjMg==" {
+		t.Errorf("secret patch = %v", patch)
+	}
+}
+
+func TestRestartAndRollout(t *testing.T) {
+	api, client := startFakeAPI(t)
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	if err := client.Restart("deployment/gluetun", at); err != nil {
+		t.Fatal(err)
+	}
+	template := api.patches["/apis/apps/v1/namespaces/vpn/deployments/gluetun"]["spec"].(map[string]any)["template"].(map[string]any)
+	annotations := template["metadata"].(map[string]any)["annotations"].(map[string]any)
+	if annotations[RestartAnnotation] != "2026-10-16T12:00:00Z" {
+		t.Errorf("annotations = %v", annotations)
+	}
+
+	if done, err := client.RolledOut("deployment/gluetun"); err != nil || done {
+		t.Errorf("RolledOut with an old pod left = %v, %v", done, err)
+	}
+	api.rolled = true
+	if done, err := client.RolledOut("deploy/gluetun"); err != nil || !done {
+		t.Errorf("RolledOut = %v, %v", done, err)
+	}
+	if err := client.Restart("daemonset/gluetun", at); err == nil {
+		t.Error("unsupported workload kind accepted")
+	}
+}
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+)
+
+// microTime is the timestamp format of Lease fields.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// LeaseSpec is a coordination.k8s.io/v1 Lease's spec.
+type LeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int32  `json:"leaseTransitions,omitempty"`
+}
+
+// Lease is a coordination.k8s.io/v1 Lease, used for leader election.
+type Lease struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Metadata   Metadata  `json:"metadata"`
+	Spec       LeaseSpec `json:"spec"`
+}
+
+// Expired reports whether the holder failed to renew the lease in time. A
+// lease without a holder is free.
+func (l *Lease) Expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renewed, err := time.Parse(microTime, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+func (c *Client) leasePath(name string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", c.namespace, name)
+}
+
+// Lease fetches a Lease.
+func (c *Client) Lease(name string) (*Lease, error) {
+	var l Lease
+	if err := c.do("GET", c.leasePath(name), nil, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// HoldLease makes holder the lease's holder for duration, starting now. A
+// nil lease creates it. Writes are based on the lease's resourceVersion, so
+// of two replicas racing for it, one gets ErrConflict.
+func (c *Client) HoldLease(name string, l *Lease, holder string, duration time.Duration, now time.Time) (*Lease, error) {
+	stamp := now.UTC().Format(microTime)
+	if l == nil {
+		l = &Lease{Metadata: Metadata{Name: name}}
+	}
+	next := *l
+	next.APIVersion, next.Kind = "coordination.k8s.io/v1", "Lease"
+	if next.Spec.HolderIdentity != holder {
+		if next.Spec.HolderIdentity != "" || l.Metadata.ResourceVersion != "" {
+			next.Spec.LeaseTransitions++
+		}
+		next.Spec.HolderIdentity, next.Spec.AcquireTime = holder, stamp
+	}
+	next.Spec.RenewTime = stamp
+	next.Spec.LeaseDurationSeconds = int32(duration / time.Second)
+
+	var out Lease
+	var err error
+	if l.Metadata.ResourceVersion == "" {
+		err = c.do("POST", fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", c.namespace), next, &out)
+	} else {
+		err = c.do("PUT", c.leasePath(name), next, &out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ReleaseLease gives up the lease so a standby can take it over at once.
+func (c *Client) ReleaseLease(name string, l *Lease) error {
+	next := *l
+	next.Spec.HolderIdentity, next.Spec.AcquireTime, next.Spec.RenewTime = "", "", ""
+	return c.do("PUT", c.leasePath(name), next, nil)
+}
@@ -0,0 +1,89 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeases stores one Lease with optimistic concurrency, as the API server
+// does.
+type fakeLeases struct {
+	mu      sync.Mutex
+	lease   *Lease
+	version int
+}
+
+func (f *fakeLeases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var in Lease
+	json.NewDecoder(r.Body).Decode(&in)
+	switch r.Method {
+	case "GET":
+		if f.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+		return
+	case "POST":
+		if f.lease != nil {
+			http.Error(w, "{}", http.StatusConflict)
+			return
+		}
+	case "PUT":
+		if f.lease == nil || in.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion {
+			http.Error(w, "{}", http.StatusConflict)
+			return
+		}
+	}
+	f.version++
+	in.Metadata.ResourceVersion = string(rune('0' + f.version))
+	f.lease = &in
+	json.NewEncoder(w).Encode(f.lease)
+}
+
+func TestHoldLease(t *testing.T) {
+	leases := &fakeLeases{}
+	srv := httptest.NewServer(leases)
+	defer srv.Close()
+	client := New(srv.URL, "vpn", "", nil)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	if _, err := client.Lease("proton-manager"); err != ErrNotFound {
+		t.Fatalf("missing lease: %v", err)
+	}
+	a, err := client.HoldLease("proton-manager", nil, "manager-a", 15*time.Second, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Spec.HolderIdentity != "manager-a" || a.Expired(now.Add(10*time.Second)) || !a.Expired(now.Add(16*time.Second)) {
+		t.Errorf("lease = %+v", a.Spec)
+	}
+
+	// A standby that read the lease before a renewal loses the race
+	stale := *a
+	if a, err = client.HoldLease("proton-manager", a, "manager-a", 15*time.Second, now.Add(5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.HoldLease("proton-manager", &stale, "manager-b", 15*time.Second, now.Add(21*time.Second)); err != ErrConflict {
+		t.Errorf("stale takeover = %v, want ErrConflict", err)
+	}
+
+	// Released, it is free at once
+	if err := client.ReleaseLease("proton-manager", a); err != nil {
+		t.Fatal(err)
+	}
+	free, _ := client.Lease("proton-manager")
+	if !free.Expired(now.Add(6 * time.Second)) {
+		t.Error("released lease not free")
+	}
+	b, err := client.HoldLease("proton-manager", free, "manager-b", 15*time.Second, now.Add(6*time.Second))
+	if err != nil || b.Spec.HolderIdentity != "manager-b" || b.Spec.LeaseTransitions != 1 {
+		t.Errorf("takeover = %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,220 @@
+// Package nomad updates a gluetun task running under HashiCorp Nomad, either
+// through its job's env block or through Nomad Variables read by a template.
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a minimal Nomad HTTP API client.
+type Client struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// New returns a client for the Nomad agent at addr, e.g.
+// http://127.0.0.1:4646.
+func New(addr, token, namespace string) *Client {
+	return &Client{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		http:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// errNotFound is returned for 404 responses.
+var errNotFound = fmt.Errorf("not found")
+
+func (c *Client) do(method, path string, query url.Values, body, out any) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.namespace != "" {
+		query.Set("namespace", c.namespace)
+	}
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, &buf)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(msg.String()))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Job is a job specification as returned by the API. It is kept as a
+// generic map so an update sends back every field unchanged.
+type Job map[string]any
+
+// Job fetches the job with the given ID.
+func (c *Client) Job(id string) (Job, error) {
+	var job Job
+	if err := c.do("GET", "/v1/job/"+url.PathEscape(id), nil, nil, &job); err != nil {
+		return nil, fmt.Errorf("job %s: %v", id, err)
+	}
+	return job, nil
+}
+
+// Register submits an updated job. The update is rejected if the job changed
+// since it was fetched.
+func (c *Client) Register(job Job) error {
+	id, _ := job["ID"].(string)
+	body := map[string]any{"Job": job, "EnforceIndex": true, "JobModifyIndex": job["JobModifyIndex"]}
+	return c.do("POST", "/v1/job/"+url.PathEscape(id), nil, body, nil)
+}
+
+// task finds a task in the job. An empty group matches any group.
+func (job Job) task(group, task string) (map[string]any, string, error) {
+	groups, _ := job["TaskGroups"].([]any)
+	for _, g := range groups {
+		tg, _ := g.(map[string]any)
+		name, _ := tg["Name"].(string)
+		if group != "" && name != group {
+			continue
+		}
+		tasks, _ := tg["Tasks"].([]any)
+		for _, t := range tasks {
+			if tm, _ := t.(map[string]any); tm["Name"] == task {
+				return tm, name, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("task %q not found in job %v", task, job["ID"])
+}
+
+// TaskEnv returns a task's env block.
+func (job Job) TaskEnv(group, task string) (map[string]string, error) {
+	t, _, err := job.task(group, task)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string)
+	if m, ok := t["Env"].(map[string]any); ok {
+		for k, v := range m {
+			env[k], _ = v.(string)
+		}
+	}
+	return env, nil
+}
+
+// SetTaskEnv applies env over a task's env block and returns the task's
+// group.
+func (job Job) SetTaskEnv(group, task string, env map[string]string) (string, error) {
+	t, name, err := job.task(group, task)
+	if err != nil {
+		return "", err
+	}
+	m, ok := t["Env"].(map[string]any)
+	if !ok {
+		m = make(map[string]any)
+		t["Env"] = m
+	}
+	for k, v := range env {
+		m[k] = v
+	}
+	return name, nil
+}
+
+// Variables returns the items stored at a Nomad Variables path and the
+// index to pass to PutVariables. A missing path has no items.
+func (c *Client) Variables(path string) (map[string]string, uint64, error) {
+	var v struct {
+		Items       map[string]string
+		ModifyIndex uint64
+	}
+	err := c.do("GET", "/v1/var/"+path, nil, nil, &v)
+	if err == errNotFound {
+		return map[string]string{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("variables %s: %v", path, err)
+	}
+	if v.Items == nil {
+		v.Items = map[string]string{}
+	}
+	return v.Items, v.ModifyIndex, nil
+}
+
+// PutVariables replaces the items at path, failing if they changed since
+// index was read.
+func (c *Client) PutVariables(path string, items map[string]string, index uint64) error {
+	body := map[string]any{"Path": path, "Namespace": c.namespace, "Items": items}
+	query := url.Values{"cas": {strconv.FormatUint(index, 10)}}
+	if err := c.do("PUT", "/v1/var/"+path, query, body, nil); err != nil {
+		return fmt.Errorf("variables %s: %v", path, err)
+	}
+	return nil
+}
+
+// TaskState is one task's state within an allocation.
+type TaskState struct {
+	State     string
+	StartedAt time.Time
+}
+
+// Allocation is the part of a job allocation the manager checks.
+type Allocation struct {
+	ID           string
+	TaskGroup    string
+	ClientStatus string
+	TaskStates   map[string]TaskState
+}
+
+// Allocations lists the job's allocations.
+func (c *Client) Allocations(job string) ([]Allocation, error) {
+	var allocs []Allocation
+	if err := c.do("GET", "/v1/job/"+url.PathEscape(job)+"/allocations", nil, nil, &allocs); err != nil {
+		return nil, fmt.Errorf("allocations of %s: %v", job, err)
+	}
+	return allocs, nil
+}
+
+// TaskRunningSince reports whether an allocation of group runs task, started
+// at or after since.
+func TaskRunningSince(allocs []Allocation, group, task string, since time.Time) bool {
+	for _, a := range allocs {
+		if a.ClientStatus != "running" || (group != "" && a.TaskGroup != group) {
+			continue
+		}
+		if s, ok := a.TaskStates[task]; ok && s.State == "running" && !s.StartedAt.Before(since) {
+			return true
+		}
+	}
+	return false
+}
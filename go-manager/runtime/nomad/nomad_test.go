@@ -0,0 +1,133 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAgent serves a job and a variables path the way a Nomad agent does.
+type fakeAgent struct {
+	mu         sync.Mutex
+	registered map[string]any
+	items      map[string]string
+	index      uint64
+	query      string
+	token      string
+}
+
+func (f *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.query, f.token = r.URL.RawQuery, r.Header.Get("X-Nomad-Token")
+
+	switch r.Method + " " + r.URL.Path {
+	case "GET /v1/job/vpn":
+		w.Write([]byte(`{
+			"ID": "vpn", "JobModifyIndex": 41, "Datacenters": ["home"],
+			"TaskGroups": [
+				{"Name": "vpn", "Tasks": [
+					{"Name": "gluetun", "Driver": "docker", "Env": {"VPN_TYPE": "wireguard", "SERVER_NAMES": "US#1"}},
+					{"Name": "qbittorrent", "Driver": "docker"}
+				]}
+			]
+		}`))
+	case "POST /v1/job/vpn":
+		json.NewDecoder(r.Body).Decode(&f.registered)
+		w.Write([]byte(`{"EvalID": "e1"}`))
+	case "GET /v1/var/nomad/jobs/vpn":
+		if f.items == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Items": f.items, "ModifyIndex": f.index})
+	case "PUT /v1/var/nomad/jobs/vpn":
+		if r.URL.Query().Get("cas") != "0" && f.items == nil {
+			http.Error(w, "cas conflict", http.StatusConflict)
+			return
+		}
+		var v struct{ Items map[string]string }
+		json.NewDecoder(r.Body).Decode(&v)
+		f.items, f.index = v.Items, f.index+1
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUpdateTaskEnv(t *testing.T) {
+	agent := &fakeAgent{}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	client := New(srv.URL+"/", "secret", "homelab")
+
+	job, err := client.Job("vpn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := job.SetTaskEnv("", "gluetun", map[string]string{"SERVER_NAMES": "US#2"})
+	if err != nil || group != "vpn" {
+		t.Fatalf("SetTaskEnv = %q, %v", group, err)
+	}
+	if err := client.Register(job); err != nil {
+		t.Fatal(err)
+	}
+	if agent.token != "secret" || agent.query != "namespace=homelab" {
+		t.Errorf("token %q, query %q", agent.token, agent.query)
+	}
+
+	if agent.registered["EnforceIndex"] != true || agent.registered["JobModifyIndex"] != float64(41) {
+		t.Errorf("update not index-checked: %v", agent.registered)
+	}
+	registered := Job(agent.registered["Job"].(map[string]any))
+	env, err := registered.TaskEnv("vpn", "gluetun")
+	if err != nil || env["SERVER_NAMES"] != "US#2" || env["VPN_TYPE"] != "wireguard" {
+		t.Errorf("env = %v, %v", env, err)
+	}
+	if registered["Datacenters"] == nil {
+		t.Error("job fields dropped on update")
+	}
+	if _, err := job.TaskEnv("", "missing"); err == nil {
+		t.Error("found a task that doesn't exist")
+	}
+}
+
+func TestVariables(t *testing.T) {
+	agent := &fakeAgent{}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	client := New(srv.URL, "", "")
+
+	items, index, err := client.Variables("nomad/jobs/vpn")
+	if err != nil || len(items) != 0 || index != 0 {
+		t.Fatalf("missing path = %v, %d, %v", items, index, err)
+	}
+	items["SERVER_NAMES"] = "US#2"
+	if err := client.PutVariables("nomad/jobs/vpn", items, index); err != nil {
+		t.Fatal(err)
+	}
+	if items, index, err = client.Variables("nomad/jobs/vpn"); err != nil || items["SERVER_NAMES"] != "US#2" || index != 1 {
+		t.Errorf("after put = %v, %d, %v", items, index, err)
+	}
+}
+
+func TestTaskRunningSince(t *testing.T) {
+	pushed := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	allocs := []Allocation{
+		{TaskGroup: "vpn", ClientStatus: "running", TaskStates: map[string]TaskState{"gluetun": {State: "running", StartedAt: pushed.Add(-time.Hour)}}},
+		{TaskGroup: "vpn", ClientStatus: "pending", TaskStates: map[string]TaskState{"gluetun": {State: "pending"}}},
+	}
+	if TaskRunningSince(allocs, "vpn", "gluetun", pushed) {
+		t.Error("ready before the updated task started")
+	}
+	allocs[1] = Allocation{TaskGroup: "vpn", ClientStatus: "running", TaskStates: map[string]TaskState{"gluetun": {State: "running", StartedAt: pushed.Add(5 * time.Second)}}}
+	if !TaskRunningSince(allocs, "", "gluetun", pushed) {
+		t.Error("not ready with the updated task running")
+	}
+	if TaskRunningSince(allocs, "other", "gluetun", pushed) {
+		t.Error("matched an allocation of another group")
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Secret backends. With "env" (the default) credentials come from the
+// environment and sessions live in SESSION_FILE; the others keep both the
+// credentials and the Proton session (including its refresh token) in the
+// backend, so nothing sensitive has to be in the compose file.
+const (
+	secretBackendEnv     = "env"
+	secretBackendFile    = "file"
+	secretBackendKeyring = "keyring"
+	secretBackendVault   = "vault"
+)
+
+const keyringService = "gluetun-proton-manager"
+
+var errSecretNotFound = errors.New("secret not found")
+
+// secretStore is a key/value store for credentials and sessions. Keys are
+// lower-case env var style names, e.g. proton_password or proton_session_2.
+type secretStore interface {
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+}
+
+var (
+	secrets    secretStore // nil with the env backend
+	secretsErr error
+)
+
+func newSecretStore(backend string) (secretStore, error) {
+	switch backend {
+	case "", secretBackendEnv:
+		return nil, nil
+	case secretBackendFile:
+		return fileSecrets{dir: cfg.secretDir}, nil
+	case secretBackendKeyring:
+		return keyringSecrets{}, nil
+	case secretBackendVault:
+		return newVaultSecrets()
+	}
+	return nil, fmt.Errorf("unknown SECRET_BACKEND %q", backend)
+}
+
+// credential returns an env var, falling back to the secret backend.
+func credential(name string) string {
+	if v := os.Getenv(name); v != "" || secrets == nil {
+		return v
+	}
+	v, err := secrets.Get(strings.ToLower(name))
+	if err != nil && !errors.Is(err, errSecretNotFound) {
+		log(fmt.Sprintf("Failed to read %s from %s: %v", name, secrets.Name(), err))
+	}
+	return v
+}
+
+// sessionLocation describes where an account's session is kept.
+func sessionLocation(acct account) string {
+	if secrets != nil {
+		return secrets.Name()
+	}
+	return acct.SessionFile
+}
+
+// fileSecrets stores one secret per file, named after its key, so Docker
+// secrets can be mounted straight into SECRET_DIR.
+type fileSecrets struct {
+	dir string
+}
+
+func (s fileSecrets) Name() string { return "secret files" }
+
+func (s fileSecrets) Get(key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, key))
+	if os.IsNotExist(err) {
+		return "", errSecretNotFound
+	}
+	return strings.TrimSpace(string(data)), err
+}
+
+func (s fileSecrets) Set(key, value string) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, key), []byte(value), 0600)
+}
+
+// keyringSecrets uses the OS keyring (Secret Service on Linux).
+type keyringSecrets struct{}
+
+func (keyringSecrets) Name() string { return "keyring" }
+
+func (keyringSecrets) Get(key string) (string, error) {
+	v, err := keyring.Get(keyringService, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", errSecretNotFound
+	}
+	return v, err
+}
+
+func (keyringSecrets) Set(key, value string) error {
+	return keyring.Set(keyringService, key, value)
+}
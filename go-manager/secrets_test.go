@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+// newFakeVault serves a KV v2 secret at secret/data/manager, replacing the
+// whole secret on every write like Vault does.
+func newFakeVault(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	var fields map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("X-Vault-Token") != token {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/manager" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			if fields == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": fields}})
+		case "POST":
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			fields = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNewSecretStore(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("VAULT_TOKEN_FILE", "")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("s.file\n"), 0600)
+
+	for _, tc := range []struct {
+		backend, addr, path, tokenFile string
+		name                           string // of the store, "" for none
+		ok                             bool
+	}{
+		{"", "", "", "", "", true},
+		{"env", "", "", "", "", true},
+		{"file", "", "", "", "secret files", true},
+		{"keyring", "", "", "", "keyring", true},
+		{"vault", "http://vault:8200", "secret/manager", tokenFile, "Vault", true},
+		{"vault", "", "secret/manager", tokenFile, "", false},
+		{"vault", "http://vault:8200", "secret/manager", "", "", false},
+		{"vault", "http://vault:8200", "secret/manager", "/missing", "", false},
+		{"vault", "http://vault:8200", "secret", tokenFile, "", false},
+		{"aws", "", "", "", "", false},
+	} {
+		cfg.vaultAddr, cfg.vaultSecretPath = tc.addr, tc.path
+		t.Setenv("VAULT_TOKEN_FILE", tc.tokenFile)
+		store, err := newSecretStore(tc.backend)
+		if (err == nil) != tc.ok {
+			t.Errorf("SECRET_BACKEND=%s (%s, %s): %v", tc.backend, tc.addr, tc.path, err)
+			continue
+		}
+		name := ""
+		if store != nil {
+			name = store.Name()
+		}
+		if tc.ok && name != tc.name {
+			t.Errorf("SECRET_BACKEND=%q: store %q, want %q", tc.backend, name, tc.name)
+		}
+	}
+}
+
+func TestSecretBackends(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	keyring.MockInit()
+	vault := newFakeVault(t, "s.token")
+	cfg.vaultAddr, cfg.vaultSecretPath = vault.URL, "/secret/manager/"
+	t.Setenv("VAULT_TOKEN", "s.token")
+	vaultStore, err := newVaultSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, store := range []secretStore{fileSecrets{dir: filepath.Join(t.TempDir(), "secrets")}, keyringSecrets{}, vaultStore} {
+		if _, err := store.Get("proton_password"); !errors.Is(err, errSecretNotFound) {
+			t.Errorf("%s: missing secret: %v", store.Name(), err)
+		}
+		if err := store.Set("proton_password", "hunter2"); err != nil {
+			t.Fatalf("%s: %v", store.Name(), err)
+		}
+		if err := store.Set("proton_session", `{"UID":"uid"}`); err != nil {
+			t.Fatalf("%s: %v", store.Name(), err)
+		}
+		// Writing one key keeps the others
+		if v, err := store.Get("proton_password"); v != "hunter2" || err != nil {
+			t.Errorf("%s: proton_password = %q, %v", store.Name(), v, err)
+		}
+		if v, err := store.Get("proton_session"); v != `{"UID":"uid"}` || err != nil {
+			t.Errorf("%s: proton_session = %q, %v", store.Name(), v, err)
+		}
+	}
+
+	vaultStore.token = "s.wrong"
+	if _, err := vaultStore.Get("proton_password"); err == nil || errors.Is(err, errSecretNotFound) {
+		t.Errorf("Vault with a bad token: %v", err)
+	}
+}
+
+func TestCredentialFallsBackToSecrets(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "proton_username"), []byte("alice\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "proton_password"), []byte("from-file"), 0600)
+	t.Setenv("PROTON_USERNAME", "")
+	t.Setenv("PROTON_PASSWORD", "from-env")
+	t.Setenv("PROTON_USERNAME_2", "")
+
+	prev := secrets
+	defer func() { secrets = prev }()
+	secrets = nil
+	if got := credential("PROTON_USERNAME"); got != "" {
+		t.Errorf("env backend read %q", got)
+	}
+
+	secrets = fileSecrets{dir: dir}
+	for name, want := range map[string]string{
+		"PROTON_USERNAME":   "alice",
+		"PROTON_PASSWORD":   "from-env", // the environment wins
+		"PROTON_USERNAME_2": "",
+	} {
+		if got := credential(name); got != want {
+			t.Errorf("credential(%s) = %q, want %q", name, got, want)
+		}
+	}
+
+	// Sessions go to the backend under the account's key
+	accounts = []account{{Username: "alice", SessionKey: "proton_session"}}
+	(&ProtonManager{uid: "uid", accessToken: "access", refreshToken: "refresh"}).saveSession()
+	if _, err := os.Stat(filepath.Join(dir, "proton_session")); err != nil {
+		t.Fatalf("session not in the secret dir: %v", err)
+	}
+	pm := &ProtonManager{}
+	if err := pm.loadSession(); err != nil || pm.refreshToken != "refresh" {
+		t.Errorf("loadSession = %v, refresh token %q", err, pm.refreshToken)
+	}
+	if got := sessionLocation(accounts[0]); got != "secret files" {
+		t.Errorf("sessionLocation = %q", got)
+	}
+}
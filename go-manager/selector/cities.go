@@ -0,0 +1,86 @@
+package selector
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// City names in targets are matched ignoring case, accents and separators,
+// so "Zurich" matches "Zürich" and "Sao Paulo" matches "São Paulo". A name
+// containing regular expression syntax is matched as a case-insensitive
+// pattern against the whole city name instead, e.g. "New York|Newark" or
+// "Los .*".
+
+const regexChars = `\^$.*+?()[]{}|`
+
+// foldTable maps accented Latin letters to their base letters.
+var foldTable = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ā", "a", "ă", "a", "ą", "a",
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Ā", "A", "Ă", "A", "Ą", "A",
+	"æ", "ae", "Æ", "AE", "ç", "c", "ć", "c", "č", "c", "Ç", "C", "Ć", "C", "Č", "C",
+	"ď", "d", "đ", "d", "Ď", "D", "Đ", "D",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ē", "e", "ė", "e", "ę", "e", "ě", "e",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E", "Ē", "E", "Ė", "E", "Ę", "E", "Ě", "E",
+	"ğ", "g", "Ğ", "G",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ī", "i", "ı", "i", "İ", "I",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I", "Ī", "I",
+	"ł", "l", "ľ", "l", "Ł", "L", "Ľ", "L",
+	"ñ", "n", "ń", "n", "ň", "n", "Ñ", "N", "Ń", "N", "Ň", "N",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ō", "o", "ő", "o",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Ō", "O", "Ő", "O",
+	"œ", "oe", "Œ", "OE", "ř", "r", "Ř", "R",
+	"ś", "s", "š", "s", "ş", "s", "ș", "s", "ß", "ss", "Ś", "S", "Š", "S", "Ş", "S", "Ș", "S",
+	"ť", "t", "ţ", "t", "ț", "t", "Ť", "T", "Ţ", "T", "Ț", "T",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ū", "u", "ů", "u", "ű", "u",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ū", "U", "Ů", "U", "Ű", "U",
+	"ý", "y", "ÿ", "y", "Ý", "Y", "ž", "z", "ź", "z", "ż", "z", "Ž", "Z", "Ź", "Z", "Ż", "Z",
+)
+
+// NormalizeCity folds a city name for comparison: accents removed, lower
+// case, and hyphens, dots and runs of spaces reduced to single spaces.
+func NormalizeCity(name string) string {
+	name = strings.ToLower(foldTable.Replace(name))
+	name = strings.NewReplacer("-", " ", ".", " ", "'", "").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// IsCityPattern reports whether a target city is a regular expression.
+func IsCityPattern(city string) bool {
+	return strings.ContainsAny(city, regexChars)
+}
+
+var (
+	patternMu    sync.Mutex
+	patternCache = map[string]*regexp.Regexp{}
+)
+
+// CompileCity compiles a city pattern, anchored and case-insensitive. Accents
+// in the pattern are folded like city names.
+func CompileCity(pattern string) (*regexp.Regexp, error) {
+	patternMu.Lock()
+	defer patternMu.Unlock()
+	if re, ok := patternCache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(`(?i)^(?:` + foldTable.Replace(strings.TrimSpace(pattern)) + `)$`)
+	if err != nil {
+		return nil, err
+	}
+	patternCache[pattern] = re
+	return re, nil
+}
+
+// MatchCity reports whether a server's city matches a target city. Invalid
+// patterns match nothing; ParseTargets rejects them.
+func MatchCity(target, city string) bool {
+	target = strings.TrimSpace(target)
+	if !IsCityPattern(target) {
+		return NormalizeCity(target) == NormalizeCity(city)
+	}
+	re, err := CompileCity(target)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(city) || re.MatchString(foldTable.Replace(city))
+}
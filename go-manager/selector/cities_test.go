@@ -0,0 +1,33 @@
+package selector
+
+import "testing"
+
+func TestMatchCity(t *testing.T) {
+	for _, tc := range []struct {
+		target, city string
+		want         bool
+	}{
+		{"Zurich", "Zürich", true},
+		{"zürich", "Zurich", true},
+		{"Sao Paulo", "São Paulo", true},
+		{"Malmo", "Malmö", true},
+		{"new york", "New York", true},
+		{"Frankfurt am Main", "Frankfurt-am-Main", true},
+		{"York", "New York", false},
+		{"Los .*", "Los Angeles", true},
+		{"New York|Newark", "Newark", true},
+		{"New York|Newark", "New Yorkshire", false},
+		{"S[aã]o Paulo", "São Paulo", true},
+		{"Reykjav.k", "Reykjavík", true},
+	} {
+		if got := MatchCity(tc.target, tc.city); got != tc.want {
+			t.Errorf("MatchCity(%q, %q) = %v, want %v", tc.target, tc.city, got, tc.want)
+		}
+	}
+}
+
+func TestParseTargetsRejectsBadPattern(t *testing.T) {
+	if _, err := ParseTargets("", "", false, "US", []string{"New (York"}); err == nil {
+		t.Error("accepted an invalid city pattern")
+	}
+}
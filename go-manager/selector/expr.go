@@ -0,0 +1,129 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Expressions describe selection policies the built-in settings can't, in the
+// expr language (https://expr-lang.org) over one server:
+//
+//	server.Load < 60 && server.City in ['Zurich', 'Geneva'] && !server.Virtual
+//
+// A filter must be a condition; a score must be a number. Expressions are
+// type checked when compiled.
+
+// exprServer is what an expression sees as server.
+type exprServer struct {
+	Name         string
+	City         string
+	Country      string // exit country
+	EntryCountry string
+	HostCountry  string
+	Domain       string
+	Features     []string
+	Load         int
+	Score        float64
+	Tier         int
+	Lat          float64
+	Long         float64
+	Servers      int // physical servers behind it
+	Virtual      bool
+	SecureCore   bool
+	Tor          bool
+	P2P          bool
+	Streaming    bool
+	IPv6         bool
+}
+
+type exprEnv struct {
+	Server exprServer `expr:"server"`
+}
+
+func newEnv(s *protonapi.LogicalServer) exprEnv {
+	return exprEnv{Server: exprServer{
+		Name:         s.Name,
+		City:         s.City,
+		Country:      s.ExitCountry,
+		EntryCountry: s.EntryCountry,
+		HostCountry:  s.HostCountry,
+		Domain:       s.Domain,
+		Features:     s.FeatureNames(),
+		Load:         s.Load,
+		Score:        s.Score,
+		Tier:         s.Tier,
+		Lat:          s.Location.Lat,
+		Long:         s.Location.Long,
+		Servers:      len(s.Servers),
+		Virtual:      s.IsVirtual(),
+		SecureCore:   s.Features&protonapi.FeatureSecureCore != 0,
+		Tor:          s.Features&protonapi.FeatureTor != 0,
+		P2P:          s.Features&protonapi.FeatureP2P != 0,
+		Streaming:    s.Features&protonapi.FeatureStreaming != 0,
+		IPv6:         s.Features&protonapi.FeatureIPv6 != 0,
+	}}
+}
+
+// Expr is a compiled filter or score expression.
+type Expr struct {
+	src     string
+	program *vm.Program
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Match reports whether a filter accepts s. It fails if the expression can't
+// be evaluated for s, e.g. on a division by zero.
+func (e *Expr) Match(s protonapi.LogicalServer) (bool, error) {
+	v, err := expr.Run(e.program, newEnv(&s))
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := v.(bool)
+	if !isBool {
+		return false, fmt.Errorf("%s is %v, not a condition", e.src, v)
+	}
+	return ok, nil
+}
+
+// Score evaluates a score expression for s. It fails unless the result is a
+// finite number, so NaN or an infinity can't upset the ranking.
+func (e *Expr) Score(s protonapi.LogicalServer) (float64, error) {
+	v, err := expr.Run(e.program, newEnv(&s))
+	if err != nil {
+		return 0, err
+	}
+	score, ok := v.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s is %v, not a number", e.src, v)
+	}
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return 0, fmt.Errorf("%s is %v for %s", e.src, score, s.Name)
+	}
+	return score, nil
+}
+
+// CompileFilter compiles an expression that must be true for a server to be
+// used.
+func CompileFilter(src string) (*Expr, error) {
+	return compile(src, expr.AsBool())
+}
+
+// CompileScore compiles an expression whose value is added to a server's
+// load when ranking candidates.
+func CompileScore(src string) (*Expr, error) {
+	return compile(src, expr.AsFloat64())
+}
+
+func compile(src string, want expr.Option) (*Expr, error) {
+	program, err := expr.Compile(src, expr.Env(exprEnv{}), want)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, program: program}, nil
+}
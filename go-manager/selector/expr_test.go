@@ -0,0 +1,102 @@
+package selector
+
+import (
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestExprFilter(t *testing.T) {
+	zurich := protonapi.LogicalServer{Name: "CH#4", City: "Zurich", ExitCountry: "CH", Load: 40, Tier: 2,
+		Features: protonapi.FeatureP2P | protonapi.FeatureStreaming}
+	virtual := protonapi.LogicalServer{Name: "IS#1", City: "Reykjavik", ExitCountry: "IS", HostCountry: "DE", Load: 10}
+
+	for _, tc := range []struct {
+		expr        string
+		ch4, virtIS bool
+	}{
+		{`server.Load < 60 && server.City in ['Zurich', 'Geneva'] && !server.Virtual`, true, false},
+		{`!server.Virtual`, true, false},
+		{`server.Load <= 10 || server.P2P`, true, true},
+		{`'P2P' in server.Features && server.Streaming`, true, false},
+		{`server.Name startsWith "CH#" || server.Country == 'IS'`, true, true},
+		{`server.City matches '^Z.*h$'`, true, false},
+		{`(server.Load * 2 - 10 > 60) == true`, true, false},
+		{`(server.Tier == 2 ? server.Load : 100) < 50`, true, false},
+		{`server.Load % 10 == 0 && server.Tier in [0, 2]`, true, true},
+		{`server.HostCountry != '' && server.Name contains '#1'`, false, true},
+	} {
+		f, err := CompileFilter(tc.expr)
+		if err != nil {
+			t.Errorf("CompileFilter(%s): %v", tc.expr, err)
+			continue
+		}
+		if got, err := f.Match(zurich); err != nil || got != tc.ch4 {
+			t.Errorf("%s on CH#4 = %v, %v, want %v", tc.expr, got, err, tc.ch4)
+		}
+		if got, err := f.Match(virtual); err != nil || got != tc.virtIS {
+			t.Errorf("%s on IS#1 = %v, %v, want %v", tc.expr, got, err, tc.virtIS)
+		}
+	}
+}
+
+func TestExprScore(t *testing.T) {
+	score, err := CompileScore(`server.City == 'Zurich' ? -10 : server.Load / 4`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := score.Score(protonapi.LogicalServer{City: "Zurich"}); err != nil || got != -10 {
+		t.Errorf("score in Zurich = %v, %v, want -10", got, err)
+	}
+	if got, err := score.Score(protonapi.LogicalServer{City: "Geneva", Load: 30}); err != nil || got != 7.5 {
+		t.Errorf("score in Geneva = %v, %v, want 7.5", got, err)
+	}
+}
+
+func TestExprScoreNotFinite(t *testing.T) {
+	for _, src := range []string{
+		`server.Load / 0`,      // +Inf
+		`-server.Load / 0`,     // -Inf
+		`server.Score / 0 * 0`, // NaN
+		`server.Load % 0`,      // integer division by zero
+		`server.Tier % server.Tier`,
+	} {
+		score, err := CompileScore(src)
+		if err != nil {
+			t.Errorf("CompileScore(%s): %v", src, err)
+			continue
+		}
+		if got, err := score.Score(protonapi.LogicalServer{Name: "CH#4", Load: 40}); err == nil {
+			t.Errorf("%s = %v, want an error", src, got)
+		}
+	}
+
+	f, err := CompileFilter(`server.Load % server.Tier == 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Match(protonapi.LogicalServer{Load: 40}); err == nil {
+		t.Error("filter dividing by zero matched without an error")
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, expr := range []string{
+		`server.Load`,          // not a condition
+		`server.Load < 'high'`, // mismatched types
+		`server.Speed > 1`,     // unknown field
+		`Load > 1`,             // missing server.
+		`server.Load > 1 &&`,   // incomplete
+		`server.City matches '('`,
+		`'unterminated`,
+		`server.Load > 1 )`,
+		`!server.Load`,
+	} {
+		if _, err := CompileFilter(expr); err == nil {
+			t.Errorf("CompileFilter(%s) succeeded, want an error", expr)
+		}
+	}
+	if _, err := CompileScore(`server.Load < 50`); err == nil {
+		t.Error("CompileScore accepted a condition")
+	}
+}
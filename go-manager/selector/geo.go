@@ -0,0 +1,39 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// ParseLocation reads a "lat,long" pair.
+func ParseLocation(s string) (protonapi.Location, error) {
+	latStr, longStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return protonapi.Location{}, fmt.Errorf("expected lat,long")
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil {
+		return protonapi.Location{}, err
+	}
+	long, err := strconv.ParseFloat(strings.TrimSpace(longStr), 64)
+	if err != nil {
+		return protonapi.Location{}, err
+	}
+	return protonapi.Location{Lat: lat, Long: long}, nil
+}
+
+// DistanceKm is the great-circle distance between two points.
+func DistanceKm(a, b protonapi.Location) float64 {
+	const earthRadius = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(b.Lat - a.Lat)
+	dLong := rad(b.Long - a.Long)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,99 @@
+package selector
+
+import (
+	"math"
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+var (
+	amsterdam = protonapi.Location{Lat: 52.37, Long: 4.89}
+	paris     = protonapi.Location{Lat: 48.86, Long: 2.35}
+	newYork   = protonapi.Location{Lat: 40.71, Long: -74.01}
+	sydney    = protonapi.Location{Lat: -33.87, Long: 151.21}
+)
+
+func TestDistanceKm(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b protonapi.Location
+		want float64
+	}{
+		{"same place", amsterdam, amsterdam, 0},
+		{"amsterdam-paris", amsterdam, paris, 430},
+		{"paris-new york", paris, newYork, 5837},
+		{"across the date line", protonapi.Location{Lat: 0, Long: 179}, protonapi.Location{Lat: 0, Long: -179}, 222},
+		{"antipodes", protonapi.Location{Lat: 0, Long: 0}, protonapi.Location{Lat: 0, Long: 180}, math.Pi * 6371},
+	} {
+		got := DistanceKm(tc.a, tc.b)
+		if math.Abs(got-tc.want) > tc.want/100+1 {
+			t.Errorf("%s: %.0f km, want about %.0f", tc.name, got, tc.want)
+		}
+		if back := DistanceKm(tc.b, tc.a); math.Abs(back-got) > 1e-6 {
+			t.Errorf("%s: not symmetric (%f, %f)", tc.name, got, back)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want protonapi.Location
+		ok   bool
+	}{
+		{"52.37,4.89", amsterdam, true},
+		{" -33.87 , 151.21 ", sydney, true},
+		{"52.37", protonapi.Location{}, false},
+		{"north,4.89", protonapi.Location{}, false},
+		{"52.37,", protonapi.Location{}, false},
+	} {
+		got, err := ParseLocation(tc.in)
+		if (err == nil) != tc.ok || got != tc.want {
+			t.Errorf("ParseLocation(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestResolveAutoRadius(t *testing.T) {
+	servers := []protonapi.LogicalServer{
+		{Name: "NL#1", EntryCountry: "NL", Location: amsterdam},
+		{Name: "FR#1", EntryCountry: "FR", Location: paris},
+		{Name: "US#1", EntryCountry: "US", Location: newYork},
+		{Name: "XX#1", EntryCountry: "XX"}, // no location
+	}
+	tiers, err := ParseTargets("US", "", true, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := func(protonapi.LogicalServer) bool { return true }
+	notNL := func(s protonapi.LogicalServer) bool { return s.EntryCountry != "NL" }
+	at := func(loc protonapi.Location) *protonapi.Location { return &loc }
+
+	for _, tc := range []struct {
+		name     string
+		origin   *protonapi.Location
+		radius   float64
+		eligible func(protonapi.LogicalServer) bool
+		want     map[string]int
+	}{
+		{"nearest only", at(amsterdam), 300, all, map[string]int{"NL#1": 1, "FR#1": 2, "US#1": 0, "XX#1": 2}},
+		{"radius reaches paris", at(amsterdam), 500, all, map[string]int{"NL#1": 1, "FR#1": 1, "US#1": 0}},
+		// The radius starts at the nearest eligible server, however far
+		{"nearest not eligible", at(amsterdam), 10, notNL, map[string]int{"NL#1": 1, "FR#1": 1, "US#1": 0}},
+		{"only the nearest", at(sydney), 0, func(s protonapi.LogicalServer) bool { return s.EntryCountry != "US" }, map[string]int{"NL#1": 1, "FR#1": 2}},
+		{"unknown origin", nil, 300, all, map[string]int{"NL#1": 2, "FR#1": 2, "US#1": 0}},
+	} {
+		resolved := Resolve(tiers, servers, tc.origin, tc.radius, tc.eligible)
+		for _, s := range servers {
+			if want, ok := tc.want[s.Name]; ok {
+				if got := Rank(resolved, s); got != want {
+					t.Errorf("%s: Rank(%s) = %d, want %d", tc.name, s.Name, got, want)
+				}
+			}
+		}
+	}
+	if tiers[1].Origin != nil || tiers[1].MaxKm != 0 {
+		t.Error("Resolve modified the parsed tiers")
+	}
+}
@@ -0,0 +1,34 @@
+package selector
+
+// Regions maps region names to the ISO country codes Proton labels its
+// servers with. Broader regions include the narrower ones.
+var Regions = map[string][]string{
+	"eu-west":         {"BE", "FR", "GB", "IE", "LU", "NL", "UK"},
+	"eu-central":      {"AT", "CH", "CZ", "DE", "HU", "LI", "PL", "SI", "SK"},
+	"eu-north":        {"DK", "EE", "FI", "IS", "LT", "LV", "NO", "SE"},
+	"eu-south":        {"AD", "CY", "ES", "GR", "HR", "IT", "MT", "PT"},
+	"eu-east":         {"AL", "BA", "BG", "GE", "MD", "ME", "MK", "RO", "RS", "UA"},
+	"north-america":   {"CA", "MX", "US"},
+	"central-america": {"BZ", "CR", "GT", "HN", "NI", "PA", "SV"},
+	"south-america":   {"AR", "BO", "BR", "CL", "CO", "EC", "PE", "PY", "UY", "VE"},
+	"middle-east":     {"AE", "BH", "IL", "JO", "KW", "LB", "OM", "QA", "SA", "TR"},
+	"asia-east":       {"CN", "HK", "JP", "KR", "MN", "TW"},
+	"asia-southeast":  {"ID", "KH", "MM", "MY", "PH", "SG", "TH", "VN"},
+	"asia-south":      {"BD", "IN", "LK", "NP", "PK"},
+	"asia-central":    {"AZ", "KZ", "KG", "TJ", "UZ"},
+	"oceania":         {"AU", "FJ", "NZ", "PG"},
+	"africa":          {"AO", "DZ", "EG", "ET", "GH", "KE", "MA", "MZ", "NG", "SN", "TN", "UG", "ZA"},
+}
+
+func init() {
+	union := func(names ...string) []string {
+		var codes []string
+		for _, name := range names {
+			codes = append(codes, Regions[name]...)
+		}
+		return codes
+	}
+	Regions["europe"] = union("eu-west", "eu-central", "eu-north", "eu-south", "eu-east")
+	Regions["americas"] = union("north-america", "central-america", "south-america")
+	Regions["asia"] = union("asia-east", "asia-southeast", "asia-south", "asia-central")
+}
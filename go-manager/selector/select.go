@@ -0,0 +1,146 @@
+package selector
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Options are the policies Select applies on top of the tiers.
+type Options struct {
+	// Fallback allows any eligible server once every tier is exhausted.
+	Fallback bool
+	// Eligible filters servers before ranking. Nil accepts active servers.
+	Eligible func(protonapi.LogicalServer) bool
+	// Quarantined servers are only used when nothing else is left. Nil
+	// quarantines nothing.
+	Quarantined func(name string) bool
+	// Penalty is added to a server's load when ordering candidates. Nil adds
+	// nothing.
+	Penalty func(protonapi.LogicalServer) float64
+	// TopK > 1 moves a random one of the TopK best candidates within
+	// LoadBand points of the best to the front, favouring the less loaded,
+	// so many clients using the same data don't all pick the same server.
+	TopK     int
+	LoadBand float64
+	// Preferred names servers, in order, that win over the tiers while they
+	// are eligible, not quarantined and at most PreferredMaxLoad loaded.
+	Preferred        []string
+	PreferredMaxLoad int
+}
+
+// Select returns the eligible servers of the most preferred tier that has
+// any, sorted by load plus penalty, after the first usable preferred server
+// if there is one. The tiers should already be resolved. It reports whether
+// it had to fall back to quarantined servers.
+func Select(servers []protonapi.LogicalServer, tiers []Tier, opts Options) ([]protonapi.LogicalServer, bool) {
+	eligible := opts.Eligible
+	if eligible == nil {
+		eligible = func(s protonapi.LogicalServer) bool { return s.Status == 1 }
+	}
+	ranks := len(tiers)
+	if opts.Fallback {
+		ranks++
+	}
+	candidates := make([][]protonapi.LogicalServer, ranks)
+	quarantined := make([][]protonapi.LogicalServer, ranks)
+
+	for _, s := range servers {
+		if !eligible(s) {
+			continue
+		}
+		rank := Rank(tiers, s)
+		if rank >= ranks {
+			continue
+		}
+		if opts.Quarantined != nil && opts.Quarantined(s.Name) {
+			quarantined[rank] = append(quarantined[rank], s)
+		} else {
+			candidates[rank] = append(candidates[rank], s)
+		}
+	}
+
+	score := func(s protonapi.LogicalServer) float64 {
+		if opts.Penalty == nil {
+			return float64(s.Load)
+		}
+		return float64(s.Load) + opts.Penalty(s)
+	}
+	pick := func(ranked [][]protonapi.LogicalServer) []protonapi.LogicalServer {
+		for _, tier := range ranked {
+			if len(tier) > 0 {
+				sort.SliceStable(tier, func(i, j int) bool { return score(tier[i]) < score(tier[j]) })
+				return tier
+			}
+		}
+		return nil
+	}
+
+	if pref := FirstPreferred(servers, opts); pref != nil {
+		rest := slices.DeleteFunc(slices.Clone(pick(candidates)), func(s protonapi.LogicalServer) bool { return s.Name == pref.Name })
+		return append([]protonapi.LogicalServer{*pref}, rest...), false
+	}
+	if best := pick(candidates); best != nil {
+		spread(best, score, opts)
+		return best, false
+	}
+	// Better a recently failing server than none at all
+	if best := pick(quarantined); best != nil {
+		spread(best, score, opts)
+		return best, true
+	}
+	return nil, false
+}
+
+// FirstPreferred returns the first server of opts.Preferred that is usable
+// right now, or nil.
+func FirstPreferred(servers []protonapi.LogicalServer, opts Options) *protonapi.LogicalServer {
+	for _, name := range opts.Preferred {
+		s := protonapi.FindByName(servers, name)
+		if s != nil && PreferredUsable(*s, opts) {
+			return s
+		}
+	}
+	return nil
+}
+
+// PreferredUsable reports whether a preferred server may be used.
+func PreferredUsable(s protonapi.LogicalServer, opts Options) bool {
+	eligible := opts.Eligible == nil && s.Status == 1 || opts.Eligible != nil && opts.Eligible(s)
+	return eligible && s.Load <= opts.PreferredMaxLoad &&
+		(opts.Quarantined == nil || !opts.Quarantined(s.Name))
+}
+
+// spread moves a weighted random pick among the sorted servers' top
+// opts.TopK within opts.LoadBand of the first to the front. The weight falls
+// linearly with the distance from the best score.
+func spread(servers []protonapi.LogicalServer, score func(protonapi.LogicalServer) float64, opts Options) {
+	if opts.TopK < 2 || len(servers) < 2 {
+		return
+	}
+	best := score(servers[0])
+	var weights []float64
+	var total float64
+	for _, s := range servers[:min(opts.TopK, len(servers))] {
+		d := score(s) - best
+		if d > opts.LoadBand {
+			break
+		}
+		w := opts.LoadBand + 1 - d
+		weights = append(weights, w)
+		total += w
+	}
+
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			chosen := servers[i]
+			copy(servers[1:i+1], servers[:i])
+			servers[0] = chosen
+			return
+		}
+		r -= w
+	}
+}
@@ -0,0 +1,143 @@
+// Package selector picks Proton servers from an ordered list of preferred
+// targets: countries, cities, regions or the servers nearest to a location.
+package selector
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Tier is one entry of the ordered preference list: a country or a region.
+// Empty Countries matches any country and empty Cities any city.
+type Tier struct {
+	Name      string
+	Countries []string
+	Cities    []string
+
+	// Auto tiers match servers within MaxKm of Origin. Resolve fills both in
+	// for a given server list.
+	Auto   bool
+	Origin *protonapi.Location
+	MaxKm  float64
+}
+
+// ParseTargets builds the tiers from "NL:Amsterdam|Rotterdam,DE,CH:Zurich",
+// followed by one tier per region in "eu-west,europe" and the nearest-server
+// tier if auto is set. Without any of them, a single tier for country and
+// cities is returned.
+func ParseTargets(countries, regions string, auto bool, country string, cities []string) ([]Tier, error) {
+	var tiers []Tier
+	for _, entry := range strings.Split(countries, ",") {
+		code, cityList, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if code == "" {
+			continue
+		}
+		code = strings.ToUpper(strings.TrimSpace(code))
+		tier := Tier{Name: code, Countries: []string{code}}
+		for _, city := range strings.Split(cityList, "|") {
+			if city = strings.TrimSpace(city); city != "" {
+				tier.Cities = append(tier.Cities, city)
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	for _, name := range strings.Split(regions, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		codes, ok := Regions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TARGET_REGION %q", name)
+		}
+		tiers = append(tiers, Tier{Name: name, Countries: codes})
+	}
+	if auto {
+		tiers = append(tiers, Tier{Name: "nearest", Auto: true})
+	}
+	if len(tiers) == 0 {
+		tier := Tier{Name: country, Cities: cities}
+		if country != "" {
+			tier.Countries = []string{country}
+		}
+		tiers = []Tier{tier}
+	}
+	for _, t := range tiers {
+		for _, city := range t.Cities {
+			if IsCityPattern(city) {
+				if _, err := CompileCity(city); err != nil {
+					return nil, fmt.Errorf("invalid city pattern %q: %v", city, err)
+				}
+			}
+		}
+	}
+	return tiers, nil
+}
+
+// Matches reports whether the server belongs to the tier.
+func (t Tier) Matches(s protonapi.LogicalServer) bool {
+	if t.Auto {
+		return t.Origin != nil && s.HasLocation() && DistanceKm(*t.Origin, s.Location) <= t.MaxKm
+	}
+	if len(t.Countries) > 0 && !slices.ContainsFunc(t.Countries, func(c string) bool {
+		return strings.EqualFold(s.EntryCountry, c)
+	}) {
+		return false
+	}
+	if len(t.Cities) == 0 {
+		return true
+	}
+	for _, city := range t.Cities {
+		if MatchCity(city, s.City) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Tier) String() string {
+	name := t.Name
+	if name == "" {
+		name = "any country"
+	}
+	if len(t.Cities) > 0 {
+		name += " (" + strings.Join(t.Cities, ", ") + ")"
+	}
+	return name
+}
+
+// Resolve returns a copy of tiers with the auto tiers centred on origin,
+// reaching radiusKm beyond the nearest server that passes eligible. Auto
+// tiers match nothing when origin is nil.
+func Resolve(tiers []Tier, servers []protonapi.LogicalServer, origin *protonapi.Location, radiusKm float64, eligible func(protonapi.LogicalServer) bool) []Tier {
+	tiers = slices.Clone(tiers)
+	for i := range tiers {
+		if !tiers[i].Auto || origin == nil {
+			continue
+		}
+		nearest := math.Inf(1)
+		for _, s := range servers {
+			if eligible(s) && s.HasLocation() {
+				nearest = min(nearest, DistanceKm(*origin, s.Location))
+			}
+		}
+		tiers[i].Origin = origin
+		tiers[i].MaxKm = nearest + radiusKm
+	}
+	return tiers
+}
+
+// Rank returns the index of the first tier the server matches, or len(tiers)
+// if it only qualifies through the fallback.
+func Rank(tiers []Tier, s protonapi.LogicalServer) int {
+	for i, tier := range tiers {
+		if tier.Matches(s) {
+			return i
+		}
+	}
+	return len(tiers)
+}
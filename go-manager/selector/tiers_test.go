@@ -0,0 +1,110 @@
+package selector
+
+import (
+	"reflect"
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+func TestParseTargets(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		countries string
+		country   string
+		cities    []string
+		want      []Tier
+	}{
+		{"plain country and cities", "", "US", []string{"San Jose", "Seattle"},
+			[]Tier{{Name: "US", Countries: []string{"US"}, Cities: []string{"San Jose", "Seattle"}}}},
+		{"nothing set", "", "", nil, []Tier{{}}},
+		{"ordered countries", "nl:Amsterdam|Rotterdam, DE ,CH:Zurich", "US", []string{"San Jose"}, []Tier{
+			{Name: "NL", Countries: []string{"NL"}, Cities: []string{"Amsterdam", "Rotterdam"}},
+			{Name: "DE", Countries: []string{"DE"}},
+			{Name: "CH", Countries: []string{"CH"}, Cities: []string{"Zurich"}},
+		}},
+		{"empty entries skipped", ",SE:, :Oslo,", "", nil, []Tier{{Name: "SE", Countries: []string{"SE"}}}},
+	} {
+		got, err := ParseTargets(tc.countries, "", false, tc.country, tc.cities)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: ParseTargets = %+v, %v, want %+v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	tiers, err := ParseTargets("NL:Amsterdam,DE", "", false, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		server protonapi.LogicalServer
+		want   int
+	}{
+		{protonapi.LogicalServer{EntryCountry: "NL", City: "Amsterdam"}, 0},
+		{protonapi.LogicalServer{EntryCountry: "nl", City: "amsterdam"}, 0},
+		{protonapi.LogicalServer{EntryCountry: "NL", City: "Rotterdam"}, 2},
+		{protonapi.LogicalServer{EntryCountry: "DE", City: "Berlin"}, 1},
+		// Secure Core servers rank by their entry country
+		{protonapi.LogicalServer{EntryCountry: "CH", ExitCountry: "DE"}, 2},
+	} {
+		if got := Rank(tiers, tc.server); got != tc.want {
+			t.Errorf("Rank(%s %s) = %d, want %d", tc.server.EntryCountry, tc.server.City, got, tc.want)
+		}
+	}
+	if got := (Tier{}).String(); got != "any country" {
+		t.Errorf("empty tier = %q", got)
+	}
+	if got := tiers[0].String(); got != "NL (Amsterdam)" {
+		t.Errorf("tier = %q", got)
+	}
+}
+
+func TestRegionTiers(t *testing.T) {
+	tiers, err := ParseTargets("CH", " EU-West, europe,", false, "US", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tier := range tiers {
+		names = append(names, tier.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"CH", "eu-west", "europe"}) {
+		t.Fatalf("tiers = %v", names)
+	}
+	for _, tc := range []struct {
+		country string
+		want    int
+	}{
+		{"CH", 0},
+		{"NL", 1},
+		{"gb", 1},
+		{"SE", 2}, // eu-north, part of europe
+		{"RO", 2},
+		{"US", 3},
+	} {
+		if got := Rank(tiers, protonapi.LogicalServer{EntryCountry: tc.country}); got != tc.want {
+			t.Errorf("Rank(%s) = %d, want %d", tc.country, got, tc.want)
+		}
+	}
+
+	if _, err := ParseTargets("", "eu-west,narnia", false, "", nil); err == nil {
+		t.Error("unknown region accepted")
+	}
+}
+
+func TestRegionUnions(t *testing.T) {
+	for union, parts := range map[string][]string{
+		"europe":   {"eu-west", "eu-central", "eu-north", "eu-south", "eu-east"},
+		"americas": {"north-america", "central-america", "south-america"},
+		"asia":     {"asia-east", "asia-southeast", "asia-south", "asia-central"},
+	} {
+		var want []string
+		for _, part := range parts {
+			want = append(want, Regions[part]...)
+		}
+		if !reflect.DeepEqual(Regions[union], want) {
+			t.Errorf("%s = %v, want %v", union, Regions[union], want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SELECTOR_PLUGIN hands the final choice to an external program. It runs
+// with sh, reads the candidates, best first, as JSON on stdin:
+//
+//	{"current":"CH#12","candidates":[{"Name":"CH#4","Load":31,...},...]}
+//
+// and prints the name of the server to use. Printing nothing keeps the
+// built-in choice.
+
+// Selector makes the final choice among the ranked candidates, returning
+// the name of the server to use or "" to leave it to the next selector.
+type Selector interface {
+	Name() string
+	Select(candidates []LogicalServer, current string) (string, error)
+}
+
+// selectorPluginInput is what selector plugins read on stdin. Candidates
+// are the servers as the Proton API lists them.
+type selectorPluginInput struct {
+	Current    string          `json:"current"`
+	Candidates []LogicalServer `json:"candidates"`
+}
+
+// selectors returns SELECTOR_PLUGIN, if set, followed by the WASM selectors.
+func selectors() []Selector {
+	var list []Selector
+	if cfg.selectorPlugin != "" {
+		list = append(list, commandSelector{})
+	}
+	return append(list, wasmSelectors...)
+}
+
+// pluginSelect moves the first selector's choice to the front of the
+// candidates. A selector that fails, times out, makes no choice or names a
+// server that isn't a candidate is passed over; without a choice the
+// candidates are left as they are.
+func pluginSelect(candidates []LogicalServer, current string) []LogicalServer {
+	if len(candidates) == 0 {
+		return candidates
+	}
+	for _, sel := range selectors() {
+		name, err := sel.Select(candidates, current)
+		if err != nil {
+			log(fmt.Sprintf("Selector %s failed: %v", sel.Name(), err))
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		i := slices.IndexFunc(candidates, func(s LogicalServer) bool { return s.Name == name })
+		if i < 0 {
+			log(fmt.Sprintf("Selector %s chose %s, which isn't a candidate", sel.Name(), name))
+			continue
+		}
+		chosen := candidates[i]
+		copy(candidates[1:i+1], candidates[:i])
+		candidates[0] = chosen
+		return candidates
+	}
+	return candidates
+}
+
+// commandSelector runs SELECTOR_PLUGIN.
+type commandSelector struct{}
+
+func (commandSelector) Name() string { return "SELECTOR_PLUGIN" }
+
+// Select returns the first line the plugin prints.
+func (commandSelector) Select(candidates []LogicalServer, current string) (string, error) {
+	input, err := json.Marshal(selectorPluginInput{Current: current, Candidates: candidates})
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.selectorPluginTimeout)*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", cfg.selectorPlugin)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Don't wait for children of sh that still hold stdout after a timeout
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("timed out after %ds", cfg.selectorPluginTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return firstLine(out), nil
+}
+
+// firstLine returns a plugin's answer: the first line of its output.
+func firstLine(out []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return strings.TrimSpace(line)
+}
+
+// selectorPluginProblems reports SELECTOR_PLUGIN settings that can't work.
+func selectorPluginProblems() []string {
+	if cfg.selectorPlugin != "" && cfg.selectorPluginTimeout < 1 {
+		return []string{"SELECTOR_PLUGIN_TIMEOUT must be >= 1"}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSelectorPlugin(t *testing.T) {
+	setupTestEnv(t, "")
+	servers := []LogicalServer{
+		{Name: "A", Status: 1, Load: 10},
+		{Name: "B", Status: 1, Load: 20},
+		{Name: "C", Status: 1, Load: 30},
+	}
+	input := filepath.Join(t.TempDir(), "input.json")
+
+	cfg.selectorPlugin = "cat > " + input + "; echo C"
+	if best, _ := findBestServer(servers, "B"); best.Name != "C" {
+		t.Errorf("best = %s, want the plugin's choice C", best.Name)
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got selectorPluginInput
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("plugin input %s: %v", data, err)
+	}
+	if got.Current != "B" || len(got.Candidates) != 3 || got.Candidates[0].Name != "A" {
+		t.Errorf("plugin input = %+v, want current B and the candidates best first", got)
+	}
+
+	for _, plugin := range []string{
+		"true",                    // no choice
+		"echo Z",                  // not a candidate
+		"echo broken >&2; exit 1", // failed
+	} {
+		cfg.selectorPlugin = plugin
+		if best, _ := findBestServer(servers, ""); best.Name != "A" {
+			t.Errorf("with plugin %q best = %s, want the built-in choice A", plugin, best.Name)
+		}
+	}
+
+	cfg.selectorPlugin, cfg.selectorPluginTimeout = "sleep 5; echo C", 1
+	if best, _ := findBestServer(servers, ""); best.Name != "A" {
+		t.Errorf("after a timeout best = %s, want A", best.Name)
+	}
+}
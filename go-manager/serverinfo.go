@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// runServerInfo prints everything the API says about one logical server.
+func runServerInfo(pm *ProtonManager, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: manager server-info <server name, e.g. US-CA#50>")
+		os.Exit(exitUsage)
+	}
+	servers, err := pm.Servers()
+	if err != nil {
+		log(fmt.Sprintf("Error fetching servers: %v", err))
+		os.Exit(exitCode(err))
+	}
+
+	s := protonapi.FindByName(servers, strings.ToUpper(strings.TrimSpace(args[0])))
+	if s == nil {
+		fmt.Fprintf(os.Stderr, "No server named %q\n", args[0])
+		os.Exit(exitFailure)
+	}
+	writeServerInfo(os.Stdout, *s)
+}
+
+// writeServerInfo writes the details of one logical server and its physical
+// servers as a table.
+func writeServerInfo(w io.Writer, s LogicalServer) {
+	status := "active"
+	if s.Status != 1 {
+		status = fmt.Sprintf("unavailable (status %d)", s.Status)
+	}
+	features := strings.Join(s.FeatureNames(), ", ")
+	if features == "" {
+		features = "none"
+	}
+	location := fmt.Sprintf("%s, entry %s, exit %s", s.City, s.EntryCountry, s.ExitCountry)
+	if s.IsVirtual() {
+		location += fmt.Sprintf(", hosted in %s (Smart Routing)", s.HostCountry)
+	}
+
+	fmt.Fprintln(w, "------------------------------------------------------------")
+	fmt.Fprintf(w, "%-14s %s\n", "Server:", s.Name)
+	fmt.Fprintf(w, "%-14s %s\n", "ID:", s.ID)
+	fmt.Fprintf(w, "%-14s %s\n", "Status:", status)
+	fmt.Fprintf(w, "%-14s %s\n", "Location:", location)
+	if s.HasLocation() {
+		fmt.Fprintf(w, "%-14s %.4f, %.4f\n", "Coordinates:", s.Location.Lat, s.Location.Long)
+	}
+	fmt.Fprintf(w, "%-14s %s\n", "Domain:", s.Domain)
+	fmt.Fprintf(w, "%-14s %s\n", "Tier:", s.TierName())
+	fmt.Fprintf(w, "%-14s %s (0x%x)\n", "Features:", features, s.Features)
+	fmt.Fprintf(w, "%-14s %d%%\n", "Load:", s.Load)
+	fmt.Fprintf(w, "%-14s %.4f\n", "Score:", s.Score)
+	fmt.Fprintln(w, "------------------------------------------------------------")
+	fmt.Fprintf(w, "%-16s %-16s %-8s %-30s %s\n", "ENTRY IP", "EXIT IP", "STATUS", "DOMAIN", "WIREGUARD PUBLIC KEY")
+	for _, p := range s.Servers {
+		state := "up"
+		if p.Status != 1 {
+			state = "down"
+		}
+		fmt.Fprintf(w, "%-16s %-16s %-8s %-30s %s\n", p.EntryIP, p.ExitIP, state, p.Domain, p.X25519PublicKey)
+	}
+	fmt.Fprintln(w, "------------------------------------------------------------")
+}
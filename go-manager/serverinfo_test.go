@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestServerInfoDecoding(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    string
+		want    []string // output lines, whitespace collapsed
+		without string
+	}{
+		{"extra fields ignored", `{"Code":1000,"Unknown":true,"LogicalServers":[{
+			"ID":"l1","Name":"US-NY#7","EntryCountry":"US","ExitCountry":"US","HostCountry":"CA","Domain":"node-us-07.protonvpn.net",
+			"Tier":2,"Features":4,"Status":1,"Load":42,"Score":1.5,"City":"New York","Region":null,"NewFlag":[1,2],
+			"Location":{"Lat":40.7128,"Long":-74.006,"Elevation":10},
+			"Servers":[{"EntryIP":"1.2.3.4","ExitIP":"1.2.3.5","Domain":"node-us-07.protonvpn.net","ID":"p1","Status":0,"X25519PublicKey":"key=","Label":"2","Generation":0}]}]}`,
+			[]string{
+				"Server: US-NY#7",
+				"ID: l1",
+				"Status: active",
+				"Location: New York, entry US, exit US, hosted in CA (Smart Routing)",
+				"Coordinates: 40.7128, -74.0060",
+				"Tier: Plus",
+				"Features: P2P (0x4)",
+				"Load: 42%",
+				"Score: 1.5000",
+				"1.2.3.4 1.2.3.5 down node-us-07.protonvpn.net key=",
+			}, ""},
+		{"missing fields left empty", `{"Code":1000,"LogicalServers":[{"Name":"CH#9"}]}`,
+			[]string{
+				"Server: CH#9",
+				"Status: unavailable (status 0)",
+				"Location: , entry , exit",
+				"Tier: Free",
+				"Features: none (0x0)",
+				"Load: 0%",
+			}, "Coordinates:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, "")
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tc.body))
+			}))
+			t.Cleanup(api.Close)
+			cfg.apiBaseURL, cfg.altRouting = api.URL, false
+
+			pm := newTestManager(t, "alice")
+			servers, err := pm.Servers()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(servers) != 1 {
+				t.Fatalf("decoded %d servers, want 1", len(servers))
+			}
+
+			var out bytes.Buffer
+			writeServerInfo(&out, servers[0])
+			var lines []string
+			for line := range strings.Lines(out.String()) {
+				lines = append(lines, strings.Join(strings.Fields(line), " "))
+			}
+			for _, want := range tc.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("output lacks %q:\n%s", want, out.String())
+				}
+			}
+			if tc.without != "" && strings.Contains(out.String(), tc.without) {
+				t.Errorf("output has %q:\n%s", tc.without, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// Versions written when SERVERS_JSON_PATH doesn't exist yet, matching the
+// format gluetun's bundled list uses.
+const (
+	serversJSONVersion  = 1
+	protonServerVersion = 4
+)
+
+// serversJSONReload is set when the synced list holds servers gluetun is
+// configured for but its previous list lacked.
+var serversJSONReload atomic.Bool
+
+// gluetunServer is one entry of the protonvpn list in gluetun's servers.json.
+type gluetunServer struct {
+	VPN         string   `json:"vpn"`
+	Country     string   `json:"country,omitempty"`
+	City        string   `json:"city,omitempty"`
+	ServerName  string   `json:"server_name,omitempty"`
+	Hostname    string   `json:"hostname"`
+	TCP         bool     `json:"tcp,omitempty"`
+	UDP         bool     `json:"udp,omitempty"`
+	WgPubKey    string   `json:"wgpubkey,omitempty"`
+	Free        bool     `json:"free,omitempty"`
+	Stream      bool     `json:"stream,omitempty"`
+	SecureCore  bool     `json:"secure_core,omitempty"`
+	Tor         bool     `json:"tor,omitempty"`
+	PortForward bool     `json:"port_forward,omitempty"`
+	IPs         []string `json:"ips"`
+}
+
+type gluetunProviderServers struct {
+	Version   int             `json:"version"`
+	Timestamp int64           `json:"timestamp"`
+	Servers   []gluetunServer `json:"servers"`
+}
+
+// gluetunServers converts the live server list into gluetun's entries: one
+// WireGuard and one OpenVPN entry per physical server that is up. Country
+// names, which the API doesn't return, are taken from the previous list.
+func gluetunServers(servers []LogicalServer, previous []gluetunServer) []gluetunServer {
+	known := make(map[string]string)
+	for _, s := range previous {
+		known[s.Hostname] = s.Country
+	}
+	countries := make(map[string]string)
+	for _, l := range servers {
+		for _, s := range l.Servers {
+			if name := known[s.Domain]; name != "" {
+				countries[l.ExitCountry] = name
+			}
+		}
+	}
+
+	var entries []gluetunServer
+	for _, l := range servers {
+		if l.Status != 1 {
+			continue
+		}
+		for _, s := range l.Servers {
+			if s.Status == 0 || s.Domain == "" || s.EntryIP == "" {
+				continue
+			}
+			base := gluetunServer{
+				Country:     cmp.Or(countries[l.ExitCountry], l.ExitCountry),
+				City:        l.City,
+				ServerName:  l.Name,
+				Hostname:    s.Domain,
+				Free:        l.Tier == 0,
+				Stream:      l.Features&protonapi.FeatureStreaming != 0,
+				SecureCore:  l.Features&protonapi.FeatureSecureCore != 0,
+				Tor:         l.Features&protonapi.FeatureTor != 0,
+				PortForward: l.Features&protonapi.FeatureP2P != 0,
+				IPs:         []string{s.EntryIP},
+			}
+			if s.X25519PublicKey != "" {
+				wg := base
+				wg.VPN, wg.WgPubKey = "wireguard", s.X25519PublicKey
+				entries = append(entries, wg)
+			}
+			ovpn := base
+			ovpn.VPN, ovpn.TCP, ovpn.UDP = "openvpn", true, true
+			entries = append(entries, ovpn)
+		}
+	}
+	slices.SortFunc(entries, func(a, b gluetunServer) int {
+		if c := strings.Compare(a.Hostname, b.Hostname); c != 0 {
+			return c
+		}
+		return strings.Compare(a.VPN, b.VPN)
+	})
+	return entries
+}
+
+// syncServersJSON replaces the protonvpn list in SERVERS_JSON_PATH with the
+// live server list, keeping other providers' lists as they are. The file is
+// only rewritten when a server was added, removed or changed, and its
+// timestamp is set to now so gluetun prefers it over its bundled list.
+func syncServersJSON(servers []LogicalServer) (bool, error) {
+	if cfg.serversJSONPath == "" || len(servers) == 0 {
+		return false, nil
+	}
+	file := map[string]json.RawMessage{}
+	data, err := os.ReadFile(cfg.serversJSONPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		file["version"], _ = json.Marshal(serversJSONVersion)
+	case err != nil:
+		return false, err
+	default:
+		if err := json.Unmarshal(data, &file); err != nil {
+			return false, fmt.Errorf("%s: %w", cfg.serversJSONPath, err)
+		}
+	}
+	proton := gluetunProviderServers{Version: protonServerVersion}
+	if raw, ok := file["protonvpn"]; ok {
+		if err := json.Unmarshal(raw, &proton); err != nil {
+			return false, fmt.Errorf("%s: protonvpn: %w", cfg.serversJSONPath, err)
+		}
+	}
+
+	fresh := gluetunServers(servers, proton.Servers)
+	old, _ := json.Marshal(proton.Servers)
+	updated, _ := json.Marshal(fresh)
+	if string(old) == string(updated) {
+		return false, nil
+	}
+	if missingConfiguredHosts(proton.Servers, fresh) {
+		serversJSONReload.Store(true)
+	}
+	proton.Timestamp, proton.Servers = time.Now().Unix(), fresh
+	if file["protonvpn"], err = json.Marshal(proton); err != nil {
+		return false, err
+	}
+	out, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	// Replace rather than rewrite, so gluetun never reads a partial file
+	tmp := cfg.serversJSONPath + ".tmp"
+	if err := os.WriteFile(tmp, append(out, '\n'), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, cfg.serversJSONPath)
+}
+
+// missingConfiguredHosts reports whether a hostname gluetun is configured
+// to select was absent from its previous list and is in the new one.
+func missingConfiguredHosts(previous, fresh []gluetunServer) bool {
+	hosts := splitList(readEnvFile()["SERVER_HOSTNAMES"])
+	has := func(list []gluetunServer, host string) bool {
+		return slices.ContainsFunc(list, func(s gluetunServer) bool { return strings.EqualFold(s.Hostname, host) })
+	}
+	return slices.ContainsFunc(hosts, func(h string) bool { return !has(previous, h) && has(fresh, h) })
+}
+
+// serversJSONProblems reports SERVERS_JSON_PATH settings that can't work.
+func serversJSONProblems() []string {
+	if cfg.serversJSONPath == "" {
+		return nil
+	}
+	info, err := os.Stat(getDir(cfg.serversJSONPath))
+	if err != nil || !info.IsDir() {
+		return []string{fmt.Sprintf("SERVERS_JSON_PATH directory %s does not exist; mount gluetun's /gluetun volume", getDir(cfg.serversJSONPath))}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gluetun-proton-manager/envfile"
+)
+
+func TestSyncServersJSON(t *testing.T) {
+	setupTestEnv(t, "CH#4")
+	cfg.serversJSONPath = filepath.Join(t.TempDir(), "servers.json")
+	old := `{"version":1,"mullvad":{"version":1,"servers":[]},"protonvpn":{"version":4,"timestamp":1,"servers":[` +
+		`{"vpn":"wireguard","country":"Switzerland","hostname":"node-ch-04.protonvpn.net","ips":["10.0.0.9"]}]}}`
+	if err := os.WriteFile(cfg.serversJSONPath, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := envfile.Update(cfg.envFile, map[string]string{"SERVER_HOSTNAMES": "node-ch-05.protonvpn.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := []LogicalServer{*providerTestServer()}
+	if changed, err := syncServersJSON(servers); err != nil || !changed {
+		t.Fatalf("sync = %v, %v; want changed", changed, err)
+	}
+	if !serversJSONReload.Swap(false) {
+		t.Error("gluetun's list lacked node-ch-05 but no reload was requested")
+	}
+
+	var file struct {
+		Mullvad   json.RawMessage        `json:"mullvad"`
+		ProtonVPN gluetunProviderServers `json:"protonvpn"`
+	}
+	data, _ := os.ReadFile(cfg.serversJSONPath)
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	if file.Mullvad == nil {
+		t.Error("other providers' lists were dropped")
+	}
+	p := file.ProtonVPN
+	if p.Version != 4 || p.Timestamp <= 1 {
+		t.Errorf("version %d, timestamp %d", p.Version, p.Timestamp)
+	}
+	// Two live physical servers, each with a WireGuard and an OpenVPN entry
+	if len(p.Servers) != 4 {
+		t.Fatalf("got %d entries: %+v", len(p.Servers), p.Servers)
+	}
+	wg := p.Servers[1]
+	if wg.VPN != "wireguard" || wg.Hostname != "node-ch-04.protonvpn.net" || wg.Country != "Switzerland" ||
+		wg.City != "Zurich" || wg.WgPubKey != "key1" || wg.IPs[0] != "10.0.0.1" {
+		t.Errorf("wireguard entry %+v", wg)
+	}
+
+	// An unchanged list isn't rewritten
+	if changed, err := syncServersJSON(servers); err != nil || changed {
+		t.Errorf("second sync = %v, %v; want unchanged", changed, err)
+	}
+}
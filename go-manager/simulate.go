@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// The simulate subcommand replays recorded server lists through the daemon's
+// selection and switching rules, so LOAD_SWITCH_THRESHOLD can be tuned
+// against real load data before deploying it. The snapshot subcommand
+// records those lists.
+
+// simResult is the outcome of replaying the snapshots with one threshold.
+type simResult struct {
+	threshold     int
+	optimizations int // switches of a working server for a better one
+	failovers     int // switches forced by the server disappearing
+	loadSum       int
+	steps         int
+	log           []string
+}
+
+func (r simResult) switches() int { return r.optimizations + r.failovers }
+
+func runSimulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fixture := fs.String("fixture", "", "Recorded server lists: one /vpn/logicals response, a JSON array of them, or one per line")
+	hours := fs.Float64("hours", 24, "Hours of recording to replay, 0 for all of it")
+	thresholdList := fs.String("threshold", strconv.Itoa(cfg.loadThreshold), "Load switch thresholds to compare, comma separated")
+	interval := fs.Int("interval", cfg.loadCheckInterval, "Seconds between snapshots that have no recorded time")
+	start := fs.String("start", "", "Server connected at the start (default: the best of the first snapshot)")
+	verbose := fs.Bool("v", false, "List every switch")
+	fs.Parse(args)
+
+	if *fixture == "" {
+		fmt.Fprintln(os.Stderr, "simulate: --fixture is required")
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+	if targetTiersErr != nil {
+		log(fmt.Sprintf("Invalid target configuration: %v", targetTiersErr))
+		os.Exit(exitConfig)
+	}
+	var thresholds []int
+	for _, field := range strings.Split(*thresholdList, ",") {
+		t, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || t < 0 {
+			log(fmt.Sprintf("Invalid threshold %q", field))
+			os.Exit(exitUsage)
+		}
+		thresholds = append(thresholds, t)
+	}
+
+	snapshots, err := protonapi.LoadSnapshots(*fixture)
+	if err != nil {
+		log(fmt.Sprintf("Failed to load fixture: %v", err))
+		os.Exit(exitFailure)
+	}
+	snapshots = replayWindow(snapshots, time.Duration(*interval)*time.Second, time.Duration(*hours*float64(time.Hour)))
+	if len(snapshots) == 0 {
+		log("The fixture holds no snapshots")
+		os.Exit(exitFailure)
+	}
+
+	first := *start
+	if first == "" {
+		best, _ := findBestServer(snapshots[0].LogicalServers, "")
+		if best == nil {
+			log("No suitable server in the first snapshot")
+			os.Exit(exitNoCandidates)
+		}
+		first = best.Name
+	}
+
+	span := snapshots[len(snapshots)-1].Time.Sub(snapshots[0].Time)
+	fmt.Printf("Replaying %d snapshots over %s (%s to %s), starting on %s\n",
+		len(snapshots), span.Round(time.Minute),
+		snapshots[0].Time.Format("2006-01-02 15:04"), snapshots[len(snapshots)-1].Time.Format("2006-01-02 15:04"), first)
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("%-10s %-10s %-14s %-10s %-10s\n", "THRESHOLD", "SWITCHES", "OPTIMIZATIONS", "FAILOVERS", "AVG LOAD")
+	fmt.Println("------------------------------------------------------------")
+
+	var results []simResult
+	for _, t := range thresholds {
+		r := simulate(snapshots, first, t)
+		results = append(results, r)
+		label := strconv.Itoa(t)
+		if t == cfg.loadThreshold {
+			label += "*"
+		}
+		fmt.Printf("%-10s %-10d %-14d %-10d %d%%\n", label, r.switches(), r.optimizations, r.failovers, r.loadSum/max(r.steps, 1))
+	}
+	fmt.Println("------------------------------------------------------------")
+	fmt.Printf("* current LOAD_SWITCH_THRESHOLD. Each snapshot counts as one load check.\n")
+
+	if *verbose {
+		for _, r := range results {
+			fmt.Printf("\nThreshold %d:\n", r.threshold)
+			for _, line := range r.log {
+				fmt.Println("  " + line)
+			}
+		}
+	}
+}
+
+// replayWindow gives untimed snapshots a time interval apart and keeps those
+// within the first window of the recording (all of them if window is 0).
+func replayWindow(snapshots []protonapi.Snapshot, interval, window time.Duration) []protonapi.Snapshot {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	base := snapshots[0].Time
+	if base.IsZero() {
+		base = time.Now().Truncate(time.Minute)
+	}
+	var kept []protonapi.Snapshot
+	for i, s := range snapshots {
+		if s.Time.IsZero() {
+			s.Time = base.Add(time.Duration(i) * interval)
+		}
+		if window > 0 && s.Time.Sub(base) > window {
+			break
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
+
+// simulate applies the daemon's decision to each snapshot in turn, as if the
+// connection stayed healthy as long as its server was listed and eligible.
+func simulate(snapshots []protonapi.Snapshot, start string, threshold int) simResult {
+	r := simResult{threshold: threshold}
+	current := start
+	for _, snap := range snapshots {
+		servers := snap.LogicalServers
+		best, currentLoad := findBestServer(servers, current)
+
+		reason := ""
+		if best != nil && best.Name != current {
+			if s := protonapi.FindByName(servers, current); s == nil || !eligible(*s) {
+				reason = "Server unavailable"
+				r.failovers++
+			} else if reason = optimizationReason(servers, current, best, currentLoad, threshold); reason != "" {
+				r.optimizations++
+			}
+		}
+		if reason != "" {
+			r.log = append(r.log, fmt.Sprintf("%s  %s -> %s  %s", snap.Time.Format("01-02 15:04"), current, best.Name, reason))
+			current, currentLoad = best.Name, best.Load
+		}
+		r.loadSum += currentLoad
+		r.steps++
+	}
+	return r
+}
+
+func runSnapshot(pm *ProtonManager, args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	out := fs.String("out", filepath.Join(cfg.cacheDir, "snapshots.ndjson"), "File to append the snapshot to")
+	fs.Parse(args)
+
+	servers, err := pm.Servers()
+	if err != nil {
+		log(fmt.Sprintf("Error fetching servers: %v", err))
+		os.Exit(exitCode(err))
+	}
+
+	// Keep what selection looks at, which is a small part of the full list
+	kept := targetServers(servers)
+	for i := range kept {
+		kept[i].Servers = nil
+	}
+	line, _ := json.Marshal(protonapi.Snapshot{Time: time.Now().UTC().Truncate(time.Second), LogicalServers: kept})
+
+	f, err := os.OpenFile(*out, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log(fmt.Sprintf("Failed to open %s: %v", *out, err))
+		os.Exit(exitFailure)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log(fmt.Sprintf("Failed to write %s: %v", *out, err))
+		os.Exit(exitFailure)
+	}
+	log(fmt.Sprintf("Appended %d servers to %s", len(kept), *out))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/selector"
+)
+
+func TestSimulateThresholds(t *testing.T) {
+	setupTestEnv(t, "CH#1")
+	cfg.targetTiers = []selector.Tier{{Name: "CH", Countries: []string{"CH"}}}
+	snapshots, err := protonapi.LoadSnapshots(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		threshold, switches int
+		final               string
+	}{
+		{threshold: 20, switches: 3, final: "CH#4"},
+		{threshold: 40, switches: 1, final: "CH#2"},
+		{threshold: 60, switches: 0},
+	} {
+		r := simulate(snapshots, "CH#1", tc.threshold)
+		if r.switches() != tc.switches || r.failovers != 0 {
+			t.Errorf("threshold %d: %d switches (%d failovers), want %d optimizations", tc.threshold, r.switches(), r.failovers, tc.switches)
+		}
+		if tc.final != "" && len(r.log) > 0 && !strings.Contains(r.log[len(r.log)-1], "-> "+tc.final) {
+			t.Errorf("threshold %d: last switch %q, want one to %s", tc.threshold, r.log[len(r.log)-1], tc.final)
+		}
+	}
+}
+
+func TestSimulateFailsOverFromMissingServer(t *testing.T) {
+	setupTestEnv(t, "CH#9")
+	cfg.targetTiers = []selector.Tier{{Name: "CH", Countries: []string{"CH"}}}
+	snapshots, err := protonapi.LoadSnapshots(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := simulate(snapshots[:1], "CH#9", 100)
+	if r.failovers != 1 {
+		t.Errorf("%d failovers, want 1", r.failovers)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	snapshots := make([]protonapi.Snapshot, 10)
+	kept := replayWindow(snapshots, 15*time.Minute, time.Hour)
+	if len(kept) != 5 {
+		t.Fatalf("kept %d snapshots, want 5", len(kept))
+	}
+	if d := kept[4].Time.Sub(kept[0].Time); d != time.Hour {
+		t.Errorf("window spans %s, want 1h", d)
+	}
+}
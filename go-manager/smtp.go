@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// smtpNotifier emails alerts. Repeats are already coalesced by alertManager.
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+}
+
+func newSMTPNotifier() *smtpNotifier {
+	n := &smtpNotifier{addr: net.JoinHostPort(cfg.smtpHost, fmt.Sprint(cfg.smtpPort))}
+	if cfg.smtpUsername != "" {
+		n.auth = smtp.PlainAuth("", cfg.smtpUsername, cfg.smtpPassword, cfg.smtpHost)
+	}
+	return n
+}
+
+func (n *smtpNotifier) Name() string { return "email" }
+
+func (n *smtpNotifier) Send(a alert) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.smtpFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(cfg.smtpTo, ", "))
+	fmt.Fprintf(&msg, "Subject: [%s] %s\r\n", cfg.gluetunContainer, a.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", a.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(a.Body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	// Port 465 speaks TLS from the start; others upgrade with STARTTLS
+	if cfg.smtpPort == 465 {
+		return n.sendImplicitTLS([]byte(msg.String()))
+	}
+	return smtp.SendMail(n.addr, n.auth, cfg.smtpFrom, cfg.smtpTo, []byte(msg.String()))
+}
+
+func (n *smtpNotifier) sendImplicitTLS(msg []byte) error {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", n.addr, &tls.Config{ServerName: cfg.smtpHost})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, cfg.smtpHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if n.auth != nil {
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.smtpFrom); err != nil {
+		return err
+	}
+	for _, rcpt := range cfg.smtpTo {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMail is one message as a mail server receives it.
+type smtpMail struct {
+	auth string // decoded AUTH PLAIN credentials
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer runs a plain-text mail server that accepts every message
+// and passes it on, and points the SMTP settings at it.
+func startSMTPServer(t *testing.T) <-chan smtpMail {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	mails := make(chan smtpMail, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	cfg.smtpHost = host
+	cfg.smtpPort, _ = strconv.Atoi(port)
+	return mails
+}
+
+func serveSMTP(conn net.Conn, mails chan<- smtpMail) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+	reply("220 localhost ESMTP")
+	var m smtpMail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0])
+		switch {
+		case verb == "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(strings.ToUpper(cmd), "AUTH PLAIN "):
+			creds, _ := base64.StdEncoding.DecodeString(cmd[len("AUTH PLAIN "):])
+			m.auth = strings.ReplaceAll(strings.TrimPrefix(string(creds), "\x00"), "\x00", ":")
+			reply("235 OK")
+		case verb == "MAIL":
+			m.from = strings.Trim(strings.TrimPrefix(cmd, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case verb == "RCPT":
+			m.to = append(m.to, strings.Trim(strings.TrimPrefix(cmd, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case verb == "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m.data = data.String()
+			mails <- m
+			m = smtpMail{}
+			reply("250 OK")
+		case verb == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPNotifierSend(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	mails := startSMTPServer(t)
+	cfg.smtpUsername, cfg.smtpPassword = "alerts@example.com", "app-password"
+	cfg.smtpFrom, cfg.smtpTo = "alerts@example.com", []string{"ops@example.com", "me@example.com"}
+
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	err := newSMTPNotifier().Send(alert{Kind: alertUnhealthy, Subject: "VPN tunnel unhealthy", Body: "No traffic for 10m.\nFailovers: 3", Time: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := <-mails
+	if m.auth != "alerts@example.com:app-password" {
+		t.Errorf("authenticated as %q", m.auth)
+	}
+	if m.from != "alerts@example.com" || strings.Join(m.to, ",") != "ops@example.com,me@example.com" {
+		t.Errorf("envelope from %q to %v", m.from, m.to)
+	}
+	want := "From: alerts@example.com\r\n" +
+		"To: ops@example.com, me@example.com\r\n" +
+		"Subject: [gluetun] VPN tunnel unhealthy\r\n" +
+		"Date: Fri, 16 Oct 2026 09:30:00 +0000\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"No traffic for 10m.\r\nFailovers: 3\r\n"
+	if m.data != want {
+		t.Errorf("message =\n%q\nwant\n%q", m.data, want)
+	}
+}
+
+func TestSMTPNotifierOnlyGetsAlerts(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	mails := startSMTPServer(t)
+	cfg.smtpFrom, cfg.smtpTo = "alerts@example.com", []string{"ops@example.com"}
+	setupNotifiers()
+	t.Cleanup(func() { notifiers = nil })
+	if len(notifiers) != 1 || notifiers[0].Name() != "email" {
+		t.Fatalf("notifiers = %v, want email", notifiers)
+	}
+
+	// A routine switch for load is logged, not emailed.
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true), notifiers...)
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.appliedNames()) != 1 {
+		t.Fatalf("applied %v, want a switch", rt.appliedNames())
+	}
+	flushNotifications(5 * time.Second)
+	select {
+	case m := <-mails:
+		t.Fatalf("emailed a routine switch: %q", m.data)
+	default:
+	}
+
+	// One that needs a human is.
+	notify(alertSwitchFailure, "Server switches keep failing", "3 switches failed in a row.")
+	flushNotifications(5 * time.Second)
+	select {
+	case m := <-mails:
+		if !strings.Contains(m.data, "Subject: [gluetun] Server switches keep failing\r\n") {
+			t.Errorf("message = %q", m.data)
+		}
+	default:
+		t.Error("switch failure alert not emailed")
+	}
+}
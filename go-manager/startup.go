@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/protonapi"
+)
+
+// SWITCH_ON_START decides whether the manager may switch servers before its
+// first regular load check, so restarting it doesn't rotate a working tunnel.
+const (
+	switchOnStartNever       = "never"        // keep the server until the first regular check
+	switchOnStartIfUnhealthy = "if-unhealthy" // adopt a usable server, switch away from a failing one
+	switchOnStartAlways      = "always"       // optimize right away
+)
+
+// startingUp reports whether the daemon is still before its first regular
+// load check.
+func (d *daemon) startingUp() bool {
+	return time.Now().Before(d.startupUntil)
+}
+
+// holdOnStart reports whether SWITCH_ON_START=never keeps the current
+// server for now, logging it.
+func (d *daemon) holdOnStart(what string) bool {
+	if d.cfg.switchOnStart != switchOnStartNever || !d.startingUp() {
+		return false
+	}
+	log(fmt.Sprintf("Skipping %s until %s (SWITCH_ON_START=%s)", what, d.startupUntil.Format("15:04:05"), d.cfg.switchOnStart))
+	return true
+}
+
+// adoptOnStart reports whether a healthy current server is kept instead of
+// being optimized away: with SWITCH_ON_START=if-unhealthy, until the first
+// regular load check, as long as the server is still usable.
+func (d *daemon) adoptOnStart(servers []LogicalServer, currentName string) bool {
+	return d.cfg.switchOnStart == switchOnStartIfUnhealthy && d.startingUp() &&
+		unusableReason(protonapi.FindByName(servers, currentName)) == ""
+}
+
+// startupProblems reports SWITCH_ON_START values that can't work.
+func startupProblems() []string {
+	switch cfg.switchOnStart {
+	case switchOnStartNever, switchOnStartIfUnhealthy, switchOnStartAlways:
+		return nil
+	}
+	return []string{fmt.Sprintf("SWITCH_ON_START must be %s, %s or %s, got %q",
+		switchOnStartNever, switchOnStartIfUnhealthy, switchOnStartAlways, cfg.switchOnStart)}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSwitchOnStart(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		healthy  bool
+		starting bool
+		want     []string
+	}{
+		{switchOnStartIfUnhealthy, true, true, nil},
+		{switchOnStartIfUnhealthy, false, true, []string{"US#2"}},
+		{switchOnStartIfUnhealthy, true, false, []string{"US#2"}},
+		{switchOnStartNever, false, true, nil},
+		{switchOnStartNever, false, false, []string{"US#2"}},
+		{switchOnStartAlways, true, true, []string{"US#2"}},
+	} {
+		setupTestEnv(t, "US#1")
+		cfg.switchOnStart = tc.mode
+		rt := newMockRuntime(t)
+		// US#1 is 40 points busier than US#2
+		servers := testServers()
+		servers[0].Servers = []Server{{EntryIP: "192.0.2.1", X25519PublicKey: "key", Status: 1}}
+		d := newTestDaemon(newMockServerSource(t, servers...), rt, newMockHealth(t, tc.healthy, true))
+		if tc.starting {
+			d.startupUntil = time.Now().Add(time.Minute)
+		}
+		if err := d.checkLoad(); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(rt.applied, tc.want) {
+			t.Errorf("%s, healthy %v, starting %v: applied %v, want %v", tc.mode, tc.healthy, tc.starting, rt.applied, tc.want)
+		}
+	}
+}
+
+func TestSwitchOnStartReplacesUnusableServer(t *testing.T) {
+	setupTestEnv(t, "US#3") // inactive
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+	d.startupUntil = time.Now().Add(time.Minute)
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2] in place of the inactive US#3", rt.applied)
+	}
+}
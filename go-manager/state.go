@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is what the daemon's subsystems share about the tunnel: the server
+// the manager last wrote to the env file, when and why it last switched, the
+// run of health checks and the pinned server. It lives in the state store,
+// so reads and writes go through its lock and every change is saved.
+type State struct {
+	// Server is the server the manager itself last wrote, used to tell its
+	// own writes apart from human edits
+	Server           string    `json:"server,omitempty"`
+	LastSwitch       time.Time `json:"last_switch,omitzero"`
+	LastSwitchReason string    `json:"last_switch_reason,omitempty"`
+	// HealthStreak counts consecutive health checks: passed ones up from 1,
+	// failed ones down from -1
+	HealthStreak int `json:"health_streak,omitempty"`
+	// Pinned is exempt from load-optimization switches
+	Pinned string `json:"pinned,omitempty"`
+	// LastTrigger is when the trigger webhook last accepted a request, for
+	// TRIGGER_COOLDOWN
+	LastTrigger time.Time `json:"last_trigger,omitzero"`
+}
+
+// state returns a copy of the shared state.
+func (s *Store) state() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.State
+}
+
+// updateState applies fn to the shared state and saves it if that changed
+// anything. A health streak that only grows is saved with the next other
+// change, so a steady tunnel doesn't rewrite the file on every check.
+func (s *Store) updateState(fn func(*State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.State
+	fn(&s.State)
+	after := s.State
+	before.HealthStreak, after.HealthStreak = sign(before.HealthStreak), sign(after.HealthStreak)
+	if after != before {
+		s.save()
+	}
+}
+
+// resumeState picks up the state saved before a restart, so the pin and the
+// time of the last switch survive it. Both only carry over if the env file
+// still names the server the manager last wrote; after an edit while it was
+// down they no longer apply. Quarantines and the rest of the store are
+// persisted as they are.
+func (d *daemon) resumeState(current string) {
+	var st State
+	stateStore.updateState(func(s *State) {
+		if s.Server != current {
+			s.LastSwitch, s.LastSwitchReason, s.Pinned = time.Time{}, "", ""
+		}
+		s.Server = current
+		st = *s
+	})
+	if !st.LastSwitch.IsZero() {
+		msg := fmt.Sprintf("Resuming on %s, switched %s ago (%s)", current, time.Since(st.LastSwitch).Round(time.Second), st.LastSwitchReason)
+		if st.Pinned != "" {
+			msg += ", pinned"
+		}
+		log(msg)
+	} else if st.Pinned != "" {
+		log(fmt.Sprintf("Resuming on %s, pinned", current))
+	}
+	d.updateStatus(func(s *Status) {
+		s.Server, s.Pinned = st.Server, st.Pinned
+		s.LastSwitch, s.LastSwitchReason = st.LastSwitch, st.LastSwitchReason
+	})
+}
+
+// countHealth extends the health streak with a check's result.
+func (st *State) countHealth(healthy bool) {
+	if healthy {
+		st.HealthStreak = max(st.HealthStreak, 0) + 1
+	} else {
+		st.HealthStreak = min(st.HealthStreak, 0) - 1
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
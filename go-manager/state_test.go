@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := loadStore(path)
+	switched := time.Now().Truncate(time.Second)
+	s.updateState(func(st *State) {
+		st.Server, st.Pinned = "CH#4", "CH#4"
+		st.LastSwitch, st.LastSwitchReason = switched, "Unhealthy Connection"
+	})
+	s.updateState(func(st *State) { st.countHealth(false) })
+
+	got := loadStore(path).state()
+	want := State{Server: "CH#4", Pinned: "CH#4", LastSwitch: switched, LastSwitchReason: "Unhealthy Connection", HealthStreak: -1}
+	if !got.LastSwitch.Equal(want.LastSwitch) {
+		t.Errorf("last switch = %v, want %v", got.LastSwitch, want.LastSwitch)
+	}
+	got.LastSwitch = want.LastSwitch
+	if got != want {
+		t.Errorf("reloaded state = %+v, want %+v", got, want)
+	}
+
+	// A growing streak waits for the next change to be saved
+	s.updateState(func(st *State) { st.countHealth(true) })
+	s.updateState(func(st *State) { st.countHealth(true) })
+	if streak := s.state().HealthStreak; streak != 2 {
+		t.Errorf("streak = %d, want 2", streak)
+	}
+	if streak := loadStore(path).state().HealthStreak; streak != 1 {
+		t.Errorf("saved streak = %d, want 1 from the flip to healthy", streak)
+	}
+}
+
+func TestStateConcurrentUpdates(t *testing.T) {
+	s := loadStore(filepath.Join(t.TempDir(), "state.json"))
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			for range 10 {
+				s.updateState(func(st *State) { st.countHealth(true) })
+				_ = s.state().Server
+			}
+		})
+	}
+	wg.Wait()
+	if streak := s.state().HealthStreak; streak != 200 {
+		t.Errorf("streak = %d, want 200", streak)
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	switched := time.Now().Add(-time.Hour)
+	stateStore.updateState(func(st *State) {
+		st.Server, st.Pinned = "US#1", "US#1"
+		st.LastSwitch, st.LastSwitchReason = switched, "Load Optimization"
+	})
+	stateStore.recordFailure("US#2", "unhealthy connection")
+	stateStore = loadStore(stateStore.path)
+
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	d.resumeState("US#1")
+	st := d.status
+	if st.Server != "US#1" || st.Pinned != "US#1" || !st.LastSwitch.Equal(switched) || st.LastSwitchReason != "Load Optimization" {
+		t.Errorf("resumed status = %+v", st)
+	}
+	if len(stateStore.Servers["US#2"].Failures) != 1 {
+		t.Error("lost the failure history")
+	}
+
+	// Edited while the manager was down: the pin and switch belonged to US#1
+	d = newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	d.resumeState("US#3")
+	if got := stateStore.state(); got.Server != "US#3" || got.Pinned != "" || !got.LastSwitch.IsZero() {
+		t.Errorf("state after an edit = %+v", got)
+	}
+	if d.status.Pinned != "" || !d.status.LastSwitch.IsZero() {
+		t.Errorf("status after an edit = %+v", d.status)
+	}
+}
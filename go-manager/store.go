@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is the manager's persistent local state, saved as JSON next to the
+// session file so it survives container restarts.
+type Store struct {
+	mu   sync.Mutex
+	path string
+
+	Servers      map[string]*ServerRecord `json:"servers"`
+	HostLocation *Location                `json:"host_location,omitempty"`
+
+	// DeadEndpoints maps unreachable entry IPs to when they may be retried
+	DeadEndpoints map[string]time.Time `json:"dead_endpoints,omitempty"`
+
+	// Current is the server of the open connection session, since CurrentSince
+	Current      string    `json:"current,omitempty"`
+	CurrentSince time.Time `json:"current_since,omitzero"`
+
+	// Recent lists the servers left behind, oldest first
+	Recent []RecentServer `json:"recent,omitempty"`
+
+	// ExitIPs lists the exit IPs seen, oldest first
+	ExitIPs []ExitIPRecord `json:"exit_ips,omitempty"`
+
+	// Health lists the tunnel's health changes, oldest first
+	Health []HealthRecord `json:"health,omitempty"`
+
+	// State is shared by the daemon's subsystems, see state.go
+	State State `json:"state"`
+}
+
+// ServerRecord tracks recent failures of a single logical server and its
+// history for reliability scoring.
+type ServerRecord struct {
+	Failures         []time.Time `json:"failures,omitempty"`
+	LastFailure      string      `json:"last_failure,omitempty"`
+	QuarantinedUntil time.Time   `json:"quarantined_until,omitempty"`
+
+	Connects        int     `json:"connects,omitempty"`
+	ConnectFailures int     `json:"connect_failures,omitempty"`
+	Drops           int     `json:"drops,omitempty"`
+	UptimeSeconds   int64   `json:"uptime_seconds,omitempty"`
+	ThroughputMbps  float64 `json:"throughput_mbps,omitempty"`
+
+	// HourlyLoad is the average load seen in each hour of the day
+	HourlyLoad    []float64 `json:"hourly_load,omitempty"`
+	HourlySamples []int     `json:"hourly_samples,omitempty"`
+}
+
+var stateStore *Store
+
+// loadStore reads the store from disk, starting empty if it doesn't exist or
+// can't be parsed.
+func loadStore(path string) *Store {
+	s := &Store{path: path, Servers: make(map[string]*ServerRecord)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log(fmt.Sprintf("Failed to read state store: %v", err))
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		log(fmt.Sprintf("Failed to parse state store, starting fresh: %v", err))
+		s.Servers = make(map[string]*ServerRecord)
+	}
+	if s.Servers == nil {
+		s.Servers = make(map[string]*ServerRecord)
+	}
+	return s
+}
+
+// save writes the store atomically. Callers hold mu.
+func (s *Store) save() {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		log(fmt.Sprintf("Failed to encode state store: %v", err))
+		return
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		log(fmt.Sprintf("Failed to save state store: %v", err))
+		return
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		log(fmt.Sprintf("Failed to save state store: %v", err))
+	}
+}
+
+func (s *Store) record(name string) *ServerRecord {
+	rec, ok := s.Servers[name]
+	if !ok {
+		rec = &ServerRecord{}
+		s.Servers[name] = rec
+	}
+	return rec
+}
+
+// recordFailure counts a failure against a server and quarantines it once it
+// has failed quarantineThreshold times within quarantineWindow. It returns
+// true if this failure tripped the quarantine.
+func (s *Store) recordFailure(name, reason string) bool {
+	if name == "" {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	window := time.Duration(cfg.quarantineWindow) * time.Second
+	rec := s.record(name)
+
+	// Drop failures that fell out of the window
+	recent := rec.Failures[:0]
+	for _, t := range rec.Failures {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	rec.Failures = append(recent, now)
+	rec.LastFailure = reason
+
+	tripped := false
+	if cfg.quarantineThreshold > 0 && len(rec.Failures) >= cfg.quarantineThreshold {
+		rec.QuarantinedUntil = now.Add(time.Duration(cfg.quarantineDuration) * time.Second)
+		rec.Failures = nil
+		tripped = true
+		log(fmt.Sprintf("Quarantining %s until %s (%s)", name, rec.QuarantinedUntil.Format("2006-01-02 15:04:05"), reason))
+	}
+	s.save()
+	return tripped
+}
+
+// isQuarantined reports whether a server is currently quarantined.
+func (s *Store) isQuarantined(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.Servers[name]
+	return ok && time.Now().Before(rec.QuarantinedUntil)
+}
+
+// quarantined lists currently quarantined servers, sorted by name.
+func (s *Store) quarantined() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name, rec := range s.Servers {
+		if time.Now().Before(rec.QuarantinedUntil) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hostLocation returns the last geolocated host location, if any.
+func (s *Store) hostLocation() *Location {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.HostLocation == nil {
+		return nil
+	}
+	loc := *s.HostLocation
+	return &loc
+}
+
+func (s *Store) setHostLocation(loc Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.HostLocation = &loc
+	s.save()
+}
+
+// markEndpointDead skips an entry IP for endpointDeadFor seconds.
+func (s *Store) markEndpointDead(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.DeadEndpoints == nil {
+		s.DeadEndpoints = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for addr, until := range s.DeadEndpoints {
+		if now.After(until) {
+			delete(s.DeadEndpoints, addr)
+		}
+	}
+	s.DeadEndpoints[ip] = now.Add(time.Duration(cfg.endpointDeadFor) * time.Second)
+	s.save()
+}
+
+func (s *Store) isEndpointDead(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.DeadEndpoints[ip]
+	return ok && time.Now().Before(until)
+}
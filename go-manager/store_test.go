@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecordFailureQuarantines(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		threshold int
+		earlier   []time.Duration // ages of failures already recorded
+		want      bool
+	}{
+		{"first failure", 3, nil, false},
+		{"reaches threshold", 3, []time.Duration{time.Minute, 10 * time.Minute}, true},
+		{"old failures expired", 3, []time.Duration{2 * time.Hour, 3 * time.Hour}, false},
+		{"one expired", 3, []time.Duration{time.Minute, 2 * time.Hour}, false},
+		{"threshold of one", 1, nil, true},
+		{"disabled", 0, []time.Duration{time.Minute, time.Minute, time.Minute}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestEnv(t, "US#1")
+			cfg.quarantineThreshold, cfg.quarantineWindow, cfg.quarantineDuration = tc.threshold, 3600, 600
+			rec := stateStore.record("US#2")
+			for _, age := range tc.earlier {
+				rec.Failures = append(rec.Failures, time.Now().Add(-age))
+			}
+
+			if tripped := stateStore.recordFailure("US#2", "unhealthy connection"); tripped != tc.want {
+				t.Errorf("recordFailure tripped = %v, want %v", tripped, tc.want)
+			}
+			if got := stateStore.isQuarantined("US#2"); got != tc.want {
+				t.Errorf("isQuarantined = %v, want %v", got, tc.want)
+			}
+			if rec.LastFailure != "unhealthy connection" {
+				t.Errorf("last failure = %q", rec.LastFailure)
+			}
+			// Tripping starts the count over; otherwise only the window is kept
+			wantFailures := 1
+			for _, age := range tc.earlier {
+				if age < time.Hour {
+					wantFailures++
+				}
+			}
+			if tc.want {
+				wantFailures = 0
+			}
+			if len(rec.Failures) != wantFailures {
+				t.Errorf("%d failures kept, want %d", len(rec.Failures), wantFailures)
+			}
+		})
+	}
+}
+
+func TestQuarantineExpiresAndPersists(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.quarantineThreshold, cfg.quarantineDuration = 1, 600
+	if stateStore.recordFailure("", "no server") {
+		t.Error("quarantined an unnamed server")
+	}
+	stateStore.record("CH#1").QuarantinedUntil = time.Now().Add(-time.Second)
+	stateStore.recordFailure("US#3", "unhealthy connection")
+	stateStore.recordFailure("US#2", "unhealthy connection")
+
+	stateStore = loadStore(stateStore.path)
+	if got := stateStore.quarantined(); !slices.Equal(got, []string{"US#2", "US#3"}) {
+		t.Errorf("quarantined after reload = %v, want US#2 and US#3", got)
+	}
+	if stateStore.isQuarantined("CH#1") || stateStore.isQuarantined("DE#1") {
+		t.Error("expired or unknown server quarantined")
+	}
+	until := stateStore.Servers["US#2"].QuarantinedUntil
+	if d := time.Until(until); d < 590*time.Second || d > 600*time.Second {
+		t.Errorf("quarantined for %s, want QUARANTINE_DURATION", d)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/selector"
+)
+
+var targetTiersErr error
+
+// eligible applies the filters every tier shares: the server is active, has
+// the REQUIRED_FEATURES (and IPv6 with IPV6=require), exits in a TARGET_EXIT_COUNTRY if set, isn't
+// excluded as virtual and passes SELECTION_FILTER. Tiers match
+// on the entry country, which differs from the exit for Secure Core servers.
+func eligible(s LogicalServer) bool {
+	if s.Status != 1 || (cfg.excludeVirtual && s.IsVirtual()) || s.Features&cfg.requiredFeatures != cfg.requiredFeatures || !ipv6Eligible(s) {
+		return false
+	}
+	if len(cfg.targetExitCountries) > 0 && !slices.ContainsFunc(cfg.targetExitCountries, func(c string) bool {
+		return strings.EqualFold(s.ExitCountry, c)
+	}) {
+		return false
+	}
+	if cfg.selectionFilter == nil {
+		return true
+	}
+	// A server the filter can't be evaluated for isn't known to pass it
+	ok, err := cfg.selectionFilter.Match(s)
+	return err == nil && ok
+}
+
+// compileSelectionExprs compiles SELECTION_FILTER and SELECTION_SCORE. Unset
+// ones stay nil.
+func compileSelectionExprs(filter, score string) (*selector.Expr, *selector.Expr, error) {
+	var f, sc *selector.Expr
+	var err error
+	if filter != "" {
+		if f, err = selector.CompileFilter(filter); err != nil {
+			return nil, nil, fmt.Errorf("SELECTION_FILTER: %v", err)
+		}
+	}
+	if score != "" {
+		if sc, err = selector.CompileScore(score); err != nil {
+			return nil, nil, fmt.Errorf("SELECTION_SCORE: %v", err)
+		}
+	}
+	return f, sc, nil
+}
+
+// selectionScorePenalty is SELECTION_SCORE for s, or 0 without one or if it
+// can't be evaluated for s.
+func selectionScorePenalty(s LogicalServer) float64 {
+	if cfg.selectionScore == nil {
+		return 0
+	}
+	score, err := cfg.selectionScore.Score(s)
+	if err != nil {
+		return 0
+	}
+	return score
+}
+
+// resolveTiers returns targetTiers with auto tiers centred on hostLocation
+// for this server list.
+func resolveTiers(servers []LogicalServer) []selector.Tier {
+	return selector.Resolve(cfg.targetTiers, servers, hostLocation, float64(cfg.autoRadius), eligible)
+}
+
+// targetServers returns the eligible servers any tier matches, or all
+// eligible servers with the fallback.
+func targetServers(servers []LogicalServer) []LogicalServer {
+	tiers := resolveTiers(servers)
+	var matched []LogicalServer
+	for _, s := range servers {
+		if eligible(s) && (cfg.targetFallback || selector.Rank(tiers, s) < len(tiers)) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// selectionOptions returns the selection policies from the configuration.
+func selectionOptions() selector.Options {
+	return selector.Options{
+		Fallback: cfg.targetFallback,
+		Eligible: eligible,
+		Quarantined: func(name string) bool {
+			return (stateStore != nil && stateStore.isQuarantined(name)) || avoidRecent(name)
+		},
+		Penalty: func(s LogicalServer) float64 {
+			return reliabilityPenalty(s.Name) + forecastPenalty(s, time.Now()) + ipv6Penalty(s) + selectionScorePenalty(s)
+		},
+		TopK:             cfg.selectionTopK,
+		LoadBand:         float64(cfg.selectionLoadBand),
+		Preferred:        cfg.preferredServers,
+		PreferredMaxLoad: cfg.preferredMaxLoad,
+	}
+}
+
+// selectCandidates returns the active servers of the most preferred tier that
+// has any, sorted by load and reliability, behind the first usable
+// PREFERRED_SERVERS entry. Quarantined and recently used
+// servers are only used when no tier (nor the fallback) has anything else.
+func selectCandidates(servers []LogicalServer) []LogicalServer {
+	candidates, quarantined := selector.Select(servers, resolveTiers(servers), selectionOptions())
+	if quarantined {
+		log("All candidate servers are quarantined or recently used, ignoring that")
+	}
+	return candidates
+}
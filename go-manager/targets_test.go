@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/selector"
+)
+
+func TestTopKSpreadsWithinLoadBand(t *testing.T) {
+	setupTestEnv(t, "")
+	cfg.selectionTopK, cfg.selectionLoadBand = 3, 5
+	servers := []LogicalServer{
+		{Name: "A", Status: 1, Load: 10},
+		{Name: "B", Status: 1, Load: 14},
+		{Name: "C", Status: 1, Load: 30}, // outside the band
+	}
+
+	picked := map[string]int{}
+	for range 500 {
+		best, _ := findBestServer(servers, "")
+		picked[best.Name]++
+	}
+	if picked["C"] > 0 {
+		t.Errorf("picked C %d times despite being outside the load band", picked["C"])
+	}
+	if picked["A"] == 0 || picked["B"] == 0 {
+		t.Errorf("picks %v, want both A and B", picked)
+	}
+	if picked["A"] <= picked["B"] {
+		t.Errorf("picks %v, want the less loaded A favoured", picked)
+	}
+}
+
+func TestTopKOneIsDeterministic(t *testing.T) {
+	setupTestEnv(t, "")
+	servers := testServers()
+	for range 50 {
+		if best, _ := findBestServer(servers, ""); best.Name != "US#2" {
+			t.Fatalf("best = %s, want US#2", best.Name)
+		}
+	}
+}
+
+func TestPreferredServers(t *testing.T) {
+	setupTestEnv(t, "US#2")
+	cfg.preferredServers, cfg.preferredMaxLoad = []string{"US#3", "US#1"}, 60
+	servers := testServers() // US#3 is in maintenance, US#1 at 50%
+
+	best, currentLoad := findBestServer(servers, "US#2")
+	if best == nil || best.Name != "US#1" {
+		t.Fatalf("best = %v, want the preferred US#1", best)
+	}
+	if reason := optimizationReason(servers, "US#2", best, currentLoad, 20); reason == "" {
+		t.Error("no switch to an available preferred server")
+	}
+
+	// On a preferred server, a quieter one is no reason to move
+	servers[1].Load = 0
+	currentLoad = servers[0].Load
+	if reason := optimizationReason(servers, "US#1", &servers[1], currentLoad, 20); reason != "" {
+		t.Errorf("left the preferred server: %s", reason)
+	}
+
+	// Over the cap, normal selection takes over
+	servers[0].Load = 70
+	if best, _ = findBestServer(servers, "US#1"); best == nil || best.Name != "US#2" {
+		t.Errorf("best = %v, want US#2 once US#1 exceeds the cap", best)
+	}
+}
+
+func TestSelectionExpressions(t *testing.T) {
+	setupTestEnv(t, "")
+	var err error
+	cfg.selectionFilter, cfg.selectionScore, err = compileSelectionExprs(`server.Name != 'A'`, `server.Name == 'C' ? -30 : 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := []LogicalServer{
+		{Name: "A", Status: 1, Load: 5},
+		{Name: "B", Status: 1, Load: 10},
+		{Name: "C", Status: 1, Load: 30},
+	}
+	if best, _ := findBestServer(servers, ""); best.Name != "C" {
+		t.Errorf("best = %s, want C, which SELECTION_SCORE favours over B", best.Name)
+	}
+
+	// A score that divides by zero for B counts as no score
+	if cfg.selectionFilter, cfg.selectionScore, err = compileSelectionExprs(`server.Name != 'A'`, `100 / (server.Load - 10)`); err != nil {
+		t.Fatal(err)
+	}
+	if best, _ := findBestServer(servers, ""); best.Name != "B" {
+		t.Errorf("best = %s, want B, whose infinite score is ignored", best.Name)
+	}
+
+	if _, _, err := compileSelectionExprs(`server.Load`, ""); err == nil {
+		t.Error("accepted a SELECTION_FILTER that isn't a condition")
+	}
+}
+
+func TestEligible(t *testing.T) {
+	secureCore := LogicalServer{Name: "CH-US#1", EntryCountry: "CH", ExitCountry: "US", Status: 1, Features: protonapi.FeatureSecureCore | protonapi.FeatureP2P}
+	virtual := LogicalServer{Name: "IS#9", EntryCountry: "IS", ExitCountry: "IS", HostCountry: "SE", Status: 1, Features: protonapi.FeatureP2P}
+	plain := LogicalServer{Name: "US#1", EntryCountry: "US", ExitCountry: "US", Status: 1}
+	down := LogicalServer{Name: "US#3", EntryCountry: "US", ExitCountry: "US", Status: 0}
+
+	for _, tc := range []struct {
+		name      string
+		configure func()
+		want      map[string]bool
+	}{
+		{"defaults", func() {},
+			map[string]bool{"CH-US#1": true, "IS#9": true, "US#1": true, "US#3": false}},
+		{"exit country", func() { cfg.targetExitCountries = []string{"us"} },
+			map[string]bool{"CH-US#1": true, "IS#9": false, "US#1": true}},
+		{"exit country list", func() { cfg.targetExitCountries = []string{"DE", "IS"} },
+			map[string]bool{"CH-US#1": false, "IS#9": true, "US#1": false}},
+		{"required features", func() { cfg.requiredFeatures = protonapi.FeatureP2P },
+			map[string]bool{"CH-US#1": true, "IS#9": true, "US#1": false}},
+		{"all required features", func() { cfg.requiredFeatures = protonapi.FeatureP2P | protonapi.FeatureSecureCore },
+			map[string]bool{"CH-US#1": true, "IS#9": false}},
+		{"exclude virtual", func() { cfg.excludeVirtual = true },
+			map[string]bool{"CH-US#1": true, "IS#9": false, "US#1": true}},
+		{"ipv6 required", func() { cfg.ipv6Mode = ipv6Require },
+			map[string]bool{"CH-US#1": false, "US#1": false}},
+		{"selection filter", func() {
+			cfg.selectionFilter, _ = selector.CompileFilter(`server.Country == server.EntryCountry`)
+		}, map[string]bool{"CH-US#1": false, "IS#9": true, "US#1": true, "US#3": false}},
+		{"filter that can't be evaluated", func() {
+			cfg.selectionFilter, _ = selector.CompileFilter(`server.Load % server.Tier == 0`)
+		}, map[string]bool{"US#1": false}},
+	} {
+		setupTestEnv(t, "")
+		tc.configure()
+		for _, s := range []LogicalServer{secureCore, virtual, plain, down} {
+			if want, ok := tc.want[s.Name]; ok && eligible(s) != want {
+				t.Errorf("%s: eligible(%s) = %v, want %v", tc.name, s.Name, !want, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/retry"
+)
+
+// Proton's access tokens expire after about a day. Waiting for the 401 puts
+// a refresh round trip, or a whole login, in front of the first API call
+// after that, which may be the one a failover is waiting on. So the daemon
+// renews the token TOKEN_REFRESH_AHEAD seconds before it is expected to
+// expire.
+
+// minTokenLifetime is the shortest lifetime learned from an early 401;
+// anything shorter is taken for a revoked token rather than its lifetime.
+const minTokenLifetime = 10 * time.Minute
+
+// tokenRetryBase is the first pause after a failed proactive refresh.
+var tokenRetryBase = time.Minute
+
+// tokenExpiry is when the access token is expected to expire. Callers hold
+// pm.mu.
+func (pm *ProtonManager) tokenExpiry() time.Time {
+	lifetime := time.Duration(cfg.tokenLifetime) * time.Second
+	if pm.learnedLifetime > 0 {
+		lifetime = min(lifetime, pm.learnedLifetime)
+	}
+	return pm.tokenIssued.Add(lifetime)
+}
+
+// tokenExpired notes a 401. A token that expired sooner than expected
+// teaches the lifetime to plan refreshes with. Callers hold pm.mu.
+func (pm *ProtonManager) tokenExpired() {
+	sessionMetrics.rejected()
+	if pm.tokenIssued.IsZero() {
+		return
+	}
+	age := time.Since(pm.tokenIssued)
+	if age >= minTokenLifetime && time.Now().Before(pm.tokenExpiry()) {
+		pm.learnedLifetime = age
+		log(fmt.Sprintf("Access token expired after %s, sooner than expected; refreshing ahead of that from now on", age.Round(time.Minute)))
+	}
+}
+
+// renewTokens exchanges the refresh token for new tokens and persists them;
+// trigger says why, for the metrics. Callers hold pm.mu, except while the
+// session is set up.
+func (pm *ProtonManager) renewTokens(trigger string) error {
+	c, auth, err := pm.apiManager.NewClientWithRefresh(context.Background(), pm.uid, pm.refreshToken)
+	if err != nil {
+		sessionMetrics.refreshFailed()
+		return err
+	}
+	sessionMetrics.refreshed(trigger)
+	resolveAlert(alertReauth, reauthSubject)
+	if pm.client != nil {
+		pm.client.Close()
+	}
+	pm.client = c
+	pm.accessToken = auth.AccessToken
+	pm.refreshToken = auth.RefreshToken
+	pm.tokenIssued = time.Now()
+	pm.saveSession()
+	return nil
+}
+
+// refreshLoop renews the access token ahead of its expiry until done is
+// closed. Failed refreshes are retried with backoff; if they keep failing,
+// the next API call falls back to refreshing on the 401.
+func (pm *ProtonManager) refreshLoop(done <-chan struct{}) {
+	ahead := time.Duration(cfg.tokenRefreshAhead) * time.Second
+	retries := retry.Policy{Base: tokenRetryBase, Max: max(ahead/4, tokenRetryBase), Jitter: cfg.apiRetry.Jitter}
+	failures := 0
+	var retryIn time.Duration
+	for {
+		wait := retryIn
+		if wait == 0 {
+			pm.mu.Lock()
+			wait = time.Until(pm.tokenExpiry().Add(-ahead))
+			pm.mu.Unlock()
+		}
+
+		timer := time.NewTimer(max(wait, 0))
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return
+		}
+
+		if err := pm.refreshAhead(ahead); err != nil {
+			failures++
+			retryIn = retries.Delay(failures)
+			log(fmt.Sprintf("Proactive token refresh failed: %v (retrying in %s)", err, retryIn.Round(time.Second)))
+		} else {
+			failures, retryIn = 0, 0
+		}
+	}
+}
+
+// refreshAhead renews the token if it expires within ahead; an API call may
+// have renewed it in the meantime.
+func (pm *ProtonManager) refreshAhead(ahead time.Duration) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if time.Until(pm.tokenExpiry()) > ahead {
+		return nil
+	}
+	if err := pm.renewTokens(refreshScheduled); err != nil {
+		return err
+	}
+	log(fmt.Sprintf("Access token refreshed ahead of expiry; next refresh around %s",
+		pm.tokenExpiry().Add(-ahead).Format("2006-01-02 15:04:05")))
+	return nil
+}
+
+const reauthSubject = "Proton session had to be re-established"
+
+// reauthenticated counts a password login that replaced a session which
+// could not be refreshed (cause), and alerts: repeated ones mean the refresh
+// token keeps being invalidated. A later successful refresh resolves it.
+func (pm *ProtonManager) reauthenticated(cause error) {
+	n := sessionMetrics.reauthenticated()
+	notify(alertReauth, reauthSubject,
+		fmt.Sprintf("The manager could not refresh its Proton session as %s:\n\n%v\n\nIt logged in with the password instead (%d such logins since it started). If this keeps happening, something is invalidating the refresh token: a password change, sessions revoked in the Proton dashboard, or another client using the same session file.",
+			pm.acct().Username, cause, n))
+}
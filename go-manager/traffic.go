@@ -0,0 +1,103 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"time"
+
+	"gluetun-proton-manager/runtime/docker"
+)
+
+// trafficSample is the tunnel's byte counter at one point in time.
+type trafficSample struct {
+	at    time.Time
+	bytes uint64
+}
+
+// readTunnelBytes returns the bytes received and sent on gluetun's tunnel
+// interface, VPN_INTERFACE in the env file (tun0 by default).
+var readTunnelBytes = func() (uint64, error) {
+	return docker.NetBytes(activeGluetun(), cmp.Or(readEnvFile()["VPN_INTERFACE"], "tun0"))
+}
+
+// sampleTraffic records the tunnel's byte counter after a passing health
+// check. Once the traffic over BUSY_WINDOW falls back under
+// BUSY_THRESHOLD_MBPS, a switch deferred while it was busy is retried.
+func (d *daemon) sampleTraffic() {
+	if d.cfg.busyThresholdMbps <= 0 {
+		return
+	}
+	n, err := readTunnelBytes()
+	if err != nil {
+		log(fmt.Sprintf("Traffic sample failed: %v", err))
+		return
+	}
+	now := time.Now()
+	window := time.Duration(d.cfg.busyWindow) * time.Second
+
+	d.mu.Lock()
+	// Counters start over when gluetun is recreated
+	if len(d.trafficWindow) > 0 && n < d.trafficWindow[len(d.trafficWindow)-1].bytes {
+		d.trafficWindow = nil
+	}
+	d.trafficWindow = append(d.trafficWindow, trafficSample{now, n})
+	for len(d.trafficWindow) > 2 && now.Sub(d.trafficWindow[1].at) >= window {
+		d.trafficWindow = d.trafficWindow[1:]
+	}
+	retry := d.switchDeferred && d.trafficMbpsLocked() < float64(d.cfg.busyThresholdMbps)
+	if retry {
+		d.switchDeferred = false
+	}
+	d.mu.Unlock()
+
+	if retry {
+		log("Tunnel traffic has calmed down, retrying the deferred switch")
+		d.requestFailover("")
+	}
+}
+
+// trafficMbpsLocked is the average rate over the sampled window, 0 without
+// two samples. Callers hold mu.
+func (d *daemon) trafficMbpsLocked() float64 {
+	if len(d.trafficWindow) < 2 {
+		return 0
+	}
+	first, last := d.trafficWindow[0], d.trafficWindow[len(d.trafficWindow)-1]
+	secs := last.at.Sub(first.at).Seconds()
+	if secs <= 0 {
+		return 0
+	}
+	return float64(last.bytes-first.bytes) * 8 / 1e6 / secs
+}
+
+// deferForTraffic reports whether a switch that isn't needed to keep the
+// tunnel working should wait because the tunnel is busy, marking it to be
+// retried once traffic calms down. It returns the current rate for logging.
+func (d *daemon) deferForTraffic() (float64, bool) {
+	if d.cfg.busyThresholdMbps <= 0 {
+		return 0, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	mbps := d.trafficMbpsLocked()
+	if mbps < float64(d.cfg.busyThresholdMbps) {
+		return mbps, false
+	}
+	d.switchDeferred = true
+	return mbps, true
+}
+
+// trafficProblems reports BUSY_* settings that can't work.
+func trafficProblems() []string {
+	if cfg.busyThresholdMbps <= 0 {
+		return nil
+	}
+	var problems []string
+	if cfg.runtimeBackend != runtimeDocker {
+		problems = append(problems, "BUSY_THRESHOLD_MBPS reads gluetun's counters with docker exec and needs RUNTIME=docker")
+	}
+	if cfg.busyWindow < 1 {
+		problems = append(problems, "BUSY_WINDOW must be >= 1")
+	}
+	return problems
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTrafficDefersSwitch(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.busyThresholdMbps, cfg.busyWindow = 10, 120
+	counter := uint64(0)
+	prev := readTunnelBytes
+	readTunnelBytes = func() (uint64, error) { return counter, nil }
+	t.Cleanup(func() { readTunnelBytes = prev })
+
+	rt := newMockRuntime(t)
+	d := newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, true))
+	// 150 MB over the last minute is 20 Mbit/s
+	d.trafficWindow = []trafficSample{{time.Now().Add(-time.Minute), 0}, {time.Now(), 150e6}}
+	counter = 150e6
+
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.applied) != 0 || !d.switchDeferred {
+		t.Fatalf("applied %v, deferred %v; want the load switch deferred", rt.applied, d.switchDeferred)
+	}
+
+	// Traffic stops: once the busy minute has left the window, the switch is retried
+	d.trafficWindow = []trafficSample{{time.Now().Add(-3 * time.Minute), 0}, {time.Now().Add(-2 * time.Minute), 150e6}}
+	d.sampleTraffic()
+	select {
+	case <-d.failover:
+	default:
+		t.Fatal("deferred switch not retried when the tunnel went idle")
+	}
+	if d.switchDeferred {
+		t.Error("still marked deferred")
+	}
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2] once idle", rt.applied)
+	}
+
+	// Failing servers are never deferred
+	setupTestEnv(t, "US#1")
+	cfg.busyThresholdMbps = 10
+	rt = newMockRuntime(t)
+	d = newTestDaemon(newMockServerSource(t, testServers()...), rt, newMockHealth(t, false, true))
+	d.trafficWindow = []trafficSample{{time.Now().Add(-time.Minute), 0}, {time.Now(), 150e6}}
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(rt.applied, []string{"US#2"}) {
+		t.Errorf("applied %v, want [US#2] for an unhealthy server", rt.applied)
+	}
+}
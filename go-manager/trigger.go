@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// triggerReasonPrefix marks failovers requested by an external monitor.
+const triggerReasonPrefix = "External Trigger"
+
+// serveTrigger handles POST /trigger/switch, which lets monitors outside the
+// tunnel ask for a failover. It needs TRIGGER_TOKEN, as a bearer token or a
+// token query parameter for hooks that can't set headers, or the control
+// API's own credentials. Requests within TRIGGER_COOLDOWN of the last
+// accepted one are refused, since monitors repeat alerts while a switch is
+// under way.
+func (d *daemon) serveTrigger(w http.ResponseWriter, r *http.Request) {
+	if d.cfg.triggerToken == "" {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "trigger webhook disabled; set TRIGGER_TOKEN"})
+		return
+	}
+	if !triggerAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="proton-manager"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+
+	var wait time.Duration
+	stateStore.updateState(func(st *State) {
+		wait = time.Until(st.LastTrigger.Add(time.Duration(d.cfg.triggerCooldown) * time.Second))
+		if wait <= 0 {
+			st.LastTrigger = time.Now()
+		}
+	})
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "a trigger was accepted recently"})
+		return
+	}
+
+	reason := triggerReasonPrefix
+	if detail := strings.TrimSpace(r.URL.Query().Get("reason")); detail != "" {
+		reason += ": " + truncateUTF8(detail, 100)
+	}
+	log(fmt.Sprintf("Failover requested by %s (%s)", r.RemoteAddr, reason))
+	d.requestFailover(reason)
+	writeJSON(w, http.StatusOK, map[string]string{"reason": reason})
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func triggerAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.triggerToken)) == 1 {
+		return true
+	}
+	return controlAuthEnabled() && authorized(r)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTriggerWebhook(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+	cfg.controlToken = "s3cret"
+	srv := httptest.NewServer(requireAuth(controlHandler(d)))
+	defer srv.Close()
+
+	post := func(query string, auth func(*http.Request)) int {
+		t.Helper()
+		req, _ := http.NewRequest("POST", srv.URL+"/trigger/switch"+query, nil)
+		if auth != nil {
+			auth(req)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post("?token=kuma", nil); code != http.StatusNotFound {
+		t.Errorf("without TRIGGER_TOKEN = %d", code)
+	}
+	cfg.triggerToken = "kuma"
+	if code := post("?token=wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d", code)
+	}
+	if code := post("?token=kuma&reason=site+unreachable", nil); code != http.StatusOK {
+		t.Errorf("token in query = %d", code)
+	}
+	if got := d.takeFailoverReason(); got != "External Trigger: site unreachable" {
+		t.Errorf("failover reason %q", got)
+	}
+	if got := switchTrigger(true, "External Trigger: site unreachable", ""); got != triggerExternal {
+		t.Errorf("audit trigger %q", got)
+	}
+
+	// Repeated alerts wait out the cooldown
+	bearer := func(r *http.Request) { r.Header.Set("Authorization", "Bearer kuma") }
+	if code := post("", bearer); code != http.StatusTooManyRequests {
+		t.Errorf("within cooldown = %d", code)
+	}
+	// The cooldown survives a restart
+	stateStore = loadStore(stateStore.path)
+	if code := post("", bearer); code != http.StatusTooManyRequests {
+		t.Errorf("within cooldown after a restart = %d", code)
+	}
+	cfg.triggerCooldown = 0
+	if code := post("", bearer); code != http.StatusOK {
+		t.Errorf("bearer token = %d", code)
+	}
+	// The control API's own credentials work too
+	if code := post("", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }); code != http.StatusOK {
+		t.Errorf("control token = %d", code)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"site down", 100, "site down"},
+		{"abcdef", 3, "abc"},
+		{"Zürich down", 2, "Z"},
+		{"Zürich down", 3, "Zü"},
+		{"🔥🔥", 5, "🔥"},
+		{"🔥", 3, ""},
+	} {
+		got := truncateUTF8(tc.s, tc.n)
+		if got != tc.want || !utf8.ValidString(got) {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gluetun-proton-manager/health"
+	"gluetun-proton-manager/protonapi"
+	"gluetun-proton-manager/runtime/docker"
+	"gluetun-proton-manager/selector"
+)
+
+type checkResult struct {
+	Name   string
+	OK     bool
+	Detail string
+	// Hint says how to fix a failed check; only doctor sets it
+	Hint string
+}
+
+// runValidate checks configuration, credentials, targets, Docker access and
+// env file writability, printing a pass/fail report. It returns 0 if every
+// check passed, else the exit code of the first failure.
+func runValidate() int {
+	results := validationChecks()
+	if printReport(results) {
+		return 0
+	}
+	return checksExitCode(results)
+}
+
+// validationChecks runs the checks behind validate and doctor.
+func validationChecks() []checkResult {
+	var results []checkResult
+	add := func(name string, ok bool, format string, args ...any) {
+		results = append(results, checkResult{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// 1. Static configuration
+	var problems []string
+	if cfg.healthCheckInterval <= 0 {
+		problems = append(problems, "HEALTH_CHECK_INTERVAL must be > 0")
+	}
+	if cfg.envFileFormat != envFormatEnv && cfg.envFileFormat != envFormatCompose {
+		problems = append(problems, fmt.Sprintf("ENV_FILE_FORMAT must be %s or %s", envFormatEnv, envFormatCompose))
+	} else if cfg.envFileFormat == envFormatCompose && cfg.switchMode == switchModeBlueGreen {
+		problems = append(problems, "ENV_FILE_FORMAT=compose is not supported with SWITCH_MODE=bluegreen")
+	}
+	if cfg.gluetunLabel != "" && cfg.switchMode == switchModeBlueGreen {
+		problems = append(problems, "GLUETUN_LABEL is not supported with SWITCH_MODE=bluegreen")
+	}
+	switch cfg.runtimeBackend {
+	case runtimeDocker:
+	case runtimeNomad:
+		problems = append(problems, nomadProblems()...)
+	case runtimeKubernetes:
+		problems = append(problems, kubeProblems()...)
+	default:
+		problems = append(problems, fmt.Sprintf("RUNTIME must be %s, %s or %s", runtimeDocker, runtimeNomad, runtimeKubernetes))
+	}
+	switch cfg.leaderElection {
+	case leaderOff, leaderFile:
+	case leaderKubernetes:
+		if kubeClientErr != nil {
+			problems = append(problems, fmt.Sprintf("LEADER_ELECTION=kubernetes: %v", kubeClientErr))
+		}
+		if cfg.leaderLeaseDuration < 3 {
+			problems = append(problems, "LEADER_LEASE_DURATION must be >= 3")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("LEADER_ELECTION must be %s or %s", leaderFile, leaderKubernetes))
+	}
+	if cfg.dockerAPI && cfg.switchMode == switchModeBlueGreen {
+		problems = append(problems, "SWITCH_MODE=bluegreen needs Compose and isn't supported with DOCKER_API")
+	}
+	if cfg.loadCheckInterval <= 0 {
+		problems = append(problems, "LOAD_CHECK_INTERVAL must be > 0")
+	}
+	if cfg.loadThreshold < 0 || cfg.loadThreshold > 100 {
+		problems = append(problems, "LOAD_SWITCH_THRESHOLD must be between 0 and 100")
+	}
+	if cfg.avoidLastN < 0 || cfg.avoidRecentHours < 0 {
+		problems = append(problems, "AVOID_LAST_N_SERVERS and AVOID_RECENT_HOURS must be >= 0")
+	}
+	if cfg.forecastWeight < 0 || cfg.forecastWeight > 100 {
+		problems = append(problems, "LOAD_FORECAST_WEIGHT must be between 0 and 100")
+	}
+	if cfg.forecastHours < 1 || cfg.forecastHours > 24 {
+		problems = append(problems, "LOAD_FORECAST_HOURS must be between 1 and 24")
+	}
+	if cfg.preferredMaxLoad < 0 || cfg.preferredMaxLoad > 100 {
+		problems = append(problems, "PREFERRED_MAX_LOAD must be between 0 and 100")
+	}
+	if cfg.selectionTopK < 1 || cfg.selectionLoadBand < 0 {
+		problems = append(problems, "SELECTION_TOP_K must be >= 1 and SELECTION_LOAD_BAND >= 0")
+	}
+	if cfg.reliabilityWeight < 0 {
+		problems = append(problems, "RELIABILITY_WEIGHT must be >= 0")
+	}
+	if cfg.throughputProbeURL != "" && cfg.healthMode != healthModeNative && cfg.healthMode != healthModeProxy {
+		problems = append(problems, "THROUGHPUT_PROBE_URL needs HEALTH_MODE=native or proxy")
+	}
+	for _, zone := range cfg.dnsblRotateOn {
+		if !slices.Contains(cfg.dnsblZones, zone) {
+			problems = append(problems, fmt.Sprintf("DNSBL_ROTATE_ON zone %s is not in DNSBL_ZONES", zone))
+		}
+	}
+	if requiredFeaturesErr != nil {
+		problems = append(problems, "REQUIRED_FEATURES: "+requiredFeaturesErr.Error())
+	}
+	if profilesErr != nil {
+		problems = append(problems, profilesErr.Error())
+	}
+	if canariesErr != nil {
+		problems = append(problems, canariesErr.Error())
+	}
+	if retryErr != nil {
+		problems = append(problems, retryErr.Error())
+	}
+	if cfg.maxRTTMs < 0 || cfg.maxRTTSamples < 1 {
+		problems = append(problems, "MAX_RTT_MS must be >= 0 and MAX_RTT_SAMPLES >= 1")
+	}
+	if cfg.maxLossPct < 0 || cfg.maxLossPct > 100 || cfg.lossWindow < 1 {
+		problems = append(problems, "MAX_PACKET_LOSS_PCT must be between 0 and 100 and PACKET_LOSS_WINDOW >= 1")
+	}
+	if cfg.canaryMaxAttempts < 1 {
+		problems = append(problems, "CANARY_MAX_ATTEMPTS must be >= 1")
+	}
+	if cfg.healthMinInterval > cfg.healthMaxInterval {
+		problems = append(problems, "HEALTH_CHECK_MIN_INTERVAL must not exceed HEALTH_CHECK_MAX_INTERVAL")
+	}
+	if cfg.reconcileInterval <= 0 {
+		problems = append(problems, "RECONCILE_INTERVAL must be > 0")
+	}
+	if targetTiersErr != nil {
+		problems = append(problems, targetTiersErr.Error())
+	}
+	if selectionExprErr != nil {
+		problems = append(problems, selectionExprErr.Error())
+	}
+	if cfg.geoLocation != "" {
+		if _, err := selector.ParseLocation(cfg.geoLocation); err != nil {
+			problems = append(problems, fmt.Sprintf("GEO_LOCATION: %v", err))
+		}
+	}
+	switch cfg.switchMode {
+	case switchModeRecreate:
+	case switchModeBlueGreen:
+		problems = append(problems, blueGreenProblems()...)
+	default:
+		problems = append(problems, fmt.Sprintf("unknown SWITCH_MODE %q", cfg.switchMode))
+	}
+	switch cfg.healthMode {
+	case healthModeExec, healthModeNative:
+	case healthModeProxy:
+		if _, err := health.ProxyClient(cfg.healthProxyURL); err != nil {
+			problems = append(problems, fmt.Sprintf("HEALTH_PROXY_URL: %v", err))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown HEALTH_MODE %q", cfg.healthMode))
+	}
+	if cfg.healthURL != "" {
+		if u, err := url.Parse(cfg.healthURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("HEALTH_URL must be an http(s) URL, got %q", cfg.healthURL))
+		}
+	}
+	if cfg.healthURLStatus != 0 && (cfg.healthURLStatus < 100 || cfg.healthURLStatus > 599) {
+		problems = append(problems, fmt.Sprintf("HEALTH_URL_STATUS must be an HTTP status, got %d", cfg.healthURLStatus))
+	}
+	if cfg.triggerToken != "" && cfg.controlAddr == "" {
+		problems = append(problems, "TRIGGER_TOKEN needs CONTROL_ADDR for monitors to reach /trigger/switch")
+	}
+	if len(cfg.pingTargets) == 0 {
+		problems = append(problems, "PING_TARGETS lists no targets")
+	}
+	if cfg.healthCmd != "" && cfg.healthURL != "" {
+		problems = append(problems, "set either HEALTH_CMD or HEALTH_URL, not both")
+	}
+	if cfg.tokenRefreshAhead < 0 || cfg.tokenLifetime <= cfg.tokenRefreshAhead {
+		problems = append(problems, "TOKEN_REFRESH_AHEAD must be >= 0 and less than TOKEN_LIFETIME")
+	}
+	if p := os.Getenv("WIREGUARD_ENDPOINT_PORT"); p != "" && port(p) != nil {
+		problems = append(problems, fmt.Sprintf("WIREGUARD_ENDPOINT_PORT must be a port, got %q", p))
+	}
+	if cfg.wireguardMTUMax < minTunnelMTU {
+		problems = append(problems, fmt.Sprintf("WIREGUARD_MTU_MAX must be >= %d", minTunnelMTU))
+	}
+	if cfg.hvRetryInterval <= 0 {
+		problems = append(problems, "HV_RETRY_INTERVAL must be > 0")
+	}
+	if secretsErr != nil {
+		problems = append(problems, secretsErr.Error())
+	}
+	if u, err := url.Parse(cfg.apiBaseURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("PROTON_API_URL must be an http(s) URL, got %q", cfg.apiBaseURL))
+	}
+	if cfg.apiProxyURL != "" {
+		if _, err := health.ProxyClient(cfg.apiProxyURL); err != nil {
+			problems = append(problems, fmt.Sprintf("API_PROXY_URL: %v", err))
+		}
+	}
+	switch cfg.dependentAction {
+	case dependentStop, dependentPause, dependentRecreate:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown DEPENDENT_ACTION %q", cfg.dependentAction))
+	}
+	switch cfg.envChangePolicy {
+	case envPolicyAdopt, envPolicyRevert, envPolicyIgnore:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown ENV_CHANGE_POLICY %q", cfg.envChangePolicy))
+	}
+	if cfg.protocolFallback && readEnvFile()["OPENVPN_USER"] == "" {
+		problems = append(problems, "PROTOCOL_FALLBACK needs OPENVPN_USER and OPENVPN_PASSWORD in the env file")
+	}
+	if cfg.smtpHost != "" && (len(cfg.smtpTo) == 0 || cfg.smtpFrom == "") {
+		problems = append(problems, "SMTP_TO and SMTP_FROM (or SMTP_USERNAME) must be set when SMTP_HOST is")
+	}
+	if notifyCooldownsErr != nil {
+		problems = append(problems, notifyCooldownsErr.Error())
+	}
+	problems = append(problems, ipv6Problems()...)
+	problems = append(problems, killSwitchProblems()...)
+	problems = append(problems, portFileProblems()...)
+	problems = append(problems, integrationProblems()...)
+	problems = append(problems, ddnsProblems()...)
+	problems = append(problems, allowlistProblems()...)
+	problems = append(problems, proxyProblems()...)
+	problems = append(problems, providerProblems()...)
+	problems = append(problems, serversJSONProblems()...)
+	problems = append(problems, gluetunAuthProblems()...)
+	problems = append(problems, reportProblems()...)
+	problems = append(problems, selectorPluginProblems()...)
+	problems = append(problems, wasmPluginProblems()...)
+	problems = append(problems, startupProblems()...)
+	problems = append(problems, connectionAgeProblems()...)
+	problems = append(problems, trafficProblems()...)
+	problems = append(problems, controlProblems()...)
+	problems = append(problems, quietHoursProblems()...)
+	if len(problems) > 0 {
+		add("Configuration", false, "%s", strings.Join(problems, "; "))
+	} else {
+		add("Configuration", true, "intervals %ds/%ds/%ds", cfg.healthCheckInterval, cfg.loadCheckInterval, cfg.reconcileInterval)
+	}
+
+	// 2. Proton session or credentials of each account
+	pm := &ProtonManager{}
+	pm.ensureDirs()
+	pm.apiManager = newAPIManager()
+	authed := -1
+	for i, acct := range accounts {
+		pm.useAccount(i)
+		name := "Proton auth"
+		if len(accounts) > 1 {
+			name += " (" + acct.Username + ")"
+		}
+		if err := pm.resumeSession(); err == nil {
+			add(name, true, "session in %s is valid", sessionLocation(acct))
+		} else if err := pm.login(); err == nil {
+			add(name, true, "logged in as %s", acct.Username)
+		} else {
+			add(name, false, "%v", err)
+			continue
+		}
+		if authed < 0 {
+			authed = i
+		}
+	}
+
+	// 3. Targets exist in the live server list
+	if authed >= 0 && authed != pm.account {
+		pm.useAccount(authed)
+		pm.resumeSession()
+	}
+	if authed >= 0 {
+		servers, err := pm.Servers()
+		if err != nil {
+			add("Server list", false, "%v", err)
+		} else {
+			add("Server list", true, "%d logical servers", len(servers))
+			validateTargets(servers, add)
+		}
+	}
+
+	// 4. Docker and Compose, Nomad or Kubernetes
+	if cfg.runtimeBackend == runtimeNomad {
+		validateNomad(add)
+	} else if cfg.runtimeBackend == runtimeKubernetes {
+		validateKubernetes(add)
+	} else if version, err := docker.Version(); err != nil {
+		add("Docker", false, "cannot reach Docker daemon: %v", err)
+	} else {
+		add("Docker", true, "daemon %s at %s", version, getEnv("DOCKER_HOST", docker.DefaultHost))
+		var containers []string
+		for _, c := range gluetunInstances() {
+			containers = append(containers, c.Name)
+		}
+		if cfg.switchMode == switchModeBlueGreen {
+			containers = nil
+			for _, slot := range cfg.bgSlots {
+				containers = append(containers, slot.Container)
+			}
+		}
+		for _, name := range containers {
+			if _, err := docker.InspectEnv(name); err != nil {
+				add("Gluetun container", false, "%v", err)
+			} else {
+				add("Gluetun container", true, "%s found", name)
+			}
+		}
+		for _, dep := range cfg.dependents {
+			if _, _, err := docker.State(dep.Name); err != nil {
+				add("Dependent container", false, "%s not found", dep.Name)
+			} else {
+				add("Dependent container", true, "%s found", dep.Name)
+			}
+		}
+		if len(cfg.dependents) > 0 {
+			if err := checkDependentAction(); err != nil {
+				add("Dependent containers", false, "%v", err)
+			}
+		}
+	}
+	if cfg.runtimeBackend != runtimeDocker {
+		add("Compose", true, "not used with RUNTIME=%s", cfg.runtimeBackend)
+	} else if cfg.dockerAPI {
+		add("Compose", true, "not used with DOCKER_API")
+	} else if cmd, err := composeCommand("config", "--services"); err != nil {
+		add("Compose", false, "%v", err)
+	} else if out, err := cmd.Output(); err != nil {
+		add("Compose", false, "compose config failed: %v", err)
+	} else {
+		services := gluetunServices()
+		if cfg.switchMode == switchModeBlueGreen {
+			services = nil
+			for _, slot := range cfg.bgSlots {
+				services = append(services, slot.Service)
+			}
+		}
+		var missing []string
+		for _, svc := range services {
+			if !containsLine(string(out), svc) {
+				missing = append(missing, fmt.Sprintf("%q", svc))
+			}
+		}
+		if len(missing) > 0 {
+			add("Compose", false, "service %s not defined in %s", strings.Join(missing, ", "), strings.Join(composeProjectConfig().FindFiles(), ", "))
+		} else {
+			add("Compose", true, "%s (services %s)", cmd.Args[0], strings.Join(services, ", "))
+		}
+	}
+
+	// 5. Env file writability and gluetun's settings in it
+	validateEnvFile(add)
+	if problems := validateGluetunEnv(readEnvFile()); len(problems) > 0 && cfg.runtimeBackend != runtimeKubernetes {
+		add("Gluetun env", false, "%s", strings.Join(problems, "; "))
+	}
+	if cfg.runtimeBackend == runtimeDocker || cfg.gluetunVersionSetting != "" {
+		detectGluetunVersion()
+		v := currentGluetunVersion()
+		raw, _ := readRawEnv()
+		if warnings := renameWarnings(raw, v); len(warnings) > 0 {
+			add("Gluetun version", false, "%s", strings.Join(warnings, "; "))
+		} else if isReleaseVersion(v) {
+			add("Gluetun version", true, "%s", v)
+		} else {
+			add("Gluetun version", true, "unknown (%q), assuming a current release", v)
+		}
+	}
+	if cfg.ipv6Mode != ipv6Off && cfg.runtimeBackend != runtimeKubernetes {
+		if addrs := readEnvFile()["WIREGUARD_ADDRESSES"]; hasIPv6Address(addrs) {
+			add("IPv6", true, "WIREGUARD_ADDRESSES includes an IPv6 address")
+		} else {
+			add("IPv6", false, "WIREGUARD_ADDRESSES (%q) has no IPv6 address, so gluetun can't carry IPv6", addrs)
+		}
+	}
+
+	// 6. MQTT broker, if publishing is enabled
+	if cfg.mqttBroker != "" {
+		if client, err := dialMQTT(cfg.mqttBroker, mqttNode()+"-validate", cfg.mqttUsername, cfg.mqttPassword, nil, 10*time.Second); err != nil {
+			add("MQTT", false, "%s: %v", cfg.mqttBroker, err)
+		} else {
+			client.close()
+			add("MQTT", true, "connected to %s", cfg.mqttBroker)
+		}
+	}
+
+	// 7. Control API certificate, if served over TLS
+	if cfg.controlAddr != "" && cfg.controlTLS {
+		if _, err := controlTLSConfig(); err != nil {
+			add("Control API", false, "%v", err)
+		} else {
+			certFile, _ := controlTLSFiles()
+			add("Control API", true, "TLS certificate %s", certFile)
+		}
+	}
+
+	return results
+}
+
+// validateEnvFile checks that the env file can be written, opening it for
+// append without modifying it, and in compose format that it parses.
+func validateEnvFile(add func(string, bool, string, ...any)) {
+	if f, err := os.OpenFile(cfg.envFile, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		add("Env file", false, "%v", err)
+	} else {
+		f.Close()
+		add("Env file", true, "%s is writable", cfg.envFile)
+	}
+	if cfg.envFileFormat == envFormatCompose {
+		if _, err := readEnv(); err != nil {
+			add("Env file", false, "%v", err)
+		}
+	}
+}
+
+// validateNomad checks that the Nomad job and its gluetun task exist, and
+// the variables path if one is used.
+func validateNomad(add func(string, bool, string, ...any)) {
+	client := nomadClient()
+	job, err := client.Job(cfg.nomadJob)
+	if err != nil {
+		add("Nomad", false, "%s: %v", cfg.nomadAddr, err)
+		return
+	}
+	if _, err := job.TaskEnv(cfg.nomadGroup, cfg.nomadTask); err != nil {
+		add("Nomad", false, "%v", err)
+		return
+	}
+	add("Nomad", true, "job %s, task %s at %s", cfg.nomadJob, cfg.nomadTask, cfg.nomadAddr)
+	if cfg.nomadVarsPath != "" {
+		if _, _, err := client.Variables(cfg.nomadVarsPath); err != nil {
+			add("Nomad variables", false, "%v", err)
+		} else {
+			add("Nomad variables", true, "%s readable", cfg.nomadVarsPath)
+		}
+	}
+}
+
+// validateKubernetes checks that the VPNTunnel, its Secret and its workload
+// can be read.
+func validateKubernetes(add func(string, bool, string, ...any)) {
+	if kubeClient == nil {
+		add("Kubernetes", false, "%v", kubeClientErr)
+		return
+	}
+	t, err := kubeClient.Tunnel(cfg.kubeTunnel)
+	if err != nil {
+		add("Kubernetes", false, "%v", err)
+		return
+	}
+	if _, err := tunnelProfile(t.Spec); err != nil {
+		add("VPNTunnel", false, "%s: %v", cfg.kubeTunnel, err)
+		return
+	}
+	add("VPNTunnel", true, "%s/%s (secret %s, %s)", kubeClient.Namespace(), cfg.kubeTunnel, t.Spec.SecretName, t.Spec.Workload)
+	// The env file is seeded from the Secret on startup, so check the Secret
+	if env, err := kubeClient.Secret(t.Spec.SecretName); err != nil {
+		add("Kubernetes secret", false, "%v", err)
+	} else if problems := validateGluetunEnv(env); len(problems) > 0 {
+		add("Gluetun env", false, "%s", strings.Join(problems, "; "))
+	} else {
+		add("Kubernetes secret", true, "%s readable", t.Spec.SecretName)
+	}
+	if _, err := kubeClient.RolledOut(t.Spec.Workload); err != nil {
+		add("Kubernetes workload", false, "%v", err)
+	} else {
+		add("Kubernetes workload", true, "%s found", t.Spec.Workload)
+	}
+}
+
+// validateTargets reports target countries and cities that have no active
+// servers, for each tier of the preference list.
+func validateTargets(servers []LogicalServer, add func(string, bool, string, ...any)) {
+	for _, tier := range cfg.targetTiers {
+		name := "Target cities"
+		if tier.Name != "" {
+			name = "Target " + tier.Name
+		}
+
+		var cities []string
+		for _, s := range servers {
+			if eligible(s) && (selector.Tier{Countries: tier.Countries}).Matches(s) {
+				cities = append(cities, s.City)
+			}
+		}
+		if len(cities) == 0 {
+			add(name, false, "no active servers in %q", tier.Name)
+			continue
+		}
+
+		var missing []string
+		for _, city := range tier.Cities {
+			city = strings.TrimSpace(city)
+			if !slices.ContainsFunc(cities, func(c string) bool { return selector.MatchCity(city, c) }) {
+				missing = append(missing, fmt.Sprintf("%q", city))
+			}
+		}
+		if len(missing) > 0 {
+			add(name, false, "no active servers in %s", strings.Join(missing, ", "))
+		} else {
+			add(name, true, "%s", tier)
+		}
+	}
+
+	if len(cfg.preferredServers) > 0 {
+		var missing []string
+		for _, name := range cfg.preferredServers {
+			if protonapi.FindByName(servers, name) == nil {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			add("Preferred servers", false, "not in the server list: %s", strings.Join(missing, ", "))
+		} else {
+			add("Preferred servers", true, "%s", strings.Join(cfg.preferredServers, ", "))
+		}
+	}
+}
+
+// checksExitCode returns the exit code for the class of the first failed
+// check, so scripts running validate or doctor can tell a bad password from
+// an unreachable Docker daemon.
+func checksExitCode(results []checkResult) int {
+	for _, r := range results {
+		if r.OK {
+			continue
+		}
+		class := classOther
+		switch {
+		case r.Name == "Configuration":
+			class = classConfig
+		case strings.HasPrefix(r.Name, "Proton auth"):
+			class = classAuth
+		case r.Name == "Proton API":
+			class = classAPIUnreachable
+		case r.Name == "Docker", r.Name == "Gluetun container", r.Name == "Dependent container", r.Name == "Compose":
+			class = classDocker
+		case strings.HasPrefix(r.Name, "Target"):
+			class = classNoCandidates
+		}
+		return exitCode(classed(class, errors.New(r.Detail)))
+	}
+	return 0
+}
+
+func printReport(results []checkResult) bool {
+	failed := 0
+	fmt.Println("------------------------------------------------------------")
+	for _, r := range results {
+		status := "PASS"
+		if !r.OK {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("[%s] %-20s %s\n", status, r.Name, r.Detail)
+		if !r.OK && r.Hint != "" {
+			fmt.Printf("       %-20s -> %s\n", "", r.Hint)
+		}
+	}
+	fmt.Println("------------------------------------------------------------")
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(results))
+		return false
+	}
+	fmt.Printf("All %d checks passed\n", len(results))
+	return true
+}
+
+func containsLine(text, want string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == want {
+			return true
+		}
+	}
+	return false
+}
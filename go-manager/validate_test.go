@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gluetun-proton-manager/selector"
+)
+
+// collect returns an add func for the validate checks and the results it
+// gathers.
+func collect() (func(string, bool, string, ...any), *[]checkResult) {
+	var results []checkResult
+	return func(name string, ok bool, format string, args ...any) {
+		results = append(results, checkResult{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+	}, &results
+}
+
+func TestValidateEnvFile(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	dir := filepath.Dir(cfg.envFile)
+	compose := filepath.Join(dir, "docker-compose.yml")
+	os.WriteFile(compose, []byte("services:\n  gluetun:\n    environment:\n      - PROTON_SERVER_NAME=US#1\n"), 0644)
+	other := filepath.Join(dir, "other-compose.yml")
+	os.WriteFile(other, []byte("services:\n  web:\n    image: nginx\n"), 0644)
+
+	for _, tc := range []struct {
+		name, path, format string
+		ok                 bool
+		detail             string
+	}{
+		{"writable", cfg.envFile, envFormatEnv, true, "is writable"},
+		{"missing", filepath.Join(dir, "missing.env"), envFormatEnv, false, "no such file"},
+		{"directory", dir, envFormatEnv, false, "is a directory"},
+		{"compose", compose, envFormatCompose, true, "is writable"},
+		{"compose without gluetun", other, envFormatCompose, false, `service "gluetun" not found`},
+	} {
+		cfg.envFile, cfg.envFileFormat = tc.path, tc.format
+		add, results := collect()
+		validateEnvFile(add)
+		failed := -1
+		for i, r := range *results {
+			if !r.OK {
+				failed = i
+				break
+			}
+		}
+		if (failed < 0) != tc.ok {
+			t.Errorf("%s: results %+v, want ok=%v", tc.name, *results, tc.ok)
+			continue
+		}
+		detail := (*results)[0].Detail
+		if failed >= 0 {
+			detail = (*results)[failed].Detail
+		}
+		if !strings.Contains(detail, tc.detail) {
+			t.Errorf("%s: detail %q, want it to contain %q", tc.name, detail, tc.detail)
+		}
+	}
+}
+
+func TestValidateTargets(t *testing.T) {
+	servers := testServers()
+	servers[0].City, servers[1].City = "New York", "Chicago"
+
+	for _, tc := range []struct {
+		name      string
+		tiers     []selector.Tier
+		preferred []string
+		want      []checkResult
+	}{
+		{"known country", []selector.Tier{{Name: "US", Countries: []string{"US"}}}, nil,
+			[]checkResult{{Name: "Target US", OK: true}}},
+		{"unknown country", []selector.Tier{{Name: "XX", Countries: []string{"XX"}}}, nil,
+			[]checkResult{{Name: "Target XX", Detail: `no active servers in "XX"`}}},
+		{"unknown city", []selector.Tier{{Name: "US", Countries: []string{"US"}, Cities: []string{"Chicago", " Zurich "}}}, nil,
+			[]checkResult{{Name: "Target US", Detail: `no active servers in "Zurich"`}}},
+		{"city in the default tier", []selector.Tier{{Countries: []string{"US"}, Cities: []string{"Miami"}}}, nil,
+			[]checkResult{{Name: "Target cities", Detail: `no active servers in "Miami"`}}},
+		{"preferred servers", []selector.Tier{{Name: "US", Countries: []string{"US"}}}, []string{"US#1", "US#9"},
+			[]checkResult{{Name: "Target US", OK: true}, {Name: "Preferred servers", Detail: "not in the server list: US#9"}}},
+	} {
+		setupTestEnv(t, "US#1")
+		cfg.targetTiers, cfg.preferredServers = tc.tiers, tc.preferred
+		add, results := collect()
+		validateTargets(servers, add)
+		if len(*results) != len(tc.want) {
+			t.Errorf("%s: results %+v, want %+v", tc.name, *results, tc.want)
+			continue
+		}
+		for i, want := range tc.want {
+			got := (*results)[i]
+			if got.Name != want.Name || got.OK != want.OK || !want.OK && got.Detail != want.Detail {
+				t.Errorf("%s: result %+v, want %+v", tc.name, got, want)
+			}
+		}
+	}
+}
+
+func TestContainsLine(t *testing.T) {
+	services := "gluetun\n  gluetun-green \nqbittorrent\n"
+	for _, tc := range []struct {
+		want string
+		ok   bool
+	}{
+		{"gluetun", true},
+		{"gluetun-green", true},
+		{"glue", false},
+		{"sonarr", false},
+	} {
+		if got := containsLine(services, tc.want); got != tc.ok {
+			t.Errorf("containsLine(%q) = %v, want %v", tc.want, got, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultSecrets keeps all secrets as fields of one HashiCorp Vault KV v2
+// secret, addressed as <mount>/<path> by VAULT_SECRET_PATH.
+type vaultSecrets struct {
+	mu     sync.Mutex
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newVaultSecrets() (*vaultSecrets, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if file := os.Getenv("VAULT_TOKEN_FILE"); token == "" && file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("VAULT_TOKEN_FILE: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if cfg.vaultAddr == "" || token == "" {
+		return nil, fmt.Errorf("the vault backend needs VAULT_ADDR and VAULT_TOKEN (or VAULT_TOKEN_FILE)")
+	}
+	mount, path, ok := strings.Cut(strings.Trim(cfg.vaultSecretPath, "/"), "/")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("VAULT_SECRET_PATH must be <mount>/<path>, got %q", cfg.vaultSecretPath)
+	}
+	return &vaultSecrets{
+		url:    strings.TrimRight(cfg.vaultAddr, "/") + "/v1/" + mount + "/data/" + path,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (v *vaultSecrets) Name() string { return "Vault" }
+
+func (v *vaultSecrets) do(method string, body any) (*http.Response, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequest(method, v.url, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	req.Header.Set("Content-Type", "application/json")
+	return v.client.Do(req)
+}
+
+// read returns every field of the secret; a missing secret has none.
+func (v *vaultSecrets) read() (map[string]string, error) {
+	resp, err := v.do("GET", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]string{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Vault returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if result.Data.Data == nil {
+		return map[string]string{}, nil
+	}
+	return result.Data.Data, nil
+}
+
+func (v *vaultSecrets) Get(key string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fields, err := v.read()
+	if err != nil {
+		return "", err
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", errSecretNotFound
+	}
+	return value, nil
+}
+
+// Set rewrites the secret with key updated. KV v2 writes replace the whole
+// secret, so the other fields are read back first.
+func (v *vaultSecrets) Set(key, value string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fields, err := v.read()
+	if err != nil {
+		return err
+	}
+	fields[key] = value
+
+	resp, err := v.do("POST", map[string]any{"data": fields})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("Vault returned status %d", resp.StatusCode)
+	}
+	return nil
+}
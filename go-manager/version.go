@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=...".
+// Unset values are filled in from the module's VCS stamp where Go recorded
+// one.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuild returns the ldflags values, completed from the Go build info.
+func currentBuild() buildInfo {
+	b := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.time":
+			if b.BuildDate == "" {
+				b.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			b.Modified = s.Value == "true" && commit == ""
+		}
+	}
+	return b
+}
+
+// String is the one-line form logged at startup, e.g.
+// "v1.4.0 (3f2a9c1, 2026-01-02T15:04:05Z, go1.25.7 linux/amd64)".
+func (b buildInfo) String() string {
+	rev := b.Commit
+	if len(rev) > 7 {
+		rev = rev[:7]
+	}
+	if rev == "" {
+		rev = "unknown commit"
+	}
+	if b.Modified {
+		rev += "-dirty"
+	}
+	if b.BuildDate != "" {
+		rev += ", " + b.BuildDate
+	}
+	return fmt.Sprintf("%s (%s, %s %s)", b.Version, rev, b.GoVersion, b.Platform)
+}
+
+// runVersion implements `manager version [--json]`.
+func runVersion(args []string) {
+	b := currentBuild()
+	if len(args) > 0 && (args[0] == "--json" || args[0] == "-json") {
+		json.NewEncoder(os.Stdout).Encode(b)
+		return
+	}
+	fmt.Printf("Version:    %s\n", b.Version)
+	if b.Commit != "" {
+		modified := ""
+		if b.Modified {
+			modified = " (modified)"
+		}
+		fmt.Printf("Commit:     %s%s\n", b.Commit, modified)
+	}
+	if b.BuildDate != "" {
+		fmt.Printf("Built:      %s\n", b.BuildDate)
+	}
+	fmt.Printf("Go version: %s\n", b.GoVersion)
+	fmt.Printf("Platform:   %s\n", b.Platform)
+}
@@ -0,0 +1,139 @@
+// Package wasm runs sandboxed WebAssembly plugins. A plugin is a WASI
+// command module (a .wasm file with a _start function, as built by
+// GOOS=wasip1, TinyGo or Rust's wasm32-wasip1 target) that reads its input on
+// stdin and writes its answer to stdout. It gets no files, environment or
+// network, a memory limit and a deadline, and a fresh instance for every
+// call.
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Limits bound what a plugin may use per call.
+type Limits struct {
+	// Timeout is how long one call may run.
+	Timeout time.Duration
+	// MemoryMB caps the plugin's linear memory.
+	MemoryMB int
+}
+
+// Host compiles and runs plugins.
+type Host struct {
+	runtime wazero.Runtime
+	limits  Limits
+}
+
+// NewHost returns a host enforcing limits.
+func NewHost(limits Limits) (*Host, error) {
+	ctx := context.Background()
+	cfg := wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(uint32(limits.MemoryMB) * 16) // 64 KiB pages
+	r := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	return &Host{runtime: r, limits: limits}, nil
+}
+
+// Close releases the host and its plugins.
+func (h *Host) Close() error { return h.runtime.Close(context.Background()) }
+
+// Plugin is a compiled module.
+type Plugin struct {
+	// Name is the file name without .wasm.
+	Name string
+
+	host   *Host
+	module wazero.CompiledModule
+}
+
+// Load compiles a plugin from a .wasm file.
+func (h *Host) Load(path string) (*Plugin, error) {
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return h.Compile(strings.TrimSuffix(filepath.Base(path), ".wasm"), bin)
+}
+
+// Compile compiles a plugin from the module's bytes.
+func (h *Host) Compile(name string, bin []byte) (*Plugin, error) {
+	module, err := h.runtime.CompileModule(context.Background(), bin)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", name, err)
+	}
+	if _, ok := module.ExportedFunctions()["_start"]; !ok {
+		return nil, fmt.Errorf("plugin %s: not a WASI command module (no _start)", name)
+	}
+	return &Plugin{Name: name, host: h, module: module}, nil
+}
+
+// LoadDir compiles every .wasm file in dir, in name order. A missing
+// directory holds no plugins.
+func (h *Host) LoadDir(dir string) ([]*Plugin, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var plugins []*Plugin
+	for _, path := range paths {
+		p, err := h.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+// Run calls the plugin with input on stdin and returns what it wrote to
+// stdout. A plugin that exits with a non-zero code, traps or runs past the
+// timeout fails, with its stderr in the error.
+func (p *Plugin) Run(input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.host.limits.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cfg := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(p.Name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&stdout).
+		WithStderr(&stderr).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	mod, err := p.host.runtime.InstantiateModule(ctx, p.module, cfg)
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+	var exit *sys.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return nil, fmt.Errorf("plugin %s timed out after %s", p.Name, p.host.limits.Timeout)
+	case errors.As(err, &exit) && exit.ExitCode() == 0:
+	case err != nil:
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("plugin %s: %v: %s", p.Name, err, msg)
+		}
+		return nil, fmt.Errorf("plugin %s: %v", p.Name, err)
+	}
+	return stdout.Bytes(), nil
+}
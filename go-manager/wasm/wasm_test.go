@@ -0,0 +1,99 @@
+package wasm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gluetun-proton-manager/wasm/wasmtest"
+)
+
+func newTestHost(t *testing.T) *Host {
+	t.Helper()
+	h, err := NewHost(Limits{Timeout: time.Second, MemoryMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestRun(t *testing.T) {
+	h := newTestHost(t)
+	echo, err := h.Compile("echo", wasmtest.Echo("CH#4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := echo.Run(nil); err != nil || string(out) != "CH#4\n" {
+		t.Errorf("echo = %q, %v", out, err)
+	}
+
+	cat, err := h.Compile("cat", wasmtest.Cat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every call gets a fresh instance
+	for _, input := range []string{`{"current":"CH#4"}`, "second"} {
+		if out, err := cat.Run([]byte(input)); err != nil || string(out) != input {
+			t.Errorf("cat %q = %q, %v", input, out, err)
+		}
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	h := newTestHost(t)
+	for name, tc := range map[string]struct {
+		module []byte
+		want   string
+	}{
+		"loop": {wasmtest.Loop(), "timed out"},
+		"trap": {wasmtest.Trap(), "unreachable"},
+	} {
+		p, err := h.Compile(name, tc.module)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Run(nil); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: %v, want an error containing %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	h := newTestHost(t)
+	// 1 MB is 16 pages
+	if p, err := h.Compile("big", wasmtest.Pages(17)); err == nil {
+		if _, err := p.Run(nil); err == nil {
+			t.Error("a module needing 17 pages ran with a 1 MB limit")
+		}
+	}
+	if _, err := h.Compile("junk", []byte("not wasm")); err == nil {
+		t.Error("compiled junk")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	h := newTestHost(t)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "b.wasm"), wasmtest.Echo("b"), 0o644)
+	os.WriteFile(filepath.Join(dir, "a.wasm"), wasmtest.Echo("a"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644)
+
+	plugins, err := h.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugins) != 2 || plugins[0].Name != "a" || plugins[1].Name != "b" {
+		t.Fatalf("plugins = %v, want a and b", plugins)
+	}
+	if plugins, err := h.LoadDir(filepath.Join(dir, "missing")); err != nil || len(plugins) != 0 {
+		t.Errorf("missing dir = %v, %v", plugins, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.wasm"), []byte("broken"), 0o644)
+	if _, err := h.LoadDir(dir); err == nil || !strings.Contains(err.Error(), "plugin c") {
+		t.Errorf("broken module: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Package wasmtest assembles tiny WASI command modules for tests, so no
+// toolchain or binary fixtures are needed.
+package wasmtest
+
+import "slices"
+
+// Echo returns a module that writes out to stdout.
+func Echo(out string) []byte {
+	data := slices.Concat(u32(16), u32(len(out)), make([]byte, 8), []byte(out))
+	return command(1, slices.Concat(write, []byte{end}), data)
+}
+
+// Cat returns a module that copies up to 4 KiB of stdin to stdout.
+func Cat() []byte {
+	body := slices.Concat(
+		// fd_read(0, iovs=0, 1, nread=8)
+		i32(0), i32(0), i32(1), i32(8), []byte{call, fdRead, drop},
+		// iov.len = nread
+		i32(4), i32(8), []byte{0x28, 2, 0, 0x36, 2, 0},
+		write, []byte{end},
+	)
+	return command(1, body, slices.Concat(u32(16), u32(4096)))
+}
+
+// Loop returns a module that never returns.
+func Loop() []byte {
+	return command(1, []byte{0x03, 0x40, 0x0c, 0x00, end, end}, nil)
+}
+
+// Trap returns a module that traps at once.
+func Trap() []byte {
+	return command(1, []byte{0x00, end}, nil)
+}
+
+// Pages returns a module that does nothing but needs pages of memory.
+func Pages(pages int) []byte {
+	return command(pages, []byte{end}, nil)
+}
+
+const (
+	fdRead  = 0
+	fdWrite = 1
+	call    = 0x10
+	drop    = 0x1a
+	end     = 0x0b
+)
+
+// write is fd_write(1, iovs=0, 1, nwritten=8).
+var write = slices.Concat(i32(1), i32(0), i32(1), i32(8), []byte{call, fdWrite, drop})
+
+// command assembles a module importing fd_read and fd_write, whose _start
+// runs body with data at address 0 of its memory.
+func command(pages int, body, data []byte) []byte {
+	io := []byte{0x60, 4, 0x7f, 0x7f, 0x7f, 0x7f, 1, 0x7f} // (i32 i32 i32 i32) -> i32
+	start := []byte{0x60, 0, 0}                            // () -> ()
+	wasi := func(name string) []byte {
+		return slices.Concat(str("wasi_snapshot_preview1"), str(name), []byte{0x00, 0})
+	}
+	code := slices.Concat([]byte{0}, body) // no locals
+	return slices.Concat(
+		[]byte("\x00asm\x01\x00\x00\x00"),
+		section(1, vec(io, start)),
+		section(2, vec(wasi("fd_read"), wasi("fd_write"))),
+		section(3, vec([]byte{1})),
+		section(5, vec(slices.Concat([]byte{0}, uleb(pages)))),
+		section(7, vec(
+			slices.Concat(str("memory"), []byte{0x02, 0}),
+			slices.Concat(str("_start"), []byte{0x00, 2}),
+		)),
+		section(10, vec(slices.Concat(uleb(len(code)), code))),
+		section(11, vec(slices.Concat([]byte{0, 0x41, 0, end}, uleb(len(data)), data))),
+	)
+}
+
+func i32(v byte) []byte { return []byte{0x41, v} } // v < 64
+
+func u32(v int) []byte { return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)} }
+
+func uleb(n int) []byte {
+	var b []byte
+	for {
+		c := byte(n & 0x7f)
+		n >>= 7
+		if n != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func str(s string) []byte { return append(uleb(len(s)), s...) }
+
+func vec(items ...[]byte) []byte {
+	b := uleb(len(items))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func section(id byte, content []byte) []byte {
+	return slices.Concat([]byte{id}, uleb(len(content)), content)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gluetun-proton-manager/wasm"
+)
+
+// WASM plugins extend selection and health checks with sandboxed modules
+// dropped into PLUGIN_DIR:
+//
+//	selector/*.wasm  read selectorPluginInput, print the server to use
+//	health/*.wasm    read the daemon's Status, print a reason to switch
+//
+// Modules are WASI commands and get stdin, stdout, stderr, clocks and
+// randomness, nothing else. Each call runs in a fresh instance under
+// WASM_PLUGIN_TIMEOUT and WASM_PLUGIN_MEMORY_MB.
+
+// HealthPolicy judges a tunnel that passed its health check by the daemon's
+// latest measurements, returning a reason to switch away or "" to stay.
+type HealthPolicy interface {
+	Name() string
+	Judge(status Status) (string, error)
+}
+
+var (
+	wasmSelectors  []Selector
+	healthPolicies []HealthPolicy
+)
+
+type wasmSelector struct{ plugin *wasm.Plugin }
+
+func (s wasmSelector) Name() string { return s.plugin.Name }
+
+func (s wasmSelector) Select(candidates []LogicalServer, current string) (string, error) {
+	input, err := json.Marshal(selectorPluginInput{Current: current, Candidates: candidates})
+	if err != nil {
+		return "", err
+	}
+	out, err := s.plugin.Run(input)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(out), nil
+}
+
+type wasmHealthPolicy struct{ plugin *wasm.Plugin }
+
+func (p wasmHealthPolicy) Name() string { return p.plugin.Name }
+
+func (p wasmHealthPolicy) Judge(status Status) (string, error) {
+	input, err := json.Marshal(status)
+	if err != nil {
+		return "", err
+	}
+	out, err := p.plugin.Run(input)
+	if err != nil {
+		return "", err
+	}
+	return firstLine(out), nil
+}
+
+// loadWASMPlugins compiles the modules in PLUGIN_DIR. Without any, no
+// WebAssembly runtime is started.
+func loadWASMPlugins() error {
+	selectorDir, healthDir := filepath.Join(cfg.pluginDir, "selector"), filepath.Join(cfg.pluginDir, "health")
+	found := false
+	for _, dir := range []string{selectorDir, healthDir} {
+		if paths, _ := filepath.Glob(filepath.Join(dir, "*.wasm")); len(paths) > 0 {
+			found = true
+		}
+	}
+	wasmSelectors, healthPolicies = nil, nil
+	if !found {
+		return nil
+	}
+
+	host, err := wasm.NewHost(wasm.Limits{
+		Timeout:  time.Duration(cfg.wasmPluginTimeout) * time.Second,
+		MemoryMB: cfg.wasmPluginMemoryMB,
+	})
+	if err != nil {
+		return err
+	}
+	plugins, err := host.LoadDir(selectorDir)
+	if err != nil {
+		return err
+	}
+	for _, p := range plugins {
+		wasmSelectors = append(wasmSelectors, wasmSelector{p})
+		log(fmt.Sprintf("Loaded selector plugin %s", p.Name))
+	}
+	if plugins, err = host.LoadDir(healthDir); err != nil {
+		return err
+	}
+	for _, p := range plugins {
+		healthPolicies = append(healthPolicies, wasmHealthPolicy{p})
+		log(fmt.Sprintf("Loaded health policy plugin %s", p.Name))
+	}
+	return nil
+}
+
+// judgeHealth asks the health policies about a tunnel that passed its
+// health check and requests a switch for the first one that objects. A
+// policy that fails is ignored.
+func (d *daemon) judgeHealth() {
+	if len(healthPolicies) == 0 {
+		return
+	}
+	d.mu.Lock()
+	status := d.status
+	d.mu.Unlock()
+	for _, p := range healthPolicies {
+		reason, err := p.Judge(status)
+		if err != nil {
+			log(fmt.Sprintf("Health policy %s failed: %v", p.Name(), err))
+			continue
+		}
+		if reason != "" {
+			reason = fmt.Sprintf("Health Policy %s (%s)", p.Name(), reason)
+			log(reason)
+			d.requestFailover(reason)
+			return
+		}
+	}
+}
+
+// wasmPluginProblems reports PLUGIN_DIR settings that can't work.
+func wasmPluginProblems() []string {
+	var problems []string
+	if cfg.wasmPluginTimeout < 1 || cfg.wasmPluginMemoryMB < 1 {
+		problems = append(problems, "WASM_PLUGIN_TIMEOUT and WASM_PLUGIN_MEMORY_MB must be >= 1")
+	}
+	if info, err := os.Stat(cfg.pluginDir); err == nil && !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("PLUGIN_DIR %s is not a directory", cfg.pluginDir))
+	}
+	return problems
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gluetun-proton-manager/wasm/wasmtest"
+)
+
+// writePlugin drops a module into PLUGIN_DIR/kind.
+func writePlugin(t *testing.T, kind, name string, module []byte) {
+	t.Helper()
+	dir := filepath.Join(cfg.pluginDir, kind)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".wasm"), module, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWASMSelectors(t *testing.T) {
+	setupTestEnv(t, "")
+	cfg.pluginDir, cfg.wasmPluginTimeout, cfg.wasmPluginMemoryMB = t.TempDir(), 1, 16
+	servers := []LogicalServer{
+		{Name: "A", Status: 1, Load: 10},
+		{Name: "B", Status: 1, Load: 20},
+		{Name: "C", Status: 1, Load: 30},
+	}
+
+	if err := loadWASMPlugins(); err != nil || len(wasmSelectors) != 0 {
+		t.Fatalf("empty PLUGIN_DIR: %d selectors, %v", len(wasmSelectors), err)
+	}
+
+	// Failing selectors are passed over, in name order
+	writePlugin(t, "selector", "1-trap", wasmtest.Trap())
+	writePlugin(t, "selector", "2-unknown", wasmtest.Echo("Z\n"))
+	writePlugin(t, "selector", "3-pick", wasmtest.Echo("C\n"))
+	writePlugin(t, "selector", "4-other", wasmtest.Echo("B\n"))
+	if err := loadWASMPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	if best, _ := findBestServer(servers, ""); best.Name != "C" {
+		t.Errorf("best = %s, want C from the first working selector", best.Name)
+	}
+
+	// SELECTOR_PLUGIN goes first
+	cfg.selectorPlugin = "echo B"
+	if best, _ := findBestServer(servers, ""); best.Name != "B" {
+		t.Errorf("best = %s, want B from SELECTOR_PLUGIN", best.Name)
+	}
+}
+
+func TestWASMHealthPolicies(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.pluginDir, cfg.wasmPluginTimeout, cfg.wasmPluginMemoryMB = t.TempDir(), 1, 16
+	writePlugin(t, "health", "a-silent", wasmtest.Echo(""))
+	writePlugin(t, "health", "b-strict", wasmtest.Echo("load too high\n"))
+	if err := loadWASMPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t))
+
+	d.judgeHealth()
+	if reason := d.takeFailoverReason(); reason != "Health Policy b-strict (load too high)" {
+		t.Errorf("failover reason = %q", reason)
+	}
+
+	// The status reaches the policy on stdin
+	d.updateStatus(func(s *Status) { s.Server = "US#1" })
+	writePlugin(t, "health", "b-strict", wasmtest.Cat())
+	if err := loadWASMPlugins(); err != nil {
+		t.Fatal(err)
+	}
+	d.judgeHealth()
+	reason := d.takeFailoverReason()
+	status, ok := strings.CutPrefix(reason, "Health Policy b-strict (")
+	var got Status
+	if !ok || json.Unmarshal([]byte(strings.TrimSuffix(status, ")")), &got) != nil || got.Server != "US#1" {
+		t.Errorf("failover reason = %q, want the status as JSON", reason)
+	}
+}
+
+func TestLoadWASMPluginsRejectsBrokenModules(t *testing.T) {
+	setupTestEnv(t, "")
+	cfg.pluginDir, cfg.wasmPluginTimeout, cfg.wasmPluginMemoryMB = t.TempDir(), 1, 16
+	writePlugin(t, "health", "broken", []byte("not wasm"))
+	if err := loadWASMPlugins(); err == nil {
+		t.Error("loaded a broken module")
+	}
+}
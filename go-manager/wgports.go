@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Proton's WireGuard servers listen on several UDP ports. cfg.wireguardPorts
+// is the ordered fallback list and wgPortIndex the one in use; after init
+// both are only touched under the daemon's opMu.
+var wgPortIndex int
+
+func parseWireguardPorts(spec string) []string {
+	var ports []string
+	for _, p := range strings.Split(spec, ",") {
+		p = strings.TrimSpace(p)
+		if n, err := strconv.Atoi(p); err == nil && n > 0 && n < 65536 {
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		ports = []string{"51820"}
+	}
+	return ports
+}
+
+// preferWireguardPort moves port, the WIREGUARD_ENDPOINT_PORT setting, to
+// the front of ports, adding it if the list lacks it.
+func preferWireguardPort(ports []string, port string) []string {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return ports
+	}
+	preferred := []string{port}
+	for _, p := range ports {
+		if p != port {
+			preferred = append(preferred, p)
+		}
+	}
+	return preferred
+}
+
+func wireguardPort() string {
+	return cfg.wireguardPorts[wgPortIndex]
+}
+
+// syncWireguardPort continues with the port recorded in the env file, so a
+// manager restart doesn't go back to a port that was already failing.
+func syncWireguardPort(port string) {
+	for i, p := range cfg.wireguardPorts {
+		if p == port {
+			wgPortIndex = i
+			return
+		}
+	}
+}
+
+// rotateWireguardPort moves on to the next port in the list, wrapping around.
+// It returns false if there is no other port to try.
+func rotateWireguardPort(why string) bool {
+	if len(cfg.wireguardPorts) < 2 {
+		return false
+	}
+	prev := wireguardPort()
+	wgPortIndex = (wgPortIndex + 1) % len(cfg.wireguardPorts)
+	log(fmt.Sprintf("Rotating WireGuard port %s -> %s (%s)", prev, wireguardPort(), why))
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseWireguardPorts(t *testing.T) {
+	for _, tc := range []struct {
+		spec, endpointPort string
+		want               []string
+	}{
+		{"51820,88,1224", "", []string{"51820", "88", "1224"}},
+		{" 88 , ,4569,", "", []string{"88", "4569"}},
+		{"0,65536,udp,-1", "", []string{"51820"}},
+		{"", "", []string{"51820"}},
+		// WIREGUARD_ENDPOINT_PORT goes first, whether or not the list has it
+		{"51820,88,1224", "1224", []string{"1224", "51820", "88"}},
+		{"51820,88", "443", []string{"443", "51820", "88"}},
+		{"51820,88", "99999", []string{"51820", "88"}},
+	} {
+		got := preferWireguardPort(parseWireguardPorts(tc.spec), tc.endpointPort)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("WIREGUARD_PORTS=%q WIREGUARD_ENDPOINT_PORT=%q: %v, want %v", tc.spec, tc.endpointPort, got, tc.want)
+		}
+	}
+}
+
+func TestRotateWireguardPort(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	if rotateWireguardPort("test") || wireguardPort() != "51820" {
+		t.Error("rotated with a single port")
+	}
+
+	cfg.wireguardPorts = []string{"51820", "88", "1224"}
+	syncWireguardPort("88")
+	if wireguardPort() != "88" {
+		t.Fatalf("port = %s after syncing to 88", wireguardPort())
+	}
+	syncWireguardPort("4569") // not in the list
+	if wireguardPort() != "88" {
+		t.Errorf("port = %s after syncing to an unknown port", wireguardPort())
+	}
+	var seen []string
+	for range 3 {
+		if !rotateWireguardPort("test") {
+			t.Fatal("no rotation")
+		}
+		seen = append(seen, wireguardPort())
+	}
+	if !slices.Equal(seen, []string{"1224", "51820", "88"}) {
+		t.Errorf("rotated through %v", seen)
+	}
+}
+
+func TestHandshakeFailuresRotatePort(t *testing.T) {
+	setupTestEnv(t, "US#1")
+	cfg.wireguardPorts = []string{"51820", "88"}
+	d := newTestDaemon(newMockServerSource(t, testServers()...), newMockRuntime(t), newMockHealth(t, true))
+
+	d.requestPortRotation()
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if wireguardPort() != "88" {
+		t.Errorf("port = %s, want 88 after handshake failures", wireguardPort())
+	}
+	// The request is used up
+	if err := d.checkLoad(); err != nil {
+		t.Fatal(err)
+	}
+	if wireguardPort() != "88" {
+		t.Errorf("port = %s, rotated again without new failures", wireguardPort())
+	}
+}